@@ -1,25 +1,69 @@
 package coingecko
 
-// GetTokensPrices queries the remote APIs to get the token prices of all the tokens having the given ids
-// func GetBtcPrice(currency string, ids []string) (float64, error) {
-// 	var prices []MarketTicker
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
 
-// 	resp, err := http.Get("https://api.coingecko.com/api/v3/simple/price?ids=bitcoin&vs_currencies=usd")
-// 	if err != nil {
-// 		return 0, err
-// 	}
+	"github.com/shopspring/decimal"
+)
 
-// 	defer resp.Body.Close()
+const DefaultBaseURL = "https://api.coingecko.com/api/v3"
 
-// 	bz, err := ioutil.ReadAll(resp.Body)
-// 	if err != nil {
-// 		return 0, fmt.Errorf("error while reading response body: %s", err)
-// 	}
+// GetBtcPrices queries the simple price api for the price of a bitcoin in each of the currencies, e.g. usd.
+// The prices are read as exact decimals, a currency the api has no price for is an error.
+func GetBtcPrices(ctx context.Context, client *http.Client, baseURL string, currencies []string) (map[string]decimal.Decimal, error) {
+	query := url.Values{}
+	query.Set("ids", "bitcoin")
+	query.Set("vs_currencies", strings.Join(currencies, ","))
+	query.Set("precision", "full")
 
-// 	err = json.Unmarshal(bz, &prices)
-// 	if err != nil {
-// 		return 0, fmt.Errorf("error while unmarshaling response body: %s", err)
-// 	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/simple/price?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
 
-// 	return prices[0].CurrentPrice, nil
-// }
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	bz, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error while reading response body: %s", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error! Request Failed: %s with StatusCode: %d. Error: %s", resp.Status, resp.StatusCode, string(bz))
+	}
+
+	var prices map[string]map[string]json.Number
+	decoder := json.NewDecoder(bytes.NewReader(bz))
+	decoder.UseNumber()
+	if err := decoder.Decode(&prices); err != nil {
+		return nil, fmt.Errorf("error while unmarshaling response body: %s", err)
+	}
+
+	btcPrices := make(map[string]decimal.Decimal)
+	for _, currency := range currencies {
+		price, ok := prices["bitcoin"][strings.ToLower(currency)]
+		if !ok {
+			return nil, fmt.Errorf("no bitcoin price in currency {%s}", currency)
+		}
+
+		btcPrices[currency], err = decimal.NewFromString(price.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid bitcoin price {%s} in currency {%s}: %s", price, currency, err)
+		}
+	}
+
+	return btcPrices, nil
+}
@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/notifier"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/requesters"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/resilience"
+	services "github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/services"
+	"github.com/spf13/cobra"
+)
+
+// newDryRunCmd runs the pay service once in dry run mode and prints the report as json to stdout
+func newDryRunCmd() *cobra.Command {
+	var farm string
+
+	dryRunCmd := &cobra.Command{
+		Use:   "dry-run",
+		Short: "Calculate the payouts and print them without sending anything or writing to the db",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			provider := infrastructure.NewProvider(config)
+			requestClient := requesters.NewRequester(config, resilience.NewBreakers(config.BreakerFailureThreshold, config.BreakerOpenTimeout))
+
+			rpcClient, err := provider.InitBtcRpcClient()
+			if err != nil {
+				return fmt.Errorf("failed to connect to bitcoin node: %s", err)
+			}
+			defer rpcClient.Shutdown()
+
+			storage, closeStorage, err := openStorage(provider)
+			if err != nil {
+				return err
+			}
+			defer closeStorage()
+
+			if err := storage.CheckSchemaVersion(cmd.Context()); err != nil {
+				return err
+			}
+
+			alerts := notifier.NewAlertManager(notifier.New(config), config.AlertCooldown, config.AlertDigestInterval)
+			// dry runs never unlock the wallets, so no secret provider is needed
+			payService := services.NewPayService(config, requestClient, infrastructure.NewHelper(config), alerts, newBtcNetworkParams(config), nil, nil)
+
+			btcClient := services.NewBtcNodeClient(rpcClient, provider.InitBtcWalletRpcClient, services.NewWalletLocks())
+			report, err := payService.DryRunFarm(cmd.Context(), btcClient, storage, farm)
+			if err != nil {
+				return fmt.Errorf("dry run failed: %s", err)
+			}
+
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(report)
+		},
+	}
+
+	dryRunCmd.Flags().StringVar(&farm, "farm", "", "id, name or wallet name of the only farm to calculate")
+
+	return dryRunCmd
+}
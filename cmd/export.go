@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	services "github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/services"
+	"github.com/spf13/cobra"
+)
+
+// newExportCmd exports the breakdown of a farm payment, or of the farm payments created in a period, as csv or json
+func newExportCmd() *cobra.Command {
+	var farmPaymentId int64
+	var from, to, format, currency string
+
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export the breakdown of farm payments, from the received UTXO to the payout transactions",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := services.FarmPaymentExportQuery{FarmPaymentId: farmPaymentId}
+			if farmPaymentId == 0 {
+				if from == "" || to == "" {
+					return fmt.Errorf("either --farm-payment-id or both --from and --to are required")
+				}
+
+				var err error
+				if query.From, err = services.ParseExportTime(from); err != nil {
+					return err
+				}
+				if query.To, err = services.ParseExportTime(to); err != nil {
+					return err
+				}
+			}
+
+			if format != services.ExportFormatCSV && format != services.ExportFormatJSON {
+				return fmt.Errorf("invalid --format {%s}, expected %s or %s", format, services.ExportFormatCSV, services.ExportFormatJSON)
+			}
+
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			storage, closeStorage, err := openStorage(infrastructure.NewProvider(config))
+			if err != nil {
+				return err
+			}
+			defer closeStorage()
+
+			query.Currency = strings.ToLower(currency)
+			if query.Currency == "" {
+				query.Currency = config.DefaultFiatCurrency()
+			}
+
+			exports, err := services.ExportFarmPayments(cmd.Context(), storage, query)
+			if err != nil {
+				return err
+			}
+
+			return services.WriteFarmPaymentExports(cmd.OutOrStdout(), format, exports)
+		},
+	}
+
+	exportCmd.Flags().Int64Var(&farmPaymentId, "farm-payment-id", 0, "id of the farm payment to export")
+	exportCmd.Flags().StringVar(&from, "from", "", "export the farm payments created at or after this date, e.g. 2023-07-01")
+	exportCmd.Flags().StringVar(&to, "to", "", "export the farm payments created before this date")
+	exportCmd.Flags().StringVar(&format, "format", services.ExportFormatCSV, "output format: csv or json")
+	exportCmd.Flags().StringVar(&currency, "currency", "", "fiat currency to value the amounts in, the first of PRICE_FIAT_CURRENCIES by default")
+
+	return exportCmd
+}
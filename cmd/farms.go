@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/spf13/cobra"
+)
+
+func newFarmsCmd() *cobra.Command {
+	farmsCmd := &cobra.Command{
+		Use:   "farms",
+		Short: "Inspect the farms",
+	}
+
+	farmsCmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the approved farms with their pause state and pay schedule",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			storage, closeStorage, err := openStorage(infrastructure.NewProvider(config))
+			if err != nil {
+				return err
+			}
+			defer closeStorage()
+
+			ctx := cmd.Context()
+			if err := storage.CheckSchemaVersion(ctx); err != nil {
+				return err
+			}
+
+			farms, err := storage.GetApprovedFarms(ctx)
+			if err != nil {
+				return err
+			}
+
+			pausedFarmIds, err := storage.GetPausedFarmIds(ctx)
+			if err != nil {
+				return err
+			}
+			pausedFarms := make(map[int64]bool)
+			for _, farmId := range pausedFarmIds {
+				pausedFarms[farmId] = true
+			}
+
+			farmSchedules, err := storage.GetFarmSchedules(ctx)
+			if err != nil {
+				return err
+			}
+			schedules := make(map[int64]string)
+			lastRuns := make(map[int64]string)
+			for _, farmSchedule := range farmSchedules {
+				schedules[farmSchedule.FarmId] = farmSchedule.Schedule
+				if farmSchedule.LastRunAt != nil {
+					lastRuns[farmSchedule.FarmId] = farmSchedule.LastRunAt.UTC().Format(time.RFC3339)
+				}
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tNAME\tWALLET\tPAUSED\tSCHEDULE\tLAST SCHEDULED RUN")
+			for _, farm := range farms {
+				farmSchedule := schedules[farm.Id]
+				if farmSchedule == "" {
+					farmSchedule = config.PaySchedule
+				}
+				if farmSchedule == "" {
+					farmSchedule = "-"
+				}
+
+				lastRun := lastRuns[farm.Id]
+				if lastRun == "" {
+					lastRun = "-"
+				}
+
+				fmt.Fprintf(w, "%d\t%s\t%s\t%t\t%s\t%s\n", farm.Id, farm.Name, farm.RewardsFromPoolBtcWalletName, pausedFarms[farm.Id], farmSchedule, lastRun)
+			}
+
+			return w.Flush()
+		},
+	})
+
+	return farmsCmd
+}
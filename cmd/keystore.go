@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/secrets"
+	"github.com/spf13/cobra"
+)
+
+func newKeystoreCmd() *cobra.Command {
+	keystoreCmd := &cobra.Command{
+		Use:   "keystore",
+		Short: "Manage the encrypted keystore with the farm wallet passphrases",
+	}
+
+	keystoreCmd.AddCommand(&cobra.Command{
+		Use:   "set <wallet-name>",
+		Short: "Encrypt the passphrase of the wallet read from stdin into the keystore",
+		Long: `Encrypt the passphrase of the wallet read from stdin into SECRETS_KEYSTORE_PATH with the password in SECRETS_KEYSTORE_PASSWORD_FILE.
+The keystore is created if it does not exist. The passphrase is read from stdin, so it does not end up in the shell history:
+
+  aura-pay keystore set farm-1 < farm-1-passphrase.txt`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			if config.SecretsKeystorePath == "" || config.SecretsKeystorePasswordFile == "" {
+				return errors.New("SECRETS_KEYSTORE_PATH and SECRETS_KEYSTORE_PASSWORD_FILE must be set")
+			}
+
+			password, err := secrets.ReadSecretFile(config.SecretsKeystorePasswordFile)
+			if err != nil {
+				return fmt.Errorf("failed to read keystore password: %s", err)
+			}
+			defer password.Wipe()
+
+			passphrase, err := secrets.ReadSecret(cmd.InOrStdin())
+			if err != nil {
+				return fmt.Errorf("failed to read passphrase: %s", err)
+			}
+			defer passphrase.Wipe()
+
+			if err := secrets.SetKeystorePassphrase(config.SecretsKeystorePath, password, args[0], passphrase); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "passphrase of wallet %s saved in %s\n", args[0], config.SecretsKeystorePath)
+			return nil
+		},
+	})
+
+	return keystoreCmd
+}
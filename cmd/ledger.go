@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/spf13/cobra"
+)
+
+func newLedgerCmd() *cobra.Command {
+	ledgerCmd := &cobra.Command{
+		Use:   "ledger",
+		Short: "Inspect the double-entry ledger of the payouts",
+	}
+
+	ledgerCmd.AddCommand(&cobra.Command{
+		Use:   "verify",
+		Short: "Check that the ledger balances and agrees with the payment statistics and the accumulated amounts",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			storage, closeStorage, err := openStorage(infrastructure.NewProvider(config))
+			if err != nil {
+				return err
+			}
+			defer closeStorage()
+
+			ctx := cmd.Context()
+			if err := storage.CheckSchemaVersion(ctx); err != nil {
+				return err
+			}
+
+			problems, err := storage.VerifyLedger(ctx)
+			if err != nil {
+				return err
+			}
+
+			for _, problem := range problems {
+				fmt.Fprintln(cmd.OutOrStdout(), problem)
+			}
+
+			if len(problems) != 0 {
+				return fmt.Errorf("ledger verification found %d problems", len(problems))
+			}
+
+			fmt.Fprintln(cmd.OutOrStdout(), "ledger is consistent")
+			return nil
+		},
+	})
+
+	return ledgerCmd
+}
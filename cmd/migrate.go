@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/sql_db"
+	"github.com/spf13/cobra"
+)
+
+func newMigrateCmd() *cobra.Command {
+	migrateCmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage the db schema",
+	}
+
+	migrateCmd.AddCommand(&cobra.Command{
+		Use:   "up",
+		Short: "Apply all migrations that are not applied yet",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			storage, closeStorage, err := openMigrationStorage()
+			if err != nil {
+				return err
+			}
+			defer closeStorage()
+
+			applied, err := storage.MigrateUp(cmd.Context())
+			printMigrations(cmd, "applied", applied)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "schema is at version %d\n", sql_db.SchemaVersion())
+			return nil
+		},
+	})
+
+	var steps int
+	downCmd := &cobra.Command{
+		Use:   "down",
+		Short: "Revert the last applied migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if steps <= 0 {
+				return fmt.Errorf("--steps must be positive, got %d", steps)
+			}
+
+			storage, closeStorage, err := openMigrationStorage()
+			if err != nil {
+				return err
+			}
+			defer closeStorage()
+
+			reverted, err := storage.MigrateDown(cmd.Context(), steps)
+			printMigrations(cmd, "reverted", reverted)
+			return err
+		},
+	}
+	downCmd.Flags().IntVar(&steps, "steps", 1, "number of migrations to revert")
+	migrateCmd.AddCommand(downCmd)
+
+	migrateCmd.AddCommand(&cobra.Command{
+		Use:   "status",
+		Short: "List the migrations and when they were applied",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			storage, closeStorage, err := openMigrationStorage()
+			if err != nil {
+				return err
+			}
+			defer closeStorage()
+
+			statuses, err := storage.MigrationStatus(cmd.Context())
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+			for _, status := range statuses {
+				appliedAt := "pending"
+				if status.AppliedAt != nil {
+					appliedAt = status.AppliedAt.UTC().Format(time.RFC3339)
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+			}
+
+			return w.Flush()
+		},
+	})
+
+	return migrateCmd
+}
+
+func openMigrationStorage() (*sql_db.SqlDB, func(), error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return openStorage(infrastructure.NewProvider(config))
+}
+
+func printMigrations(cmd *cobra.Command, action string, migrations []sql_db.Migration) {
+	for _, migration := range migrations {
+		fmt.Fprintf(cmd.OutOrStdout(), "%s %d_%s\n", action, migration.Version, migration.Name)
+	}
+}
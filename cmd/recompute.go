@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	services "github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/services"
+	"github.com/spf13/cobra"
+)
+
+// newRecomputeCmd recomputes the totals of a farm payment from its statistics and prints them as json.
+// The command fails if the statistics are not consistent.
+func newRecomputeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "recompute <farm-payment-id>",
+		Short: "Recompute the totals of a farm payment from its statistics and check them",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			farmPaymentId, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid farm payment id {%s}: %s", args[0], err)
+			}
+
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			storage, closeStorage, err := openStorage(infrastructure.NewProvider(config))
+			if err != nil {
+				return err
+			}
+			defer closeStorage()
+
+			ctx := cmd.Context()
+			farmPayment, err := storage.GetFarmPayment(ctx, farmPaymentId)
+			if err != nil {
+				return fmt.Errorf("failed to get farm payment {%d}: %s", farmPaymentId, err)
+			}
+
+			allocations, err := storage.GetCollectionPaymentAllocations(ctx, farmPaymentId)
+			if err != nil {
+				return err
+			}
+
+			collections, err := storage.GetFarmAuraPoolCollections(ctx, farmPayment.FarmId)
+			if err != nil {
+				return err
+			}
+
+			statistics, err := storage.GetNFTStatisticsByFarmPayment(ctx, farmPaymentId)
+			if err != nil {
+				return err
+			}
+
+			recomputation := services.RecomputeFarmPayment(farmPayment, allocations, collections, statistics)
+
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(recomputation); err != nil {
+				return err
+			}
+
+			if len(recomputation.Mismatches) > 0 {
+				return fmt.Errorf("farm payment {%d} has %d mismatches", farmPaymentId, len(recomputation.Mismatches))
+			}
+
+			return nil
+		},
+	}
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/sql_db"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// Version and Commit are set by the Makefile through ldflags
+var (
+	Version = "dev"
+	Commit  = ""
+)
+
+const defaultConfigFile = ".env"
+
+// configFile is the config file given with the --config flag
+var configFile string
+
+// NewRootCmd returns the aura-pay command with all of its subcommands
+func NewRootCmd() *cobra.Command {
+	rootCmd := &cobra.Command{
+		Use:          "aura-pay",
+		Short:        "Pays the bitcoin rewards of the farms to the owners of their NFTs",
+		SilenceUsage: true,
+	}
+
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", defaultConfigFile, "config file in env, yaml or toml format, environment variables override its values")
+
+	rootCmd.AddCommand(
+		newRunCmd(),
+		newDryRunCmd(),
+		newFarmsCmd(),
+		newTxCmd(),
+		newRecomputeCmd(),
+		newExportCmd(),
+		newStatementCmd(),
+		newThresholdsCmd(),
+		newKeystoreCmd(),
+		newMigrateCmd(),
+		newLedgerCmd(),
+		newVersionCmd(),
+	)
+
+	return rootCmd
+}
+
+// Execute runs the command given on the command line
+func Execute() error {
+	return NewRootCmd().Execute()
+}
+
+// loadConfig loads the config file and the environment and fails on any problem with the config.
+// Without the default .env file the config is read from the environment only.
+func loadConfig() (*infrastructure.Config, error) {
+	file := configFile
+	if file == defaultConfigFile {
+		if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+			log.Info().Msgf("No %s file found, reading the config from the environment", defaultConfigFile)
+			file = ""
+		}
+	}
+
+	return infrastructure.LoadConfig(file)
+}
+
+// openStorage connects to the db. The returned func closes the connection.
+func openStorage(provider *infrastructure.Provider) (*sql_db.SqlDB, func(), error) {
+	db, err := provider.InitDBConnection()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to db: %s", err)
+	}
+
+	return sql_db.NewSqlDB(db), func() { db.Close() }, nil
+}
+
+func newBtcNetworkParams(config *infrastructure.Config) *types.BtcNetworkParams {
+	btcNetworkParams := types.BtcNetworkParams{
+		ChainParams:      config.ChainParams(),
+		MinConfirmations: 6,
+	}
+	if config.IsTesting {
+		btcNetworkParams.MinConfirmations = 1
+	}
+
+	return &btcNetworkParams
+}
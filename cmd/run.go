@@ -0,0 +1,171 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	worker "github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/admin"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/notifier"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/price"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/requesters"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/resilience"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/schedule"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/secrets"
+	services "github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/services"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/sql_db"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func newRunCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "run",
+		Short: "Run the pay, retry, sweep and accrual reconcile workers and the admin api",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runService(cmd.Context())
+		},
+	}
+}
+
+// runService refuses to start on an invalid config, otherwise it runs until the context is done
+func runService(ctx context.Context) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	retrySchedule, err := newRetrySchedule(config)
+	if err != nil {
+		return err
+	}
+
+	sweepSchedule, err := newSweepSchedule(config)
+	if err != nil {
+		return err
+	}
+
+	if err := checkSchemaVersion(ctx, config); err != nil {
+		return err
+	}
+
+	secretProvider, err := secrets.NewProvider(config)
+	if err != nil {
+		return err
+	}
+
+	priceSource, err := price.NewSource(config)
+	if err != nil {
+		return err
+	}
+
+	// a core dump would contain the wallet passphrases in use
+	if err := secrets.DisableCoreDumps(); err != nil {
+		log.Warn().Msgf("Failed to disable core dumps: %s", err)
+	}
+
+	ctx, ctxCancel := context.WithCancel(ctx)
+
+	provider := infrastructure.NewProvider(config)
+	// the breakers are shared, so both workers pause while a common dependency is unavailable
+	breakers := resilience.NewBreakers(config.BreakerFailureThreshold, config.BreakerOpenTimeout)
+	requestClient := requesters.NewRequester(config, breakers)
+
+	btcNetworkParams := newBtcNetworkParams(config)
+	walletLocks := services.NewWalletLocks()
+
+	// all services share the alert manager, so the same failure is not reported by each of them
+	alerts := notifier.NewAlertManager(notifier.New(config), config.AlertCooldown, config.AlertDigestInterval)
+	go alerts.Run(ctx)
+
+	retryService := services.NewRetryService(config, requestClient, infrastructure.NewHelper(config), alerts, btcNetworkParams, secretProvider)
+	payService := services.NewPayService(config, requestClient, infrastructure.NewHelper(config), alerts, btcNetworkParams, secretProvider, priceSource)
+
+	retryControl := worker.NewControl("retry")
+	payControl := worker.NewControl("pay")
+
+	startAdminApi(ctx, config, provider, payService, payControl, retryControl)
+
+	// only the replica that holds the lease runs the workers, the others are standing by
+	leader := worker.NewLeader(worker.LeaseName, config.LeaderId, config.LeaderLeaseTtl)
+	go leader.Start(ctx, config, provider)
+
+	go worker.Start(ctx, ctxCancel, config, retryService, provider, walletLocks, leader, alerts, breakers, retrySchedule, retryControl)
+
+	if sweepSchedule != nil {
+		sweepService := services.NewSweepService(config, requestClient, infrastructure.NewHelper(config), alerts, btcNetworkParams, secretProvider, priceSource)
+		go worker.Start(ctx, ctxCancel, config, sweepService, provider, walletLocks, leader, alerts, breakers, sweepSchedule, worker.NewControl("sweep"))
+	} else {
+		log.Info().Msg("SWEEP_SCHEDULE is not set, the aged accumulated amounts are not swept")
+	}
+
+	reconcileService := services.NewReconcileAccrualsService(config, requestClient)
+	go worker.Start(ctx, ctxCancel, config, reconcileService, provider, walletLocks, leader, alerts, breakers, schedule.Every(config.AccrualReconcileInterval), worker.NewControl("reconcile"))
+
+	// the pay worker checks every interval which farms are due, the farms follow PAY_SCHEDULE or their own schedules
+	worker.Start(ctx, ctxCancel, config, payService, provider, walletLocks, leader, alerts, breakers, schedule.Every(config.WorkerProcessIntervalPayment), payControl)
+	return nil
+}
+
+// checkSchemaVersion refuses to start on a schema the workers are not built for.
+// The workers check it again on every connection, in case the schema is migrated while the service is running.
+func checkSchemaVersion(ctx context.Context, config *infrastructure.Config) error {
+	storage, closeStorage, err := openStorage(infrastructure.NewProvider(config))
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	return storage.CheckSchemaVersion(ctx)
+}
+
+// newRetrySchedule returns the schedule of the retry worker.
+// Without RETRY_SCHEDULE the retry worker runs every WORKER_PROCESS_INTERVAL_RETRY.
+func newRetrySchedule(config *infrastructure.Config) (schedule.Schedule, error) {
+	if config.RetrySchedule == "" {
+		return schedule.Every(config.WorkerProcessIntervalRetry), nil
+	}
+
+	retrySchedule, err := schedule.Parse(config.RetrySchedule, config.ScheduleTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RETRY_SCHEDULE: %s", err)
+	}
+
+	return retrySchedule, nil
+}
+
+// newSweepSchedule returns the schedule of the sweep worker, or nil if the sweep is disabled because SWEEP_SCHEDULE is not set
+func newSweepSchedule(config *infrastructure.Config) (schedule.Schedule, error) {
+	if config.SweepSchedule == "" {
+		return nil, nil
+	}
+
+	sweepSchedule, err := schedule.Parse(config.SweepSchedule, config.ScheduleTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SWEEP_SCHEDULE: %s", err)
+	}
+
+	return sweepSchedule, nil
+}
+
+// startAdminApi starts the admin api in the background.
+// Without admin token only the health probes and the metrics are served.
+func startAdminApi(ctx context.Context, config *infrastructure.Config, provider *infrastructure.Provider, payService *services.PayService, payControl, retryControl *worker.Control) {
+	if config.AdminApiToken == "" {
+		log.Warn().Msg("ADMIN_API_TOKEN is not set, admin api endpoints are disabled")
+	}
+
+	db, err := provider.InitDBConnection()
+	if err != nil {
+		log.Error().Msgf("Failed to connect to db, admin api is disabled: %s", err)
+		return
+	}
+
+	adminServer := admin.NewServer(config, payService, sql_db.NewSqlDB(db), payControl, retryControl)
+	go func() {
+		adminServer.Start(ctx)
+		db.Close()
+	}()
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	services "github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/services"
+	"github.com/spf13/cobra"
+)
+
+// newStatementCmd writes the earnings statement of a nft owner for a period as html or csv
+func newStatementCmd() *cobra.Command {
+	var owner, from, to, format, currency string
+
+	statementCmd := &cobra.Command{
+		Use:   "statement",
+		Short: "Write what a nft owner earned in a period, what is still held for them and the transactions that paid them",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if owner == "" || from == "" || to == "" {
+				return fmt.Errorf("--owner, --from and --to are required")
+			}
+
+			query := services.OwnerStatementQuery{Owner: owner}
+			var err error
+			if query.From, err = services.ParseExportTime(from); err != nil {
+				return err
+			}
+			if query.To, err = services.ParseExportTime(to); err != nil {
+				return err
+			}
+
+			if format != services.StatementFormatHTML && format != services.StatementFormatCSV {
+				return fmt.Errorf("invalid --format {%s}, expected %s or %s", format, services.StatementFormatHTML, services.StatementFormatCSV)
+			}
+
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			storage, closeStorage, err := openStorage(infrastructure.NewProvider(config))
+			if err != nil {
+				return err
+			}
+			defer closeStorage()
+
+			query.Currency = strings.ToLower(currency)
+			if query.Currency == "" {
+				query.Currency = config.DefaultFiatCurrency()
+			}
+
+			statement, err := services.GenerateOwnerStatement(cmd.Context(), storage, query)
+			if err != nil {
+				return err
+			}
+
+			return services.WriteOwnerStatement(cmd.OutOrStdout(), format, statement)
+		},
+	}
+
+	statementCmd.Flags().StringVar(&owner, "owner", "", "cudos address of the nft owner")
+	statementCmd.Flags().StringVar(&from, "from", "", "start of the period, e.g. 2023-07-01")
+	statementCmd.Flags().StringVar(&to, "to", "", "end of the period, not included")
+	statementCmd.Flags().StringVar(&format, "format", services.StatementFormatHTML, "output format: html or csv")
+	statementCmd.Flags().StringVar(&currency, "currency", "", "fiat currency to value the amounts in, the first of PRICE_FIAT_CURRENCIES by default")
+
+	return statementCmd
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/spf13/cobra"
+)
+
+func newThresholdsCmd() *cobra.Command {
+	thresholdsCmd := &cobra.Command{
+		Use:   "thresholds",
+		Short: "Inspect the amounts accumulated under the payout threshold",
+	}
+
+	thresholdsCmd.AddCommand(&cobra.Command{
+		Use:   "show <address>",
+		Short: "Show the amounts accumulated for the address in each farm",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			storage, closeStorage, err := openStorage(infrastructure.NewProvider(config))
+			if err != nil {
+				return err
+			}
+			defer closeStorage()
+
+			thresholdAmounts, err := storage.GetThresholdAmountsByAddress(cmd.Context(), args[0])
+			if err != nil {
+				return err
+			}
+
+			if len(thresholdAmounts) == 0 {
+				return fmt.Errorf("no accumulated amounts found for address {%s}", args[0])
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintf(w, "FARM ID\tACCUMULATED BTC\tTHRESHOLD BTC\n")
+			for _, thresholdAmount := range thresholdAmounts {
+				fmt.Fprintf(w, "%s\t%s\t%v\n", thresholdAmount.FarmId, thresholdAmount.AmountBTC, config.GlobalPayoutThresholdInBTC)
+			}
+
+			return w.Flush()
+		},
+	})
+
+	return thresholdsCmd
+}
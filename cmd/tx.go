@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/notifier"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/requesters"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/resilience"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/secrets"
+	services "github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/services"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/spf13/cobra"
+)
+
+func newTxCmd() *cobra.Command {
+	txCmd := &cobra.Command{
+		Use:   "tx",
+		Short: "Inspect and bump the payout transactions",
+	}
+
+	txCmd.AddCommand(newTxListCmd(), newTxBumpCmd())
+
+	return txCmd
+}
+
+func newTxListCmd() *cobra.Command {
+	var status string
+
+	txListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the payout transactions with the given status",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch status {
+			case types.TransactionPending, types.TransactionCompleted, types.TransactionFailed, types.TransactionReplaced:
+			default:
+				return fmt.Errorf("invalid status {%s}, expected one of %s, %s, %s, %s", status,
+					types.TransactionPending, types.TransactionCompleted, types.TransactionFailed, types.TransactionReplaced)
+			}
+
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			storage, closeStorage, err := openStorage(infrastructure.NewProvider(config))
+			if err != nil {
+				return err
+			}
+			defer closeStorage()
+
+			txs, err := storage.GetTxHashesByStatus(cmd.Context(), status)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TX HASH\tFARM WALLET\tFARM PAYMENT ID\tRETRY COUNT\tTIME SENT")
+			for _, tx := range txs {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", tx.TxHash, tx.FarmBtcWalletName, tx.FarmPaymentId, tx.RetryCount, time.Unix(tx.TimeSent, 0).UTC().Format(time.RFC3339))
+			}
+
+			return w.Flush()
+		},
+	}
+
+	txListCmd.Flags().StringVar(&status, "status", types.TransactionPending, "status of the transactions: Pending, Completed, Failed or Replaced")
+
+	return txListCmd
+}
+
+// newTxBumpCmd replaces a stuck transaction with a higher fee one, without waiting for the retry worker
+func newTxBumpCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "bump <tx-hash>",
+		Short: "Bump the fee of a pending or failed transaction",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			config, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			secretProvider, err := secrets.NewProvider(config)
+			if err != nil {
+				return err
+			}
+
+			provider := infrastructure.NewProvider(config)
+			requestClient := requesters.NewRequester(config, resilience.NewBreakers(config.BreakerFailureThreshold, config.BreakerOpenTimeout))
+
+			rpcClient, err := provider.InitBtcRpcClient()
+			if err != nil {
+				return fmt.Errorf("failed to connect to bitcoin node: %s", err)
+			}
+			defer rpcClient.Shutdown()
+
+			storage, closeStorage, err := openStorage(provider)
+			if err != nil {
+				return err
+			}
+			defer closeStorage()
+
+			alerts := notifier.NewAlertManager(notifier.New(config), config.AlertCooldown, config.AlertDigestInterval)
+			retryService := services.NewRetryService(config, requestClient, infrastructure.NewHelper(config), alerts, newBtcNetworkParams(config), secretProvider)
+
+			btcClient := services.NewBtcNodeClient(rpcClient, provider.InitBtcWalletRpcClient, services.NewWalletLocks())
+			newTxHash, err := retryService.BumpTransaction(cmd.Context(), btcClient, storage, args[0])
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "%s replaced by %s\n", args[0], newTxHash)
+			return nil
+		},
+	}
+}
@@ -0,0 +1,496 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	worker "github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/schedule"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/services"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// Server is the operator http api of the daemon.
+// The liveness and readiness probes and the prometheus metrics are open, every other endpoint requires the admin token as bearer token.
+type Server struct {
+	config       *infrastructure.Config
+	payService   PayService
+	storage      Storage
+	payControl   WorkerControl
+	retryControl WorkerControl
+	server       *http.Server
+}
+
+type PayService interface {
+	FarmStatuses() []services.FarmStatus
+}
+
+type Storage interface {
+	services.ExportStorage
+	services.StatementStorage
+	PingContext(ctx context.Context) error
+	GetTxHashesByStatus(ctx context.Context, status string) ([]types.TransactionHashWithStatus, error)
+	PauseFarm(ctx context.Context, farmId int64) error
+	ResumeFarm(ctx context.Context, farmId int64) error
+	SetFarmSchedule(ctx context.Context, farmId int64, schedule, timezone string) error
+	DeleteFarmSchedule(ctx context.Context, farmId int64) error
+	SetFarmPayoutThreshold(ctx context.Context, threshold types.FarmPayoutThreshold) error
+	DeleteFarmPayoutThreshold(ctx context.Context, farmId int64) error
+	SetAddressPayoutThreshold(ctx context.Context, address string, threshold types.Sats) error
+	DeleteAddressPayoutThreshold(ctx context.Context, address string) error
+}
+
+type WorkerControl interface {
+	Trigger() bool
+	Ready() bool
+	Status() worker.ControlStatus
+}
+
+func NewServer(config *infrastructure.Config, payService PayService, storage Storage, payControl, retryControl WorkerControl) *Server {
+	s := &Server{
+		config:       config,
+		payService:   payService,
+		storage:      storage,
+		payControl:   payControl,
+		retryControl: retryControl,
+	}
+
+	s.server = &http.Server{
+		Addr:              config.AdminApiAddress,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	return s
+}
+
+func (s *Server) Handler() http.Handler {
+	router := mux.NewRouter()
+
+	router.HandleFunc("/health/live", s.live).Methods(http.MethodGet)
+	router.HandleFunc("/health/ready", s.ready).Methods(http.MethodGet)
+	router.Handle("/metrics", metrics.Handler()).Methods(http.MethodGet)
+
+	api := router.PathPrefix("/api/v1").Subrouter()
+	api.Use(s.authenticate)
+	api.HandleFunc("/workers", s.workers).Methods(http.MethodGet)
+	api.HandleFunc("/farms", s.farms).Methods(http.MethodGet)
+	api.HandleFunc("/farms/{farmId:[0-9]+}/pause", s.pauseFarm).Methods(http.MethodPost)
+	api.HandleFunc("/farms/{farmId:[0-9]+}/resume", s.resumeFarm).Methods(http.MethodPost)
+	api.HandleFunc("/farms/{farmId:[0-9]+}/schedule", s.setFarmSchedule).Methods(http.MethodPut)
+	api.HandleFunc("/farms/{farmId:[0-9]+}/schedule", s.deleteFarmSchedule).Methods(http.MethodDelete)
+	api.HandleFunc("/farms/{farmId:[0-9]+}/payout-threshold", s.setFarmPayoutThreshold).Methods(http.MethodPut)
+	api.HandleFunc("/farms/{farmId:[0-9]+}/payout-threshold", s.deleteFarmPayoutThreshold).Methods(http.MethodDelete)
+	api.HandleFunc("/addresses/{address}/payout-threshold", s.setAddressPayoutThreshold).Methods(http.MethodPut)
+	api.HandleFunc("/addresses/{address}/payout-threshold", s.deleteAddressPayoutThreshold).Methods(http.MethodDelete)
+	api.HandleFunc("/runs/pay", s.triggerRun(s.payControl)).Methods(http.MethodPost)
+	api.HandleFunc("/runs/retry", s.triggerRun(s.retryControl)).Methods(http.MethodPost)
+	api.HandleFunc("/transactions/pending", s.pendingTransactions).Methods(http.MethodGet)
+	api.HandleFunc("/farm-payments/export", s.exportFarmPayments).Methods(http.MethodGet)
+	api.HandleFunc("/farm-payments/{farmPaymentId:[0-9]+}/export", s.exportFarmPayments).Methods(http.MethodGet)
+	api.HandleFunc("/owners/{owner}/statement", s.ownerStatement).Methods(http.MethodGet)
+
+	return router
+}
+
+// Start serves the api until the context is done
+func (s *Server) Start(ctx context.Context) {
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.server.Shutdown(shutdownCtx); err != nil {
+			log.Error().Msgf("Failed to shutdown admin api: %s", err)
+		}
+	}()
+
+	log.Info().Msgf("Admin api listening on %s", s.config.AdminApiAddress)
+	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Error().Msgf("Admin api stopped: %s", err)
+	}
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.config.AdminApiToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AdminApiToken)) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// ready is ok only when both workers are connected to the node and the db and the db answers
+func (s *Server) ready(w http.ResponseWriter, r *http.Request) {
+	if !s.payControl.Ready() || !s.retryControl.Ready() {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("workers are not ready"))
+		return
+	}
+
+	if err := s.storage.PingContext(r.Context()); err != nil {
+		writeError(w, http.StatusServiceUnavailable, fmt.Errorf("db is not reachable: %s", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+func (s *Server) workers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]worker.ControlStatus{
+		"pay":   s.payControl.Status(),
+		"retry": s.retryControl.Status(),
+	})
+}
+
+func (s *Server) farms(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.payService.FarmStatuses())
+}
+
+func (s *Server) pauseFarm(w http.ResponseWriter, r *http.Request) {
+	farmId, err := strconv.ParseInt(mux.Vars(r)["farmId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	err = s.storage.PauseFarm(r.Context(), farmId)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Info().Msgf("Farm with id {%d} paused through the admin api", farmId)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"farm_id": farmId, "paused": true})
+}
+
+func (s *Server) resumeFarm(w http.ResponseWriter, r *http.Request) {
+	farmId, err := strconv.ParseInt(mux.Vars(r)["farmId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.storage.ResumeFarm(r.Context(), farmId); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Info().Msgf("Farm with id {%d} resumed through the admin api", farmId)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"farm_id": farmId, "paused": false})
+}
+
+type farmScheduleRequest struct {
+	Schedule string `json:"schedule"`
+	Timezone string `json:"timezone"`
+}
+
+// setFarmSchedule overrides the pay schedule of the farm, e.g. {"schedule": "0 2 * * *", "timezone": "UTC"}
+func (s *Server) setFarmSchedule(w http.ResponseWriter, r *http.Request) {
+	farmId, err := strconv.ParseInt(mux.Vars(r)["farmId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var request farmScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %s", err))
+		return
+	}
+
+	if _, err := schedule.Parse(request.Schedule, request.Timezone); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.storage.SetFarmSchedule(r.Context(), farmId, request.Schedule, request.Timezone); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Info().Msgf("Schedule of farm with id {%d} set to {%s} through the admin api", farmId, request.Schedule)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"farm_id": farmId, "schedule": request.Schedule, "timezone": request.Timezone})
+}
+
+// deleteFarmSchedule makes the farm follow the schedule of the pay service again
+func (s *Server) deleteFarmSchedule(w http.ResponseWriter, r *http.Request) {
+	farmId, err := strconv.ParseInt(mux.Vars(r)["farmId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.storage.DeleteFarmSchedule(r.Context(), farmId); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Info().Msgf("Schedule of farm with id {%d} deleted through the admin api", farmId)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"farm_id": farmId, "schedule": ""})
+}
+
+type farmPayoutThresholdRequest struct {
+	ThresholdBtc                  *types.Sats `json:"threshold_btc"`
+	SkipThresholdForFarmAddresses bool        `json:"skip_threshold_for_farm_addresses"`
+}
+
+// setFarmPayoutThreshold overrides the payout threshold of the farm, e.g. {"threshold_btc": 0.05, "skip_threshold_for_farm_addresses": true}.
+// Without a threshold the farm keeps the global one.
+func (s *Server) setFarmPayoutThreshold(w http.ResponseWriter, r *http.Request) {
+	farmId, err := strconv.ParseInt(mux.Vars(r)["farmId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var request farmPayoutThresholdRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %s", err))
+		return
+	}
+
+	threshold := types.FarmPayoutThreshold{FarmId: farmId, ThresholdBtc: request.ThresholdBtc, SkipThresholdForFarmAddresses: request.SkipThresholdForFarmAddresses}
+	if err := services.ValidateFarmPayoutThreshold(threshold); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.storage.SetFarmPayoutThreshold(r.Context(), threshold); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Info().Msgf("Payout threshold of farm with id {%d} set through the admin api", farmId)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"farm_id":                           farmId,
+		"threshold_btc":                     request.ThresholdBtc,
+		"skip_threshold_for_farm_addresses": request.SkipThresholdForFarmAddresses,
+	})
+}
+
+// deleteFarmPayoutThreshold makes the addresses paid by the farm use the global payout threshold again
+func (s *Server) deleteFarmPayoutThreshold(w http.ResponseWriter, r *http.Request) {
+	farmId, err := strconv.ParseInt(mux.Vars(r)["farmId"], 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.storage.DeleteFarmPayoutThreshold(r.Context(), farmId); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Info().Msgf("Payout threshold of farm with id {%d} deleted through the admin api", farmId)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"farm_id": farmId, "threshold_btc": nil})
+}
+
+type addressPayoutThresholdRequest struct {
+	ThresholdBtc *types.Sats `json:"threshold_btc"`
+}
+
+// setAddressPayoutThreshold saves the payout threshold the owner of the address picked, e.g. {"threshold_btc": 0.5}.
+// The threshold must not be below MIN_ADDRESS_PAYOUT_THRESHOLD_IN_BTC.
+func (s *Server) setAddressPayoutThreshold(w http.ResponseWriter, r *http.Request) {
+	address := mux.Vars(r)["address"]
+
+	var request addressPayoutThresholdRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid request body: %s", err))
+		return
+	}
+
+	if request.ThresholdBtc == nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("threshold_btc is required"))
+		return
+	}
+
+	if err := services.ValidateAddressPayoutThreshold(s.config, *request.ThresholdBtc); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if err := s.storage.SetAddressPayoutThreshold(r.Context(), address, *request.ThresholdBtc); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Info().Msgf("Payout threshold of address {%s} set to {%s} through the admin api", address, request.ThresholdBtc)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"address": address, "threshold_btc": request.ThresholdBtc})
+}
+
+// deleteAddressPayoutThreshold makes the address use the threshold of the farms that pay it again
+func (s *Server) deleteAddressPayoutThreshold(w http.ResponseWriter, r *http.Request) {
+	address := mux.Vars(r)["address"]
+
+	if err := s.storage.DeleteAddressPayoutThreshold(r.Context(), address); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Info().Msgf("Payout threshold of address {%s} deleted through the admin api", address)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"address": address, "threshold_btc": nil})
+}
+
+// triggerRun queues a run of the worker. If a run is already queued, nothing more is queued.
+func (s *Server) triggerRun(control WorkerControl) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusAccepted, map[string]bool{"queued": control.Trigger()})
+	}
+}
+
+func (s *Server) pendingTransactions(w http.ResponseWriter, r *http.Request) {
+	txHashesWithStatus, err := s.storage.GetTxHashesByStatus(r.Context(), types.TransactionPending)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, txHashesWithStatus)
+}
+
+// exportFarmPayments exports the farm payment of the path, or the farm payments created in the period of the from and to parameters.
+// The format parameter is csv, which is the default, or json. The currency parameter is the fiat currency of the values.
+func (s *Server) exportFarmPayments(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = services.ExportFormatCSV
+	}
+
+	contentType := "application/json"
+	if format == services.ExportFormatCSV {
+		contentType = "text/csv"
+	} else if format != services.ExportFormatJSON {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid format {%s}, expected %s or %s", format, services.ExportFormatCSV, services.ExportFormatJSON))
+		return
+	}
+
+	var query services.FarmPaymentExportQuery
+	if farmPaymentId, ok := mux.Vars(r)["farmPaymentId"]; ok {
+		var err error
+		if query.FarmPaymentId, err = strconv.ParseInt(farmPaymentId, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		var err error
+		if query.From, err = services.ParseExportTime(r.URL.Query().Get("from")); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if query.To, err = services.ParseExportTime(r.URL.Query().Get("to")); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		if !query.From.Before(query.To) {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("from {%s} must be before to {%s}", query.From, query.To))
+			return
+		}
+	}
+
+	query.Currency = s.fiatCurrency(r)
+	exports, err := services.ExportFarmPayments(r.Context(), s.storage, query)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=farm_payments.%s", format))
+	w.WriteHeader(http.StatusOK)
+	if err := services.WriteFarmPaymentExports(w, format, exports); err != nil {
+		log.Error().Msgf("Failed to write farm payments export: %s", err)
+	}
+}
+
+// ownerStatement writes the earnings statement of the owner for the period of the from and to parameters.
+// The format parameter is html, which is the default, or csv. The currency parameter is the fiat currency of the values.
+func (s *Server) ownerStatement(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = services.StatementFormatHTML
+	}
+
+	contentType := "text/html; charset=utf-8"
+	if format == services.StatementFormatCSV {
+		contentType = "text/csv"
+	} else if format != services.StatementFormatHTML {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid format {%s}, expected %s or %s", format, services.StatementFormatHTML, services.StatementFormatCSV))
+		return
+	}
+
+	query := services.OwnerStatementQuery{Owner: mux.Vars(r)["owner"]}
+	var err error
+	if query.From, err = services.ParseExportTime(r.URL.Query().Get("from")); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if query.To, err = services.ParseExportTime(r.URL.Query().Get("to")); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if !query.From.Before(query.To) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("from {%s} must be before to {%s}", query.From, query.To))
+		return
+	}
+
+	query.Currency = s.fiatCurrency(r)
+	statement, err := services.GenerateOwnerStatement(r.Context(), s.storage, query)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if err := services.WriteOwnerStatement(w, format, statement); err != nil {
+		log.Error().Msgf("Failed to write the statement of owner {%s}: %s", query.Owner, err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Error().Msgf("Failed to write admin api response: %s", err)
+	}
+}
+
+// fiatCurrency returns the currency parameter, or the default fiat currency of the config
+func (s *Server) fiatCurrency(r *http.Request) string {
+	if currency := r.URL.Query().Get("currency"); currency != "" {
+		return strings.ToLower(currency)
+	}
+
+	return s.config.DefaultFiatCurrency()
+}
+
+func writeError(w http.ResponseWriter, statusCode int, err error) {
+	writeJSON(w, statusCode, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,486 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	worker "github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/services"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/rs/zerolog"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "test_token"
+
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	os.Exit(m.Run())
+}
+
+func TestEndpointsRequireToken(t *testing.T) {
+	s := NewServer(&infrastructure.Config{AdminApiToken: testToken}, &mockPayService{}, &mockStorage{}, &mockWorkerControl{}, &mockWorkerControl{})
+
+	for _, token := range []string{"", "wrong_token"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/farms", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		require.Equal(t, http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestEndpointsAreClosedWithoutConfiguredToken(t *testing.T) {
+	s := NewServer(&infrastructure.Config{}, &mockPayService{}, &mockStorage{}, &mockWorkerControl{}, &mockWorkerControl{})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/farms", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	require.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestLive(t *testing.T) {
+	s := NewServer(&infrastructure.Config{AdminApiToken: testToken}, &mockPayService{}, &mockStorage{}, &mockWorkerControl{}, &mockWorkerControl{})
+
+	rec := serve(s, http.MethodGet, "/health/live", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestReady(t *testing.T) {
+	tests := []struct {
+		name         string
+		payReady     bool
+		retryReady   bool
+		pingError    error
+		expectedCode int
+	}{
+		{name: "ready", payReady: true, retryReady: true, expectedCode: http.StatusOK},
+		{name: "pay worker not ready", payReady: false, retryReady: true, expectedCode: http.StatusServiceUnavailable},
+		{name: "retry worker not ready", payReady: true, retryReady: false, expectedCode: http.StatusServiceUnavailable},
+		{name: "db not reachable", payReady: true, retryReady: true, pingError: fmt.Errorf("connection refused"), expectedCode: http.StatusServiceUnavailable},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			storage := &mockStorage{}
+			storage.On("PingContext", mock.Anything).Return(test.pingError)
+
+			s := NewServer(&infrastructure.Config{AdminApiToken: testToken}, &mockPayService{}, storage,
+				&mockWorkerControl{ready: test.payReady}, &mockWorkerControl{ready: test.retryReady})
+
+			rec := serve(s, http.MethodGet, "/health/ready", "")
+			require.Equal(t, test.expectedCode, rec.Code)
+		})
+	}
+}
+
+func TestFarms(t *testing.T) {
+	payService := &mockPayService{farmStatuses: []services.FarmStatus{
+		{FarmId: 1, FarmName: "farm_1"},
+		{FarmId: 2, FarmName: "farm_2", Paused: true},
+	}}
+	s := NewServer(&infrastructure.Config{AdminApiToken: testToken}, payService, &mockStorage{}, &mockWorkerControl{}, &mockWorkerControl{})
+
+	rec := serve(s, http.MethodGet, "/api/v1/farms", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var farmStatuses []services.FarmStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &farmStatuses))
+	require.Equal(t, payService.farmStatuses, farmStatuses)
+}
+
+func TestPauseAndResumeFarm(t *testing.T) {
+	storage := &mockStorage{}
+	storage.On("PauseFarm", mock.Anything, int64(3)).Return(nil).Once()
+	storage.On("ResumeFarm", mock.Anything, int64(3)).Return(nil).Once()
+	storage.On("PauseFarm", mock.Anything, int64(4)).Return(fmt.Errorf("failed to get farm {4}: %w", sql.ErrNoRows)).Once()
+
+	s := NewServer(&infrastructure.Config{AdminApiToken: testToken}, &mockPayService{}, storage, &mockWorkerControl{}, &mockWorkerControl{})
+
+	rec := serve(s, http.MethodPost, "/api/v1/farms/3/pause", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(s, http.MethodPost, "/api/v1/farms/3/resume", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = serve(s, http.MethodPost, "/api/v1/farms/abc/pause", testToken)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serve(s, http.MethodPost, "/api/v1/farms/4/pause", testToken)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	storage.AssertExpectations(t)
+}
+
+func TestSetAndDeleteFarmSchedule(t *testing.T) {
+	storage := &mockStorage{}
+	storage.On("SetFarmSchedule", mock.Anything, int64(3), "0 2 * * *", "Europe/Sofia").Return(nil).Once()
+	storage.On("DeleteFarmSchedule", mock.Anything, int64(3)).Return(nil).Once()
+
+	s := NewServer(&infrastructure.Config{AdminApiToken: testToken}, &mockPayService{}, storage, &mockWorkerControl{}, &mockWorkerControl{})
+
+	setSchedule := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/farms/3/schedule", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := setSchedule(`{"schedule": "0 2 * * *", "timezone": "Europe/Sofia"}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// invalid schedules are not saved
+	rec = setSchedule(`{"schedule": "0 25 * * *"}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = setSchedule(`not json`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(s, http.MethodDelete, "/api/v1/farms/3/schedule", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	storage.AssertExpectations(t)
+}
+
+func TestSetAndDeletePayoutThresholds(t *testing.T) {
+	farmThreshold := types.Sats(5000000)
+	storage := &mockStorage{}
+	storage.On("SetFarmPayoutThreshold", mock.Anything, types.FarmPayoutThreshold{FarmId: 3, ThresholdBtc: &farmThreshold, SkipThresholdForFarmAddresses: true}).Return(nil).Once()
+	storage.On("SetFarmPayoutThreshold", mock.Anything, types.FarmPayoutThreshold{FarmId: 3, SkipThresholdForFarmAddresses: true}).Return(nil).Once()
+	storage.On("DeleteFarmPayoutThreshold", mock.Anything, int64(3)).Return(nil).Once()
+	storage.On("SetAddressPayoutThreshold", mock.Anything, "btc_address", types.Sats(50000000)).Return(nil).Once()
+	storage.On("DeleteAddressPayoutThreshold", mock.Anything, "btc_address").Return(nil).Once()
+
+	s := NewServer(&infrastructure.Config{AdminApiToken: testToken, MinAddressPayoutThresholdInBTC: 1000000}, &mockPayService{}, storage, &mockWorkerControl{}, &mockWorkerControl{})
+
+	put := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := put("/api/v1/farms/3/payout-threshold", `{"threshold_btc": 0.05, "skip_threshold_for_farm_addresses": true}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// the farm keeps the global threshold and only skips it for its own addresses
+	rec = put("/api/v1/farms/3/payout-threshold", `{"skip_threshold_for_farm_addresses": true}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = put("/api/v1/farms/3/payout-threshold", `{"threshold_btc": -1}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(s, http.MethodDelete, "/api/v1/farms/3/payout-threshold", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	rec = put("/api/v1/addresses/btc_address/payout-threshold", `{"threshold_btc": 0.5}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	// the threshold of an address can not be below the minimum
+	rec = put("/api/v1/addresses/btc_address/payout-threshold", `{"threshold_btc": 0.001}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = put("/api/v1/addresses/btc_address/payout-threshold", `{}`)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(s, http.MethodDelete, "/api/v1/addresses/btc_address/payout-threshold", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	storage.AssertExpectations(t)
+}
+
+func TestTriggerRuns(t *testing.T) {
+	payControl := &mockWorkerControl{}
+	retryControl := &mockWorkerControl{}
+	s := NewServer(&infrastructure.Config{AdminApiToken: testToken}, &mockPayService{}, &mockStorage{}, payControl, retryControl)
+
+	rec := serve(s, http.MethodPost, "/api/v1/runs/pay", testToken)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Equal(t, 1, payControl.triggerCount)
+	require.Equal(t, 0, retryControl.triggerCount)
+
+	rec = serve(s, http.MethodPost, "/api/v1/runs/retry", testToken)
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Equal(t, 1, retryControl.triggerCount)
+
+	rec = serve(s, http.MethodGet, "/api/v1/runs/pay", testToken)
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestPendingTransactions(t *testing.T) {
+	storage := &mockStorage{}
+	storage.On("GetTxHashesByStatus", mock.Anything, types.TransactionPending).Return([]types.TransactionHashWithStatus{
+		{TxHash: "tx_hash_1", Status: types.TransactionPending, FarmBtcWalletName: "farm_1"},
+	}, nil).Once()
+
+	s := NewServer(&infrastructure.Config{AdminApiToken: testToken}, &mockPayService{}, storage, &mockWorkerControl{}, &mockWorkerControl{})
+
+	rec := serve(s, http.MethodGet, "/api/v1/transactions/pending", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var txHashesWithStatus []types.TransactionHashWithStatus
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &txHashesWithStatus))
+	require.Len(t, txHashesWithStatus, 1)
+	require.Equal(t, "tx_hash_1", txHashesWithStatus[0].TxHash)
+}
+
+func TestExportFarmPayments(t *testing.T) {
+	storage := &mockStorage{}
+	storage.On("GetFarmPayment", mock.Anything, int64(1)).Return(types.FarmPayment{Id: "1", FarmId: 2, AmountBTC: 100000000}, nil)
+	storage.On("GetFarmPayment", mock.Anything, int64(3)).Return(types.FarmPayment{}, fmt.Errorf("%w", sql.ErrNoRows))
+	storage.On("GetFarmPaymentUTXOTxHash", mock.Anything, int64(1)).Return("utxo_tx_hash", nil)
+	storage.On("GetFarmPaymentLedgerEntries", mock.Anything, int64(1)).Return([]types.LedgerEntry{}, nil)
+	storage.On("GetFarmAuraPoolCollections", mock.Anything, int64(2)).Return([]types.AuraPoolCollection{}, nil)
+	storage.On("GetCollectionPaymentAllocations", mock.Anything, int64(1)).Return([]types.CollectionPaymentAllocation{}, nil)
+	storage.On("GetNFTStatisticsByFarmPayment", mock.Anything, int64(1)).Return([]types.NFTStatistics{}, nil)
+	storage.On("GetDestinationAddressesByFarmPayment", mock.Anything, int64(1)).Return([]types.DestinationAddressWithAmount{
+		{Address: "address_1", AmountBTC: 100000000, TxHash: "tx_hash_1", ThresholdReached: true},
+	}, nil)
+	storage.On("GetTxHashesByFarmPayment", mock.Anything, int64(1)).Return([]types.TransactionHashWithStatus{}, nil)
+	storage.On("GetRBFTransactionsByFarmPayment", mock.Anything, int64(1)).Return([]types.RBFTransactionHistory{}, nil)
+	storage.On("GetBtcPrice", mock.Anything, types.BtcPriceEventFarmPayment, "utxo_tx_hash", "usd").Return(types.BtcPrice{Price: decimal.NewFromInt(20000)}, nil)
+	storage.On("GetBtcPrice", mock.Anything, types.BtcPriceEventSendMany, "tx_hash_1", "usd").Return(types.BtcPrice{}, sql.ErrNoRows)
+
+	s := NewServer(&infrastructure.Config{AdminApiToken: testToken, PriceFiatCurrencies: []string{"usd"}}, &mockPayService{}, storage, &mockWorkerControl{}, &mockWorkerControl{})
+
+	rec := serve(s, http.MethodGet, "/api/v1/farm-payments/1/export?format=json", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var exports []services.FarmPaymentExport
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &exports))
+	require.Len(t, exports, 1)
+	require.Equal(t, "utxo_tx_hash", exports[0].UTXOTxHash)
+	require.Len(t, exports[0].Destinations, 1)
+	require.Equal(t, "usd", exports[0].FiatCurrency)
+	require.Equal(t, "20000", exports[0].BtcPrice.String())
+	// the send price was not captured, the destination is valued at the price of the payment
+	require.Equal(t, "20000", exports[0].Destinations[0].BtcPrice.String())
+
+	rec = serve(s, http.MethodGet, "/api/v1/farm-payments/1/export", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "text/csv", rec.Header().Get("Content-Type"))
+	require.Contains(t, rec.Body.String(), "1,2,")
+
+	rec = serve(s, http.MethodGet, "/api/v1/farm-payments/3/export", testToken)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = serve(s, http.MethodGet, "/api/v1/farm-payments/1/export?format=xml", testToken)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(s, http.MethodGet, "/api/v1/farm-payments/export?from=2023-07-02&to=2023-07-01", testToken)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(s, http.MethodGet, "/api/v1/farm-payments/export?from=2023-07-01", testToken)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestOwnerStatement(t *testing.T) {
+	storage := &mockStorage{}
+	storage.On("GetNFTStatisticsByOwner", mock.Anything, "cudos1owner", mock.Anything, mock.Anything).Return([]types.NFTStatistics{}, nil)
+	storage.On("GetThresholdAmountsByAddress", mock.Anything, "cudos1owner").Return([]types.AddressThresholdAmountByFarm{
+		{BTCAddress: "cudos1owner", FarmId: "1", AmountBTC: "0.001"},
+	}, nil)
+	storage.On("GetPaidDestinationsByAddress", mock.Anything, "cudos1owner", mock.Anything, mock.Anything).Return([]types.AddressPayout{}, nil)
+
+	s := NewServer(&infrastructure.Config{AdminApiToken: testToken}, &mockPayService{}, storage, &mockWorkerControl{}, &mockWorkerControl{})
+
+	rec := serve(s, http.MethodGet, "/api/v1/owners/cudos1owner/statement?from=2023-07-01&to=2023-08-01", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	require.Contains(t, rec.Body.String(), "cudos1owner")
+
+	rec = serve(s, http.MethodGet, "/api/v1/owners/cudos1owner/statement?from=2023-07-01&to=2023-08-01&format=csv", testToken)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "cudos1owner,held,,1,")
+
+	rec = serve(s, http.MethodGet, "/api/v1/owners/cudos1owner/statement?from=2023-07-01", testToken)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = serve(s, http.MethodGet, "/api/v1/owners/cudos1owner/statement?from=2023-07-01&to=2023-08-01&format=pdf", testToken)
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func serve(s *Server, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+type mockPayService struct {
+	farmStatuses []services.FarmStatus
+}
+
+func (mps *mockPayService) FarmStatuses() []services.FarmStatus {
+	return mps.farmStatuses
+}
+
+type mockStorage struct {
+	mock.Mock
+}
+
+func (ms *mockStorage) PingContext(ctx context.Context) error {
+	args := ms.Called(ctx)
+	return args.Error(0)
+}
+
+func (ms *mockStorage) GetTxHashesByStatus(ctx context.Context, status string) ([]types.TransactionHashWithStatus, error) {
+	args := ms.Called(ctx, status)
+	return args.Get(0).([]types.TransactionHashWithStatus), args.Error(1)
+}
+
+func (ms *mockStorage) PauseFarm(ctx context.Context, farmId int64) error {
+	args := ms.Called(ctx, farmId)
+	return args.Error(0)
+}
+
+func (ms *mockStorage) ResumeFarm(ctx context.Context, farmId int64) error {
+	args := ms.Called(ctx, farmId)
+	return args.Error(0)
+}
+
+func (ms *mockStorage) SetFarmSchedule(ctx context.Context, farmId int64, schedule, timezone string) error {
+	args := ms.Called(ctx, farmId, schedule, timezone)
+	return args.Error(0)
+}
+
+func (ms *mockStorage) DeleteFarmSchedule(ctx context.Context, farmId int64) error {
+	args := ms.Called(ctx, farmId)
+	return args.Error(0)
+}
+
+func (ms *mockStorage) SetFarmPayoutThreshold(ctx context.Context, threshold types.FarmPayoutThreshold) error {
+	args := ms.Called(ctx, threshold)
+	return args.Error(0)
+}
+
+func (ms *mockStorage) DeleteFarmPayoutThreshold(ctx context.Context, farmId int64) error {
+	args := ms.Called(ctx, farmId)
+	return args.Error(0)
+}
+
+func (ms *mockStorage) SetAddressPayoutThreshold(ctx context.Context, address string, threshold types.Sats) error {
+	args := ms.Called(ctx, address, threshold)
+	return args.Error(0)
+}
+
+func (ms *mockStorage) DeleteAddressPayoutThreshold(ctx context.Context, address string) error {
+	args := ms.Called(ctx, address)
+	return args.Error(0)
+}
+
+func (ms *mockStorage) GetFarmPayment(ctx context.Context, farmPaymentId int64) (types.FarmPayment, error) {
+	args := ms.Called(ctx, farmPaymentId)
+	return args.Get(0).(types.FarmPayment), args.Error(1)
+}
+
+func (ms *mockStorage) GetFarmPaymentIdsByDate(ctx context.Context, from, to time.Time) ([]int64, error) {
+	args := ms.Called(ctx, from, to)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (ms *mockStorage) GetBtcPrice(ctx context.Context, event, reference, currency string) (types.BtcPrice, error) {
+	args := ms.Called(ctx, event, reference, currency)
+	return args.Get(0).(types.BtcPrice), args.Error(1)
+}
+
+func (ms *mockStorage) GetFarmPaymentUTXOTxHash(ctx context.Context, farmPaymentId int64) (string, error) {
+	args := ms.Called(ctx, farmPaymentId)
+	return args.Get(0).(string), args.Error(1)
+}
+
+func (ms *mockStorage) GetFarmPaymentLedgerEntries(ctx context.Context, farmPaymentId int64) ([]types.LedgerEntry, error) {
+	args := ms.Called(ctx, farmPaymentId)
+	return args.Get(0).([]types.LedgerEntry), args.Error(1)
+}
+
+func (ms *mockStorage) GetFarmAuraPoolCollections(ctx context.Context, farmId int64) ([]types.AuraPoolCollection, error) {
+	args := ms.Called(ctx, farmId)
+	return args.Get(0).([]types.AuraPoolCollection), args.Error(1)
+}
+
+func (ms *mockStorage) GetCollectionPaymentAllocations(ctx context.Context, farmPaymentId int64) ([]types.CollectionPaymentAllocation, error) {
+	args := ms.Called(ctx, farmPaymentId)
+	return args.Get(0).([]types.CollectionPaymentAllocation), args.Error(1)
+}
+
+func (ms *mockStorage) GetNFTStatisticsByFarmPayment(ctx context.Context, farmPaymentId int64) ([]types.NFTStatistics, error) {
+	args := ms.Called(ctx, farmPaymentId)
+	return args.Get(0).([]types.NFTStatistics), args.Error(1)
+}
+
+func (ms *mockStorage) GetDestinationAddressesByFarmPayment(ctx context.Context, farmPaymentId int64) ([]types.DestinationAddressWithAmount, error) {
+	args := ms.Called(ctx, farmPaymentId)
+	return args.Get(0).([]types.DestinationAddressWithAmount), args.Error(1)
+}
+
+func (ms *mockStorage) GetTxHashesByFarmPayment(ctx context.Context, farmPaymentId int64) ([]types.TransactionHashWithStatus, error) {
+	args := ms.Called(ctx, farmPaymentId)
+	return args.Get(0).([]types.TransactionHashWithStatus), args.Error(1)
+}
+
+func (ms *mockStorage) GetRBFTransactionsByFarmPayment(ctx context.Context, farmPaymentId int64) ([]types.RBFTransactionHistory, error) {
+	args := ms.Called(ctx, farmPaymentId)
+	return args.Get(0).([]types.RBFTransactionHistory), args.Error(1)
+}
+
+func (ms *mockStorage) GetNFTStatisticsByOwner(ctx context.Context, owner string, from, to int64) ([]types.NFTStatistics, error) {
+	args := ms.Called(ctx, owner, from, to)
+	return args.Get(0).([]types.NFTStatistics), args.Error(1)
+}
+
+func (ms *mockStorage) GetThresholdAmountsByAddress(ctx context.Context, address string) ([]types.AddressThresholdAmountByFarm, error) {
+	args := ms.Called(ctx, address)
+	return args.Get(0).([]types.AddressThresholdAmountByFarm), args.Error(1)
+}
+
+func (ms *mockStorage) GetPaidDestinationsByAddress(ctx context.Context, address string, from, to time.Time) ([]types.AddressPayout, error) {
+	args := ms.Called(ctx, address, from, to)
+	return args.Get(0).([]types.AddressPayout), args.Error(1)
+}
+
+type mockWorkerControl struct {
+	ready        bool
+	triggerCount int
+}
+
+func (mwc *mockWorkerControl) Trigger() bool {
+	mwc.triggerCount++
+	return true
+}
+
+func (mwc *mockWorkerControl) Ready() bool {
+	return mwc.ready
+}
+
+func (mwc *mockWorkerControl) Status() worker.ControlStatus {
+	return worker.ControlStatus{Ready: mwc.ready}
+}
+
+func TestMetricsAreOpen(t *testing.T) {
+	s := NewServer(&infrastructure.Config{}, &mockPayService{}, &mockStorage{}, &mockWorkerControl{}, &mockWorkerControl{})
+
+	rec := serve(s, http.MethodGet, "/metrics", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Contains(t, rec.Body.String(), "go_goroutines")
+}
@@ -0,0 +1,108 @@
+package tokenised_infrastructure_rewarder
+
+import (
+	"sync"
+	"time"
+)
+
+// Control lets the admin api see the state of a worker and trigger a run without waiting for the next tick.
+type Control struct {
+	service string
+	trigger chan struct{}
+
+	mutex          sync.Mutex
+	ready          bool
+	leader         bool
+	nextRun        time.Time
+	lastRunStarted time.Time
+	lastRunEnded   time.Time
+	lastRunError   string
+}
+
+type ControlStatus struct {
+	Ready          bool      `json:"ready"`
+	Leader         bool      `json:"leader"`
+	NextRun        time.Time `json:"next_run"`
+	LastRunStarted time.Time `json:"last_run_started"`
+	LastRunEnded   time.Time `json:"last_run_ended"`
+	LastRunError   string    `json:"last_run_error,omitempty"`
+}
+
+// NewControl creates the control of a worker. The service name is used to label the worker metrics.
+func NewControl(service string) *Control {
+	return &Control{
+		service: service,
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+// Trigger queues a run to be executed as soon as the worker is free.
+// Returns false if a run is already queued.
+func (c *Control) Trigger() bool {
+	select {
+	case c.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *Control) Ready() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.ready
+}
+
+func (c *Control) Status() ControlStatus {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return ControlStatus{
+		Ready:          c.ready,
+		Leader:         c.leader,
+		NextRun:        c.nextRun,
+		LastRunStarted: c.lastRunStarted,
+		LastRunEnded:   c.lastRunEnded,
+		LastRunError:   c.lastRunError,
+	}
+}
+
+func (c *Control) setReady(ready bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.ready = ready
+}
+
+func (c *Control) setLeader(leader bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.leader = leader
+}
+
+func (c *Control) setNextRun(nextRun time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.nextRun = nextRun.UTC()
+}
+
+func (c *Control) runStarted() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.lastRunStarted = time.Now().UTC()
+}
+
+func (c *Control) runEnded(err error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.lastRunEnded = time.Now().UTC()
+	c.lastRunError = ""
+	if err != nil {
+		c.lastRunError = err.Error()
+	}
+}
@@ -1,10 +1,22 @@
 package infrastructure
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/schedule"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml"
+	"github.com/shopspring/decimal"
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
@@ -32,117 +44,513 @@ type Config struct {
 	CUDOMaintenanceFeePayoutAddress   string
 	CUDOFeeOnAllBTC                   float64
 	AuraPoolTestFarmWalletPassword    string
+	SecretsProvider                   string
+	SecretsDir                        string
+	SecretsKeystorePath               string
+	SecretsKeystorePasswordFile       string
 	WorkerProcessIntervalPayment      time.Duration
 	WorkerProcessIntervalRetry        time.Duration
+	PaySchedule                       string
+	RetrySchedule                     string
+	ScheduleTimezone                  string
 	WorkerFailureRetryDelay           time.Duration
+	WorkerFailureRetryMaxDelay        time.Duration
+	BreakerFailureThreshold           int
+	BreakerOpenTimeout                time.Duration
 	RBFTransactionRetryDelayInSeconds int
 	RBFTransactionRetryMaxCount       int
-	GlobalPayoutThresholdInBTC        float64
+	GlobalPayoutThresholdInBTC        types.Sats
+	MinAddressPayoutThresholdInBTC    types.Sats
+	SweepSchedule                     string
+	SweepMaxAgeDays                   int
+	SweepDustFloorInBTC               types.Sats
+	AccrualReconcileInterval          time.Duration
+	CrossFarmThreshold                bool
+	CrossFarmMinShareInBTC            types.Sats
 	MailFromAddress                   string
 	MailToAddress                     string
 	SendgridApiKey                    string
+	SmtpHost                          string
+	SmtpPort                          string
+	SmtpUsername                      string
+	SmtpPassword                      string
+	NotifyWebhookUrl                  string
+	SlackWebhookUrl                   string
+	AlertCooldown                     time.Duration
+	AlertDigestInterval               time.Duration
 	ServiceMaxErrorCount              int
+	FarmProcessingConcurrency         int
+	AdminApiAddress                   string
+	AdminApiToken                     string
+	LeaderLeaseTtl                    time.Duration
+	LeaderId                          string
+	PriceSource                       string
+	PriceFile                         string
+	PriceFiatCurrencies               []string
+	CoinGeckoApiUrl                   string
 }
 
-// NewConfig New returns a new Config struct
-func NewConfig() *Config {
-	return &Config{
-		HasuraURL:                         getEnv("HASURA_URL", ""),
-		NodeRestUrl:                       getEnv("NODE_REST_URL", ""),
-		NodeRPCUrl:                        getEnv("NODE_RPC_URL", ""),
-		BitcoinNodeUrl:                    getEnv("BITCOIN_NODE_URL", ""),
-		BitcoinNodePort:                   getEnv("BITCOIN_NODE_PORT", ""),
-		BitcoinNodeUserName:               getEnv("BITCOIN_NODE_USER_NAME", ""),
-		BitcoinNodePassword:               getEnv("BITCOIN_NODE_PASSWORD", ""),
-		FoundryPoolAPIBaseURL:             getEnv("FOUNDRY_POOL_API_BASE_URL", ""),
-		FoundryPoolAPIKey:                 getEnv("FOUNDRY_POOL_API_KEY", ""),
-		DbDriverName:                      getEnv("DB_DRIVER_NAME", ""),
-		DbHost:                            getEnv("DB_HOST", ""),
-		DbPort:                            getEnv("DB_PORT", ""),
-		DbUser:                            getEnv("DB_USER", ""),
-		DbPassword:                        getEnv("DB_PASSWORD", ""),
-		DbName:                            getEnv("DB_NAME", ""),
-		HasuraActionsURL:                  getEnv("HASURA_ACTIONS_URL", ""),
-		IsTesting:                         getEnvAsBool("IS_TESTING", true),
-		AuraPoolBackEndUrl:                getEnv("AURA_POOL_BACKEND_URL", ""),
-		Network:                           getEnv("NETWORK", ""),
-		CUDOMaintenanceFeePercent:         getEnvAsFloat64("CUDO_MAINTENANCE_FEE_PERCENT", 10.0),
-		CUDOFeeOnAllBTC:                   getEnvAsFloat64("CUDO_FEE_ON_ALL_BTC", 2.0),
-		CUDOFeePayoutAddress:              getEnv("CUDO_FEE_PAYOUT_ADDRESS", ""),
-		CUDOMaintenanceFeePayoutAddress:   getEnv("CUDO_MAINTENANCE_FEE_PAYOUT_ADDRESS", ""),
-		AuraPoolTestFarmWalletPassword:    getEnv("AURA_POOL_TEST_FARM_WALLET_PASSWORD", ""),
-		WorkerProcessIntervalPayment:      getEnvAsDuration("WORKER_PROCESS_INTERVAL_PAYMENT", time.Second*5),
-		WorkerProcessIntervalRetry:        getEnvAsDuration("WORKER_PROCESS_INTERVAL_RETRY", time.Second*13),
-		WorkerFailureRetryDelay:           getEnvAsDuration("WORKER_FAILURE_RETRY_DELAY", time.Second*5),
-		RBFTransactionRetryDelayInSeconds: getEnvAsInt("RBF_TRANSACTION_RETRY_DELAY_IN_SECONDS", 18000),
-		RBFTransactionRetryMaxCount:       getEnvAsInt("RBF_TRANSACTION_RETRY_MAX_COUNT", 2),
-		GlobalPayoutThresholdInBTC:        getEnvAsFloat64("GLOBAL_PAYOUT_THRESHOLD_IN_BTC", 0.1),
-		MailFromAddress:                   getEnv("MAIL_FROM_ADDRESS", ""),
-		MailToAddress:                     getEnv("MAIL_TO_ADDRESS", ""),
-		SendgridApiKey:                    getEnv("SENDGRID_API_KEY", ""),
-		ServiceMaxErrorCount:              getEnvAsInt("SERVICE_MAX_ERROR_COUNT", 5),
-	}
-}
-
-// Simple helper function to read an environment or return a default value
-func getEnv(key string, defaultVal string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+// ConfigError lists every problem found in the config, so all of them can be fixed at once
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("invalid config:\n - %s", strings.Join(e.Problems, "\n - "))
+}
+
+/*
+LoadConfig reads the config and refuses it if anything is wrong with it.
+
+ 1. The config file is optional. Depending on its extension it is read as yaml (.yaml, .yml), toml (.toml) or env file (anything else).
+    It has the same keys as the environment variables, e.g. CUDO_FEE_PAYOUT_ADDRESS or cudo_fee_payout_address.
+ 2. Environment variables override the values of the file. Empty values are the same as missing ones.
+ 3. Unknown keys in the file, values that can not be parsed, missing required values and values out of range
+    are all collected and returned together as ConfigError.
+*/
+func LoadConfig(configFile string) (*Config, error) {
+	source := &configSource{values: make(map[string]string), known: make(map[string]bool)}
+	if configFile != "" {
+		if err := source.readFile(configFile); err != nil {
+			return nil, err
+		}
 	}
 
-	return defaultVal
+	config := &Config{
+		HasuraURL:                         source.getRequiredString("HASURA_URL"),
+		NodeRestUrl:                       source.getRequiredString("NODE_REST_URL"),
+		NodeRPCUrl:                        source.getString("NODE_RPC_URL", ""),
+		BitcoinNodeUrl:                    source.getRequiredString("BITCOIN_NODE_URL"),
+		BitcoinNodePort:                   source.getRequiredString("BITCOIN_NODE_PORT"),
+		BitcoinNodeUserName:               source.getRequiredString("BITCOIN_NODE_USER_NAME"),
+		BitcoinNodePassword:               source.getRequiredString("BITCOIN_NODE_PASSWORD"),
+		FoundryPoolAPIBaseURL:             source.getRequiredString("FOUNDRY_POOL_API_BASE_URL"),
+		FoundryPoolAPIKey:                 source.getRequiredString("FOUNDRY_POOL_API_KEY"),
+		DbDriverName:                      source.getString("DB_DRIVER_NAME", "postgres"),
+		DbHost:                            source.getString("DB_HOST", ""),
+		DbPort:                            source.getString("DB_PORT", ""),
+		DbUser:                            source.getString("DB_USER", ""),
+		DbPassword:                        source.getString("DB_PASSWORD", ""),
+		DbName:                            source.getRequiredString("DB_NAME"),
+		HasuraActionsURL:                  source.getString("HASURA_ACTIONS_URL", ""),
+		IsTesting:                         source.getBool("IS_TESTING", true),
+		AuraPoolBackEndUrl:                source.getString("AURA_POOL_BACKEND_URL", ""),
+		Network:                           source.getRequiredString("NETWORK"),
+		CUDOMaintenanceFeePercent:         source.getFloat64("CUDO_MAINTENANCE_FEE_PERCENT", 10.0),
+		CUDOFeeOnAllBTC:                   source.getFloat64("CUDO_FEE_ON_ALL_BTC", 2.0),
+		CUDOFeePayoutAddress:              source.getRequiredString("CUDO_FEE_PAYOUT_ADDRESS"),
+		CUDOMaintenanceFeePayoutAddress:   source.getRequiredString("CUDO_MAINTENANCE_FEE_PAYOUT_ADDRESS"),
+		AuraPoolTestFarmWalletPassword:    source.getString("AURA_POOL_TEST_FARM_WALLET_PASSWORD", ""),
+		SecretsProvider:                   source.getString("SECRETS_PROVIDER", "env"),
+		SecretsDir:                        source.getString("SECRETS_DIR", "/run/secrets"),
+		SecretsKeystorePath:               source.getString("SECRETS_KEYSTORE_PATH", ""),
+		SecretsKeystorePasswordFile:       source.getString("SECRETS_KEYSTORE_PASSWORD_FILE", ""),
+		WorkerProcessIntervalPayment:      source.getDuration("WORKER_PROCESS_INTERVAL_PAYMENT", time.Second*5),
+		WorkerProcessIntervalRetry:        source.getDuration("WORKER_PROCESS_INTERVAL_RETRY", time.Second*13),
+		PaySchedule:                       source.getString("PAY_SCHEDULE", ""),
+		RetrySchedule:                     source.getString("RETRY_SCHEDULE", ""),
+		ScheduleTimezone:                  source.getString("SCHEDULE_TIMEZONE", "UTC"),
+		WorkerFailureRetryDelay:           source.getDuration("WORKER_FAILURE_RETRY_DELAY", time.Second*5),
+		WorkerFailureRetryMaxDelay:        source.getDuration("WORKER_FAILURE_RETRY_MAX_DELAY", time.Minute*5),
+		BreakerFailureThreshold:           source.getInt("BREAKER_FAILURE_THRESHOLD", 3),
+		BreakerOpenTimeout:                source.getDuration("BREAKER_OPEN_TIMEOUT", time.Minute),
+		RBFTransactionRetryDelayInSeconds: source.getInt("RBF_TRANSACTION_RETRY_DELAY_IN_SECONDS", 18000),
+		RBFTransactionRetryMaxCount:       source.getInt("RBF_TRANSACTION_RETRY_MAX_COUNT", 2),
+		FarmProcessingConcurrency:         source.getInt("FARM_PROCESSING_CONCURRENCY", 4),
+		GlobalPayoutThresholdInBTC:        source.getSats("GLOBAL_PAYOUT_THRESHOLD_IN_BTC", 10000000),
+		MinAddressPayoutThresholdInBTC:    source.getSats("MIN_ADDRESS_PAYOUT_THRESHOLD_IN_BTC", 1000000),
+		SweepSchedule:                     source.getString("SWEEP_SCHEDULE", ""),
+		SweepMaxAgeDays:                   source.getInt("SWEEP_MAX_AGE_DAYS", 90),
+		SweepDustFloorInBTC:               source.getSats("SWEEP_DUST_FLOOR_IN_BTC", 1000),
+		AccrualReconcileInterval:          source.getDuration("ACCRUAL_RECONCILE_INTERVAL", time.Hour),
+		CrossFarmThreshold:                source.getBool("CROSS_FARM_THRESHOLD", false),
+		CrossFarmMinShareInBTC:            source.getSats("CROSS_FARM_MIN_SHARE_IN_BTC", 0),
+		MailFromAddress:                   source.getString("MAIL_FROM_ADDRESS", ""),
+		MailToAddress:                     source.getString("MAIL_TO_ADDRESS", ""),
+		SendgridApiKey:                    source.getString("SENDGRID_API_KEY", ""),
+		SmtpHost:                          source.getString("SMTP_HOST", ""),
+		SmtpPort:                          source.getString("SMTP_PORT", "587"),
+		SmtpUsername:                      source.getString("SMTP_USERNAME", ""),
+		SmtpPassword:                      source.getString("SMTP_PASSWORD", ""),
+		NotifyWebhookUrl:                  source.getString("NOTIFY_WEBHOOK_URL", ""),
+		SlackWebhookUrl:                   source.getString("SLACK_WEBHOOK_URL", ""),
+		AlertCooldown:                     source.getDuration("ALERT_COOLDOWN", time.Minute*30),
+		AlertDigestInterval:               source.getDuration("ALERT_DIGEST_INTERVAL", time.Hour*6),
+		ServiceMaxErrorCount:              source.getInt("SERVICE_MAX_ERROR_COUNT", 5),
+		AdminApiAddress:                   source.getString("ADMIN_API_ADDRESS", ":8081"),
+		AdminApiToken:                     source.getString("ADMIN_API_TOKEN", ""),
+		LeaderLeaseTtl:                    source.getDuration("LEADER_LEASE_TTL", time.Second*30),
+		LeaderId:                          source.getString("LEADER_ID", ""),
+		PriceSource:                       source.getString("PRICE_SOURCE", "coingecko"),
+		PriceFile:                         source.getString("PRICE_FILE", ""),
+		PriceFiatCurrencies:               source.getList("PRICE_FIAT_CURRENCIES", []string{"usd"}),
+		CoinGeckoApiUrl:                   source.getString("COINGECKO_API_URL", "https://api.coingecko.com/api/v3"),
+	}
+
+	problems := append(source.unknownKeys(), source.problems...)
+	problems = append(problems, config.validate()...)
+	if len(problems) > 0 {
+		return nil, &ConfigError{Problems: problems}
+	}
+
+	return config, nil
 }
 
-// Simple helper function to read an environment variable into integer or return a default value
-func getEnvAsInt(name string, defaultVal int) int {
-	valueStr := getEnv(name, "")
-	if value, err := strconv.Atoi(valueStr); err == nil {
-		return value
+// ChainParams returns the params of the bitcoin network the service works on
+func (c *Config) ChainParams() *chaincfg.Params {
+	if c.IsTesting {
+		return &chaincfg.SigNetParams
 	}
 
-	return defaultVal
+	return &chaincfg.MainNetParams
+}
+
+// DefaultFiatCurrency is the currency the exports are valued in when none is requested, the first of PRICE_FIAT_CURRENCIES
+func (c *Config) DefaultFiatCurrency() string {
+	if len(c.PriceFiatCurrencies) == 0 {
+		return ""
+	}
+
+	return c.PriceFiatCurrencies[0]
+}
+
+// validate checks the ranges of the parsed values and returns every problem found
+func (c *Config) validate() []string {
+	var problems []string
+
+	for key, percent := range map[string]float64{
+		"CUDO_MAINTENANCE_FEE_PERCENT": c.CUDOMaintenanceFeePercent,
+		"CUDO_FEE_ON_ALL_BTC":          c.CUDOFeeOnAllBTC,
+	} {
+		if percent < 0 || percent > 100 {
+			problems = append(problems, fmt.Sprintf("%s must be between 0 and 100, got %v", key, percent))
+		}
+	}
+
+	for key, duration := range map[string]time.Duration{
+		"WORKER_PROCESS_INTERVAL_PAYMENT": c.WorkerProcessIntervalPayment,
+		"WORKER_PROCESS_INTERVAL_RETRY":   c.WorkerProcessIntervalRetry,
+		"WORKER_FAILURE_RETRY_DELAY":      c.WorkerFailureRetryDelay,
+		"WORKER_FAILURE_RETRY_MAX_DELAY":  c.WorkerFailureRetryMaxDelay,
+		"BREAKER_OPEN_TIMEOUT":            c.BreakerOpenTimeout,
+		"ALERT_COOLDOWN":                  c.AlertCooldown,
+		"LEADER_LEASE_TTL":                c.LeaderLeaseTtl,
+		"ACCRUAL_RECONCILE_INTERVAL":      c.AccrualReconcileInterval,
+	} {
+		if duration <= 0 {
+			problems = append(problems, fmt.Sprintf("%s must be a positive duration, got %s", key, duration))
+		}
+	}
+
+	if c.WorkerFailureRetryMaxDelay < c.WorkerFailureRetryDelay {
+		problems = append(problems, fmt.Sprintf("WORKER_FAILURE_RETRY_MAX_DELAY (%s) must not be less than WORKER_FAILURE_RETRY_DELAY (%s)", c.WorkerFailureRetryMaxDelay, c.WorkerFailureRetryDelay))
+	}
+
+	for key, value := range map[string]int{
+		"BREAKER_FAILURE_THRESHOLD":   c.BreakerFailureThreshold,
+		"FARM_PROCESSING_CONCURRENCY": c.FarmProcessingConcurrency,
+		"SERVICE_MAX_ERROR_COUNT":     c.ServiceMaxErrorCount,
+		"SWEEP_MAX_AGE_DAYS":          c.SweepMaxAgeDays,
+	} {
+		if value <= 0 {
+			problems = append(problems, fmt.Sprintf("%s must be positive, got %d", key, value))
+		}
+	}
+
+	for key, value := range map[string]int{
+		"RBF_TRANSACTION_RETRY_DELAY_IN_SECONDS": c.RBFTransactionRetryDelayInSeconds,
+		"RBF_TRANSACTION_RETRY_MAX_COUNT":        c.RBFTransactionRetryMaxCount,
+	} {
+		if value < 0 {
+			problems = append(problems, fmt.Sprintf("%s must not be negative, got %d", key, value))
+		}
+	}
+
+	if c.GlobalPayoutThresholdInBTC < 0 {
+		problems = append(problems, fmt.Sprintf("GLOBAL_PAYOUT_THRESHOLD_IN_BTC must not be negative, got %v", c.GlobalPayoutThresholdInBTC))
+	}
+
+	if c.MinAddressPayoutThresholdInBTC < 0 {
+		problems = append(problems, fmt.Sprintf("MIN_ADDRESS_PAYOUT_THRESHOLD_IN_BTC must not be negative, got %v", c.MinAddressPayoutThresholdInBTC))
+	}
+
+	if c.SweepDustFloorInBTC < 0 {
+		problems = append(problems, fmt.Sprintf("SWEEP_DUST_FLOOR_IN_BTC must not be negative, got %v", c.SweepDustFloorInBTC))
+	}
+
+	if c.CrossFarmMinShareInBTC < 0 {
+		problems = append(problems, fmt.Sprintf("CROSS_FARM_MIN_SHARE_IN_BTC must not be negative, got %v", c.CrossFarmMinShareInBTC))
+	}
+
+	for key, address := range map[string]string{
+		"CUDO_FEE_PAYOUT_ADDRESS":             c.CUDOFeePayoutAddress,
+		"CUDO_MAINTENANCE_FEE_PAYOUT_ADDRESS": c.CUDOMaintenanceFeePayoutAddress,
+	} {
+		if address == "" {
+			continue
+		}
+		if err := validateBtcAddress(address, c.ChainParams()); err != nil {
+			problems = append(problems, fmt.Sprintf("%s %s", key, err))
+		}
+	}
+
+	switch c.DbDriverName {
+	case "postgres":
+		for key, value := range map[string]string{
+			"DB_HOST": c.DbHost,
+			"DB_PORT": c.DbPort,
+			"DB_USER": c.DbUser,
+		} {
+			if value == "" {
+				problems = append(problems, fmt.Sprintf("%s is required by the postgres db driver", key))
+			}
+		}
+	case "sqlite3":
+	default:
+		problems = append(problems, fmt.Sprintf("DB_DRIVER_NAME must be postgres or sqlite3, got {%s}", c.DbDriverName))
+	}
+
+	switch c.SecretsProvider {
+	case "env", "file":
+	case "keystore":
+		if c.SecretsKeystorePath == "" {
+			problems = append(problems, "SECRETS_KEYSTORE_PATH is required by the keystore secrets provider")
+		}
+		if c.SecretsKeystorePasswordFile == "" {
+			problems = append(problems, "SECRETS_KEYSTORE_PASSWORD_FILE is required by the keystore secrets provider")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("SECRETS_PROVIDER must be one of env, file or keystore, got {%s}", c.SecretsProvider))
+	}
+
+	switch c.PriceSource {
+	case "none", "coingecko":
+	case "file":
+		if c.PriceFile == "" {
+			problems = append(problems, "PRICE_FILE is required by the file price source")
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("PRICE_SOURCE must be one of none, coingecko or file, got {%s}", c.PriceSource))
+	}
+
+	if _, err := time.LoadLocation(c.ScheduleTimezone); err != nil {
+		problems = append(problems, fmt.Sprintf("SCHEDULE_TIMEZONE is invalid: %s", err))
+	}
+
+	for key, spec := range map[string]string{
+		"PAY_SCHEDULE":   c.PaySchedule,
+		"RETRY_SCHEDULE": c.RetrySchedule,
+		"SWEEP_SCHEDULE": c.SweepSchedule,
+	} {
+		if spec == "" {
+			continue
+		}
+		if _, err := schedule.Parse(spec, c.ScheduleTimezone); err != nil {
+			problems = append(problems, fmt.Sprintf("%s is invalid: %s", key, err))
+		}
+	}
+
+	// the maps above are iterated in random order
+	sort.Strings(problems)
+	return problems
+}
+
+func validateBtcAddress(address string, chainParams *chaincfg.Params) error {
+	decodedAddress, err := btcutil.DecodeAddress(address, chainParams)
+	if err == nil && !decodedAddress.IsForNet(chainParams) {
+		err = fmt.Errorf("address is for another network")
+	}
+	if err != nil {
+		return fmt.Errorf("{%s} is not a valid bitcoin address of the %s network: %s", address, chainParams.Name, err)
+	}
+
+	return nil
+}
+
+// configSource reads the config values from the environment and the config file and collects the problems with them
+type configSource struct {
+	values   map[string]string
+	known    map[string]bool
+	problems []string
 }
 
-// Simple helper function to read an environment variable into integer or return a default value
-func getEnvAsFloat64(name string, defaultVal float64) float64 {
-	valueStr := getEnv(name, "")
-	if value, err := strconv.ParseFloat(strings.TrimSpace(valueStr), 64); err == nil {
+func (s *configSource) readFile(configFile string) error {
+	content, err := os.ReadFile(configFile)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %s", err)
+	}
+
+	var values map[string]interface{}
+	switch strings.ToLower(filepath.Ext(configFile)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &values)
+	case ".toml":
+		var tree *toml.Tree
+		if tree, err = toml.LoadBytes(content); err == nil {
+			values = tree.ToMap()
+		}
+	default:
+		var envValues map[string]string
+		if envValues, err = godotenv.Unmarshal(string(content)); err == nil {
+			values = make(map[string]interface{})
+			for key, value := range envValues {
+				values[key] = value
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file {%s}: %s", configFile, err)
+	}
+
+	for key, value := range values {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			s.problems = append(s.problems, fmt.Sprintf("%s must be a single value", key))
+		case nil:
+		default:
+			s.values[strings.ToUpper(key)] = fmt.Sprint(value)
+		}
+	}
+
+	return nil
+}
+
+// lookup returns the value of the key from the environment or the config file. Empty values are treated as missing.
+func (s *configSource) lookup(key string) (string, bool) {
+	s.known[key] = true
+
+	value, ok := os.LookupEnv(key)
+	if !ok || value == "" {
+		value = s.values[key]
+	}
+
+	value = strings.TrimSpace(value)
+	return value, value != ""
+}
+
+// unknownKeys returns a problem for every key of the config file that is not a config key, usually a typo
+func (s *configSource) unknownKeys() []string {
+	var problems []string
+	for key := range s.values {
+		if !s.known[key] {
+			problems = append(problems, fmt.Sprintf("%s is not a known config key", key))
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+func (s *configSource) getString(key, defaultVal string) string {
+	if value, ok := s.lookup(key); ok {
 		return value
 	}
 
 	return defaultVal
 }
 
-// Helper to read an environment variable into a bool or return default value
-func getEnvAsBool(name string, defaultVal bool) bool {
-	valStr := getEnv(name, "")
-	if val, err := strconv.ParseBool(valStr); err == nil {
-		return val
+func (s *configSource) getRequiredString(key string) string {
+	value, ok := s.lookup(key)
+	if !ok {
+		s.problems = append(s.problems, fmt.Sprintf("%s is required", key))
 	}
 
-	return defaultVal
+	return value
+}
+
+// getList returns the comma separated values of the key in lower case, e.g. usd,eur
+func (s *configSource) getList(key string, defaultVal []string) []string {
+	valueStr, ok := s.lookup(key)
+	if !ok {
+		return defaultVal
+	}
+
+	var values []string
+	for _, value := range strings.Split(valueStr, ",") {
+		if value = strings.ToLower(strings.TrimSpace(value)); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	if len(values) == 0 {
+		return defaultVal
+	}
+
+	return values
 }
 
-// Helper to read an environment variable into a string slice or return default value
-func getEnvAsSlice(name string, defaultVal []string, sep string) []string {
-	valStr := getEnv(name, "")
+func (s *configSource) getInt(key string, defaultVal int) int {
+	valueStr, ok := s.lookup(key)
+	if !ok {
+		return defaultVal
+	}
 
-	if valStr == "" {
+	value, err := strconv.Atoi(valueStr)
+	if err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("%s must be an integer, got {%s}", key, valueStr))
 		return defaultVal
 	}
 
-	val := strings.Split(valStr, sep)
+	return value
+}
+
+func (s *configSource) getFloat64(key string, defaultVal float64) float64 {
+	valueStr, ok := s.lookup(key)
+	if !ok {
+		return defaultVal
+	}
 
-	return val
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("%s must be a number, got {%s}", key, valueStr))
+		return defaultVal
+	}
+
+	return value
 }
 
-func getEnvAsDuration(name string, defaultVal time.Duration) time.Duration {
-	valStr := getEnv(name, "")
-	if valStr == "" {
+// getSats parses an amount in BTC exactly, without going through a float. More than 8 decimals are refused.
+func (s *configSource) getSats(key string, defaultVal types.Sats) types.Sats {
+	valueStr, ok := s.lookup(key)
+	if !ok {
 		return defaultVal
 	}
-	if duration, err := time.ParseDuration(valStr); err == nil {
-		return duration
+
+	value, err := decimal.NewFromString(valueStr)
+	if err != nil || !value.Shift(8).IsInteger() {
+		s.problems = append(s.problems, fmt.Sprintf("%s must be an amount in BTC with at most 8 decimals, got {%s}", key, valueStr))
+		return defaultVal
 	}
-	return defaultVal
+
+	return types.NewSatsFromBtc(value)
+}
+
+func (s *configSource) getBool(key string, defaultVal bool) bool {
+	valueStr, ok := s.lookup(key)
+	if !ok {
+		return defaultVal
+	}
+
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("%s must be true or false, got {%s}", key, valueStr))
+		return defaultVal
+	}
+
+	return value
+}
+
+func (s *configSource) getDuration(key string, defaultVal time.Duration) time.Duration {
+	valueStr, ok := s.lookup(key)
+	if !ok {
+		return defaultVal
+	}
+
+	value, err := time.ParseDuration(valueStr)
+	if err != nil {
+		s.problems = append(s.problems, fmt.Sprintf("%s must be a duration like 30s or 5m, got {%s}", key, valueStr))
+		return defaultVal
+	}
+
+	return value
 }
@@ -0,0 +1,173 @@
+package infrastructure
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/stretchr/testify/require"
+)
+
+const validConfigYaml = `
+hasura_url: http://hasura
+node_rest_url: http://node
+bitcoin_node_url: http://bitcoind
+bitcoin_node_port: 38332
+bitcoin_node_user_name: user
+bitcoin_node_password: password
+foundry_pool_api_base_url: http://foundry
+foundry_pool_api_key: key
+db_driver_name: postgres
+db_host: localhost
+db_port: 5432
+db_user: postgres
+db_name: aura-pay
+network: BTC
+is_testing: true
+cudo_fee_payout_address: n2Wgrv3LAaaWzF44B7DdumkcL2GnvaCmjP
+cudo_maintenance_fee_payout_address: n2Wgrv3LAaaWzF44B7DdumkcL2GnvaCmjP
+worker_process_interval_payment: 1m
+rbf_transaction_retry_max_count: 3
+`
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	config, err := LoadConfig(writeConfigFile(t, "config.yaml", validConfigYaml))
+	require.NoError(t, err)
+	require.Equal(t, "http://hasura", config.HasuraURL)
+	require.Equal(t, "38332", config.BitcoinNodePort)
+	require.Equal(t, time.Minute, config.WorkerProcessIntervalPayment)
+	require.Equal(t, 3, config.RBFTransactionRetryMaxCount)
+	require.Equal(t, 10.0, config.CUDOMaintenanceFeePercent)
+}
+
+func TestLoadConfig_EnvironmentOverridesFile(t *testing.T) {
+	t.Setenv("RBF_TRANSACTION_RETRY_MAX_COUNT", "5")
+
+	config, err := LoadConfig(writeConfigFile(t, "config.yaml", validConfigYaml))
+	require.NoError(t, err)
+	require.Equal(t, 5, config.RBFTransactionRetryMaxCount)
+}
+
+func TestLoadConfig_Toml(t *testing.T) {
+	config, err := LoadConfig(writeConfigFile(t, "config.toml", `
+HASURA_URL = "http://hasura"
+NODE_REST_URL = "http://node"
+BITCOIN_NODE_URL = "http://bitcoind"
+BITCOIN_NODE_PORT = 38332
+BITCOIN_NODE_USER_NAME = "user"
+BITCOIN_NODE_PASSWORD = "password"
+FOUNDRY_POOL_API_BASE_URL = "http://foundry"
+FOUNDRY_POOL_API_KEY = "key"
+DB_DRIVER_NAME = "postgres"
+DB_HOST = "localhost"
+DB_PORT = 5432
+DB_USER = "postgres"
+DB_NAME = "aura-pay"
+NETWORK = "BTC"
+CUDO_FEE_PAYOUT_ADDRESS = "n2Wgrv3LAaaWzF44B7DdumkcL2GnvaCmjP"
+CUDO_MAINTENANCE_FEE_PAYOUT_ADDRESS = "n2Wgrv3LAaaWzF44B7DdumkcL2GnvaCmjP"
+CUDO_FEE_ON_ALL_BTC = 2.5
+`))
+	require.NoError(t, err)
+	require.Equal(t, "5432", config.DbPort)
+	require.Equal(t, 2.5, config.CUDOFeeOnAllBTC)
+}
+
+func TestLoadConfig_ReportsAllProblems(t *testing.T) {
+	_, err := LoadConfig(writeConfigFile(t, ".env", `
+HASURA_URL=http://hasura
+RBF_TRANSACTION_RETRY_MAX_COUN=3
+CUDO_MAINTENANCE_FEE_PERCENT=120
+WORKER_PROCESS_INTERVAL_RETRY=-1s
+BREAKER_FAILURE_THRESHOLD=three
+CROSS_FARM_MIN_SHARE_IN_BTC=-0.0001
+IS_TESTING=false
+CUDO_FEE_PAYOUT_ADDRESS=n2Wgrv3LAaaWzF44B7DdumkcL2GnvaCmjP
+CUDO_MAINTENANCE_FEE_PAYOUT_ADDRESS=not_an_address
+`))
+	require.Error(t, err)
+
+	configErr, ok := err.(*ConfigError)
+	require.True(t, ok)
+	require.Contains(t, configErr.Problems, "RBF_TRANSACTION_RETRY_MAX_COUN is not a known config key")
+	require.Contains(t, configErr.Problems, "NODE_REST_URL is required")
+	require.Contains(t, configErr.Problems, "CUDO_MAINTENANCE_FEE_PERCENT must be between 0 and 100, got 120")
+	require.Contains(t, configErr.Problems, "WORKER_PROCESS_INTERVAL_RETRY must be a positive duration, got -1s")
+	require.Contains(t, configErr.Problems, "BREAKER_FAILURE_THRESHOLD must be an integer, got {three}")
+	require.Contains(t, configErr.Problems, "CROSS_FARM_MIN_SHARE_IN_BTC must not be negative, got -0.0001")
+	require.Contains(t, configErr.Problems, "CUDO_FEE_PAYOUT_ADDRESS {n2Wgrv3LAaaWzF44B7DdumkcL2GnvaCmjP} is not a valid bitcoin address of the mainnet network: unknown address type")
+	require.Contains(t, configErr.Problems, "CUDO_MAINTENANCE_FEE_PAYOUT_ADDRESS {not_an_address} is not a valid bitcoin address of the mainnet network: decoded address is of unknown format")
+	require.NotContains(t, configErr.Problems, "HASURA_URL is required")
+}
+
+func TestLoadConfig_BtcAmounts(t *testing.T) {
+	t.Setenv("GLOBAL_PAYOUT_THRESHOLD_IN_BTC", "0.29")
+	t.Setenv("SWEEP_DUST_FLOOR_IN_BTC", "1e-5")
+
+	config, err := LoadConfig(writeConfigFile(t, "config.yaml", validConfigYaml))
+	require.NoError(t, err)
+	require.Equal(t, types.Sats(29000000), config.GlobalPayoutThresholdInBTC)
+	require.Equal(t, types.Sats(1000000), config.MinAddressPayoutThresholdInBTC)
+	require.Equal(t, types.Sats(1000), config.SweepDustFloorInBTC)
+
+	t.Setenv("CROSS_FARM_MIN_SHARE_IN_BTC", "0.000000001")
+	_, err = LoadConfig(writeConfigFile(t, "config.yaml", validConfigYaml))
+	require.EqualError(t, err, "invalid config:\n - CROSS_FARM_MIN_SHARE_IN_BTC must be an amount in BTC with at most 8 decimals, got {0.000000001}")
+}
+
+func TestLoadConfig_SecretsProvider(t *testing.T) {
+	t.Setenv("SECRETS_PROVIDER", "keystore")
+
+	_, err := LoadConfig(writeConfigFile(t, "config.yaml", validConfigYaml))
+	require.Error(t, err)
+
+	configErr, ok := err.(*ConfigError)
+	require.True(t, ok)
+	require.Equal(t, []string{
+		"SECRETS_KEYSTORE_PASSWORD_FILE is required by the keystore secrets provider",
+		"SECRETS_KEYSTORE_PATH is required by the keystore secrets provider",
+	}, configErr.Problems)
+
+	t.Setenv("SECRETS_PROVIDER", "vault")
+	_, err = LoadConfig(writeConfigFile(t, "config.yaml", validConfigYaml))
+	require.EqualError(t, err, "invalid config:\n - SECRETS_PROVIDER must be one of env, file or keystore, got {vault}")
+}
+
+func TestLoadConfig_PriceSource(t *testing.T) {
+	config, err := LoadConfig(writeConfigFile(t, "config.yaml", validConfigYaml))
+	require.NoError(t, err)
+	require.Equal(t, "coingecko", config.PriceSource)
+	require.Equal(t, []string{"usd"}, config.PriceFiatCurrencies)
+
+	t.Setenv("PRICE_SOURCE", "file")
+	t.Setenv("PRICE_FIAT_CURRENCIES", "USD, eur,")
+	_, err = LoadConfig(writeConfigFile(t, "config.yaml", validConfigYaml))
+	require.EqualError(t, err, "invalid config:\n - PRICE_FILE is required by the file price source")
+
+	t.Setenv("PRICE_FILE", "prices.json")
+	config, err = LoadConfig(writeConfigFile(t, "config.yaml", validConfigYaml))
+	require.NoError(t, err)
+	require.Equal(t, []string{"usd", "eur"}, config.PriceFiatCurrencies)
+}
+
+func TestLoadConfig_DbDriver(t *testing.T) {
+	t.Setenv("DB_DRIVER_NAME", "sqlite3")
+	t.Setenv("DB_NAME", "aura-pay.db")
+
+	config, err := LoadConfig(writeConfigFile(t, "config.yaml", validConfigYaml))
+	require.NoError(t, err)
+	require.Equal(t, "sqlite3", config.DbDriverName)
+	require.Equal(t, "aura-pay.db", config.DbName)
+
+	t.Setenv("DB_DRIVER_NAME", "mysql")
+	_, err = LoadConfig(writeConfigFile(t, "config.yaml", validConfigYaml))
+	require.EqualError(t, err, "invalid config:\n - DB_DRIVER_NAME must be postgres or sqlite3, got {mysql}")
+}
@@ -1,11 +1,7 @@
 package infrastructure
 
 import (
-	"fmt"
 	"time"
-
-	"github.com/sendgrid/sendgrid-go"
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
 )
 
 func NewHelper(config *Config) *Helper {
@@ -31,18 +27,3 @@ func (h *Helper) Unix() int64 {
 func (h *Helper) Date() (year int, month time.Month, day int) {
 	return time.Now().Date()
 }
-
-func (h *Helper) SendMail(message string) error {
-	from := mail.NewEmail("Aura Pay Service", h.config.MailFromAddress)
-	subject := "Automatic email from Aura Pay Service"
-	to := mail.NewEmail("User", h.config.MailToAddress)
-	plainTextContent := message
-	htmlContent := fmt.Sprintf("<strong>%s</strong>", message)
-	emailMsg := mail.NewSingleEmail(from, subject, to, plainTextContent, htmlContent)
-	client := sendgrid.NewSendClient(h.config.SendgridApiKey)
-	_, err := client.Send(emailMsg)
-	if err != nil {
-		return err
-	}
-	return nil
-}
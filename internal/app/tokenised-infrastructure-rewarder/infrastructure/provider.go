@@ -2,10 +2,12 @@ package infrastructure
 
 import (
 	"fmt"
+	"net/url"
 
 	"github.com/btcsuite/btcd/rpcclient"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/rs/zerolog/log"
 )
 
@@ -36,7 +38,32 @@ func (p *Provider) InitBtcRpcClient() (*rpcclient.Client, error) {
 	return client, err
 }
 
+// InitBtcWalletRpcClient creates a client for the multiwallet endpoint of the node,
+// so the wallet calls go to the given wallet even when several wallets are loaded
+func (p *Provider) InitBtcWalletRpcClient(walletName string) (*rpcclient.Client, error) {
+	connCfg := &rpcclient.ConnConfig{
+		Host:         p.config.BitcoinNodeUrl + ":" + p.config.BitcoinNodePort + "/wallet/" + url.PathEscape(walletName),
+		User:         p.config.BitcoinNodeUserName,
+		Pass:         p.config.BitcoinNodePassword,
+		HTTPPostMode: true,
+		DisableTLS:   true,
+	}
+
+	client, err := rpcclient.New(connCfg, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug().Msgf("rpcClient initiated with host: %s", connCfg.Host)
+
+	return client, err
+}
+
+// InitDBConnection connects to postgres, or with DB_DRIVER_NAME=sqlite3 opens the sqlite db file DB_NAME
 func (p *Provider) InitDBConnection() (*sqlx.DB, error) {
+	if p.config.DbDriverName == "sqlite3" {
+		return p.initSqliteConnection()
+	}
 
 	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s "+
 		"password=%s dbname=%s sslmode=disable",
@@ -51,3 +78,18 @@ func (p *Provider) InitDBConnection() (*sqlx.DB, error) {
 
 	return db, nil
 }
+
+func (p *Provider) initSqliteConnection() (*sqlx.DB, error) {
+	// the workers and the admin api have their own connections, the busy timeout makes them wait for each other's writes
+	db, err := sqlx.Connect("sqlite3", fmt.Sprintf("file:%s?_busy_timeout=5000&_journal_mode=WAL", p.config.DbName))
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite has a single writer, more connections would only wait for each other
+	db.SetMaxOpenConns(1)
+
+	log.Debug().Msgf("Successfull connection to sqlite database: %s", p.config.DbName)
+
+	return db, nil
+}
@@ -0,0 +1,229 @@
+package tokenised_infrastructure_rewarder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/sql_db"
+	"github.com/rs/zerolog/log"
+)
+
+// LeaseName is the lease that the replicas compete for. The pay and retry workers run only on its holder.
+const LeaseName = "aura-pay-workers"
+
+type LeaseStorage interface {
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
+
+// Leader keeps the lease of this replica in the db, so only one replica runs the workers at a time.
+// The lease is renewed every third of its ttl. When it can not be renewed in time,
+// the replica steps down before the lease expires and a standby can take it over.
+// The db decides when the lease expires. The replica counts its own deadline from before the renewal was sent
+// and keeps it shorter than the ttl, so it always steps down before the db hands the lease to a standby.
+type Leader struct {
+	name   string
+	holder string
+	ttl    time.Duration
+	now    func() time.Time
+
+	mutex     sync.Mutex
+	expiresAt time.Time
+	lost      chan struct{}
+}
+
+// NewLeader creates the leader election of this replica. Without holder the hostname and the pid are used.
+func NewLeader(name, holder string, ttl time.Duration) *Leader {
+	if holder == "" {
+		hostname, _ := os.Hostname()
+		holder = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+
+	return &Leader{
+		name:   name,
+		holder: holder,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Start connects to the db and campaigns for the lease until the context is done.
+// Without the lease the workers do not run at all, so a failed connection is retried.
+func (l *Leader) Start(ctx context.Context, config *infrastructure.Config, provider Provider) {
+	retry := func(err error) {
+		log.Error().Msgf("lease {%s} error: %s", l.name, err)
+
+		select {
+		case <-time.After(config.WorkerFailureRetryDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	for ctx.Err() == nil {
+		db, err := provider.InitDBConnection()
+		if err != nil {
+			retry(err)
+			continue
+		}
+
+		storage := sql_db.NewSqlDB(db)
+		if err := storage.CheckSchemaVersion(ctx); err != nil {
+			db.Close()
+			retry(err)
+			continue
+		}
+
+		l.Run(ctx, storage)
+		db.Close()
+	}
+}
+
+// Run campaigns for the lease until the context is done and releases it after that
+func (l *Leader) Run(ctx context.Context, storage LeaseStorage) {
+	ticker := time.NewTicker(l.renewInterval())
+	defer ticker.Stop()
+
+	for {
+		l.campaign(ctx, storage)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			l.resign(storage)
+			return
+		}
+	}
+}
+
+func (l *Leader) IsLeader() bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.isLeader()
+}
+
+// Context returns a context that is canceled as soon as this replica loses the lease,
+// or when the lease expires because the renewals hang. Its deadline is extended with each renewal.
+// Returns false if this replica is not the leader.
+func (l *Leader) Context(ctx context.Context) (context.Context, context.CancelFunc, bool) {
+	l.mutex.Lock()
+	isLeader, lost := l.isLeader(), l.lost
+	l.mutex.Unlock()
+
+	if !isLeader {
+		return nil, nil, false
+	}
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	go l.cancelOnExpiry(leaderCtx, cancel, lost)
+
+	return leaderCtx, cancel, true
+}
+
+// cancelOnExpiry waits until the local deadline of the lease and cancels the context if the lease was not renewed meanwhile
+func (l *Leader) cancelOnExpiry(ctx context.Context, cancel context.CancelFunc, lost chan struct{}) {
+	for {
+		l.mutex.Lock()
+		stillLeader, expiresAt := l.lost == lost, l.expiresAt
+		l.mutex.Unlock()
+
+		remaining := expiresAt.Sub(l.now())
+		if !stillLeader || remaining <= 0 {
+			cancel()
+			return
+		}
+
+		timer := time.NewTimer(remaining)
+		select {
+		case <-timer.C:
+		case <-lost:
+			timer.Stop()
+			cancel()
+			return
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (l *Leader) campaign(ctx context.Context, storage LeaseStorage) {
+	now := l.now()
+
+	// a renewal that hangs must not outlive the next one, the lease could expire meanwhile
+	renewCtx, cancel := context.WithTimeout(ctx, l.renewInterval())
+	defer cancel()
+
+	acquired, err := storage.AcquireLease(renewCtx, l.name, l.holder, l.ttl)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if err != nil {
+		log.Error().Msgf("Failed to renew lease {%s}: %s", l.name, err)
+		// the next renewal would be too late, so the lease is given up while it is still ours
+		if l.lost != nil && now.Add(l.renewInterval()).After(l.expiresAt) {
+			l.stepDown()
+		}
+		return
+	}
+
+	if !acquired {
+		if l.lost != nil {
+			l.stepDown()
+		}
+		return
+	}
+
+	if l.lost == nil {
+		log.Info().Msgf("Acquired lease {%s} as {%s}, this replica is the leader", l.name, l.holder)
+		l.lost = make(chan struct{})
+		metrics.Leader.Set(1)
+	}
+	l.expiresAt = now.Add(l.localTTL())
+}
+
+func (l *Leader) resign(storage LeaseStorage) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.lost == nil {
+		return
+	}
+
+	l.stepDown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := storage.ReleaseLease(ctx, l.name, l.holder); err != nil {
+		log.Error().Msgf("Failed to release lease {%s}: %s", l.name, err)
+	}
+}
+
+func (l *Leader) isLeader() bool {
+	return l.lost != nil && l.now().Before(l.expiresAt)
+}
+
+func (l *Leader) stepDown() {
+	log.Warn().Msgf("Lost lease {%s}, this replica is a standby", l.name)
+	close(l.lost)
+	l.lost = nil
+	l.expiresAt = time.Time{}
+	metrics.Leader.Set(0)
+}
+
+func (l *Leader) renewInterval() time.Duration {
+	return l.ttl / 3
+}
+
+// localTTL is how long this replica considers itself the leader after a renewal.
+// It is shorter than the ttl by a margin for the drift of the local clock against the db.
+func (l *Leader) localTTL() time.Duration {
+	return l.ttl - l.ttl/6
+}
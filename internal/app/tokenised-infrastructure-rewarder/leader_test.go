@@ -0,0 +1,218 @@
+package tokenised_infrastructure_rewarder
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/sql_db"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLeaderCampaign(t *testing.T) {
+	storage := &mockLeaseStorage{}
+	storage.On("AcquireLease", mock.Anything, LeaseName, "replica_1", time.Minute).Return(true, nil).Once()
+	storage.On("AcquireLease", mock.Anything, LeaseName, "replica_1", time.Minute).Return(false, nil).Once()
+
+	leader := NewLeader(LeaseName, "replica_1", time.Minute)
+	_, _, isLeader := leader.Context(context.Background())
+	require.False(t, isLeader)
+
+	leader.campaign(context.Background(), storage)
+	require.True(t, leader.IsLeader())
+
+	leaderCtx, cancel, isLeader := leader.Context(context.Background())
+	require.True(t, isLeader)
+	defer cancel()
+
+	// another replica took the lease over
+	leader.campaign(context.Background(), storage)
+	require.False(t, leader.IsLeader())
+
+	select {
+	case <-leaderCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("the context of the leader was not canceled after the lease was lost")
+	}
+}
+
+func TestLeaderRenewalFailure(t *testing.T) {
+	storage := &mockLeaseStorage{}
+	storage.On("AcquireLease", mock.Anything, LeaseName, "replica_1", time.Minute).Return(true, nil).Once()
+	storage.On("AcquireLease", mock.Anything, LeaseName, "replica_1", time.Minute).Return(false, errors.New("db is down"))
+
+	leader := NewLeader(LeaseName, "replica_1", time.Minute)
+	leader.campaign(context.Background(), storage)
+
+	// the lease is still valid long enough for the next renewal
+	leader.campaign(context.Background(), storage)
+	require.True(t, leader.IsLeader())
+
+	// the next renewal would be after the lease expires
+	leader.expiresAt = time.Now().Add(10 * time.Second)
+	leader.campaign(context.Background(), storage)
+	require.False(t, leader.IsLeader())
+}
+
+func TestLeaderContextExpiresWhenRenewalHangs(t *testing.T) {
+	storage := &blockingLeaseStorage{unblock: make(chan struct{})}
+	defer close(storage.unblock)
+
+	leader := NewLeader(LeaseName, "replica_1", 600*time.Millisecond)
+	leader.campaign(context.Background(), storage)
+	leaderCtx, cancel, isLeader := leader.Context(context.Background())
+	require.True(t, isLeader)
+	defer cancel()
+
+	leader.mutex.Lock()
+	expiresAt := leader.expiresAt
+	leader.mutex.Unlock()
+
+	// the renewal hangs in the db and never returns, so the replica can not step down by itself
+	go leader.campaign(context.Background(), storage)
+
+	select {
+	case <-leaderCtx.Done():
+		require.False(t, time.Now().Before(expiresAt), "the context is canceled when the lease expires")
+	case <-time.After(2 * time.Second):
+		t.Fatal("the context of the leader was not canceled when the lease expired")
+	}
+}
+
+func TestLeaderRenewalTimeout(t *testing.T) {
+	storage := &mockLeaseStorage{}
+	storage.On("AcquireLease", mock.Anything, LeaseName, "replica_1", 600*time.Millisecond).Return(true, nil).Once()
+	storage.On("AcquireLease", mock.Anything, LeaseName, "replica_1", 600*time.Millisecond).Return(false, context.DeadlineExceeded).
+		Run(func(args mock.Arguments) { <-args.Get(0).(context.Context).Done() })
+
+	leader := NewLeader(LeaseName, "replica_1", 600*time.Millisecond)
+	leader.campaign(context.Background(), storage)
+	leaderCtx, cancel, isLeader := leader.Context(context.Background())
+	require.True(t, isLeader)
+	defer cancel()
+
+	// the renewal is given up after the renew interval, the lease is still valid until the next one
+	start := time.Now()
+	leader.campaign(context.Background(), storage)
+	require.Less(t, time.Since(start), 400*time.Millisecond)
+	require.True(t, leader.IsLeader())
+
+	// without another renewal the context ends with the lease
+	select {
+	case <-leaderCtx.Done():
+		require.False(t, leader.IsLeader())
+	case <-time.After(2 * time.Second):
+		t.Fatal("the context of the leader was not canceled when the lease expired")
+	}
+}
+
+func TestLeaderWithSkewedClock(t *testing.T) {
+	storage := sql_db.NewSqlDB(newTestDB(t))
+
+	leader := NewLeader(LeaseName, "replica_1", time.Minute)
+	leader.campaign(context.Background(), storage)
+	require.True(t, leader.IsLeader())
+
+	// the clock of the standby runs far ahead of the leader and the db
+	standby := NewLeader(LeaseName, "replica_2", time.Minute)
+	standby.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	standby.campaign(context.Background(), storage)
+	require.False(t, standby.IsLeader())
+
+	leader.campaign(context.Background(), storage)
+	require.True(t, leader.IsLeader())
+	standby.campaign(context.Background(), storage)
+	require.False(t, standby.IsLeader())
+
+	// the deadline of the leader is shorter than the ttl
+	require.True(t, leader.expiresAt.Before(time.Now().Add(time.Minute)))
+
+	leader.resign(storage)
+	standby.campaign(context.Background(), storage)
+	require.True(t, standby.IsLeader())
+}
+
+func TestLeaseExpiresByTheClockOfTheDb(t *testing.T) {
+	storage := sql_db.NewSqlDB(newTestDB(t))
+
+	acquired, err := storage.AcquireLease(context.Background(), LeaseName, "replica_1", 50*time.Millisecond)
+	require.NoError(t, err)
+	require.True(t, acquired)
+
+	acquired, err = storage.AcquireLease(context.Background(), LeaseName, "replica_2", time.Minute)
+	require.NoError(t, err)
+	require.False(t, acquired)
+
+	time.Sleep(100 * time.Millisecond)
+
+	acquired, err = storage.AcquireLease(context.Background(), LeaseName, "replica_2", time.Minute)
+	require.NoError(t, err)
+	require.True(t, acquired)
+}
+
+func TestLeaderReleasesLeaseWhenDone(t *testing.T) {
+	storage := &mockLeaseStorage{}
+	storage.On("AcquireLease", mock.Anything, LeaseName, "replica_1", time.Minute).Return(true, nil)
+	storage.On("ReleaseLease", mock.Anything, LeaseName, "replica_1").Return(nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	leader := NewLeader(LeaseName, "replica_1", time.Minute)
+	leader.Run(ctx, storage)
+
+	require.False(t, leader.IsLeader())
+	storage.AssertCalled(t, "ReleaseLease", mock.Anything, LeaseName, "replica_1")
+}
+
+func TestNewLeaderShouldDefaultHolder(t *testing.T) {
+	require.NotEmpty(t, NewLeader(LeaseName, "", time.Minute).holder)
+}
+
+// newTestLeader returns a leader that holds the lease
+func newTestLeader(t *testing.T) *Leader {
+	storage := &mockLeaseStorage{}
+	storage.On("AcquireLease", mock.Anything, LeaseName, "test", time.Hour).Return(true, nil)
+
+	leader := NewLeader(LeaseName, "test", time.Hour)
+	leader.campaign(context.Background(), storage)
+	require.True(t, leader.IsLeader())
+
+	return leader
+}
+
+// blockingLeaseStorage grants the lease once and then hangs until it is unblocked, regardless of the context
+type blockingLeaseStorage struct {
+	calls   int
+	unblock chan struct{}
+}
+
+func (b *blockingLeaseStorage) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	b.calls++
+	if b.calls == 1 {
+		return true, nil
+	}
+
+	<-b.unblock
+	return false, errors.New("db is down")
+}
+
+func (b *blockingLeaseStorage) ReleaseLease(ctx context.Context, name, holder string) error {
+	return nil
+}
+
+type mockLeaseStorage struct {
+	mock.Mock
+}
+
+func (m *mockLeaseStorage) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	args := m.Called(ctx, name, holder, ttl)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *mockLeaseStorage) ReleaseLease(ctx context.Context, name, holder string) error {
+	args := m.Called(ctx, name, holder)
+	return args.Error(0)
+}
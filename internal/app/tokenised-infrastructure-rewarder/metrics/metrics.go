@@ -0,0 +1,191 @@
+package metrics
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/shopspring/decimal"
+)
+
+const namespace = "aura_pay"
+
+// External endpoints the service depends on
+const (
+	EndpointHasura    = "hasura"
+	EndpointCudosRest = "cudos_rest"
+	EndpointCudosRpc  = "cudos_rpc"
+	EndpointFoundry   = "foundry"
+	EndpointBitcoind  = "bitcoind"
+	EndpointDb        = "db"
+)
+
+// Classes of the recipients of the farm rewards
+const (
+	RecipientCudoFee     = "cudo_fee"
+	RecipientMaintenance = "maintenance"
+	RecipientNftOwners   = "nft_owners"
+	RecipientLeftovers   = "leftovers"
+)
+
+const (
+	statusOk    = "ok"
+	statusError = "error"
+)
+
+var (
+	WorkerRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "worker_runs_total",
+		Help:      "Number of runs of a worker service.",
+	}, []string{"service"})
+
+	WorkerRunFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "worker_run_failures_total",
+		Help:      "Number of runs of a worker service that returned an error.",
+	}, []string{"service"})
+
+	WorkerRunDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "worker_run_duration_seconds",
+		Help:      "Duration of the runs of a worker service.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800},
+	}, []string{"service"})
+
+	FarmProcessingDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "farm_processing_duration_seconds",
+		Help:      "Duration of processing a single farm in a pay run.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600},
+	}, []string{"farm"})
+
+	FarmProcessingFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "farm_processing_failures_total",
+		Help:      "Number of times processing a farm returned an error.",
+	}, []string{"farm"})
+
+	RewardsDistributedBtc = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rewards_distributed_btc_total",
+		Help:      "BTC allocated to each recipient class of a farm, including amounts accumulated below the payment threshold.",
+	}, []string{"farm", "recipient_class"})
+
+	PendingTransactions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "pending_transactions",
+		Help:      "Number of sent transactions waiting for a confirmation, as seen by the last retry run.",
+	})
+
+	Leader = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "leader",
+		Help:      "1 if this replica holds the lease and runs the workers, 0 otherwise.",
+	})
+
+	TransactionStatusChanges = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transaction_status_changes_total",
+		Help:      "Number of sent transactions that moved to a final status.",
+	}, []string{"status"})
+
+	RBFBumps = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rbf_bumps_total",
+		Help:      "Number of transactions replaced with a higher fee.",
+	}, []string{"farm"})
+
+	ExternalRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "external_request_duration_seconds",
+		Help:      "Latency of the requests to the external endpoints.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint", "operation"})
+
+	ExternalRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "external_requests_total",
+		Help:      "Number of requests to the external endpoints by http status code, ok or error.",
+	}, []string{"endpoint", "operation", "status"})
+
+	CircuitBreakerState = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_state",
+		Help:      "State of the circuit breaker of an external dependency: 0 closed, 1 half-open, 2 open.",
+	}, []string{"dependency"})
+
+	DbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Latency of the db operations.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	DbQueryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "db_query_errors_total",
+		Help:      "Number of db operations that returned an error.",
+	}, []string{"operation"})
+)
+
+// Handler serves all registered metrics in the prometheus format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveWorkerRun records a finished run of a worker service
+func ObserveWorkerRun(service string, start time.Time, err error) {
+	WorkerRuns.WithLabelValues(service).Inc()
+	WorkerRunDuration.WithLabelValues(service).Observe(time.Since(start).Seconds())
+	if err != nil {
+		WorkerRunFailures.WithLabelValues(service).Inc()
+	}
+}
+
+// ObserveHttpRequest records a request to an external http endpoint.
+// The status is the http status code of the response or error if no response was received.
+func ObserveHttpRequest(endpoint, operation string, start time.Time, response *http.Response, err error) {
+	status := statusError
+	if err == nil && response != nil {
+		status = strconv.Itoa(response.StatusCode)
+	}
+
+	ExternalRequestDuration.WithLabelValues(endpoint, operation).Observe(time.Since(start).Seconds())
+	ExternalRequests.WithLabelValues(endpoint, operation, status).Inc()
+}
+
+// ObserveRequest records a request to an external endpoint that is not called over plain http
+func ObserveRequest(endpoint, operation string, start time.Time, err error) {
+	status := statusOk
+	if err != nil {
+		status = statusError
+	}
+
+	ExternalRequestDuration.WithLabelValues(endpoint, operation).Observe(time.Since(start).Seconds())
+	ExternalRequests.WithLabelValues(endpoint, operation, status).Inc()
+}
+
+// ObserveDbQuery records a db operation. Meant to be deferred with a pointer to the named error result.
+// No rows is an expected result for some of the reads, so it is not counted as an error.
+func ObserveDbQuery(operation string, start time.Time, err *error) {
+	DbQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil && *err != nil && !errors.Is(*err, sql.ErrNoRows) {
+		DbQueryErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// AddRewardsDistributed adds the amount allocated to a recipient class of the farm
+func AddRewardsDistributed(farm, recipientClass string, amountBtc decimal.Decimal) {
+	if !amountBtc.IsPositive() {
+		return
+	}
+
+	amount, _ := amountBtc.Float64()
+	RewardsDistributedBtc.WithLabelValues(farm, recipientClass).Add(amount)
+}
@@ -0,0 +1,196 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const maxErrorClassLength = 120
+
+var (
+	// the values in the errors of the service are wrapped in braces, e.g. Farm Id: {1}
+	errorValuePattern  = regexp.MustCompile(`\{[^}]*\}`)
+	errorNumberPattern = regexp.MustCompile(`[0-9]+`)
+)
+
+/*
+AlertManager is shared by all services and decides which alerts are actually sent.
+
+ 1. Alerts are deduplicated by key, which is the source of the alert (a farm, a transaction, a worker)
+    and the class of its error. Values like ids and amounts are not part of the class.
+ 2. An alert is sent again only after the cooldown of its key passed. Until then it is suppressed.
+ 3. When a source recovers, a single resolved notice is sent for all of its firing alerts.
+ 4. Every digest interval the suppressed alerts are summarized in one notification.
+*/
+type AlertManager struct {
+	notifier       Notifier
+	cooldown       time.Duration
+	digestInterval time.Duration
+	now            func() time.Time
+
+	mutex  sync.Mutex
+	alerts map[string]*alertState
+}
+
+type alertState struct {
+	source       string
+	notification Notification
+	firstSent    time.Time
+	lastSent     time.Time
+	suppressed   int
+}
+
+func NewAlertManager(notifier Notifier, cooldown, digestInterval time.Duration) *AlertManager {
+	return &AlertManager{
+		notifier:       notifier,
+		cooldown:       cooldown,
+		digestInterval: digestInterval,
+		now:            time.Now,
+		alerts:         make(map[string]*alertState),
+	}
+}
+
+// Fire sends the alert of the source, unless the same alert was sent within the cooldown
+func (am *AlertManager) Fire(ctx context.Context, source string, notification Notification) {
+	key := alertKey(source, notification)
+	now := am.now()
+
+	am.mutex.Lock()
+	alert, ok := am.alerts[key]
+	if ok && now.Before(alert.lastSent.Add(am.cooldown)) {
+		alert.suppressed++
+		alert.notification = notification
+		am.mutex.Unlock()
+		log.Debug().Msgf("Alert {%s} is suppressed until the cooldown passes", key)
+		return
+	}
+
+	if !ok {
+		alert = &alertState{source: source, firstSent: now}
+		am.alerts[key] = alert
+	}
+	alert.notification = notification
+	alert.lastSent = now
+	am.mutex.Unlock()
+
+	am.send(ctx, notification)
+}
+
+// Resolve sends a resolved notice if the source has firing alerts and forgets them
+func (am *AlertManager) Resolve(ctx context.Context, source string) {
+	am.mutex.Lock()
+	resolved := []*alertState{}
+	for key, alert := range am.alerts {
+		if alert.source == source {
+			resolved = append(resolved, alert)
+			delete(am.alerts, key)
+		}
+	}
+	am.mutex.Unlock()
+
+	if len(resolved) == 0 {
+		return
+	}
+
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].firstSent.Before(resolved[j].firstSent) })
+
+	lines := []string{fmt.Sprintf("{%s} recovered. Resolved alerts:", source)}
+	for _, alert := range resolved {
+		lines = append(lines, fmt.Sprintf("- %s (first sent at %s)", alert.notification.Title, alert.firstSent.UTC().Format(time.RFC3339)))
+	}
+
+	last := resolved[len(resolved)-1].notification
+	am.send(ctx, Notification{
+		Severity: SeverityInfo,
+		Title:    fmt.Sprintf("Resolved: %s", source),
+		Message:  strings.Join(lines, "\n"),
+		Farm:     last.Farm,
+		TxHash:   last.TxHash,
+	})
+}
+
+// Run sends the digest of the suppressed alerts every digest interval until the context is done.
+// The digest is disabled if the interval is not positive.
+func (am *AlertManager) Run(ctx context.Context) {
+	if am.digestInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(am.digestInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			am.SendDigest(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// SendDigest summarizes the alerts suppressed since the last digest. Nothing is sent if nothing was suppressed.
+func (am *AlertManager) SendDigest(ctx context.Context) {
+	am.mutex.Lock()
+	keys := []string{}
+	for key, alert := range am.alerts {
+		if alert.suppressed > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	lines := []string{}
+	total := 0
+	for _, key := range keys {
+		alert := am.alerts[key]
+		lines = append(lines, fmt.Sprintf("- %s: %s, suppressed %d times. Last: %s", alert.source, alert.notification.Title, alert.suppressed, alert.notification.Message))
+		total += alert.suppressed
+		alert.suppressed = 0
+	}
+	am.mutex.Unlock()
+
+	if total == 0 {
+		return
+	}
+
+	am.send(ctx, Notification{
+		Severity: SeverityInfo,
+		Title:    "Digest of suppressed alerts",
+		Message:  fmt.Sprintf("%d alerts were suppressed in the last %s:\n%s", total, am.digestInterval, strings.Join(lines, "\n")),
+	})
+}
+
+// send never returns an error, a failed notification must not stop the caller
+func (am *AlertManager) send(ctx context.Context, notification Notification) {
+	if err := am.notifier.Notify(ctx, notification); err != nil {
+		log.Error().Msgf("Failed to send notification: %s", err)
+	}
+}
+
+func alertKey(source string, notification Notification) string {
+	text := notification.Error
+	if text == "" {
+		text = notification.Message
+	}
+
+	return fmt.Sprintf("%s/%s/%s", source, notification.Severity, errorClass(text))
+}
+
+// errorClass removes the values from the error, so the same failure with different values has the same class
+func errorClass(text string) string {
+	class := errorValuePattern.ReplaceAllString(text, "{}")
+	class = errorNumberPattern.ReplaceAllString(class, "#")
+	if len(class) > maxErrorClassLength {
+		class = class[:maxErrorClassLength]
+	}
+
+	return class
+}
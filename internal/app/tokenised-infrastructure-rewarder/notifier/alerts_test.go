@@ -0,0 +1,100 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAlertManager(notifier Notifier, now *time.Time) *AlertManager {
+	alertManager := NewAlertManager(notifier, 30*time.Minute, 6*time.Hour)
+	alertManager.now = func() time.Time { return *now }
+	return alertManager
+}
+
+func farmFailed(farmId int) Notification {
+	return Notification{
+		Severity: SeverityWarning,
+		Title:    "Processing farm failed",
+		Message:  "processing farm {farm_1} failed",
+		Farm:     "farm_1",
+		Error:    fmt.Sprintf("farm has maintenance fee set below 0. Farm Id: {%d}", farmId),
+	}
+}
+
+func TestAlertManagerShouldSuppressDuringCooldown(t *testing.T) {
+	now := time.Unix(1666641078, 0)
+	notifier := &testNotifier{}
+	alertManager := newTestAlertManager(notifier, &now)
+
+	alertManager.Fire(context.Background(), "farm farm_1", farmFailed(1))
+	now = now.Add(10 * time.Minute)
+	// the same error with a different value is the same alert
+	alertManager.Fire(context.Background(), "farm farm_1", farmFailed(2))
+	require.Len(t, notifier.notifications, 1)
+
+	// other sources are not hidden behind the alert of the first one
+	alertManager.Fire(context.Background(), "farm farm_2", farmFailed(1))
+	require.Len(t, notifier.notifications, 2)
+
+	now = now.Add(30 * time.Minute)
+	alertManager.Fire(context.Background(), "farm farm_1", farmFailed(1))
+	require.Len(t, notifier.notifications, 3)
+}
+
+func TestAlertManagerShouldSendResolvedNotice(t *testing.T) {
+	now := time.Unix(1666641078, 0)
+	notifier := &testNotifier{}
+	alertManager := newTestAlertManager(notifier, &now)
+
+	// nothing is firing, so there is nothing to resolve
+	alertManager.Resolve(context.Background(), "farm farm_1")
+	require.Empty(t, notifier.notifications)
+
+	alertManager.Fire(context.Background(), "farm farm_1", farmFailed(1))
+	alertManager.Fire(context.Background(), "farm farm_2", farmFailed(1))
+	alertManager.Resolve(context.Background(), "farm farm_1")
+	require.Len(t, notifier.notifications, 3)
+
+	resolved := notifier.notifications[2]
+	require.Equal(t, SeverityInfo, resolved.Severity)
+	require.Equal(t, "Resolved: farm farm_1", resolved.Title)
+	require.Equal(t, "farm_1", resolved.Farm)
+
+	// resolved only once and the alert is sent right away when it fails again
+	alertManager.Resolve(context.Background(), "farm farm_1")
+	alertManager.Fire(context.Background(), "farm farm_1", farmFailed(1))
+	require.Len(t, notifier.notifications, 4)
+}
+
+func TestAlertManagerDigest(t *testing.T) {
+	now := time.Unix(1666641078, 0)
+	notifier := &testNotifier{}
+	alertManager := newTestAlertManager(notifier, &now)
+
+	alertManager.SendDigest(context.Background())
+	require.Empty(t, notifier.notifications)
+
+	alertManager.Fire(context.Background(), "farm farm_1", farmFailed(1))
+	alertManager.Fire(context.Background(), "farm farm_1", farmFailed(1))
+	alertManager.Fire(context.Background(), "farm farm_1", farmFailed(2))
+	alertManager.SendDigest(context.Background())
+	require.Len(t, notifier.notifications, 2)
+
+	digest := notifier.notifications[1]
+	require.Equal(t, "Digest of suppressed alerts", digest.Title)
+	require.Contains(t, digest.Message, "2 alerts were suppressed in the last 6h0m0s")
+	require.Contains(t, digest.Message, "farm farm_1: Processing farm failed, suppressed 2 times")
+
+	// the suppressed alerts are reported only once
+	alertManager.SendDigest(context.Background())
+	require.Len(t, notifier.notifications, 2)
+}
+
+func TestErrorClass(t *testing.T) {
+	require.Equal(t, "farm has no AddressForReceivingRewardsFromPool, farm Id: {}", errorClass("farm has no AddressForReceivingRewardsFromPool, farm Id: {12}"))
+	require.Equal(t, "Retrying for # time", errorClass("Retrying for 3 time"))
+}
@@ -0,0 +1,101 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+type SendgridNotifier struct {
+	apiKey string
+	from   string
+	to     string
+}
+
+func NewSendgridNotifier(apiKey, from, to string) *SendgridNotifier {
+	return &SendgridNotifier{
+		apiKey: apiKey,
+		from:   from,
+		to:     to,
+	}
+}
+
+func (n *SendgridNotifier) Notify(ctx context.Context, notification Notification) error {
+	from := mail.NewEmail("Aura Pay Service", n.from)
+	to := mail.NewEmail("User", n.to)
+	htmlContent := fmt.Sprintf("<strong>%s</strong>", strings.ReplaceAll(html.EscapeString(notification.Text()), "\n", "<br>"))
+	emailMsg := mail.NewSingleEmail(from, notification.Subject(), to, notification.Text(), htmlContent)
+
+	client := sendgrid.NewSendClient(n.apiKey)
+	response, err := client.SendWithContext(ctx, emailMsg)
+	if err != nil {
+		return fmt.Errorf("sendgrid: %s", err)
+	}
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("sendgrid: request failed with StatusCode: %d. Error: %s", response.StatusCode, response.Body)
+	}
+
+	return nil
+}
+
+// SmtpNotifier sends plain text emails through an smtp server.
+// The recipients are separated by comma.
+type SmtpNotifier struct {
+	host     string
+	port     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func NewSmtpNotifier(host, port, username, password, from, to string) *SmtpNotifier {
+	recipients := []string{}
+	for _, recipient := range strings.Split(to, ",") {
+		if recipient = strings.TrimSpace(recipient); recipient != "" {
+			recipients = append(recipients, recipient)
+		}
+	}
+
+	return &SmtpNotifier{
+		host:     host,
+		port:     port,
+		username: username,
+		password: password,
+		from:     from,
+		to:       recipients,
+	}
+}
+
+func (n *SmtpNotifier) Notify(ctx context.Context, notification Notification) error {
+	var auth smtp.Auth
+	if n.username != "" {
+		auth = smtp.PlainAuth("", n.username, n.password, n.host)
+	}
+
+	if err := smtp.SendMail(net.JoinHostPort(n.host, n.port), auth, n.from, n.to, n.message(notification)); err != nil {
+		return fmt.Errorf("smtp: %s", err)
+	}
+
+	return nil
+}
+
+func (n *SmtpNotifier) message(notification Notification) []byte {
+	headers := []string{
+		fmt.Sprintf("From: Aura Pay Service <%s>", n.from),
+		fmt.Sprintf("To: %s", strings.Join(n.to, ", ")),
+		fmt.Sprintf("Subject: %s", notification.Subject()),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+	}
+
+	body := strings.ReplaceAll(notification.Text(), "\n", "\r\n")
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + body + "\r\n")
+}
@@ -0,0 +1,31 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Multi fans out every notification to all of its notifiers.
+// A failing channel does not stop the others, the errors of all failed channels are returned together.
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, notification Notification) error {
+	if notification.Time.IsZero() {
+		notification.Time = time.Now().UTC()
+	}
+
+	errs := []string{}
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, notification); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d notifiers failed: %s", len(errs), len(m), strings.Join(errs, "; "))
+	}
+
+	return nil
+}
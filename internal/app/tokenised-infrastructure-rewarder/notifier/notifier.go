@@ -0,0 +1,93 @@
+package notifier
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+)
+
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Notification is a single alert of the service. Farm, TxHash and Error are set only when they are known.
+type Notification struct {
+	Severity Severity  `json:"severity"`
+	Title    string    `json:"title"`
+	Message  string    `json:"message"`
+	Farm     string    `json:"farm,omitempty"`
+	TxHash   string    `json:"tx_hash,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Notifier sends notifications to a single channel, or to several of them in case of Multi
+type Notifier interface {
+	Notify(ctx context.Context, notification Notification) error
+}
+
+// New creates a notifier for all channels that are configured.
+// Without any configured channel the notifications are dropped.
+func New(config *infrastructure.Config) Notifier {
+	multi := Multi{}
+
+	if config.SendgridApiKey != "" {
+		multi = append(multi, NewSendgridNotifier(config.SendgridApiKey, config.MailFromAddress, config.MailToAddress))
+	}
+
+	if config.SmtpHost != "" {
+		multi = append(multi, NewSmtpNotifier(config.SmtpHost, config.SmtpPort, config.SmtpUsername, config.SmtpPassword, config.MailFromAddress, config.MailToAddress))
+	}
+
+	if config.NotifyWebhookUrl != "" {
+		multi = append(multi, NewWebhookNotifier(config.NotifyWebhookUrl))
+	}
+
+	if config.SlackWebhookUrl != "" {
+		multi = append(multi, NewSlackNotifier(config.SlackWebhookUrl))
+	}
+
+	return multi
+}
+
+// Subject is the single line summary of the notification, used as the email subject
+func (n Notification) Subject() string {
+	return fmt.Sprintf("[%s] Aura Pay Service: %s", strings.ToUpper(string(n.Severity)), n.Title)
+}
+
+// Text is the message followed by the known fields, one per line
+func (n Notification) Text() string {
+	lines := []string{n.Message}
+	for _, field := range n.fields() {
+		lines = append(lines, fmt.Sprintf("%s: %s", field.name, field.value))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+type field struct {
+	name  string
+	value string
+}
+
+func (n Notification) fields() []field {
+	fields := []field{}
+	if n.Farm != "" {
+		fields = append(fields, field{"Farm", n.Farm})
+	}
+	if n.TxHash != "" {
+		fields = append(fields, field{"TxHash", n.TxHash})
+	}
+	if n.Error != "" {
+		fields = append(fields, field{"Error", n.Error})
+	}
+
+	return fields
+}
@@ -0,0 +1,110 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/stretchr/testify/require"
+)
+
+var testNotification = Notification{
+	Severity: SeverityCritical,
+	Title:    "Transaction needs manual intervention",
+	Message:  "transaction has reached max RBF retry count",
+	Farm:     "farm_1",
+	TxHash:   "tx_hash_1",
+	Time:     time.Unix(1666641078, 0).UTC(),
+}
+
+func TestNotificationText(t *testing.T) {
+	require.Equal(t, "[CRITICAL] Aura Pay Service: Transaction needs manual intervention", testNotification.Subject())
+	require.Equal(t, "transaction has reached max RBF retry count\nFarm: farm_1\nTxHash: tx_hash_1", testNotification.Text())
+}
+
+func TestNewShouldUseConfiguredChannels(t *testing.T) {
+	require.Empty(t, New(&infrastructure.Config{}))
+
+	notifier := New(&infrastructure.Config{
+		SendgridApiKey:   "key",
+		SmtpHost:         "localhost",
+		NotifyWebhookUrl: "http://localhost/webhook",
+		SlackWebhookUrl:  "http://localhost/slack",
+	})
+	require.Len(t, notifier, 4)
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var received Notification
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPost, r.Method)
+		require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	require.NoError(t, NewWebhookNotifier(server.URL).Notify(context.Background(), testNotification))
+	require.Equal(t, testNotification, received)
+}
+
+func TestSlackNotifier(t *testing.T) {
+	var received slackMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	require.NoError(t, NewSlackNotifier(server.URL).Notify(context.Background(), testNotification))
+	require.True(t, strings.HasPrefix(received.Text, "*[CRITICAL]"))
+	require.Len(t, received.Attachments, 1)
+	require.Equal(t, "danger", received.Attachments[0].Color)
+	require.Equal(t, []slackField{{Title: "Farm", Value: "farm_1", Short: true}, {Title: "TxHash", Value: "tx_hash_1", Short: true}}, received.Attachments[0].Fields)
+}
+
+func TestWebhookNotifierShouldFailOnErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad request", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := NewWebhookNotifier(server.URL).Notify(context.Background(), testNotification)
+	require.EqualError(t, err, "webhook: request failed with StatusCode: 400. Error: bad request")
+}
+
+func TestSmtpNotifierMessage(t *testing.T) {
+	notifier := NewSmtpNotifier("localhost", "587", "", "", "from@aura.pay", "ops@aura.pay, dev@aura.pay")
+	require.Equal(t, []string{"ops@aura.pay", "dev@aura.pay"}, notifier.to)
+
+	message := string(notifier.message(testNotification))
+	require.Contains(t, message, "To: ops@aura.pay, dev@aura.pay\r\n")
+	require.Contains(t, message, "Subject: [CRITICAL] Aura Pay Service: Transaction needs manual intervention\r\n")
+	require.True(t, strings.HasSuffix(message, "\r\n\r\ntransaction has reached max RBF retry count\r\nFarm: farm_1\r\nTxHash: tx_hash_1\r\n"))
+}
+
+func TestMultiShouldNotifyAllChannels(t *testing.T) {
+	first, second := &testNotifier{}, &testNotifier{}
+	failing := &testNotifier{err: errors.New("channel is down")}
+
+	err := Multi{first, failing, second}.Notify(context.Background(), Notification{Severity: SeverityInfo, Message: "test"})
+	require.EqualError(t, err, "1 of 3 notifiers failed: channel is down")
+
+	require.Len(t, first.notifications, 1)
+	require.Len(t, second.notifications, 1)
+	require.False(t, second.notifications[0].Time.IsZero(), "the time should be set by Multi")
+}
+
+type testNotifier struct {
+	notifications []Notification
+	err           error
+}
+
+func (n *testNotifier) Notify(ctx context.Context, notification Notification) error {
+	n.notifications = append(n.notifications, notification)
+	return n.err
+}
@@ -0,0 +1,114 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// WebhookNotifier posts the notification as json to the url
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{
+		url:    url,
+		client: &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, notification Notification) error {
+	if err := postJSON(ctx, n.client, n.url, notification); err != nil {
+		return fmt.Errorf("webhook: %s", err)
+	}
+
+	return nil
+}
+
+// SlackNotifier posts the notification to a Slack compatible incoming webhook
+type SlackNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewSlackNotifier(url string) *SlackNotifier {
+	return &SlackNotifier{
+		url:    url,
+		client: &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+type slackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments,omitempty"`
+}
+
+type slackAttachment struct {
+	Color  string       `json:"color"`
+	Fields []slackField `json:"fields"`
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+var slackColors = map[Severity]string{
+	SeverityInfo:     "good",
+	SeverityWarning:  "warning",
+	SeverityCritical: "danger",
+}
+
+func (n *SlackNotifier) Notify(ctx context.Context, notification Notification) error {
+	message := slackMessage{
+		Text: fmt.Sprintf("*%s*\n%s", notification.Subject(), notification.Message),
+	}
+
+	if fields := notification.fields(); len(fields) > 0 {
+		attachment := slackAttachment{Color: slackColors[notification.Severity]}
+		for _, field := range fields {
+			attachment.Fields = append(attachment.Fields, slackField{Title: field.name, Value: field.value, Short: field.name != "Error"})
+		}
+		message.Attachments = []slackAttachment{attachment}
+	}
+
+	if err := postJSON(ctx, n.client, n.url, message); err != nil {
+		return fmt.Errorf("slack: %s", err)
+	}
+
+	return nil
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		resBody, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("request failed with StatusCode: %d. Error: %s", res.StatusCode, strings.TrimSpace(string(resBody)))
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package price
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	SourceNone      = "none"
+	SourceCoinGecko = "coingecko"
+	SourceFile      = "file"
+)
+
+// PriceSource tells the current price of a bitcoin in fiat currencies
+type PriceSource interface {
+	// Name identifies the source in the recorded prices
+	Name() string
+	// BtcPrices returns the price of a bitcoin in each of the currencies, e.g. usd.
+	// A currency the source has no price for is an error.
+	BtcPrices(ctx context.Context, currencies []string) (map[string]decimal.Decimal, error)
+}
+
+// NewSource returns the price source selected with PRICE_SOURCE, or nil if the prices are not captured
+func NewSource(config *infrastructure.Config) (PriceSource, error) {
+	switch config.PriceSource {
+	case SourceNone:
+		return nil, nil
+	case SourceCoinGecko:
+		return NewCoinGeckoSource(config.CoinGeckoApiUrl, &http.Client{Timeout: time.Second * 10}), nil
+	case SourceFile:
+		return NewFileSource(config.PriceFile), nil
+	default:
+		return nil, fmt.Errorf("unknown price source {%s}", config.PriceSource)
+	}
+}
@@ -0,0 +1,87 @@
+package price
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/client/coingecko"
+	"github.com/shopspring/decimal"
+)
+
+// CoinGeckoSource reads the prices from the simple price api of CoinGecko
+type CoinGeckoSource struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewCoinGeckoSource(baseURL string, client *http.Client) *CoinGeckoSource {
+	return &CoinGeckoSource{baseURL: baseURL, client: client}
+}
+
+func (s *CoinGeckoSource) Name() string {
+	return SourceCoinGecko
+}
+
+func (s *CoinGeckoSource) BtcPrices(ctx context.Context, currencies []string) (map[string]decimal.Decimal, error) {
+	return coingecko.GetBtcPrices(ctx, s.client, s.baseURL, currencies)
+}
+
+// FileSource reads the prices from a json file of prices by currency, e.g. {"usd": "30123.45", "eur": 27750.1}.
+// The file is read on every call, so the prices can be changed without a restart. It is meant for tests and offline use.
+type FileSource struct {
+	path string
+}
+
+func NewFileSource(path string) *FileSource {
+	return &FileSource{path: path}
+}
+
+func (s *FileSource) Name() string {
+	return SourceFile
+}
+
+func (s *FileSource) BtcPrices(ctx context.Context, currencies []string) (map[string]decimal.Decimal, error) {
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price file: %s", err)
+	}
+
+	var prices map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&prices); err != nil {
+		return nil, fmt.Errorf("failed to parse price file {%s}: %s", s.path, err)
+	}
+
+	pricesByCurrency := make(map[string]string)
+	for currency, price := range prices {
+		switch price := price.(type) {
+		case json.Number:
+			pricesByCurrency[strings.ToLower(currency)] = price.String()
+		case string:
+			pricesByCurrency[strings.ToLower(currency)] = price
+		default:
+			return nil, fmt.Errorf("price of currency {%s} in price file {%s} must be a number", currency, s.path)
+		}
+	}
+
+	btcPrices := make(map[string]decimal.Decimal)
+	for _, currency := range currencies {
+		price, ok := pricesByCurrency[strings.ToLower(currency)]
+		if !ok {
+			return nil, fmt.Errorf("no bitcoin price in currency {%s} in price file {%s}", currency, s.path)
+		}
+
+		btcPrices[currency], err = decimal.NewFromString(price)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bitcoin price {%s} in currency {%s}: %s", price, currency, err)
+		}
+	}
+
+	return btcPrices, nil
+}
@@ -0,0 +1,63 @@
+package price
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"USD": 30123.456789, "eur": "27750.10"}`), 0o600))
+
+	source := NewFileSource(path)
+	prices, err := source.BtcPrices(context.Background(), []string{"usd", "eur"})
+	require.NoError(t, err)
+	require.Equal(t, "30123.456789", prices["usd"].String())
+	require.Equal(t, "27750.1", prices["eur"].String())
+
+	_, err = source.BtcPrices(context.Background(), []string{"gbp"})
+	require.Error(t, err)
+
+	_, err = NewFileSource(filepath.Join(t.TempDir(), "missing.json")).BtcPrices(context.Background(), []string{"usd"})
+	require.Error(t, err)
+}
+
+func TestCoinGeckoSource(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/simple/price" || r.URL.Query().Get("ids") != "bitcoin" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"bitcoin": {"usd": 30123.45678901, "eur": 27750.1}}`))
+	}))
+	defer server.Close()
+
+	source := NewCoinGeckoSource(server.URL, server.Client())
+	prices, err := source.BtcPrices(context.Background(), []string{"usd", "eur"})
+	require.NoError(t, err)
+	require.Equal(t, "30123.45678901", prices["usd"].String())
+	require.Equal(t, "27750.1", prices["eur"].String())
+
+	_, err = source.BtcPrices(context.Background(), []string{"usd", "gbp"})
+	require.Error(t, err)
+}
+
+func TestNewSource(t *testing.T) {
+	source, err := NewSource(&infrastructure.Config{PriceSource: SourceNone})
+	require.NoError(t, err)
+	require.Nil(t, source)
+
+	source, err = NewSource(&infrastructure.Config{PriceSource: SourceFile, PriceFile: "prices.json"})
+	require.NoError(t, err)
+	require.Equal(t, SourceFile, source.Name())
+
+	_, err = NewSource(&infrastructure.Config{PriceSource: "oracle"})
+	require.Error(t, err)
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
 )
 
@@ -30,7 +31,7 @@ func (r *Requester) GetPayoutAddressFromNode(ctx context.Context, cudosAddress,
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	res, err := client.Do(req)
+	res, err := r.doRequest(client, req, metrics.EndpointCudosRest, "addressbook_address")
 	if err != nil {
 		return "", err
 	}
@@ -145,7 +146,7 @@ func (r *Requester) getLatestBlock(ctx context.Context) (types.Block, error) {
 		return types.Block{}, err
 	}
 
-	bytes, err := r.makeRequest(ctx, request)
+	bytes, err := r.makeRequest(ctx, request, metrics.EndpointCudosRest, "block")
 	if err != nil {
 		return types.Block{}, err
 	}
@@ -164,7 +165,7 @@ func (r *Requester) getBlockAtHeight(ctx context.Context, height int64) (types.B
 		return types.Block{}, err
 	}
 
-	bytes, err := r.makeRequest(ctx, request)
+	bytes, err := r.makeRequest(ctx, request, metrics.EndpointCudosRest, "block")
 	if err != nil {
 		return types.Block{}, err
 	}
@@ -219,7 +220,7 @@ func (r *Requester) getTxsByEvents(ctx context.Context, query string) ([]types.T
 			return []types.Tx{}, err
 		}
 
-		bytes, err := r.makeRequest(ctx, request)
+		bytes, err := r.makeRequest(ctx, request, metrics.EndpointCudosRpc, "tx_search")
 		if err != nil {
 			return []types.Tx{}, err
 		}
@@ -378,9 +379,9 @@ func (r *Requester) GetDenomNftTransferHistory(ctx context.Context, collectionDe
 	return filteredTransferEvents, nil
 }
 
-func (r *Requester) makeRequest(ctx context.Context, request *http.Request) ([]byte, error) {
+func (r *Requester) makeRequest(ctx context.Context, request *http.Request, endpoint, operation string) ([]byte, error) {
 	client := &http.Client{Timeout: time.Second * 10}
-	response, err := client.Do(request)
+	response, err := r.doRequest(client, request, endpoint, operation)
 	if err != nil {
 		return nil, err
 	}
@@ -4,24 +4,29 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/rs/zerolog/log"
 
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/resilience"
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
 )
 
-func NewRequester(config *infrastructure.Config) *Requester {
-	return &Requester{config: config}
+func NewRequester(config *infrastructure.Config, breakers *resilience.Breakers) *Requester {
+	return &Requester{config: config, breakers: breakers}
 }
 
 type Requester struct {
-	config *infrastructure.Config
+	config   *infrastructure.Config
+	breakers *resilience.Breakers
 }
 
 const (
@@ -29,6 +34,37 @@ const (
 	StatusCodeNotFound = 404
 )
 
+// doRequest sends the request and records its latency and status for the endpoint.
+// While the circuit breaker of the endpoint is open, the request is not sent at all.
+func (r *Requester) doRequest(client *http.Client, request *http.Request, endpoint, operation string) (*http.Response, error) {
+	breaker := r.breakers.Get(endpoint)
+	if err := breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	response, err := client.Do(request)
+	metrics.ObserveHttpRequest(endpoint, operation, start, response, err)
+	breaker.Record(isUnavailable(response, err))
+
+	return response, err
+}
+
+// isUnavailable is true if the endpoint could not be reached or is not able to handle requests.
+// Other error statuses are answers of a working endpoint, e.g. bitcoind returns 500 for rpc errors.
+func isUnavailable(response *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled)
+	}
+
+	switch response.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
 func (r *Requester) GetHasuraCollectionNftMintEvents(ctx context.Context, collectionDenomId string) (types.NftMintHistory, error) {
 	jsonData := map[string]string{
 		"query": fmt.Sprintf(`
@@ -47,10 +83,9 @@ func (r *Requester) GetHasuraCollectionNftMintEvents(ctx context.Context, collec
 		return types.NftMintHistory{}, err
 	}
 	client := &http.Client{Timeout: time.Second * 10}
-	response, err := client.Do(request)
+	response, err := r.doRequest(client, request, metrics.EndpointHasura, "nft_mint_events")
 	if err != nil {
-		log.Error().Msgf("The HTTP request failed with error %s\n", err)
-		return types.NftMintHistory{}, nil
+		return types.NftMintHistory{}, err
 	}
 	if response.StatusCode != StatusCodeOK {
 		return types.NftMintHistory{}, fmt.Errorf("error! Request Failed: %s with StatusCode: %d", response.Status, response.StatusCode)
@@ -107,7 +142,7 @@ func (r *Requester) getFarmDailyDataFromPool(ctx context.Context, farmName, sinc
 	req.URL.RawQuery = q.Encode()  // Encode and assign back to the original query.
 
 	client := &http.Client{Timeout: time.Second * 10}
-	res, err := client.Do(req)
+	res, err := r.doRequest(client, req, metrics.EndpointFoundry, "subaccount_hashrate_day")
 	if err != nil {
 		return types.FarmHashRate{}, err
 	}
@@ -157,10 +192,9 @@ func (r *Requester) getTxsFromHasura(ctx context.Context, txHashes []string) ([]
 		return []types.HasuraTx{}, err
 	}
 	client := &http.Client{Timeout: time.Second * 10}
-	response, err := client.Do(request)
+	response, err := r.doRequest(client, request, metrics.EndpointHasura, "transactions")
 	if err != nil {
-		log.Error().Msgf("The HTTP request failed with error %s\n", err)
-		return []types.HasuraTx{}, nil
+		return []types.HasuraTx{}, err
 	}
 	defer response.Body.Close()
 
@@ -199,10 +233,9 @@ func (r *Requester) GetFarmCollectionsFromHasura(ctx context.Context, farmId int
 		return types.CollectionData{}, err
 	}
 	client := &http.Client{Timeout: time.Second * 10}
-	response, err := client.Do(request)
+	response, err := r.doRequest(client, request, metrics.EndpointHasura, "denoms_by_data_property")
 	if err != nil {
-		log.Error().Msgf("The HTTP request failed with error %s\n", err)
-		return types.CollectionData{}, nil
+		return types.CollectionData{}, err
 	}
 	defer response.Body.Close()
 
@@ -237,7 +270,7 @@ func (r *Requester) VerifyCollection(ctx context.Context, denomId string) (bool,
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	res, err := client.Do(req)
+	res, err := r.doRequest(client, req, metrics.EndpointCudosRest, "collection_by_denom_id")
 	if err != nil {
 		return false, err
 	}
@@ -288,7 +321,7 @@ func (r *Requester) GetFarmCollectionsWithNFTs(ctx context.Context, denomIds []s
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	res, err := client.Do(req)
+	res, err := r.doRequest(client, req, metrics.EndpointCudosRest, "collections_by_denom_ids")
 	if err != nil {
 		return nil, err
 	}
@@ -316,7 +349,11 @@ func (r *Requester) GetFarmCollectionsWithNFTs(ctx context.Context, denomIds []s
 			nft := okStruct.Result.Collections[i].Nfts[j]
 			var nftDataJson types.NFTDataJson
 			err := json.Unmarshal([]byte(nft.Data), &nftDataJson)
-			if err != nil || nftDataJson.ExpirationDate == 0 || nftDataJson.HashRateOwned == 0 {
+			if errors.Is(err, types.ErrHashPowerPrecision) {
+				// the hash power would have to be rounded, that would pay the owner a reward for a hash power they don't have
+				return nil, fmt.Errorf("nft {%s} of denom {%s} is rejected: %s", nft.Id, okStruct.Result.Collections[i].Denom.Id, err)
+			}
+			if err != nil || nftDataJson.ExpirationDate == 0 || !nftDataJson.HashRateOwned.IsPositive() {
 				// log.Warn().Msgf("Failed to parse NFT dataJson field. Skipping. NFT: %s", nft)
 				continue
 			}
@@ -330,9 +367,17 @@ func (r *Requester) GetFarmCollectionsWithNFTs(ctx context.Context, denomIds []s
 	return okStruct.Result.Collections, nil
 }
 
+// walletEndpoint is the multiwallet endpoint of the node, so the call goes to the given wallet even when several wallets are loaded
+func (r *Requester) walletEndpoint(walletName string) string {
+	return fmt.Sprintf("http://%s:%s/wallet/%s", r.config.BitcoinNodeUrl, r.config.BitcoinNodePort, url.PathEscape(walletName))
+}
+
 // SendMany Issues a curl request to the btc node to send funds to many addresses:
 // curl --user myusername --data-binary '{"jsonrpc": "1.0", "id": "curltest", "method": "sendmany", "params": ["", {"bc1q09vm5lfy0j5reeulh4x5752q25uqqvz34hufdl":0.01,"bc1q02ad21edsxd23d32dfgqqsz4vv4nmtfzuklhy3":0.02}, 6, "testing"]}' -H 'content-type: text/plain;' http://127.0.0.1:8332/
-func (r *Requester) SendMany(ctx context.Context, destinationAddressesWithAmount map[string]float64) (string, error) {
+// SendMany sends to all destination addresses in a single transaction.
+// The comment is saved in the wallet with the transaction, so the transaction can be found by it later.
+// The amounts are written as exact BTC numbers with at most 8 decimals.
+func (r *Requester) SendMany(ctx context.Context, walletName string, destinationAddressesWithAmount map[string]types.Sats, comment string) (string, error) {
 
 	client := &http.Client{
 		Timeout: 60 * time.Second,
@@ -355,10 +400,16 @@ func (r *Requester) SendMany(ctx context.Context, destinationAddressesWithAmount
 	}
 	escapedSubractFeeFromAddressesString := string(bytes)
 
-	formatedString := fmt.Sprintf("{\"jsonrpc\": \"1.0\", \"id\": \"curl\", \"method\": \"sendmany\", \"params\": [\"\", %s, 6, \"\", %s, true]}", escapedDestinationAddresses, escapedSubractFeeFromAddressesString)
+	bytes, err = json.Marshal(comment)
+	if err != nil {
+		return "", err
+	}
+	escapedComment := string(bytes)
+
+	formatedString := fmt.Sprintf("{\"jsonrpc\": \"1.0\", \"id\": \"curl\", \"method\": \"sendmany\", \"params\": [\"\", %s, 6, %s, %s, true]}", escapedDestinationAddresses, escapedComment, escapedSubractFeeFromAddressesString)
 
 	body := strings.NewReader(formatedString)
-	endPointToCall := fmt.Sprintf("http://%s:%s", r.config.BitcoinNodeUrl, r.config.BitcoinNodePort)
+	endPointToCall := r.walletEndpoint(walletName)
 	req, err := http.NewRequestWithContext(ctx, "POST", endPointToCall, body)
 	if err != nil {
 		return "", err
@@ -366,7 +417,7 @@ func (r *Requester) SendMany(ctx context.Context, destinationAddressesWithAmount
 	req.SetBasicAuth(r.config.BitcoinNodeUserName, r.config.BitcoinNodePassword)
 	req.Header.Set("Content-Type", "text/plain;")
 
-	resp, err := client.Do(req)
+	resp, err := r.doRequest(client, req, metrics.EndpointBitcoind, "sendmany")
 	if err != nil {
 		return "", err
 	}
@@ -397,7 +448,7 @@ func (r *Requester) SendMany(ctx context.Context, destinationAddressesWithAmount
 	return okStruct.TxHash, nil
 }
 
-func (r *Requester) BumpFee(ctx context.Context, txId string) (string, error) {
+func (r *Requester) BumpFee(ctx context.Context, walletName, txId string) (string, error) {
 	client := &http.Client{
 		Timeout: 60 * time.Second,
 	}
@@ -406,7 +457,7 @@ func (r *Requester) BumpFee(ctx context.Context, txId string) (string, error) {
 	formatedString := fmt.Sprintf("{\"jsonrpc\": \"1.0\", \"id\": \"curl\", \"method\": \"bumpfee\", \"params\": [\"%s\", %s]}", txId, optionals)
 
 	body := strings.NewReader(formatedString)
-	endPointToCall := fmt.Sprintf("http://%s:%s", r.config.BitcoinNodeUrl, r.config.BitcoinNodePort)
+	endPointToCall := r.walletEndpoint(walletName)
 	log.Debug().Msgf("Trying to bump fee with request %s and params %s", endPointToCall, formatedString)
 
 	req, err := http.NewRequestWithContext(ctx, "POST", endPointToCall, body)
@@ -416,7 +467,7 @@ func (r *Requester) BumpFee(ctx context.Context, txId string) (string, error) {
 	req.SetBasicAuth(r.config.BitcoinNodeUserName, r.config.BitcoinNodePassword)
 	req.Header.Set("Content-Type", "text/plain;")
 
-	resp, err := client.Do(req)
+	resp, err := r.doRequest(client, req, metrics.EndpointBitcoind, "bumpfee")
 	if err != nil {
 		return "", err
 	}
@@ -456,7 +507,7 @@ func (r *Requester) BumpFee(ctx context.Context, txId string) (string, error) {
 	return okStruct.TxHash, nil
 }
 
-func (r *Requester) GetWalletTransaction(ctx context.Context, txHash string) (*types.BtcWalletTransaction, error) {
+func (r *Requester) GetWalletTransaction(ctx context.Context, walletName, txHash string) (*types.BtcWalletTransaction, error) {
 	client := &http.Client{
 		Timeout: 60 * time.Second,
 	}
@@ -464,7 +515,7 @@ func (r *Requester) GetWalletTransaction(ctx context.Context, txHash string) (*t
 	formatedString := fmt.Sprintf("{\"jsonrpc\": \"1.0\", \"id\": \"curl\", \"method\": \"gettransaction\", \"params\": [\"%s\"]}", txHash)
 
 	body := strings.NewReader(formatedString)
-	endPointToCall := fmt.Sprintf("http://%s:%s", r.config.BitcoinNodeUrl, r.config.BitcoinNodePort)
+	endPointToCall := r.walletEndpoint(walletName)
 
 	req, err := http.NewRequestWithContext(ctx, "POST", endPointToCall, body)
 	if err != nil {
@@ -473,7 +524,7 @@ func (r *Requester) GetWalletTransaction(ctx context.Context, txHash string) (*t
 	req.SetBasicAuth(r.config.BitcoinNodeUserName, r.config.BitcoinNodePassword)
 	req.Header.Set("Content-Type", "text/plain;")
 
-	resp, err := client.Do(req)
+	resp, err := r.doRequest(client, req, metrics.EndpointBitcoind, "gettransaction")
 	if err != nil {
 		return nil, err
 	}
@@ -504,3 +555,52 @@ func (r *Requester) GetWalletTransaction(ctx context.Context, txHash string) (*t
 
 	return &okStruct.Result, nil
 }
+
+// ListWalletTransactions returns the most recent transactions of the wallet, skipping the first skip of them
+func (r *Requester) ListWalletTransactions(ctx context.Context, walletName string, count, skip int) ([]types.BtcWalletTransaction, error) {
+	client := &http.Client{
+		Timeout: 60 * time.Second,
+	}
+
+	formatedString := fmt.Sprintf("{\"jsonrpc\": \"1.0\", \"id\": \"curl\", \"method\": \"listtransactions\", \"params\": [\"*\", %d, %d]}", count, skip)
+
+	body := strings.NewReader(formatedString)
+	endPointToCall := r.walletEndpoint(walletName)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endPointToCall, body)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(r.config.BitcoinNodeUserName, r.config.BitcoinNodePassword)
+	req.Header.Set("Content-Type", "text/plain;")
+
+	resp, err := r.doRequest(client, req, metrics.EndpointBitcoind, "listtransactions")
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	bts, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != StatusCodeOK {
+		return nil, fmt.Errorf("error! Request Failed: %s with StatusCode: %d. Error: %s", resp.Status, resp.StatusCode, string(bts))
+	}
+
+	okStruct := struct {
+		Result []types.BtcWalletTransaction `json:"result"`
+		Error  *string                      `json:"error"`
+	}{}
+
+	if err := json.Unmarshal(bts, &okStruct); err != nil {
+		return nil, err
+	}
+
+	if okStruct.Error != nil {
+		return nil, fmt.Errorf(*okStruct.Error)
+	}
+
+	return okStruct.Result, nil
+}
@@ -0,0 +1,33 @@
+package resilience
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff is an exponential backoff with jitter
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// Delay returns the delay before the next attempt after the given number of consecutive failures.
+// The delay doubles with every failure up to Max. Half of it is random,
+// so the replicas that failed at the same time do not retry at the same time.
+func (b Backoff) Delay(failures int) time.Duration {
+	delay := b.Initial
+	for i := 1; i < failures && delay < b.Max; i++ {
+		delay *= 2
+	}
+
+	if b.Max > 0 && delay > b.Max {
+		delay = b.Max
+	}
+
+	if delay <= 0 {
+		return 0
+	}
+
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
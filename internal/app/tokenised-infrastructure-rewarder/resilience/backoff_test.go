@@ -0,0 +1,29 @@
+package resilience
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	backoff := Backoff{Initial: time.Second, Max: 10 * time.Second}
+
+	for i := 0; i < 100; i++ {
+		delay := backoff.Delay(1)
+		require.GreaterOrEqual(t, delay, 500*time.Millisecond)
+		require.LessOrEqual(t, delay, time.Second)
+
+		delay = backoff.Delay(3)
+		require.GreaterOrEqual(t, delay, 2*time.Second)
+		require.LessOrEqual(t, delay, 4*time.Second)
+
+		// capped at max no matter how many failures
+		delay = backoff.Delay(1000)
+		require.GreaterOrEqual(t, delay, 5*time.Second)
+		require.LessOrEqual(t, delay, 10*time.Second)
+	}
+
+	require.Zero(t, Backoff{}.Delay(5))
+}
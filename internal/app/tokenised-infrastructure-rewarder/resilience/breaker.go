@@ -0,0 +1,206 @@
+package resilience
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrOpen is returned instead of calling a dependency while its circuit breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "open"
+	}
+}
+
+/*
+Breaker is the circuit breaker of a single external dependency.
+
+ 1. While closed, all calls are allowed. After failureThreshold consecutive failures the breaker opens.
+ 2. While open, the calls fail right away with ErrOpen, so the dependency is not hammered while it is down.
+ 3. After openTimeout a single probe call is allowed (half-open). If it succeeds the breaker closes,
+    otherwise it opens again for another openTimeout.
+*/
+type Breaker struct {
+	name             string
+	failureThreshold int
+	openTimeout      time.Duration
+	now              func() time.Time
+
+	mutex         sync.Mutex
+	state         State
+	failures      int
+	totalFailures int
+	openedAt      time.Time
+	probing       bool
+}
+
+func NewBreaker(name string, failureThreshold int, openTimeout time.Duration) *Breaker {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+
+	return &Breaker{
+		name:             name,
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		now:              time.Now,
+	}
+}
+
+// Allow returns ErrOpen if the dependency must not be called.
+// Every allowed call must be followed by Record with its result.
+func (b *Breaker) Allow() error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if b.now().Before(b.openedAt.Add(b.openTimeout)) {
+			return fmt.Errorf("%w: %s", ErrOpen, b.name)
+		}
+		b.setState(StateHalfOpen)
+		b.probing = true
+		return nil
+	case StateHalfOpen:
+		if b.probing {
+			return fmt.Errorf("%w: %s", ErrOpen, b.name)
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Record reports the result of an allowed call
+func (b *Breaker) Record(failed bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if !failed {
+		b.failures = 0
+		b.probing = false
+		b.setState(StateClosed)
+		return
+	}
+
+	b.failures++
+	b.totalFailures++
+	if b.state == StateHalfOpen || b.failures >= b.failureThreshold {
+		b.probing = false
+		b.openedAt = b.now()
+		b.setState(StateOpen)
+	}
+}
+
+// Blocked is true while the breaker is open and not ready for a probe yet. It does not change the state.
+func (b *Breaker) Blocked() bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.state == StateOpen && b.now().Before(b.openedAt.Add(b.openTimeout))
+}
+
+// TotalFailures is the number of failures recorded since the breaker was created, including the ones that did not open it
+func (b *Breaker) TotalFailures() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.totalFailures
+}
+
+func (b *Breaker) State() State {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.state
+}
+
+func (b *Breaker) setState(state State) {
+	if b.state == state {
+		return
+	}
+
+	if state == StateOpen {
+		log.Warn().Msgf("Circuit breaker of {%s} is open after %d failures", b.name, b.failures)
+	} else {
+		log.Info().Msgf("Circuit breaker of {%s} is %s", b.name, state)
+	}
+
+	b.state = state
+	metrics.CircuitBreakerState.WithLabelValues(b.name).Set(float64(state))
+}
+
+// Breakers holds the circuit breakers of all dependencies, created on first use with the same settings
+type Breakers struct {
+	failureThreshold int
+	openTimeout      time.Duration
+
+	mutex    sync.Mutex
+	breakers map[string]*Breaker
+}
+
+func NewBreakers(failureThreshold int, openTimeout time.Duration) *Breakers {
+	return &Breakers{
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		breakers:         make(map[string]*Breaker),
+	}
+}
+
+func (b *Breakers) Get(name string) *Breaker {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	breaker, ok := b.breakers[name]
+	if !ok {
+		breaker = NewBreaker(name, b.failureThreshold, b.openTimeout)
+		b.breakers[name] = breaker
+	}
+
+	return breaker
+}
+
+// Blocked returns the names of the dependencies whose breakers are blocking the calls, sorted by name
+func (b *Breakers) Blocked(names ...string) []string {
+	blocked := []string{}
+	for _, name := range names {
+		if b.Get(name).Blocked() {
+			blocked = append(blocked, name)
+		}
+	}
+	sort.Strings(blocked)
+
+	return blocked
+}
+
+// TotalFailures returns the number of failures recorded by the breakers of the dependencies together
+func (b *Breakers) TotalFailures(names ...string) int {
+	total := 0
+	for _, name := range names {
+		total += b.Get(name).TotalFailures()
+	}
+
+	return total
+}
@@ -0,0 +1,98 @@
+package resilience
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestBreaker(now *time.Time) *Breaker {
+	breaker := NewBreaker("test", 3, time.Minute)
+	breaker.now = func() time.Time { return *now }
+	return breaker
+}
+
+func TestBreakerShouldOpenAfterConsecutiveFailures(t *testing.T) {
+	now := time.Unix(1666641078, 0)
+	breaker := newTestBreaker(&now)
+
+	breaker.Record(true)
+	breaker.Record(true)
+	// a success resets the consecutive failures
+	breaker.Record(false)
+	breaker.Record(true)
+	breaker.Record(true)
+	require.Equal(t, StateClosed, breaker.State())
+	require.NoError(t, breaker.Allow())
+
+	breaker.Record(true)
+	require.Equal(t, StateOpen, breaker.State())
+	require.True(t, breaker.Blocked())
+
+	err := breaker.Allow()
+	require.True(t, errors.Is(err, ErrOpen))
+	require.EqualError(t, err, "circuit breaker is open: test")
+}
+
+func TestBreakerShouldAllowSingleProbeWhenHalfOpen(t *testing.T) {
+	now := time.Unix(1666641078, 0)
+	breaker := newTestBreaker(&now)
+	for i := 0; i < 3; i++ {
+		breaker.Record(true)
+	}
+
+	now = now.Add(time.Minute)
+	require.False(t, breaker.Blocked())
+	require.NoError(t, breaker.Allow())
+	require.Equal(t, StateHalfOpen, breaker.State())
+
+	// the other calls wait for the result of the probe
+	require.ErrorIs(t, breaker.Allow(), ErrOpen)
+
+	breaker.Record(false)
+	require.Equal(t, StateClosed, breaker.State())
+	require.NoError(t, breaker.Allow())
+}
+
+func TestBreakerShouldReopenWhenProbeFails(t *testing.T) {
+	now := time.Unix(1666641078, 0)
+	breaker := newTestBreaker(&now)
+	for i := 0; i < 3; i++ {
+		breaker.Record(true)
+	}
+
+	now = now.Add(time.Minute)
+	require.NoError(t, breaker.Allow())
+
+	// a single failed probe is enough to open the breaker again
+	breaker.Record(true)
+	require.Equal(t, StateOpen, breaker.State())
+	require.ErrorIs(t, breaker.Allow(), ErrOpen)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, breaker.Allow())
+}
+
+func TestBreakersBlocked(t *testing.T) {
+	breakers := NewBreakers(1, time.Hour)
+	require.Same(t, breakers.Get("bitcoind"), breakers.Get("bitcoind"))
+
+	breakers.Get("hasura").Record(true)
+	breakers.Get("db").Record(true)
+	require.Equal(t, []string{"db", "hasura"}, breakers.Blocked("hasura", "bitcoind", "db"))
+	require.Empty(t, breakers.Blocked("bitcoind"))
+}
+
+func TestBreakersTotalFailures(t *testing.T) {
+	breakers := NewBreakers(3, time.Hour)
+
+	breakers.Get("hasura").Record(true)
+	breakers.Get("hasura").Record(false)
+	breakers.Get("db").Record(true)
+	require.Equal(t, StateClosed, breakers.Get("hasura").State())
+	// the failures are counted even though no breaker is open
+	require.Equal(t, 2, breakers.TotalFailures("hasura", "bitcoind", "db"))
+	require.Equal(t, 0, breakers.TotalFailures("bitcoind"))
+}
@@ -0,0 +1,268 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule tells when the next run is due
+type Schedule interface {
+	// Next returns the first run time after the given time, or the zero time if there is none
+	Next(after time.Time) time.Time
+}
+
+// Every runs with a constant delay after the previous run
+type Every time.Duration
+
+func (e Every) Next(after time.Time) time.Time {
+	return after.Add(time.Duration(e))
+}
+
+func (e Every) String() string {
+	return fmt.Sprintf("@every %s", time.Duration(e))
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+/*
+Parse parses a schedule in one of the following formats:
+
+ 1. A standard cron expression with five fields: minute hour day-of-month month day-of-week, e.g. "0 2 * * *".
+    The fields support lists, ranges, steps and the names of the months and the days, e.g. "0,30 8-18 * * mon-fri".
+ 2. One of the descriptors @yearly, @monthly, @weekly, @daily and @hourly.
+ 3. "@every <duration>", e.g. "@every 15m", which runs with a constant delay after the previous run.
+
+The cron expressions are evaluated in the given timezone, UTC if it is empty.
+The timezone can also be set in the expression itself with a CRON_TZ= prefix, e.g. "CRON_TZ=Europe/Sofia 0 2 * * *".
+*/
+func Parse(spec, timezone string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "CRON_TZ=") || strings.HasPrefix(spec, "TZ=") {
+		parts := strings.SplitN(spec, " ", 2)
+		timezone = parts[0][strings.Index(parts[0], "=")+1:]
+		spec = ""
+		if len(parts) == 2 {
+			spec = strings.TrimSpace(parts[1])
+		}
+	}
+
+	if spec == "" {
+		return nil, fmt.Errorf("empty schedule")
+	}
+
+	if strings.HasPrefix(spec, "@every") {
+		duration, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every")))
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule {%s}: %s", spec, err)
+		}
+		if duration <= 0 {
+			return nil, fmt.Errorf("invalid schedule {%s}: duration must be positive", spec)
+		}
+		return Every(duration), nil
+	}
+
+	location := time.UTC
+	if timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("invalid schedule timezone {%s}: %s", timezone, err)
+		}
+	}
+
+	if expression, ok := descriptors[spec]; ok {
+		spec = expression
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid schedule {%s}: expected 5 fields, got %d", spec, len(fields))
+	}
+
+	cron := &Cron{spec: spec, location: location}
+	var err error
+	if cron.minute, err = parseField(fields[0], minuteBounds); err != nil {
+		return nil, fmt.Errorf("invalid schedule {%s}: minute: %s", spec, err)
+	}
+	if cron.hour, err = parseField(fields[1], hourBounds); err != nil {
+		return nil, fmt.Errorf("invalid schedule {%s}: hour: %s", spec, err)
+	}
+	if cron.dayOfMonth, err = parseField(fields[2], dayOfMonthBounds); err != nil {
+		return nil, fmt.Errorf("invalid schedule {%s}: day of month: %s", spec, err)
+	}
+	if cron.month, err = parseField(fields[3], monthBounds); err != nil {
+		return nil, fmt.Errorf("invalid schedule {%s}: month: %s", spec, err)
+	}
+	if cron.dayOfWeek, err = parseField(fields[4], dayOfWeekBounds); err != nil {
+		return nil, fmt.Errorf("invalid schedule {%s}: day of week: %s", spec, err)
+	}
+
+	// 7 is sunday as well
+	if cron.dayOfWeek&(1<<7) != 0 {
+		cron.dayOfWeek |= 1
+	}
+
+	cron.anyDayOfMonth = isWildcard(fields[2])
+	cron.anyDayOfWeek = isWildcard(fields[4])
+
+	return cron, nil
+}
+
+// Cron is a parsed cron expression. Every field is a bit set of the allowed values.
+type Cron struct {
+	spec     string
+	location *time.Location
+
+	minute     uint64
+	hour       uint64
+	dayOfMonth uint64
+	month      uint64
+	dayOfWeek  uint64
+
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+func (c *Cron) String() string {
+	return fmt.Sprintf("%s (%s)", c.spec, c.location)
+}
+
+// Next finds the next matching minute. It gives up after 5 years, which happens only for dates like 30 February.
+func (c *Cron) Next(after time.Time) time.Time {
+	t := after.In(c.location)
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	yearLimit := t.Year() + 5
+
+	for t.Year() <= yearLimit {
+		previous := t
+
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.location)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.location)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.location)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+
+		// the wall clock can jump backwards on daylight saving time changes
+		if !t.After(previous) {
+			t = previous.Add(time.Minute)
+		}
+	}
+
+	return time.Time{}
+}
+
+// dayMatches follows the cron convention: if both day fields are restricted, matching either of them is enough
+func (c *Cron) dayMatches(t time.Time) bool {
+	dayOfMonth := c.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := c.dayOfWeek&(1<<uint(t.Weekday())) != 0
+
+	if c.anyDayOfMonth || c.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+
+	return dayOfMonth || dayOfWeek
+}
+
+type bounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteBounds     = bounds{min: 0, max: 59}
+	hourBounds       = bounds{min: 0, max: 23}
+	dayOfMonthBounds = bounds{min: 1, max: 31}
+	monthBounds      = bounds{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dayOfWeekBounds = bounds{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+func isWildcard(field string) bool {
+	return field == "*" || field == "?"
+}
+
+// parseField parses a comma separated list of values, ranges and steps into a bit set
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step, hasStep := 1, false
+		if i := strings.Index(part, "/"); i >= 0 {
+			hasStep = true
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step {%s}", part[i+1:])
+			}
+			part = part[:i]
+		}
+
+		start, end := b.min, b.max
+		switch {
+		case isWildcard(part):
+		case strings.Contains(part, "-"):
+			rangeParts := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = parseValue(rangeParts[0], b); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(rangeParts[1], b); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range {%s}", part)
+			}
+		default:
+			value, err := parseValue(part, b)
+			if err != nil {
+				return 0, err
+			}
+			start = value
+			// a single value with a step runs from the value to the max, e.g. 5/15
+			if !hasStep {
+				end = value
+			}
+		}
+
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseValue(value string, b bounds) (int, error) {
+	if number, ok := b.names[strings.ToLower(value)]; ok {
+		return number, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value {%s}", value)
+	}
+
+	if number < b.min || number > b.max {
+		return 0, fmt.Errorf("value {%d} out of range [%d, %d]", number, b.min, b.max)
+	}
+
+	return number, nil
+}
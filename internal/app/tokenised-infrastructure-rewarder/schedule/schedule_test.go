@@ -0,0 +1,80 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func mustParse(t *testing.T, spec, timezone string) Schedule {
+	schedule, err := Parse(spec, timezone)
+	require.NoError(t, err)
+	return schedule
+}
+
+func utc(value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		spec     string
+		after    string
+		expected string
+	}{
+		{"0 2 * * *", "2022-10-24T01:59:59Z", "2022-10-24T02:00:00Z"},
+		{"0 2 * * *", "2022-10-24T02:00:00Z", "2022-10-25T02:00:00Z"},
+		{"*/15 * * * *", "2022-10-24T10:07:30Z", "2022-10-24T10:15:00Z"},
+		{"5/20 * * * *", "2022-10-24T10:26:00Z", "2022-10-24T10:45:00Z"},
+		{"0,30 8-18 * * mon-fri", "2022-10-21T18:30:00Z", "2022-10-24T08:00:00Z"},
+		{"0 0 1 * *", "2022-12-15T00:00:00Z", "2023-01-01T00:00:00Z"},
+		{"0 0 29 feb *", "2022-03-01T00:00:00Z", "2024-02-29T00:00:00Z"},
+		// both days are restricted, so either of them matches
+		{"0 0 13 * 5", "2022-10-10T00:00:00Z", "2022-10-13T00:00:00Z"},
+		{"0 0 * * 7", "2022-10-24T00:00:00Z", "2022-10-30T00:00:00Z"},
+		{"@daily", "2022-10-24T10:00:00Z", "2022-10-25T00:00:00Z"},
+		{"@every 15m", "2022-10-24T10:07:30Z", "2022-10-24T10:22:30Z"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			require.Equal(t, utc(test.expected), mustParse(t, test.spec, "").Next(utc(test.after)).UTC())
+		})
+	}
+}
+
+func TestCronNextShouldUseTimezone(t *testing.T) {
+	// 02:00 in Sofia is 23:00 UTC in the summer and 00:00 UTC in the winter
+	schedule := mustParse(t, "0 2 * * *", "Europe/Sofia")
+	require.Equal(t, utc("2022-10-28T23:00:00Z"), schedule.Next(utc("2022-10-28T12:00:00Z")).UTC())
+	require.Equal(t, utc("2022-10-31T00:00:00Z"), schedule.Next(utc("2022-10-30T12:00:00Z")).UTC())
+
+	// the timezone in the expression wins
+	schedule = mustParse(t, "CRON_TZ=Europe/Sofia 0 2 * * *", "America/New_York")
+	require.Equal(t, utc("2022-10-28T23:00:00Z"), schedule.Next(utc("2022-10-28T12:00:00Z")).UTC())
+}
+
+func TestCronNextShouldSkipMissingDaylightSavingHour(t *testing.T) {
+	// 03:30 does not exist in Sofia on 27 March 2022, the clock jumps from 03:00 to 04:00
+	schedule := mustParse(t, "30 3 * * *", "Europe/Sofia")
+	require.Equal(t, utc("2022-03-28T00:30:00Z"), schedule.Next(utc("2022-03-26T12:00:00Z")).UTC())
+}
+
+func TestCronNextShouldGiveUpOnImpossibleDates(t *testing.T) {
+	require.True(t, mustParse(t, "0 0 30 feb *", "").Next(utc("2022-10-24T00:00:00Z")).IsZero())
+}
+
+func TestParseShouldFailOnInvalidSchedules(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "5-1 * * * *", "*/0 * * * *", "@every", "@every -1m", "@sometimes"} {
+		_, err := Parse(spec, "")
+		require.Error(t, err, spec)
+	}
+
+	_, err := Parse("0 2 * * *", "Mars/Olympus")
+	require.Error(t, err)
+}
@@ -0,0 +1,10 @@
+//go:build linux || darwin
+
+package secrets
+
+import "syscall"
+
+// DisableCoreDumps stops the process from writing core dumps, which would contain the passphrases in use
+func DisableCoreDumps() error {
+	return syscall.Setrlimit(syscall.RLIMIT_CORE, &syscall.Rlimit{Cur: 0, Max: 0})
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package secrets
+
+// DisableCoreDumps is not supported on this platform
+func DisableCoreDumps() error {
+	return nil
+}
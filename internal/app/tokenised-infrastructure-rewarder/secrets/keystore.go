@@ -0,0 +1,165 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	keystoreVersion = 1
+	scryptN         = 1 << 15
+	scryptR         = 8
+	scryptP         = 1
+	keyLength       = 32
+	saltLength      = 16
+)
+
+type keystoreFile struct {
+	Version int                      `json:"version"`
+	Wallets map[string]keystoreEntry `json:"wallets"`
+}
+
+// keystoreEntry is a passphrase encrypted with AES-256-GCM, with a key derived from the keystore password with scrypt.
+// The wallet name is authenticated too, so entries can not be swapped between wallets.
+type keystoreEntry struct {
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// KeystoreProvider reads the passphrases from an encrypted keystore file.
+// The keystore is read on every call, so passphrases set while the service is running are used right away.
+type KeystoreProvider struct {
+	path     string
+	password *Secret
+}
+
+func NewKeystoreProvider(path string, password *Secret) *KeystoreProvider {
+	return &KeystoreProvider{path: path, password: password}
+}
+
+func (p *KeystoreProvider) WalletPassphrase(walletName string) (*Secret, error) {
+	keystore, err := readKeystore(p.path)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, ok := keystore.Wallets[walletName]
+	if !ok {
+		return nil, fmt.Errorf("no passphrase for wallet {%s} in keystore", walletName)
+	}
+
+	gcm, err := newGCM(p.password, entry.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	passphrase, err := gcm.Open(nil, entry.Nonce, entry.Ciphertext, []byte(walletName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt passphrase of wallet {%s}, the keystore password is wrong or the keystore is corrupted", walletName)
+	}
+
+	return NewSecret(passphrase), nil
+}
+
+// SetKeystorePassphrase encrypts the passphrase of the wallet into the keystore. The keystore is created if it does not exist.
+func SetKeystorePassphrase(path string, password *Secret, walletName string, passphrase *Secret) error {
+	if len(passphrase.value) == 0 {
+		return fmt.Errorf("empty passphrase for wallet {%s}", walletName)
+	}
+
+	keystore, err := readKeystore(path)
+	if errors.Is(err, os.ErrNotExist) {
+		keystore = keystoreFile{Version: keystoreVersion, Wallets: make(map[string]keystoreEntry)}
+	} else if err != nil {
+		return err
+	}
+
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+
+	gcm, err := newGCM(password, salt)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	keystore.Wallets[walletName] = keystoreEntry{
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: gcm.Seal(nil, nonce, passphrase.value, []byte(walletName)),
+	}
+
+	content, err := json.MarshalIndent(keystore, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file first, so a failed write does not destroy the keystore
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".keystore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), path)
+}
+
+func readKeystore(path string) (keystoreFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return keystoreFile{}, fmt.Errorf("failed to read keystore: %w", err)
+	}
+
+	var keystore keystoreFile
+	if err := json.Unmarshal(content, &keystore); err != nil {
+		return keystoreFile{}, fmt.Errorf("invalid keystore {%s}: %s", path, err)
+	}
+
+	if keystore.Version != keystoreVersion {
+		return keystoreFile{}, fmt.Errorf("unsupported keystore version {%d}", keystore.Version)
+	}
+
+	if keystore.Wallets == nil {
+		keystore.Wallets = make(map[string]keystoreEntry)
+	}
+
+	return keystore, nil
+}
+
+func newGCM(password *Secret, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(password.value, salt, scryptN, scryptR, scryptP, keyLength)
+	if err != nil {
+		return nil, err
+	}
+	defer NewSecret(key).Wipe()
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
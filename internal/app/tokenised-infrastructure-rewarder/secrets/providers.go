@@ -0,0 +1,53 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// EnvProvider reads the passphrases from FARM_WALLET_PASSPHRASE_<WALLET NAME> environment variables.
+// Wallets without their own variable use the default passphrase. It is meant for development only.
+type EnvProvider struct {
+	defaultPassphrase string
+}
+
+func NewEnvProvider(defaultPassphrase string) *EnvProvider {
+	return &EnvProvider{defaultPassphrase: defaultPassphrase}
+}
+
+func (p *EnvProvider) WalletPassphrase(walletName string) (*Secret, error) {
+	if passphrase, ok := os.LookupEnv(envKey(walletName)); ok && passphrase != "" {
+		return NewSecret([]byte(passphrase)), nil
+	}
+
+	if p.defaultPassphrase == "" {
+		return nil, fmt.Errorf("no passphrase for wallet {%s}, set %s", walletName, envKey(walletName))
+	}
+
+	return NewSecret([]byte(p.defaultPassphrase)), nil
+}
+
+// FileProvider reads the passphrase of each wallet from a file named after the wallet in a directory,
+// e.g. the docker or kubernetes secrets mounted in /run/secrets
+type FileProvider struct {
+	dir string
+}
+
+func NewFileProvider(dir string) *FileProvider {
+	return &FileProvider{dir: dir}
+}
+
+func (p *FileProvider) WalletPassphrase(walletName string) (*Secret, error) {
+	if walletName == "" || walletName == "." || walletName == ".." || strings.ContainsAny(walletName, `/\`) {
+		return nil, fmt.Errorf("invalid wallet name {%s}", walletName)
+	}
+
+	passphrase, err := ReadSecretFile(filepath.Join(p.dir, walletName))
+	if err != nil {
+		return nil, fmt.Errorf("no passphrase for wallet {%s}: %s", walletName, err)
+	}
+
+	return passphrase, nil
+}
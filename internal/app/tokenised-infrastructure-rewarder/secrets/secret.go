@@ -0,0 +1,113 @@
+package secrets
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+)
+
+const (
+	ProviderEnv      = "env"
+	ProviderFile     = "file"
+	ProviderKeystore = "keystore"
+
+	redacted = "[REDACTED]"
+)
+
+// Secret holds a passphrase as bytes, so it can be wiped once it is used.
+// It is never printed, formatting or marshaling it gives [REDACTED].
+type Secret struct {
+	value []byte
+}
+
+func NewSecret(value []byte) *Secret {
+	return &Secret{value: value}
+}
+
+// Use calls use with the value of the secret. The value should not be kept after use returns.
+func (s *Secret) Use(use func(value string) error) error {
+	return use(string(s.value))
+}
+
+// Wipe overwrites the value of the secret with zeros
+func (s *Secret) Wipe() {
+	for i := range s.value {
+		s.value[i] = 0
+	}
+	s.value = nil
+}
+
+func (s *Secret) String() string {
+	return redacted
+}
+
+func (s *Secret) GoString() string {
+	return redacted
+}
+
+func (s *Secret) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// NewProvider returns the secret provider selected with SECRETS_PROVIDER
+func NewProvider(config *infrastructure.Config) (Provider, error) {
+	switch config.SecretsProvider {
+	case ProviderEnv:
+		return NewEnvProvider(config.AuraPoolTestFarmWalletPassword), nil
+	case ProviderFile:
+		return NewFileProvider(config.SecretsDir), nil
+	case ProviderKeystore:
+		password, err := ReadSecretFile(config.SecretsKeystorePasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keystore password: %s", err)
+		}
+		return NewKeystoreProvider(config.SecretsKeystorePath, password), nil
+	default:
+		return nil, fmt.Errorf("unknown secrets provider {%s}", config.SecretsProvider)
+	}
+}
+
+// Provider resolves the passphrases of the farm wallets
+type Provider interface {
+	WalletPassphrase(walletName string) (*Secret, error)
+}
+
+// ReadSecretFile reads a secret file, e.g. the keystore password
+func ReadSecretFile(path string) (*Secret, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadSecret(file)
+}
+
+// ReadSecret reads a secret, without the trailing new line most editors and secret mounts add
+func ReadSecret(r io.Reader) (*Secret, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	end := len(content)
+	for end > 0 && (content[end-1] == '\n' || content[end-1] == '\r') {
+		end--
+	}
+	for i := end; i < len(content); i++ {
+		content[i] = 0
+	}
+
+	return NewSecret(content[:end]), nil
+}
+
+var nonAlphanumeric = regexp.MustCompile("[^A-Z0-9]+")
+
+// envKey returns the name of the environment variable with the passphrase of the wallet, e.g. FARM_WALLET_PASSPHRASE_FARM_1 for farm-1
+func envKey(walletName string) string {
+	return "FARM_WALLET_PASSPHRASE_" + nonAlphanumeric.ReplaceAllString(strings.ToUpper(walletName), "_")
+}
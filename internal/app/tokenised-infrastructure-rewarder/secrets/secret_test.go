@@ -0,0 +1,140 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/stretchr/testify/require"
+)
+
+func secretValue(t *testing.T, secret *Secret) string {
+	var value string
+	require.NoError(t, secret.Use(func(v string) error {
+		value = v
+		return nil
+	}))
+	return value
+}
+
+func TestSecret_IsRedacted(t *testing.T) {
+	secret := NewSecret([]byte("passphrase"))
+
+	require.Equal(t, redacted, fmt.Sprintf("%s", secret))
+	require.Equal(t, redacted, fmt.Sprintf("%v", secret))
+	require.Equal(t, redacted, fmt.Sprintf("%#v", secret))
+
+	marshaled, err := json.Marshal(map[string]*Secret{"passphrase": secret})
+	require.NoError(t, err)
+	require.Equal(t, `{"passphrase":"[REDACTED]"}`, string(marshaled))
+}
+
+func TestSecret_Wipe(t *testing.T) {
+	value := []byte("passphrase")
+	secret := NewSecret(value)
+
+	secret.Wipe()
+
+	require.Equal(t, make([]byte, len(value)), value)
+	require.Equal(t, "", secretValue(t, secret))
+}
+
+func TestEnvProvider(t *testing.T) {
+	t.Setenv("FARM_WALLET_PASSPHRASE_FARM_1", "farm 1 passphrase")
+	provider := NewEnvProvider("default passphrase")
+
+	passphrase, err := provider.WalletPassphrase("farm-1")
+	require.NoError(t, err)
+	require.Equal(t, "farm 1 passphrase", secretValue(t, passphrase))
+
+	passphrase, err = provider.WalletPassphrase("farm-2")
+	require.NoError(t, err)
+	require.Equal(t, "default passphrase", secretValue(t, passphrase))
+
+	_, err = NewEnvProvider("").WalletPassphrase("farm-2")
+	require.EqualError(t, err, "no passphrase for wallet {farm-2}, set FARM_WALLET_PASSPHRASE_FARM_2")
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "farm-1"), []byte("farm 1 passphrase\n"), 0o600))
+	provider := NewFileProvider(dir)
+
+	passphrase, err := provider.WalletPassphrase("farm-1")
+	require.NoError(t, err)
+	require.Equal(t, "farm 1 passphrase", secretValue(t, passphrase))
+
+	_, err = provider.WalletPassphrase("farm-2")
+	require.Error(t, err)
+
+	_, err = provider.WalletPassphrase("../farm-1")
+	require.EqualError(t, err, "invalid wallet name {../farm-1}")
+}
+
+func TestKeystoreProvider(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	password := NewSecret([]byte("keystore password"))
+
+	require.NoError(t, SetKeystorePassphrase(path, password, "farm-1", NewSecret([]byte("farm 1 passphrase"))))
+	require.NoError(t, SetKeystorePassphrase(path, password, "farm-2", NewSecret([]byte("farm 2 passphrase"))))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(content), "farm 1 passphrase")
+
+	provider := NewKeystoreProvider(path, password)
+	passphrase, err := provider.WalletPassphrase("farm-1")
+	require.NoError(t, err)
+	require.Equal(t, "farm 1 passphrase", secretValue(t, passphrase))
+
+	passphrase, err = provider.WalletPassphrase("farm-2")
+	require.NoError(t, err)
+	require.Equal(t, "farm 2 passphrase", secretValue(t, passphrase))
+
+	_, err = provider.WalletPassphrase("farm-3")
+	require.EqualError(t, err, "no passphrase for wallet {farm-3} in keystore")
+
+	_, err = NewKeystoreProvider(path, NewSecret([]byte("wrong password"))).WalletPassphrase("farm-1")
+	require.EqualError(t, err, "failed to decrypt passphrase of wallet {farm-1}, the keystore password is wrong or the keystore is corrupted")
+}
+
+func TestKeystoreProvider_EntriesCanNotBeSwapped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	password := NewSecret([]byte("keystore password"))
+	require.NoError(t, SetKeystorePassphrase(path, password, "farm-1", NewSecret([]byte("farm 1 passphrase"))))
+
+	keystore, err := readKeystore(path)
+	require.NoError(t, err)
+	keystore.Wallets["farm-2"] = keystore.Wallets["farm-1"]
+	content, err := json.Marshal(keystore)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+
+	_, err = NewKeystoreProvider(path, password).WalletPassphrase("farm-2")
+	require.Error(t, err)
+}
+
+func TestNewProvider(t *testing.T) {
+	dir := t.TempDir()
+	passwordFile := filepath.Join(dir, "password")
+	require.NoError(t, os.WriteFile(passwordFile, []byte("keystore password\n"), 0o600))
+	keystorePath := filepath.Join(dir, "keystore.json")
+	require.NoError(t, SetKeystorePassphrase(keystorePath, NewSecret([]byte("keystore password")), "farm-1", NewSecret([]byte("farm 1 passphrase"))))
+
+	provider, err := NewProvider(&infrastructure.Config{SecretsProvider: ProviderKeystore, SecretsKeystorePath: keystorePath, SecretsKeystorePasswordFile: passwordFile})
+	require.NoError(t, err)
+
+	passphrase, err := provider.WalletPassphrase("farm-1")
+	require.NoError(t, err)
+	require.Equal(t, "farm 1 passphrase", secretValue(t, passphrase))
+
+	_, err = NewProvider(&infrastructure.Config{SecretsProvider: "vault"})
+	require.EqualError(t, err, "unknown secrets provider {vault}")
+}
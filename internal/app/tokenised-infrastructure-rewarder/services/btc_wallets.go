@@ -0,0 +1,107 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/btcsuite/btcd/rpcclient"
+)
+
+// WalletLocks serializes the work on a single wallet between the Pay and Retry services.
+// Different wallets are not waiting on each other.
+type WalletLocks struct {
+	mutex sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func NewWalletLocks() *WalletLocks {
+	return &WalletLocks{
+		locks: make(map[string]*sync.Mutex),
+	}
+}
+
+// Lock blocks until the wallet is free and returns the function that releases it
+func (wl *WalletLocks) Lock(walletName string) func() {
+	wl.mutex.Lock()
+	lock, ok := wl.locks[walletName]
+	if !ok {
+		lock = &sync.Mutex{}
+		wl.locks[walletName] = lock
+	}
+	wl.mutex.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// btcNodeClient is the client of the node endpoint of bitcoind.
+// Wallet calls are made through the client returned by OpenWallet, which uses the /wallet/<name> endpoint.
+type btcNodeClient struct {
+	*rpcclient.Client
+	initWalletClient func(walletName string) (*rpcclient.Client, error)
+	walletLocks      *WalletLocks
+}
+
+func NewBtcNodeClient(client *rpcclient.Client, initWalletClient func(walletName string) (*rpcclient.Client, error), walletLocks *WalletLocks) BtcClient {
+	return &btcNodeClient{
+		Client:           client,
+		initWalletClient: initWalletClient,
+		walletLocks:      walletLocks,
+	}
+}
+
+// OpenWallet locks the wallet and returns a client for its endpoint.
+// The wallet is locked until the returned release function is called.
+func (c *btcNodeClient) OpenWallet(walletName string) (BtcClient, func(), error) {
+	unlock := c.walletLocks.Lock(walletName)
+
+	walletClient, err := c.initWalletClient(walletName)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+
+	release := func() {
+		walletClient.Shutdown()
+		unlock()
+	}
+
+	return &btcWalletClient{Client: walletClient}, release, nil
+}
+
+// ListUnspent lists the unspent outputs of the default wallet with the exact amounts the node returned
+func (c *btcNodeClient) ListUnspent() ([]types.UnspentTx, error) {
+	return listUnspent(c.Client)
+}
+
+// listUnspent reads the amounts from the json numbers of the response,
+// the ListUnspent of the rpc client would round them through a float64.
+func listUnspent(client *rpcclient.Client) ([]types.UnspentTx, error) {
+	rawMessage, err := client.RawRequest("listunspent", []json.RawMessage{})
+	if err != nil {
+		return nil, err
+	}
+
+	var unspentTxs []types.UnspentTx
+	if err := json.Unmarshal(rawMessage, &unspentTxs); err != nil {
+		return nil, err
+	}
+
+	return unspentTxs, nil
+}
+
+// btcWalletClient is the client of a single wallet endpoint. It can not open other wallets.
+type btcWalletClient struct {
+	*rpcclient.Client
+}
+
+// ListUnspent lists the unspent outputs of the wallet with the exact amounts the node returned
+func (c *btcWalletClient) ListUnspent() ([]types.UnspentTx, error) {
+	return listUnspent(c.Client)
+}
+
+func (c *btcWalletClient) OpenWallet(walletName string) (BtcClient, func(), error) {
+	return nil, nil, fmt.Errorf("wallet client can not open wallet {%s}", walletName)
+}
@@ -0,0 +1,40 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWalletLocks(t *testing.T) {
+	walletLocks := NewWalletLocks()
+	unlockFarm1 := walletLocks.Lock("farm_1")
+
+	// a different wallet is not waiting for farm_1
+	unlockFarm2 := walletLocks.Lock("farm_2")
+	unlockFarm2()
+
+	locked := make(chan struct{})
+	go func() {
+		unlock := walletLocks.Lock("farm_1")
+		close(locked)
+		unlock()
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("farm_1 was locked twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlockFarm1()
+
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatal("farm_1 was not locked after it was released")
+	}
+
+	require.Len(t, walletLocks.locks, 2)
+}
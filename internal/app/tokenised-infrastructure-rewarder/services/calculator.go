@@ -12,7 +12,7 @@ import (
 // so a method that returns each nft owner for the time period with the time he owned it as percent
 // use this percent to calculate how much each one should get from the total reward
 func (s *PayService) calculateNftOwnersForTimePeriodWithRewardPercent(ctx context.Context, nftTransferHistory []types.NftTransferEvent,
-	collectionDenomId, nftId string, periodStart, periodEnd int64, currentNftOwner, payoutAddrNetwork string, rewardForNftAfterFeeBtcDecimal decimal.Decimal) (map[string]float64, []types.NFTOwnerInformation, error) {
+	collectionDenomId, nftId string, periodStart, periodEnd int64, currentNftOwner, payoutAddrNetwork string, rewardForNftAfterFee types.Sats) (map[string]float64, []types.NFTOwnerInformation, error) {
 
 	totalPeriodTimeInSeconds := periodEnd - periodStart
 	// tx time is block time
@@ -45,7 +45,7 @@ func (s *PayService) calculateNftOwnersForTimePeriodWithRewardPercent(ctx contex
 				PayoutAddress:      "",
 				PercentOfTimeOwned: 100,
 				Owner:              currentNftOwner,
-				Reward:             rewardForNftAfterFeeBtcDecimal,
+				Reward:             rewardForNftAfterFee,
 			}},
 			nil
 	}
@@ -68,15 +68,14 @@ func (s *PayService) calculateNftOwnersForTimePeriodWithRewardPercent(ctx contex
 		Timestamp: periodEnd,
 	})
 
-	totalCalculatedReward := decimal.Zero
 	nftOwnersInformation := []types.NFTOwnerInformation{}
+	timesOwned := []decimal.Decimal{}
 	for i := 0; i < len(transferHistoryForTimePeriod)-1; i++ {
 		timeOwned := transferHistoryForTimePeriod[i+1].Timestamp - transferHistoryForTimePeriod[i].Timestamp
 		percentOfTimeOwned := decimal.NewFromInt(timeOwned).Div(decimal.NewFromInt(totalPeriodTimeInSeconds)).RoundDown(15)
 
-		calculatedReward := rewardForNftAfterFeeBtcDecimal.Mul(percentOfTimeOwned)
-		totalCalculatedReward = totalCalculatedReward.Add(calculatedReward)
 		ownersCudosAddressWithPercentOwnedTime[transferHistoryForTimePeriod[i].To] += percentOfTimeOwned.InexactFloat64() * 100
+		timesOwned = append(timesOwned, decimal.NewFromInt(timeOwned))
 
 		nftOwnersInformation = append(nftOwnersInformation, types.NFTOwnerInformation{
 			PercentOfTimeOwned: percentOfTimeOwned.InexactFloat64() * 100,
@@ -85,28 +84,21 @@ func (s *PayService) calculateNftOwnersForTimePeriodWithRewardPercent(ctx contex
 			TimeOwnedTo:        transferHistoryForTimePeriod[i+1].Timestamp,
 			PayoutAddress:      "",
 			Owner:              transferHistoryForTimePeriod[i].To,
-			Reward:             calculatedReward,
 		})
 	}
 
-	nftRewardDistributionleftovers := rewardForNftAfterFeeBtcDecimal.Sub(totalCalculatedReward)
-
-	if nftRewardDistributionleftovers.Abs().GreaterThan(decimal.NewFromFloat(0.000000001)) {
-		return nil, nil, fmt.Errorf("calculated NFT reward distribution is too far off the total given. CalculatedForOwnerDistribution: %s, TotalGiventoDistribute: %s", totalCalculatedReward, rewardForNftAfterFeeBtcDecimal)
-	}
-
-	lastOwnerIndex := len(nftOwnersInformation) - 1
-	if nftRewardDistributionleftovers.GreaterThan(decimal.Zero) {
-		nftOwnersInformation[lastOwnerIndex].Reward = nftOwnersInformation[lastOwnerIndex].Reward.Add(nftRewardDistributionleftovers)
+	// the reward is split by the time owned, the satoshis that are rounded off go to the owners with the largest remainders
+	for i, reward := range rewardForNftAfterFee.Allocate(timesOwned) {
+		nftOwnersInformation[i].Reward = reward
 	}
 
-	var finalTotalDistribution decimal.Decimal
+	var finalTotalDistribution types.Sats
 	for _, ownerInfo := range nftOwnersInformation {
-		finalTotalDistribution = finalTotalDistribution.Add(ownerInfo.Reward)
+		finalTotalDistribution += ownerInfo.Reward
 	}
 
-	if !finalTotalDistribution.Equal(rewardForNftAfterFeeBtcDecimal) {
-		return nil, nil, fmt.Errorf("calculated NFT reward distribution is not equal to the total given. CalculatedForOwnerDistribution: %s, TotalGivenToDistribute: %s", finalTotalDistribution, rewardForNftAfterFeeBtcDecimal)
+	if finalTotalDistribution != rewardForNftAfterFee {
+		return nil, nil, fmt.Errorf("calculated NFT reward distribution is not equal to the total given. CalculatedForOwnerDistribution: %s, TotalGivenToDistribute: %s", finalTotalDistribution, rewardForNftAfterFee)
 	}
 
 	return ownersCudosAddressWithPercentOwnedTime, nftOwnersInformation, nil
@@ -115,69 +107,70 @@ func (s *PayService) calculateNftOwnersForTimePeriodWithRewardPercent(ctx contex
 // calculateHourlyMaintenanceFee calculates the hourly maintenance fee for a farm
 // the farm maintenance fee is given in BTC on early basis
 // split that into hourly fee
-func (s *PayService) calculateHourlyMaintenanceFee(farm types.Farm, currentHashPowerForFarm float64) decimal.Decimal {
+func (s *PayService) calculateHourlyMaintenanceFee(farm types.Farm, currentHashPowerForFarm types.HashPower) decimal.Decimal {
 	currentYear, currentMonth, _ := s.helper.Date()
 	periodLength := s.helper.DaysIn(currentMonth, currentYear)
 
 	mtFeeInBtc := decimal.NewFromFloat(farm.MaintenanceFeeInBtc)
 
-	btcFeePerOneHashPowerBtcDecimal := mtFeeInBtc.Div(decimal.NewFromFloat(currentHashPowerForFarm))
+	btcFeePerOneHashPowerBtcDecimal := mtFeeInBtc.Div(currentHashPowerForFarm.Th())
 	dailyFeeInBtcDecimalPerTh := btcFeePerOneHashPowerBtcDecimal.Div(decimal.NewFromInt(int64(periodLength)))
 	hourlyFeeInBtcDecimalPerTh := dailyFeeInBtcDecimalPerTh.Div(decimal.NewFromInt(24))
 
 	return hourlyFeeInBtcDecimalPerTh
 }
 
-// calculate the hours that the period consists of
-// calculate fee based on the hourly fee multiplied by the period hours
+// calculate the fee for the period based on the hourly fee, rounded down to the satoshi
 // if the fee is bigger than the nft reward, reduce it to the nft reward and set the reward to zero
 // else reduce the nft reward by the fee
 // finally distribute the maintenance fee between aura and farm
 func (s *PayService) calculateMaintenanceFeeForNFT(periodStart int64,
 	periodEnd int64,
 	hourlyFeePerThInBtcDecimal decimal.Decimal,
-	nftHashRateInTh float64,
-	rewardForNftBtcDecimal decimal.Decimal) (decimal.Decimal, decimal.Decimal, decimal.Decimal, error) {
-	periodInHoursToPayFor := float64(periodEnd-periodStart) / float64(3600) // period for which we are paying the MT fee
-	hourlyFeeForNftInBtcDecimal := hourlyFeePerThInBtcDecimal.Mul(decimal.NewFromFloat(nftHashRateInTh))
-
-	var rewardForNftAfterFeesBtcDecimal decimal.Decimal
-	nftMaintenanceFeeForPayoutPeriodBtcDecimal := hourlyFeeForNftInBtcDecimal.Mul(decimal.NewFromFloat(periodInHoursToPayFor)) // the fee for the period
-	if nftMaintenanceFeeForPayoutPeriodBtcDecimal.GreaterThan(rewardForNftBtcDecimal) {                                        // if the fee is greater - it has higher priority then the users reward
-		nftMaintenanceFeeForPayoutPeriodBtcDecimal = rewardForNftBtcDecimal
-		rewardForNftAfterFeesBtcDecimal = decimal.Zero
+	nftHashRate types.HashPower,
+	rewardForNft types.Sats) (types.Sats, types.Sats, types.Sats, error) {
+	hourlyFeeForNftInBtcDecimal := hourlyFeePerThInBtcDecimal.Mul(nftHashRate.Th())
+
+	// the fee for the period, hourly fee * seconds / 3600
+	oneBtc := types.Sats(types.SatsPerBtc)
+	nftMaintenanceFeeForPayoutPeriod := oneBtc.Share(hourlyFeeForNftInBtcDecimal.Mul(decimal.NewFromInt(periodEnd-periodStart)), decimal.NewFromInt(3600))
+
+	var rewardForNftAfterFees types.Sats
+	if nftMaintenanceFeeForPayoutPeriod > rewardForNft { // if the fee is greater - it has higher priority then the users reward
+		nftMaintenanceFeeForPayoutPeriod = rewardForNft
+		rewardForNftAfterFees = 0
 	} else {
-		rewardForNftAfterFeesBtcDecimal = rewardForNftBtcDecimal.Sub(nftMaintenanceFeeForPayoutPeriodBtcDecimal)
+		rewardForNftAfterFees = rewardForNft - nftMaintenanceFeeForPayoutPeriod
 	}
 
-	partOfMaintenanceFeeForCudoBtcDecimal := nftMaintenanceFeeForPayoutPeriodBtcDecimal.Mul(decimal.NewFromFloat(s.config.CUDOMaintenanceFeePercent / 100)) // ex 10% from 1000 = 100
-	nftMaintenanceFeeForPayoutPeriodBtcDecimal = nftMaintenanceFeeForPayoutPeriodBtcDecimal.Sub(partOfMaintenanceFeeForCudoBtcDecimal)
+	partOfMaintenanceFeeForCudo := nftMaintenanceFeeForPayoutPeriod.Percent(decimal.NewFromFloat(s.config.CUDOMaintenanceFeePercent)) // ex 10% from 1000 = 100
+	nftMaintenanceFeeForPayoutPeriod -= partOfMaintenanceFeeForCudo
 
-	totalCalculated := nftMaintenanceFeeForPayoutPeriodBtcDecimal.Add(partOfMaintenanceFeeForCudoBtcDecimal).Add(rewardForNftAfterFeesBtcDecimal)
-	if !totalCalculated.Equal(rewardForNftBtcDecimal) {
-		return decimal.Zero, decimal.Zero, decimal.Zero, fmt.Errorf("the sum of the maintenance fee, cudos fee and the reward for the nft is not equal to the reward for the nft. MaintenanceFee: %s, CudosFee: %s, Reward: %s, Sum: %s. AmountToDistribute: %s", nftMaintenanceFeeForPayoutPeriodBtcDecimal, partOfMaintenanceFeeForCudoBtcDecimal, rewardForNftBtcDecimal, totalCalculated, rewardForNftBtcDecimal)
+	totalCalculated := nftMaintenanceFeeForPayoutPeriod + partOfMaintenanceFeeForCudo + rewardForNftAfterFees
+	if totalCalculated != rewardForNft {
+		return 0, 0, 0, fmt.Errorf("the sum of the maintenance fee, cudos fee and the reward for the nft is not equal to the reward for the nft. MaintenanceFee: %s, CudosFee: %s, Reward: %s, Sum: %s. AmountToDistribute: %s", nftMaintenanceFeeForPayoutPeriod, partOfMaintenanceFeeForCudo, rewardForNft, totalCalculated, rewardForNft)
 	}
 
-	return nftMaintenanceFeeForPayoutPeriodBtcDecimal, partOfMaintenanceFeeForCudoBtcDecimal, rewardForNftAfterFeesBtcDecimal, nil
+	return nftMaintenanceFeeForPayoutPeriod, partOfMaintenanceFeeForCudo, rewardForNftAfterFees, nil
 }
 
 // calculates the cudos/aura fee from the total farm payment before maintenance fees
-// the fee is taken from the payment service env
-func (s *PayService) calculateCudosFeeOfTotalFarmIncome(totalFarmIncomeBtcDecimal decimal.Decimal) (decimal.Decimal, decimal.Decimal) {
+// the fee is taken from the payment service env and is rounded down to the satoshi
+func (s *PayService) calculateCudosFeeOfTotalFarmIncome(totalFarmIncome types.Sats) (types.Sats, types.Sats) {
 
-	farmIncomeCudosFeeBtcDecimal := totalFarmIncomeBtcDecimal.Mul(decimal.NewFromFloat(s.config.CUDOFeeOnAllBTC / 100)) // ex 10% = 0.1 * total
-	farmIncomeAfterCudosFeeBtcDecimal := totalFarmIncomeBtcDecimal.Sub(farmIncomeCudosFeeBtcDecimal)
+	farmIncomeCudosFee := totalFarmIncome.Percent(decimal.NewFromFloat(s.config.CUDOFeeOnAllBTC)) // ex 10% = 0.1 * total
+	farmIncomeAfterCudosFee := totalFarmIncome - farmIncomeCudosFee
 
-	return farmIncomeAfterCudosFeeBtcDecimal, farmIncomeCudosFeeBtcDecimal
+	return farmIncomeAfterCudosFee, farmIncomeCudosFee
 }
 
 // calculates the total hash power distributed to the collections
 // used for checks - it shouldn't exceed that of the farm
-func sumMintedHashPowerForAllCollections(collections []types.Collection) float64 {
-	var totalMintedHashPowerForAllCollections float64
+func sumMintedHashPowerForAllCollections(collections []types.Collection) types.HashPower {
+	var totalMintedHashPowerForAllCollections types.HashPower
 
 	for _, collection := range collections {
-		totalMintedHashPowerForAllCollections += sumMintedHashPowerForCollection(collection)
+		totalMintedHashPowerForAllCollections = totalMintedHashPowerForAllCollections.Add(sumMintedHashPowerForCollection(collection))
 	}
 
 	return totalMintedHashPowerForAllCollections
@@ -185,64 +178,59 @@ func sumMintedHashPowerForAllCollections(collections []types.Collection) float64
 
 // calculates the minted hash power for a collection
 // that means the minted nfts from that collection
-func sumMintedHashPowerForCollection(collection types.Collection) float64 {
-	var totalMintedHashPowerForCollection float64
+func sumMintedHashPowerForCollection(collection types.Collection) types.HashPower {
+	var totalMintedHashPowerForCollection types.HashPower
 
 	for _, nft := range collection.Nfts {
-		totalMintedHashPowerForCollection += nft.DataJson.HashRateOwned
+		totalMintedHashPowerForCollection = totalMintedHashPowerForCollection.Add(nft.DataJson.HashRateOwned)
 	}
 
 	return totalMintedHashPowerForCollection
 }
 
 // given total hash power and allocated hash power for the given payment (nft, collection)
-// calculate the reward as percent of the total
-func calculateRewardByPercent(availableHashPower float64, actualHashPower float64, reward decimal.Decimal) decimal.Decimal {
-	if availableHashPower <= 0 || actualHashPower <= 0 || reward.LessThanOrEqual(decimal.Zero) {
-		return decimal.Zero
+// calculate the reward as percent of the total, rounded down to the satoshi
+func calculateRewardByPercent(availableHashPower types.HashPower, actualHashPower types.HashPower, reward types.Sats) types.Sats {
+	if !availableHashPower.IsPositive() || !actualHashPower.IsPositive() {
+		return 0
 	}
 
-	payoutRewardPercent := decimal.NewFromFloat(actualHashPower).Div(decimal.NewFromFloat(availableHashPower)).RoundDown(15)
-	calculatedReward := reward.Mul(payoutRewardPercent)
-
-	// btcutil.Amount is int64 because satoshi is the lowest possible unit (1 satoshi = 0.00000001 bitcoin) and is an int64 in btc core code
-	return calculatedReward
+	return reward.Share(actualHashPower.Th(), availableHashPower.Th())
 }
 
 // given period and nft valid period within this period
 // calculate the reward it should take
 // this is used when nft that is minted or expired in the middle of a payment period exists
-func calculatePercentByTime(timestampPrevPayment, timestampCurrentPayment, nftStartTime, nftEndTime int64, totalRewardForPeriod decimal.Decimal) decimal.Decimal {
+func calculatePercentByTime(timestampPrevPayment, timestampCurrentPayment, nftStartTime, nftEndTime int64, totalRewardForPeriod types.Sats) types.Sats {
 	if nftStartTime <= timestampPrevPayment && nftEndTime >= timestampCurrentPayment {
 		return totalRewardForPeriod
 	}
 
 	if nftEndTime <= timestampPrevPayment || nftStartTime >= timestampCurrentPayment {
-		return decimal.Zero
+		return 0
 	}
 
 	timeMinted := nftEndTime - nftStartTime
 	wholePeriod := timestampCurrentPayment - timestampPrevPayment
-	percentOfPeriodMitned := decimal.NewFromInt(timeMinted).Div(decimal.NewFromInt(wholePeriod)).RoundDown(15)
 
-	return totalRewardForPeriod.Mul(percentOfPeriodMitned)
+	return totalRewardForPeriod.Share(decimal.NewFromInt(timeMinted), decimal.NewFromInt(wholePeriod))
 }
 
-// during calculations of the nft fees and rewards there are some inaccuracies
+// the nft rewards and fees are rounded down to the satoshi
 // sum nft rewards and fees for each nft
 // and check that they are not bigger than the total reward for all nfts of the farm
-// return it so it van be distributed
-func calculateLeftoverNftRewardDistribution(rewardForNftOwnersBtcDecimal decimal.Decimal, statistics []types.NFTStatistics) (decimal.Decimal, error) {
+// return what is left so it goes to the farm leftover
+func calculateLeftoverNftRewardDistribution(rewardForNftOwners types.Sats, statistics []types.NFTStatistics) (types.Sats, error) {
 	// return to the farm owner whatever is left
-	var distributedNftRewards decimal.Decimal
+	var distributedNftRewards types.Sats
 	for _, nftStat := range statistics {
-		distributedNftRewards = distributedNftRewards.Add(nftStat.Reward).Add(nftStat.MaintenanceFee).Add(nftStat.CUDOPartOfMaintenanceFee)
+		distributedNftRewards += nftStat.Reward + nftStat.MaintenanceFee + nftStat.CUDOPartOfMaintenanceFee
 	}
 
-	leftoverNftRewardDistribution := rewardForNftOwnersBtcDecimal.Sub(distributedNftRewards)
+	leftoverNftRewardDistribution := rewardForNftOwners - distributedNftRewards
 
-	if leftoverNftRewardDistribution.LessThan(decimal.Zero) {
-		return decimal.Decimal{}, fmt.Errorf("distributed NFT awards bigger than farm nft reward. NftRewardDistribution: %s, TotalFarmRewardAfterCudosFee: %s", distributedNftRewards, rewardForNftOwnersBtcDecimal)
+	if leftoverNftRewardDistribution < 0 {
+		return 0, fmt.Errorf("distributed NFT awards bigger than farm nft reward. NftRewardDistribution: %s, TotalFarmRewardAfterCudosFee: %s", distributedNftRewards, rewardForNftOwners)
 	}
 
 	return leftoverNftRewardDistribution, nil
@@ -250,14 +238,14 @@ func calculateLeftoverNftRewardDistribution(rewardForNftOwnersBtcDecimal decimal
 
 // sum all amounts for all addresses taht will be sent
 // they should equal exactly the total farm reward or something went wrong during calculation
-func checkTotalAmountToDistribute(receivedRewardForFarmBtcDecimal decimal.Decimal, destinationAddressesWithAmountBtcDecimal map[string]decimal.Decimal) error {
-	var totalAmountToPayToAddressesBtcDecimal decimal.Decimal
-	for _, amount := range destinationAddressesWithAmountBtcDecimal {
-		totalAmountToPayToAddressesBtcDecimal = totalAmountToPayToAddressesBtcDecimal.Add(amount)
+func checkTotalAmountToDistribute(receivedRewardForFarm types.Sats, destinationAddressesWithAmount map[string]types.Sats) error {
+	var totalAmountToPayToAddresses types.Sats
+	for _, amount := range destinationAddressesWithAmount {
+		totalAmountToPayToAddresses += amount
 	}
 
-	if !totalAmountToPayToAddressesBtcDecimal.Equals(receivedRewardForFarmBtcDecimal) {
-		return fmt.Errorf("distributed amount doesn't equal total farm rewards. Distributed amount: {%s}, TotalFarmReward: {%s}", totalAmountToPayToAddressesBtcDecimal, receivedRewardForFarmBtcDecimal)
+	if totalAmountToPayToAddresses != receivedRewardForFarm {
+		return fmt.Errorf("distributed amount doesn't equal total farm rewards. Distributed amount: {%s}, TotalFarmReward: {%s}", totalAmountToPayToAddresses, receivedRewardForFarm)
 	}
 
 	return nil
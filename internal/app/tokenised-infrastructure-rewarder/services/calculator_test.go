@@ -18,7 +18,7 @@ import (
 
 func TestSumMintedHashPowerForAllCollectionsShouldReturnZeroWithEmptyCollections(t *testing.T) {
 	result := sumMintedHashPowerForAllCollections([]types.Collection{})
-	require.Equal(t, float64(0), result)
+	require.Equal(t, "0", result.String())
 }
 
 func TestSumMintedHashPowerForAllCollections(t *testing.T) {
@@ -29,18 +29,18 @@ func TestSumMintedHashPowerForAllCollections(t *testing.T) {
 				{
 					DataJson: types.NFTDataJson{
 						ExpirationDate: expirationDate,
-						HashRateOwned:  0.01,
+						HashRateOwned:  types.NewHashPowerFromTh(decimal.New(1, -2)),
 					},
 				},
 				{
 					DataJson: types.NFTDataJson{
 						ExpirationDate: expirationDate,
-						HashRateOwned:  1001,
+						HashRateOwned:  types.NewHashPowerFromInt(1001),
 					},
 				},
 				{
 					DataJson: types.NFTDataJson{
-						HashRateOwned: 5,
+						HashRateOwned: types.NewHashPowerFromInt(5),
 					},
 				},
 			},
@@ -50,42 +50,42 @@ func TestSumMintedHashPowerForAllCollections(t *testing.T) {
 				{
 					DataJson: types.NFTDataJson{
 						ExpirationDate: expirationDate,
-						HashRateOwned:  2,
+						HashRateOwned:  types.NewHashPowerFromInt(2),
 					},
 				},
 				{
 					DataJson: types.NFTDataJson{
 						ExpirationDate: expirationDate,
-						HashRateOwned:  666,
+						HashRateOwned:  types.NewHashPowerFromInt(666),
 					},
 				},
 			},
 		},
 	}
 	result := sumMintedHashPowerForAllCollections(collections)
-	require.Equal(t, 1674.01, result)
+	require.Equal(t, "1674.01", result.String())
 }
 
 func TestCalculatePercentShouldReturnZeroIfInvalidHashingPowerProvided(t *testing.T) {
-	require.Equal(t, decimal.Zero, calculateRewardByPercent(-1, -1, decimal.NewFromInt(10000000)))
-	require.Equal(t, decimal.Zero, calculateRewardByPercent(10000, -1, decimal.NewFromInt(10000000)))
-	require.Equal(t, decimal.Zero, calculateRewardByPercent(-1, 10000, decimal.NewFromInt(10000000)))
-	require.Equal(t, decimal.Zero, calculateRewardByPercent(0, 0, decimal.NewFromInt(10000000)))
-	require.Equal(t, decimal.Zero, calculateRewardByPercent(10000, 0, decimal.NewFromInt(10000000)))
-	require.Equal(t, decimal.Zero, calculateRewardByPercent(0, 10000, decimal.NewFromInt(10000000)))
+	require.Equal(t, types.Sats(0), calculateRewardByPercent(types.NewHashPowerFromInt(-1), types.NewHashPowerFromInt(-1), 10000000))
+	require.Equal(t, types.Sats(0), calculateRewardByPercent(types.NewHashPowerFromInt(10000), types.NewHashPowerFromInt(-1), 10000000))
+	require.Equal(t, types.Sats(0), calculateRewardByPercent(types.NewHashPowerFromInt(-1), types.NewHashPowerFromInt(10000), 10000000))
+	require.Equal(t, types.Sats(0), calculateRewardByPercent(types.NewHashPowerFromInt(0), types.NewHashPowerFromInt(0), 10000000))
+	require.Equal(t, types.Sats(0), calculateRewardByPercent(types.NewHashPowerFromInt(10000), types.NewHashPowerFromInt(0), 10000000))
+	require.Equal(t, types.Sats(0), calculateRewardByPercent(types.NewHashPowerFromInt(0), types.NewHashPowerFromInt(10000), 10000000))
 }
 
 func TestCalculatePercentShouldReturnZeroIfRewardIsZero(t *testing.T) {
-	require.Equal(t, decimal.Zero, calculateRewardByPercent(10000, 10000, decimal.Zero))
+	require.Equal(t, types.Sats(0), calculateRewardByPercent(types.NewHashPowerFromInt(10000), types.NewHashPowerFromInt(10000), 0))
 }
 
 func TestCalculatePercent(t *testing.T) {
-	require.Equal(t, decimal.NewFromInt(10).String(), calculateRewardByPercent(10000, 1000, decimal.NewFromInt(100)).String())
+	require.Equal(t, types.Sats(10), calculateRewardByPercent(types.NewHashPowerFromInt(10000), types.NewHashPowerFromInt(1000), 100))
 }
 
 func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldReturnErrorIfInvalidPeriod(t *testing.T) {
-	s := NewPayService(nil, nil, nil, nil)
-	_, _, err := s.calculateNftOwnersForTimePeriodWithRewardPercent(context.TODO(), []types.NftTransferEvent{}, "", "", 1000, 100, "", "", decimal.Zero)
+	s := NewPayService(nil, nil, nil, nil, nil, nil, nil)
+	_, _, err := s.calculateNftOwnersForTimePeriodWithRewardPercent(context.TODO(), []types.NftTransferEvent{}, "", "", 1000, 100, "", "", 0)
 	require.Equal(t, errors.New("invalid period, start (1000) end (100)"), err)
 }
 
@@ -98,8 +98,8 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldReturnHundredPerc
 	currentNftOwner := "addr1"
 	periodStart := int64(1)
 	periodEnd := int64(100)
-	s := NewPayService(nil, apiRequester, nil, nil)
-	percents, nftOwnersForPeriod, err := s.calculateNftOwnersForTimePeriodWithRewardPercent(context.TODO(), []types.NftTransferEvent{}, "testdenom", "1", periodStart, periodEnd, currentNftOwner, "BTC", decimal.Zero)
+	s := NewPayService(nil, apiRequester, nil, nil, nil, &mockSecretProvider{}, nil)
+	percents, nftOwnersForPeriod, err := s.calculateNftOwnersForTimePeriodWithRewardPercent(context.TODO(), []types.NftTransferEvent{}, "testdenom", "1", periodStart, periodEnd, currentNftOwner, "BTC", 0)
 	statistics.NFTOwnersForPeriod = nftOwnersForPeriod
 
 	require.NoError(t, err)
@@ -114,7 +114,7 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldReturnHundredPerc
 				PayoutAddress:      "",
 				PercentOfTimeOwned: 100,
 				Owner:              "addr1",
-				Reward:             decimal.Zero,
+				Reward:             0,
 			},
 		},
 	}
@@ -142,8 +142,8 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithSingleTra
 	currentNftOwner := "addr1"
 	periodStart := int64(1)
 	periodEnd := int64(100)
-	s := NewPayService(nil, apiRequester, nil, nil)
-	percents, nftOwnersForPeriod, err := s.calculateNftOwnersForTimePeriodWithRewardPercent(context.TODO(), nftTransferHistory, "testdenom", "1", periodStart, periodEnd, currentNftOwner, "BTC", decimal.Zero)
+	s := NewPayService(nil, apiRequester, nil, nil, nil, &mockSecretProvider{}, nil)
+	percents, nftOwnersForPeriod, err := s.calculateNftOwnersForTimePeriodWithRewardPercent(context.TODO(), nftTransferHistory, "testdenom", "1", periodStart, periodEnd, currentNftOwner, "BTC", 0)
 	require.NoError(t, err)
 	statistics.NFTOwnersForPeriod = nftOwnersForPeriod
 
@@ -162,7 +162,7 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithSingleTra
 			PercentOfTimeOwned: 63.636363636363605,
 			PayoutAddress:      "",
 			Owner:              "nft_owner_1",
-			Reward:             decimal.Zero,
+			Reward:             0,
 		},
 		{
 			TimeOwnedFrom:      64,
@@ -171,7 +171,7 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithSingleTra
 			PercentOfTimeOwned: 36.363636363636296,
 			PayoutAddress:      "",
 			Owner:              "nft_owner_2",
-			Reward:             decimal.Zero,
+			Reward:             0,
 		},
 	}
 
@@ -236,8 +236,8 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithMultipleT
 	currentNftOwner := "addr1"
 	periodStart := int64(1)
 	periodEnd := int64(100)
-	s := NewPayService(nil, apiRequester, nil, nil)
-	percents, nftOwnersForPeriod, err := s.calculateNftOwnersForTimePeriodWithRewardPercent(context.TODO(), nftTransferHistory, "testdenom", "1", periodStart, periodEnd, currentNftOwner, "BTC", decimal.Zero)
+	s := NewPayService(nil, apiRequester, nil, nil, nil, &mockSecretProvider{}, nil)
+	percents, nftOwnersForPeriod, err := s.calculateNftOwnersForTimePeriodWithRewardPercent(context.TODO(), nftTransferHistory, "testdenom", "1", periodStart, periodEnd, currentNftOwner, "BTC", 0)
 	require.NoError(t, err)
 	statistics.NFTOwnersForPeriod = nftOwnersForPeriod
 
@@ -260,7 +260,7 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithMultipleT
 			PercentOfTimeOwned: 9.090909090909,
 			PayoutAddress:      "",
 			Owner:              "nft_minter",
-			Reward:             decimal.Zero,
+			Reward:             0,
 		},
 		{
 			TimeOwnedFrom:      10,
@@ -269,7 +269,7 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithMultipleT
 			PercentOfTimeOwned: 3.030303030303,
 			PayoutAddress:      "",
 			Owner:              "nft_owner_1",
-			Reward:             decimal.Zero,
+			Reward:             0,
 		},
 		{
 			TimeOwnedFrom:      13,
@@ -278,7 +278,7 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithMultipleT
 			PercentOfTimeOwned: 37.3737373737373,
 			PayoutAddress:      "",
 			Owner:              "nft_owner_2",
-			Reward:             decimal.Zero,
+			Reward:             0,
 		},
 		{
 			TimeOwnedFrom:      50,
@@ -287,7 +287,7 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithMultipleT
 			PercentOfTimeOwned: 30.303030303030297,
 			PayoutAddress:      "",
 			Owner:              "nft_owner_3",
-			Reward:             decimal.Zero,
+			Reward:             0,
 		},
 		{
 			TimeOwnedFrom:      80,
@@ -296,7 +296,7 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithMultipleT
 			PercentOfTimeOwned: 15.151515151515099,
 			PayoutAddress:      "",
 			Owner:              "nft_owner_4",
-			Reward:             decimal.Zero,
+			Reward:             0,
 		},
 		{
 			TimeOwnedFrom:      95,
@@ -305,7 +305,7 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithMultipleT
 			PercentOfTimeOwned: 5.0505050505049995,
 			PayoutAddress:      "",
 			Owner:              "nft_owner_5",
-			Reward:             decimal.Zero,
+			Reward:             0,
 		},
 	}
 
@@ -365,8 +365,8 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithMultipleT
 	currentNftOwner := "addr1"
 	periodStart := int64(1)
 	periodEnd := int64(100)
-	s := NewPayService(nil, apiRequester, nil, nil)
-	percents, nftOwnersForPeriod, err := s.calculateNftOwnersForTimePeriodWithRewardPercent(context.TODO(), nftTransferHistory, "testdenom", "1", periodStart, periodEnd, currentNftOwner, "BTC", decimal.Zero)
+	s := NewPayService(nil, apiRequester, nil, nil, nil, &mockSecretProvider{}, nil)
+	percents, nftOwnersForPeriod, err := s.calculateNftOwnersForTimePeriodWithRewardPercent(context.TODO(), nftTransferHistory, "testdenom", "1", periodStart, periodEnd, currentNftOwner, "BTC", 0)
 	require.NoError(t, err)
 	statistics.NFTOwnersForPeriod = nftOwnersForPeriod
 
@@ -389,7 +389,7 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithMultipleT
 			PercentOfTimeOwned: 9.090909090909,
 			PayoutAddress:      "",
 			Owner:              "nft_minter",
-			Reward:             decimal.Zero,
+			Reward:             0,
 		},
 		{
 			TimeOwnedFrom:      10,
@@ -398,7 +398,7 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithMultipleT
 			PercentOfTimeOwned: 3.030303030303,
 			PayoutAddress:      "",
 			Owner:              "nft_owner_1",
-			Reward:             decimal.Zero,
+			Reward:             0,
 		},
 		{
 			TimeOwnedFrom:      13,
@@ -407,7 +407,7 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithMultipleT
 			PercentOfTimeOwned: 37.3737373737373,
 			PayoutAddress:      "",
 			Owner:              "nft_owner_2",
-			Reward:             decimal.Zero,
+			Reward:             0,
 		},
 		{
 			TimeOwnedFrom:      50,
@@ -416,7 +416,7 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithMultipleT
 			PercentOfTimeOwned: 30.303030303030297,
 			PayoutAddress:      "",
 			Owner:              "nft_owner_3",
-			Reward:             decimal.Zero,
+			Reward:             0,
 		},
 		{
 			TimeOwnedFrom:      80,
@@ -425,7 +425,7 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithMultipleT
 			PercentOfTimeOwned: 15.151515151515099,
 			PayoutAddress:      "",
 			Owner:              "nft_owner_4",
-			Reward:             decimal.Zero,
+			Reward:             0,
 		},
 		{
 			TimeOwnedFrom:      95,
@@ -434,7 +434,7 @@ func TestCalculateNftOwnersForTimePeriodWithRewardPercentShouldWorkWithMultipleT
 			PercentOfTimeOwned: 5.0505050505049995,
 			PayoutAddress:      "",
 			Owner:              "nft_owner_5",
-			Reward:             decimal.Zero,
+			Reward:             0,
 		},
 	}
 	// needed because values of decimal.Decimal are not exactly equal
@@ -451,7 +451,7 @@ func TestCalculateHourlyMaintenanceFee(t *testing.T) {
 	testCases := []struct {
 		desc                    string
 		farm                    types.Farm
-		currentHashPowerForFarm float64
+		currentHashPowerForFarm types.HashPower
 		helper                  InfrastructureHelper
 		expectedResult          decimal.Decimal
 	}{
@@ -460,14 +460,14 @@ func TestCalculateHourlyMaintenanceFee(t *testing.T) {
 			farm: types.Farm{
 				MaintenanceFeeInBtc: 0.01,
 			},
-			currentHashPowerForFarm: 1000,
+			currentHashPowerForFarm: types.NewHashPowerFromInt(1000),
 			expectedResult:          result,
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
-			s := NewPayService(nil, &mockAPIRequester{}, &mockHelper{}, nil)
+			s := NewPayService(nil, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, nil, &mockSecretProvider{}, nil)
 
 			result := s.calculateHourlyMaintenanceFee(tc.farm, tc.currentHashPowerForFarm)
 			assert.Equal(t, tc.expectedResult.String(), result.String(), "unexpected result for %s", tc.desc)
@@ -480,62 +480,62 @@ func TestCalculateMaintenanceFeeForNFT(t *testing.T) {
 		desc                       string
 		periodStart                int64
 		periodEnd                  int64
-		nftHashPower               float64
+		nftHashPower               types.HashPower
 		hourlyFeePerThInBtcDecimal decimal.Decimal
-		rewardForNftBtcDecimal     decimal.Decimal
+		rewardForNft               types.Sats
 		config                     infrastructure.Config
-		expectedNftMaintenanceFee  decimal.Decimal
-		expectedCudoMaintenance    decimal.Decimal
-		expectedRewardForNft       decimal.Decimal
+		expectedNftMaintenanceFee  types.Sats
+		expectedCudoMaintenance    types.Sats
+		expectedRewardForNft       types.Sats
 	}{
 		{
 			desc:                       "successful case",
 			periodStart:                0,
 			periodEnd:                  3600,
-			nftHashPower:               1,
+			nftHashPower:               types.NewHashPowerFromInt(1),
 			hourlyFeePerThInBtcDecimal: decimal.NewFromFloat(0.0001),
-			rewardForNftBtcDecimal:     decimal.NewFromFloat(0.001),
+			rewardForNft:               types.NewSatsFromBtcFloat(0.001),
 			config: infrastructure.Config{
 				CUDOMaintenanceFeePercent: 10,
 			},
-			expectedNftMaintenanceFee: decimal.NewFromFloat(0.00009),
-			expectedCudoMaintenance:   decimal.NewFromFloat(0.00001),
-			expectedRewardForNft:      decimal.NewFromFloat(0.0009),
+			expectedNftMaintenanceFee: types.NewSatsFromBtcFloat(0.00009),
+			expectedCudoMaintenance:   types.NewSatsFromBtcFloat(0.00001),
+			expectedRewardForNft:      types.NewSatsFromBtcFloat(0.0009),
 		}, {
 			desc:                       "zero reward",
 			periodStart:                0,
 			periodEnd:                  3600,
-			nftHashPower:               1,
+			nftHashPower:               types.NewHashPowerFromInt(1),
 			hourlyFeePerThInBtcDecimal: decimal.NewFromFloat(0.0001),
-			rewardForNftBtcDecimal:     decimal.Zero,
+			rewardForNft:               0,
 			config: infrastructure.Config{
 				CUDOMaintenanceFeePercent: 10,
 			},
-			expectedNftMaintenanceFee: decimal.Zero,
-			expectedCudoMaintenance:   decimal.Zero,
-			expectedRewardForNft:      decimal.Zero,
+			expectedNftMaintenanceFee: 0,
+			expectedCudoMaintenance:   0,
+			expectedRewardForNft:      0,
 		},
 		{
 			desc:                       "zero maintenance fee",
 			periodStart:                0,
 			periodEnd:                  3600,
-			nftHashPower:               1,
+			nftHashPower:               types.NewHashPowerFromInt(1),
 			hourlyFeePerThInBtcDecimal: decimal.Zero,
-			rewardForNftBtcDecimal:     decimal.NewFromFloat(0.001),
+			rewardForNft:               types.NewSatsFromBtcFloat(0.001),
 			config: infrastructure.Config{
 				CUDOMaintenanceFeePercent: 10,
 			},
-			expectedNftMaintenanceFee: decimal.Zero,
-			expectedCudoMaintenance:   decimal.Zero,
-			expectedRewardForNft:      decimal.NewFromFloat(0.001),
+			expectedNftMaintenanceFee: 0,
+			expectedCudoMaintenance:   0,
+			expectedRewardForNft:      types.NewSatsFromBtcFloat(0.001),
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
-			s := NewPayService(&tc.config, &mockAPIRequester{}, &mockHelper{}, nil)
+			s := NewPayService(&tc.config, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, nil, &mockSecretProvider{}, nil)
 
-			nftMaintenanceFee, cudoMaintenance, rewardForNft, err := s.calculateMaintenanceFeeForNFT(tc.periodStart, tc.periodEnd, tc.hourlyFeePerThInBtcDecimal, tc.nftHashPower, tc.rewardForNftBtcDecimal)
+			nftMaintenanceFee, cudoMaintenance, rewardForNft, err := s.calculateMaintenanceFeeForNFT(tc.periodStart, tc.periodEnd, tc.hourlyFeePerThInBtcDecimal, tc.nftHashPower, tc.rewardForNft)
 			require.NoError(t, err)
 			assert.Equal(t, tc.expectedNftMaintenanceFee.String(), nftMaintenanceFee.String(), "unexpected NFT maintenance fee for %s", tc.desc)
 			assert.Equal(t, tc.expectedCudoMaintenance.String(), cudoMaintenance.String(), "unexpected Cudo maintenance fee for %s", tc.desc)
@@ -546,44 +546,44 @@ func TestCalculateMaintenanceFeeForNFT(t *testing.T) {
 
 func TestCalculateCudosFeeOfTotalFarmIncome(t *testing.T) {
 	testCases := []struct {
-		desc                         string
-		config                       infrastructure.Config
-		totalFarmIncomeBtcDecimal    decimal.Decimal
-		expectedFarmIncomeBtcDecimal decimal.Decimal
-		expectedCudosFeeBtcDecimal   decimal.Decimal
+		desc               string
+		config             infrastructure.Config
+		totalFarmIncome    types.Sats
+		expectedFarmIncome types.Sats
+		expectedCudosFee   types.Sats
 	}{
 		{
 			desc: "Test with a 10% CUDO fee",
 			config: infrastructure.Config{
 				CUDOFeeOnAllBTC: 10,
 			},
-			totalFarmIncomeBtcDecimal:    decimal.NewFromFloat(1),
-			expectedFarmIncomeBtcDecimal: decimal.NewFromFloat(0.9),
-			expectedCudosFeeBtcDecimal:   decimal.NewFromFloat(0.1),
+			totalFarmIncome:    types.NewSatsFromBtcFloat(1),
+			expectedFarmIncome: types.NewSatsFromBtcFloat(0.9),
+			expectedCudosFee:   types.NewSatsFromBtcFloat(0.1),
 		},
 		{
 			desc: "Test with a 20% CUDO fee",
 			config: infrastructure.Config{
 				CUDOFeeOnAllBTC: 20,
 			},
-			totalFarmIncomeBtcDecimal:    decimal.NewFromFloat(1),
-			expectedFarmIncomeBtcDecimal: decimal.NewFromFloat(0.8),
-			expectedCudosFeeBtcDecimal:   decimal.NewFromFloat(0.2),
+			totalFarmIncome:    types.NewSatsFromBtcFloat(1),
+			expectedFarmIncome: types.NewSatsFromBtcFloat(0.8),
+			expectedCudosFee:   types.NewSatsFromBtcFloat(0.2),
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
-			payService := NewPayService(&tc.config, &mockAPIRequester{}, &mockHelper{}, nil)
+			payService := NewPayService(&tc.config, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, nil, &mockSecretProvider{}, nil)
 
-			farmIncomeBtcDecimal, cudosFeeBtcDecimal := payService.calculateCudosFeeOfTotalFarmIncome(tc.totalFarmIncomeBtcDecimal)
+			farmIncome, cudosFee := payService.calculateCudosFeeOfTotalFarmIncome(tc.totalFarmIncome)
 
-			if !farmIncomeBtcDecimal.Equal(tc.expectedFarmIncomeBtcDecimal) {
-				t.Errorf("Expected farm income: %s, got: %s", tc.expectedFarmIncomeBtcDecimal, farmIncomeBtcDecimal)
+			if farmIncome != tc.expectedFarmIncome {
+				t.Errorf("Expected farm income: %s, got: %s", tc.expectedFarmIncome, farmIncome)
 			}
 
-			if !cudosFeeBtcDecimal.Equal(tc.expectedCudosFeeBtcDecimal) {
-				t.Errorf("Expected CUDO fee: %s, got: %s", tc.expectedCudosFeeBtcDecimal, cudosFeeBtcDecimal)
+			if cudosFee != tc.expectedCudosFee {
+				t.Errorf("Expected CUDO fee: %s, got: %s", tc.expectedCudosFee, cudosFee)
 			}
 		})
 	}
@@ -593,7 +593,7 @@ func TestSumMintedHashPowerForCollection(t *testing.T) {
 	testCases := []struct {
 		desc                   string
 		collection             types.Collection
-		expectedTotalHashPower float64
+		expectedTotalHashPower types.HashPower
 	}{
 		{
 			desc: "Test with multiple NFTs",
@@ -601,22 +601,22 @@ func TestSumMintedHashPowerForCollection(t *testing.T) {
 				Nfts: []types.NFT{
 					{
 						DataJson: types.NFTDataJson{
-							HashRateOwned: 10,
+							HashRateOwned: types.NewHashPowerFromInt(10),
 						},
 					},
 					{
 						DataJson: types.NFTDataJson{
-							HashRateOwned: 20,
+							HashRateOwned: types.NewHashPowerFromInt(20),
 						},
 					},
 					{
 						DataJson: types.NFTDataJson{
-							HashRateOwned: 30,
+							HashRateOwned: types.NewHashPowerFromInt(30),
 						},
 					},
 				},
 			},
-			expectedTotalHashPower: 60,
+			expectedTotalHashPower: types.NewHashPowerFromInt(60),
 		},
 		{
 			desc: "Test with a single NFT",
@@ -624,19 +624,19 @@ func TestSumMintedHashPowerForCollection(t *testing.T) {
 				Nfts: []types.NFT{
 					{
 						DataJson: types.NFTDataJson{
-							HashRateOwned: 5,
+							HashRateOwned: types.NewHashPowerFromInt(5),
 						},
 					},
 				},
 			},
-			expectedTotalHashPower: 5,
+			expectedTotalHashPower: types.NewHashPowerFromInt(5),
 		},
 		{
 			desc: "Test with an empty collection",
 			collection: types.Collection{
 				Nfts: []types.NFT{},
 			},
-			expectedTotalHashPower: 0,
+			expectedTotalHashPower: types.NewHashPowerFromInt(0),
 		},
 	}
 
@@ -644,8 +644,8 @@ func TestSumMintedHashPowerForCollection(t *testing.T) {
 		t.Run(tC.desc, func(t *testing.T) {
 			totalHashPower := sumMintedHashPowerForCollection(tC.collection)
 
-			if totalHashPower != tC.expectedTotalHashPower {
-				t.Errorf("Expected total hash power: %f, got: %f", tC.expectedTotalHashPower, totalHashPower)
+			if !totalHashPower.Equal(tC.expectedTotalHashPower) {
+				t.Errorf("Expected total hash power: %s, got: %s", tC.expectedTotalHashPower, totalHashPower)
 			}
 		})
 	}
@@ -654,38 +654,38 @@ func TestSumMintedHashPowerForCollection(t *testing.T) {
 func TestCalculateRewardByPercent(t *testing.T) {
 	testCases := []struct {
 		desc               string
-		availableHashPower float64
-		actualHashPower    float64
-		reward             decimal.Decimal
-		expectedReward     decimal.Decimal
+		availableHashPower types.HashPower
+		actualHashPower    types.HashPower
+		reward             types.Sats
+		expectedReward     types.Sats
 	}{
 		{
 			desc:               "Test with valid input",
-			availableHashPower: 100,
-			actualHashPower:    25,
-			reward:             decimal.NewFromFloat(1),
-			expectedReward:     decimal.NewFromFloat(0.25),
+			availableHashPower: types.NewHashPowerFromInt(100),
+			actualHashPower:    types.NewHashPowerFromInt(25),
+			reward:             types.NewSatsFromBtcFloat(1),
+			expectedReward:     types.NewSatsFromBtcFloat(0.25),
 		},
 		{
 			desc:               "Test with zero available hash power",
-			availableHashPower: 0,
-			actualHashPower:    25,
-			reward:             decimal.NewFromFloat(1),
-			expectedReward:     decimal.Zero,
+			availableHashPower: types.NewHashPowerFromInt(0),
+			actualHashPower:    types.NewHashPowerFromInt(25),
+			reward:             types.NewSatsFromBtcFloat(1),
+			expectedReward:     0,
 		},
 		{
 			desc:               "Test with zero actual hash power",
-			availableHashPower: 100,
-			actualHashPower:    0,
-			reward:             decimal.NewFromFloat(1),
-			expectedReward:     decimal.Zero,
+			availableHashPower: types.NewHashPowerFromInt(100),
+			actualHashPower:    types.NewHashPowerFromInt(0),
+			reward:             types.NewSatsFromBtcFloat(1),
+			expectedReward:     0,
 		},
 		{
 			desc:               "Test with zero reward",
-			availableHashPower: 100,
-			actualHashPower:    25,
-			reward:             decimal.Zero,
-			expectedReward:     decimal.Zero,
+			availableHashPower: types.NewHashPowerFromInt(100),
+			actualHashPower:    types.NewHashPowerFromInt(25),
+			reward:             0,
+			expectedReward:     0,
 		},
 	}
 
@@ -693,7 +693,7 @@ func TestCalculateRewardByPercent(t *testing.T) {
 		t.Run(tC.desc, func(t *testing.T) {
 			calculatedReward := calculateRewardByPercent(tC.availableHashPower, tC.actualHashPower, tC.reward)
 
-			if !calculatedReward.Equal(tC.expectedReward) {
+			if calculatedReward != tC.expectedReward {
 				t.Errorf("Expected reward: %s, got: %s", tC.expectedReward, calculatedReward)
 			}
 		})
@@ -707,8 +707,8 @@ func TestCalculatePercentByTime(t *testing.T) {
 		timestampCurrentPayment int64
 		nftStartTime            int64
 		nftEndTime              int64
-		totalRewardForPeriod    decimal.Decimal
-		expectedReward          decimal.Decimal
+		totalRewardForPeriod    types.Sats
+		expectedReward          types.Sats
 	}{
 		{
 			desc:                    "Test with valid input",
@@ -716,8 +716,8 @@ func TestCalculatePercentByTime(t *testing.T) {
 			timestampCurrentPayment: 2000,
 			nftStartTime:            1000,
 			nftEndTime:              2000,
-			totalRewardForPeriod:    decimal.NewFromFloat(1),
-			expectedReward:          decimal.NewFromFloat(1),
+			totalRewardForPeriod:    types.NewSatsFromBtcFloat(1),
+			expectedReward:          types.NewSatsFromBtcFloat(1),
 		},
 		{
 			desc:                    "Test with NFT only active for half the period",
@@ -725,8 +725,8 @@ func TestCalculatePercentByTime(t *testing.T) {
 			timestampCurrentPayment: 2000,
 			nftStartTime:            1000,
 			nftEndTime:              1500,
-			totalRewardForPeriod:    decimal.NewFromFloat(1),
-			expectedReward:          decimal.NewFromFloat(0.5),
+			totalRewardForPeriod:    types.NewSatsFromBtcFloat(1),
+			expectedReward:          types.NewSatsFromBtcFloat(0.5),
 		},
 		{
 			desc:                    "Test with NFT not active during the period",
@@ -734,8 +734,8 @@ func TestCalculatePercentByTime(t *testing.T) {
 			timestampCurrentPayment: 2000,
 			nftStartTime:            3000,
 			nftEndTime:              4000,
-			totalRewardForPeriod:    decimal.NewFromFloat(1),
-			expectedReward:          decimal.Zero,
+			totalRewardForPeriod:    types.NewSatsFromBtcFloat(1),
+			expectedReward:          0,
 		},
 	}
 
@@ -743,7 +743,7 @@ func TestCalculatePercentByTime(t *testing.T) {
 		t.Run(tC.desc, func(t *testing.T) {
 			calculatedReward := calculatePercentByTime(tC.timestampPrevPayment, tC.timestampCurrentPayment, tC.nftStartTime, tC.nftEndTime, tC.totalRewardForPeriod)
 
-			if !calculatedReward.Equal(tC.expectedReward) {
+			if calculatedReward != tC.expectedReward {
 				t.Errorf("Expected reward: %s, got: %s", tC.expectedReward, calculatedReward)
 			}
 		})
@@ -753,46 +753,46 @@ func TestCalculatePercentByTime(t *testing.T) {
 func TestCalculateLeftoverNftRewardDistribution(t *testing.T) {
 	testCases := []struct {
 		desc               string
-		rewardForNftOwners decimal.Decimal
+		rewardForNftOwners types.Sats
 		statistics         []types.NFTStatistics
-		expectedLeftover   decimal.Decimal
+		expectedLeftover   types.Sats
 		expectedError      error
 	}{
 		{
 			desc:               "Test with valid input",
-			rewardForNftOwners: decimal.NewFromFloat(1),
+			rewardForNftOwners: types.NewSatsFromBtcFloat(1),
 			statistics: []types.NFTStatistics{
 				{
-					Reward:                   decimal.NewFromFloat(0.2),
-					MaintenanceFee:           decimal.NewFromFloat(0.1),
-					CUDOPartOfMaintenanceFee: decimal.NewFromFloat(0.05),
+					Reward:                   types.NewSatsFromBtcFloat(0.2),
+					MaintenanceFee:           types.NewSatsFromBtcFloat(0.1),
+					CUDOPartOfMaintenanceFee: types.NewSatsFromBtcFloat(0.05),
 				},
 				{
-					Reward:                   decimal.NewFromFloat(0.3),
-					MaintenanceFee:           decimal.NewFromFloat(0.2),
-					CUDOPartOfMaintenanceFee: decimal.NewFromFloat(0.1),
+					Reward:                   types.NewSatsFromBtcFloat(0.3),
+					MaintenanceFee:           types.NewSatsFromBtcFloat(0.2),
+					CUDOPartOfMaintenanceFee: types.NewSatsFromBtcFloat(0.1),
 				},
 			},
-			expectedLeftover: decimal.NewFromFloat(0.05),
+			expectedLeftover: types.NewSatsFromBtcFloat(0.05),
 			expectedError:    nil,
 		},
 		{
 			desc:               "Test with distributed rewards exceeding farm reward",
-			rewardForNftOwners: decimal.NewFromFloat(1),
+			rewardForNftOwners: types.NewSatsFromBtcFloat(1),
 			statistics: []types.NFTStatistics{
 				{
-					Reward:                   decimal.NewFromFloat(0.5),
-					MaintenanceFee:           decimal.NewFromFloat(0.3),
-					CUDOPartOfMaintenanceFee: decimal.NewFromFloat(0.1),
+					Reward:                   types.NewSatsFromBtcFloat(0.5),
+					MaintenanceFee:           types.NewSatsFromBtcFloat(0.3),
+					CUDOPartOfMaintenanceFee: types.NewSatsFromBtcFloat(0.1),
 				},
 				{
-					Reward:                   decimal.NewFromFloat(0.6),
-					MaintenanceFee:           decimal.NewFromFloat(0.4),
-					CUDOPartOfMaintenanceFee: decimal.NewFromFloat(0.2),
+					Reward:                   types.NewSatsFromBtcFloat(0.6),
+					MaintenanceFee:           types.NewSatsFromBtcFloat(0.4),
+					CUDOPartOfMaintenanceFee: types.NewSatsFromBtcFloat(0.2),
 				},
 			},
-			expectedLeftover: decimal.Decimal{},
-			expectedError:    fmt.Errorf("distributed NFT awards bigger than farm nft reward. NftRewardDistribution: %s, TotalFarmRewardAfterCudosFee: %s", decimal.NewFromFloat(2.1), decimal.NewFromFloat(1)),
+			expectedLeftover: 0,
+			expectedError:    fmt.Errorf("distributed NFT awards bigger than farm nft reward. NftRewardDistribution: %s, TotalFarmRewardAfterCudosFee: %s", types.NewSatsFromBtcFloat(2.1), types.NewSatsFromBtcFloat(1)),
 		},
 	}
 
@@ -803,7 +803,7 @@ func TestCalculateLeftoverNftRewardDistribution(t *testing.T) {
 				t.Errorf("Expected error: %s, got: %s", tC.expectedError, err)
 			}
 
-			if !leftover.Equal(tC.expectedLeftover) {
+			if leftover != tC.expectedLeftover {
 				t.Errorf("Expected leftover: %s, got: %s", tC.expectedLeftover, leftover)
 			}
 		})
@@ -813,25 +813,25 @@ func TestCalculateLeftoverNftRewardDistribution(t *testing.T) {
 func TestCheckTotalAmountToDistribute(t *testing.T) {
 	testCases := []struct {
 		desc                              string
-		receivedRewardForFarmBtcDecimal   decimal.Decimal
-		destinationAddressesWithAmountBtc map[string]decimal.Decimal
+		receivedRewardForFarm             types.Sats
+		destinationAddressesWithAmountBtc map[string]types.Sats
 		expectedError                     error
 	}{
 		{
-			desc:                            "Equal amounts",
-			receivedRewardForFarmBtcDecimal: decimal.NewFromInt(100),
-			destinationAddressesWithAmountBtc: map[string]decimal.Decimal{
-				"address1": decimal.NewFromInt(50),
-				"address2": decimal.NewFromInt(50),
+			desc:                  "Equal amounts",
+			receivedRewardForFarm: types.NewSatsFromBtcFloat(100),
+			destinationAddressesWithAmountBtc: map[string]types.Sats{
+				"address1": types.NewSatsFromBtcFloat(50),
+				"address2": types.NewSatsFromBtcFloat(50),
 			},
 			expectedError: nil,
 		},
 		{
-			desc:                            "Unequal amounts",
-			receivedRewardForFarmBtcDecimal: decimal.NewFromInt(100),
-			destinationAddressesWithAmountBtc: map[string]decimal.Decimal{
-				"address1": decimal.NewFromInt(40),
-				"address2": decimal.NewFromInt(50),
+			desc:                  "Unequal amounts",
+			receivedRewardForFarm: types.NewSatsFromBtcFloat(100),
+			destinationAddressesWithAmountBtc: map[string]types.Sats{
+				"address1": types.NewSatsFromBtcFloat(40),
+				"address2": types.NewSatsFromBtcFloat(50),
 			},
 			expectedError: fmt.Errorf("distributed amount doesn't equal total farm rewards. Distributed amount: {90}, TotalFarmReward: {100}"),
 		},
@@ -839,7 +839,7 @@ func TestCheckTotalAmountToDistribute(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.desc, func(t *testing.T) {
-			err := checkTotalAmountToDistribute(tc.receivedRewardForFarmBtcDecimal, tc.destinationAddressesWithAmountBtc)
+			err := checkTotalAmountToDistribute(tc.receivedRewardForFarm, tc.destinationAddressesWithAmountBtc)
 
 			if tc.expectedError == nil && err != nil {
 				t.Errorf("Expected no error, got: %v", err)
@@ -899,17 +899,22 @@ func (mar *mockAPIRequester) GetPayoutAddressFromNode(ctx context.Context, cudos
 	return args.String(0), args.Error(1)
 }
 
-func (mar *mockAPIRequester) SendMany(ctx context.Context, destinationAddressesWithAmount map[string]float64) (string, error) {
-	args := mar.Called(ctx, destinationAddressesWithAmount)
+func (mar *mockAPIRequester) SendMany(ctx context.Context, walletName string, destinationAddressesWithAmount map[string]types.Sats, comment string) (string, error) {
+	args := mar.Called(ctx, walletName, destinationAddressesWithAmount, comment)
 	return args.String(0), args.Error(1)
 }
 
-func (mar *mockAPIRequester) BumpFee(ctx context.Context, txId string) (string, error) {
-	args := mar.Called(ctx, txId)
+func (mar *mockAPIRequester) BumpFee(ctx context.Context, walletName, txId string) (string, error) {
+	args := mar.Called(ctx, walletName, txId)
 	return args.String(0), args.Error(1)
 }
 
-func (mar *mockAPIRequester) GetWalletTransaction(ctx context.Context, txId string) (*types.BtcWalletTransaction, error) {
-	args := mar.Called(ctx, txId)
+func (mar *mockAPIRequester) GetWalletTransaction(ctx context.Context, walletName, txId string) (*types.BtcWalletTransaction, error) {
+	args := mar.Called(ctx, walletName, txId)
 	return args.Get(0).(*types.BtcWalletTransaction), args.Error(1)
 }
+
+func (mar *mockAPIRequester) ListWalletTransactions(ctx context.Context, walletName string, count, skip int) ([]types.BtcWalletTransaction, error) {
+	args := mar.Called(ctx, walletName, count, skip)
+	return args.Get(0).([]types.BtcWalletTransaction), args.Error(1)
+}
@@ -0,0 +1,432 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/notifier"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/rs/zerolog/log"
+)
+
+// crossFarmAccruals adds up the amounts accumulated for the nft owners in the other farms, when CROSS_FARM_THRESHOLD is set.
+// Only the shares that are paid at the end of the run count, see isPayableCrossFarmShare.
+type crossFarmAccruals struct {
+	storage        Storage
+	farmId         int64
+	payableFarmIds map[int64]bool
+	minShare       types.Sats
+}
+
+// getCrossFarmAccruals returns nil if the owners reach the payout threshold in every farm separately
+func (s *PayService) getCrossFarmAccruals(ctx context.Context, storage Storage, farm types.Farm) (*crossFarmAccruals, error) {
+	if !s.config.CrossFarmThreshold {
+		return nil, nil
+	}
+
+	payableFarmIds := make(map[int64]bool)
+	for _, payableFarm := range s.getPayableFarms() {
+		payableFarmIds[payableFarm.Id] = true
+	}
+
+	return &crossFarmAccruals{storage: storage, farmId: farm.Id, payableFarmIds: payableFarmIds, minShare: s.crossFarmMinShare()}, nil
+}
+
+// otherFarms returns the amount accumulated in the other farms for the cudos address of the owner and the btc address it is paid to
+func (c *crossFarmAccruals) otherFarms(ctx context.Context, address, payoutAddress string) (types.Sats, error) {
+	amounts, err := getOwnerAmountsByFarm(ctx, c.storage, address, payoutAddress)
+	if err != nil {
+		return 0, err
+	}
+
+	var total types.Sats
+	for farmId, amount := range amounts {
+		if farmId != c.farmId && c.payableFarmIds[farmId] && isPayableCrossFarmShare(amount, c.minShare) {
+			total += amount
+		}
+	}
+
+	return total, nil
+}
+
+// isPayableCrossFarmShare tells if the share of a farm is paid at the end of the run.
+// The shares below CROSS_FARM_MIN_SHARE_IN_BTC are not worth a transaction output and keep accumulating.
+func isPayableCrossFarmShare(amount, minShare types.Sats) bool {
+	return amount > 0 && amount >= minShare
+}
+
+func (s *PayService) crossFarmMinShare() types.Sats {
+	return s.config.CrossFarmMinShareInBTC
+}
+
+// setPayableFarms remembers the farms due in the run. Only these farms pay the shares of the owners at the end of the run,
+// the wallets of the other farms are not used outside of their own runs.
+func (s *PayService) setPayableFarms(farms []types.Farm) {
+	s.crossFarmOwnersMutex.Lock()
+	defer s.crossFarmOwnersMutex.Unlock()
+
+	s.payableFarms = farms
+}
+
+func (s *PayService) getPayableFarms() []types.Farm {
+	s.crossFarmOwnersMutex.Lock()
+	defer s.crossFarmOwnersMutex.Unlock()
+
+	return s.payableFarms
+}
+
+// getOwnerAmountsByFarm returns the amounts accumulated for the addresses of an owner, added up by farm
+func getOwnerAmountsByFarm(ctx context.Context, storage Storage, addresses ...string) (map[int64]types.Sats, error) {
+	amounts := make(map[int64]types.Sats)
+	for _, address := range addresses {
+		thresholdAmounts, err := storage.GetThresholdAmountsByAddress(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, thresholdAmount := range thresholdAmounts {
+			farmId, err := strconv.ParseInt(thresholdAmount.FarmId, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid farm id {%s} of address {%s}: %s", thresholdAmount.FarmId, address, err)
+			}
+
+			amount, err := types.ParseSats(thresholdAmount.AmountBTC)
+			if err != nil {
+				return nil, fmt.Errorf("invalid amount of address {%s} in farm {%d}: %s", address, farmId, err)
+			}
+
+			amounts[farmId] += amount
+		}
+	}
+
+	return amounts, nil
+}
+
+// crossFarmOwner is an owner that reached the payout threshold only with the amounts in all farms.
+// The farms that found it hold their shares until the shares of the other farms are sent at the end of the run.
+type crossFarmOwner struct {
+	payoutAddress string
+	holdingFarms  map[int64]bool
+}
+
+// addCrossFarmOwners remembers the owners held by a farm because of their amounts in all farms,
+// so the shares of all farms are paid at the end of the run
+func (s *PayService) addCrossFarmOwners(farm types.Farm, addressesWithAmountInfo map[string]types.AmountInfo, cudosBtcAddressMap map[string]string) {
+	s.crossFarmOwnersMutex.Lock()
+	defer s.crossFarmOwnersMutex.Unlock()
+
+	for address, payoutAddress := range cudosBtcAddressMap {
+		if !addressesWithAmountInfo[address].CrossFarm {
+			continue
+		}
+
+		if s.crossFarmOwners == nil {
+			s.crossFarmOwners = make(map[string]crossFarmOwner)
+		}
+
+		owner, ok := s.crossFarmOwners[address]
+		if !ok {
+			owner = crossFarmOwner{payoutAddress: payoutAddress, holdingFarms: make(map[int64]bool)}
+		}
+		owner.holdingFarms[farm.Id] = true
+		s.crossFarmOwners[address] = owner
+	}
+}
+
+// takeCrossFarmOwners returns the owners remembered in the run, the next run starts without them
+func (s *PayService) takeCrossFarmOwners() map[string]crossFarmOwner {
+	s.crossFarmOwnersMutex.Lock()
+	defer s.crossFarmOwnersMutex.Unlock()
+
+	owners := s.crossFarmOwners
+	s.crossFarmOwners = nil
+	return owners
+}
+
+/*
+payCrossFarmShares pays the shares of all farms to the owners whose amounts in all farms reached the payout threshold in the run.
+Each share is paid from the wallet of its own farm, with a payout of the accumulated amounts like a sweep.
+The wallets of different farms can not be spent from in a single transaction, so the shares that made the owner reach the threshold
+are sent first and the farms that found the owner pay last, only if the owner still reaches the threshold with what was sent.
+
+ 1. Find the farms due in the run that hold a payable share for any of the owners, the same shares that counted towards the threshold.
+ 2. Pay the shares of each farm, except for the owners the farm holds. In case of an error the error is logged and alerted and the next farm is paid,
+    the shares of the farm keep accumulating and count towards the next time the threshold is reached.
+ 3. Pay the shares held by each farm to the owners whose shares sent in step 2 and held shares still reach the threshold of the farm.
+    The other held shares keep accumulating, so no owner is paid below the threshold from the farm that found it.
+*/
+func (s *PayService) payCrossFarmShares(ctx context.Context, btcClient BtcClient, storage Storage) error {
+	owners := s.takeCrossFarmOwners()
+	if len(owners) == 0 {
+		return nil
+	}
+
+	minShare := s.crossFarmMinShare()
+	farmsWithShares := make(map[int64]bool)
+	for address, owner := range owners {
+		amounts, err := getOwnerAmountsByFarm(ctx, storage, address, owner.payoutAddress)
+		if err != nil {
+			return err
+		}
+
+		for farmId, amount := range amounts {
+			if !owner.holdingFarms[farmId] && isPayableCrossFarmShare(amount, minShare) {
+				farmsWithShares[farmId] = true
+			}
+		}
+	}
+
+	failedFarms := make(map[int64]bool)
+	paidFarms := make(map[int64]bool)
+	sent := make(map[string]types.Sats)
+	for _, farm := range s.getPayableFarms() {
+		if !farmsWithShares[farm.Id] {
+			continue
+		}
+
+		farmOwners := make(map[string]string)
+		for address, owner := range owners {
+			if !owner.holdingFarms[farm.Id] {
+				farmOwners[address] = owner.payoutAddress
+			}
+		}
+
+		paid, err := s.payCrossFarmSharesOfFarm(ctx, btcClient, storage, farm, farmOwners, minShare)
+		if err != nil {
+			s.crossFarmSharesFailed(ctx, farm, err)
+			failedFarms[farm.Id] = true
+			continue
+		}
+
+		paidFarms[farm.Id] = true
+		for address, amount := range paid {
+			sent[address] += amount
+		}
+	}
+
+	for _, farm := range s.getPayableFarms() {
+		farmOwners, err := s.releasedCrossFarmOwners(ctx, storage, farm, owners, sent)
+		if err != nil {
+			s.crossFarmSharesFailed(ctx, farm, err)
+			failedFarms[farm.Id] = true
+			continue
+		}
+
+		if len(farmOwners) == 0 {
+			continue
+		}
+
+		// the held share counted towards the threshold in full, so the minimum share does not apply to it
+		if _, err := s.payCrossFarmSharesOfFarm(ctx, btcClient, storage, farm, farmOwners, 0); err != nil {
+			s.crossFarmSharesFailed(ctx, farm, err)
+			failedFarms[farm.Id] = true
+			continue
+		}
+
+		paidFarms[farm.Id] = true
+	}
+
+	if !s.isDryRun() {
+		for _, farm := range s.getPayableFarms() {
+			if paidFarms[farm.Id] && !failedFarms[farm.Id] {
+				s.alerts.Resolve(ctx, crossFarmAlertSource(farm))
+			}
+		}
+	}
+
+	return nil
+}
+
+// releasedCrossFarmOwners returns the owners held by the farm that still reach its payout threshold
+// with the shares sent by the other farms and the shares held for them in all farms
+func (s *PayService) releasedCrossFarmOwners(ctx context.Context, storage Storage, farm types.Farm, owners map[string]crossFarmOwner, sent map[string]types.Sats) (map[string]string, error) {
+	var thresholds *payoutThresholds
+	released := make(map[string]string)
+	for address, owner := range owners {
+		if !owner.holdingFarms[farm.Id] {
+			continue
+		}
+
+		if thresholds == nil {
+			var err error
+			if thresholds, err = s.getPayoutThresholds(ctx, storage, farm); err != nil {
+				return nil, err
+			}
+		}
+
+		threshold, err := thresholds.resolve(ctx, address, owner.payoutAddress)
+		if err != nil {
+			return nil, err
+		}
+
+		amounts, err := getOwnerAmountsByFarm(ctx, storage, address, owner.payoutAddress)
+		if err != nil {
+			return nil, err
+		}
+
+		total := sent[address]
+		for farmId := range owner.holdingFarms {
+			total += amounts[farmId]
+		}
+
+		if total < threshold {
+			log.Info().Msgf("Shares of {%s} sent in the run and held are {%s}, below the threshold {%s} of farm {%s}, the share of the farm keeps accumulating",
+				address, total, threshold, farm.RewardsFromPoolBtcWalletName)
+			continue
+		}
+
+		released[address] = owner.payoutAddress
+	}
+
+	return released, nil
+}
+
+func (s *PayService) crossFarmSharesFailed(ctx context.Context, farm types.Farm, err error) {
+	msg := fmt.Sprintf("paying the cross-farm shares of farm {%s} failed. Error: %s", farm.RewardsFromPoolBtcWalletName, err)
+	log.Error().Msg(msg)
+
+	if s.isDryRun() {
+		s.withDryRunReport(func(report *DryRunReport) { report.setFarmError(farm.Id, err) })
+		return
+	}
+
+	s.alerts.Fire(ctx, crossFarmAlertSource(farm), notifier.Notification{
+		Severity: notifier.SeverityWarning,
+		Title:    "Paying cross-farm shares failed",
+		Message:  msg,
+		Farm:     farm.RewardsFromPoolBtcWalletName,
+		Error:    err.Error(),
+	})
+}
+
+func crossFarmAlertSource(farm types.Farm) string {
+	return fmt.Sprintf("cross-farm %s", farm.RewardsFromPoolBtcWalletName)
+}
+
+/*
+payCrossFarmSharesOfFarm pays the shares of a single farm:
+
+ 1. Open and load the farm wallet and recover its interrupted payouts, the same way as before processing the farm.
+ 2. Pay the amount accumulated in the farm for each owner, the cudos address and the btc address together, to the btc address.
+    The shares below minShare keep accumulating, they did not count towards the threshold either.
+    The unprocessed UTXOs of the farm are locked while sending, like in the sweep, so the shares are paid even if the farm has them.
+
+Returns the amounts paid to the owners by their cudos addresses.
+*/
+func (s *PayService) payCrossFarmSharesOfFarm(ctx context.Context, btcClient BtcClient, storage Storage, farm types.Farm, owners map[string]string, minShare types.Sats) (map[string]types.Sats, error) {
+	if err := validateFarm(farm); err != nil {
+		return nil, err
+	}
+
+	walletClient, releaseWallet, err := btcClient.OpenWallet(farm.RewardsFromPoolBtcWalletName)
+	if err != nil {
+		return nil, err
+	}
+	defer releaseWallet()
+
+	loaded, err := s.wallets.prepareWallet(ctx, btcClient, walletClient, storage, farm)
+	if err != nil {
+		return nil, err
+	}
+
+	if !loaded {
+		return nil, nil
+	}
+
+	payload, paid, err := s.crossFarmSharesPayload(ctx, storage, farm, owners, minShare)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(payload.AddressesToSendBtc) == 0 {
+		return nil, nil
+	}
+
+	txHash, err := s.wallets.payAccumulatedAmounts(ctx, walletClient, storage, farm, "cross-farm", payload)
+	if err != nil {
+		return nil, err
+	}
+
+	s.withDryRunReport(func(report *DryRunReport) {
+		report.addPayment(farm.Id, PaymentDryRunReport{
+			PeriodEnd:             payload.PaymentTimestamp,
+			Destinations:          newDestinationsDryRunReport(payload.AddressesWithAmountInfo),
+			AccumulatedAmountsBtc: payload.AddressesWithThresholdToUpdateBtc,
+			SendManyOutputs:       payload.AddressesToSendBtc,
+		})
+	})
+
+	log.Info().Msgf("Paid the cross-farm shares of %d addresses from farm {%s} with tx {%s}", len(payload.AddressesToSendBtc), farm.RewardsFromPoolBtcWalletName, txHash)
+	return paid, nil
+}
+
+func (s *PayService) crossFarmSharesPayload(ctx context.Context, storage Storage, farm types.Farm, owners map[string]string, minShare types.Sats) (types.PayoutIntentPayload, map[string]types.Sats, error) {
+	payload := types.PayoutIntentPayload{
+		FarmSubAccountName:                farm.RewardsFromPoolBtcWalletName,
+		PaymentTimestamp:                  s.helper.Unix(),
+		AddressesToSendBtc:                make(map[string]types.Sats),
+		AddressesWithAmountInfo:           make(map[string]types.AmountInfo),
+		AddressesWithThresholdToUpdateBtc: make(map[string]types.Sats),
+		Sweep:                             true,
+	}
+	paid := make(map[string]types.Sats)
+
+	// the same btc address can be mapped to several cudos addresses, each of them is added once
+	addresses := make([]string, 0, len(owners))
+	for address := range owners {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+
+	for _, address := range addresses {
+		payoutAddress := owners[address]
+
+		var amount types.Sats
+		paidAddresses := []string{}
+		for _, ownerAddress := range []string{address, payoutAddress} {
+			if _, paid := payload.AddressesWithThresholdToUpdateBtc[ownerAddress]; paid {
+				continue
+			}
+
+			ownerAmount, err := s.getAccumulatedAmount(ctx, storage, ownerAddress, farm.Id)
+			if err != nil {
+				return types.PayoutIntentPayload{}, nil, err
+			}
+
+			if ownerAmount > 0 {
+				amount += ownerAmount
+				paidAddresses = append(paidAddresses, ownerAddress)
+			}
+		}
+
+		if amount == 0 {
+			continue
+		}
+
+		if !isPayableCrossFarmShare(amount, minShare) {
+			log.Debug().Msgf("Cross-farm share {%s} of {%s} in farm {%s} is below the minimum share, it is not paid", amount, address, farm.RewardsFromPoolBtcWalletName)
+			continue
+		}
+
+		for _, paidAddress := range paidAddresses {
+			payload.AddressesWithThresholdToUpdateBtc[paidAddress] = 0
+		}
+		paid[address] = amount
+		payload.AddressesToSendBtc[payoutAddress] += amount
+		payload.AddressesWithAmountInfo[payoutAddress] = types.AmountInfo{Amount: payload.AddressesToSendBtc[payoutAddress], ThresholdReached: true, CrossFarm: true}
+	}
+
+	return payload, paid, nil
+}
+
+// getAccumulatedAmount returns 0 for the addresses without an amount in the farm
+func (s *PayService) getAccumulatedAmount(ctx context.Context, storage Storage, address string, farmId int64) (types.Sats, error) {
+	amount, err := storage.GetCurrentAcummulatedAmountForAddress(ctx, address, farmId)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	return amount, nil
+}
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newCrossFarmTestConfig() *infrastructure.Config {
+	return &infrastructure.Config{Network: "cudos-network", GlobalPayoutThresholdInBTC: 100000, CrossFarmThreshold: true, CrossFarmMinShareInBTC: 1000}
+}
+
+func TestFilterByPaymentThreshold_CrossFarm(t *testing.T) {
+	storage := &mockStorage{}
+	storage.On("GetFarmPayoutThreshold", mock.Anything, int64(1)).Return(types.FarmPayoutThreshold{}, sql.ErrNoRows)
+	storage.On("GetAddressPayoutThreshold", mock.Anything, mock.Anything).Return(types.AddressPayoutThreshold{}, sql.ErrNoRows)
+	storage.On("GetCurrentAcummulatedAmountForAddress", mock.Anything, "cudos1owner", int64(1)).Return(types.Sats(10000), nil)
+	storage.On("GetCurrentAcummulatedAmountForAddress", mock.Anything, "btc_owner_address", int64(1)).Return(types.Sats(0), sql.ErrNoRows)
+	storage.On("GetCurrentAcummulatedAmountForAddress", mock.Anything, "cudos1small", int64(1)).Return(types.Sats(0), nil)
+	storage.On("GetCurrentAcummulatedAmountForAddress", mock.Anything, "btc_small_address", int64(1)).Return(types.Sats(0), sql.ErrNoRows)
+	storage.On("GetCurrentAcummulatedAmountForAddress", mock.Anything, "cudos1near", int64(1)).Return(types.Sats(0), nil)
+	storage.On("GetCurrentAcummulatedAmountForAddress", mock.Anything, "btc_near_address", int64(1)).Return(types.Sats(0), sql.ErrNoRows)
+	// the amount of farm 3 does not count, it is not due in the run, so its share could not be paid
+	storage.On("GetThresholdAmountsByAddress", mock.Anything, "cudos1owner").Return([]types.AddressThresholdAmountByFarm{
+		{BTCAddress: "cudos1owner", FarmId: "1", AmountBTC: "0.0001"},
+		{BTCAddress: "cudos1owner", FarmId: "2", AmountBTC: "0.0005"},
+		{BTCAddress: "cudos1owner", FarmId: "3", AmountBTC: "0.005"},
+	}, nil)
+	storage.On("GetThresholdAmountsByAddress", mock.Anything, "btc_owner_address").Return([]types.AddressThresholdAmountByFarm{
+		{BTCAddress: "btc_owner_address", FarmId: "2", AmountBTC: "0.0003"},
+	}, nil)
+	storage.On("GetThresholdAmountsByAddress", mock.Anything, "cudos1small").Return([]types.AddressThresholdAmountByFarm{
+		{BTCAddress: "cudos1small", FarmId: "3", AmountBTC: "0.01"},
+	}, nil)
+	storage.On("GetThresholdAmountsByAddress", mock.Anything, "btc_small_address").Return([]types.AddressThresholdAmountByFarm{}, nil)
+	// the share of farm 4 is below the minimum share, so it is not paid and does not count either
+	storage.On("GetThresholdAmountsByAddress", mock.Anything, "cudos1near").Return([]types.AddressThresholdAmountByFarm{
+		{BTCAddress: "cudos1near", FarmId: "4", AmountBTC: "0.000008"},
+	}, nil)
+	storage.On("GetThresholdAmountsByAddress", mock.Anything, "btc_near_address").Return([]types.AddressThresholdAmountByFarm{}, nil)
+
+	apiRequester := &mockAPIRequester{}
+	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "cudos1owner", "cudos-network").Return("btc_owner_address", nil)
+	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "cudos1small", "cudos-network").Return("btc_small_address", nil)
+	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "cudos1near", "cudos-network").Return("btc_near_address", nil)
+
+	payService := NewPayService(newCrossFarmTestConfig(), apiRequester, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
+	payService.setPayableFarms([]types.Farm{{Id: 1}, {Id: 2}, {Id: 4}})
+	thresholdsToUpdate, addressesToSend, _, err := payService.filterByPaymentThreshold(context.Background(), map[string]types.Sats{
+		"cudos1owner": 20000,
+		"cudos1small": 10000,
+		"cudos1near":  99500,
+	}, storage, types.Farm{Id: 1})
+	require.NoError(t, err)
+
+	// 0.0003 in this farm and 0.0008 in farm 2 reach the threshold of 0.001 together, the farm holds its share until farm 2 sends its own
+	require.Equal(t, map[string]types.AmountInfo{
+		"cudos1owner": {Amount: 30000, ThresholdReached: false, CrossFarm: true},
+		"cudos1small": {Amount: 10000, ThresholdReached: false},
+		"cudos1near":  {Amount: 99500, ThresholdReached: false},
+	}, addressesToSend)
+	require.Equal(t, map[string]types.Sats{
+		"btc_owner_address": 0,
+		"cudos1owner":       30000,
+		"btc_small_address": 0,
+		"cudos1small":       10000,
+		"btc_near_address":  0,
+		"cudos1near":        99500,
+	}, thresholdsToUpdate)
+}
+
+func TestPayCrossFarmShares(t *testing.T) {
+	otherFarm := newSweepTestFarm()
+	otherFarm.Id = 2
+	otherFarm.RewardsFromPoolBtcWalletName = "farm_2"
+	dustFarm := newSweepTestFarm()
+	dustFarm.Id = 3
+	dustFarm.RewardsFromPoolBtcWalletName = "farm_3"
+
+	storage := newCrossFarmSharesTestStorage()
+	storage.On("MarkPayoutIntentSent", mock.Anything, mock.Anything, "cross_farm_tx_hash").Return(nil)
+	storage.On("MarkPayoutIntentSent", mock.Anything, mock.Anything, "held_tx_hash").Return(nil)
+	storage.On("UpdateThresholdStatus", mock.Anything, mock.Anything, int64(1666641078), map[string]types.Sats{
+		"cudos1owner":       0,
+		"btc_owner_address": 0,
+	}, int64(2)).Return(nil)
+	storage.On("SaveStatistics", mock.Anything, types.Sats(0), mock.Anything, map[string]types.AmountInfo{
+		"btc_owner_address": {Amount: 80000, ThresholdReached: true, CrossFarm: true},
+	}, mock.Anything, "cross_farm_tx_hash", int64(2), "farm_2").Return(nil)
+	storage.On("UpdateThresholdStatus", mock.Anything, mock.Anything, int64(1666641078), map[string]types.Sats{
+		"cudos1owner": 0,
+	}, int64(1)).Return(nil)
+	storage.On("SaveStatistics", mock.Anything, types.Sats(0), mock.Anything, map[string]types.AmountInfo{
+		"btc_owner_address": {Amount: 30000, ThresholdReached: true, CrossFarm: true},
+	}, mock.Anything, "held_tx_hash", int64(1), "farm_1").Return(nil)
+
+	apiRequester := &mockAPIRequester{}
+	apiRequester.On("SendMany", mock.Anything, "farm_2", map[string]types.Sats{"btc_owner_address": 80000}, mock.Anything).Return("cross_farm_tx_hash", nil)
+	apiRequester.On("SendMany", mock.Anything, "farm_1", map[string]types.Sats{"btc_owner_address": 30000}, mock.Anything).Return("held_tx_hash", nil)
+
+	btcClient := newCrossFarmSharesTestBtcClient()
+
+	alerts := &mockAlerter{}
+	payService := NewPayService(newCrossFarmTestConfig(), apiRequester, &mockHelper{}, alerts, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
+	payService.setPayableFarms([]types.Farm{newSweepTestFarm(), otherFarm, dustFarm})
+	// only the owner that reached the threshold with the amounts of all farms is held by farm 1 and paid at the end of the run
+	payService.addCrossFarmOwners(newSweepTestFarm(), map[string]types.AmountInfo{
+		"cudos1owner":       {Amount: 30000, ThresholdReached: false, CrossFarm: true},
+		"btc_other_address": {Amount: 200000, ThresholdReached: true},
+	}, map[string]string{
+		"cudos1owner": "btc_owner_address",
+		"cudos1other": "btc_other_address",
+	})
+
+	require.NoError(t, payService.payCrossFarmShares(context.Background(), btcClient, storage))
+
+	storage.AssertExpectations(t)
+	apiRequester.AssertExpectations(t)
+	storage.AssertNotCalled(t, "GetThresholdAmountsByAddress", mock.Anything, "cudos1other")
+	storage.AssertNotCalled(t, "GetUnfinishedPayoutIntents", mock.Anything, int64(3))
+	require.Contains(t, btcClient.rawRequests, `lockunspent [false,[{"txid":"utxo","vout":0}]]`)
+	require.Empty(t, alerts.fired)
+	require.Equal(t, []string{"cross-farm farm_1", "cross-farm farm_2"}, alerts.resolved)
+	require.Nil(t, payService.takeCrossFarmOwners(), "the owners are paid once")
+
+	// the share held by farm 1 is sent only after the share of farm 2
+	var sentFrom []string
+	for _, call := range apiRequester.Calls {
+		if call.Method == "SendMany" {
+			sentFrom = append(sentFrom, call.Arguments.String(1))
+		}
+	}
+	require.Equal(t, []string{"farm_2", "farm_1"}, sentFrom)
+
+	var intentFarmIds []int64
+	for _, call := range storage.Calls {
+		if call.Method == "SavePayoutIntent" {
+			intent := call.Arguments.Get(1).(types.PayoutIntent)
+			require.True(t, intent.Payload.Sweep)
+			require.Equal(t, intent.IdempotencyKey, intent.UTXOTxHash)
+			intentFarmIds = append(intentFarmIds, intent.FarmId)
+		}
+	}
+	require.Equal(t, []int64{2, 1}, intentFarmIds)
+}
+
+func TestPayCrossFarmShares_OtherFarmFails(t *testing.T) {
+	otherFarm := newSweepTestFarm()
+	otherFarm.Id = 2
+	otherFarm.RewardsFromPoolBtcWalletName = "farm_2"
+
+	storage := newCrossFarmSharesTestStorage()
+
+	apiRequester := &mockAPIRequester{}
+	apiRequester.On("SendMany", mock.Anything, "farm_2", mock.Anything, mock.Anything).Return("", errors.New("failed to send"))
+
+	alerts := &mockAlerter{}
+	payService := NewPayService(newCrossFarmTestConfig(), apiRequester, &mockHelper{}, alerts, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
+	payService.setPayableFarms([]types.Farm{newSweepTestFarm(), otherFarm})
+	payService.addCrossFarmOwners(newSweepTestFarm(), map[string]types.AmountInfo{
+		"cudos1owner": {Amount: 30000, ThresholdReached: false, CrossFarm: true},
+	}, map[string]string{
+		"cudos1owner": "btc_owner_address",
+	})
+
+	require.NoError(t, payService.payCrossFarmShares(context.Background(), newCrossFarmSharesTestBtcClient(), storage))
+
+	// the owner is below the threshold without the share of farm 2, so farm 1 keeps its share accumulating
+	apiRequester.AssertNumberOfCalls(t, "SendMany", 1)
+	apiRequester.AssertNotCalled(t, "SendMany", mock.Anything, "farm_1", mock.Anything, mock.Anything)
+	storage.AssertNotCalled(t, "UpdateThresholdStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	storage.AssertNotCalled(t, "SaveStatistics", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	require.Len(t, alerts.fired["cross-farm farm_2"], 1)
+	require.Empty(t, alerts.resolved)
+}
+
+// farm 1 holds 0.0003 of the owner, farm 2 has 0.0008 to send and the share of farm 3 is below the minimum share
+func newCrossFarmSharesTestStorage() *mockStorage {
+	storage := &mockStorage{}
+	storage.On("GetThresholdAmountsByAddress", mock.Anything, "cudos1owner").Return([]types.AddressThresholdAmountByFarm{
+		{BTCAddress: "cudos1owner", FarmId: "1", AmountBTC: "0.0003"},
+		{BTCAddress: "cudos1owner", FarmId: "2", AmountBTC: "0.0005"},
+		{BTCAddress: "cudos1owner", FarmId: "3", AmountBTC: "0.000008"},
+	}, nil)
+	storage.On("GetThresholdAmountsByAddress", mock.Anything, "btc_owner_address").Return([]types.AddressThresholdAmountByFarm{
+		{BTCAddress: "btc_owner_address", FarmId: "2", AmountBTC: "0.0003"},
+	}, nil)
+	storage.On("GetFarmPayoutThreshold", mock.Anything, int64(1)).Return(types.FarmPayoutThreshold{}, sql.ErrNoRows)
+	storage.On("GetAddressPayoutThreshold", mock.Anything, mock.Anything).Return(types.AddressPayoutThreshold{}, sql.ErrNoRows)
+	storage.On("GetUnfinishedPayoutIntents", mock.Anything, int64(1)).Return([]types.PayoutIntent{}, nil)
+	storage.On("GetUnfinishedPayoutIntents", mock.Anything, int64(2)).Return([]types.PayoutIntent{}, nil)
+	storage.On("GetUTXOTransaction", mock.Anything, "utxo").Return(types.UTXOTransaction{Processed: false}, nil)
+	storage.On("GetCurrentAcummulatedAmountForAddress", mock.Anything, "cudos1owner", int64(1)).Return(types.Sats(30000), nil)
+	storage.On("GetCurrentAcummulatedAmountForAddress", mock.Anything, "btc_owner_address", int64(1)).Return(types.Sats(0), sql.ErrNoRows)
+	storage.On("GetCurrentAcummulatedAmountForAddress", mock.Anything, "cudos1owner", int64(2)).Return(types.Sats(50000), nil)
+	storage.On("GetCurrentAcummulatedAmountForAddress", mock.Anything, "btc_owner_address", int64(2)).Return(types.Sats(30000), nil)
+	storage.On("SavePayoutIntent", mock.Anything, mock.Anything).Return(nil)
+	return storage
+}
+
+// the unprocessed UTXO of the farms is locked while the shares are paid
+func newCrossFarmSharesTestBtcClient() *mockBtcClient {
+	btcClient := &mockBtcClient{}
+	btcClient.On("RawRequest").Return(json.RawMessage(`["farm_1","farm_2"]`), nil)
+	btcClient.On("ListUnspent").Return([]types.UnspentTx{{TxID: "utxo", Amount: 100000000, Address: "address_for_receiving_reward_from_pool_1"}}, nil)
+	btcClient.On("GetBalance").Return(btcutil.Amount(100080000), nil)
+	btcClient.On("WalletPassphrase", "passphrase-farm_1", int64(60)).Return(nil)
+	btcClient.On("WalletPassphrase", "passphrase-farm_2", int64(60)).Return(nil)
+	btcClient.On("WalletLock").Return(nil)
+	return btcClient
+}
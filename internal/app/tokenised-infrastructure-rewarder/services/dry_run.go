@@ -0,0 +1,451 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/shopspring/decimal"
+)
+
+// DryRunReport contains everything a pay run would have done without actually doing it.
+type DryRunReport struct {
+	Farms []FarmDryRunReport `json:"farms"`
+}
+
+type FarmDryRunReport struct {
+	FarmId   int64                 `json:"farm_id"`
+	FarmName string                `json:"farm_name"`
+	Paused   bool                  `json:"paused,omitempty"`
+	Error    string                `json:"error,omitempty"`
+	Payments []PaymentDryRunReport `json:"payments"`
+}
+
+type PaymentDryRunReport struct {
+	UnspentTxId                  string                              `json:"unspent_tx_id"`
+	PeriodEnd                    int64                               `json:"period_end"`
+	ReceivedRewardBtc            types.Sats                          `json:"received_reward_btc"`
+	RewardForNftOwnersBtc        types.Sats                          `json:"reward_for_nft_owners_btc"`
+	Destinations                 []DestinationDryRunReport           `json:"destinations"`
+	AccumulatedAmountsBtc        map[string]types.Sats               `json:"accumulated_amounts_btc"`
+	SendManyOutputs              map[string]types.Sats               `json:"send_many_outputs"`
+	NftStatistics                []types.NFTStatistics               `json:"nft_statistics"`
+	CollectionPaymentAllocations []types.CollectionPaymentAllocation `json:"collection_payment_allocations"`
+}
+
+// DestinationDryRunReport is the threshold decision for a single destination address.
+type DestinationDryRunReport struct {
+	Address          string     `json:"address"`
+	AmountBtc        types.Sats `json:"amount_btc"`
+	ThresholdReached bool       `json:"threshold_reached"`
+	CrossFarm        bool       `json:"cross_farm"`
+}
+
+/*
+DryRun runs the whole pay pipeline for all approved farms without touching any funds or persisted state.
+
+ 1. A copy of the service is created in dry run mode, so the state of the real service is not changed.
+ 2. Storage is wrapped so every write is kept in memory only. Reads see these writes,
+    so a farm with several unspent transactions is calculated the same way as in a real run.
+ 3. Wallets are never unlocked, SendMany is never called and no emails are sent.
+ 4. The report contains every destination address, amount, threshold decision and the statistics that would have been saved.
+*/
+func (s *PayService) DryRun(ctx context.Context, btcClient BtcClient, storage Storage) (DryRunReport, error) {
+	return s.DryRunFarm(ctx, btcClient, storage, "")
+}
+
+// DryRunFarm is DryRun limited to a single farm, given by its id, name or wallet name. Without farm all farms are processed.
+func (s *PayService) DryRunFarm(ctx context.Context, btcClient BtcClient, storage Storage, farm string) (DryRunReport, error) {
+	dryRunWallets := newFarmWallets(s.config, s.apiRequester, s.helper, s.secretProvider, nil)
+	dryRunWallets.dryRun = true
+
+	dryRunService := &PayService{
+		config:           s.config,
+		helper:           s.helper,
+		btcNetworkParams: s.btcNetworkParams,
+		apiRequester:     s.apiRequester,
+		wallets:          dryRunWallets,
+		farmStatuses:     make(map[int64]FarmStatus),
+		dryRunReport:     &DryRunReport{Farms: []FarmDryRunReport{}},
+	}
+
+	dryRunStorage := newDryRunStorage(storage)
+	dryRunStorage.farm = farm
+
+	if err := dryRunService.Execute(ctx, btcClient, dryRunStorage); err != nil {
+		return DryRunReport{}, err
+	}
+
+	return *dryRunService.dryRunReport, nil
+}
+
+func (s *PayService) isDryRun() bool {
+	return s.dryRunReport != nil
+}
+
+// withDryRunReport updates the report in dry run. Farms are processed concurrently, so the updates are serialized.
+func (s *PayService) withDryRunReport(update func(report *DryRunReport)) {
+	if !s.isDryRun() {
+		return
+	}
+
+	s.dryRunReportMutex.Lock()
+	defer s.dryRunReportMutex.Unlock()
+
+	update(s.dryRunReport)
+}
+
+func (r *DryRunReport) addFarm(farm types.Farm) {
+	r.Farms = append(r.Farms, FarmDryRunReport{
+		FarmId:   farm.Id,
+		FarmName: farm.RewardsFromPoolBtcWalletName,
+		Payments: []PaymentDryRunReport{},
+	})
+}
+
+func (r *DryRunReport) farm(farmId int64) *FarmDryRunReport {
+	for i := range r.Farms {
+		if r.Farms[i].FarmId == farmId {
+			return &r.Farms[i]
+		}
+	}
+
+	return nil
+}
+
+func (r *DryRunReport) setFarmPaused(farmId int64) {
+	if farm := r.farm(farmId); farm != nil {
+		farm.Paused = true
+	}
+}
+
+func (r *DryRunReport) setFarmError(farmId int64, err error) {
+	if farm := r.farm(farmId); farm != nil {
+		farm.Error = err.Error()
+	}
+}
+
+func (r *DryRunReport) addPayment(farmId int64, payment PaymentDryRunReport) {
+	if farm := r.farm(farmId); farm != nil {
+		farm.Payments = append(farm.Payments, payment)
+	}
+}
+
+func newDestinationsDryRunReport(addressesWithAmountInfo map[string]types.AmountInfo) []DestinationDryRunReport {
+	destinations := []DestinationDryRunReport{}
+	for address, amountInfo := range addressesWithAmountInfo {
+		destinations = append(destinations, DestinationDryRunReport{
+			Address:          address,
+			AmountBtc:        amountInfo.Amount,
+			ThresholdReached: amountInfo.ThresholdReached,
+			CrossFarm:        amountInfo.CrossFarm,
+		})
+	}
+
+	return destinations
+}
+
+// dryRunStorage is a Storage that keeps all writes in memory and serves them back on reads.
+// Everything that is not written during the run is read from the underlying storage.
+// Farms are processed concurrently, so the in memory state is guarded by a mutex.
+type dryRunStorage struct {
+	storage            Storage
+	mutex              sync.Mutex
+	accumulatedAmounts map[string]types.Sats
+	utxoTransactions   map[string]types.UTXOTransaction
+	lastUTXOByFarmId   map[int64]types.UTXOTransaction
+	nftPayoutTimes     map[string][]types.NFTStatistics
+	finishedIntents    map[string]bool
+	// farm limits the run to a single farm, see DryRunFarm
+	farm string
+}
+
+func newDryRunStorage(storage Storage) *dryRunStorage {
+	return &dryRunStorage{
+		storage:            storage,
+		accumulatedAmounts: make(map[string]types.Sats),
+		utxoTransactions:   make(map[string]types.UTXOTransaction),
+		lastUTXOByFarmId:   make(map[int64]types.UTXOTransaction),
+		nftPayoutTimes:     make(map[string][]types.NFTStatistics),
+		finishedIntents:    make(map[string]bool),
+	}
+}
+
+func accumulatedAmountKey(address string, farmId int64) string {
+	return fmt.Sprintf("%d/%s", farmId, address)
+}
+
+func nftKey(denomId, nftId string) string {
+	return fmt.Sprintf("%s/%s", denomId, nftId)
+}
+
+func (ds *dryRunStorage) GetApprovedFarms(ctx context.Context) ([]types.Farm, error) {
+	farms, err := ds.storage.GetApprovedFarms(ctx)
+	if err != nil || ds.farm == "" {
+		return farms, err
+	}
+
+	for _, farm := range farms {
+		if strconv.FormatInt(farm.Id, 10) == ds.farm || farm.Name == ds.farm || farm.RewardsFromPoolBtcWalletName == ds.farm {
+			return []types.Farm{farm}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no approved farm {%s} found", ds.farm)
+}
+
+func (ds *dryRunStorage) GetPayoutTimesForNFT(ctx context.Context, collectionDenomId, nftId string) ([]types.NFTStatistics, error) {
+	payoutTimes, err := ds.storage.GetPayoutTimesForNFT(ctx, collectionDenomId, nftId)
+	if err != nil {
+		return nil, err
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	return append(payoutTimes, ds.nftPayoutTimes[nftKey(collectionDenomId, nftId)]...), nil
+}
+
+func (ds *dryRunStorage) SaveStatistics(ctx context.Context, receivedRewardForFarm types.Sats, collectionPaymentAllocationsStatistics []types.CollectionPaymentAllocation, destinationAddressesWithAmount map[string]types.AmountInfo, statistics []types.NFTStatistics, txHash string, farmId int64, farmSubAccountName string) error {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	for _, nftStatistics := range statistics {
+		key := nftKey(nftStatistics.DenomId, nftStatistics.TokenId)
+		ds.nftPayoutTimes[key] = append(ds.nftPayoutTimes[key], nftStatistics)
+	}
+
+	return nil
+}
+
+func (ds *dryRunStorage) GetTxHashesByStatus(ctx context.Context, status string) ([]types.TransactionHashWithStatus, error) {
+	return ds.storage.GetTxHashesByStatus(ctx, status)
+}
+
+func (ds *dryRunStorage) UpdateTransactionsStatus(ctx context.Context, txHashesToMarkCompleted []string, status string) error {
+	return fmt.Errorf("updating transaction statuses is not allowed in dry run")
+}
+
+func (ds *dryRunStorage) CompleteTransactions(ctx context.Context, networkFees []types.NetworkFee) error {
+	return fmt.Errorf("completing transactions is not allowed in dry run")
+}
+
+func (ds *dryRunStorage) SaveTxHashWithStatus(ctx context.Context, txHash, status, farmSubAccountName string, farmPaymentId int64, retryCount int) error {
+	return fmt.Errorf("saving transaction hashes is not allowed in dry run")
+}
+
+func (ds *dryRunStorage) SaveRBFTransactionInformation(ctx context.Context, oldTxHash, oldTxStatus, newRBFTxHash, newRBFTXStatus, farmSubAccountName string, farmPaymentId int64, retryCount int) error {
+	return fmt.Errorf("saving RBF transactions is not allowed in dry run")
+}
+
+func (ds *dryRunStorage) GetUTXOTransaction(ctx context.Context, txId string) (types.UTXOTransaction, error) {
+	ds.mutex.Lock()
+	utxo, ok := ds.utxoTransactions[txId]
+	ds.mutex.Unlock()
+	if ok {
+		return utxo, nil
+	}
+
+	return ds.storage.GetUTXOTransaction(ctx, txId)
+}
+
+func (ds *dryRunStorage) GetLastUTXOTransactionByFarmId(ctx context.Context, farmId int64) (types.UTXOTransaction, error) {
+	ds.mutex.Lock()
+	utxo, ok := ds.lastUTXOByFarmId[farmId]
+	ds.mutex.Unlock()
+	if ok {
+		return utxo, nil
+	}
+
+	return ds.storage.GetLastUTXOTransactionByFarmId(ctx, farmId)
+}
+
+func (ds *dryRunStorage) GetCurrentAcummulatedAmountForAddress(ctx context.Context, key string, farmId int64) (types.Sats, error) {
+	ds.mutex.Lock()
+	amount, ok := ds.accumulatedAmounts[accumulatedAmountKey(key, farmId)]
+	ds.mutex.Unlock()
+	if ok {
+		return amount, nil
+	}
+
+	return ds.storage.GetCurrentAcummulatedAmountForAddress(ctx, key, farmId)
+}
+
+func (ds *dryRunStorage) UpdateThresholdStatus(ctx context.Context, processedTransactions string, paymentTimestamp int64, addressesWithThresholdToUpdate map[string]types.Sats, farmId int64) error {
+	utxo := types.UTXOTransaction{
+		FarmId:           fmt.Sprint(farmId),
+		TxHash:           processedTransactions,
+		PaymentTimestamp: paymentTimestamp,
+		Processed:        true,
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	ds.utxoTransactions[processedTransactions] = utxo
+	ds.lastUTXOByFarmId[farmId] = utxo
+
+	for address, amount := range addressesWithThresholdToUpdate {
+		ds.accumulatedAmounts[accumulatedAmountKey(address, farmId)] = amount
+	}
+
+	return nil
+}
+
+func (ds *dryRunStorage) SetInitialAccumulatedAmountForAddress(ctx context.Context, address string, farmId int64, amount int) error {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	ds.accumulatedAmounts[accumulatedAmountKey(address, farmId)] = types.NewSatsFromBtc(decimal.NewFromInt(int64(amount)))
+	return nil
+}
+
+func (ds *dryRunStorage) GetFarmAuraPoolCollections(ctx context.Context, farmId int64) ([]types.AuraPoolCollection, error) {
+	return ds.storage.GetFarmAuraPoolCollections(ctx, farmId)
+}
+
+func (ds *dryRunStorage) SavePayoutIntent(ctx context.Context, intent types.PayoutIntent) error {
+	return nil
+}
+
+func (ds *dryRunStorage) MarkPayoutIntentSent(ctx context.Context, idempotencyKey, txHash string) error {
+	return nil
+}
+
+func (ds *dryRunStorage) FinalizePayoutIntent(ctx context.Context, intent types.PayoutIntent, txHash string) error {
+	payload := intent.Payload
+	if err := ds.UpdateThresholdStatus(ctx, intent.UTXOTxHash, payload.PaymentTimestamp, payload.AddressesWithThresholdToUpdateBtc, intent.FarmId); err != nil {
+		return err
+	}
+
+	if err := ds.SaveStatistics(ctx, payload.ReceivedRewardBtc, payload.CollectionPaymentAllocations, payload.AddressesWithAmountInfo,
+		payload.NftStatistics, txHash, intent.FarmId, payload.FarmSubAccountName); err != nil {
+		return err
+	}
+
+	ds.mutex.Lock()
+	ds.finishedIntents[intent.IdempotencyKey] = true
+	ds.mutex.Unlock()
+
+	return nil
+}
+
+func (ds *dryRunStorage) RollbackPayoutIntent(ctx context.Context, idempotencyKey string) error {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	ds.finishedIntents[idempotencyKey] = true
+	return nil
+}
+
+func (ds *dryRunStorage) GetUnfinishedPayoutIntents(ctx context.Context, farmId int64) ([]types.PayoutIntent, error) {
+	intents, err := ds.storage.GetUnfinishedPayoutIntents(ctx, farmId)
+	if err != nil {
+		return nil, err
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	unfinishedIntents := []types.PayoutIntent{}
+	for _, intent := range intents {
+		if !ds.finishedIntents[intent.IdempotencyKey] {
+			unfinishedIntents = append(unfinishedIntents, intent)
+		}
+	}
+
+	return unfinishedIntents, nil
+}
+
+func (ds *dryRunStorage) GetPausedFarmIds(ctx context.Context) ([]int64, error) {
+	return ds.storage.GetPausedFarmIds(ctx)
+}
+
+func (ds *dryRunStorage) GetFarmSchedules(ctx context.Context) ([]types.FarmSchedule, error) {
+	return ds.storage.GetFarmSchedules(ctx)
+}
+
+// SaveFarmLastRun does nothing, the dry run does not move the schedules of the farms
+func (ds *dryRunStorage) SaveFarmLastRun(ctx context.Context, farmId int64, lastRunAt time.Time) error {
+	return nil
+}
+
+func (ds *dryRunStorage) GetFarmPayoutThreshold(ctx context.Context, farmId int64) (types.FarmPayoutThreshold, error) {
+	return ds.storage.GetFarmPayoutThreshold(ctx, farmId)
+}
+
+func (ds *dryRunStorage) GetAddressPayoutThreshold(ctx context.Context, address string) (types.AddressPayoutThreshold, error) {
+	return ds.storage.GetAddressPayoutThreshold(ctx, address)
+}
+
+func (ds *dryRunStorage) GetAccruingAmountsByFarm(ctx context.Context, farmId int64) ([]types.AddressThresholdAmountByFarm, error) {
+	return ds.storage.GetAccruingAmountsByFarm(ctx, farmId)
+}
+
+func (ds *dryRunStorage) GetCudosAddressAccruals(ctx context.Context) ([]types.AddressThresholdAmountByFarm, error) {
+	return ds.storage.GetCudosAddressAccruals(ctx)
+}
+
+// GetThresholdAmountsByAddress returns the amounts of the address with the ones accumulated in memory
+func (ds *dryRunStorage) GetThresholdAmountsByAddress(ctx context.Context, address string) ([]types.AddressThresholdAmountByFarm, error) {
+	thresholdAmounts, err := ds.storage.GetThresholdAmountsByAddress(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	inStorage := make(map[string]bool)
+	for i, thresholdAmount := range thresholdAmounts {
+		key := fmt.Sprintf("%s/%s", thresholdAmount.FarmId, address)
+		inStorage[key] = true
+		if amount, ok := ds.accumulatedAmounts[key]; ok {
+			thresholdAmounts[i].AmountBTC = amount.String()
+		}
+	}
+
+	for key, amount := range ds.accumulatedAmounts {
+		farmId, keyAddress, _ := strings.Cut(key, "/")
+		if keyAddress == address && !inStorage[key] {
+			thresholdAmounts = append(thresholdAmounts, types.AddressThresholdAmountByFarm{BTCAddress: address, FarmId: farmId, AmountBTC: amount.String()})
+		}
+	}
+
+	return thresholdAmounts, nil
+}
+
+// MoveAccumulatedAmount moves the amount in memory, like the other accumulated amounts of the dry run
+func (ds *dryRunStorage) MoveAccumulatedAmount(ctx context.Context, farmId int64, fromAddress, toAddress string) (types.Sats, error) {
+	fromAmount, err := ds.GetCurrentAcummulatedAmountForAddress(ctx, fromAddress, farmId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	toAmount, err := ds.GetCurrentAcummulatedAmountForAddress(ctx, toAddress, farmId)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	ds.accumulatedAmounts[accumulatedAmountKey(toAddress, farmId)] = toAmount + fromAmount
+	ds.accumulatedAmounts[accumulatedAmountKey(fromAddress, farmId)] = 0
+	return fromAmount, nil
+}
+
+// SaveBtcPrice does nothing, the prices are recorded only for the payments that are made
+func (ds *dryRunStorage) SaveBtcPrice(ctx context.Context, price types.BtcPrice) error {
+	return nil
+}
+
+var _ Storage = (*dryRunStorage)(nil)
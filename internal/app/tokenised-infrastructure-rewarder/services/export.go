@@ -0,0 +1,572 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/shopspring/decimal"
+)
+
+type ExportStorage interface {
+	GetFarmPayment(ctx context.Context, farmPaymentId int64) (types.FarmPayment, error)
+	GetFarmPaymentIdsByDate(ctx context.Context, from, to time.Time) ([]int64, error)
+	GetFarmPaymentUTXOTxHash(ctx context.Context, farmPaymentId int64) (string, error)
+	GetFarmPaymentLedgerEntries(ctx context.Context, farmPaymentId int64) ([]types.LedgerEntry, error)
+	GetFarmAuraPoolCollections(ctx context.Context, farmId int64) ([]types.AuraPoolCollection, error)
+	GetCollectionPaymentAllocations(ctx context.Context, farmPaymentId int64) ([]types.CollectionPaymentAllocation, error)
+	GetNFTStatisticsByFarmPayment(ctx context.Context, farmPaymentId int64) ([]types.NFTStatistics, error)
+	GetDestinationAddressesByFarmPayment(ctx context.Context, farmPaymentId int64) ([]types.DestinationAddressWithAmount, error)
+	GetTxHashesByFarmPayment(ctx context.Context, farmPaymentId int64) ([]types.TransactionHashWithStatus, error)
+	GetRBFTransactionsByFarmPayment(ctx context.Context, farmPaymentId int64) ([]types.RBFTransactionHistory, error)
+	GetBtcPrice(ctx context.Context, event, reference, currency string) (types.BtcPrice, error)
+}
+
+// FarmPaymentExportQuery selects a single farm payment by its id, or else the farm payments created in [From, To).
+// The amounts are valued in the fiat Currency at the captured prices, no fiat values are exported without a currency.
+type FarmPaymentExportQuery struct {
+	FarmPaymentId int64
+	From          time.Time
+	To            time.Time
+	Currency      string
+}
+
+// FarmPaymentExport is the breakdown of a farm payment, from the received UTXO to the transactions that paid it out
+type FarmPaymentExport struct {
+	FarmPaymentId         int64               `json:"farm_payment_id"`
+	FarmId                int64               `json:"farm_id"`
+	CreatedAt             time.Time           `json:"created_at"`
+	UTXOTxHash            string              `json:"utxo_tx_hash"`
+	ReceivedRewardBtc     types.Sats          `json:"received_reward_btc"`
+	CUDOGeneralFeeBtc     types.Sats          `json:"cudo_general_fee_btc"`
+	CUDOMaintenanceFeeBtc types.Sats          `json:"cudo_maintenance_fee_btc"`
+	FiatCurrency          string              `json:"fiat_currency"`
+	BtcPrice              *decimal.Decimal    `json:"btc_price"`
+	Collections           []CollectionExport  `json:"collections"`
+	Nfts                  []NftExport         `json:"nfts"`
+	Destinations          []DestinationExport `json:"destinations"`
+	Transactions          []TransactionExport `json:"transactions"`
+}
+
+type CollectionExport struct {
+	CollectionId            int64      `json:"collection_id"`
+	DenomId                 string     `json:"denom_id"`
+	CollectionAllocationBtc types.Sats `json:"collection_allocation_btc"`
+	CUDOGeneralFeeBtc       types.Sats `json:"cudo_general_fee_btc"`
+	CUDOMaintenanceFeeBtc   types.Sats `json:"cudo_maintenance_fee_btc"`
+	FarmMaintenanceFeeBtc   types.Sats `json:"farm_maintenance_fee_btc"`
+	FarmUnsoldLeftoverBtc   types.Sats `json:"farm_unsold_leftover_btc"`
+}
+
+type NftExport struct {
+	DenomId               string        `json:"denom_id"`
+	TokenId               string        `json:"token_id"`
+	PayoutPeriodStart     int64         `json:"payout_period_start"`
+	PayoutPeriodEnd       int64         `json:"payout_period_end"`
+	RewardBtc             types.Sats    `json:"reward_btc"`
+	FarmMaintenanceFeeBtc types.Sats    `json:"farm_maintenance_fee_btc"`
+	CUDOMaintenanceFeeBtc types.Sats    `json:"cudo_maintenance_fee_btc"`
+	TxHash                string        `json:"tx_hash"`
+	Owners                []OwnerExport `json:"owners"`
+}
+
+type OwnerExport struct {
+	Owner              string     `json:"owner"`
+	PayoutAddress      string     `json:"payout_address"`
+	TimeOwnedFrom      int64      `json:"time_owned_from"`
+	TimeOwnedTo        int64      `json:"time_owned_to"`
+	PercentOfTimeOwned float64    `json:"percent_of_time_owned"`
+	RewardBtc          types.Sats `json:"reward_btc"`
+}
+
+type DestinationExport struct {
+	Address          string     `json:"address"`
+	AmountBtc        types.Sats `json:"amount_btc"`
+	ThresholdReached bool       `json:"threshold_reached"`
+	// CrossFarm is set when the threshold was reached by the amounts of the owner in all farms together
+	CrossFarm bool             `json:"cross_farm"`
+	TxHash    string           `json:"tx_hash"`
+	BtcPrice  *decimal.Decimal `json:"btc_price"`
+}
+
+type TransactionExport struct {
+	TxHash           string           `json:"tx_hash"`
+	Status           string           `json:"status"`
+	TimeSent         int64            `json:"time_sent"`
+	ReplacedByTxHash string           `json:"replaced_by_tx_hash"`
+	BtcPrice         *decimal.Decimal `json:"btc_price"`
+}
+
+// ExportFarmPayments returns the breakdown of the farm payments selected by the query, ordered by their id
+func ExportFarmPayments(ctx context.Context, storage ExportStorage, query FarmPaymentExportQuery) ([]FarmPaymentExport, error) {
+	farmPaymentIds := []int64{query.FarmPaymentId}
+	if query.FarmPaymentId == 0 {
+		if !query.From.Before(query.To) {
+			return nil, fmt.Errorf("invalid export period, from {%s} is not before to {%s}", query.From, query.To)
+		}
+
+		var err error
+		if farmPaymentIds, err = storage.GetFarmPaymentIdsByDate(ctx, query.From, query.To); err != nil {
+			return nil, err
+		}
+	}
+
+	exports := []FarmPaymentExport{}
+	for _, farmPaymentId := range farmPaymentIds {
+		export, err := exportFarmPayment(ctx, storage, farmPaymentId, query.Currency)
+		if err != nil {
+			return nil, err
+		}
+		exports = append(exports, export)
+	}
+
+	return exports, nil
+}
+
+/*
+exportFarmPayment collects the statistics of a farm payment.
+
+ 1. The CUDO fees are the ones booked in the ledger. Farm payments booked before the ledger allocated them
+    report the fees of their collections.
+ 2. A transaction that was replaced by fee references its replacement, which is exported as a transaction of its own.
+ 3. The payment is priced at the moment it was received, the destinations and transactions at the moment they were sent.
+    A destination whose send price was not captured falls back to the price of the payment.
+*/
+func exportFarmPayment(ctx context.Context, storage ExportStorage, farmPaymentId int64, currency string) (FarmPaymentExport, error) {
+	farmPayment, err := storage.GetFarmPayment(ctx, farmPaymentId)
+	if err != nil {
+		return FarmPaymentExport{}, fmt.Errorf("failed to get farm payment {%d}: %w", farmPaymentId, err)
+	}
+
+	utxoTxHash, err := storage.GetFarmPaymentUTXOTxHash(ctx, farmPaymentId)
+	if err != nil {
+		return FarmPaymentExport{}, err
+	}
+
+	export := FarmPaymentExport{
+		FarmPaymentId:     farmPaymentId,
+		FarmId:            farmPayment.FarmId,
+		CreatedAt:         farmPayment.CreatedAt.UTC(),
+		UTXOTxHash:        utxoTxHash,
+		ReceivedRewardBtc: farmPayment.AmountBTC,
+		Collections:       []CollectionExport{},
+		Nfts:              []NftExport{},
+		Destinations:      []DestinationExport{},
+		Transactions:      []TransactionExport{},
+	}
+
+	if currency != "" {
+		export.FiatCurrency = currency
+		if export.BtcPrice, err = getBtcPrice(ctx, storage, types.BtcPriceEventFarmPayment, utxoTxHash, currency); err != nil {
+			return FarmPaymentExport{}, err
+		}
+	}
+
+	ledgerEntries, err := storage.GetFarmPaymentLedgerEntries(ctx, farmPaymentId)
+	if err != nil {
+		return FarmPaymentExport{}, err
+	}
+
+	bookedInLedger := false
+	for _, entry := range ledgerEntries {
+		switch entry.Account {
+		case types.LedgerCudoGeneralFee:
+			export.CUDOGeneralFeeBtc += types.NewSatsFromBtc(entry.AmountBtc)
+			bookedInLedger = true
+		case types.LedgerCudoMaintenanceFee:
+			export.CUDOMaintenanceFeeBtc += types.NewSatsFromBtc(entry.AmountBtc)
+			bookedInLedger = true
+		}
+	}
+
+	collections, err := storage.GetFarmAuraPoolCollections(ctx, farmPayment.FarmId)
+	if err != nil {
+		return FarmPaymentExport{}, err
+	}
+
+	denomIdByCollectionId := make(map[int64]string)
+	for _, collection := range collections {
+		denomIdByCollectionId[collection.Id] = collection.DenomId
+	}
+
+	allocations, err := storage.GetCollectionPaymentAllocations(ctx, farmPaymentId)
+	if err != nil {
+		return FarmPaymentExport{}, err
+	}
+
+	for _, allocation := range allocations {
+		export.Collections = append(export.Collections, CollectionExport{
+			CollectionId:            allocation.CollectionId,
+			DenomId:                 denomIdByCollectionId[allocation.CollectionId],
+			CollectionAllocationBtc: allocation.CollectionAllocationAmount,
+			CUDOGeneralFeeBtc:       allocation.CUDOGeneralFee,
+			CUDOMaintenanceFeeBtc:   allocation.CUDOMaintenanceFee,
+			FarmMaintenanceFeeBtc:   allocation.FarmMaintenanceFee,
+			FarmUnsoldLeftoverBtc:   allocation.FarmUnsoldLeftovers,
+		})
+
+		if !bookedInLedger {
+			export.CUDOGeneralFeeBtc += allocation.CUDOGeneralFee
+			export.CUDOMaintenanceFeeBtc += allocation.CUDOMaintenanceFee
+		}
+	}
+
+	statistics, err := storage.GetNFTStatisticsByFarmPayment(ctx, farmPaymentId)
+	if err != nil {
+		return FarmPaymentExport{}, err
+	}
+
+	for _, nftStatistics := range statistics {
+		nft := NftExport{
+			DenomId:               nftStatistics.DenomId,
+			TokenId:               nftStatistics.TokenId,
+			PayoutPeriodStart:     nftStatistics.PayoutPeriodStart,
+			PayoutPeriodEnd:       nftStatistics.PayoutPeriodEnd,
+			RewardBtc:             nftStatistics.Reward,
+			FarmMaintenanceFeeBtc: nftStatistics.MaintenanceFee,
+			CUDOMaintenanceFeeBtc: nftStatistics.CUDOPartOfMaintenanceFee,
+			TxHash:                nftStatistics.TxHash,
+			Owners:                []OwnerExport{},
+		}
+
+		for _, owner := range nftStatistics.NFTOwnersForPeriod {
+			nft.Owners = append(nft.Owners, OwnerExport{
+				Owner:              owner.Owner,
+				PayoutAddress:      owner.PayoutAddress,
+				TimeOwnedFrom:      owner.TimeOwnedFrom,
+				TimeOwnedTo:        owner.TimeOwnedTo,
+				PercentOfTimeOwned: owner.PercentOfTimeOwned,
+				RewardBtc:          owner.Reward,
+			})
+		}
+
+		export.Nfts = append(export.Nfts, nft)
+	}
+
+	destinations, err := storage.GetDestinationAddressesByFarmPayment(ctx, farmPaymentId)
+	if err != nil {
+		return FarmPaymentExport{}, err
+	}
+
+	sendPrices := make(map[string]*decimal.Decimal)
+	getSendPrice := func(txHash string) (*decimal.Decimal, error) {
+		if currency == "" || txHash == "" {
+			return nil, nil
+		}
+		if price, ok := sendPrices[txHash]; ok {
+			return price, nil
+		}
+
+		price, err := getBtcPrice(ctx, storage, types.BtcPriceEventSendMany, txHash, currency)
+		if err != nil {
+			return nil, err
+		}
+		sendPrices[txHash] = price
+		return price, nil
+	}
+
+	for _, destination := range destinations {
+		price, err := getSendPrice(destination.TxHash)
+		if err != nil {
+			return FarmPaymentExport{}, err
+		}
+		if price == nil {
+			price = export.BtcPrice
+		}
+
+		export.Destinations = append(export.Destinations, DestinationExport{
+			Address:          destination.Address,
+			AmountBtc:        destination.AmountBTC,
+			ThresholdReached: destination.ThresholdReached,
+			CrossFarm:        destination.CrossFarm,
+			TxHash:           destination.TxHash,
+			BtcPrice:         price,
+		})
+	}
+
+	rbfTransactions, err := storage.GetRBFTransactionsByFarmPayment(ctx, farmPaymentId)
+	if err != nil {
+		return FarmPaymentExport{}, err
+	}
+
+	replacedBy := make(map[string]string)
+	for _, rbfTransaction := range rbfTransactions {
+		replacedBy[rbfTransaction.OldTxHash] = rbfTransaction.NewTxHash
+	}
+
+	transactions, err := storage.GetTxHashesByFarmPayment(ctx, farmPaymentId)
+	if err != nil {
+		return FarmPaymentExport{}, err
+	}
+
+	for _, transaction := range transactions {
+		price, err := getSendPrice(transaction.TxHash)
+		if err != nil {
+			return FarmPaymentExport{}, err
+		}
+
+		export.Transactions = append(export.Transactions, TransactionExport{
+			TxHash:           transaction.TxHash,
+			Status:           transaction.Status,
+			TimeSent:         transaction.TimeSent,
+			ReplacedByTxHash: replacedBy[transaction.TxHash],
+			BtcPrice:         price,
+		})
+	}
+
+	return export, nil
+}
+
+type btcPriceStorage interface {
+	GetBtcPrice(ctx context.Context, event, reference, currency string) (types.BtcPrice, error)
+}
+
+// getBtcPrice returns the price of a bitcoin captured at the event, nil if it was not captured
+func getBtcPrice(ctx context.Context, storage btcPriceStorage, event, reference, currency string) (*decimal.Decimal, error) {
+	price, err := storage.GetBtcPrice(ctx, event, reference, currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s btc price of {%s}: %s", event, reference, err)
+	}
+
+	return &price.Price, nil
+}
+
+// The formats the farm payments can be exported in
+const (
+	ExportFormatCSV  = "csv"
+	ExportFormatJSON = "json"
+)
+
+// ParseExportTime parses a date, e.g. 2023-07-01, or a RFC3339 time
+func ParseExportTime(value string) (time.Time, error) {
+	if parsed, err := time.Parse("2006-01-02", value); err == nil {
+		return parsed, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time {%s}, expected a date as 2006-01-02 or a RFC3339 time", value)
+	}
+
+	return parsed, nil
+}
+
+// WriteFarmPaymentExports writes the farm payments in the given format
+func WriteFarmPaymentExports(w io.Writer, format string, exports []FarmPaymentExport) error {
+	switch format {
+	case ExportFormatCSV:
+		return WriteFarmPaymentExportsCSV(w, exports)
+	case ExportFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(exports)
+	default:
+		return fmt.Errorf("invalid export format {%s}, expected %s or %s", format, ExportFormatCSV, ExportFormatJSON)
+	}
+}
+
+// FarmPaymentExportCSVHeader are the columns of the csv export, in their order.
+// Every row is a record of a farm payment, the columns that don't apply to the record are empty.
+// Every amount is exported in btc, sats and the fiat currency, the fiat columns are empty when the price was not captured.
+var FarmPaymentExportCSVHeader = exportColumns(
+	"farm_payment_id",
+	"farm_id",
+	"created_at",
+	"utxo_tx_hash",
+	"record",
+	"collection_id",
+	"denom_id",
+	"token_id",
+	"owner",
+	"address",
+	"period_start",
+	"period_end",
+	"percent_of_time_owned",
+	"fiat_currency",
+	"btc_price",
+	"amount_btc",
+	"cudo_general_fee_btc",
+	"cudo_maintenance_fee_btc",
+	"farm_maintenance_fee_btc",
+	"farm_unsold_leftover_btc",
+	"threshold_reached",
+	"cross_farm",
+	"tx_hash",
+	"status",
+	"replaced_by_tx_hash",
+)
+
+// the records of the csv export
+const (
+	exportRecordPayment     = "payment"
+	exportRecordCollection  = "collection"
+	exportRecordNft         = "nft"
+	exportRecordOwner       = "owner"
+	exportRecordDestination = "destination"
+	exportRecordTransaction = "transaction"
+)
+
+/*
+WriteFarmPaymentExportsCSV writes the farm payments as csv, with the columns of FarmPaymentExportCSVHeader.
+Each farm payment is written as its records in this order:
+
+ 1. The payment with the received reward and the CUDO fees.
+ 2. A collection record for each collection allocation.
+ 3. A nft record for each paid nft, followed by an owner record for each of its owners.
+ 4. A destination record for each address the payment was allocated to.
+ 5. A transaction record for each transaction that paid it out.
+*/
+func WriteFarmPaymentExportsCSV(w io.Writer, exports []FarmPaymentExport) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(FarmPaymentExportCSVHeader); err != nil {
+		return err
+	}
+
+	for _, export := range exports {
+		for _, row := range farmPaymentExportRows(export) {
+			if err := csvWriter.Write(row.values(FarmPaymentExportCSVHeader)); err != nil {
+				return err
+			}
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// exportRow is a row of a csv export, by column name
+type exportRow map[string]string
+
+// values returns the values of the row in the order of the header, the missing columns are empty
+func (row exportRow) values(header []string) []string {
+	values := make([]string, len(header))
+	for i, column := range header {
+		values[i] = row[column]
+	}
+	return values
+}
+
+// exportColumns expands each amount column, the ones with the _btc suffix, to its btc, sats and fiat columns
+func exportColumns(columns ...string) []string {
+	header := []string{}
+	for _, column := range columns {
+		if name := strings.TrimSuffix(column, "_btc"); name != column {
+			header = append(header, column, name+"_sats", name+"_fiat")
+			continue
+		}
+		header = append(header, column)
+	}
+	return header
+}
+
+// setPrice sets the price the amounts of the row are valued at, a row without a price has no fiat values
+func (row exportRow) setPrice(currency string, btcPrice *decimal.Decimal) {
+	if btcPrice == nil {
+		delete(row, "fiat_currency")
+		delete(row, "btc_price")
+		return
+	}
+	row["fiat_currency"] = currency
+	row["btc_price"] = btcPrice.String()
+}
+
+// setAmount sets the btc, sats and fiat columns of the amount column, which is named with the _btc suffix
+func (row exportRow) setAmount(column string, amount types.Sats) {
+	name := strings.TrimSuffix(column, "_btc")
+	row[name+"_btc"] = amount.String()
+	row[name+"_sats"] = strconv.FormatInt(int64(amount), 10)
+	if btcPrice, ok := row["btc_price"]; ok {
+		row[name+"_fiat"] = amount.FiatValue(decimal.RequireFromString(btcPrice)).StringFixed(2)
+	}
+}
+
+func farmPaymentExportRows(export FarmPaymentExport) []exportRow {
+	newRow := func(record string) exportRow {
+		row := exportRow{
+			"farm_payment_id": strconv.FormatInt(export.FarmPaymentId, 10),
+			"farm_id":         strconv.FormatInt(export.FarmId, 10),
+			"created_at":      export.CreatedAt.Format(time.RFC3339),
+			"utxo_tx_hash":    export.UTXOTxHash,
+			"record":          record,
+		}
+		row.setPrice(export.FiatCurrency, export.BtcPrice)
+		return row
+	}
+
+	payment := newRow(exportRecordPayment)
+	payment.setAmount("amount_btc", export.ReceivedRewardBtc)
+	payment.setAmount("cudo_general_fee_btc", export.CUDOGeneralFeeBtc)
+	payment.setAmount("cudo_maintenance_fee_btc", export.CUDOMaintenanceFeeBtc)
+	rows := []exportRow{payment}
+
+	for _, collection := range export.Collections {
+		row := newRow(exportRecordCollection)
+		row["collection_id"] = strconv.FormatInt(collection.CollectionId, 10)
+		row["denom_id"] = collection.DenomId
+		row.setAmount("amount_btc", collection.CollectionAllocationBtc)
+		row.setAmount("cudo_general_fee_btc", collection.CUDOGeneralFeeBtc)
+		row.setAmount("cudo_maintenance_fee_btc", collection.CUDOMaintenanceFeeBtc)
+		row.setAmount("farm_maintenance_fee_btc", collection.FarmMaintenanceFeeBtc)
+		row.setAmount("farm_unsold_leftover_btc", collection.FarmUnsoldLeftoverBtc)
+		rows = append(rows, row)
+	}
+
+	for _, nft := range export.Nfts {
+		row := newRow(exportRecordNft)
+		row["denom_id"] = nft.DenomId
+		row["token_id"] = nft.TokenId
+		row["period_start"] = strconv.FormatInt(nft.PayoutPeriodStart, 10)
+		row["period_end"] = strconv.FormatInt(nft.PayoutPeriodEnd, 10)
+		row.setAmount("amount_btc", nft.RewardBtc)
+		row.setAmount("cudo_maintenance_fee_btc", nft.CUDOMaintenanceFeeBtc)
+		row.setAmount("farm_maintenance_fee_btc", nft.FarmMaintenanceFeeBtc)
+		row["tx_hash"] = nft.TxHash
+		rows = append(rows, row)
+
+		for _, owner := range nft.Owners {
+			row := newRow(exportRecordOwner)
+			row["denom_id"] = nft.DenomId
+			row["token_id"] = nft.TokenId
+			row["owner"] = owner.Owner
+			row["address"] = owner.PayoutAddress
+			row["period_start"] = strconv.FormatInt(owner.TimeOwnedFrom, 10)
+			row["period_end"] = strconv.FormatInt(owner.TimeOwnedTo, 10)
+			row["percent_of_time_owned"] = strconv.FormatFloat(owner.PercentOfTimeOwned, 'f', -1, 64)
+			row.setAmount("amount_btc", owner.RewardBtc)
+			rows = append(rows, row)
+		}
+	}
+
+	for _, destination := range export.Destinations {
+		row := newRow(exportRecordDestination)
+		row.setPrice(export.FiatCurrency, destination.BtcPrice)
+		row["address"] = destination.Address
+		row.setAmount("amount_btc", destination.AmountBtc)
+		row["threshold_reached"] = strconv.FormatBool(destination.ThresholdReached)
+		row["cross_farm"] = strconv.FormatBool(destination.CrossFarm)
+		row["tx_hash"] = destination.TxHash
+		rows = append(rows, row)
+	}
+
+	for _, transaction := range export.Transactions {
+		row := newRow(exportRecordTransaction)
+		row.setPrice(export.FiatCurrency, transaction.BtcPrice)
+		row["tx_hash"] = transaction.TxHash
+		row["status"] = transaction.Status
+		row["replaced_by_tx_hash"] = transaction.ReplacedByTxHash
+		rows = append(rows, row)
+	}
+
+	return rows
+}
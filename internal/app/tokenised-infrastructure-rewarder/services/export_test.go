@@ -0,0 +1,75 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFarmPaymentExportsCSV(t *testing.T) {
+	paymentPrice := decimal.NewFromInt(20000)
+	sendPrice := decimal.RequireFromString("21000.5")
+	export := FarmPaymentExport{
+		FarmPaymentId:         1,
+		FarmId:                2,
+		CreatedAt:             time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC),
+		UTXOTxHash:            "utxo_tx_hash",
+		ReceivedRewardBtc:     100000000,
+		CUDOGeneralFeeBtc:     2000000,
+		CUDOMaintenanceFeeBtc: 500000,
+		FiatCurrency:          "usd",
+		BtcPrice:              &paymentPrice,
+		Collections:           []CollectionExport{{CollectionId: 1, DenomId: "denom_1", CollectionAllocationBtc: 98000000}},
+		Nfts: []NftExport{
+			{
+				DenomId:   "denom_1",
+				TokenId:   "1",
+				RewardBtc: 97500000,
+				TxHash:    "tx_hash_1",
+				Owners:    []OwnerExport{{Owner: "owner_1", PayoutAddress: "address_1", PercentOfTimeOwned: 100, RewardBtc: 97500000}},
+			},
+		},
+		Destinations: []DestinationExport{{Address: "address_1", AmountBtc: 97500000, ThresholdReached: true, TxHash: "tx_hash_1", BtcPrice: &sendPrice}},
+		Transactions: []TransactionExport{{TxHash: "tx_hash_1", Status: "Completed", ReplacedByTxHash: ""}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteFarmPaymentExportsCSV(&buf, []FarmPaymentExport{export}))
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 7)
+	require.Equal(t, FarmPaymentExportCSVHeader, records[0])
+
+	column := func(record []string, name string) string {
+		for i, header := range FarmPaymentExportCSVHeader {
+			if header == name {
+				return record[i]
+			}
+		}
+		return ""
+	}
+
+	expectedRecords := []string{exportRecordPayment, exportRecordCollection, exportRecordNft, exportRecordOwner, exportRecordDestination, exportRecordTransaction}
+	for i, expectedRecord := range expectedRecords {
+		require.Equal(t, expectedRecord, column(records[i+1], "record"))
+		require.Equal(t, "utxo_tx_hash", column(records[i+1], "utxo_tx_hash"))
+	}
+
+	require.Equal(t, "1", column(records[1], "amount_btc"))
+	require.Equal(t, "100000000", column(records[1], "amount_sats"))
+	require.Equal(t, "20000.00", column(records[1], "amount_fiat"))
+	require.Equal(t, "usd", column(records[1], "fiat_currency"))
+	require.Equal(t, "20000", column(records[1], "btc_price"))
+	require.Equal(t, "0.02", column(records[1], "cudo_general_fee_btc"))
+	require.Equal(t, "address_1", column(records[4], "address"))
+	require.Equal(t, "0.975", column(records[5], "amount_btc"))
+	require.Equal(t, "true", column(records[5], "threshold_reached"))
+	require.Equal(t, "21000.5", column(records[5], "btc_price"))
+	require.Equal(t, "20475.49", column(records[5], "amount_fiat"))
+	require.Equal(t, "", column(records[6], "amount_fiat"))
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/rs/zerolog/log"
+)
+
+// farmWallets loads the farm wallets, recovers their interrupted payouts and pays from them.
+// It is shared by the services that spend from the farm wallets, so they prepare and pay from a wallet the same way.
+type farmWallets struct {
+	config         *infrastructure.Config
+	helper         InfrastructureHelper
+	apiRequester   ApiRequester
+	secretProvider SecretProvider
+	priceSource    PriceSource
+	// in dry run nothing is sent and no prices are captured
+	dryRun bool
+
+	// farms are processed concurrently, so the counters are shared between them
+	btcWalletOpenFailsMutex   sync.Mutex
+	btcWalletOpenFailsPerFarm map[string]int
+}
+
+func newFarmWallets(config *infrastructure.Config, apiRequester ApiRequester, helper InfrastructureHelper, secretProvider SecretProvider, priceSource PriceSource) *farmWallets {
+	return &farmWallets{
+		config:                    config,
+		helper:                    helper,
+		apiRequester:              apiRequester,
+		secretProvider:            secretProvider,
+		priceSource:               priceSource,
+		btcWalletOpenFailsPerFarm: make(map[string]int),
+	}
+}
+
+// prepareWallet loads the farm wallet, if it is not loaded yet, and recovers the payouts of the farm that were interrupted after sending,
+// so a UTXO that was already paid is never paid again. The wallet has to be opened already, walletClient is its client.
+// The UTXOs left locked by an interrupted payout of accumulated amounts are unlocked, so they are listed again.
+// Returns false if the wallet could not be loaded yet.
+func (w *farmWallets) prepareWallet(ctx context.Context, btcClient, walletClient BtcClient, storage Storage, farm types.Farm) (bool, error) {
+	loaded, err := w.loadWallet(btcClient, farm.RewardsFromPoolBtcWalletName)
+	if err != nil || !loaded {
+		return false, err
+	}
+
+	if !w.dryRun {
+		if err := lockUnspent(walletClient, true, nil); err != nil {
+			return false, fmt.Errorf("failed to unlock the UTXOs of wallet {%s}: %s", farm.RewardsFromPoolBtcWalletName, err)
+		}
+	}
+
+	if err := w.recoverPayoutIntents(ctx, storage, farm); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// loadWallet attempts to load the specified Bitcoin wallet using the given BTC client.
+// A wallet that is already loaded is not loaded again.
+// If the wallet fails to load for 15 consecutive attempts, the function returns an error.
+// The function returns a boolean to indicate whether the wallet was successfully loaded or not.
+// If the wallet is loaded successfully - nullate the fail counter for the wallet.
+// Returns:
+// - bool: True if the wallet was successfully loaded, false otherwise.
+// - error: An error indicating the reason for the wallet load failure, if any.
+func (w *farmWallets) loadWallet(btcClient BtcClient, farmName string) (bool, error) {
+	loaded, err := isWalletLoaded(btcClient, farmName)
+	if err != nil {
+		return false, err
+	}
+
+	if loaded {
+		return true, nil
+	}
+
+	w.btcWalletOpenFailsMutex.Lock()
+	defer w.btcWalletOpenFailsMutex.Unlock()
+
+	_, err = btcClient.LoadWallet(farmName)
+	if err != nil {
+		w.btcWalletOpenFailsPerFarm[farmName]++
+		if w.btcWalletOpenFailsPerFarm[farmName] >= 15 {
+			w.btcWalletOpenFailsPerFarm[farmName] = 0
+			return false, fmt.Errorf("failed to load wallet %s for 15 times", farmName)
+		}
+
+		log.Warn().Msgf("Failed to load wallet %s for %d consecutive times: %s", farmName, w.btcWalletOpenFailsPerFarm[farmName], err)
+		return false, nil
+	}
+
+	w.btcWalletOpenFailsPerFarm[farmName] = 0
+	log.Debug().Msgf("Farm Wallet: {%s} loaded", farmName)
+
+	return true, nil
+}
+
+// gets all the unspent transactions for the farm wallet
+// the farm wallet must fisrst be loaded
+func (w *farmWallets) getUnspentTxsForFarm(ctx context.Context, btcClient BtcClient, storage Storage, farmAddresses []string) ([]types.UnspentTx, error) {
+	unspentTransactions, err := btcClient.ListUnspent()
+	if err != nil {
+		return nil, err
+	}
+
+	validUnspentTransactions, err := filterUnspentTransactions(ctx, unspentTransactions, storage, farmAddresses)
+	if err != nil {
+		return nil, err
+	}
+
+	return validUnspentTransactions, nil
+}
+
+// recordBtcPrices saves the current price of a bitcoin in each of the configured fiat currencies for the event,
+// so the payments can be valued later at the price they were made at.
+// The prices are only bookkeeping, a failure to get or save them is logged and does not stop the payment.
+func (w *farmWallets) recordBtcPrices(ctx context.Context, storage Storage, event, reference string, farmId int64) {
+	if w.priceSource == nil || w.dryRun {
+		return
+	}
+
+	prices, err := w.priceSource.BtcPrices(ctx, w.config.PriceFiatCurrencies)
+	if err != nil {
+		log.Warn().Msgf("Failed to get btc prices for %s {%s}: %s", event, reference, err)
+		return
+	}
+
+	capturedAt := time.Unix(w.helper.Unix(), 0).UTC()
+	for _, currency := range w.config.PriceFiatCurrencies {
+		price := types.BtcPrice{
+			Event:      event,
+			Reference:  reference,
+			FarmId:     farmId,
+			Currency:   currency,
+			Price:      prices[currency],
+			Source:     w.priceSource.Name(),
+			CapturedAt: capturedAt,
+		}
+		if err := storage.SaveBtcPrice(ctx, price); err != nil {
+			log.Warn().Msgf("Failed to save btc price in {%s} for %s {%s}: %s", currency, event, reference, err)
+		}
+	}
+}
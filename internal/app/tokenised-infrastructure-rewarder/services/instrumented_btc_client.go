@@ -0,0 +1,101 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/resilience"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// instrumentedBtcClient records the latency and errors of every call to the bitcoin node.
+// While the circuit breaker of the node is open, the calls fail without reaching the node.
+type instrumentedBtcClient struct {
+	btcClient BtcClient
+	breaker   *resilience.Breaker
+}
+
+func NewInstrumentedBtcClient(btcClient BtcClient, breaker *resilience.Breaker) BtcClient {
+	return &instrumentedBtcClient{btcClient: btcClient, breaker: breaker}
+}
+
+func (c *instrumentedBtcClient) LoadWallet(walletName string) (result *btcjson.LoadWalletResult, err error) {
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	defer c.observe("loadwallet", time.Now(), &err)
+	return c.btcClient.LoadWallet(walletName)
+}
+
+func (c *instrumentedBtcClient) WalletPassphrase(passphrase string, timeoutSecs int64) (err error) {
+	if err := c.breaker.Allow(); err != nil {
+		return err
+	}
+	defer c.observe("walletpassphrase", time.Now(), &err)
+	return c.btcClient.WalletPassphrase(passphrase, timeoutSecs)
+}
+
+func (c *instrumentedBtcClient) WalletLock() (err error) {
+	if err := c.breaker.Allow(); err != nil {
+		return err
+	}
+	defer c.observe("walletlock", time.Now(), &err)
+	return c.btcClient.WalletLock()
+}
+
+func (c *instrumentedBtcClient) GetRawTransactionVerbose(txHash *chainhash.Hash) (result *btcjson.TxRawResult, err error) {
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	defer c.observe("getrawtransaction", time.Now(), &err)
+	return c.btcClient.GetRawTransactionVerbose(txHash)
+}
+
+func (c *instrumentedBtcClient) ListUnspent() (result []types.UnspentTx, err error) {
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	defer c.observe("listunspent", time.Now(), &err)
+	return c.btcClient.ListUnspent()
+}
+
+func (c *instrumentedBtcClient) GetBalance(account string) (balance btcutil.Amount, err error) {
+	if err := c.breaker.Allow(); err != nil {
+		return 0, err
+	}
+	defer c.observe("getbalance", time.Now(), &err)
+	return c.btcClient.GetBalance(account)
+}
+
+func (c *instrumentedBtcClient) RawRequest(method string, params []json.RawMessage) (result json.RawMessage, err error) {
+	if err := c.breaker.Allow(); err != nil {
+		return nil, err
+	}
+	defer c.observe(method, time.Now(), &err)
+	return c.btcClient.RawRequest(method, params)
+}
+
+func (c *instrumentedBtcClient) OpenWallet(walletName string) (BtcClient, func(), error) {
+	walletClient, release, err := c.btcClient.OpenWallet(walletName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return NewInstrumentedBtcClient(walletClient, c.breaker), release, nil
+}
+
+func (c *instrumentedBtcClient) observe(operation string, start time.Time, err *error) {
+	metrics.ObserveRequest(metrics.EndpointBitcoind, operation, start, *err)
+	c.breaker.Record(isNodeUnavailable(*err))
+}
+
+// isNodeUnavailable is true if the node did not answer. An rpc error is an answer of a working node.
+func isNodeUnavailable(err error) bool {
+	var rpcError *btcjson.RPCError
+	return err != nil && !errors.As(err, &rpcError)
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"sort"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+)
+
+// ledgerAllocations splits the received reward by ledger account, the same way it is split between the destination addresses.
+// Whatever is not paid as fees or to the nft owners is returned to the farm as leftovers.
+func (s *PayService) ledgerAllocations(farm types.Farm, receivedRewardForFarmSats, totalRewardForFarmAfterCudosFeeSats types.Sats, statistics []types.NFTStatistics) []types.LedgerAllocation {
+	// keyed by account and address
+	amounts := make(map[[2]string]types.Sats)
+	add := func(account, address string, amount types.Sats) {
+		amounts[[2]string{account, address}] += amount
+	}
+
+	add(types.LedgerCudoGeneralFee, s.config.CUDOFeePayoutAddress, receivedRewardForFarmSats-totalRewardForFarmAfterCudosFeeSats)
+	for _, nftStatistics := range statistics {
+		add(types.LedgerFarmMaintenance, farm.MaintenanceFeePayoutAddress, nftStatistics.MaintenanceFee)
+		add(types.LedgerCudoMaintenanceFee, s.config.CUDOMaintenanceFeePayoutAddress, nftStatistics.CUDOPartOfMaintenanceFee)
+		for _, nftOwnersForPeriod := range nftStatistics.NFTOwnersForPeriod {
+			add(types.LedgerOwnerAccrued, nftOwnersForPeriod.Owner, nftOwnersForPeriod.Reward)
+		}
+	}
+
+	leftoversSats := receivedRewardForFarmSats
+	for _, amount := range amounts {
+		leftoversSats -= amount
+	}
+	add(types.LedgerFarmLeftover, farm.LeftoverRewardPayoutAddress, leftoversSats)
+
+	var allocations []types.LedgerAllocation
+	for key, amount := range amounts {
+		if amount != 0 {
+			allocations = append(allocations, types.LedgerAllocation{Account: key[0], Address: key[1], AmountBtc: amount})
+		}
+	}
+
+	sort.Slice(allocations, func(i, j int) bool {
+		if allocations[i].Account != allocations[j].Account {
+			return allocations[i].Account < allocations[j].Account
+		}
+		return allocations[i].Address < allocations[j].Address
+	})
+
+	return allocations
+}
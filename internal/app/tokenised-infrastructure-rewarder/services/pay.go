@@ -2,74 +2,253 @@ package services
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/shopspring/decimal"
 
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/notifier"
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
-	"github.com/btcsuite/btcd/btcjson"
 	"github.com/rs/zerolog/log"
 )
 
 type PayService struct {
-	config                    *infrastructure.Config
-	helper                    InfrastructureHelper
-	btcNetworkParams          *types.BtcNetworkParams
-	apiRequester              ApiRequester
-	lastEmailTimestamp        int64
-	btcWalletOpenFailsPerFarm map[string]int
+	config           *infrastructure.Config
+	helper           InfrastructureHelper
+	alerts           Alerter
+	btcNetworkParams *types.BtcNetworkParams
+	apiRequester     ApiRequester
+	secretProvider   SecretProvider
+	wallets          *farmWallets
+	dryRunReport     *DryRunReport
+
+	// farms are processed concurrently, this guards the report shared between them
+	dryRunReportMutex sync.Mutex
+
+	// the statuses are read by the admin api while the worker is running
+	farmStatusesMutex sync.Mutex
+	farmStatuses      map[int64]FarmStatus
+
+	// the owners held in the run because of their amounts in all farms, by their cudos addresses,
+	// and the farms due in the run, which pay their shares at the end of it, see CROSS_FARM_THRESHOLD
+	crossFarmOwnersMutex sync.Mutex
+	crossFarmOwners      map[string]crossFarmOwner
+	payableFarms         []types.Farm
 }
 
-func NewPayService(config *infrastructure.Config, apiRequester ApiRequester, helper InfrastructureHelper, btcNetworkParams *types.BtcNetworkParams) *PayService {
+func NewPayService(config *infrastructure.Config, apiRequester ApiRequester, helper InfrastructureHelper, alerts Alerter, btcNetworkParams *types.BtcNetworkParams, secretProvider SecretProvider, priceSource PriceSource) *PayService {
 	return &PayService{
-		config:                    config,
-		helper:                    helper,
-		btcNetworkParams:          btcNetworkParams,
-		apiRequester:              apiRequester,
-		lastEmailTimestamp:        0,
-		btcWalletOpenFailsPerFarm: make(map[string]int),
+		config:           config,
+		helper:           helper,
+		alerts:           alerts,
+		btcNetworkParams: btcNetworkParams,
+		apiRequester:     apiRequester,
+		secretProvider:   secretProvider,
+		wallets:          newFarmWallets(config, apiRequester, helper, secretProvider, priceSource),
+		farmStatuses:     make(map[int64]FarmStatus),
 	}
 }
 
-// Processes all approved farms by iterating through them and calling the processFarm function for each farm.
+// Processes all approved farms by calling the processFarm function for each farm.
+// Up to FarmProcessingConcurrency farms are processed at the same time,
+// each farm works only with its own wallet, so farms do not wait on each other.
+// Farms paused through the admin api and farms that are not due according to their schedule are skipped.
+// The due farms are found before any farm is processed, so only their amounts count towards the cross-farm threshold.
 // In case of an error while processing a farm,
 // the function logs the error message
-// and sends an email notification (limited to once per half hour) to inform about the failure.
+// and sends an alert to inform about the failure. The alert is resolved once the farm is processed successfully.
 func (s *PayService) Execute(ctx context.Context, btcClient BtcClient, storage Storage) error {
 	farms, err := storage.GetApprovedFarms(ctx)
 	if err != nil {
 		return err
 	}
 
+	pausedFarmIds, err := storage.GetPausedFarmIds(ctx)
+	if err != nil {
+		return err
+	}
+
+	pausedFarms := make(map[int64]bool)
+	for _, farmId := range pausedFarmIds {
+		pausedFarms[farmId] = true
+	}
+
+	defaultSchedule, farmSchedules, err := s.loadFarmSchedules(ctx, storage)
+	if err != nil {
+		return err
+	}
+	now := time.Unix(s.helper.Unix(), 0).UTC()
+
+	// the report keeps the order of the farms, no matter which one is finished first
+	if s.isDryRun() {
+		for _, farm := range farms {
+			s.dryRunReport.addFarm(farm)
+		}
+	}
+
+	payableFarms := []types.Farm{}
+	// the last run of the farms that follow a schedule is saved after they are processed
+	scheduledFarms := make(map[int64]bool)
 	for _, farm := range farms {
-		if err := s.processFarm(ctx, btcClient, storage, farm); err != nil {
-			msg := fmt.Sprintf("processing farm {%s} failed. Error: %s", farm.RewardsFromPoolBtcWalletName, err)
-			// send email only once per half hour
-			if s.helper.Unix() >= s.lastEmailTimestamp+int64(time.Minute.Seconds()*30) {
-				s.helper.SendMail(msg)
-				s.lastEmailTimestamp = s.helper.Unix()
-			}
-			log.Error().Msg(msg)
+		if pausedFarms[farm.Id] {
+			log.Info().Msgf("Farm {%s} is paused, skipping it", farm.RewardsFromPoolBtcWalletName)
+			s.withDryRunReport(func(report *DryRunReport) { report.setFarmPaused(farm.Id) })
+			s.setFarmStatus(farm, true, nil)
+			continue
+		}
+
+		farmPaySchedule, due, err := s.isFarmDue(ctx, storage, farm, defaultSchedule, farmSchedules[farm.Id], now)
+		if err != nil {
+			s.setFarmStatus(farm, false, err)
+			s.farmFailed(ctx, farm, err)
+			continue
+		}
+
+		if !due {
+			log.Debug().Msgf("Farm {%s} is not due, skipping it", farm.RewardsFromPoolBtcWalletName)
 			continue
 		}
+
+		payableFarms = append(payableFarms, farm)
+		scheduledFarms[farm.Id] = farmPaySchedule != nil
 	}
+	s.setPayableFarms(payableFarms)
 
-	return nil
+	farmsSemaphore := make(chan struct{}, s.farmProcessingConcurrency())
+	var wg sync.WaitGroup
+
+	for _, farm := range payableFarms {
+		farmsSemaphore <- struct{}{}
+		wg.Add(1)
+		go func(farm types.Farm) {
+			defer wg.Done()
+			defer func() { <-farmsSemaphore }()
+
+			s.executeFarm(ctx, btcClient, storage, farm)
+
+			// a failed run is not repeated before the next window either, the failure is alerted instead
+			if scheduledFarms[farm.Id] {
+				if err := storage.SaveFarmLastRun(ctx, farm.Id, now); err != nil {
+					log.Error().Msgf("Failed to save the last run of farm {%s}: %s", farm.RewardsFromPoolBtcWalletName, err)
+				}
+			}
+		}(farm)
+	}
+
+	wg.Wait()
+
+	// the farms are done, so the wallets of the other farms are free to pay their shares
+	return s.payCrossFarmShares(ctx, btcClient, storage)
+}
+
+func (s *PayService) executeFarm(ctx context.Context, btcClient BtcClient, storage Storage, farm types.Farm) {
+	start := time.Now()
+	err := s.processFarm(ctx, btcClient, storage, farm)
+	metrics.FarmProcessingDuration.WithLabelValues(farm.RewardsFromPoolBtcWalletName).Observe(time.Since(start).Seconds())
+	s.setFarmStatus(farm, false, err)
+	if err == nil {
+		if !s.isDryRun() {
+			s.alerts.Resolve(ctx, farmAlertSource(farm))
+		}
+		return
+	}
+
+	s.farmFailed(ctx, farm, err)
+}
+
+func (s *PayService) farmFailed(ctx context.Context, farm types.Farm, err error) {
+	metrics.FarmProcessingFailures.WithLabelValues(farm.RewardsFromPoolBtcWalletName).Inc()
+	msg := fmt.Sprintf("processing farm {%s} failed. Error: %s", farm.RewardsFromPoolBtcWalletName, err)
+	log.Error().Msg(msg)
+
+	if s.isDryRun() {
+		s.withDryRunReport(func(report *DryRunReport) { report.setFarmError(farm.Id, err) })
+		return
+	}
+
+	s.alerts.Fire(ctx, farmAlertSource(farm), notifier.Notification{
+		Severity: notifier.SeverityWarning,
+		Title:    "Processing farm failed",
+		Message:  msg,
+		Farm:     farm.RewardsFromPoolBtcWalletName,
+		Error:    err.Error(),
+	})
+}
+
+func farmAlertSource(farm types.Farm) string {
+	return fmt.Sprintf("farm %s", farm.RewardsFromPoolBtcWalletName)
+}
+
+func (s *PayService) Dependencies() []string {
+	return []string{
+		metrics.EndpointBitcoind,
+		metrics.EndpointDb,
+		metrics.EndpointHasura,
+		metrics.EndpointCudosRest,
+		metrics.EndpointCudosRpc,
+		metrics.EndpointFoundry,
+	}
+}
+
+func (s *PayService) farmProcessingConcurrency() int {
+	if s.config == nil || s.config.FarmProcessingConcurrency < 1 {
+		return 1
+	}
+
+	return s.config.FarmProcessingConcurrency
+}
+
+// FarmStatuses returns the result of the last run for each farm, ordered by farm id
+func (s *PayService) FarmStatuses() []FarmStatus {
+	s.farmStatusesMutex.Lock()
+	defer s.farmStatusesMutex.Unlock()
+
+	farmStatuses := []FarmStatus{}
+	for _, farmStatus := range s.farmStatuses {
+		farmStatuses = append(farmStatuses, farmStatus)
+	}
+
+	sort.Slice(farmStatuses, func(i, j int) bool {
+		return farmStatuses[i].FarmId < farmStatuses[j].FarmId
+	})
+
+	return farmStatuses
+}
+
+func (s *PayService) setFarmStatus(farm types.Farm, paused bool, err error) {
+	s.farmStatusesMutex.Lock()
+	defer s.farmStatusesMutex.Unlock()
+
+	farmStatus := FarmStatus{
+		FarmId:    farm.Id,
+		FarmName:  farm.RewardsFromPoolBtcWalletName,
+		Paused:    paused,
+		LastRunAt: time.Unix(s.helper.Unix(), 0).UTC(),
+	}
+
+	if err != nil {
+		farmStatus.LastRunError = err.Error()
+	}
+
+	s.farmStatuses[farm.Id] = farmStatus
 }
 
 /*
 processFarm function processes a single farm by performing a series of steps:
 
 1. Validate the farm.
-2. Load the farm wallet.
-3. Get unspent transactions for the farm wallet.
-4. Get the last payment timestamp for the farm.
-5. Unlock the farm wallet.
-6. Process each unspent transaction for the farm.
-7. Lock the farm wallet after processing.
+2. Open the farm wallet, so it is not used by the retry service until the farm is processed.
+3. Load the farm wallet, if it is not loaded yet. Wallets stay loaded after processing.
+4. Recover the payouts of the farm that were interrupted after sending, so their UTXOs are not paid again.
+5. Get unspent transactions for the farm wallet.
+6. Get the last payment timestamp for the farm.
+7. Unlock the farm wallet. Skipped in dry run, since nothing is going to be sent.
+8. Process each unspent transaction for the farm.
+9. Lock the farm wallet after processing.
 */
 func (s *PayService) processFarm(ctx context.Context, btcClient BtcClient, storage Storage, farm types.Farm) error {
 	log.Debug().Msgf("Processing farm with name %s..", farm.RewardsFromPoolBtcWalletName)
@@ -78,27 +257,15 @@ func (s *PayService) processFarm(ctx context.Context, btcClient BtcClient, stora
 		return err
 	}
 
-	log.Debug().Msgf("Check for loaded wallets...")
-	rawMessage, err := btcClient.RawRequest("listwallets", []json.RawMessage{})
-	if err != nil {
-		return err
-	}
-
-	loadedWalletsNames := []string{}
-	err = json.Unmarshal(rawMessage, &loadedWalletsNames)
+	log.Debug().Msgf("Opening farm wallet...")
+	walletClient, releaseWallet, err := btcClient.OpenWallet(farm.RewardsFromPoolBtcWalletName)
 	if err != nil {
 		return err
 	}
+	defer releaseWallet()
 
-	if len(loadedWalletsNames) > 0 {
-		log.Debug().Msgf("Loaded wallets found. Unloading...")
-		for _, loadedWalletName := range loadedWalletsNames {
-			unloadWallet(btcClient, loadedWalletName)
-		}
-	}
-
-	log.Debug().Msgf("Loading farm wallet...")
-	loaded, err := s.loadWallet(btcClient, farm.RewardsFromPoolBtcWalletName)
+	log.Debug().Msgf("Loading farm wallet and recovering unfinished payouts for farm...")
+	loaded, err := s.wallets.prepareWallet(ctx, btcClient, walletClient, storage, farm)
 	if err != nil {
 		return err
 	}
@@ -106,10 +273,9 @@ func (s *PayService) processFarm(ctx context.Context, btcClient BtcClient, stora
 	if !loaded {
 		return nil
 	}
-	defer unloadWallet(btcClient, farm.RewardsFromPoolBtcWalletName)
 
 	log.Debug().Msgf("Getting unspent transactions for farm wallet...")
-	unspentTxsForFarm, err := s.getUnspentTxsForFarm(ctx, btcClient, storage, []string{farm.AddressForReceivingRewardsFromPool})
+	unspentTxsForFarm, err := s.wallets.getUnspentTxsForFarm(ctx, walletClient, storage, []string{farm.AddressForReceivingRewardsFromPool})
 	if err != nil {
 		return err
 	}
@@ -126,17 +292,19 @@ func (s *PayService) processFarm(ctx context.Context, btcClient BtcClient, stora
 		return err
 	}
 
-	log.Debug().Msgf("Unlocking farm wallet...")
-	err = btcClient.WalletPassphrase(s.config.AuraPoolTestFarmWalletPassword, 60)
-	if err != nil {
-		return err
+	if !s.isDryRun() {
+		log.Debug().Msgf("Unlocking farm wallet...")
+		err = unlockWallet(s.secretProvider, walletClient, farm.RewardsFromPoolBtcWalletName)
+		if err != nil {
+			return err
+		}
+		defer lockWallet(walletClient, farm.RewardsFromPoolBtcWalletName)
 	}
-	defer lockWallet(btcClient, farm.RewardsFromPoolBtcWalletName)
 
 	// for each payment
 	log.Debug().Msgf("Processing unspent transactions for farm...")
 	for _, unspentTxForFarm := range unspentTxsForFarm {
-		lastProcessedPaymentTimestamp, err := s.processFarmUnspentTx(ctx, btcClient, storage, farm, unspentTxForFarm, lastPaymentTimestamp)
+		lastProcessedPaymentTimestamp, err := s.processFarmUnspentTx(ctx, walletClient, storage, farm, unspentTxForFarm, lastPaymentTimestamp)
 		if err != nil {
 			return err
 		}
@@ -174,7 +342,7 @@ func (s *PayService) processFarmUnspentTx(
 	btcClient BtcClient,
 	storage Storage,
 	farm types.Farm,
-	unspentTxForFarm btcjson.ListUnspentResult,
+	unspentTxForFarm types.UnspentTx,
 	lastPaymentTimestamp int64,
 ) (int64, error) {
 	txRawResult, err := s.getUnspentTxDetails(ctx, btcClient, unspentTxForFarm)
@@ -185,17 +353,17 @@ func (s *PayService) processFarmUnspentTx(
 	// period end is the time the payment was made
 	periodEnd := txRawResult.Time
 
-	receivedRewardForFarmBtcDecimal := decimal.NewFromFloat(unspentTxForFarm.Amount)
-	totalRewardForFarmAfterCudosFeeBtcDecimal, cudosFeeOfTotalRewardBtcDecimal := s.calculateCudosFeeOfTotalFarmIncome(receivedRewardForFarmBtcDecimal)
+	receivedRewardForFarmSats := unspentTxForFarm.Amount
+	totalRewardForFarmAfterCudosFeeSats, cudosFeeOfTotalRewardSats := s.calculateCudosFeeOfTotalFarmIncome(receivedRewardForFarmSats)
 
 	log.Debug().Msgf("-------------------------------------------------")
 	log.Debug().Msgf("Processing Unspent TX: %s, Payment period: %d to %d", unspentTxForFarm.TxID, lastPaymentTimestamp, periodEnd)
-	log.Debug().Msgf("Total reward for farm \"%s\": %s", farm.RewardsFromPoolBtcWalletName, receivedRewardForFarmBtcDecimal)
-	log.Debug().Msgf("Cudos part of total farm reward: %s", cudosFeeOfTotalRewardBtcDecimal)
-	log.Debug().Msgf("Total reward for farm \"%s\" after cudos fee: %s", farm.RewardsFromPoolBtcWalletName, totalRewardForFarmAfterCudosFeeBtcDecimal)
+	log.Debug().Msgf("Total reward for farm \"%s\": %s", farm.RewardsFromPoolBtcWalletName, receivedRewardForFarmSats)
+	log.Debug().Msgf("Cudos part of total farm reward: %s", cudosFeeOfTotalRewardSats)
+	log.Debug().Msgf("Total reward for farm \"%s\" after cudos fee: %s", farm.RewardsFromPoolBtcWalletName, totalRewardForFarmAfterCudosFeeSats)
 
 	currentHashPowerForFarm := farm.TotalHashPower
-	log.Debug().Msgf("Total hash power for farm %s: %.6f", farm.RewardsFromPoolBtcWalletName, currentHashPowerForFarm)
+	log.Debug().Msgf("Total hash power for farm %s: %s TH/s", farm.RewardsFromPoolBtcWalletName, currentHashPowerForFarm)
 	hourlyMaintenanceFeePerThInBtcDecimal := s.calculateHourlyMaintenanceFee(farm, currentHashPowerForFarm)
 
 	farmCollectionsWithNFTs, farmAuraPoolCollectionsMap, err := s.getCollectionsWithNftsForFarm(ctx, storage, farm)
@@ -218,23 +386,23 @@ func (s *PayService) processFarmUnspentTx(
 
 	mintedHashPowerForFarm := sumMintedHashPowerForAllCollections(farmCollectionsWithNFTs)
 
-	log.Debug().Msgf("Minted hash for farm %s: %.6f", farm.RewardsFromPoolBtcWalletName, mintedHashPowerForFarm)
+	log.Debug().Msgf("Minted hash for farm %s: %s TH/s", farm.RewardsFromPoolBtcWalletName, mintedHashPowerForFarm)
 
-	rewardForNftOwnersBtcDecimal := calculateRewardByPercent(currentHashPowerForFarm, mintedHashPowerForFarm, totalRewardForFarmAfterCudosFeeBtcDecimal)
-	leftoverHashPower := currentHashPowerForFarm - mintedHashPowerForFarm // if hash power increased or not all of it is used as NFTs
-	var rewardToReturnBtcDecimal decimal.Decimal
+	rewardForNftOwnersSats := calculateRewardByPercent(currentHashPowerForFarm, mintedHashPowerForFarm, totalRewardForFarmAfterCudosFeeSats)
+	leftoverHashPower := currentHashPowerForFarm.Sub(mintedHashPowerForFarm) // if hash power increased or not all of it is used as NFTs
+	var rewardToReturnSats types.Sats
 
-	destinationAddressesWithAmountBtcDecimal := make(map[string]decimal.Decimal)
+	destinationAddressesWithAmountSats := make(map[string]types.Sats)
 
 	// add cudos fee on total farm income
-	addPaymentAmountToAddress(destinationAddressesWithAmountBtcDecimal, cudosFeeOfTotalRewardBtcDecimal, s.config.CUDOFeePayoutAddress)
+	addPaymentAmountToAddress(destinationAddressesWithAmountSats, cudosFeeOfTotalRewardSats, s.config.CUDOFeePayoutAddress)
 
 	// return to the farm owner whatever is left
-	if leftoverHashPower > 0 {
-		rewardToReturnBtcDecimal = totalRewardForFarmAfterCudosFeeBtcDecimal.Sub(rewardForNftOwnersBtcDecimal)
-		addLeftoverRewardToFarmOwner(destinationAddressesWithAmountBtcDecimal, rewardToReturnBtcDecimal, farm.LeftoverRewardPayoutAddress)
+	if leftoverHashPower.IsPositive() {
+		rewardToReturnSats = totalRewardForFarmAfterCudosFeeSats - rewardForNftOwnersSats
+		addLeftoverRewardToFarmOwner(destinationAddressesWithAmountSats, rewardToReturnSats, farm.LeftoverRewardPayoutAddress)
 	}
-	log.Debug().Msgf("rewardForNftOwners : %s, rewardToReturn: %s, farm: {%s}", rewardForNftOwnersBtcDecimal, rewardToReturnBtcDecimal, farm.RewardsFromPoolBtcWalletName)
+	log.Debug().Msgf("rewardForNftOwners : %s, rewardToReturn: %s, farm: {%s}", rewardForNftOwnersSats, rewardToReturnSats, farm.RewardsFromPoolBtcWalletName)
 
 	var statistics []types.NFTStatistics
 	var collectionPaymentAllocationsStatistics []types.CollectionPaymentAllocation
@@ -245,12 +413,12 @@ func (s *PayService) processFarmUnspentTx(
 			storage,
 			farm,
 			collection,
-			destinationAddressesWithAmountBtcDecimal,
-			rewardForNftOwnersBtcDecimal,
+			destinationAddressesWithAmountSats,
+			rewardForNftOwnersSats,
 			mintedHashPowerForFarm,
 			currentHashPowerForFarm,
-			totalRewardForFarmAfterCudosFeeBtcDecimal,
-			cudosFeeOfTotalRewardBtcDecimal,
+			totalRewardForFarmAfterCudosFeeSats,
+			cudosFeeOfTotalRewardSats,
 			hourlyMaintenanceFeePerThInBtcDecimal,
 			lastPaymentTimestamp,
 			periodEnd,
@@ -272,10 +440,10 @@ func (s *PayService) processFarmUnspentTx(
 		farm,
 		unspentTxForFarm,
 		periodEnd,
-		receivedRewardForFarmBtcDecimal,
-		rewardForNftOwnersBtcDecimal,
-		totalRewardForFarmAfterCudosFeeBtcDecimal,
-		destinationAddressesWithAmountBtcDecimal,
+		receivedRewardForFarmSats,
+		rewardForNftOwnersSats,
+		totalRewardForFarmAfterCudosFeeSats,
+		destinationAddressesWithAmountSats,
 		statistics,
 		collectionPaymentAllocationsStatistics,
 	); err != nil {
@@ -307,10 +475,11 @@ func (s *PayService) processCollection(
 	storage Storage,
 	farm types.Farm,
 	collection types.Collection,
-	destinationAddressesWithAmountBtcDecimal map[string]decimal.Decimal,
-	rewardForNftOwnersBtcDecimal decimal.Decimal,
-	mintedHashPowerForFarm, currentHashPowerForFarm float64,
-	totalRewardForFarmAfterCudosFeeBtcDecimal, cudosFeeOfTotalRewardBtcDecimal, hourlyMaintenanceFeePerThInBtcDecimal decimal.Decimal,
+	destinationAddressesWithAmountSats map[string]types.Sats,
+	rewardForNftOwnersSats types.Sats,
+	mintedHashPowerForFarm, currentHashPowerForFarm types.HashPower,
+	totalRewardForFarmAfterCudosFeeSats, cudosFeeOfTotalRewardSats types.Sats,
+	hourlyMaintenanceFeePerThInBtcDecimal decimal.Decimal,
 	periodStart, periodEnd int64,
 	farmAuraPoolCollectionsMap map[string]types.AuraPoolCollection,
 ) (CollectionProcessResult, error) {
@@ -339,9 +508,9 @@ func (s *PayService) processCollection(
 		ahsuraNftMintEventsMap[fmt.Sprint(hasuraNftMintEvent.TokenId)] = hasuraNftMintEvent
 	}
 
-	var CUDOMaintenanceFeeBtcDecimal decimal.Decimal
-	var farmMaintenanceFeeBtcDecimal decimal.Decimal
-	var nftRewardsAfterFeesBtcDecimal decimal.Decimal
+	var CUDOMaintenanceFeeSats types.Sats
+	var farmMaintenanceFeeSats types.Sats
+	var nftRewardsAfterFeesSats types.Sats
 
 	var nftStatistics []types.NFTStatistics
 
@@ -368,8 +537,8 @@ func (s *PayService) processCollection(
 			nft,
 			mintTimestamp,
 			nftTransferEventsMap[nft.Id],
-			destinationAddressesWithAmountBtcDecimal,
-			rewardForNftOwnersBtcDecimal,
+			destinationAddressesWithAmountSats,
+			rewardForNftOwnersSats,
 			mintedHashPowerForFarm,
 			hourlyMaintenanceFeePerThInBtcDecimal,
 			periodStart,
@@ -385,54 +554,52 @@ func (s *PayService) processCollection(
 			continue
 		}
 
-		CUDOMaintenanceFeeBtcDecimal = CUDOMaintenanceFeeBtcDecimal.Add(nftProcessResult.CudoPartOfMaintenanceFeeBtcDecimal)
-		farmMaintenanceFeeBtcDecimal = farmMaintenanceFeeBtcDecimal.Add(nftProcessResult.MaintenanceFeeBtcDecimal)
-		nftRewardsAfterFeesBtcDecimal = nftRewardsAfterFeesBtcDecimal.Add(nftProcessResult.RewardForNftAfterFeeBtcDecimal)
+		CUDOMaintenanceFeeSats += nftProcessResult.CudoPartOfMaintenanceFeeSats
+		farmMaintenanceFeeSats += nftProcessResult.MaintenanceFeeSats
+		nftRewardsAfterFeesSats += nftProcessResult.RewardForNftAfterFeeSats
 
 		nftStatistics = append(nftStatistics, types.NFTStatistics{
 			TokenId:                  nft.Id,
 			DenomId:                  collection.Denom.Id,
 			PayoutPeriodStart:        nftProcessResult.NftPeriodStart,
 			PayoutPeriodEnd:          nftProcessResult.NftPeriodEnd,
-			Reward:                   nftProcessResult.RewardForNftAfterFeeBtcDecimal,
-			MaintenanceFee:           nftProcessResult.MaintenanceFeeBtcDecimal,
-			CUDOPartOfMaintenanceFee: nftProcessResult.CudoPartOfMaintenanceFeeBtcDecimal,
+			Reward:                   nftProcessResult.RewardForNftAfterFeeSats,
+			MaintenanceFee:           nftProcessResult.MaintenanceFeeSats,
+			CUDOPartOfMaintenanceFee: nftProcessResult.CudoPartOfMaintenanceFeeSats,
 			NFTOwnersForPeriod:       nftProcessResult.NftOwnersForPeriod,
 		})
 
-		log.Debug().Msgf("Reward for nft with denomId {%s} and tokenId {%s} is %s", collection.Denom.Id, nft.Id, nftProcessResult.RewardForNftAfterFeeBtcDecimal)
-		log.Debug().Msgf("Maintenance fee for nft with denomId {%s} and tokenId {%s} is %s", collection.Denom.Id, nft.Id, nftProcessResult.MaintenanceFeeBtcDecimal)
-		log.Debug().Msgf("CUDO part (%.2f) of Maintenance fee for nft with denomId {%s} and tokenId {%s} is %s", s.config.CUDOMaintenanceFeePercent, collection.Denom.Id, nft.Id, nftProcessResult.CudoPartOfMaintenanceFeeBtcDecimal)
+		log.Debug().Msgf("Reward for nft with denomId {%s} and tokenId {%s} is %s", collection.Denom.Id, nft.Id, nftProcessResult.RewardForNftAfterFeeSats)
+		log.Debug().Msgf("Maintenance fee for nft with denomId {%s} and tokenId {%s} is %s", collection.Denom.Id, nft.Id, nftProcessResult.MaintenanceFeeSats)
+		log.Debug().Msgf("CUDO part (%.2f) of Maintenance fee for nft with denomId {%s} and tokenId {%s} is %s", s.config.CUDOMaintenanceFeePercent, collection.Denom.Id, nft.Id, nftProcessResult.CudoPartOfMaintenanceFeeSats)
 	}
 
 	// calculate collection's percent of rewards based on hash power
 	auraPoolCollection := farmAuraPoolCollectionsMap[collection.Denom.Id]
-	collectionPartOfFarmDecimal := decimal.NewFromFloat(auraPoolCollection.HashingPower / currentHashPowerForFarm)
-
-	collectionAwardAllocation := totalRewardForFarmAfterCudosFeeBtcDecimal.Mul(collectionPartOfFarmDecimal)
-	cudoGeneralFeeForCollection := cudosFeeOfTotalRewardBtcDecimal.Mul(collectionPartOfFarmDecimal)
-	CUDOMaintenanceFeeBtcDecimalForCollection := CUDOMaintenanceFeeBtcDecimal
-	farmMaintenanceFeeBtcDecimalForCollection := farmMaintenanceFeeBtcDecimal
-	farmLeftoverForCollection := collectionAwardAllocation.Sub(nftRewardsAfterFeesBtcDecimal).Sub(CUDOMaintenanceFeeBtcDecimalForCollection).Sub(farmMaintenanceFeeBtcDecimalForCollection)
+	collectionAwardAllocation := calculateRewardByPercent(currentHashPowerForFarm, auraPoolCollection.HashingPower, totalRewardForFarmAfterCudosFeeSats)
+	cudoGeneralFeeForCollection := calculateRewardByPercent(currentHashPowerForFarm, auraPoolCollection.HashingPower, cudosFeeOfTotalRewardSats)
+	CUDOMaintenanceFeeSatsForCollection := CUDOMaintenanceFeeSats
+	farmMaintenanceFeeSatsForCollection := farmMaintenanceFeeSats
+	farmLeftoverForCollection := collectionAwardAllocation - nftRewardsAfterFeesSats - CUDOMaintenanceFeeSatsForCollection - farmMaintenanceFeeSatsForCollection
 
 	collectionPaymentAllocation := types.CollectionPaymentAllocation{
 		FarmId:                     farm.Id,
 		CollectionId:               auraPoolCollection.Id,
 		CollectionAllocationAmount: collectionAwardAllocation,
 		CUDOGeneralFee:             cudoGeneralFeeForCollection,
-		CUDOMaintenanceFee:         CUDOMaintenanceFeeBtcDecimalForCollection,
+		CUDOMaintenanceFee:         CUDOMaintenanceFeeSatsForCollection,
 		FarmUnsoldLeftovers:        farmLeftoverForCollection,
-		FarmMaintenanceFee:         farmMaintenanceFeeBtcDecimalForCollection,
+		FarmMaintenanceFee:         farmMaintenanceFeeSatsForCollection,
 	}
 
-	log.Debug().Msgf("rewardForNftOwners : %s, rewardToReturn from collection: %s, farm: {%s}, collection: {%d}", nftRewardsAfterFeesBtcDecimal, farmLeftoverForCollection, farm.RewardsFromPoolBtcWalletName, auraPoolCollection.Id)
+	log.Debug().Msgf("rewardForNftOwners : %s, rewardToReturn from collection: %s, farm: {%s}, collection: {%d}", nftRewardsAfterFeesSats, farmLeftoverForCollection, farm.RewardsFromPoolBtcWalletName, auraPoolCollection.Id)
 
 	return CollectionProcessResult{
-		CUDOMaintenanceFeeBtcDecimal:  CUDOMaintenanceFeeBtcDecimal,
-		FarmMaintenanceFeeBtcDecimal:  farmMaintenanceFeeBtcDecimal,
-		NftRewardsAfterFeesBtcDecimal: nftRewardsAfterFeesBtcDecimal,
-		CollectionPaymentAllocation:   collectionPaymentAllocation,
-		NftStatistics:                 nftStatistics,
+		CUDOMaintenanceFeeSats:      CUDOMaintenanceFeeSats,
+		FarmMaintenanceFeeSats:      farmMaintenanceFeeSats,
+		NftRewardsAfterFeesSats:     nftRewardsAfterFeesSats,
+		CollectionPaymentAllocation: collectionPaymentAllocation,
+		NftStatistics:               nftStatistics,
 	}, nil
 }
 
@@ -463,9 +630,9 @@ func (s *PayService) processNft(
 	nft types.NFT,
 	mintTimestamp int64,
 	nftTransferHistory []types.NftTransferEvent,
-	destinationAddressesWithAmountBtcDecimal map[string]decimal.Decimal,
-	rewardForNftOwnersBtcDecimal decimal.Decimal,
-	mintedHashPowerForFarm float64,
+	destinationAddressesWithAmountSats map[string]types.Sats,
+	rewardForNftOwnersSats types.Sats,
+	mintedHashPowerForFarm types.HashPower,
 	hourlyMaintenanceFeePerThInBtcDecimal decimal.Decimal,
 	lastPaymentTimestamp int64,
 	periodEnd int64,
@@ -481,20 +648,20 @@ func (s *PayService) processNft(
 	}
 
 	// first calculate nft parf ot the farm as percent of hash power
-	totalRewardForNftBtcDecimal := calculateRewardByPercent(mintedHashPowerForFarm, nft.DataJson.HashRateOwned, rewardForNftOwnersBtcDecimal)
+	totalRewardForNftSats := calculateRewardByPercent(mintedHashPowerForFarm, nft.DataJson.HashRateOwned, rewardForNftOwnersSats)
 	// if nft was minted after the last payment, part of the reward before the mint is still for the farm
-	rewardForNftBtcDecimal := calculatePercentByTime(lastPaymentTimestamp, periodEnd, nftPeriodStart, nftPeriodEnd, totalRewardForNftBtcDecimal)
+	rewardForNftSats := calculatePercentByTime(lastPaymentTimestamp, periodEnd, nftPeriodStart, nftPeriodEnd, totalRewardForNftSats)
 
 	if nftPeriodStart < lastPaymentTimestamp {
 		nftPeriodStart = lastPaymentTimestamp
 	}
 
-	maintenanceFeeBtcDecimal, cudoPartOfMaintenanceFeeBtcDecimal, rewardForNftAfterFeeBtcDecimal, err := s.calculateMaintenanceFeeForNFT(
+	maintenanceFeeSats, cudoPartOfMaintenanceFeeSats, rewardForNftAfterFeeSats, err := s.calculateMaintenanceFeeForNFT(
 		nftPeriodStart,
 		nftPeriodEnd,
 		hourlyMaintenanceFeePerThInBtcDecimal,
 		nft.DataJson.HashRateOwned,
-		rewardForNftBtcDecimal,
+		rewardForNftSats,
 	)
 
 	if err != nil {
@@ -510,7 +677,7 @@ func (s *PayService) processNft(
 		nftPeriodEnd,
 		nft.Owner,
 		s.config.Network,
-		rewardForNftAfterFeeBtcDecimal,
+		rewardForNftAfterFeeSats,
 	)
 
 	if err != nil {
@@ -518,9 +685,9 @@ func (s *PayService) processNft(
 	}
 
 	return NftProcessResult{
-		CudoPartOfMaintenanceFeeBtcDecimal:         cudoPartOfMaintenanceFeeBtcDecimal,
-		MaintenanceFeeBtcDecimal:                   maintenanceFeeBtcDecimal,
-		RewardForNftAfterFeeBtcDecimal:             rewardForNftAfterFeeBtcDecimal,
+		CudoPartOfMaintenanceFeeSats:               cudoPartOfMaintenanceFeeSats,
+		MaintenanceFeeSats:                         maintenanceFeeSats,
+		RewardForNftAfterFeeSats:                   rewardForNftAfterFeeSats,
 		AllNftOwnersForTimePeriodWithRewardPercent: ownersCudosAddressWithPercentOwnedTime,
 		NftOwnersForPeriod:                         nftOwnersForPeriod,
 		NftPeriodStart:                             nftPeriodStart,
@@ -536,7 +703,7 @@ Additionally, it updates the threshold status for each address and saves the rew
 
  1. Calculate any leftover rewards that were not distributed to NFT owners.
  2. If there are any leftover rewards, add them to the farm owner's payout address.
- 3. Check if there are any addresses in the destinationAddressesWithAmountBtcDecimal map to pay rewards.
+ 3. Check if there are any addresses in the destinationAddressesWithAmountSats map to pay rewards.
     If not, return an error, since this is not a valid case.
     At least the farms address should be present in the map.
     TODO: Is there a case where the total payed amount to the farm is under the threshold?
@@ -545,63 +712,67 @@ Additionally, it updates the threshold status for each address and saves the rew
  5. Remove any addresses with zero rewards from the destination addresses list.
  6. Filter the payments based on the payment threshold.
     Update the addresses that have reached the payment threshold.
- 7. Convert the reward amounts to floats with 8 decimals (BTC type).
- 8. Send the rewards to the destination addresses.
-    If the transaction is successful, store the transaction hash.
- 9. Update the threshold statuses for the addresses.
- 10. Save the statistics for the rewards, NFT allocations, and payment allocations.
+ 7. Keep only the addresses that reached the threshold, their amounts are sent in whole satoshis.
+ 8. Save a payout intent with everything needed to finish the bookkeeping.
+    In dry run nothing is sent, the payment is added to the dry run report instead.
+ 9. Send the rewards to the destination addresses, with the intent idempotency key as transaction comment.
+    If the transaction is successful, mark the intent as sent with the transaction hash.
+ 10. In a single db transaction update the threshold statuses for the addresses, save the statistics
+    for the rewards, NFT allocations, and payment allocations, book the payment in the ledger and mark the intent as completed.
+    If the service dies anywhere after the intent is saved, recoverPayoutIntents finishes or rolls back the bookkeeping.
+ 11. Remember the owners that reached the threshold only with their amounts in all farms, their shares in all farms are paid at the end of the run.
 */
 func (s *PayService) sendRewards(
 	ctx context.Context,
 	btcClient BtcClient,
 	storage Storage,
 	farm types.Farm,
-	unspentTxForFarm btcjson.ListUnspentResult,
+	unspentTxForFarm types.UnspentTx,
 	periodEnd int64,
-	receivedRewardForFarmBtcDecimal, rewardForNftOwnersBtcDecimal, totalRewardForFarmAfterCudosFeeBtcDecimal decimal.Decimal,
-	destinationAddressesWithAmountBtcDecimal map[string]decimal.Decimal,
+	receivedRewardForFarmSats, rewardForNftOwnersSats, totalRewardForFarmAfterCudosFeeSats types.Sats,
+	destinationAddressesWithAmountSats map[string]types.Sats,
 	statistics []types.NFTStatistics,
 	collectionPaymentAllocationsStatistics []types.CollectionPaymentAllocation,
 ) error {
 	// distributing nft owners rewards
 	for _, nftStatistics := range statistics {
 		// distribute maintenance fees
-		addPaymentAmountToAddress(destinationAddressesWithAmountBtcDecimal, nftStatistics.MaintenanceFee, farm.MaintenanceFeePayoutAddress)
-		addPaymentAmountToAddress(destinationAddressesWithAmountBtcDecimal, nftStatistics.CUDOPartOfMaintenanceFee, s.config.CUDOMaintenanceFeePayoutAddress)
+		addPaymentAmountToAddress(destinationAddressesWithAmountSats, nftStatistics.MaintenanceFee, farm.MaintenanceFeePayoutAddress)
+		addPaymentAmountToAddress(destinationAddressesWithAmountSats, nftStatistics.CUDOPartOfMaintenanceFee, s.config.CUDOMaintenanceFeePayoutAddress)
 
 		// add cudos addresses to payout addresses so they can be saved in the db with the cudos address
 		// on send the btc address will be gotten if possible
 		for _, nftOwnersForPeriod := range nftStatistics.NFTOwnersForPeriod {
-			addPaymentAmountToAddress(destinationAddressesWithAmountBtcDecimal, nftOwnersForPeriod.Reward, nftOwnersForPeriod.Owner)
+			addPaymentAmountToAddress(destinationAddressesWithAmountSats, nftOwnersForPeriod.Reward, nftOwnersForPeriod.Owner)
 		}
 
 	}
 
 	log.Debug().Msgf("Calculating leftover rewards...")
 	// return to the farm owner whatever is left
-	leftoverNftRewardDistribution, err := calculateLeftoverNftRewardDistribution(rewardForNftOwnersBtcDecimal, statistics)
+	leftoverNftRewardDistribution, err := calculateLeftoverNftRewardDistribution(rewardForNftOwnersSats, statistics)
 	if err != nil {
 		return err
 	}
 
-	if leftoverNftRewardDistribution.GreaterThan(decimal.Zero) {
-		addLeftoverRewardToFarmOwner(destinationAddressesWithAmountBtcDecimal, leftoverNftRewardDistribution, farm.LeftoverRewardPayoutAddress)
+	if leftoverNftRewardDistribution > 0 {
+		addLeftoverRewardToFarmOwner(destinationAddressesWithAmountSats, leftoverNftRewardDistribution, farm.LeftoverRewardPayoutAddress)
 	}
 
-	if len(destinationAddressesWithAmountBtcDecimal) == 0 {
+	if len(destinationAddressesWithAmountSats) == 0 {
 		return fmt.Errorf("no addresses found to pay for Farm {%s}", farm.RewardsFromPoolBtcWalletName)
 	}
 
 	// check that all of the amount is distributed and no more than it
 	log.Debug().Msgf("Checking if total amount given is the same as distributed...")
-	if err := checkTotalAmountToDistribute(receivedRewardForFarmBtcDecimal, destinationAddressesWithAmountBtcDecimal); err != nil {
+	if err := checkTotalAmountToDistribute(receivedRewardForFarmSats, destinationAddressesWithAmountSats); err != nil {
 		return err
 	}
 
-	removeAddressesWithZeroReward(destinationAddressesWithAmountBtcDecimal)
+	removeAddressesWithZeroReward(destinationAddressesWithAmountSats)
 
 	log.Debug().Msgf("Filtering payments by payment threshold...")
-	addressesWithThresholdToUpdateBtcDecimal, addressesWithAmountInfo, cudosBtcAddressMap, err := s.filterByPaymentThreshold(ctx, destinationAddressesWithAmountBtcDecimal, storage, farm.Id)
+	addressesWithThresholdToUpdateSats, addressesWithAmountInfo, cudosBtcAddressMap, err := s.filterByPaymentThreshold(ctx, destinationAddressesWithAmountSats, storage, farm)
 	if err != nil {
 		return err
 	}
@@ -615,11 +786,8 @@ func (s *PayService) sendRewards(
 		}
 	}
 
-	log.Debug().Msgf("Destination addresses with amount for farm {%s}: {%s}", farm.RewardsFromPoolBtcWalletName, fmt.Sprint(destinationAddressesWithAmountBtcDecimal))
-	addressesToSendBtc, err := convertAmountToBTC(addressesWithAmountInfo)
-	if err != nil {
-		return err
-	}
+	log.Debug().Msgf("Destination addresses with amount for farm {%s}: {%s}", farm.RewardsFromPoolBtcWalletName, fmt.Sprint(destinationAddressesWithAmountSats))
+	addressesToSendBtc := filterAddressesToSend(addressesWithAmountInfo)
 
 	log.Debug().Msgf("Addresses above threshold that will be sent for farm {%s}: {%s}", farm.RewardsFromPoolBtcWalletName, fmt.Sprint(addressesToSendBtc))
 
@@ -629,37 +797,99 @@ func (s *PayService) sendRewards(
 		return err
 	}
 
-	var totalBalanceDistributed decimal.Decimal
+	var totalBalanceDistributed types.Sats
 	for _, amount := range addressesToSendBtc {
-		totalBalanceDistributed = totalBalanceDistributed.Add(decimal.NewFromFloat(amount))
+		totalBalanceDistributed += amount
 	}
-	for _, amount := range addressesWithThresholdToUpdateBtcDecimal {
-		totalBalanceDistributed = totalBalanceDistributed.Add(amount)
+	for _, amount := range addressesWithThresholdToUpdateSats {
+		totalBalanceDistributed += amount
 	}
 
-	if !totalBalanceDistributed.LessThanOrEqual(decimal.NewFromFloat(walletBalance.ToBTC())) {
+	// btcutil.Amount is in satoshis
+	if totalBalanceDistributed > types.Sats(walletBalance) {
 		return fmt.Errorf("total balance distributed {%s} is not equal to wallet balance {%s}", totalBalanceDistributed, walletBalance)
 	}
 
+	intent := newPayoutIntent(farm, unspentTxForFarm, types.PayoutIntentPayload{
+		FarmSubAccountName:                farm.RewardsFromPoolBtcWalletName,
+		PaymentTimestamp:                  periodEnd,
+		ReceivedRewardBtc:                 receivedRewardForFarmSats,
+		AddressesToSendBtc:                addressesToSendBtc,
+		AddressesWithAmountInfo:           addressesWithAmountInfo,
+		AddressesWithThresholdToUpdateBtc: addressesWithThresholdToUpdateSats,
+		NftStatistics:                     statistics,
+		CollectionPaymentAllocations:      collectionPaymentAllocationsStatistics,
+		LedgerAllocations:                 s.ledgerAllocations(farm, receivedRewardForFarmSats, totalRewardForFarmAfterCudosFeeSats, statistics),
+	})
+
+	log.Debug().Msgf("Saving payout intent {%s}...", intent.IdempotencyKey)
+	if err := storage.SavePayoutIntent(ctx, intent); err != nil {
+		return err
+	}
+	s.wallets.recordBtcPrices(ctx, storage, types.BtcPriceEventFarmPayment, unspentTxForFarm.TxID, farm.Id)
+
 	txHash := ""
-	if len(addressesToSendBtc) > 0 {
-		if txHash, err = s.apiRequester.SendMany(ctx, addressesToSendBtc); err != nil {
+	if s.isDryRun() {
+		payment := PaymentDryRunReport{
+			UnspentTxId:                  unspentTxForFarm.TxID,
+			PeriodEnd:                    periodEnd,
+			ReceivedRewardBtc:            receivedRewardForFarmSats,
+			RewardForNftOwnersBtc:        rewardForNftOwnersSats,
+			Destinations:                 newDestinationsDryRunReport(addressesWithAmountInfo),
+			AccumulatedAmountsBtc:        addressesWithThresholdToUpdateSats,
+			SendManyOutputs:              addressesToSendBtc,
+			NftStatistics:                statistics,
+			CollectionPaymentAllocations: collectionPaymentAllocationsStatistics,
+		}
+		s.withDryRunReport(func(report *DryRunReport) { report.addPayment(farm.Id, payment) })
+		log.Debug().Msgf("Dry run, skipping send for farm {%s}", farm.RewardsFromPoolBtcWalletName)
+	} else if len(addressesToSendBtc) > 0 {
+		// if this fails the intent stays pending and the recovery checks the wallet if anything was sent
+		if txHash, err = s.apiRequester.SendMany(ctx, farm.RewardsFromPoolBtcWalletName, addressesToSendBtc, intent.IdempotencyKey); err != nil {
 			return err
 		}
 		log.Debug().Msgf("Tx sucessfully sent! Tx Hash {%s}", txHash)
+		s.wallets.recordBtcPrices(ctx, storage, types.BtcPriceEventSendMany, txHash, farm.Id)
+
+		if err := storage.MarkPayoutIntentSent(ctx, intent.IdempotencyKey, txHash); err != nil {
+			log.Error().Msgf("Failed to mark payout intent {%s} as sent with tx hash {%s}: %s", intent.IdempotencyKey, txHash, err)
+			return err
+		}
 	}
 
-	log.Debug().Msgf("Updating threshold statuses...")
-	if err := storage.UpdateThresholdStatus(ctx, unspentTxForFarm.TxID, periodEnd, addressesWithThresholdToUpdateBtcDecimal, farm.Id); err != nil {
-		log.Error().Msgf("Failed to update threshold for tx hash {%s}: %s", txHash, err)
+	log.Debug().Msgf("Updating threshold statuses and saving statistics...")
+	if err := storage.FinalizePayoutIntent(ctx, intent, txHash); err != nil {
+		log.Error().Msgf("Failed to finalize payout intent {%s} for tx hash {%s}: %s", intent.IdempotencyKey, txHash, err)
 		return err
 	}
+	s.addCrossFarmOwners(farm, addressesWithAmountInfo, cudosBtcAddressMap)
 
-	log.Debug().Msgf("Saving statistics...")
-	if err := storage.SaveStatistics(ctx, receivedRewardForFarmBtcDecimal, collectionPaymentAllocationsStatistics, addressesWithAmountInfo, statistics, txHash, farm.Id, farm.RewardsFromPoolBtcWalletName); err != nil {
-		log.Error().Msgf("Failed to save statistics for tx hash {%s}: %s", txHash, err)
-		return err
+	if !s.isDryRun() {
+		addRewardsDistributedMetrics(farm, receivedRewardForFarmSats, totalRewardForFarmAfterCudosFeeSats, statistics)
 	}
 
 	return nil
 }
+
+// addRewardsDistributedMetrics splits the received reward by recipient class.
+// Whatever is not paid as fees or to the nft owners is returned to the farm as leftovers.
+func addRewardsDistributedMetrics(farm types.Farm, receivedRewardForFarmSats, totalRewardForFarmAfterCudosFeeSats types.Sats, statistics []types.NFTStatistics) {
+	cudoFeeSats := receivedRewardForFarmSats - totalRewardForFarmAfterCudosFeeSats
+	var maintenanceFeeSats types.Sats
+	var nftOwnersRewardSats types.Sats
+
+	for _, nftStatistics := range statistics {
+		maintenanceFeeSats += nftStatistics.MaintenanceFee
+		cudoFeeSats += nftStatistics.CUDOPartOfMaintenanceFee
+		for _, nftOwnersForPeriod := range nftStatistics.NFTOwnersForPeriod {
+			nftOwnersRewardSats += nftOwnersForPeriod.Reward
+		}
+	}
+
+	leftoversSats := receivedRewardForFarmSats - cudoFeeSats - maintenanceFeeSats - nftOwnersRewardSats
+
+	metrics.AddRewardsDistributed(farm.RewardsFromPoolBtcWalletName, metrics.RecipientCudoFee, cudoFeeSats.Btc())
+	metrics.AddRewardsDistributed(farm.RewardsFromPoolBtcWalletName, metrics.RecipientMaintenance, maintenanceFeeSats.Btc())
+	metrics.AddRewardsDistributed(farm.RewardsFromPoolBtcWalletName, metrics.RecipientNftOwners, nftOwnersRewardSats.Btc())
+	metrics.AddRewardsDistributed(farm.RewardsFromPoolBtcWalletName, metrics.RecipientLeftovers, leftoversSats.Btc())
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/schedule"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/rs/zerolog/log"
+)
+
+type forcedRunKey struct{}
+
+// WithForcedRun makes the pay service process all farms, no matter if they are due, e.g. for the runs triggered through the admin api
+func WithForcedRun(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forcedRunKey{}, true)
+}
+
+// IsForcedRun tells if the run was started with WithForcedRun
+func IsForcedRun(ctx context.Context) bool {
+	forced, _ := ctx.Value(forcedRunKey{}).(bool)
+	return forced
+}
+
+// loadFarmSchedules returns the default pay schedule and the schedules stored for the farms by farm id.
+// Without PAY_SCHEDULE the default schedule is nil and the farms without their own schedule are processed on every run.
+func (s *PayService) loadFarmSchedules(ctx context.Context, storage Storage) (schedule.Schedule, map[int64]types.FarmSchedule, error) {
+	var defaultSchedule schedule.Schedule
+	if s.config != nil && s.config.PaySchedule != "" {
+		var err error
+		if defaultSchedule, err = schedule.Parse(s.config.PaySchedule, s.config.ScheduleTimezone); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	farmSchedules, err := storage.GetFarmSchedules(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	farmSchedulesById := make(map[int64]types.FarmSchedule)
+	for _, farmSchedule := range farmSchedules {
+		farmSchedulesById[farmSchedule.FarmId] = farmSchedule
+	}
+
+	return defaultSchedule, farmSchedulesById, nil
+}
+
+/*
+isFarmDue tells if the farm has to be processed in this run and returns the schedule it follows.
+
+ 1. Farms follow their own schedule if they have one, otherwise the default one. Farms without any schedule are always due.
+ 2. A farm is due once the next run time after its last scheduled run has passed.
+ 3. A farm that has not run on a schedule yet is not processed right away. Its first run is at the next run time of the schedule,
+    so a new schedule does not pay the farm outside of its window.
+ 4. In dry run and in forced runs all farms are due.
+*/
+func (s *PayService) isFarmDue(ctx context.Context, storage Storage, farm types.Farm, defaultSchedule schedule.Schedule, farmSchedule types.FarmSchedule, now time.Time) (schedule.Schedule, bool, error) {
+	farmPaySchedule := defaultSchedule
+	if farmSchedule.Schedule != "" {
+		var err error
+		if farmPaySchedule, err = schedule.Parse(farmSchedule.Schedule, farmSchedule.Timezone); err != nil {
+			return nil, false, fmt.Errorf("farm {%s} has an invalid schedule: %s", farm.RewardsFromPoolBtcWalletName, err)
+		}
+	}
+
+	if farmPaySchedule == nil || s.isDryRun() || IsForcedRun(ctx) {
+		return farmPaySchedule, true, nil
+	}
+
+	if farmSchedule.LastRunAt == nil {
+		log.Info().Msgf("Farm {%s} is scheduled, first run at %s", farm.RewardsFromPoolBtcWalletName, farmPaySchedule.Next(now).UTC().Format(time.RFC3339))
+		return farmPaySchedule, false, storage.SaveFarmLastRun(ctx, farm.Id, now)
+	}
+
+	nextRun := farmPaySchedule.Next(*farmSchedule.LastRunAt)
+	return farmPaySchedule, !nextRun.IsZero() && !nextRun.After(now), nil
+}
@@ -4,19 +4,17 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"strconv"
 	"strings"
 
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/rs/zerolog/log"
-	"github.com/shopspring/decimal"
 )
 
 // gets the details for a single unspent transaction from the BTC node
 // this is needed for the timestamp of the TX
-func (s *PayService) getUnspentTxDetails(ctx context.Context, btcClient BtcClient, unspentResult btcjson.ListUnspentResult) (btcjson.TxRawResult, error) {
+func (s *PayService) getUnspentTxDetails(ctx context.Context, btcClient BtcClient, unspentResult types.UnspentTx) (btcjson.TxRawResult, error) {
 	txHash, err := chainhash.NewHashFromStr(unspentResult.TxID)
 	if err != nil {
 		return btcjson.TxRawResult{}, err
@@ -30,22 +28,6 @@ func (s *PayService) getUnspentTxDetails(ctx context.Context, btcClient BtcClien
 	return *txRawResult, nil
 }
 
-// gets all the unspent transactions for the farm wallet
-// the farm wallet must fisrst be loaded
-func (s *PayService) getUnspentTxsForFarm(ctx context.Context, btcClient BtcClient, storage Storage, farmAddresses []string) ([]btcjson.ListUnspentResult, error) {
-	unspentTransactions, err := btcClient.ListUnspent()
-	if err != nil {
-		return nil, err
-	}
-
-	validUnspentTransactions, err := filterUnspentTransactions(ctx, unspentTransactions, storage, farmAddresses)
-	if err != nil {
-		return nil, err
-	}
-
-	return validUnspentTransactions, nil
-}
-
 // tries to get the collection from BDJuno
 // it also check there if it is verified
 // basically if a collection is not verified (minted), it does not exist on the chain
@@ -149,33 +131,45 @@ func (s *PayService) findCurrentPayoutPeriod(payoutTimes []types.NFTStatistics,
 	return payoutTimes[l-1].PayoutPeriodEnd, nil // last time we paid until now
 }
 
-// filterByPaymentThreshold filters the destinationAddressesWithAmountsBtcDecimal map by the payment threshold value.
+// filterByPaymentThreshold filters the destinationAddressesWithAmountsSats map by the payment threshold value.
+// The threshold of each address is resolved by payoutThresholds, from the address, the farm and the global threshold.
+// With CROSS_FARM_THRESHOLD the amounts of a nft owner in the other farms count towards the threshold too.
+// An owner that reaches it only that way is not paid by this farm yet, the amount keeps accumulating with CrossFarm set
+// and is paid at the end of the run, once the shares of the other farms have been sent, see payCrossFarmShares.
 // If the total accumulated amount for an address is greater than or equal to the payment threshold value, the function
 // sets the thresholdReached flag to true in the returned addressesToSend map, otherwise, it sets the flag to false.
 // The function also updates the accumulated amount for each address based on the amount sent, and returns the
-// updated addressesWithThresholdToUpdateBtcDecimal map.
+// updated addressesWithThresholdToUpdateSats map.
 // Returns:
-// - map[string]decimal.Decimal: A map with the destination addresses as keys and the updated accumulated amounts as values.
+// - map[string]types.Sats: A map with the destination addresses as keys and the updated accumulated amounts as values.
 // - map[string]types.AmountInfo: A map with the destination addresses as keys and the amount to send and thresholdReached flag as values.
 // - error: An error encountered during the function execution, if any.
-func (s *PayService) filterByPaymentThreshold(ctx context.Context, destinationAddressesWithAmountsBtcDecimal map[string]decimal.Decimal, storage Storage, farmId int64) (map[string]decimal.Decimal, map[string]types.AmountInfo, map[string]string, error) {
-	thresholdInBtcDecimal := decimal.NewFromFloat(s.config.GlobalPayoutThresholdInBTC)
+func (s *PayService) filterByPaymentThreshold(ctx context.Context, destinationAddressesWithAmountsSats map[string]types.Sats, storage Storage, farm types.Farm) (map[string]types.Sats, map[string]types.AmountInfo, map[string]string, error) {
+	thresholds, err := s.getPayoutThresholds(ctx, storage, farm)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	crossFarmAccruals, err := s.getCrossFarmAccruals(ctx, storage, farm)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-	addressesWithThresholdToUpdateBtcDecimal := make(map[string]decimal.Decimal)
+	addressesWithThresholdToUpdateSats := make(map[string]types.Sats)
 
 	addressesToSend := make(map[string]types.AmountInfo)
 
 	var cudosBtcAddressMap = make(map[string]string)
 
-	for address, amountForAddress := range destinationAddressesWithAmountsBtcDecimal {
+	for address, amountForAddress := range destinationAddressesWithAmountsSats {
 		// get accumulation for cudos address and add it to current
-		amountAccumulatedBtcDecimal, err := storage.GetCurrentAcummulatedAmountForAddress(ctx, address, farmId)
+		amountAccumulatedSats, err := storage.GetCurrentAcummulatedAmountForAddress(ctx, address, farm.Id)
 
 		if err != nil {
 			switch err {
 			case sql.ErrNoRows:
 				log.Info().Msgf("No threshold found, inserting...")
-				err = storage.SetInitialAccumulatedAmountForAddress(ctx, address, farmId, 0)
+				err = storage.SetInitialAccumulatedAmountForAddress(ctx, address, farm.Id, 0)
 				if err != nil {
 					return nil, nil, nil, err
 				}
@@ -197,47 +191,63 @@ func (s *PayService) filterByPaymentThreshold(ctx context.Context, destinationAd
 
 			if nftPayoutAddress != "" {
 				addressToSend = nftPayoutAddress
-				btcAddressAmount, err := storage.GetCurrentAcummulatedAmountForAddress(ctx, nftPayoutAddress, farmId)
+				btcAddressAmount, err := storage.GetCurrentAcummulatedAmountForAddress(ctx, nftPayoutAddress, farm.Id)
 				if err != nil && err != sql.ErrNoRows {
 					return nil, nil, nil, err
 				}
 
-				amountAccumulatedBtcDecimal = amountAccumulatedBtcDecimal.Add(btcAddressAmount)
+				amountAccumulatedSats += btcAddressAmount
 
-				addressesWithThresholdToUpdateBtcDecimal[nftPayoutAddress] = decimal.Zero
+				addressesWithThresholdToUpdateSats[nftPayoutAddress] = 0
 			}
 		}
 
 		// get accumulation for btc address as well and add it to current
-		totalAmountAccumulatedForAddressBtcDecimal := amountAccumulatedBtcDecimal.Add(amountForAddress)
-		amountToSendBtcDecimal := totalAmountAccumulatedForAddressBtcDecimal.RoundFloor(8) // up to 1 satoshi
+		totalAmountAccumulatedForAddressSats := amountAccumulatedSats + amountForAddress
+
+		thresholdInSats, err := thresholds.resolve(ctx, address, addressToSend)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		thresholdReached := totalAmountAccumulatedForAddressSats >= thresholdInSats
+		crossFarm := false
+		if !thresholdReached && crossFarmAccruals != nil && isCudosAddress(address) && !isCudosAddress(addressToSend) {
+			otherFarmsAmountSats, err := crossFarmAccruals.otherFarms(ctx, address, addressToSend)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+
+			crossFarm = totalAmountAccumulatedForAddressSats+otherFarmsAmountSats >= thresholdInSats
+			thresholdReached = crossFarm
+		}
 
 		// if the address was cudos and there is registered btc address for it
 		// addressToSend should be set to the btc address and used
 		// if not, cudos address will be used
-		if totalAmountAccumulatedForAddressBtcDecimal.GreaterThanOrEqual(thresholdInBtcDecimal) && !isCudosAddress(addressToSend) {
-			// threshold reached, get amount to send up to 1 satoshi accuracy
-			// subtract it from the total amount to reset the threshold with w/e is left
-			addressesWithThresholdToUpdateBtcDecimal[address] = totalAmountAccumulatedForAddressBtcDecimal.Sub(amountToSendBtcDecimal)
+		if thresholdReached && !crossFarm && !isCudosAddress(addressToSend) {
+			// threshold reached, the whole accumulated amount is sent and the threshold is reset
+			addressesWithThresholdToUpdateSats[address] = 0
 			// if going to send for this address, use the btc one
-			addressesToSend[addressToSend] = types.AmountInfo{Amount: amountToSendBtcDecimal, ThresholdReached: true}
+			addressesToSend[addressToSend] = types.AmountInfo{Amount: totalAmountAccumulatedForAddressSats, ThresholdReached: true}
 		} else {
-			addressesWithThresholdToUpdateBtcDecimal[address] = totalAmountAccumulatedForAddressBtcDecimal
-			addressesToSend[address] = types.AmountInfo{Amount: amountToSendBtcDecimal, ThresholdReached: false}
+			// an owner over the threshold only with the other farms is held, it is paid at the end of the run after the other farms
+			addressesWithThresholdToUpdateSats[address] = totalAmountAccumulatedForAddressSats
+			addressesToSend[address] = types.AmountInfo{Amount: totalAmountAccumulatedForAddressSats, ThresholdReached: false, CrossFarm: crossFarm}
 		}
 	}
 
-	return addressesWithThresholdToUpdateBtcDecimal, addressesToSend, cudosBtcAddressMap, nil
+	return addressesWithThresholdToUpdateSats, addressesToSend, cudosBtcAddressMap, nil
 }
 
 // filterUnspentTransactions filters the given list of unspent transactions by removing transactions that
 // have already been processed and change transactions. A change transaction is a transaction that is
 // sending funds back to the farm addresses.
 // Returns:
-// - []btcjson.ListUnspentResult: A filtered list of unspent transactions.
+// - []types.UnspentTx: A filtered list of unspent transactions.
 // - error: An error encountered during the function execution, if any.
-func filterUnspentTransactions(ctx context.Context, transactions []btcjson.ListUnspentResult, storage Storage, farmAddresses []string) ([]btcjson.ListUnspentResult, error) {
-	var validTransactions []btcjson.ListUnspentResult
+func filterUnspentTransactions(ctx context.Context, transactions []types.UnspentTx, storage Storage, farmAddresses []string) ([]types.UnspentTx, error) {
+	var validTransactions []types.UnspentTx
 	for _, unspentTx := range transactions {
 		isTransactionProcessed, err := isTransactionProcessed(ctx, unspentTx, storage)
 		if err != nil {
@@ -255,7 +265,7 @@ func filterUnspentTransactions(ctx context.Context, transactions []btcjson.ListU
 // is a transaction that is sending funds back to the farm addresses.
 // Returns:
 // - bool: Returns true if the unspent transaction is a change transaction, false otherwise.
-func isChangeTransaction(unspentTx btcjson.ListUnspentResult, farmAddresses []string) bool {
+func isChangeTransaction(unspentTx types.UnspentTx, farmAddresses []string) bool {
 	for _, address := range farmAddresses {
 		if address == unspentTx.Address {
 			return false
@@ -268,7 +278,7 @@ func isChangeTransaction(unspentTx btcjson.ListUnspentResult, farmAddresses []st
 // Returns:
 // - bool: Returns true if the transaction has been processed, false otherwise.
 // - error: An error encountered during the function execution, if any.
-func isTransactionProcessed(ctx context.Context, unspentTx btcjson.ListUnspentResult, storage Storage) (bool, error) {
+func isTransactionProcessed(ctx context.Context, unspentTx types.UnspentTx, storage Storage) (bool, error) {
 	transaction, err := storage.GetUTXOTransaction(ctx, unspentTx.TxID)
 	switch err {
 	case nil:
@@ -283,51 +293,44 @@ func isTransactionProcessed(ctx context.Context, unspentTx btcjson.ListUnspentRe
 // removeAddressesWithZeroReward utilised in case we had a maintenance fee greater than the nft reward.
 // keys with 0 value were added in order to have statistics even for 0 reward
 // and in order to avoid sending them as 0 - just remove them but still keep statistic
-func removeAddressesWithZeroReward(destinationAddressesWithAmount map[string]decimal.Decimal) {
+func removeAddressesWithZeroReward(destinationAddressesWithAmount map[string]types.Sats) {
 	for key := range destinationAddressesWithAmount {
-		if destinationAddressesWithAmount[key].IsZero() {
+		if destinationAddressesWithAmount[key] == 0 {
 			delete(destinationAddressesWithAmount, key)
 		}
 	}
 }
 
-// convertAmountToBTC converts the amounts in the destinationAddressesWithAmount map from decimal to
-// float64 and filters the map to only include the addresses where the threshold has been reached.
-// The returned map contains the destination addresses as keys and the amounts in BTC as float64 values.
+// filterAddressesToSend filters the destinationAddressesWithAmount map to only include the addresses where the threshold has been reached.
+// The returned map contains the destination addresses as keys and the amounts in satoshis as values,
+// they are written in BTC when sent to the btc node.
 //
 // Parameters:
 //   - destinationAddressesWithAmount map[string]types.AmountInfo: A map with the destination addresses as keys
 //     and the amount and thresholdReached flag as values.
 //
 // Returns:
-// - map[string]float64: A map with the destination addresses as keys and the amounts in BTC as float64 values.
-// - error: An error encountered during the conversion, if any.
-func convertAmountToBTC(destinationAddressesWithAmount map[string]types.AmountInfo) (map[string]float64, error) {
-	result := make(map[string]float64)
+// - map[string]types.Sats: A map with the destination addresses as keys and the amounts to send as values.
+func filterAddressesToSend(destinationAddressesWithAmount map[string]types.AmountInfo) map[string]types.Sats {
+	result := make(map[string]types.Sats)
 	for k, v := range destinationAddressesWithAmount {
 		if v.ThresholdReached {
-			amountString := v.Amount.String()
-			amountFloat, err := strconv.ParseFloat(amountString, 64)
-			if err != nil {
-				return nil, err
-			}
-
-			result[k] = amountFloat
+			result[k] = v.Amount
 		}
 	}
-	return result, nil
+	return result
 }
 
 // addPaymentAmountToAddress adds the specified amount (amountToAdd) to the corresponding address (address) in the
 // destinationAddressesWithAmount map.
 //
 // Parameters:
-//   - destinationAddressesWithAmount map[string]decimal.Decimal: A map with the destination addresses as keys
+//   - destinationAddressesWithAmount map[string]types.Sats: A map with the destination addresses as keys
 //     and the accumulated amounts as values.
-//   - amountToAdd decimal.Decimal: The amount to be added to the specified address.
+//   - amountToAdd types.Sats: The amount to be added to the specified address.
 //   - address string: The address to which the amount will be added.
-func addPaymentAmountToAddress(destinationAddressesWithAmount map[string]decimal.Decimal, amountToAdd decimal.Decimal, address string) {
-	destinationAddressesWithAmount[address] = destinationAddressesWithAmount[address].Add(amountToAdd)
+func addPaymentAmountToAddress(destinationAddressesWithAmount map[string]types.Sats, amountToAdd types.Sats, address string) {
+	destinationAddressesWithAmount[address] += amountToAdd
 }
 
 func isCudosAddress(address string) bool {
@@ -340,14 +343,14 @@ func isCudosAddress(address string) bool {
 // Otherwise, a new entry is created with the farm owner's default payout address and the leftover reward as the value.
 //
 // Parameters:
-//   - destinationAddressesWithAmount map[string]decimal.Decimal: A map with the destination addresses as keys
+//   - destinationAddressesWithAmount map[string]types.Sats: A map with the destination addresses as keys
 //     and the accumulated amounts as values.
-//   - leftoverReward decimal.Decimal: The leftover reward amount to be added.
+//   - leftoverReward types.Sats: The leftover reward amount to be added.
 //   - farmDefaultPayoutAddress string: The farm owner's default payout address.
-func addLeftoverRewardToFarmOwner(destinationAddressesWithAmount map[string]decimal.Decimal, leftoverReward decimal.Decimal, farmDefaultPayoutAddress string) {
+func addLeftoverRewardToFarmOwner(destinationAddressesWithAmount map[string]types.Sats, leftoverReward types.Sats, farmDefaultPayoutAddress string) {
 	if _, ok := destinationAddressesWithAmount[farmDefaultPayoutAddress]; ok {
 		// log to statistics here if we are doing accumulation send for an nft
-		destinationAddressesWithAmount[farmDefaultPayoutAddress] = destinationAddressesWithAmount[farmDefaultPayoutAddress].Add(leftoverReward)
+		destinationAddressesWithAmount[farmDefaultPayoutAddress] += leftoverReward
 	} else {
 		destinationAddressesWithAmount[farmDefaultPayoutAddress] = leftoverReward
 	}
@@ -382,32 +385,6 @@ func validateFarm(farm types.Farm) error {
 	return nil
 }
 
-// loadWallet attempts to load the specified Bitcoin wallet using the given BTC client.
-// If the wallet fails to load for 15 consecutive attempts, the function returns an error.
-// The function returns a boolean to indicate whether the wallet was successfully loaded or not.
-// If the wallet is loaded successfully - nullate the fail counter for the wallet.
-// Returns:
-// - bool: True if the wallet was successfully loaded, false otherwise.
-// - error: An error indicating the reason for the wallet load failure, if any.
-func (s *PayService) loadWallet(btcClient BtcClient, farmName string) (bool, error) {
-	_, err := btcClient.LoadWallet(farmName)
-	if err != nil {
-		s.btcWalletOpenFailsPerFarm[farmName]++
-		if s.btcWalletOpenFailsPerFarm[farmName] >= 15 {
-			s.btcWalletOpenFailsPerFarm[farmName] = 0
-			return false, fmt.Errorf("failed to load wallet %s for 15 times", farmName)
-		}
-
-		log.Warn().Msgf("Failed to load wallet %s for %d consecutive times: %s", farmName, s.btcWalletOpenFailsPerFarm[farmName], err)
-		return false, nil
-	}
-
-	s.btcWalletOpenFailsPerFarm[farmName] = 0
-	log.Debug().Msgf("Farm Wallet: {%s} loaded", farmName)
-
-	return true, nil
-}
-
 // getLastUTXOTransactionTimestamp retrieves the timestamp of the last UTXO transaction for the specified farm
 // using the provided Storage. If no previous transaction is found, the function returns the farm
 // start time.
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
@@ -14,7 +15,6 @@ import (
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
-	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -23,7 +23,7 @@ import (
 func TestGetUnspentTxDetails_Success(t *testing.T) {
 	ctx := context.Background()
 	txID := "3a7e47e76d63e7f9a1e0b8d8f1f0f0c200a15a19c8e2e0a2a1a0f64e9d6ab8f1"
-	unspentResult := btcjson.ListUnspentResult{TxID: txID}
+	unspentResult := types.UnspentTx{TxID: txID}
 
 	expectedHash, _ := chainhash.NewHashFromStr(txID)
 	expectedTxRawResult := btcjson.TxRawResult{
@@ -33,7 +33,7 @@ func TestGetUnspentTxDetails_Success(t *testing.T) {
 
 	btcClient := new(mockBtcClient)
 	btcClient.On("GetRawTransactionVerbose", expectedHash).Return(&expectedTxRawResult, nil).Once()
-	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &types.BtcNetworkParams{})
+	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 
 	txRawResult, err := payService.getUnspentTxDetails(ctx, btcClient, unspentResult)
 
@@ -44,9 +44,9 @@ func TestGetUnspentTxDetails_Success(t *testing.T) {
 
 func TestGetUnspentTxDetails_InvalidTxID(t *testing.T) {
 	ctx := context.Background()
-	unspentResult := btcjson.ListUnspentResult{TxID: "invalid_tx_id"}
+	unspentResult := types.UnspentTx{TxID: "invalid_tx_id"}
 
-	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &types.BtcNetworkParams{})
+	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 
 	_, err := payService.getUnspentTxDetails(ctx, nil, unspentResult)
 
@@ -56,7 +56,7 @@ func TestGetUnspentTxDetails_InvalidTxID(t *testing.T) {
 func TestGetUnspentTxDetails_GetRawTransactionVerboseError(t *testing.T) {
 	ctx := context.Background()
 	txID := "3a7e47e76d63e7f9a1e0b8d8f1f0f0c200a15a19c8e2e0a2a1a0f64e9d6ab8f1"
-	unspentResult := btcjson.ListUnspentResult{TxID: txID}
+	unspentResult := types.UnspentTx{TxID: txID}
 
 	expectedHash, _ := chainhash.NewHashFromStr(txID)
 	expectedError := errors.New("get_raw_transaction_error")
@@ -64,7 +64,7 @@ func TestGetUnspentTxDetails_GetRawTransactionVerboseError(t *testing.T) {
 	btcClient := new(mockBtcClient)
 	btcClient.On("GetRawTransactionVerbose", expectedHash).Return(&btcjson.TxRawResult{}, expectedError).Once()
 
-	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &types.BtcNetworkParams{})
+	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 
 	_, err := payService.getUnspentTxDetails(ctx, btcClient, unspentResult)
 
@@ -77,13 +77,13 @@ func TestGetUnspentTxsForFarm_Success(t *testing.T) {
 	ctx := context.Background()
 	farmAddresses := []string{"address1", "address2"}
 
-	unspentTransactions := []btcjson.ListUnspentResult{
+	unspentTransactions := []types.UnspentTx{
 		{TxID: "tx1", Address: "address1"},
 		{TxID: "tx2", Address: "address2"},
 		{TxID: "tx3", Address: "address3"},
 	}
 
-	filteredUnspentTransactions := []btcjson.ListUnspentResult{
+	filteredUnspentTransactions := []types.UnspentTx{
 		{TxID: "tx1", Address: "address1"},
 		{TxID: "tx2", Address: "address2"},
 	}
@@ -106,9 +106,9 @@ func TestGetUnspentTxsForFarm_Success(t *testing.T) {
 	storage.On("GetUTXOTransaction", mock.Anything, "tx2").Return(utxo2, nil)
 	storage.On("GetUTXOTransaction", mock.Anything, "tx3").Return(types.UTXOTransaction{}, nil)
 
-	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &types.BtcNetworkParams{})
+	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 
-	validUnspentTxs, err := payService.getUnspentTxsForFarm(ctx, btcClient, storage, farmAddresses)
+	validUnspentTxs, err := payService.wallets.getUnspentTxsForFarm(ctx, btcClient, storage, farmAddresses)
 
 	assert.NoError(t, err)
 	assert.Equal(t, filteredUnspentTransactions, validUnspentTxs)
@@ -123,11 +123,11 @@ func TestGetUnspentTxsForFarm_ListUnspentError(t *testing.T) {
 	expectedError := errors.New("list_unspent_error")
 
 	btcClient := new(mockBtcClient)
-	btcClient.On("ListUnspent").Return([]btcjson.ListUnspentResult{}, expectedError)
+	btcClient.On("ListUnspent").Return([]types.UnspentTx{}, expectedError)
 
-	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &types.BtcNetworkParams{})
+	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 
-	_, err := payService.getUnspentTxsForFarm(ctx, btcClient, nil, farmAddresses)
+	_, err := payService.wallets.getUnspentTxsForFarm(ctx, btcClient, nil, farmAddresses)
 
 	assert.Error(t, err)
 	assert.Equal(t, expectedError, err)
@@ -138,7 +138,7 @@ func TestGetUnspentTxsForFarm_StorageError(t *testing.T) {
 	ctx := context.Background()
 	farmAddresses := []string{"address1", "address2"}
 
-	unspentTransactions := []btcjson.ListUnspentResult{
+	unspentTransactions := []types.UnspentTx{
 		{TxID: "tx1", Address: "address1"},
 		{TxID: "tx2", Address: "address2"},
 		{TxID: "tx3", Address: "address3"},
@@ -152,9 +152,9 @@ func TestGetUnspentTxsForFarm_StorageError(t *testing.T) {
 	storage := new(mockStorage)
 	storage.On("GetUTXOTransaction", mock.Anything, "tx1").Return(types.UTXOTransaction{}, expectedError)
 
-	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &types.BtcNetworkParams{})
+	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 
-	_, err := payService.getUnspentTxsForFarm(ctx, btcClient, storage, farmAddresses)
+	_, err := payService.wallets.getUnspentTxsForFarm(ctx, btcClient, storage, farmAddresses)
 
 	assert.Error(t, err)
 	assert.Equal(t, expectedError, err)
@@ -165,7 +165,7 @@ func TestGetUnspentTxsForFarm_NoValidUnspentTransactions(t *testing.T) {
 	ctx := context.Background()
 	farmAddresses := []string{"address1", "address2"}
 
-	unspentTransactions := []btcjson.ListUnspentResult{
+	unspentTransactions := []types.UnspentTx{
 		{TxID: "tx1", Address: "address3"},
 		{TxID: "tx2", Address: "address4"},
 	}
@@ -187,9 +187,9 @@ func TestGetUnspentTxsForFarm_NoValidUnspentTransactions(t *testing.T) {
 	storage.On("GetUTXOTransaction", mock.Anything, "tx1").Return(utxo1, nil)
 	storage.On("GetUTXOTransaction", mock.Anything, "tx2").Return(utxo2, nil)
 
-	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &types.BtcNetworkParams{})
+	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 
-	validUnspentTxs, err := payService.getUnspentTxsForFarm(ctx, btcClient, storage, farmAddresses)
+	validUnspentTxs, err := payService.wallets.getUnspentTxsForFarm(ctx, btcClient, storage, farmAddresses)
 
 	assert.NoError(t, err)
 	assert.Empty(t, validUnspentTxs)
@@ -202,11 +202,11 @@ func TestGetUnspentTxsForFarm_EmptyUnspentTransactions(t *testing.T) {
 	farmAddresses := []string{"address1", "address2"}
 
 	btcClient := new(mockBtcClient)
-	btcClient.On("ListUnspent").Return([]btcjson.ListUnspentResult{}, nil)
+	btcClient.On("ListUnspent").Return([]types.UnspentTx{}, nil)
 
-	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &types.BtcNetworkParams{})
+	payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 
-	validUnspentTxs, err := payService.getUnspentTxsForFarm(ctx, btcClient, nil, farmAddresses)
+	validUnspentTxs, err := payService.wallets.getUnspentTxsForFarm(ctx, btcClient, nil, farmAddresses)
 
 	assert.NoError(t, err)
 	assert.Empty(t, validUnspentTxs)
@@ -231,7 +231,7 @@ func TestVerifyCollectionIds(t *testing.T) {
 	apiRequester.On("VerifyCollection", mock.Anything, "collection1").Return(true, nil)
 	apiRequester.On("VerifyCollection", mock.Anything, "collection2").Return(false, nil)
 
-	payService := NewPayService(&infrastructure.Config{}, apiRequester, &mockHelper{}, &types.BtcNetworkParams{})
+	payService := NewPayService(&infrastructure.Config{}, apiRequester, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 
 	verifiedCollectionIds, err := payService.verifyCollectionIds(ctx, collections)
 
@@ -257,7 +257,7 @@ func TestVerifyCollectionIds_ErrorDuringVerification(t *testing.T) {
 	apiRequester := new(mockAPIRequester)
 	apiRequester.On("VerifyCollection", mock.Anything, "collection1").Return(false, errors.New("verification error"))
 
-	payService := NewPayService(&infrastructure.Config{}, apiRequester, &mockHelper{}, &types.BtcNetworkParams{})
+	payService := NewPayService(&infrastructure.Config{}, apiRequester, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 
 	_, err := payService.verifyCollectionIds(ctx, collections)
 
@@ -380,7 +380,7 @@ func TestFilterExpiredBeforePeriodNFTs(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &types.BtcNetworkParams{})
+			payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 
 			nonExpiredNFTsCount := payService.filterExpiredBeforePeriodNFTs(tc.farmCollections, tc.periodStart)
 			assert.Equal(t, tc.expectedNonExpired, nonExpiredNFTsCount)
@@ -445,7 +445,7 @@ func TestGetNftTimestamps(t *testing.T) {
 			mockStorage := &mockStorage{}
 			mockStorage.On("GetPayoutTimesForNFT", mock.Anything, tc.denomId, mock.Anything).Return(tc.payoutTimes, nil)
 
-			payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &types.BtcNetworkParams{})
+			payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 
 			start, end, err := payService.getNftTimestamps(context.Background(), mockStorage, tc.nft, tc.mintTimestamp, tc.nftTransferHistory, tc.denomId, tc.periodEnd)
 
@@ -456,37 +456,44 @@ func TestGetNftTimestamps(t *testing.T) {
 	}
 }
 
-func TestConvertAmountToBTC(t *testing.T) {
+func TestFilterAddressesToSend(t *testing.T) {
 	// Arrange
 	destinationAddressesWithAmount := map[string]types.AmountInfo{
 		"address1": {
-			Amount:           decimal.NewFromFloat(124.124124126),
+			Amount:           12412412412,
 			ThresholdReached: true,
 		},
 		"address2": {
-			Amount:           decimal.NewFromFloat(0.123),
+			Amount:           12300000,
 			ThresholdReached: true,
 		},
 		"address3": {
-			Amount:           decimal.NewFromFloat(12412323.1),
+			Amount:           1241232310000000,
 			ThresholdReached: true,
 		},
+		"address4": {
+			Amount:           50000,
+			ThresholdReached: false,
+		},
 	}
 
 	// Act
-	result, err := convertAmountToBTC(destinationAddressesWithAmount)
+	result := filterAddressesToSend(destinationAddressesWithAmount)
 
 	//Assert
+	require.Equal(t, map[string]types.Sats{
+		"address1": 12412412412,
+		"address2": 12300000,
+		"address3": 1241232310000000,
+	}, result, "Only the addresses that reached the threshold are sent")
+
+	bytes, err := json.Marshal(result)
 	require.NoError(t, err)
-	require.Equal(t, map[string]float64{
-		"address1": 124.124124126,
-		"address2": 0.123,
-		"address3": 12412323.1,
-	}, result, "Amounts are not equal to the given up to 8th digit")
+	require.Equal(t, `{"address1":124.12412412,"address2":0.123,"address3":12412323.1}`, string(bytes), "Amounts are sent as exact BTC numbers")
 }
 
 type GetCurrentAccumulatedAmountForAddressCalls struct {
-	result decimal.Decimal
+	result types.Sats
 	err    error
 }
 
@@ -494,7 +501,7 @@ func TestFilterByPaymentThreshold(t *testing.T) {
 
 	testCases := []struct {
 		desc                                       string
-		destinationAddressesWithAmountsBtcDecimal  map[string]decimal.Decimal
+		destinationAddressesWithAmounts            map[string]types.Sats
 		getCurrentAccumulatedAmountForAddressCalls map[string]GetCurrentAccumulatedAmountForAddressCalls
 		setInitialAccumulatedAmountForAddressCalls map[string]error
 		farmId                                     int64
@@ -503,45 +510,45 @@ func TestFilterByPaymentThreshold(t *testing.T) {
 	}{
 		{
 			desc: "threshold not reached for both addresses",
-			destinationAddressesWithAmountsBtcDecimal: map[string]decimal.Decimal{
-				"address1": decimal.NewFromFloat(0.0004),
-				"address2": decimal.NewFromFloat(0.0006),
+			destinationAddressesWithAmounts: map[string]types.Sats{
+				"address1": types.NewSatsFromBtcFloat(0.0004),
+				"address2": types.NewSatsFromBtcFloat(0.0006),
 			},
 			getCurrentAccumulatedAmountForAddressCalls: map[string]GetCurrentAccumulatedAmountForAddressCalls{
-				"address1": {decimal.NewFromFloat(0.0005), nil},
-				"address2": {decimal.NewFromFloat(0.0002), nil},
+				"address1": {types.NewSatsFromBtcFloat(0.0005), nil},
+				"address2": {types.NewSatsFromBtcFloat(0.0002), nil},
 			},
 			setInitialAccumulatedAmountForAddressCalls: map[string]error{"address2": nil},
 			expectedResult: map[string]types.AmountInfo{
-				"address1": {Amount: decimal.NewFromFloat(0.0009), ThresholdReached: false},
-				"address2": {Amount: decimal.NewFromFloat(0.0008), ThresholdReached: false},
+				"address1": {Amount: types.NewSatsFromBtcFloat(0.0009), ThresholdReached: false},
+				"address2": {Amount: types.NewSatsFromBtcFloat(0.0008), ThresholdReached: false},
 			},
 			expectedError: nil,
 		},
 		{
 			desc: "threshold reached for one address",
-			destinationAddressesWithAmountsBtcDecimal: map[string]decimal.Decimal{
-				"address1": decimal.NewFromFloat(0.0006),
-				"address2": decimal.NewFromFloat(0.0004),
+			destinationAddressesWithAmounts: map[string]types.Sats{
+				"address1": types.NewSatsFromBtcFloat(0.0006),
+				"address2": types.NewSatsFromBtcFloat(0.0004),
 			},
 			getCurrentAccumulatedAmountForAddressCalls: map[string]GetCurrentAccumulatedAmountForAddressCalls{
-				"address1": {decimal.NewFromFloat(0.0005), nil},
-				"address2": {decimal.NewFromFloat(0.0002), nil},
+				"address1": {types.NewSatsFromBtcFloat(0.0005), nil},
+				"address2": {types.NewSatsFromBtcFloat(0.0002), nil},
 			},
 			setInitialAccumulatedAmountForAddressCalls: map[string]error{"address2": nil},
 			expectedResult: map[string]types.AmountInfo{
-				"address1": {Amount: decimal.NewFromFloat(0.0011), ThresholdReached: true},
-				"address2": {Amount: decimal.NewFromFloat(0.0006), ThresholdReached: false},
+				"address1": {Amount: types.NewSatsFromBtcFloat(0.0011), ThresholdReached: true},
+				"address2": {Amount: types.NewSatsFromBtcFloat(0.0006), ThresholdReached: false},
 			},
 			expectedError: nil,
 		},
 		{
 			desc: "error when getting accumulated amount",
-			destinationAddressesWithAmountsBtcDecimal: map[string]decimal.Decimal{
-				"address1": decimal.NewFromFloat(0.0006),
+			destinationAddressesWithAmounts: map[string]types.Sats{
+				"address1": types.NewSatsFromBtcFloat(0.0006),
 			},
 			getCurrentAccumulatedAmountForAddressCalls: map[string]GetCurrentAccumulatedAmountForAddressCalls{
-				"address1": {decimal.Decimal{}, errors.New("error getting accumulated amount")},
+				"address1": {0, errors.New("error getting accumulated amount")},
 			},
 			setInitialAccumulatedAmountForAddressCalls: map[string]error{"address2": nil},
 			expectedResult: nil,
@@ -549,11 +556,11 @@ func TestFilterByPaymentThreshold(t *testing.T) {
 		},
 		{
 			desc: "error when setting initial accumulated amount",
-			destinationAddressesWithAmountsBtcDecimal: map[string]decimal.Decimal{
-				"address1": decimal.NewFromFloat(0.0006),
+			destinationAddressesWithAmounts: map[string]types.Sats{
+				"address1": types.NewSatsFromBtcFloat(0.0006),
 			},
 			getCurrentAccumulatedAmountForAddressCalls: map[string]GetCurrentAccumulatedAmountForAddressCalls{
-				"address1": {decimal.Decimal{}, sql.ErrNoRows},
+				"address1": {0, sql.ErrNoRows},
 			},
 			setInitialAccumulatedAmountForAddressCalls: map[string]error{"address1": errors.New("error setting initial accumulated amount")},
 			expectedResult: nil,
@@ -564,7 +571,7 @@ func TestFilterByPaymentThreshold(t *testing.T) {
 	for _, tC := range testCases {
 		t.Run(tC.desc, func(t *testing.T) {
 			ctx := context.Background()
-			config := infrastructure.Config{GlobalPayoutThresholdInBTC: 0.001}
+			config := infrastructure.Config{GlobalPayoutThresholdInBTC: 100000}
 			mockStorage := mockStorage{}
 
 			for address, result := range tC.getCurrentAccumulatedAmountForAddressCalls {
@@ -573,9 +580,11 @@ func TestFilterByPaymentThreshold(t *testing.T) {
 			for address, err := range tC.setInitialAccumulatedAmountForAddressCalls {
 				mockStorage.On("SetInitialAccumulatedAmountForAddress", mock.Anything, address, mock.Anything, mock.Anything).Return(err).Once()
 			}
-			payService := NewPayService(&config, &mockAPIRequester{}, &mockHelper{}, &types.BtcNetworkParams{})
+			mockStorage.On("GetFarmPayoutThreshold", mock.Anything, tC.farmId).Return(types.FarmPayoutThreshold{}, sql.ErrNoRows)
+			mockStorage.On("GetAddressPayoutThreshold", mock.Anything, mock.Anything).Return(types.AddressPayoutThreshold{}, sql.ErrNoRows)
+			payService := NewPayService(&config, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 
-			_, addressesToSend, _, err := payService.filterByPaymentThreshold(ctx, tC.destinationAddressesWithAmountsBtcDecimal, &mockStorage, tC.farmId)
+			_, addressesToSend, _, err := payService.filterByPaymentThreshold(ctx, tC.destinationAddressesWithAmounts, &mockStorage, types.Farm{Id: tC.farmId})
 
 			if (err == nil && tC.expectedError != nil) || (err != nil && tC.expectedError == nil) || (err != nil && tC.expectedError != nil && err.Error() != tC.expectedError.Error()) {
 				t.Errorf("Expected error %v, but got %v", tC.expectedError, err)
@@ -619,7 +628,7 @@ func TestFindCurrentPayoutPeriod(t *testing.T) {
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &types.BtcNetworkParams{})
+			payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 			start, err := payService.findCurrentPayoutPeriod(tc.payoutTimes, tc.mintTimestamp)
 
 			assert.NoError(t, err)
@@ -629,22 +638,22 @@ func TestFindCurrentPayoutPeriod(t *testing.T) {
 }
 
 func TestFilterUnspentTransactions(t *testing.T) {
-	var emptyList []btcjson.ListUnspentResult
+	var emptyList []types.UnspentTx
 
 	tests := []struct {
 		name                string
-		unspentTransactions []btcjson.ListUnspentResult
+		unspentTransactions []types.UnspentTx
 		storage             *mockStorage
 		farmAddresses       []string
-		expectedResult      []btcjson.ListUnspentResult
+		expectedResult      []types.UnspentTx
 	}{
 		{
 			name: "valid_transaction",
-			unspentTransactions: []btcjson.ListUnspentResult{
+			unspentTransactions: []types.UnspentTx{
 				{
 					TxID:    "validTx1",
 					Address: "address1",
-					Amount:  0.01,
+					Amount:  1000000,
 				},
 			},
 			storage: func() *mockStorage {
@@ -653,21 +662,21 @@ func TestFilterUnspentTransactions(t *testing.T) {
 				return ms
 			}(),
 			farmAddresses: []string{"address1", "address2"},
-			expectedResult: []btcjson.ListUnspentResult{
+			expectedResult: []types.UnspentTx{
 				{
 					TxID:    "validTx1",
 					Address: "address1",
-					Amount:  0.01,
+					Amount:  1000000,
 				},
 			},
 		},
 		{
 			name: "processed_transaction",
-			unspentTransactions: []btcjson.ListUnspentResult{
+			unspentTransactions: []types.UnspentTx{
 				{
 					TxID:    "processedTx1",
 					Address: "address1",
-					Amount:  0.01,
+					Amount:  1000000,
 				},
 			},
 			storage: func() *mockStorage {
@@ -695,31 +704,31 @@ func TestFilterUnspentTransactions(t *testing.T) {
 func TestRemoveAddressesWithZeroReward(t *testing.T) {
 	tests := []struct {
 		name                 string
-		destinationAddresses map[string]decimal.Decimal
-		expectedResult       map[string]decimal.Decimal
+		destinationAddresses map[string]types.Sats
+		expectedResult       map[string]types.Sats
 	}{
 		{
 			name: "remove_zero_reward_addresses",
-			destinationAddresses: map[string]decimal.Decimal{
-				"address1": decimal.NewFromFloat(0.01),
-				"address2": decimal.NewFromFloat(0),
-				"address3": decimal.NewFromFloat(0.05),
-				"address4": decimal.NewFromFloat(0),
+			destinationAddresses: map[string]types.Sats{
+				"address1": types.NewSatsFromBtcFloat(0.01),
+				"address2": types.NewSatsFromBtcFloat(0),
+				"address3": types.NewSatsFromBtcFloat(0.05),
+				"address4": types.NewSatsFromBtcFloat(0),
 			},
-			expectedResult: map[string]decimal.Decimal{
-				"address1": decimal.NewFromFloat(0.01),
-				"address3": decimal.NewFromFloat(0.05),
+			expectedResult: map[string]types.Sats{
+				"address1": types.NewSatsFromBtcFloat(0.01),
+				"address3": types.NewSatsFromBtcFloat(0.05),
 			},
 		},
 		{
 			name: "no_addresses_to_remove",
-			destinationAddresses: map[string]decimal.Decimal{
-				"address1": decimal.NewFromFloat(0.01),
-				"address3": decimal.NewFromFloat(0.05),
+			destinationAddresses: map[string]types.Sats{
+				"address1": types.NewSatsFromBtcFloat(0.01),
+				"address3": types.NewSatsFromBtcFloat(0.05),
 			},
-			expectedResult: map[string]decimal.Decimal{
-				"address1": decimal.NewFromFloat(0.01),
-				"address3": decimal.NewFromFloat(0.05),
+			expectedResult: map[string]types.Sats{
+				"address1": types.NewSatsFromBtcFloat(0.01),
+				"address3": types.NewSatsFromBtcFloat(0.05),
 			},
 		},
 	}
@@ -735,36 +744,36 @@ func TestRemoveAddressesWithZeroReward(t *testing.T) {
 func TestAddPaymentAmountToAddress(t *testing.T) {
 	tests := []struct {
 		name           string
-		initialAmounts map[string]decimal.Decimal
-		amountToAdd    decimal.Decimal
+		initialAmounts map[string]types.Sats
+		amountToAdd    types.Sats
 		address        string
-		expectedResult map[string]decimal.Decimal
+		expectedResult map[string]types.Sats
 	}{
 		{
 			name: "add_amount_to_existing_address",
-			initialAmounts: map[string]decimal.Decimal{
-				"address1": decimal.NewFromFloat(0.01),
-				"address2": decimal.NewFromFloat(0.05),
+			initialAmounts: map[string]types.Sats{
+				"address1": types.NewSatsFromBtcFloat(0.01),
+				"address2": types.NewSatsFromBtcFloat(0.05),
 			},
-			amountToAdd: decimal.NewFromFloat(0.02),
+			amountToAdd: types.NewSatsFromBtcFloat(0.02),
 			address:     "address1",
-			expectedResult: map[string]decimal.Decimal{
-				"address1": decimal.NewFromFloat(0.03),
-				"address2": decimal.NewFromFloat(0.05),
+			expectedResult: map[string]types.Sats{
+				"address1": types.NewSatsFromBtcFloat(0.03),
+				"address2": types.NewSatsFromBtcFloat(0.05),
 			},
 		},
 		{
 			name: "add_amount_to_new_address",
-			initialAmounts: map[string]decimal.Decimal{
-				"address1": decimal.NewFromFloat(0.01),
-				"address2": decimal.NewFromFloat(0.05),
+			initialAmounts: map[string]types.Sats{
+				"address1": types.NewSatsFromBtcFloat(0.01),
+				"address2": types.NewSatsFromBtcFloat(0.05),
 			},
-			amountToAdd: decimal.NewFromFloat(0.03),
+			amountToAdd: types.NewSatsFromBtcFloat(0.03),
 			address:     "address3",
-			expectedResult: map[string]decimal.Decimal{
-				"address1": decimal.NewFromFloat(0.01),
-				"address2": decimal.NewFromFloat(0.05),
-				"address3": decimal.NewFromFloat(0.03),
+			expectedResult: map[string]types.Sats{
+				"address1": types.NewSatsFromBtcFloat(0.01),
+				"address2": types.NewSatsFromBtcFloat(0.05),
+				"address3": types.NewSatsFromBtcFloat(0.03),
 			},
 		},
 	}
@@ -873,11 +882,20 @@ func TestLoadWallet(t *testing.T) {
 	tests := []struct {
 		name            string
 		farmName        string
+		loadedWallets   string
 		loadWalletError error
 		failsPerFarm    map[string]int
 		expectSuccess   bool
 		expectError     bool
 	}{
+		{
+			name:          "already_loaded",
+			farmName:      "farm1",
+			loadedWallets: `["farm2", "farm1"]`,
+			failsPerFarm:  map[string]int{},
+			expectSuccess: true,
+			expectError:   false,
+		},
 		{
 			name:            "successful_load",
 			farmName:        "farm1",
@@ -907,12 +925,19 @@ func TestLoadWallet(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			mockBtcClient := &mockBtcClient{}
-			mockBtcClient.On("LoadWallet", tc.farmName).Return(&btcjson.LoadWalletResult{}, tc.loadWalletError)
+			loadedWallets := tc.loadedWallets
+			if loadedWallets == "" {
+				loadedWallets = `["farm2"]`
+			}
+			mockBtcClient.On("RawRequest").Return(json.RawMessage(loadedWallets), nil)
+			if tc.loadedWallets == "" {
+				mockBtcClient.On("LoadWallet", tc.farmName).Return(&btcjson.LoadWalletResult{}, tc.loadWalletError)
+			}
 
-			payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &types.BtcNetworkParams{})
-			payService.btcWalletOpenFailsPerFarm = tc.failsPerFarm
+			payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
+			payService.wallets.btcWalletOpenFailsPerFarm = tc.failsPerFarm
 
-			success, err := payService.loadWallet(mockBtcClient, tc.farmName)
+			success, err := payService.wallets.loadWallet(mockBtcClient, tc.farmName)
 
 			assert.Equal(t, tc.expectSuccess, success)
 			if tc.expectError {
@@ -923,6 +948,9 @@ func TestLoadWallet(t *testing.T) {
 			}
 
 			mockBtcClient.AssertExpectations(t)
+			if tc.loadedWallets != "" {
+				mockBtcClient.AssertNotCalled(t, "LoadWallet", mock.Anything)
+			}
 		})
 	}
 }
@@ -986,7 +1014,7 @@ func TestGetLastUTXOTransactionTimestamp(t *testing.T) {
 
 			mockStorage.On("GetLastUTXOTransactionByFarmId", ctx, tc.farm.Id).Return(tc.mockGetLastUTXOTransactionByFarmIdResponse, tc.mockGetLastUTXOTransactionByFarmIdError)
 
-			payService := NewPayService(&infrastructure.Config{}, mockAPIRequester, &mockHelper{}, &types.BtcNetworkParams{})
+			payService := NewPayService(&infrastructure.Config{}, mockAPIRequester, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 
 			result, err := payService.getLastUTXOTransactionTimestamp(ctx, mockStorage, tc.farm)
 			assert.Equal(t, tc.expectedResult, result)
@@ -1082,7 +1110,7 @@ func TestGetCollectionsWithNftsForFarm(t *testing.T) {
 
 			mockStorage.On("GetFarmAuraPoolCollections", ctx, tc.farm.Id).Return(tc.auraPoolCollections, nil).Once()
 
-			payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester, &mockHelper{}, &types.BtcNetworkParams{})
+			payService := NewPayService(&infrastructure.Config{}, &mockAPIRequester, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 
 			resultCollections, resultMap, err := payService.getCollectionsWithNftsForFarm(ctx, &mockStorage, tc.farm)
 
@@ -2,24 +2,33 @@ package services
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/sql_db"
 	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
 	"github.com/rs/zerolog"
 	"github.com/shopspring/decimal"
 
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/notifier"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/requesters"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/resilience"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/secrets"
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -37,7 +46,7 @@ func TestProcessPayment(t *testing.T) {
 		CUDOFeeOnAllBTC:                 20,
 		CUDOFeePayoutAddress:            "cudo_fee_payout_address_1",
 		CUDOMaintenanceFeePayoutAddress: "cudo_maintenance_fee_payout_address_1",
-		GlobalPayoutThresholdInBTC:      0.01,
+		GlobalPayoutThresholdInBTC:      1000000,
 	}
 
 	btcNetworkParams := &types.BtcNetworkParams{
@@ -45,7 +54,7 @@ func TestProcessPayment(t *testing.T) {
 		MinConfirmations: 6,
 	}
 
-	s := NewPayService(config, setupMockApiRequester(t), &mockHelper{}, btcNetworkParams)
+	s := NewPayService(config, setupMockApiRequester(t), &mockHelper{}, &mockAlerter{}, btcNetworkParams, &mockSecretProvider{}, nil)
 	require.NoError(t, s.Execute(context.Background(), setupMockBtcClient(), setupMockStorage()))
 }
 
@@ -56,7 +65,7 @@ func TestProcessFarm(t *testing.T) {
 		CUDOFeeOnAllBTC:                 20,
 		CUDOFeePayoutAddress:            "cudo_fee_payout_address_1",
 		CUDOMaintenanceFeePayoutAddress: "cudo_maintenance_fee_payout_address_1",
-		GlobalPayoutThresholdInBTC:      0.01,
+		GlobalPayoutThresholdInBTC:      1000000,
 	}
 
 	btcNetworkParams := &types.BtcNetworkParams{
@@ -64,7 +73,7 @@ func TestProcessFarm(t *testing.T) {
 		MinConfirmations: 6,
 	}
 
-	s := NewPayService(config, setupMockApiRequester(t), &mockHelper{}, btcNetworkParams)
+	s := NewPayService(config, setupMockApiRequester(t), &mockHelper{}, &mockAlerter{}, btcNetworkParams, &mockSecretProvider{}, nil)
 
 	farms, err := setupMockStorage().GetApprovedFarms(context.Background())
 	require.Equal(t, err, nil, "Get farms returned error")
@@ -72,6 +81,262 @@ func TestProcessFarm(t *testing.T) {
 	require.NoError(t, s.processFarm(context.Background(), setupMockBtcClient(), setupMockStorage(), farms[0]))
 }
 
+func TestProcessFarm_StopsWhenHasuraBreakerIsOpen(t *testing.T) {
+	config := &infrastructure.Config{
+		Network:                         "BTC",
+		CUDOMaintenanceFeePercent:       50,
+		CUDOFeeOnAllBTC:                 20,
+		CUDOFeePayoutAddress:            "cudo_fee_payout_address_1",
+		CUDOMaintenanceFeePayoutAddress: "cudo_maintenance_fee_payout_address_1",
+		GlobalPayoutThresholdInBTC:      1000000,
+		HasuraURL:                       "http://hasura.invalid",
+	}
+
+	breakers := resilience.NewBreakers(1, time.Hour)
+	breakers.Get(metrics.EndpointHasura).Record(true)
+
+	apiRequester := setupMockApiRequester(t)
+	s := NewPayService(config, &hasuraRequester{mockAPIRequester: apiRequester, requester: requesters.NewRequester(config, breakers)},
+		&mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{ChainParams: &chaincfg.MainNetParams, MinConfirmations: 6}, &mockSecretProvider{}, nil)
+
+	farms, err := setupMockStorage().GetApprovedFarms(context.Background())
+	require.NoError(t, err)
+
+	// without the mint history the rewards would be calculated from nothing, so nothing is paid
+	err = s.processFarm(context.Background(), setupMockBtcClient(), setupMockStorage(), farms[0])
+	require.ErrorIs(t, err, resilience.ErrOpen)
+	apiRequester.AssertNotCalled(t, "SendMany", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// hasuraRequester sends the hasura requests through the real requester and mocks the rest
+type hasuraRequester struct {
+	*mockAPIRequester
+	requester *requesters.Requester
+}
+
+func (r *hasuraRequester) GetHasuraCollectionNftMintEvents(ctx context.Context, collectionDenomId string) (types.NftMintHistory, error) {
+	return r.requester.GetHasuraCollectionNftMintEvents(ctx, collectionDenomId)
+}
+
+func TestExecute_SkipsPausedFarms(t *testing.T) {
+	storage := new(mockStorage)
+	storage.On("GetApprovedFarms", mock.Anything).Return([]types.Farm{
+		{Id: 1, RewardsFromPoolBtcWalletName: "farm_1"},
+	}, nil).Once()
+	storage.On("GetPausedFarmIds", mock.Anything).Return([]int64{1}, nil).Once()
+	storage.On("GetFarmSchedules", mock.Anything).Return([]types.FarmSchedule{}, nil).Once()
+
+	btcClient := new(mockBtcClient)
+
+	s := NewPayService(&infrastructure.Config{}, new(mockAPIRequester), &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
+	require.NoError(t, s.Execute(context.Background(), btcClient, storage))
+
+	btcClient.AssertNotCalled(t, "LoadWallet", mock.Anything)
+	btcClient.AssertNotCalled(t, "RawRequest")
+
+	farmStatuses := s.FarmStatuses()
+	require.Len(t, farmStatuses, 1)
+	require.Equal(t, int64(1), farmStatuses[0].FarmId)
+	require.True(t, farmStatuses[0].Paused)
+	require.Empty(t, farmStatuses[0].LastRunError)
+}
+
+func TestExecute_AlertsAboutFailedFarms(t *testing.T) {
+	storage := new(mockStorage)
+	storage.On("GetApprovedFarms", mock.Anything).Return([]types.Farm{
+		{Id: 1, RewardsFromPoolBtcWalletName: "farm_1"},
+		{Id: 2, RewardsFromPoolBtcWalletName: "farm_2"},
+	}, nil).Once()
+	storage.On("GetPausedFarmIds", mock.Anything).Return([]int64{}, nil).Once()
+	storage.On("GetFarmSchedules", mock.Anything).Return([]types.FarmSchedule{}, nil).Once()
+
+	alerter := &mockAlerter{}
+	s := NewPayService(&infrastructure.Config{}, new(mockAPIRequester), &mockHelper{}, alerter, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
+	require.NoError(t, s.Execute(context.Background(), new(mockBtcClient), storage))
+
+	// each farm has its own alert, so one failing farm does not hide the others
+	require.Len(t, alerter.fired, 2)
+	for _, farmName := range []string{"farm_1", "farm_2"} {
+		notifications := alerter.fired["farm "+farmName]
+		require.Len(t, notifications, 1)
+		require.Equal(t, notifier.SeverityWarning, notifications[0].Severity)
+		require.Equal(t, farmName, notifications[0].Farm)
+		require.Contains(t, notifications[0].Error, "maintenance fee")
+	}
+	require.Empty(t, alerter.resolved)
+}
+
+func TestExecute_FollowsFarmSchedules(t *testing.T) {
+	// the mock helper time is 2022-10-24T19:51:18Z
+	now := time.Unix(1666641078, 0).UTC()
+	lastRun := func(value string) *time.Time {
+		lastRunAt, err := time.Parse(time.RFC3339, value)
+		require.NoError(t, err)
+		return &lastRunAt
+	}
+
+	setupStorage := func() *mockStorage {
+		storage := new(mockStorage)
+		storage.On("GetApprovedFarms", mock.Anything).Return([]types.Farm{
+			{Id: 1, RewardsFromPoolBtcWalletName: "farm_1"},
+			{Id: 2, RewardsFromPoolBtcWalletName: "farm_2"},
+			{Id: 3, RewardsFromPoolBtcWalletName: "farm_3"},
+		}, nil).Once()
+		storage.On("GetPausedFarmIds", mock.Anything).Return([]int64{}, nil).Once()
+		storage.On("GetFarmSchedules", mock.Anything).Return([]types.FarmSchedule{
+			// follows the daily pay schedule at 02:00, which passed since its last run
+			{FarmId: 1, LastRunAt: lastRun("2022-10-23T02:00:05Z")},
+			// has its own schedule at 20:00, which has not come yet
+			{FarmId: 2, Schedule: "0 20 * * *", Timezone: "UTC", LastRunAt: lastRun("2022-10-23T20:00:05Z")},
+		}, nil).Once()
+		storage.On("SaveFarmLastRun", mock.Anything, mock.Anything, now).Return(nil)
+		return storage
+	}
+
+	config := &infrastructure.Config{PaySchedule: "0 2 * * *", ScheduleTimezone: "UTC"}
+
+	storage := setupStorage()
+	alerter := &mockAlerter{}
+	s := NewPayService(config, new(mockAPIRequester), &mockHelper{}, alerter, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
+	require.NoError(t, s.Execute(context.Background(), new(mockBtcClient), storage))
+
+	// only farm 1 is processed, farm 3 starts following the schedule from now on
+	require.Len(t, alerter.fired, 1)
+	require.Contains(t, alerter.fired, "farm farm_1")
+	storage.AssertCalled(t, "SaveFarmLastRun", mock.Anything, int64(1), now)
+	storage.AssertCalled(t, "SaveFarmLastRun", mock.Anything, int64(3), now)
+	storage.AssertNotCalled(t, "SaveFarmLastRun", mock.Anything, int64(2), mock.Anything)
+	// only the due farms pay their cross-farm shares in the run
+	payableFarmIds := []int64{}
+	for _, farm := range s.getPayableFarms() {
+		payableFarmIds = append(payableFarmIds, farm.Id)
+	}
+	require.Equal(t, []int64{1}, payableFarmIds)
+
+	// a forced run processes all farms
+	alerter = &mockAlerter{}
+	s = NewPayService(config, new(mockAPIRequester), &mockHelper{}, alerter, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
+	require.NoError(t, s.Execute(WithForcedRun(context.Background()), new(mockBtcClient), setupStorage()))
+	require.Len(t, alerter.fired, 3)
+}
+
+func TestExecute_SavesFarmStatuses(t *testing.T) {
+	config := &infrastructure.Config{
+		Network:                         "BTC",
+		CUDOMaintenanceFeePercent:       50,
+		CUDOFeeOnAllBTC:                 20,
+		CUDOFeePayoutAddress:            "cudo_fee_payout_address_1",
+		CUDOMaintenanceFeePayoutAddress: "cudo_maintenance_fee_payout_address_1",
+		GlobalPayoutThresholdInBTC:      1000000,
+	}
+
+	alerter := &mockAlerter{}
+	s := NewPayService(config, setupMockApiRequester(t), &mockHelper{}, alerter, &types.BtcNetworkParams{ChainParams: &chaincfg.MainNetParams, MinConfirmations: 6}, &mockSecretProvider{}, nil)
+	require.NoError(t, s.Execute(context.Background(), setupMockBtcClient(), setupMockStorage()))
+
+	farmStatuses := s.FarmStatuses()
+	require.Len(t, farmStatuses, 2)
+	require.Equal(t, "farm_1", farmStatuses[0].FarmName)
+	require.Empty(t, farmStatuses[0].LastRunError)
+	require.Equal(t, "farm_2", farmStatuses[1].FarmName)
+	require.False(t, farmStatuses[1].Paused)
+	require.Contains(t, alerter.resolved, "farm farm_1")
+}
+
+func TestDryRun(t *testing.T) {
+	config := &infrastructure.Config{
+		Network:                         "BTC",
+		CUDOMaintenanceFeePercent:       50,
+		CUDOFeeOnAllBTC:                 20,
+		CUDOFeePayoutAddress:            "cudo_fee_payout_address_1",
+		CUDOMaintenanceFeePayoutAddress: "cudo_maintenance_fee_payout_address_1",
+		GlobalPayoutThresholdInBTC:      1000000,
+	}
+
+	btcNetworkParams := &types.BtcNetworkParams{
+		ChainParams:      &chaincfg.MainNetParams,
+		MinConfirmations: 6,
+	}
+
+	apiRequester := setupMockApiRequester(t)
+	btcClient := setupMockBtcClient()
+	storage := setupMockStorage()
+
+	s := NewPayService(config, apiRequester, &mockHelper{}, &mockAlerter{}, btcNetworkParams, &mockSecretProvider{}, nil)
+	report, err := s.DryRun(context.Background(), btcClient, storage)
+	require.NoError(t, err)
+
+	apiRequester.AssertNotCalled(t, "SendMany", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	btcClient.AssertNotCalled(t, "WalletPassphrase", mock.Anything, mock.Anything)
+	storage.AssertNotCalled(t, "UpdateThresholdStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	storage.AssertNotCalled(t, "SaveStatistics", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	storage.AssertNotCalled(t, "SetInitialAccumulatedAmountForAddress", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	storage.AssertNotCalled(t, "SavePayoutIntent", mock.Anything, mock.Anything)
+
+	require.Len(t, report.Farms, 2)
+	require.Equal(t, "farm_1", report.Farms[0].FarmName)
+	require.Len(t, report.Farms[0].Payments, 1)
+
+	payment := report.Farms[0].Payments[0]
+	require.Equal(t, "1", payment.UnspentTxId)
+	require.Equal(t, types.Sats(625000000), payment.ReceivedRewardBtc)
+	require.Equal(t, types.Sats(125000000), payment.SendManyOutputs["cudo_fee_payout_address_1"])
+	require.NotEmpty(t, payment.Destinations)
+	require.NotEmpty(t, payment.NftStatistics)
+	require.Len(t, payment.CollectionPaymentAllocations, 1)
+
+	var totalSent types.Sats
+	for _, amount := range payment.SendManyOutputs {
+		totalSent += amount
+	}
+	require.Equal(t, types.Sats(625000000), totalSent)
+
+	require.Equal(t, "farm_2", report.Farms[1].FarmName)
+	require.Empty(t, report.Farms[1].Payments)
+}
+
+func TestDryRunStorage_FiltersFarm(t *testing.T) {
+	ctx := context.Background()
+
+	ds := newDryRunStorage(setupMockStorage())
+	ds.farm = "farm_2"
+	farms, err := ds.GetApprovedFarms(ctx)
+	require.NoError(t, err)
+	require.Len(t, farms, 1)
+	require.Equal(t, "farm_2", farms[0].RewardsFromPoolBtcWalletName)
+
+	ds.farm = "unknown_farm"
+	_, err = ds.GetApprovedFarms(ctx)
+	require.Error(t, err)
+}
+
+func TestDryRunStorage_ReadsOwnWrites(t *testing.T) {
+	storage := setupMockStorage()
+	storage.On("GetPayoutTimesForNFT", mock.Anything, "denom_1", "1").Return([]types.NFTStatistics{}, nil).Once()
+
+	ds := newDryRunStorage(storage)
+	ctx := context.Background()
+
+	require.NoError(t, ds.UpdateThresholdStatus(ctx, "tx_1", 1666641078, map[string]types.Sats{"nft_owner_address": types.NewSatsFromBtcFloat(0.005)}, 1))
+	require.NoError(t, ds.SaveStatistics(ctx, 0, nil, nil, []types.NFTStatistics{{DenomId: "denom_1", TokenId: "1", PayoutPeriodEnd: 1666641078}}, "", 1, "farm_1"))
+
+	amount, err := ds.GetCurrentAcummulatedAmountForAddress(ctx, "nft_owner_address", 1)
+	require.NoError(t, err)
+	require.Equal(t, types.NewSatsFromBtcFloat(0.005), amount)
+
+	lastUTXO, err := ds.GetLastUTXOTransactionByFarmId(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, int64(1666641078), lastUTXO.PaymentTimestamp)
+
+	payoutTimes, err := ds.GetPayoutTimesForNFT(ctx, "denom_1", "1")
+	require.NoError(t, err)
+	require.Len(t, payoutTimes, 1)
+
+	require.Error(t, ds.SaveTxHashWithStatus(ctx, "tx_hash", types.TransactionPending, "farm_1", 1, 0))
+	storage.AssertNotCalled(t, "UpdateThresholdStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	storage.AssertNotCalled(t, "SaveStatistics", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
 func TestPayService_ProcessPayment_Threshold(t *testing.T) {
 	skipDBTests(t)
 
@@ -81,7 +346,7 @@ func TestPayService_ProcessPayment_Threshold(t *testing.T) {
 		CUDOFeeOnAllBTC:                 2,
 		CUDOFeePayoutAddress:            "cudo_fee_payout_address_1",
 		CUDOMaintenanceFeePayoutAddress: "cudo_maintenance_fee_payout_address_1",
-		GlobalPayoutThresholdInBTC:      0.01,
+		GlobalPayoutThresholdInBTC:      1000000,
 		DbDriverName:                    "postgres",
 		DbUser:                          "postgresUser",
 		DbPassword:                      "mysecretpassword",
@@ -100,20 +365,20 @@ func TestPayService_ProcessPayment_Threshold(t *testing.T) {
 		tearDownDatabase(sqlxDB)
 	}()
 
-	err := dbStorage.UpdateThresholdStatus(context.Background(), "3", 1, map[string]decimal.Decimal{}, 1)
+	err := dbStorage.UpdateThresholdStatus(context.Background(), "3", 1, map[string]types.Sats{}, 1)
 	if err != nil {
 		panic(err)
 	}
 
 	mockAPIRequester := setupMockApiRequester(t)
 	// cudo_maintenance_fee_payout_addr and maintenance_fee_payout_address_1 are below threshold of 0.01 with values 5.928e-05
-	mockAPIRequester.On("SendMany", mock.Anything, map[string]float64{
-		"leftover_reward_payout_address_1": 3,
-		"nft_minter_payout_addr":           0.1973688,
-		"nft_owner_2_payout_addr":          0.55251264,
-	}).Return("farm_1_denom_1_nft_owner_2_tx_hash", nil).Once()
+	mockAPIRequester.On("SendMany", mock.Anything, mock.Anything, map[string]types.Sats{
+		"leftover_reward_payout_address_1": types.NewSatsFromBtcFloat(3),
+		"nft_minter_payout_addr":           types.NewSatsFromBtcFloat(0.1973688),
+		"nft_owner_2_payout_addr":          types.NewSatsFromBtcFloat(0.55251264),
+	}, mock.Anything).Return("farm_1_denom_1_nft_owner_2_tx_hash", nil).Once()
 
-	s := NewPayService(config, mockAPIRequester, &mockHelper{}, btcNetworkParams)
+	s := NewPayService(config, mockAPIRequester, &mockHelper{}, &mockAlerter{}, btcNetworkParams, &mockSecretProvider{}, nil)
 
 	require.NoError(t, s.Execute(context.Background(), setupMockBtcClient(), dbStorage))
 	processTx1, _ := dbStorage.GetUTXOTransaction(context.Background(), "1")
@@ -124,15 +389,81 @@ func TestPayService_ProcessPayment_Threshold(t *testing.T) {
 	require.Equal(t, true, processTx4.Processed)
 
 	amountAccumulatedBTC, _ := dbStorage.GetCurrentAcummulatedAmountForAddress(context.Background(), "maintenance_fee_payout_address_1", 1)
-	require.Equal(t, float64(5928), amountAccumulatedBTC)
+	require.Equal(t, types.Sats(5928), amountAccumulatedBTC)
 	amountAccumulatedBTC, _ = dbStorage.GetCurrentAcummulatedAmountForAddress(context.Background(), "cudo_fee_payout_address_1", 1)
-	require.Equal(t, float64(10210010), amountAccumulatedBTC)
+	require.Equal(t, types.Sats(10210010), amountAccumulatedBTC)
 	amountAccumulatedBTC, _ = dbStorage.GetCurrentAcummulatedAmountForAddress(context.Background(), "nft_minter_payout_addr", 1)
-	require.Equal(t, float64(0), amountAccumulatedBTC)
+	require.Equal(t, types.Sats(0), amountAccumulatedBTC)
 	amountAccumulatedBTC, _ = dbStorage.GetCurrentAcummulatedAmountForAddress(context.Background(), "nft_owner_2_payout_addr", 1)
-	require.Equal(t, float64(0), amountAccumulatedBTC)
+	require.Equal(t, types.Sats(0), amountAccumulatedBTC)
 	amountAccumulatedBTC, _ = dbStorage.GetCurrentAcummulatedAmountForAddress(context.Background(), "leftover_reward_payout_address_1", 1)
-	require.Equal(t, float64(0), amountAccumulatedBTC)
+	require.Equal(t, types.Sats(0), amountAccumulatedBTC)
+}
+
+func TestPayService_Execute_With_Database(t *testing.T) {
+	config := &infrastructure.Config{
+		Network:                         "BTC",
+		CUDOMaintenanceFeePercent:       50,
+		CUDOFeeOnAllBTC:                 20,
+		CUDOFeePayoutAddress:            "cudo_fee_payout_address_1",
+		CUDOMaintenanceFeePayoutAddress: "cudo_maintenance_fee_payout_address_1",
+		GlobalPayoutThresholdInBTC:      1000000,
+		DbDriverName:                    "postgres",
+		DbUser:                          "postgresUser",
+		DbPassword:                      "mysecretpassword",
+		DbHost:                          "127.0.0.1",
+		DbPort:                          "5432",
+		DbName:                          "aura-pay-test-db",
+	}
+
+	btcNetworkParams := &types.BtcNetworkParams{
+		ChainParams:      &chaincfg.MainNetParams,
+		MinConfirmations: 6,
+	}
+
+	dbStorage, sqlxDB := setupInMemoryStorage(config)
+	defer func() {
+		tearDownDatabase(sqlxDB)
+	}()
+
+	ctx := context.Background()
+	now := time.Now().UTC()
+	sqlxDB.MustExec(`INSERT INTO farms (id, name, sub_account_name, rewards_from_pool_btc_wallet_name, total_farm_hashrate, address_for_receiving_rewards_from_pool,
+		leftover_reward_payout_address, maintenance_fee_payout_address, maintenance_fee_in_btc, status, farm_start_time, created_at, updated_at)
+		VALUES (1, 'farm_1', 'farm_1', 'farm_1', 1200, 'address_for_receiving_reward_from_pool_1', 'leftover_reward_payout_address_1', 'maintenance_fee_payout_address_1', 1, 'approved', $1, $2, $3)`, now, now, now)
+	sqlxDB.MustExec(`INSERT INTO collections (id, farm_id, denom_id, hashing_power, status, created_at, updated_at) VALUES (1, 1, 'farm_1_denom_1', 960, 'approved', $1, $2)`, now, now)
+	// the previous payment of the farm
+	require.NoError(t, dbStorage.UpdateThresholdStatus(ctx, "0", 1664999478, map[string]types.Sats{}, 1))
+
+	s := NewPayService(config, setupMockApiRequester(t), &mockHelper{}, &mockAlerter{}, btcNetworkParams, &mockSecretProvider{}, nil)
+	require.NoError(t, s.Execute(ctx, setupMockBtcClient(), dbStorage))
+
+	utxo, err := dbStorage.GetUTXOTransaction(ctx, "1")
+	require.NoError(t, err)
+	require.True(t, utxo.Processed)
+
+	pendingTxs, err := dbStorage.GetTxHashesByStatus(ctx, types.TransactionPending)
+	require.NoError(t, err)
+	require.Len(t, pendingTxs, 1)
+	require.Equal(t, "farm_1_denom_1_nft_owner_2_tx_hash", pendingTxs[0].TxHash)
+
+	farmPayment, err := dbStorage.(*sql_db.SqlDB).GetFarmPayment(ctx, pendingTxs[0].FarmPaymentId)
+	require.NoError(t, err)
+	require.Equal(t, "6.25", farmPayment.AmountBTC.String())
+
+	nftStatistics, err := dbStorage.(*sql_db.SqlDB).GetNFTStatisticsByFarmPayment(ctx, pendingTxs[0].FarmPaymentId)
+	require.NoError(t, err)
+	require.Len(t, nftStatistics, 1)
+	require.Len(t, nftStatistics[0].NFTOwnersForPeriod, 2)
+	require.Equal(t, "2.5860781", nftStatistics[0].NFTOwnersForPeriod[1].Reward.String())
+
+	unfinishedIntents, err := dbStorage.GetUnfinishedPayoutIntents(ctx, 1)
+	require.NoError(t, err)
+	require.Empty(t, unfinishedIntents)
+
+	ledgerProblems, err := sql_db.NewSqlDB(sqlxDB).VerifyLedger(ctx)
+	require.NoError(t, err)
+	require.Empty(t, ledgerProblems)
 }
 
 func TestPayService_ProcessPayment_Mint_Between_Payments(t *testing.T) {
@@ -142,7 +473,7 @@ func TestPayService_ProcessPayment_Mint_Between_Payments(t *testing.T) {
 		CUDOFeeOnAllBTC:                 20,
 		CUDOFeePayoutAddress:            "cudo_fee_payout_address_1",
 		CUDOMaintenanceFeePayoutAddress: "cudo_maintenance_fee_payout_address_1",
-		GlobalPayoutThresholdInBTC:      0.01,
+		GlobalPayoutThresholdInBTC:      1000000,
 	}
 
 	btcNetworkParams := &types.BtcNetworkParams{
@@ -173,40 +504,39 @@ func TestPayService_ProcessPayment_Mint_Between_Payments(t *testing.T) {
 	mockAPIRequester.GetDenomNftTransferHistory(context.Background(), "farm_1_denom_1", 1664999478, 0)
 	mockAPIRequester.On("GetDenomNftTransferHistory", mock.Anything, "farm_1_denom_1", int64(1664999478), mock.Anything).Return([]types.NftTransferEvent{}, nil).Once()
 
-	collectionAllocationAmount := decimal.NewFromFloat(4)
-	leftoverAmount := decimal.NewFromFloat(3)
-	cudoFee := decimal.NewFromFloat(1.25)
-	nftMinterAmount, _ := decimal.NewFromString("1.754838709674752")
-	cudoPartOfReward := decimal.NewFromFloat(1.25)
-	cudoPartOfMaintenanceFee, _ := decimal.NewFromString("0.122580645162624")
-	maintenanceFeeAddress1Amount, _ := decimal.NewFromString("0.122580645162624")
+	collectionAllocationAmount := types.NewSatsFromBtcFloat(4)
+	leftoverAmount := types.NewSatsFromBtcFloat(3)
+	cudoFee := types.NewSatsFromBtcFloat(1.25)
+	nftMinterAmount := types.Sats(175483871)
+	cudoPartOfReward := types.NewSatsFromBtcFloat(1.25)
+	cudoPartOfMaintenanceFee := types.Sats(12258064)
+	maintenanceFeeAddress1Amount := types.Sats(12258065)
 
 	// maintenance_fee_payout_address_1 is below threshold of 0.01 with values 5.928e-05
 	// call it once to clear mock
-	mockAPIRequester.On("SendMany", mock.Anything, map[string]float64{
-		"leftover_reward_payout_address_1":      leftoverAmount.InexactFloat64(),
-		"cudo_fee_payout_address_1":             cudoFee.InexactFloat64(),
-		"cudo_maintenance_fee_payout_address_1": 0.12258064,
-		"maintenance_fee_payout_address_1":      0.12258064,
-		"nft_minter_payout_addr":                nftMinterAmount.RoundFloor(8).InexactFloat64(),
-	}).Return("farm_1_denom_1_nft_owner_2_tx_hash", nil).Once()
+	mockAPIRequester.On("SendMany", mock.Anything, mock.Anything, map[string]types.Sats{
+		"leftover_reward_payout_address_1":      leftoverAmount,
+		"cudo_fee_payout_address_1":             cudoFee,
+		"cudo_maintenance_fee_payout_address_1": cudoPartOfMaintenanceFee,
+		"maintenance_fee_payout_address_1":      maintenanceFeeAddress1Amount,
+		"nft_minter_payout_addr":                nftMinterAmount,
+	}, mock.Anything).Return("farm_1_denom_1_nft_owner_2_tx_hash", nil).Once()
 
 	storage := setupMockStorage()
 
 	storage.On("SaveStatistics", mock.Anything,
-		mock.MatchedBy(func(payment decimal.Decimal) bool {
-			return payment.Equal(decimal.NewFromFloat(6.25))
+		mock.MatchedBy(func(payment types.Sats) bool {
+			return payment == types.NewSatsFromBtcFloat(6.25)
 		}),
 		mock.MatchedBy(func(collectionAllocations []types.CollectionPaymentAllocation) bool {
-			collectionPartOfFarm := decimal.NewFromFloat(0.8)
 
 			return collectionAllocations[0].FarmId == 1 &&
 				collectionAllocations[0].CollectionId == 1 &&
-				collectionAllocations[0].CollectionAllocationAmount.Equals(collectionAllocationAmount) &&
-				collectionAllocations[0].CUDOGeneralFee.Equals(cudoPartOfReward.Mul(collectionPartOfFarm)) &&
-				collectionAllocations[0].CUDOMaintenanceFee.Equals(cudoPartOfMaintenanceFee) &&
-				collectionAllocations[0].FarmMaintenanceFee.Equals(maintenanceFeeAddress1Amount) &&
-				collectionAllocations[0].FarmUnsoldLeftovers.Equals(decimal.NewFromFloat(2))
+				collectionAllocations[0].CollectionAllocationAmount == collectionAllocationAmount &&
+				collectionAllocations[0].CUDOGeneralFee == cudoPartOfReward.Percent(decimal.NewFromInt(80)) &&
+				collectionAllocations[0].CUDOMaintenanceFee == cudoPartOfMaintenanceFee &&
+				collectionAllocations[0].FarmMaintenanceFee == maintenanceFeeAddress1Amount &&
+				collectionAllocations[0].FarmUnsoldLeftovers == types.NewSatsFromBtcFloat(2)
 		}),
 		mock.MatchedBy(func(amountInfoMap map[string]types.AmountInfo) bool {
 			return amountInfoMap["leftover_reward_payout_address_1"].ThresholdReached == true &&
@@ -214,10 +544,10 @@ func TestPayService_ProcessPayment_Mint_Between_Payments(t *testing.T) {
 				amountInfoMap["cudo_fee_payout_address_1"].ThresholdReached == true &&
 				amountInfoMap["maintenance_fee_payout_address_1"].ThresholdReached == true &&
 
-				amountInfoMap["leftover_reward_payout_address_1"].Amount.Equals(leftoverAmount.RoundFloor(8)) &&
-				amountInfoMap["nft_minter_payout_addr"].Amount.Equals(nftMinterAmount.RoundFloor(8)) &&
-				amountInfoMap["cudo_fee_payout_address_1"].Amount.Equals(cudoFee.RoundFloor(8)) &&
-				amountInfoMap["maintenance_fee_payout_address_1"].Amount.Equals(maintenanceFeeAddress1Amount.RoundFloor(8))
+				amountInfoMap["leftover_reward_payout_address_1"].Amount == leftoverAmount &&
+				amountInfoMap["nft_minter_payout_addr"].Amount == nftMinterAmount &&
+				amountInfoMap["cudo_fee_payout_address_1"].Amount == cudoFee &&
+				amountInfoMap["maintenance_fee_payout_address_1"].Amount == maintenanceFeeAddress1Amount
 		}),
 
 		mock.MatchedBy(func(nftStatistics []types.NFTStatistics) bool {
@@ -228,9 +558,9 @@ func TestPayService_ProcessPayment_Mint_Between_Payments(t *testing.T) {
 				nftStatistic.DenomId == "farm_1_denom_1" &&
 				nftStatistic.PayoutPeriodStart == 1665820278 &&
 				nftStatistic.PayoutPeriodEnd == 1666641078 &&
-				nftStatistic.Reward.Equals(nftMinterAmount) &&
-				nftStatistic.MaintenanceFee.Equals(maintenanceFeeAddress1Amount) &&
-				nftStatistic.CUDOPartOfMaintenanceFee.Equals(cudoPartOfMaintenanceFee)
+				nftStatistic.Reward == nftMinterAmount &&
+				nftStatistic.MaintenanceFee == maintenanceFeeAddress1Amount &&
+				nftStatistic.CUDOPartOfMaintenanceFee == cudoPartOfMaintenanceFee
 
 			nftOwnerStat1Correct := nftOwnerStat1.TimeOwnedFrom == 1665820278 &&
 				nftOwnerStat1.TimeOwnedTo == 1666641078 &&
@@ -238,7 +568,7 @@ func TestPayService_ProcessPayment_Mint_Between_Payments(t *testing.T) {
 				nftOwnerStat1.PercentOfTimeOwned == 100 &&
 				nftOwnerStat1.PayoutAddress == "nft_minter_payout_addr" &&
 				nftOwnerStat1.Owner == "cudos1_nft_minter" &&
-				nftOwnerStat1.Reward.Equals(nftMinterAmount)
+				nftOwnerStat1.Reward == nftMinterAmount
 
 			return nftStatisticCorrect && nftOwnerStat1Correct
 		}),
@@ -247,7 +577,7 @@ func TestPayService_ProcessPayment_Mint_Between_Payments(t *testing.T) {
 		"farm_1",
 	).Return(nil)
 
-	s := NewPayService(config, mockAPIRequester, &mockHelper{}, btcNetworkParams)
+	s := NewPayService(config, mockAPIRequester, &mockHelper{}, &mockAlerter{}, btcNetworkParams, &mockSecretProvider{}, nil)
 	require.NoError(t, s.Execute(context.Background(), setupMockBtcClient(), storage))
 }
 
@@ -258,7 +588,7 @@ func TestPayService_ProcessPayment_Expiration_Between_Payments(t *testing.T) {
 		CUDOFeeOnAllBTC:                 20,
 		CUDOFeePayoutAddress:            "cudo_fee_payout_address_1",
 		CUDOMaintenanceFeePayoutAddress: "cudo_maintenance_fee_payout_address_1",
-		GlobalPayoutThresholdInBTC:      0.01,
+		GlobalPayoutThresholdInBTC:      1000000,
 	}
 
 	btcNetworkParams := &types.BtcNetworkParams{
@@ -318,26 +648,26 @@ func TestPayService_ProcessPayment_Expiration_Between_Payments(t *testing.T) {
 	mockAPIRequester.GetHasuraCollectionNftMintEvents(context.Background(), "farm_1_denom_1")
 	mockAPIRequester.On("GetHasuraCollectionNftMintEvents", mock.Anything, "farm_1_denom_1").Return(farm1Denom1Nft1MintHistory, nil).Once()
 
-	collectionAllocationAmount := decimal.NewFromFloat(4)
-	leftoverAmount := decimal.NewFromFloat(3)
-	cudoMaintenanceFee := decimal.NewFromFloat(1.25012768)
-	nftMinterAmount, _ := decimal.NewFromString("1.9997446236559112")
-	cudoPartOfReward := decimal.NewFromFloat(1.25)
-	cudoPartOfMaintenanceFee, _ := decimal.NewFromString("0.0001276881720444")
-	maintenanceFeeAddress1Amount, _ := decimal.NewFromString("0.0001276881720444")
+	collectionAllocationAmount := types.NewSatsFromBtcFloat(4)
+	leftoverAmount := types.NewSatsFromBtcFloat(3)
+	cudoMaintenanceFee := types.NewSatsFromBtcFloat(1.25012768)
+	nftMinterAmount := types.Sats(199974462)
+	cudoPartOfReward := types.NewSatsFromBtcFloat(1.25)
+	cudoPartOfMaintenanceFee := types.Sats(12768)
+	maintenanceFeeAddress1Amount := types.Sats(12768)
 
 	// maintenance_fee_payout_address_1 is below threshold of 0.01 with values 5.928e-05
-	mockAPIRequester.On("SendMany", mock.Anything, map[string]float64{
-		"leftover_reward_payout_address_1": leftoverAmount.InexactFloat64(),
-		"cudo_fee_payout_address_1":        cudoMaintenanceFee.InexactFloat64(),
-		"nft_minter_payout_addr":           nftMinterAmount.RoundFloor(8).InexactFloat64(),
-	}).Return("farm_1_denom_1_nft_owner_2_tx_hash", nil).Once()
+	mockAPIRequester.On("SendMany", mock.Anything, mock.Anything, map[string]types.Sats{
+		"leftover_reward_payout_address_1": leftoverAmount,
+		"cudo_fee_payout_address_1":        cudoMaintenanceFee,
+		"nft_minter_payout_addr":           nftMinterAmount,
+	}, mock.Anything).Return("farm_1_denom_1_nft_owner_2_tx_hash", nil).Once()
 
 	storage := setupMockStorage()
 
 	storage.On("SaveStatistics", mock.Anything,
-		mock.MatchedBy(func(payment decimal.Decimal) bool {
-			return payment.Equal(decimal.NewFromFloat(6.25))
+		mock.MatchedBy(func(payment types.Sats) bool {
+			return payment == types.NewSatsFromBtcFloat(6.25)
 		}),
 		mock.MatchedBy(func(amountInfoMap map[string]types.AmountInfo) bool {
 			return amountInfoMap["leftover_reward_payout_address_1"].ThresholdReached == true &&
@@ -345,21 +675,20 @@ func TestPayService_ProcessPayment_Expiration_Between_Payments(t *testing.T) {
 				amountInfoMap["cudo_fee_payout_address_1"].ThresholdReached == true &&
 				amountInfoMap["maintenance_fee_payout_address_1"].ThresholdReached == false &&
 
-				amountInfoMap["leftover_reward_payout_address_1"].Amount.Equals(leftoverAmount.RoundFloor(8)) &&
-				amountInfoMap["nft_minter_payout_addr"].Amount.Equals(nftMinterAmount.RoundFloor(8)) &&
-				amountInfoMap["cudo_fee_payout_address_1"].Amount.Equals(cudoMaintenanceFee.RoundFloor(8)) &&
-				amountInfoMap["maintenance_fee_payout_address_1"].Amount.Equals(maintenanceFeeAddress1Amount.RoundFloor(8))
+				amountInfoMap["leftover_reward_payout_address_1"].Amount == leftoverAmount &&
+				amountInfoMap["nft_minter_payout_addr"].Amount == nftMinterAmount &&
+				amountInfoMap["cudo_fee_payout_address_1"].Amount == cudoMaintenanceFee &&
+				amountInfoMap["maintenance_fee_payout_address_1"].Amount == maintenanceFeeAddress1Amount
 		}),
 		mock.MatchedBy(func(collectionAllocations []types.CollectionPaymentAllocation) bool {
-			collectionPartOfFarm := decimal.NewFromFloat(0.8)
 
 			return collectionAllocations[0].FarmId == 1 &&
 				collectionAllocations[0].CollectionId == 1 &&
-				collectionAllocations[0].CollectionAllocationAmount.Equals(collectionAllocationAmount) &&
-				collectionAllocations[0].CUDOGeneralFee.Equals(cudoPartOfReward.Mul(collectionPartOfFarm)) &&
-				collectionAllocations[0].CUDOMaintenanceFee.Equals(cudoPartOfMaintenanceFee) &&
-				collectionAllocations[0].FarmMaintenanceFee.Equals(maintenanceFeeAddress1Amount) &&
-				collectionAllocations[0].FarmUnsoldLeftovers.Equals(collectionAllocationAmount.Sub(nftMinterAmount).Sub(cudoPartOfMaintenanceFee).Sub(maintenanceFeeAddress1Amount))
+				collectionAllocations[0].CollectionAllocationAmount == collectionAllocationAmount &&
+				collectionAllocations[0].CUDOGeneralFee == cudoPartOfReward.Percent(decimal.NewFromInt(80)) &&
+				collectionAllocations[0].CUDOMaintenanceFee == cudoPartOfMaintenanceFee &&
+				collectionAllocations[0].FarmMaintenanceFee == maintenanceFeeAddress1Amount &&
+				collectionAllocations[0].FarmUnsoldLeftovers == collectionAllocationAmount-nftMinterAmount-cudoPartOfMaintenanceFee-maintenanceFeeAddress1Amount
 		}),
 		mock.MatchedBy(func(nftStatistics []types.NFTStatistics) bool {
 			nftStatistic := nftStatistics[0]
@@ -369,9 +698,9 @@ func TestPayService_ProcessPayment_Expiration_Between_Payments(t *testing.T) {
 				nftStatistic.DenomId == "farm_1_denom_1" &&
 				nftStatistic.PayoutPeriodStart == 1664999478 &&
 				nftStatistic.PayoutPeriodEnd == 1666641078 &&
-				nftStatistic.Reward.Equals(nftMinterAmount) &&
-				nftStatistic.MaintenanceFee.Equals(maintenanceFeeAddress1Amount) &&
-				nftStatistic.CUDOPartOfMaintenanceFee.Equals(cudoPartOfMaintenanceFee)
+				nftStatistic.Reward == nftMinterAmount &&
+				nftStatistic.MaintenanceFee == maintenanceFeeAddress1Amount &&
+				nftStatistic.CUDOPartOfMaintenanceFee == cudoPartOfMaintenanceFee
 
 			nftOwnerStat1Correct := nftOwnerStat1.TimeOwnedFrom == 1664999478 &&
 				nftOwnerStat1.TimeOwnedTo == 1666641078 &&
@@ -379,7 +708,7 @@ func TestPayService_ProcessPayment_Expiration_Between_Payments(t *testing.T) {
 				nftOwnerStat1.PercentOfTimeOwned == 100 &&
 				nftOwnerStat1.PayoutAddress == "nft_minter_payout_addr" &&
 				nftOwnerStat1.Owner == "cudos1_nft_minter" &&
-				nftOwnerStat1.Reward.Equals(nftMinterAmount)
+				nftOwnerStat1.Reward == nftMinterAmount
 
 			return nftStatisticCorrect && nftOwnerStat1Correct
 		}),
@@ -388,7 +717,7 @@ func TestPayService_ProcessPayment_Expiration_Between_Payments(t *testing.T) {
 		"farm_1",
 	).Return(nil)
 
-	s := NewPayService(config, mockAPIRequester, &mockHelper{}, btcNetworkParams)
+	s := NewPayService(config, mockAPIRequester, &mockHelper{}, &mockAlerter{}, btcNetworkParams, &mockSecretProvider{}, nil)
 	require.NoError(t, s.Execute(context.Background(), setupMockBtcClient(), storage))
 }
 
@@ -399,7 +728,7 @@ func TestPayService_ProcessPayment_NFT_Minted_After_Payment_Period(t *testing.T)
 		CUDOFeeOnAllBTC:                 20,
 		CUDOFeePayoutAddress:            "cudo_fee_payout_address_1",
 		CUDOMaintenanceFeePayoutAddress: "cudo_maintenance_fee_payout_address_1",
-		GlobalPayoutThresholdInBTC:      0.01,
+		GlobalPayoutThresholdInBTC:      1000000,
 	}
 
 	btcNetworkParams := &types.BtcNetworkParams{
@@ -459,41 +788,40 @@ func TestPayService_ProcessPayment_NFT_Minted_After_Payment_Period(t *testing.T)
 	mockAPIRequester.GetHasuraCollectionNftMintEvents(context.Background(), "farm_1_denom_1")
 	mockAPIRequester.On("GetHasuraCollectionNftMintEvents", mock.Anything, "farm_1_denom_1").Return(farm1Denom1Nft1MintHistory, nil).Once()
 
-	collectionAllocationAmount := decimal.NewFromFloat(4)
-	leftoverAmount := decimal.NewFromFloat(5)
-	cudoMaintenanceFee := decimal.NewFromFloat(1.25)
-	cudoPartOfReward := decimal.NewFromFloat(1.25)
-	cudoPartOfMaintenanceFee, _ := decimal.NewFromString("0")
-	maintenanceFeeAddress1Amount, _ := decimal.NewFromString("0")
+	collectionAllocationAmount := types.NewSatsFromBtcFloat(4)
+	leftoverAmount := types.NewSatsFromBtcFloat(5)
+	cudoMaintenanceFee := types.NewSatsFromBtcFloat(1.25)
+	cudoPartOfReward := types.NewSatsFromBtcFloat(1.25)
+	cudoPartOfMaintenanceFee := types.Sats(0)
+	maintenanceFeeAddress1Amount := types.Sats(0)
 
 	// maintenance_fee_payout_address_1 is below threshold of 0.01 with values 5.928e-05
-	mockAPIRequester.On("SendMany", mock.Anything, map[string]float64{
-		"leftover_reward_payout_address_1": 5,
-		"cudo_fee_payout_address_1":        1.25,
-	}).Return("farm_1_denom_1_nft_owner_2_tx_hash", nil).Once()
+	mockAPIRequester.On("SendMany", mock.Anything, mock.Anything, map[string]types.Sats{
+		"leftover_reward_payout_address_1": types.NewSatsFromBtcFloat(5),
+		"cudo_fee_payout_address_1":        types.NewSatsFromBtcFloat(1.25),
+	}, mock.Anything).Return("farm_1_denom_1_nft_owner_2_tx_hash", nil).Once()
 
 	storage := setupMockStorage()
 
 	storage.On("SaveStatistics", mock.Anything,
-		mock.MatchedBy(func(payment decimal.Decimal) bool {
-			return payment.Equal(decimal.NewFromFloat(6.25))
+		mock.MatchedBy(func(payment types.Sats) bool {
+			return payment == types.NewSatsFromBtcFloat(6.25)
 		}),
 		mock.MatchedBy(func(collectionAllocations []types.CollectionPaymentAllocation) bool {
-			collectionPartOfFarm := decimal.NewFromFloat(0.8)
 
 			return collectionAllocations[0].FarmId == 1 &&
 				collectionAllocations[0].CollectionId == 1 &&
-				collectionAllocations[0].CollectionAllocationAmount.Equals(collectionAllocationAmount) &&
-				collectionAllocations[0].CUDOGeneralFee.Equals(cudoPartOfReward.Mul(collectionPartOfFarm)) &&
-				collectionAllocations[0].CUDOMaintenanceFee.Equals(cudoPartOfMaintenanceFee) &&
-				collectionAllocations[0].FarmMaintenanceFee.Equals(maintenanceFeeAddress1Amount) &&
-				collectionAllocations[0].FarmUnsoldLeftovers.Equals(collectionAllocationAmount.Sub(cudoPartOfMaintenanceFee).Sub(maintenanceFeeAddress1Amount))
+				collectionAllocations[0].CollectionAllocationAmount == collectionAllocationAmount &&
+				collectionAllocations[0].CUDOGeneralFee == cudoPartOfReward.Percent(decimal.NewFromInt(80)) &&
+				collectionAllocations[0].CUDOMaintenanceFee == cudoPartOfMaintenanceFee &&
+				collectionAllocations[0].FarmMaintenanceFee == maintenanceFeeAddress1Amount &&
+				collectionAllocations[0].FarmUnsoldLeftovers == collectionAllocationAmount-cudoPartOfMaintenanceFee-maintenanceFeeAddress1Amount
 		}),
 		mock.MatchedBy(func(amountInfoMap map[string]types.AmountInfo) bool {
 			return amountInfoMap["leftover_reward_payout_address_1"].ThresholdReached == true &&
 				amountInfoMap["cudo_fee_payout_address_1"].ThresholdReached == true &&
-				amountInfoMap["leftover_reward_payout_address_1"].Amount.Equals(leftoverAmount) &&
-				amountInfoMap["cudo_fee_payout_address_1"].Amount.Equals(cudoMaintenanceFee)
+				amountInfoMap["leftover_reward_payout_address_1"].Amount == leftoverAmount &&
+				amountInfoMap["cudo_fee_payout_address_1"].Amount == cudoMaintenanceFee
 		}),
 
 		mock.MatchedBy(func(nftStatistics []types.NFTStatistics) bool {
@@ -504,7 +832,7 @@ func TestPayService_ProcessPayment_NFT_Minted_After_Payment_Period(t *testing.T)
 		"farm_1",
 	).Return(nil)
 
-	s := NewPayService(config, mockAPIRequester, &mockHelper{}, btcNetworkParams)
+	s := NewPayService(config, mockAPIRequester, &mockHelper{}, &mockAlerter{}, btcNetworkParams, &mockSecretProvider{}, nil)
 	require.NoError(t, s.Execute(context.Background(), setupMockBtcClient(), storage))
 }
 
@@ -522,7 +850,7 @@ func TestProcessFarmUnspentTx_HappyPath(t *testing.T) {
 		CUDOFeeOnAllBTC:                 20,
 		CUDOFeePayoutAddress:            "cudo_fee_payout_address_1",
 		CUDOMaintenanceFeePayoutAddress: "cudo_maintenance_fee_payout_address_1",
-		GlobalPayoutThresholdInBTC:      0.01,
+		GlobalPayoutThresholdInBTC:      1000000,
 	}
 
 	btcNetworkParams := &types.BtcNetworkParams{
@@ -539,12 +867,12 @@ func TestProcessFarmUnspentTx_HappyPath(t *testing.T) {
 		LeftoverRewardPayoutAddress:        "leftover_reward_payout_address_1",
 		MaintenanceFeePayoutAddress:        "maintenance_fee_payout_address_1",
 		MaintenanceFeeInBtc:                1,
-		TotalHashPower:                     1200,
+		TotalHashPower:                     types.NewHashPowerFromInt(1200),
 	}
 
-	testUnspentTx := btcjson.ListUnspentResult{TxID: "1", Amount: 6.25, Address: "address_for_receiving_reward_from_pool_1"}
+	testUnspentTx := types.UnspentTx{TxID: "1", Amount: 625000000, Address: "address_for_receiving_reward_from_pool_1"}
 
-	s := NewPayService(config, mockApiRequester, &mockHelper{}, btcNetworkParams)
+	s := NewPayService(config, mockApiRequester, &mockHelper{}, &mockAlerter{}, btcNetworkParams, &mockSecretProvider{}, nil)
 
 	// Act
 	periodEnd, err := s.processFarmUnspentTx(testCtx, mockBtcClient, mockStorage, testFarm, testUnspentTx, testLastPaymentTimestamp)
@@ -577,7 +905,7 @@ func TestProcessFarmUnspentTx_FailedToGetTxDetails(t *testing.T) {
 		CUDOFeeOnAllBTC:                 2,
 		CUDOFeePayoutAddress:            "cudo_fee_payout_address_1",
 		CUDOMaintenanceFeePayoutAddress: "cudo_maintenance_fee_payout_address_1",
-		GlobalPayoutThresholdInBTC:      0.01,
+		GlobalPayoutThresholdInBTC:      1000000,
 		DbDriverName:                    "postgres",
 		DbUser:                          "postgresUser",
 		DbPassword:                      "mysecretpassword",
@@ -600,16 +928,16 @@ func TestProcessFarmUnspentTx_FailedToGetTxDetails(t *testing.T) {
 		LeftoverRewardPayoutAddress:        "leftover_reward_payout_address_1",
 		MaintenanceFeePayoutAddress:        "maintenance_fee_payout_address_1",
 		MaintenanceFeeInBtc:                1,
-		TotalHashPower:                     1200,
+		TotalHashPower:                     types.NewHashPowerFromInt(1200),
 	}
 
-	testUnspentTx := btcjson.ListUnspentResult{TxID: "1", Amount: 6.25, Address: "address_for_receiving_reward_from_pool_1"}
+	testUnspentTx := types.UnspentTx{TxID: "1", Amount: 625000000, Address: "address_for_receiving_reward_from_pool_1"}
 
 	txHash, _ := chainhash.NewHashFromStr("1")
 	// call once to clear mock
 	mockBtcClient.GetRawTransactionVerbose(txHash)
 	mockBtcClient.On("GetRawTransactionVerbose", txHash).Return(&btcjson.TxRawResult{}, fmt.Errorf("error")).Once()
-	s := NewPayService(config, mockApiRequester, &mockHelper{}, btcNetworkParams)
+	s := NewPayService(config, mockApiRequester, &mockHelper{}, &mockAlerter{}, btcNetworkParams, &mockSecretProvider{}, nil)
 
 	// Act
 	_, err := s.processFarmUnspentTx(testCtx, mockBtcClient, mockStorage, testFarm, testUnspentTx, testLastPaymentTimestamp)
@@ -633,7 +961,7 @@ func TestProcessFarmUnspentTx_EmptyCollectionList(t *testing.T) {
 		CUDOFeeOnAllBTC:                 2,
 		CUDOFeePayoutAddress:            "cudo_fee_payout_address_1",
 		CUDOMaintenanceFeePayoutAddress: "cudo_maintenance_fee_payout_address_1",
-		GlobalPayoutThresholdInBTC:      0.01,
+		GlobalPayoutThresholdInBTC:      1000000,
 		DbDriverName:                    "postgres",
 		DbUser:                          "postgresUser",
 		DbPassword:                      "mysecretpassword",
@@ -656,17 +984,17 @@ func TestProcessFarmUnspentTx_EmptyCollectionList(t *testing.T) {
 		LeftoverRewardPayoutAddress:        "leftover_reward_payout_address_1",
 		MaintenanceFeePayoutAddress:        "maintenance_fee_payout_address_1",
 		MaintenanceFeeInBtc:                1,
-		TotalHashPower:                     1200,
+		TotalHashPower:                     types.NewHashPowerFromInt(1200),
 	}
 
-	testUnspentTx := btcjson.ListUnspentResult{TxID: "1", Amount: 6.25, Address: "address_for_receiving_reward_from_pool_1"}
+	testUnspentTx := types.UnspentTx{TxID: "1", Amount: 625000000, Address: "address_for_receiving_reward_from_pool_1"}
 
 	// var myslice []string
 	mockStorage.GetFarmAuraPoolCollections(testCtx, int64(1))
 	mockStorage.On("GetFarmAuraPoolCollections", mock.Anything, int64(1)).Return([]types.AuraPoolCollection{}, nil).Once()
 	mockApiRequester.On("GetFarmCollectionsWithNFTs", mock.Anything, []string(nil)).Return([]types.Collection{}, nil).Once()
 
-	s := NewPayService(config, mockApiRequester, &mockHelper{}, btcNetworkParams)
+	s := NewPayService(config, mockApiRequester, &mockHelper{}, &mockAlerter{}, btcNetworkParams, &mockSecretProvider{}, nil)
 
 	// Act
 	periodEnd, err := s.processFarmUnspentTx(testCtx, mockBtcClient, mockStorage, testFarm, testUnspentTx, testLastPaymentTimestamp)
@@ -695,7 +1023,7 @@ func TestProcessCollection_Rounding(t *testing.T) {
 		CUDOFeeOnAllBTC:                 50,
 		CUDOFeePayoutAddress:            "cudo_fee_payout_address_1",
 		CUDOMaintenanceFeePayoutAddress: "cudo_maintenance_fee_payout_address_1",
-		GlobalPayoutThresholdInBTC:      0.01,
+		GlobalPayoutThresholdInBTC:      1000000,
 		DbDriverName:                    "postgres",
 		DbUser:                          "postgresUser",
 		DbPassword:                      "mysecretpassword",
@@ -714,7 +1042,7 @@ func TestProcessCollection_Rounding(t *testing.T) {
 		LeftoverRewardPayoutAddress:        "leftover_reward_payout_address_1",
 		MaintenanceFeePayoutAddress:        "maintenance_fee_payout_address_1",
 		MaintenanceFeeInBtc:                0,
-		TotalHashPower:                     18,
+		TotalHashPower:                     types.NewHashPowerFromInt(18),
 	}
 
 	testCollection := types.Collection{
@@ -737,7 +1065,7 @@ func TestProcessCollection_Rounding(t *testing.T) {
 				Data: "",
 				DataJson: types.NFTDataJson{
 					ExpirationDate: int64(999999999999999),
-					HashRateOwned:  float64(1),
+					HashRateOwned:  types.NewHashPowerFromInt(1),
 				},
 				Owner: "",
 			}, {
@@ -747,7 +1075,7 @@ func TestProcessCollection_Rounding(t *testing.T) {
 				Data: "",
 				DataJson: types.NFTDataJson{
 					ExpirationDate: int64(999999999999999),
-					HashRateOwned:  float64(1),
+					HashRateOwned:  types.NewHashPowerFromInt(1),
 				},
 				Owner: "",
 			}, {
@@ -757,7 +1085,7 @@ func TestProcessCollection_Rounding(t *testing.T) {
 				Data: "",
 				DataJson: types.NFTDataJson{
 					ExpirationDate: int64(999999999999999),
-					HashRateOwned:  float64(1),
+					HashRateOwned:  types.NewHashPowerFromInt(1),
 				},
 				Owner: "",
 			}, {
@@ -767,7 +1095,7 @@ func TestProcessCollection_Rounding(t *testing.T) {
 				Data: "",
 				DataJson: types.NFTDataJson{
 					ExpirationDate: int64(999999999999999),
-					HashRateOwned:  float64(1),
+					HashRateOwned:  types.NewHashPowerFromInt(1),
 				},
 				Owner: "",
 			}, {
@@ -777,7 +1105,7 @@ func TestProcessCollection_Rounding(t *testing.T) {
 				Data: "",
 				DataJson: types.NFTDataJson{
 					ExpirationDate: int64(999999999999999),
-					HashRateOwned:  float64(1),
+					HashRateOwned:  types.NewHashPowerFromInt(1),
 				},
 				Owner: "",
 			}, {
@@ -787,7 +1115,7 @@ func TestProcessCollection_Rounding(t *testing.T) {
 				Data: "",
 				DataJson: types.NFTDataJson{
 					ExpirationDate: int64(999999999999999),
-					HashRateOwned:  float64(1),
+					HashRateOwned:  types.NewHashPowerFromInt(1),
 				},
 				Owner: "",
 			},
@@ -797,7 +1125,7 @@ func TestProcessCollection_Rounding(t *testing.T) {
 	testAuraCollection := types.AuraPoolCollection{
 		Id:           int64(1),
 		DenomId:      "col1",
-		HashingPower: float64(6),
+		HashingPower: types.NewHashPowerFromInt(6),
 	}
 
 	farm1Denom1Nft1TransferHistoryJSON := `
@@ -848,23 +1176,23 @@ func TestProcessCollection_Rounding(t *testing.T) {
 	require.NoError(t, json.Unmarshal([]byte(arm1Denom1NftMintEventsJSON), &farm1Denom1Nft1MintHistory))
 	mockApiRequester.On("GetHasuraCollectionNftMintEvents", mock.Anything, mock.Anything).Return(farm1Denom1Nft1MintHistory, nil).Once()
 
-	s := NewPayService(config, mockApiRequester, &mockHelper{}, btcNetworkParams)
+	s := NewPayService(config, mockApiRequester, &mockHelper{}, &mockAlerter{}, btcNetworkParams, &mockSecretProvider{}, nil)
 
 	periodEnd := int64(1688462183)
 	lastPaymentTimestamp := int64(1688395493)
 
-	receivedRewardForFarmBtcDecimal := decimal.NewFromFloat(200)
-	totalRewardForFarmAfterCudosFeeBtcDecimal, cudosFeeOfTotalRewardBtcDecimal := s.calculateCudosFeeOfTotalFarmIncome(receivedRewardForFarmBtcDecimal)
+	receivedRewardForFarm := types.NewSatsFromBtcFloat(200)
+	totalRewardForFarmAfterCudosFee, cudosFeeOfTotalReward := s.calculateCudosFeeOfTotalFarmIncome(receivedRewardForFarm)
 
 	currentHashPowerForFarm := testFarm.TotalHashPower
-	hourlyMaintenanceFeePerThInBtcDecimal := s.calculateHourlyMaintenanceFee(testFarm, currentHashPowerForFarm)
+	hourlyMaintenanceFeePerThIn := s.calculateHourlyMaintenanceFee(testFarm, currentHashPowerForFarm)
 
 	farmAuraPoolCollectionsMap := map[string]types.AuraPoolCollection{}
 	farmAuraPoolCollectionsMap[testCollection.Denom.Id] = testAuraCollection
 
-	mintedHashPowerForFarm := float64(6)
-	rewardForNftOwnersBtcDecimal := calculateRewardByPercent(currentHashPowerForFarm, mintedHashPowerForFarm, totalRewardForFarmAfterCudosFeeBtcDecimal)
-	destinationAddressesWithAmountBtcDecimal := make(map[string]decimal.Decimal)
+	mintedHashPowerForFarm := types.NewHashPowerFromInt(6)
+	rewardForNftOwners := calculateRewardByPercent(currentHashPowerForFarm, mintedHashPowerForFarm, totalRewardForFarmAfterCudosFee)
+	destinationAddressesWithAmount := make(map[string]types.Sats)
 	currentHashPowerForFarm = testFarm.TotalHashPower
 
 	collectionProcessResult, _ := s.processCollection(
@@ -872,13 +1200,13 @@ func TestProcessCollection_Rounding(t *testing.T) {
 		mockStorage,
 		testFarm,
 		testCollection,
-		destinationAddressesWithAmountBtcDecimal,
-		rewardForNftOwnersBtcDecimal,
+		destinationAddressesWithAmount,
+		rewardForNftOwners,
 		mintedHashPowerForFarm,
 		currentHashPowerForFarm,
-		totalRewardForFarmAfterCudosFeeBtcDecimal,
-		cudosFeeOfTotalRewardBtcDecimal,
-		hourlyMaintenanceFeePerThInBtcDecimal,
+		totalRewardForFarmAfterCudosFee,
+		cudosFeeOfTotalReward,
+		hourlyMaintenanceFeePerThIn,
 		lastPaymentTimestamp,
 		periodEnd,
 		farmAuraPoolCollectionsMap,
@@ -886,74 +1214,95 @@ func TestProcessCollection_Rounding(t *testing.T) {
 
 	// fmt.Println(currentHashPowerForFarm)
 	// fmt.Println(mintedHashPowerForFarm)
-	// fmt.Println(totalRewardForFarmAfterCudosFeeBtcDecimal)
-	// fmt.Println(rewardForNftOwnersBtcDecimal)
+	// fmt.Println(totalRewardForFarmAfterCudosFee)
+	// fmt.Println(rewardForNftOwners)
 	// fmt.Println(collectionProcessResult.NftStatistics[0].Reward)
 	// fmt.Println(collectionProcessResult.NftStatistics[1].Reward)
 
-	_, err := calculateLeftoverNftRewardDistribution(rewardForNftOwnersBtcDecimal, collectionProcessResult.NftStatistics)
+	_, err := calculateLeftoverNftRewardDistribution(rewardForNftOwners, collectionProcessResult.NftStatistics)
 	require.NoError(t, err, "Rounding error")
 }
 
+func TestAddRewardsDistributedMetrics(t *testing.T) {
+	farm := types.Farm{RewardsFromPoolBtcWalletName: "metrics_farm"}
+	statistics := []types.NFTStatistics{
+		{
+			MaintenanceFee:           types.NewSatsFromBtcFloat(0.1),
+			CUDOPartOfMaintenanceFee: types.NewSatsFromBtcFloat(0.05),
+			NFTOwnersForPeriod: []types.NFTOwnerInformation{
+				{Reward: types.NewSatsFromBtcFloat(0.3)},
+				{Reward: types.NewSatsFromBtcFloat(0.2)},
+			},
+		},
+	}
+
+	addRewardsDistributedMetrics(farm, types.NewSatsFromBtcFloat(1), types.NewSatsFromBtcFloat(0.9), statistics)
+
+	require.InDelta(t, 0.15, testutil.ToFloat64(metrics.RewardsDistributedBtc.WithLabelValues("metrics_farm", metrics.RecipientCudoFee)), 1e-9)
+	require.InDelta(t, 0.1, testutil.ToFloat64(metrics.RewardsDistributedBtc.WithLabelValues("metrics_farm", metrics.RecipientMaintenance)), 1e-9)
+	require.InDelta(t, 0.5, testutil.ToFloat64(metrics.RewardsDistributedBtc.WithLabelValues("metrics_farm", metrics.RecipientNftOwners)), 1e-9)
+	require.InDelta(t, 0.25, testutil.ToFloat64(metrics.RewardsDistributedBtc.WithLabelValues("metrics_farm", metrics.RecipientLeftovers)), 1e-9)
+}
+
 func TestSendRewards(t *testing.T) {
 	tests := []struct {
-		name                                             string
-		unspentTxForFarm                                 btcjson.ListUnspentResult
-		receivedRewardForFarmBtcDecimal                  decimal.Decimal
-		rewardForNftOwnersBtcDecimal                     decimal.Decimal
-		totalRewardForFarmAfterCudosFeeBtcDecimal        decimal.Decimal
-		destinationAddressesWithAmountBtcDecimal         map[string]decimal.Decimal
-		statistics                                       []types.NFTStatistics
-		currentAcummulatedAmountForAddress               map[string]decimal.Decimal
-		expectedAddressesToSendBtc                       map[string]float64
-		expectedAddressesWithThresholdToUpdateBtcDecimal map[string]decimal.Decimal
-		expectedAddressesWithAmountInfo                  map[string]types.AmountInfo
-		sendManyResult                                   error
-		updateThresholdStatusResult                      error
-		saveStatisticsResult                             error
-		mockStorageFuncResult                            error
-		mockAPIRequesterFuncResult                       error
-		expectError                                      error
+		name                                   string
+		unspentTxForFarm                       types.UnspentTx
+		receivedRewardForFarm                  types.Sats
+		rewardForNftOwners                     types.Sats
+		totalRewardForFarmAfterCudosFee        types.Sats
+		destinationAddressesWithAmount         map[string]types.Sats
+		statistics                             []types.NFTStatistics
+		currentAcummulatedAmountForAddress     map[string]types.Sats
+		expectedAddressesToSendBtc             map[string]types.Sats
+		expectedAddressesWithThresholdToUpdate map[string]types.Sats
+		expectedAddressesWithAmountInfo        map[string]types.AmountInfo
+		sendManyResult                         error
+		updateThresholdStatusResult            error
+		saveStatisticsResult                   error
+		mockStorageFuncResult                  error
+		mockAPIRequesterFuncResult             error
+		expectError                            error
 	}{
 		{
 			name: "happy path",
-			unspentTxForFarm: btcjson.ListUnspentResult{
+			unspentTxForFarm: types.UnspentTx{
 				TxID:    "1",
-				Amount:  6.25,
+				Amount:  625000000,
 				Address: "address_for_receiving_reward_from_pool_1",
 			},
-			receivedRewardForFarmBtcDecimal:           decimal.NewFromFloat(6.25),
-			rewardForNftOwnersBtcDecimal:              decimal.NewFromFloat(1),
-			totalRewardForFarmAfterCudosFeeBtcDecimal: decimal.NewFromFloat(5),
-			destinationAddressesWithAmountBtcDecimal: map[string]decimal.Decimal{
-				"address_for_receiving_reward_from_pool_1": decimal.NewFromFloat(4),
-				"nft_holder_address_1":                     decimal.NewFromFloat(1),
-				"leftover_reward_payout_address_1":         decimal.NewFromFloat(1.25),
+			receivedRewardForFarm:           types.NewSatsFromBtcFloat(6.25),
+			rewardForNftOwners:              types.NewSatsFromBtcFloat(1),
+			totalRewardForFarmAfterCudosFee: types.NewSatsFromBtcFloat(5),
+			destinationAddressesWithAmount: map[string]types.Sats{
+				"address_for_receiving_reward_from_pool_1": types.NewSatsFromBtcFloat(4),
+				"nft_holder_address_1":                     types.NewSatsFromBtcFloat(1),
+				"leftover_reward_payout_address_1":         types.NewSatsFromBtcFloat(1.25),
 			},
 			statistics: []types.NFTStatistics{
 				{
-					Reward: decimal.NewFromFloat(1),
+					Reward: types.NewSatsFromBtcFloat(1),
 				},
 			},
-			currentAcummulatedAmountForAddress: map[string]decimal.Decimal{
-				"address_for_receiving_reward_from_pool_1": decimal.Zero,
-				"nft_holder_address_1":                     decimal.Zero,
-				"leftover_reward_payout_address_1":         decimal.Zero,
+			currentAcummulatedAmountForAddress: map[string]types.Sats{
+				"address_for_receiving_reward_from_pool_1": 0,
+				"nft_holder_address_1":                     0,
+				"leftover_reward_payout_address_1":         0,
 			},
-			expectedAddressesToSendBtc: map[string]float64{
-				"address_for_receiving_reward_from_pool_1": 4,
-				"nft_holder_address_1":                     1,
-				"leftover_reward_payout_address_1":         1.25,
+			expectedAddressesToSendBtc: map[string]types.Sats{
+				"address_for_receiving_reward_from_pool_1": types.NewSatsFromBtcFloat(4),
+				"nft_holder_address_1":                     types.NewSatsFromBtcFloat(1),
+				"leftover_reward_payout_address_1":         types.NewSatsFromBtcFloat(1.25),
 			},
-			expectedAddressesWithThresholdToUpdateBtcDecimal: map[string]decimal.Decimal{
-				"address_for_receiving_reward_from_pool_1": decimal.Zero,
-				"nft_holder_address_1":                     decimal.Zero,
-				"leftover_reward_payout_address_1":         decimal.Zero,
+			expectedAddressesWithThresholdToUpdate: map[string]types.Sats{
+				"address_for_receiving_reward_from_pool_1": 0,
+				"nft_holder_address_1":                     0,
+				"leftover_reward_payout_address_1":         0,
 			},
 			expectedAddressesWithAmountInfo: map[string]types.AmountInfo{
-				"address_for_receiving_reward_from_pool_1": {Amount: decimal.NewFromFloat(4), ThresholdReached: true},
-				"nft_holder_address_1":                     {Amount: decimal.NewFromFloat(1), ThresholdReached: true},
-				"leftover_reward_payout_address_1":         {Amount: decimal.NewFromFloat(1.25), ThresholdReached: true},
+				"address_for_receiving_reward_from_pool_1": {Amount: types.NewSatsFromBtcFloat(4), ThresholdReached: true},
+				"nft_holder_address_1":                     {Amount: types.NewSatsFromBtcFloat(1), ThresholdReached: true},
+				"leftover_reward_payout_address_1":         {Amount: types.NewSatsFromBtcFloat(1.25), ThresholdReached: true},
 			},
 			sendManyResult:              nil,
 			updateThresholdStatusResult: nil,
@@ -963,43 +1312,43 @@ func TestSendRewards(t *testing.T) {
 		},
 		{
 			name: "send_many_error",
-			unspentTxForFarm: btcjson.ListUnspentResult{
+			unspentTxForFarm: types.UnspentTx{
 				TxID:    "1",
-				Amount:  6.25,
+				Amount:  625000000,
 				Address: "address_for_receiving_reward_from_pool_1",
 			},
-			receivedRewardForFarmBtcDecimal:           decimal.NewFromFloat(6.25),
-			rewardForNftOwnersBtcDecimal:              decimal.NewFromFloat(1),
-			totalRewardForFarmAfterCudosFeeBtcDecimal: decimal.NewFromFloat(5),
-			destinationAddressesWithAmountBtcDecimal: map[string]decimal.Decimal{
-				"address_for_receiving_reward_from_pool_1": decimal.NewFromFloat(4),
-				"nft_holder_address_1":                     decimal.NewFromFloat(1),
-				"leftover_reward_payout_address_1":         decimal.NewFromFloat(1.25),
+			receivedRewardForFarm:           types.NewSatsFromBtcFloat(6.25),
+			rewardForNftOwners:              types.NewSatsFromBtcFloat(1),
+			totalRewardForFarmAfterCudosFee: types.NewSatsFromBtcFloat(5),
+			destinationAddressesWithAmount: map[string]types.Sats{
+				"address_for_receiving_reward_from_pool_1": types.NewSatsFromBtcFloat(4),
+				"nft_holder_address_1":                     types.NewSatsFromBtcFloat(1),
+				"leftover_reward_payout_address_1":         types.NewSatsFromBtcFloat(1.25),
 			},
 			statistics: []types.NFTStatistics{
 				{
-					Reward: decimal.NewFromFloat(1),
+					Reward: types.NewSatsFromBtcFloat(1),
 				},
 			},
-			currentAcummulatedAmountForAddress: map[string]decimal.Decimal{
-				"address_for_receiving_reward_from_pool_1": decimal.Zero,
-				"nft_holder_address_1":                     decimal.Zero,
-				"leftover_reward_payout_address_1":         decimal.Zero,
+			currentAcummulatedAmountForAddress: map[string]types.Sats{
+				"address_for_receiving_reward_from_pool_1": 0,
+				"nft_holder_address_1":                     0,
+				"leftover_reward_payout_address_1":         0,
 			},
-			expectedAddressesToSendBtc: map[string]float64{
-				"address_for_receiving_reward_from_pool_1": 4,
-				"nft_holder_address_1":                     1,
-				"leftover_reward_payout_address_1":         1.25,
+			expectedAddressesToSendBtc: map[string]types.Sats{
+				"address_for_receiving_reward_from_pool_1": types.NewSatsFromBtcFloat(4),
+				"nft_holder_address_1":                     types.NewSatsFromBtcFloat(1),
+				"leftover_reward_payout_address_1":         types.NewSatsFromBtcFloat(1.25),
 			},
-			expectedAddressesWithThresholdToUpdateBtcDecimal: map[string]decimal.Decimal{
-				"address_for_receiving_reward_from_pool_1": decimal.Zero,
-				"nft_holder_address_1":                     decimal.Zero,
-				"leftover_reward_payout_address_1":         decimal.Zero,
+			expectedAddressesWithThresholdToUpdate: map[string]types.Sats{
+				"address_for_receiving_reward_from_pool_1": 0,
+				"nft_holder_address_1":                     0,
+				"leftover_reward_payout_address_1":         0,
 			},
 			expectedAddressesWithAmountInfo: map[string]types.AmountInfo{
-				"address_for_receiving_reward_from_pool_1": {Amount: decimal.NewFromFloat(4), ThresholdReached: true},
-				"nft_holder_address_1":                     {Amount: decimal.NewFromFloat(1), ThresholdReached: true},
-				"leftover_reward_payout_address_1":         {Amount: decimal.NewFromFloat(1.25), ThresholdReached: true},
+				"address_for_receiving_reward_from_pool_1": {Amount: types.NewSatsFromBtcFloat(4), ThresholdReached: true},
+				"nft_holder_address_1":                     {Amount: types.NewSatsFromBtcFloat(1), ThresholdReached: true},
+				"leftover_reward_payout_address_1":         {Amount: types.NewSatsFromBtcFloat(1.25), ThresholdReached: true},
 			},
 			sendManyResult:              fmt.Errorf("test error"),
 			updateThresholdStatusResult: nil,
@@ -1014,16 +1363,24 @@ func TestSendRewards(t *testing.T) {
 			mockStorage := new(mockStorage)
 			mockAPIRequester := new(mockAPIRequester)
 
-			mockAPIRequester.On("SendMany", mock.Anything, test.expectedAddressesToSendBtc).Return("", test.sendManyResult).Once()
+			var savedIntent types.PayoutIntent
+			mockStorage.On("SavePayoutIntent", mock.Anything, mock.MatchedBy(func(intent types.PayoutIntent) bool {
+				return intent.UTXOTxHash == test.unspentTxForFarm.TxID && intent.Status == types.PayoutIntentPending
+			})).Return(nil).Run(func(args mock.Arguments) {
+				savedIntent = args.Get(1).(types.PayoutIntent)
+			}).Once()
+			mockStorage.On("MarkPayoutIntentSent", mock.Anything, mock.Anything, "tx_hash").Return(nil).Maybe()
+
+			mockAPIRequester.On("SendMany", mock.Anything, mock.Anything, test.expectedAddressesToSendBtc, mock.Anything).Return("tx_hash", test.sendManyResult).Once()
 
 			mockStorage.On(
 				"UpdateThresholdStatus",
 				mock.Anything,
 				test.unspentTxForFarm.TxID,
 				mock.Anything,
-				mock.MatchedBy(func(arg map[string]decimal.Decimal) bool {
+				mock.MatchedBy(func(arg map[string]types.Sats) bool {
 					for address, amount := range arg {
-						if !test.expectedAddressesWithThresholdToUpdateBtcDecimal[address].Equal(amount) {
+						if test.expectedAddressesWithThresholdToUpdate[address] != amount {
 							return false
 						}
 					}
@@ -1040,7 +1397,7 @@ func TestSendRewards(t *testing.T) {
 				mock.Anything,
 				mock.MatchedBy(func(arg map[string]types.AmountInfo) bool {
 					for address, amountInfo := range arg {
-						if !test.expectedAddressesWithAmountInfo[address].Amount.Equal(amountInfo.Amount) ||
+						if test.expectedAddressesWithAmountInfo[address].Amount != amountInfo.Amount ||
 							test.expectedAddressesWithAmountInfo[address].ThresholdReached != amountInfo.ThresholdReached {
 							return false
 						}
@@ -1057,7 +1414,9 @@ func TestSendRewards(t *testing.T) {
 			for address, amount := range test.currentAcummulatedAmountForAddress {
 				mockStorage.On("GetCurrentAcummulatedAmountForAddress", mock.Anything, address, mock.Anything).Return(amount, nil).Once()
 			}
-			payService := NewPayService(&infrastructure.Config{GlobalPayoutThresholdInBTC: 1}, mockAPIRequester, &mockHelper{}, &types.BtcNetworkParams{})
+			mockStorage.On("GetFarmPayoutThreshold", mock.Anything, mock.Anything).Return(types.FarmPayoutThreshold{}, sql.ErrNoRows)
+			mockStorage.On("GetAddressPayoutThreshold", mock.Anything, mock.Anything).Return(types.AddressPayoutThreshold{}, sql.ErrNoRows)
+			payService := NewPayService(&infrastructure.Config{GlobalPayoutThresholdInBTC: 100000000}, mockAPIRequester, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
 			btcClient := &mockBtcClient{}
 			btcClient.On("GetBalance", mock.Anything).Return(btcutil.NewAmount(1000000000)).Once()
 
@@ -1068,24 +1427,35 @@ func TestSendRewards(t *testing.T) {
 				types.Farm{},
 				test.unspentTxForFarm,
 				int64(1),
-				test.receivedRewardForFarmBtcDecimal,
-				test.rewardForNftOwnersBtcDecimal,
-				test.totalRewardForFarmAfterCudosFeeBtcDecimal,
-				test.destinationAddressesWithAmountBtcDecimal,
+				test.receivedRewardForFarm,
+				test.rewardForNftOwners,
+				test.totalRewardForFarmAfterCudosFee,
+				test.destinationAddressesWithAmount,
 				test.statistics,
 				[]types.CollectionPaymentAllocation{},
 			)
 
+			// the idempotency key of the intent is sent as transaction comment, so the recovery can find the transaction
+			mockAPIRequester.AssertCalled(t, "SendMany", mock.Anything, mock.Anything, test.expectedAddressesToSendBtc, savedIntent.IdempotencyKey)
+
 			if test.expectError != nil {
 				assert.Error(t, err, "Expected error in test case")
+				mockStorage.AssertNotCalled(t, "MarkPayoutIntentSent", mock.Anything, mock.Anything, mock.Anything)
+				mockStorage.AssertNotCalled(t, "UpdateThresholdStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
 			} else {
 				assert.NoError(t, err, "Expected no error in test case")
+				mockStorage.AssertCalled(t, "MarkPayoutIntentSent", mock.Anything, savedIntent.IdempotencyKey, "tx_hash")
 			}
 		})
 	}
 }
 
 func tearDownDatabase(sqlxDB *sqlx.DB) {
+	if sqlxDB.DriverName() == sql_db.DriverSqlite {
+		sqlxDB.Close()
+		return
+	}
+
 	_, err := sqlxDB.Exec("TRUNCATE TABLE utxo_transactions")
 	if err != nil {
 		panic(err)
@@ -1110,6 +1480,10 @@ func tearDownDatabase(sqlxDB *sqlx.DB) {
 	if err != nil {
 		panic(err)
 	}
+	_, err = sqlxDB.Exec("TRUNCATE TABLE payout_intents")
+	if err != nil {
+		panic(err)
+	}
 }
 
 func setupMockApiRequester(t *testing.T) *mockAPIRequester {
@@ -1240,14 +1614,14 @@ func setupMockApiRequester(t *testing.T) *mockAPIRequester {
 	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "cudos1_nft_owner_2", "BTC").Return("nft_owner_2_payout_addr", nil)
 
 	// maintenance_fee_payout_address_1 is below threshold of 0.01 with values 5.928e-05
-	apiRequester.On("SendMany", mock.Anything, map[string]float64{
-		"leftover_reward_payout_address_1":      1,
-		"cudo_fee_payout_address_1":             1.25,
-		"cudo_maintenance_fee_payout_address_1": 0.24516129,
-		"maintenance_fee_payout_address_1":      0.24516129,
-		"nft_minter_payout_addr":                0.92359932,
-		"nft_owner_2_payout_addr":               2.58607809,
-	}).Return("farm_1_denom_1_nft_owner_2_tx_hash", nil).Once()
+	apiRequester.On("SendMany", mock.Anything, mock.Anything, map[string]types.Sats{
+		"leftover_reward_payout_address_1":      types.NewSatsFromBtcFloat(1),
+		"cudo_fee_payout_address_1":             types.NewSatsFromBtcFloat(1.25),
+		"cudo_maintenance_fee_payout_address_1": types.NewSatsFromBtcFloat(0.24516129),
+		"maintenance_fee_payout_address_1":      types.NewSatsFromBtcFloat(0.24516129),
+		"nft_minter_payout_addr":                types.NewSatsFromBtcFloat(0.92359932),
+		"nft_owner_2_payout_addr":               types.NewSatsFromBtcFloat(2.5860781),
+	}, mock.Anything).Return("farm_1_denom_1_nft_owner_2_tx_hash", nil).Once()
 
 	return apiRequester
 }
@@ -1255,13 +1629,12 @@ func setupMockApiRequester(t *testing.T) *mockAPIRequester {
 func setupMockBtcClient() *mockBtcClient {
 	btcClient := &mockBtcClient{}
 
-	btcClient.On("ListUnspent").Return([]btcjson.ListUnspentResult{
-		{TxID: "1", Amount: 6.25, Address: "address_for_receiving_reward_from_pool_1"},
+	btcClient.On("ListUnspent").Return([]types.UnspentTx{
+		{TxID: "1", Amount: 625000000, Address: "address_for_receiving_reward_from_pool_1"},
 	}, nil).Once()
 
 	btcClient.On("LoadWallet", "farm_1").Return(&btcjson.LoadWalletResult{}, nil).Once()
 	btcClient.On("LoadWallet", "farm_2").Return(&btcjson.LoadWalletResult{}, errors.New("failed to load wallet")).Once()
-	btcClient.On("UnloadWallet", mock.Anything).Return(nil)
 	btcClient.On("WalletPassphrase", mock.Anything, mock.Anything).Return(nil)
 	btcClient.On("WalletLock").Return(nil)
 	btcClient.On("GetRawTransactionVerbose", mock.Anything).Return(&btcjson.TxRawResult{Time: 1666641078}, nil).Once()
@@ -1274,6 +1647,10 @@ func setupMockBtcClient() *mockBtcClient {
 
 type mockBtcClient struct {
 	mock.Mock
+
+	// the raw requests are recorded with their params, the mocked result is the same for all of them
+	rawRequestsMutex sync.Mutex
+	rawRequests      []string
 }
 
 func (mbc *mockBtcClient) LoadWallet(walletName string) (*btcjson.LoadWalletResult, error) {
@@ -1281,11 +1658,6 @@ func (mbc *mockBtcClient) LoadWallet(walletName string) (*btcjson.LoadWalletResu
 	return args.Get(0).(*btcjson.LoadWalletResult), args.Error(1)
 }
 
-func (mbc *mockBtcClient) UnloadWallet(walletName *string) error {
-	args := mbc.Called(walletName)
-	return args.Error(0)
-}
-
 func (mbc *mockBtcClient) WalletPassphrase(passphrase string, timeoutSecs int64) error {
 	args := mbc.Called(passphrase, timeoutSecs)
 	return args.Error(0)
@@ -1306,43 +1678,52 @@ func (mbc *mockBtcClient) GetBalance(account string) (btcutil.Amount, error) {
 	return args.Get(0).(btcutil.Amount), args.Error(1)
 }
 
+// OpenWallet returns the same mock, so the wallet calls can be asserted on it
+func (mbc *mockBtcClient) OpenWallet(walletName string) (BtcClient, func(), error) {
+	return mbc, func() {}, nil
+}
+
 func (mbc *mockBtcClient) RawRequest(method string, params []json.RawMessage) (json.RawMessage, error) {
+	rawParams, _ := json.Marshal(params)
+	mbc.rawRequestsMutex.Lock()
+	mbc.rawRequests = append(mbc.rawRequests, fmt.Sprintf("%s %s", method, rawParams))
+	mbc.rawRequestsMutex.Unlock()
+
 	args := mbc.Called()
 	return args.Get(0).(json.RawMessage), args.Error(1)
 }
 
-func (mbc *mockBtcClient) ListUnspent() ([]btcjson.ListUnspentResult, error) {
+func (mbc *mockBtcClient) ListUnspent() ([]types.UnspentTx, error) {
 	args := mbc.Called()
-	return args.Get(0).([]btcjson.ListUnspentResult), args.Error(1)
+	return args.Get(0).([]types.UnspentTx), args.Error(1)
 }
 
 func setupMockStorage() *mockStorage {
 	storage := &mockStorage{}
 
-	leftoverAmount := decimal.NewFromFloat(1)
-	nftMinterAmount, _ := decimal.NewFromString("0.923599320881448051612903226368")
-	nftOwner2Amount, _ := decimal.NewFromString("2.586078098468055948387096773632")
-	cudoPartOfReward, _ := decimal.NewFromString("1.25")
-	cudoPartOfMaintenanceFee, _ := decimal.NewFromString("0.245161290325248")
-	maintenanceFeeAddress1Amount, _ := decimal.NewFromString("0.245161290325248")
+	leftoverAmount := types.NewSatsFromBtcFloat(1)
+	nftMinterAmount := types.Sats(92359932)
+	nftOwner2Amount := types.Sats(258607810)
+	cudoPartOfReward := types.Sats(125000000)
+	cudoPartOfMaintenanceFee := types.Sats(24516129)
+	maintenanceFeeAddress1Amount := types.Sats(24516129)
 
-	amount, _ := decimal.NewFromString("3.509677419349504")
+	amount := types.Sats(350967742)
 
 	storage.On("GetPayoutTimesForNFT", mock.Anything, mock.Anything, mock.Anything).Return([]types.NFTStatistics{}, nil)
 	storage.On("SaveStatistics", mock.Anything,
-		mock.MatchedBy(func(payment decimal.Decimal) bool {
-			return payment.Equal(decimal.NewFromFloat(6.25))
+		mock.MatchedBy(func(payment types.Sats) bool {
+			return payment == types.NewSatsFromBtcFloat(6.25)
 		}),
 		mock.MatchedBy(func(collectionAllocations []types.CollectionPaymentAllocation) bool {
-			collectionPartOfFarm := decimal.NewFromFloat(0.8)
 
 			return collectionAllocations[0].FarmId == 1 &&
 				collectionAllocations[0].CollectionId == 1 &&
-				collectionAllocations[0].CollectionAllocationAmount.Equals(decimal.NewFromFloat(4)) &&
-				collectionAllocations[0].CUDOGeneralFee.Equals(cudoPartOfReward.Mul(collectionPartOfFarm)) &&
-				collectionAllocations[0].CUDOMaintenanceFee.Equals(cudoPartOfMaintenanceFee) &&
-				collectionAllocations[0].FarmUnsoldLeftovers.Equals(decimal.NewFromFloat(0)) &&
-				collectionAllocations[0].FarmMaintenanceFee.Equals(maintenanceFeeAddress1Amount)
+				collectionAllocations[0].CollectionAllocationAmount == types.NewSatsFromBtcFloat(4) &&
+				collectionAllocations[0].CUDOGeneralFee == cudoPartOfReward.Percent(decimal.NewFromInt(80)) &&
+				collectionAllocations[0].CUDOMaintenanceFee == cudoPartOfMaintenanceFee &&
+				collectionAllocations[0].FarmUnsoldLeftovers == types.NewSatsFromBtcFloat(0) &&
+				collectionAllocations[0].FarmMaintenanceFee == maintenanceFeeAddress1Amount
 		}),
 		mock.MatchedBy(func(amountInfoMap map[string]types.AmountInfo) bool {
 			return amountInfoMap["leftover_reward_payout_address_1"].ThresholdReached == true &&
@@ -1351,11 +1732,11 @@ func setupMockStorage() *mockStorage {
 				amountInfoMap["cudo_fee_payout_address_1"].ThresholdReached == true &&
 				amountInfoMap["maintenance_fee_payout_address_1"].ThresholdReached == true &&
 
-				amountInfoMap["leftover_reward_payout_address_1"].Amount.Equals(leftoverAmount.RoundFloor(8)) &&
-				amountInfoMap["nft_minter_payout_addr"].Amount.Equals(nftMinterAmount.RoundFloor(8)) &&
-				amountInfoMap["nft_owner_2_payout_addr"].Amount.Equals(nftOwner2Amount.RoundFloor(8)) &&
-				amountInfoMap["cudo_fee_payout_address_1"].Amount.Equals(cudoPartOfReward.RoundFloor(8)) &&
-				amountInfoMap["maintenance_fee_payout_address_1"].Amount.Equals(maintenanceFeeAddress1Amount.RoundFloor(8))
+				amountInfoMap["leftover_reward_payout_address_1"].Amount == leftoverAmount &&
+				amountInfoMap["nft_minter_payout_addr"].Amount == nftMinterAmount &&
+				amountInfoMap["nft_owner_2_payout_addr"].Amount == nftOwner2Amount &&
+				amountInfoMap["cudo_fee_payout_address_1"].Amount == cudoPartOfReward &&
+				amountInfoMap["maintenance_fee_payout_address_1"].Amount == maintenanceFeeAddress1Amount
 		}),
 
 		mock.MatchedBy(func(nftStatistics []types.NFTStatistics) bool {
@@ -1367,9 +1748,9 @@ func setupMockStorage() *mockStorage {
 				nftStatistic.DenomId == "farm_1_denom_1" &&
 				nftStatistic.PayoutPeriodStart == 1664999478 &&
 				nftStatistic.PayoutPeriodEnd == 1666641078 &&
-				nftStatistic.Reward.Equals(amount) &&
-				nftStatistic.MaintenanceFee.Equals(maintenanceFeeAddress1Amount) &&
-				nftStatistic.CUDOPartOfMaintenanceFee.Equals(cudoPartOfMaintenanceFee)
+				nftStatistic.Reward == amount &&
+				nftStatistic.MaintenanceFee == maintenanceFeeAddress1Amount &&
+				nftStatistic.CUDOPartOfMaintenanceFee == cudoPartOfMaintenanceFee
 
 			nftOwnerStat1Correct := nftOwnerStat1.TimeOwnedFrom == 1664999478 &&
 				nftOwnerStat1.TimeOwnedTo == 1665431478 &&
@@ -1377,7 +1758,7 @@ func setupMockStorage() *mockStorage {
 				nftOwnerStat1.PercentOfTimeOwned == 26.315789473684198 &&
 				nftOwnerStat1.PayoutAddress == "nft_minter_payout_addr" &&
 				nftOwnerStat1.Owner == "cudos1_nft_minter" &&
-				nftOwnerStat1.Reward.Equals(nftMinterAmount)
+				nftOwnerStat1.Reward == nftMinterAmount
 
 			nftOwnerStat2Correct := nftOwnerStat2.TimeOwnedFrom == 1665431478 &&
 				nftOwnerStat2.TimeOwnedTo == 1666641078 &&
@@ -1385,7 +1766,7 @@ func setupMockStorage() *mockStorage {
 				nftOwnerStat2.PercentOfTimeOwned == 73.6842105263157 &&
 				nftOwnerStat2.PayoutAddress == "nft_owner_2_payout_addr" &&
 				nftOwnerStat2.Owner == "cudos1_nft_owner_2" &&
-				nftOwnerStat2.Reward.Equals(nftOwner2Amount)
+				nftOwnerStat2.Reward == nftOwner2Amount
 
 			return nftStatisticCorrect && nftOwnerStat1Correct && nftOwnerStat2Correct
 		}),
@@ -1398,9 +1779,16 @@ func setupMockStorage() *mockStorage {
 	storage.On("GetUTXOTransaction", mock.Anything, "3").Return(types.UTXOTransaction{TxHash: "3", Processed: false}, nil)
 	storage.On("GetUTXOTransaction", mock.Anything, "4").Return(types.UTXOTransaction{TxHash: "4", Processed: false}, nil)
 
-	storage.On("GetCurrentAcummulatedAmountForAddress", mock.Anything, mock.Anything, mock.Anything).Return(decimal.Zero, nil)
+	storage.On("GetCurrentAcummulatedAmountForAddress", mock.Anything, mock.Anything, mock.Anything).Return(types.Sats(0), nil)
+	storage.On("GetFarmPayoutThreshold", mock.Anything, mock.Anything).Return(types.FarmPayoutThreshold{}, sql.ErrNoRows)
+	storage.On("GetAddressPayoutThreshold", mock.Anything, mock.Anything).Return(types.AddressPayoutThreshold{}, sql.ErrNoRows)
 
 	storage.On("UpdateThresholdStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	storage.On("SavePayoutIntent", mock.Anything, mock.Anything).Return(nil)
+	storage.On("MarkPayoutIntentSent", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	storage.On("GetUnfinishedPayoutIntents", mock.Anything, mock.Anything).Return([]types.PayoutIntent{}, nil)
+	storage.On("GetPausedFarmIds", mock.Anything).Return([]int64{}, nil)
+	storage.On("GetFarmSchedules", mock.Anything).Return([]types.FarmSchedule{}, nil)
 
 	storage.On("GetApprovedFarms", mock.Anything).Return([]types.Farm{
 		{
@@ -1411,7 +1799,7 @@ func setupMockStorage() *mockStorage {
 			LeftoverRewardPayoutAddress:        "leftover_reward_payout_address_1",
 			MaintenanceFeePayoutAddress:        "maintenance_fee_payout_address_1",
 			MaintenanceFeeInBtc:                1,
-			TotalHashPower:                     1200,
+			TotalHashPower:                     types.NewHashPowerFromInt(1200),
 		},
 		{
 			Id:                                 2,
@@ -1421,7 +1809,7 @@ func setupMockStorage() *mockStorage {
 			LeftoverRewardPayoutAddress:        "leftover_reward_payout_address_2",
 			MaintenanceFeePayoutAddress:        "maintenance_fee_payout_address_2",
 			MaintenanceFeeInBtc:                0.01,
-			TotalHashPower:                     1200,
+			TotalHashPower:                     types.NewHashPowerFromInt(1200),
 		},
 	}, nil)
 
@@ -1430,7 +1818,7 @@ func setupMockStorage() *mockStorage {
 			{
 				Id:           1,
 				DenomId:      "farm_1_denom_1",
-				HashingPower: 960,
+				HashingPower: types.NewHashPowerFromInt(960),
 			},
 		}, nil).Once()
 
@@ -1444,16 +1832,29 @@ func setupMockStorage() *mockStorage {
 	return storage
 }
 
+// setupInMemoryStorage returns an in-memory sqlite storage, or the postgres storage from the config when EXECUTE_DB_TEST is set
 func setupInMemoryStorage(c *infrastructure.Config) (Storage, *sqlx.DB) {
-	psqlInfo := fmt.Sprintf("host=%s port=%s user=%s "+
-		"password=%s dbname=%s sslmode=disable",
-		c.DbHost, c.DbPort, c.DbUser, c.DbPassword, c.DbName)
-
-	db, err := sqlx.Connect(c.DbDriverName, psqlInfo)
+	var db *sqlx.DB
+	var err error
+	if executeDBTests() {
+		psqlInfo := fmt.Sprintf("host=%s port=%s user=%s "+
+			"password=%s dbname=%s sslmode=disable",
+			c.DbHost, c.DbPort, c.DbUser, c.DbPassword, c.DbName)
+		db, err = sqlx.Connect(c.DbDriverName, psqlInfo)
+	} else {
+		db, err = sqlx.Connect(sql_db.DriverSqlite, ":memory:")
+	}
 	if err != nil {
 		panic(err)
 	}
+	// every connection to :memory: opens its own empty db
+	if db.DriverName() == sql_db.DriverSqlite {
+		db.SetMaxOpenConns(1)
+	}
 	storage := sql_db.NewSqlDB(db)
+	if _, err := storage.MigrateUp(context.Background()); err != nil {
+		panic(err)
+	}
 	return storage, db
 }
 
@@ -1462,7 +1863,7 @@ func (ms *mockStorage) GetPayoutTimesForNFT(ctx context.Context, collectionDenom
 	return args.Get(0).([]types.NFTStatistics), args.Error(1)
 }
 
-func (ms *mockStorage) SaveStatistics(ctx context.Context, payment decimal.Decimal, collectionPaymentAllocationsStatistics []types.CollectionPaymentAllocation, destinationAddressesWithAmount map[string]types.AmountInfo, statistics []types.NFTStatistics, txHash string, farmId int64, farmSubAccountName string) error {
+func (ms *mockStorage) SaveStatistics(ctx context.Context, payment types.Sats, collectionPaymentAllocationsStatistics []types.CollectionPaymentAllocation, destinationAddressesWithAmount map[string]types.AmountInfo, statistics []types.NFTStatistics, txHash string, farmId int64, farmSubAccountName string) error {
 	args := ms.Called(ctx, payment, collectionPaymentAllocationsStatistics, destinationAddressesWithAmount, statistics, txHash, farmId, farmSubAccountName)
 	return args.Error(0)
 }
@@ -1472,6 +1873,11 @@ func (ms *mockStorage) UpdateTransactionsStatus(ctx context.Context, txHashesToM
 	return args.Error(0)
 }
 
+func (ms *mockStorage) CompleteTransactions(ctx context.Context, networkFees []types.NetworkFee) error {
+	args := ms.Called(ctx, networkFees)
+	return args.Error(0)
+}
+
 func (ms *mockStorage) SaveTxHashWithStatus(ctx context.Context, txHash, status, farmSubAccountName string, farmPaymentId int64, retryCount int) error {
 	args := ms.Called(ctx, txHash, status, farmSubAccountName, farmPaymentId, retryCount)
 	return args.Error(0)
@@ -1511,16 +1917,118 @@ func (ms *mockStorage) GetUTXOTransaction(ctx context.Context, txId string) (typ
 	return args.Get(0).(types.UTXOTransaction), args.Error(1)
 }
 
-func (ms *mockStorage) GetCurrentAcummulatedAmountForAddress(ctx context.Context, key string, farmId int64) (decimal.Decimal, error) {
+func (ms *mockStorage) GetCurrentAcummulatedAmountForAddress(ctx context.Context, key string, farmId int64) (types.Sats, error) {
 	args := ms.Called(ctx, key, farmId)
-	return args.Get(0).(decimal.Decimal), args.Error(1)
+	return args.Get(0).(types.Sats), args.Error(1)
 }
 
-func (ms *mockStorage) UpdateThresholdStatus(ctx context.Context, processedTransaction string, paymentTimestamp int64, addressesWithThresholdToUpdate map[string]decimal.Decimal, farmId int64) error {
+func (ms *mockStorage) UpdateThresholdStatus(ctx context.Context, processedTransaction string, paymentTimestamp int64, addressesWithThresholdToUpdate map[string]types.Sats, farmId int64) error {
 	args := ms.Called(ctx, processedTransaction, paymentTimestamp, addressesWithThresholdToUpdate, farmId)
 	return args.Error(0)
 }
 
+func (ms *mockStorage) SavePayoutIntent(ctx context.Context, intent types.PayoutIntent) error {
+	args := ms.Called(ctx, intent)
+	return args.Error(0)
+}
+
+func (ms *mockStorage) MarkPayoutIntentSent(ctx context.Context, idempotencyKey, txHash string) error {
+	args := ms.Called(ctx, idempotencyKey, txHash)
+	return args.Error(0)
+}
+
+// FinalizePayoutIntent goes through the UpdateThresholdStatus and SaveStatistics mocks,
+// since that is what it does in a single db transaction
+func (ms *mockStorage) FinalizePayoutIntent(ctx context.Context, intent types.PayoutIntent, txHash string) error {
+	payload := intent.Payload
+	if err := ms.UpdateThresholdStatus(ctx, intent.UTXOTxHash, payload.PaymentTimestamp, payload.AddressesWithThresholdToUpdateBtc, intent.FarmId); err != nil {
+		return err
+	}
+
+	return ms.SaveStatistics(ctx, payload.ReceivedRewardBtc, payload.CollectionPaymentAllocations, payload.AddressesWithAmountInfo,
+		payload.NftStatistics, txHash, intent.FarmId, payload.FarmSubAccountName)
+}
+
+func (ms *mockStorage) RollbackPayoutIntent(ctx context.Context, idempotencyKey string) error {
+	args := ms.Called(ctx, idempotencyKey)
+	return args.Error(0)
+}
+
+func (ms *mockStorage) GetUnfinishedPayoutIntents(ctx context.Context, farmId int64) ([]types.PayoutIntent, error) {
+	args := ms.Called(ctx, farmId)
+	return args.Get(0).([]types.PayoutIntent), args.Error(1)
+}
+
+func (ms *mockStorage) GetPausedFarmIds(ctx context.Context) ([]int64, error) {
+	args := ms.Called(ctx)
+	return args.Get(0).([]int64), args.Error(1)
+}
+
+func (ms *mockStorage) GetNFTStatisticsByOwner(ctx context.Context, owner string, from, to int64) ([]types.NFTStatistics, error) {
+	args := ms.Called(ctx, owner, from, to)
+	return args.Get(0).([]types.NFTStatistics), args.Error(1)
+}
+
+func (ms *mockStorage) GetThresholdAmountsByAddress(ctx context.Context, address string) ([]types.AddressThresholdAmountByFarm, error) {
+	args := ms.Called(ctx, address)
+	return args.Get(0).([]types.AddressThresholdAmountByFarm), args.Error(1)
+}
+
+func (ms *mockStorage) GetPaidDestinationsByAddress(ctx context.Context, address string, from, to time.Time) ([]types.AddressPayout, error) {
+	args := ms.Called(ctx, address, from, to)
+	return args.Get(0).([]types.AddressPayout), args.Error(1)
+}
+
+func (ms *mockStorage) GetFarmSchedules(ctx context.Context) ([]types.FarmSchedule, error) {
+	args := ms.Called(ctx)
+	return args.Get(0).([]types.FarmSchedule), args.Error(1)
+}
+
+func (ms *mockStorage) SaveFarmLastRun(ctx context.Context, farmId int64, lastRunAt time.Time) error {
+	args := ms.Called(ctx, farmId, lastRunAt)
+	return args.Error(0)
+}
+
+func (ms *mockStorage) SaveBtcPrice(ctx context.Context, price types.BtcPrice) error {
+	args := ms.Called(ctx, price)
+	return args.Error(0)
+}
+
+func (ms *mockStorage) GetFarmPayoutThreshold(ctx context.Context, farmId int64) (types.FarmPayoutThreshold, error) {
+	args := ms.Called(ctx, farmId)
+	return args.Get(0).(types.FarmPayoutThreshold), args.Error(1)
+}
+
+func (ms *mockStorage) GetAddressPayoutThreshold(ctx context.Context, address string) (types.AddressPayoutThreshold, error) {
+	args := ms.Called(ctx, address)
+	return args.Get(0).(types.AddressPayoutThreshold), args.Error(1)
+}
+
+func (ms *mockStorage) GetAccruingAmountsByFarm(ctx context.Context, farmId int64) ([]types.AddressThresholdAmountByFarm, error) {
+	args := ms.Called(ctx, farmId)
+	return args.Get(0).([]types.AddressThresholdAmountByFarm), args.Error(1)
+}
+
+func (ms *mockStorage) GetCudosAddressAccruals(ctx context.Context) ([]types.AddressThresholdAmountByFarm, error) {
+	args := ms.Called(ctx)
+	return args.Get(0).([]types.AddressThresholdAmountByFarm), args.Error(1)
+}
+
+func (ms *mockStorage) MoveAccumulatedAmount(ctx context.Context, farmId int64, fromAddress, toAddress string) (types.Sats, error) {
+	args := ms.Called(ctx, farmId, fromAddress, toAddress)
+	return args.Get(0).(types.Sats), args.Error(1)
+}
+
+func (ms *mockStorage) GetFarmPaymentUTXOTxHash(ctx context.Context, farmPaymentId int64) (string, error) {
+	args := ms.Called(ctx, farmPaymentId)
+	return args.String(0), args.Error(1)
+}
+
+func (ms *mockStorage) GetBtcPrice(ctx context.Context, event, reference, currency string) (types.BtcPrice, error) {
+	args := ms.Called(ctx, event, reference, currency)
+	return args.Get(0).(types.BtcPrice), args.Error(1)
+}
+
 func (ms *mockStorage) SetInitialAccumulatedAmountForAddress(ctx context.Context, address string, farmId int64, amount int) error {
 	args := ms.Called(ctx, address, farmId, amount)
 	return args.Error(0)
@@ -1538,15 +2046,90 @@ func (_ *mockHelper) Date() (year int, month time.Month, day int) {
 	return 2022, time.October, 24
 }
 
-func (_ *mockHelper) SendMail(message string) error {
-	return nil
+type mockHelper struct {
 }
 
-type mockHelper struct {
+type mockAlerter struct {
+	mutex    sync.Mutex
+	fired    map[string][]notifier.Notification
+	resolved []string
+}
+
+func (ma *mockAlerter) Fire(ctx context.Context, source string, notification notifier.Notification) {
+	ma.mutex.Lock()
+	defer ma.mutex.Unlock()
+
+	if ma.fired == nil {
+		ma.fired = make(map[string][]notifier.Notification)
+	}
+	ma.fired[source] = append(ma.fired[source], notification)
+}
+
+func (ma *mockAlerter) Resolve(ctx context.Context, source string) {
+	ma.mutex.Lock()
+	defer ma.mutex.Unlock()
+
+	ma.resolved = append(ma.resolved, source)
+}
+
+type mockSecretProvider struct {
+	err error
+}
+
+func (msp *mockSecretProvider) WalletPassphrase(walletName string) (*secrets.Secret, error) {
+	if msp.err != nil {
+		return nil, msp.err
+	}
+	return secrets.NewSecret([]byte("passphrase-" + walletName)), nil
+}
+
+type mockPriceSource struct {
+	prices map[string]decimal.Decimal
+	err    error
+}
+
+func (mps *mockPriceSource) Name() string {
+	return "mock"
+}
+
+func (mps *mockPriceSource) BtcPrices(ctx context.Context, currencies []string) (map[string]decimal.Decimal, error) {
+	return mps.prices, mps.err
+}
+
+func TestRecordBtcPrices(t *testing.T) {
+	config := &infrastructure.Config{PriceFiatCurrencies: []string{"usd", "eur"}}
+	priceSource := &mockPriceSource{prices: map[string]decimal.Decimal{"usd": decimal.NewFromInt(30000), "eur": decimal.NewFromInt(27000)}}
+
+	storage := &mockStorage{}
+	storage.On("SaveBtcPrice", mock.Anything, mock.Anything).Return(nil)
+
+	s := NewPayService(config, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, priceSource)
+	s.wallets.recordBtcPrices(context.Background(), storage, types.BtcPriceEventSendMany, "tx_hash", 1)
+
+	storage.AssertNumberOfCalls(t, "SaveBtcPrice", 2)
+	storage.AssertCalled(t, "SaveBtcPrice", mock.Anything, types.BtcPrice{
+		Event:      types.BtcPriceEventSendMany,
+		Reference:  "tx_hash",
+		FarmId:     1,
+		Currency:   "eur",
+		Price:      decimal.NewFromInt(27000),
+		Source:     "mock",
+		CapturedAt: time.Unix(1666641078, 0).UTC(),
+	})
+
+	// a price that can't be captured does not fail the payment
+	priceSource.err = errors.New("price api is down")
+	storage = &mockStorage{}
+	s.wallets.recordBtcPrices(context.Background(), storage, types.BtcPriceEventSendMany, "tx_hash", 1)
+	storage.AssertNotCalled(t, "SaveBtcPrice", mock.Anything, mock.Anything)
 }
 
 func skipDBTests(t *testing.T) {
-	if os.Getenv("EXECUTE_DB_TEST") == "" || os.Getenv("EXECUTE_DB_TEST") == "false" {
+	if !executeDBTests() {
 		t.Skip("Skipping DB Tests in this env")
 	}
 }
+
+func executeDBTests() bool {
+	return os.Getenv("EXECUTE_DB_TEST") != "" && os.Getenv("EXECUTE_DB_TEST") != "false"
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	walletTransactionsPageSize = 100
+	// how much older than the intent a wallet transaction can be, so clock differences between the db and the node are covered
+	walletTransactionsSearchMargin = time.Hour
+)
+
+func newPayoutIntent(farm types.Farm, unspentTxForFarm types.UnspentTx, payload types.PayoutIntentPayload) types.PayoutIntent {
+	return types.PayoutIntent{
+		IdempotencyKey: fmt.Sprintf("aura-pay-%d-%s-%d", farm.Id, unspentTxForFarm.TxID, time.Now().UnixNano()),
+		FarmId:         farm.Id,
+		UTXOTxHash:     unspentTxForFarm.TxID,
+		Payload:        payload,
+		Status:         types.PayoutIntentPending,
+		CreatedAt:      time.Now().UTC(),
+	}
+}
+
+// newAccumulatedPayoutIntent is the intent of a payout of accumulated amounts, e.g. a sweep.
+// It has no UTXO, the idempotency key is used in its place, so the intent is unique like the ones of the UTXOs.
+func newAccumulatedPayoutIntent(farm types.Farm, kind string, payload types.PayoutIntentPayload) types.PayoutIntent {
+	idempotencyKey := fmt.Sprintf("aura-pay-%s-%d-%d", kind, farm.Id, time.Now().UnixNano())
+	return types.PayoutIntent{
+		IdempotencyKey: idempotencyKey,
+		FarmId:         farm.Id,
+		UTXOTxHash:     idempotencyKey,
+		Payload:        payload,
+		Status:         types.PayoutIntentPending,
+		CreatedAt:      time.Now().UTC(),
+	}
+}
+
+/*
+payAccumulatedAmounts sends the accumulated amounts of the payload from the farm wallet, which has to be opened already.
+
+ 1. Lock the unprocessed UTXOs of the farm in the wallet until the amounts are sent, so they are not spent on the payout
+    and are left to the pay service, which also updates the amounts accumulated with them.
+ 2. Check that the wallet holds the amounts without the unprocessed UTXOs.
+ 3. Unlock the wallet, save the payout intent, send the amounts and finish the bookkeeping like a normal payout.
+    The statistics get a farm payment without received reward, whose addresses are all paid with the transaction.
+    In dry run nothing is sent.
+
+Returns the hash of the transaction, empty in dry run.
+*/
+func (w *farmWallets) payAccumulatedAmounts(ctx context.Context, walletClient BtcClient, storage Storage, farm types.Farm, kind string, payload types.PayoutIntentPayload) (string, error) {
+	var totalSats types.Sats
+	for _, amount := range payload.AddressesToSendBtc {
+		totalSats += amount
+	}
+
+	unspentTxsForFarm, err := w.getUnspentTxsForFarm(ctx, walletClient, storage, []string{farm.AddressForReceivingRewardsFromPool})
+	if err != nil {
+		return "", err
+	}
+
+	var reservedSats types.Sats
+	for _, unspentTx := range unspentTxsForFarm {
+		reservedSats += unspentTx.Amount
+	}
+
+	if len(unspentTxsForFarm) > 0 && !w.dryRun {
+		log.Debug().Msgf("Locking %d unprocessed UTXOs of farm {%s} for the %s payout...", len(unspentTxsForFarm), farm.RewardsFromPoolBtcWalletName, kind)
+		if err := lockUnspent(walletClient, false, unspentTxsForFarm); err != nil {
+			return "", fmt.Errorf("failed to lock the unprocessed UTXOs of farm {%s}: %s", farm.RewardsFromPoolBtcWalletName, err)
+		}
+		defer unlockUnspent(walletClient, farm.RewardsFromPoolBtcWalletName, unspentTxsForFarm)
+	}
+
+	walletBalance, err := walletClient.GetBalance("*")
+	if err != nil {
+		return "", err
+	}
+
+	if totalSats+reservedSats > types.Sats(walletBalance) {
+		return "", fmt.Errorf("total amount of the %s payout {%s} is more than wallet balance {%s} without the unprocessed UTXOs {%s}", kind, totalSats, walletBalance, reservedSats)
+	}
+
+	intent := newAccumulatedPayoutIntent(farm, kind, payload)
+
+	txHash := ""
+	if w.dryRun {
+		log.Debug().Msgf("Dry run, skipping send of the %s payout for farm {%s}", kind, farm.RewardsFromPoolBtcWalletName)
+	} else {
+		if err := unlockWallet(w.secretProvider, walletClient, farm.RewardsFromPoolBtcWalletName); err != nil {
+			return "", err
+		}
+		defer lockWallet(walletClient, farm.RewardsFromPoolBtcWalletName)
+
+		log.Debug().Msgf("Saving %s payout intent {%s}...", kind, intent.IdempotencyKey)
+		if err := storage.SavePayoutIntent(ctx, intent); err != nil {
+			return "", err
+		}
+
+		// if this fails the intent stays pending and the recovery checks the wallet if anything was sent
+		if txHash, err = w.apiRequester.SendMany(ctx, farm.RewardsFromPoolBtcWalletName, payload.AddressesToSendBtc, intent.IdempotencyKey); err != nil {
+			return "", err
+		}
+		w.recordBtcPrices(ctx, storage, types.BtcPriceEventSendMany, txHash, farm.Id)
+
+		if err := storage.MarkPayoutIntentSent(ctx, intent.IdempotencyKey, txHash); err != nil {
+			log.Error().Msgf("Failed to mark %s payout intent {%s} as sent with tx hash {%s}: %s", kind, intent.IdempotencyKey, txHash, err)
+			return "", err
+		}
+	}
+
+	if err := storage.FinalizePayoutIntent(ctx, intent, txHash); err != nil {
+		log.Error().Msgf("Failed to finalize %s payout intent {%s} for tx hash {%s}: %s", kind, intent.IdempotencyKey, txHash, err)
+		return "", err
+	}
+
+	return txHash, nil
+}
+
+/*
+recoverPayoutIntents finishes the bookkeeping of the payouts of a farm that were interrupted after the intent was saved.
+It has to be called after the farm wallet is loaded and before the unspent transactions of the farm are processed,
+so a UTXO that was already paid is never paid again.
+
+ 1. Get all intents of the farm that are neither completed, nor rolled back.
+ 2. If the intent has nothing to send, the bookkeeping is finished right away.
+ 3. If the intent is marked as sent, the tx hash is known, so the bookkeeping is finished with it.
+ 4. Otherwise search the wallet transactions for the idempotency key of the intent, which is sent as the transaction comment.
+    If such transaction is found - mark the intent as sent and finish the bookkeeping with its tx hash.
+    If not - nothing was sent, so the intent is rolled back and the UTXO will be processed again.
+*/
+func (w *farmWallets) recoverPayoutIntents(ctx context.Context, storage Storage, farm types.Farm) error {
+	intents, err := storage.GetUnfinishedPayoutIntents(ctx, farm.Id)
+	if err != nil {
+		return err
+	}
+
+	for _, intent := range intents {
+		log.Info().Msgf("Recovering payout intent {%s} for utxo {%s} of farm {%s}", intent.IdempotencyKey, intent.UTXOTxHash, farm.RewardsFromPoolBtcWalletName)
+
+		if len(intent.Payload.AddressesToSendBtc) == 0 {
+			if err := storage.FinalizePayoutIntent(ctx, intent, ""); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if intent.Status == types.PayoutIntentSent {
+			if err := storage.FinalizePayoutIntent(ctx, intent, intent.TxHash); err != nil {
+				return err
+			}
+			continue
+		}
+
+		walletTransaction, err := w.findWalletTransactionByComment(ctx, farm.RewardsFromPoolBtcWalletName, intent.IdempotencyKey, intent.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		if walletTransaction == nil {
+			log.Info().Msgf("No transaction found for payout intent {%s}, rolling it back", intent.IdempotencyKey)
+			if err := storage.RollbackPayoutIntent(ctx, intent.IdempotencyKey); err != nil {
+				return err
+			}
+			continue
+		}
+
+		log.Info().Msgf("Transaction {%s} found for payout intent {%s}, finishing it", walletTransaction.Txid, intent.IdempotencyKey)
+		if err := storage.MarkPayoutIntentSent(ctx, intent.IdempotencyKey, walletTransaction.Txid); err != nil {
+			return err
+		}
+
+		if err := storage.FinalizePayoutIntent(ctx, intent, walletTransaction.Txid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findWalletTransactionByComment pages through the transactions of the wallet from the newest to the oldest
+// until a transaction with the given comment is found or the transactions get older than the given time.
+// Returns nil if no such transaction exists.
+func (w *farmWallets) findWalletTransactionByComment(ctx context.Context, walletName, comment string, notOlderThan time.Time) (*types.BtcWalletTransaction, error) {
+	oldestTime := notOlderThan.Add(-walletTransactionsSearchMargin).Unix()
+
+	for skip := 0; ; skip += walletTransactionsPageSize {
+		walletTransactions, err := w.apiRequester.ListWalletTransactions(ctx, walletName, walletTransactionsPageSize, skip)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(walletTransactions) == 0 {
+			return nil, nil
+		}
+
+		olderFound := false
+		for i := range walletTransactions {
+			if walletTransactions[i].Comment == comment && walletTransactions[i].Txid != "" {
+				return &walletTransactions[i], nil
+			}
+
+			if int64(walletTransactions[i].Time) < oldestTime {
+				olderFound = true
+			}
+		}
+
+		if olderFound || len(walletTransactions) < walletTransactionsPageSize {
+			return nil, nil
+		}
+	}
+}
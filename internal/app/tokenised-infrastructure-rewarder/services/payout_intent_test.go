@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecoverPayoutIntents(t *testing.T) {
+	farm := types.Farm{Id: 1, RewardsFromPoolBtcWalletName: "farm_1"}
+	payload := types.PayoutIntentPayload{
+		FarmSubAccountName:                "farm_1",
+		PaymentTimestamp:                  1666641078,
+		ReceivedRewardBtc:                 625000000,
+		AddressesToSendBtc:                map[string]types.Sats{"leftover_reward_payout_address_1": 625000000},
+		AddressesWithAmountInfo:           map[string]types.AmountInfo{"leftover_reward_payout_address_1": {Amount: 625000000, ThresholdReached: true}},
+		AddressesWithThresholdToUpdateBtc: map[string]types.Sats{"leftover_reward_payout_address_1": 0},
+	}
+
+	tests := []struct {
+		name               string
+		intent             types.PayoutIntent
+		walletTransactions []types.BtcWalletTransaction
+		expectedTxHash     string
+		expectFinalized    bool
+		expectMarkedSent   bool
+	}{
+		{
+			name:            "sent intent is finalized with its tx hash",
+			intent:          types.PayoutIntent{IdempotencyKey: "key_1", FarmId: 1, UTXOTxHash: "utxo_1", Payload: payload, Status: types.PayoutIntentSent, TxHash: "tx_hash_1"},
+			expectedTxHash:  "tx_hash_1",
+			expectFinalized: true,
+		},
+		{
+			name:   "pending intent found in wallet is finalized",
+			intent: types.PayoutIntent{IdempotencyKey: "key_2", FarmId: 1, UTXOTxHash: "utxo_2", Payload: payload, Status: types.PayoutIntentPending, CreatedAt: time.Unix(1666641078, 0)},
+			walletTransactions: []types.BtcWalletTransaction{
+				{Txid: "other_tx_hash", Comment: "other_key", Time: 1666641078},
+				{Txid: "tx_hash_2", Comment: "key_2", Time: 1666641079},
+			},
+			expectedTxHash:   "tx_hash_2",
+			expectFinalized:  true,
+			expectMarkedSent: true,
+		},
+		{
+			name:   "pending intent not found in wallet is rolled back",
+			intent: types.PayoutIntent{IdempotencyKey: "key_3", FarmId: 1, UTXOTxHash: "utxo_3", Payload: payload, Status: types.PayoutIntentPending, CreatedAt: time.Unix(1666641078, 0)},
+			walletTransactions: []types.BtcWalletTransaction{
+				{Txid: "other_tx_hash", Comment: "other_key", Time: 1666641078},
+			},
+			expectFinalized: false,
+		},
+		{
+			name:            "pending intent without anything to send is finalized",
+			intent:          types.PayoutIntent{IdempotencyKey: "key_4", FarmId: 1, UTXOTxHash: "utxo_4", Payload: types.PayoutIntentPayload{PaymentTimestamp: 1666641078}, Status: types.PayoutIntentPending},
+			expectedTxHash:  "",
+			expectFinalized: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			storage := new(mockStorage)
+			apiRequester := new(mockAPIRequester)
+
+			storage.On("GetUnfinishedPayoutIntents", mock.Anything, int64(1)).Return([]types.PayoutIntent{test.intent}, nil).Once()
+			storage.On("UpdateThresholdStatus", mock.Anything, test.intent.UTXOTxHash, int64(1666641078), mock.Anything, int64(1)).Return(nil).Maybe()
+			storage.On("SaveStatistics", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, test.expectedTxHash, int64(1), mock.Anything).Return(nil).Maybe()
+			storage.On("MarkPayoutIntentSent", mock.Anything, test.intent.IdempotencyKey, test.expectedTxHash).Return(nil).Maybe()
+			storage.On("RollbackPayoutIntent", mock.Anything, test.intent.IdempotencyKey).Return(nil).Maybe()
+			apiRequester.On("ListWalletTransactions", mock.Anything, mock.Anything, walletTransactionsPageSize, 0).Return(test.walletTransactions, nil).Maybe()
+
+			s := NewPayService(&infrastructure.Config{}, apiRequester, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
+			require.NoError(t, s.wallets.recoverPayoutIntents(context.Background(), storage, farm))
+
+			if test.expectFinalized {
+				storage.AssertCalled(t, "SaveStatistics", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, test.expectedTxHash, int64(1), mock.Anything)
+				storage.AssertNotCalled(t, "RollbackPayoutIntent", mock.Anything, mock.Anything)
+			} else {
+				storage.AssertCalled(t, "RollbackPayoutIntent", mock.Anything, test.intent.IdempotencyKey)
+				storage.AssertNotCalled(t, "UpdateThresholdStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+
+			if test.expectMarkedSent {
+				storage.AssertCalled(t, "MarkPayoutIntentSent", mock.Anything, test.intent.IdempotencyKey, test.expectedTxHash)
+			} else {
+				storage.AssertNotCalled(t, "MarkPayoutIntentSent", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestFindWalletTransactionByComment_StopsAtOlderTransactions(t *testing.T) {
+	apiRequester := new(mockAPIRequester)
+
+	page := make([]types.BtcWalletTransaction, walletTransactionsPageSize)
+	for i := range page {
+		page[i] = types.BtcWalletTransaction{Txid: "tx_hash", Comment: "other_key", Time: 1000}
+	}
+	apiRequester.On("ListWalletTransactions", mock.Anything, "farm_1", walletTransactionsPageSize, 0).Return(page, nil).Once()
+
+	s := NewPayService(&infrastructure.Config{}, apiRequester, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
+	walletTransaction, err := s.wallets.findWalletTransactionByComment(context.Background(), "farm_1", "key", time.Unix(1666641078, 0))
+	require.NoError(t, err)
+	require.Nil(t, walletTransaction)
+	apiRequester.AssertNumberOfCalls(t, "ListWalletTransactions", 1)
+}
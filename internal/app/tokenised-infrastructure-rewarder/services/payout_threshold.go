@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+)
+
+// payoutThresholds resolves the payout thresholds of the addresses paid by a farm
+type payoutThresholds struct {
+	storage       Storage
+	farm          types.Farm
+	global        types.Sats
+	minimum       types.Sats
+	farmThreshold types.FarmPayoutThreshold
+}
+
+// getPayoutThresholds reads the payout threshold override of the farm, the thresholds of the addresses are read when they are resolved
+func (s *PayService) getPayoutThresholds(ctx context.Context, storage Storage, farm types.Farm) (*payoutThresholds, error) {
+	farmThreshold, err := storage.GetFarmPayoutThreshold(ctx, farm.Id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get payout threshold of farm {%d}: %s", farm.Id, err)
+	}
+
+	return &payoutThresholds{
+		storage:       storage,
+		farm:          farm,
+		global:        s.config.GlobalPayoutThresholdInBTC,
+		minimum:       s.config.MinAddressPayoutThresholdInBTC,
+		farmThreshold: farmThreshold,
+	}, nil
+}
+
+/*
+resolve returns the payout threshold of the amount accumulated for the address, which is paid to the payout address.
+For an nft owner the address is their cudos address and the payout address the btc address they mapped, otherwise both are the same.
+
+ 1. The maintenance fee and leftover addresses of the farm are paid on every payment if the farm skips the threshold for them.
+ 2. The threshold picked for the payout address, or else for the address, but not lower than MIN_ADDRESS_PAYOUT_THRESHOLD_IN_BTC.
+ 3. The threshold of the farm.
+ 4. GLOBAL_PAYOUT_THRESHOLD_IN_BTC.
+*/
+func (t *payoutThresholds) resolve(ctx context.Context, address, payoutAddress string) (types.Sats, error) {
+	if t.farmThreshold.SkipThresholdForFarmAddresses && (payoutAddress == t.farm.MaintenanceFeePayoutAddress || payoutAddress == t.farm.LeftoverRewardPayoutAddress) {
+		return 0, nil
+	}
+
+	for _, preferenceAddress := range []string{payoutAddress, address} {
+		addressThreshold, err := t.storage.GetAddressPayoutThreshold(ctx, preferenceAddress)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to get payout threshold of address {%s}: %s", preferenceAddress, err)
+		}
+
+		if addressThreshold.ThresholdBtc < t.minimum {
+			return t.minimum, nil
+		}
+		return addressThreshold.ThresholdBtc, nil
+	}
+
+	if t.farmThreshold.ThresholdBtc != nil {
+		return *t.farmThreshold.ThresholdBtc, nil
+	}
+
+	return t.global, nil
+}
+
+// ValidateAddressPayoutThreshold checks that the threshold an owner picks for their address is not below the minimum
+func ValidateAddressPayoutThreshold(config *infrastructure.Config, threshold types.Sats) error {
+	if minimum := config.MinAddressPayoutThresholdInBTC; threshold < minimum {
+		return fmt.Errorf("payout threshold {%s} is below the minimum of {%s} BTC", threshold, minimum)
+	}
+	return nil
+}
+
+// ValidateFarmPayoutThreshold checks the payout threshold override of a farm
+func ValidateFarmPayoutThreshold(threshold types.FarmPayoutThreshold) error {
+	if threshold.ThresholdBtc != nil && *threshold.ThresholdBtc < 0 {
+		return fmt.Errorf("payout threshold {%s} of farm {%d} must not be negative", threshold.ThresholdBtc, threshold.FarmId)
+	}
+	return nil
+}
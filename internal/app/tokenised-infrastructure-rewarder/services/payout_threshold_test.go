@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayoutThresholds_Resolve(t *testing.T) {
+	ctx := context.Background()
+	config := &infrastructure.Config{GlobalPayoutThresholdInBTC: 10000000, MinAddressPayoutThresholdInBTC: 1000000}
+	farm := types.Farm{Id: 1, MaintenanceFeePayoutAddress: "maintenance_address", LeftoverRewardPayoutAddress: "leftover_address"}
+	farmThreshold := types.Sats(5000000)
+
+	storage := &mockStorage{}
+	storage.On("GetFarmPayoutThreshold", mock.Anything, int64(1)).Return(types.FarmPayoutThreshold{FarmId: 1, ThresholdBtc: &farmThreshold, SkipThresholdForFarmAddresses: true}, nil)
+	storage.On("GetFarmPayoutThreshold", mock.Anything, int64(2)).Return(types.FarmPayoutThreshold{}, sql.ErrNoRows)
+	storage.On("GetAddressPayoutThreshold", mock.Anything, "whale_btc_address").Return(types.AddressPayoutThreshold{ThresholdBtc: 100000000}, nil)
+	storage.On("GetAddressPayoutThreshold", mock.Anything, "dust_btc_address").Return(types.AddressPayoutThreshold{ThresholdBtc: 1000}, nil)
+	storage.On("GetAddressPayoutThreshold", mock.Anything, "cudos1whale").Return(types.AddressPayoutThreshold{ThresholdBtc: 50000000}, nil)
+	storage.On("GetAddressPayoutThreshold", mock.Anything, mock.Anything).Return(types.AddressPayoutThreshold{}, sql.ErrNoRows)
+
+	s := NewPayService(config, &mockAPIRequester{}, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
+	thresholds, err := s.getPayoutThresholds(ctx, storage, farm)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		address, payoutAddress string
+		expected               types.Sats
+	}{
+		{"maintenance_address", "maintenance_address", 0},
+		{"leftover_address", "leftover_address", 0},
+		{"cudos1owner", "whale_btc_address", 100000000},
+		{"cudos1whale", "cudos1whale", 50000000},
+		{"cudos1owner", "dust_btc_address", 1000000},
+		{"cudos1owner", "btc_address", 5000000},
+	} {
+		threshold, err := thresholds.resolve(ctx, tc.address, tc.payoutAddress)
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, threshold, tc.payoutAddress)
+	}
+
+	thresholds, err = s.getPayoutThresholds(ctx, storage, types.Farm{Id: 2, MaintenanceFeePayoutAddress: "maintenance_address"})
+	require.NoError(t, err)
+	threshold, err := thresholds.resolve(ctx, "maintenance_address", "maintenance_address")
+	require.NoError(t, err)
+	require.Equal(t, types.Sats(10000000), threshold)
+}
+
+func TestValidateAddressPayoutThreshold(t *testing.T) {
+	config := &infrastructure.Config{MinAddressPayoutThresholdInBTC: 1000000}
+	require.NoError(t, ValidateAddressPayoutThreshold(config, 1000000))
+	require.EqualError(t, ValidateAddressPayoutThreshold(config, 999999), "payout threshold {0.00999999} is below the minimum of {0.01} BTC")
+}
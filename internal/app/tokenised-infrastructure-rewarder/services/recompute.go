@@ -0,0 +1,99 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+)
+
+// FarmPaymentRecomputation is the result of recomputing the totals of a farm payment from its saved statistics.
+type FarmPaymentRecomputation struct {
+	FarmPaymentId           string     `json:"farm_payment_id"`
+	FarmId                  int64      `json:"farm_id"`
+	ReceivedRewardBtc       types.Sats `json:"received_reward_btc"`
+	CollectionAllocationBtc types.Sats `json:"collection_allocation_btc"`
+	CUDOGeneralFeeBtc       types.Sats `json:"cudo_general_fee_btc"`
+	NftRewardsBtc           types.Sats `json:"nft_rewards_btc"`
+	FarmMaintenanceFeeBtc   types.Sats `json:"farm_maintenance_fee_btc"`
+	CUDOMaintenanceFeeBtc   types.Sats `json:"cudo_maintenance_fee_btc"`
+	FarmUnsoldLeftoverBtc   types.Sats `json:"farm_unsold_leftover_btc"`
+	Mismatches              []string   `json:"mismatches"`
+}
+
+/*
+RecomputeFarmPayment recomputes the totals of a farm payment from the saved statistics and checks that they are consistent.
+
+ 1. The rewards of the owners of each NFT have to add up to the reward of the NFT.
+ 2. The rewards and the maintenance fees of the NFTs of a collection have to add up to the fees saved for the collection,
+    and its unsold leftover has to be what is left of the collection allocation after them.
+ 3. The allocations of all collections together with the CUDO general fee can not be more than the reward received for the farm.
+*/
+func RecomputeFarmPayment(farmPayment types.FarmPayment, allocations []types.CollectionPaymentAllocation, collections []types.AuraPoolCollection, statistics []types.NFTStatistics) FarmPaymentRecomputation {
+	recomputation := FarmPaymentRecomputation{
+		FarmPaymentId:     farmPayment.Id,
+		FarmId:            farmPayment.FarmId,
+		ReceivedRewardBtc: farmPayment.AmountBTC,
+		Mismatches:        []string{},
+	}
+
+	denomIdByCollectionId := make(map[int64]string)
+	for _, collection := range collections {
+		denomIdByCollectionId[collection.Id] = collection.DenomId
+	}
+
+	nftRewards := make(map[string]types.Sats)
+	farmMaintenanceFees := make(map[string]types.Sats)
+	cudoMaintenanceFees := make(map[string]types.Sats)
+	for _, nftStatistics := range statistics {
+		var ownersReward types.Sats
+		for _, owner := range nftStatistics.NFTOwnersForPeriod {
+			ownersReward += owner.Reward
+		}
+
+		if ownersReward != nftStatistics.Reward {
+			recomputation.Mismatches = append(recomputation.Mismatches, fmt.Sprintf("rewards of the owners of nft {%s/%s} are %s, nft reward is %s",
+				nftStatistics.DenomId, nftStatistics.TokenId, ownersReward, nftStatistics.Reward))
+		}
+
+		nftRewards[nftStatistics.DenomId] += nftStatistics.Reward
+		farmMaintenanceFees[nftStatistics.DenomId] += nftStatistics.MaintenanceFee
+		cudoMaintenanceFees[nftStatistics.DenomId] += nftStatistics.CUDOPartOfMaintenanceFee
+		recomputation.NftRewardsBtc += nftStatistics.Reward
+	}
+
+	for _, allocation := range allocations {
+		denomId, ok := denomIdByCollectionId[allocation.CollectionId]
+		if !ok {
+			recomputation.Mismatches = append(recomputation.Mismatches, fmt.Sprintf("collection {%d} is not a collection of farm {%d}", allocation.CollectionId, farmPayment.FarmId))
+		}
+
+		if farmMaintenanceFees[denomId] != allocation.FarmMaintenanceFee {
+			recomputation.Mismatches = append(recomputation.Mismatches, fmt.Sprintf("farm maintenance fee of collection {%d} is %s, nfts have %s",
+				allocation.CollectionId, allocation.FarmMaintenanceFee, farmMaintenanceFees[denomId]))
+		}
+
+		if cudoMaintenanceFees[denomId] != allocation.CUDOMaintenanceFee {
+			recomputation.Mismatches = append(recomputation.Mismatches, fmt.Sprintf("cudo maintenance fee of collection {%d} is %s, nfts have %s",
+				allocation.CollectionId, allocation.CUDOMaintenanceFee, cudoMaintenanceFees[denomId]))
+		}
+
+		leftover := allocation.CollectionAllocationAmount - nftRewards[denomId] - allocation.CUDOMaintenanceFee - allocation.FarmMaintenanceFee
+		if leftover != allocation.FarmUnsoldLeftovers {
+			recomputation.Mismatches = append(recomputation.Mismatches, fmt.Sprintf("unsold leftover of collection {%d} is %s, recomputed %s",
+				allocation.CollectionId, allocation.FarmUnsoldLeftovers, leftover))
+		}
+
+		recomputation.CollectionAllocationBtc += allocation.CollectionAllocationAmount
+		recomputation.CUDOGeneralFeeBtc += allocation.CUDOGeneralFee
+		recomputation.FarmMaintenanceFeeBtc += allocation.FarmMaintenanceFee
+		recomputation.CUDOMaintenanceFeeBtc += allocation.CUDOMaintenanceFee
+		recomputation.FarmUnsoldLeftoverBtc += allocation.FarmUnsoldLeftovers
+	}
+
+	allocated := recomputation.CollectionAllocationBtc + recomputation.CUDOGeneralFeeBtc
+	if allocated > farmPayment.AmountBTC {
+		recomputation.Mismatches = append(recomputation.Mismatches, fmt.Sprintf("collections are allocated %s, farm received %s", allocated, farmPayment.AmountBTC))
+	}
+
+	return recomputation
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecomputeFarmPayment(t *testing.T) {
+	farmPayment := types.FarmPayment{Id: "1", FarmId: 1, AmountBTC: 100000000}
+	collections := []types.AuraPoolCollection{{Id: 1, DenomId: "denom_1"}}
+	statistics := []types.NFTStatistics{
+		{
+			DenomId:                  "denom_1",
+			TokenId:                  "1",
+			Reward:                   50000000,
+			MaintenanceFee:           5000000,
+			CUDOPartOfMaintenanceFee: 5000000,
+			NFTOwnersForPeriod: []types.NFTOwnerInformation{
+				{Owner: "owner_1", Reward: 20000000},
+				{Owner: "owner_2", Reward: 30000000},
+			},
+		},
+	}
+	allocations := []types.CollectionPaymentAllocation{
+		{
+			CollectionId:               1,
+			CollectionAllocationAmount: 80000000,
+			CUDOGeneralFee:             20000000,
+			CUDOMaintenanceFee:         5000000,
+			FarmMaintenanceFee:         5000000,
+			FarmUnsoldLeftovers:        20000000,
+		},
+	}
+
+	recomputation := RecomputeFarmPayment(farmPayment, allocations, collections, statistics)
+	require.Empty(t, recomputation.Mismatches)
+	require.Equal(t, types.Sats(50000000), recomputation.NftRewardsBtc)
+	require.Equal(t, types.Sats(20000000), recomputation.FarmUnsoldLeftoverBtc)
+
+	statistics[0].NFTOwnersForPeriod[1].Reward = 31000000
+	allocations[0].FarmUnsoldLeftovers = 25000000
+	allocations[0].CollectionAllocationAmount = 90000000
+
+	recomputation = RecomputeFarmPayment(farmPayment, allocations, collections, statistics)
+	require.Len(t, recomputation.Mismatches, 3)
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/rs/zerolog/log"
+)
+
+// ReconcileAccrualsService moves the amounts accumulated for cudos addresses onto the btc addresses their owners mapped later.
+// The pay service merges the two only while the owner is paid, so an owner who no longer holds nfts would never get the amount.
+// It runs every ACCRUAL_RECONCILE_INTERVAL.
+type ReconcileAccrualsService struct {
+	config       *infrastructure.Config
+	apiRequester ApiRequester
+}
+
+func NewReconcileAccrualsService(config *infrastructure.Config, apiRequester ApiRequester) *ReconcileAccrualsService {
+	return &ReconcileAccrualsService{
+		config:       config,
+		apiRequester: apiRequester,
+	}
+}
+
+func (s *ReconcileAccrualsService) Dependencies() []string {
+	return []string{metrics.EndpointBitcoind, metrics.EndpointDb, metrics.EndpointCudosRest}
+}
+
+/*
+Execute reconciles the amounts of all farms:
+
+ 1. Collect the amounts accumulated for cudos addresses.
+ 2. Look up the btc address mapped to each cudos address. The amounts of the cudos addresses without one are left as they are.
+ 3. Move the amounts of each farm onto the mapped btc addresses. The wallet of an approved farm is opened meanwhile,
+    so the amounts are not moved in the middle of its payout.
+
+In case of an error while reconciling a farm, the error is logged and the next farm is reconciled.
+The farms that failed are returned as an error after all farms are done.
+*/
+func (s *ReconcileAccrualsService) Execute(ctx context.Context, btcClient BtcClient, storage Storage) error {
+	accruals, err := storage.GetCudosAddressAccruals(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(accruals) == 0 {
+		return nil
+	}
+
+	farms, err := storage.GetApprovedFarms(ctx)
+	if err != nil {
+		return err
+	}
+
+	walletNames := make(map[int64]string)
+	for _, farm := range farms {
+		walletNames[farm.Id] = farm.RewardsFromPoolBtcWalletName
+	}
+
+	// the accruals are ordered by farm
+	var farmIds []int64
+	accrualsByFarm := make(map[int64][]types.AddressThresholdAmountByFarm)
+	for _, accrual := range accruals {
+		farmId, err := strconv.ParseInt(accrual.FarmId, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid farm id {%s} of address {%s}: %s", accrual.FarmId, accrual.BTCAddress, err)
+		}
+
+		if _, ok := accrualsByFarm[farmId]; !ok {
+			farmIds = append(farmIds, farmId)
+		}
+		accrualsByFarm[farmId] = append(accrualsByFarm[farmId], accrual)
+	}
+
+	// an owner usually has amounts in several farms, the mapped address is looked up once
+	payoutAddresses := make(map[string]string)
+
+	var failedFarmIds []int64
+	for _, farmId := range farmIds {
+		if err := s.reconcileFarm(ctx, btcClient, storage, farmId, walletNames[farmId], accrualsByFarm[farmId], payoutAddresses); err != nil {
+			log.Error().Msgf("reconciling the accumulated amounts of farm {%d} failed. Error: %s", farmId, err)
+			failedFarmIds = append(failedFarmIds, farmId)
+		}
+	}
+
+	if len(failedFarmIds) > 0 {
+		return fmt.Errorf("failed to reconcile the accumulated amounts of farms {%v}", failedFarmIds)
+	}
+
+	return nil
+}
+
+func (s *ReconcileAccrualsService) reconcileFarm(ctx context.Context, btcClient BtcClient, storage Storage, farmId int64, walletName string,
+	accruals []types.AddressThresholdAmountByFarm, payoutAddresses map[string]string) error {
+	// the farms that are not approved are not paid, so there is no payout to wait for
+	if walletName != "" {
+		_, releaseWallet, err := btcClient.OpenWallet(walletName)
+		if err != nil {
+			return err
+		}
+		defer releaseWallet()
+	}
+
+	for _, accrual := range accruals {
+		cudosAddress := accrual.BTCAddress
+
+		payoutAddress, ok := payoutAddresses[cudosAddress]
+		if !ok {
+			var err error
+			payoutAddress, err = s.apiRequester.GetPayoutAddressFromNode(ctx, cudosAddress, s.config.Network)
+			if err != nil {
+				return err
+			}
+			payoutAddresses[cudosAddress] = payoutAddress
+		}
+
+		if payoutAddress == "" {
+			continue
+		}
+
+		moved, err := storage.MoveAccumulatedAmount(ctx, farmId, cudosAddress, payoutAddress)
+		if err != nil {
+			return err
+		}
+
+		if moved > 0 {
+			log.Info().Msgf("Moved the accumulated amount of {%s} from {%s} to its btc address {%s} in farm {%d}", moved, cudosAddress, payoutAddress, farmId)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReconcileAccrualsService_Execute(t *testing.T) {
+	storage := &mockStorage{}
+	storage.On("GetCudosAddressAccruals", mock.Anything).Return([]types.AddressThresholdAmountByFarm{
+		{BTCAddress: "cudos1mapped", FarmId: "1", AmountBTC: "0.001"},
+		{BTCAddress: "cudos1unmapped", FarmId: "1", AmountBTC: "0.003"},
+		{BTCAddress: "cudos1mapped", FarmId: "2", AmountBTC: "0.002"},
+	}, nil)
+	storage.On("GetApprovedFarms", mock.Anything).Return([]types.Farm{{Id: 1, RewardsFromPoolBtcWalletName: "farm_1"}}, nil)
+	storage.On("MoveAccumulatedAmount", mock.Anything, int64(1), "cudos1mapped", "btc_owner_address").Return(types.Sats(100000), nil)
+	storage.On("MoveAccumulatedAmount", mock.Anything, int64(2), "cudos1mapped", "btc_owner_address").Return(types.Sats(200000), nil)
+
+	apiRequester := &mockAPIRequester{}
+	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "cudos1mapped", "cudos-network").Return("btc_owner_address", nil).Once()
+	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "cudos1unmapped", "cudos-network").Return("", nil).Once()
+
+	s := NewReconcileAccrualsService(&infrastructure.Config{Network: "cudos-network"}, apiRequester)
+	require.NoError(t, s.Execute(context.Background(), &mockBtcClient{}, storage))
+
+	storage.AssertExpectations(t)
+	apiRequester.AssertExpectations(t)
+	storage.AssertNotCalled(t, "MoveAccumulatedAmount", mock.Anything, mock.Anything, "cudos1unmapped", mock.Anything)
+}
+
+func TestReconcileAccrualsService_FailedFarm(t *testing.T) {
+	storage := &mockStorage{}
+	storage.On("GetCudosAddressAccruals", mock.Anything).Return([]types.AddressThresholdAmountByFarm{
+		{BTCAddress: "cudos1mapped", FarmId: "1", AmountBTC: "0.001"},
+		{BTCAddress: "cudos1mapped", FarmId: "2", AmountBTC: "0.002"},
+	}, nil)
+	storage.On("GetApprovedFarms", mock.Anything).Return([]types.Farm{}, nil)
+	storage.On("MoveAccumulatedAmount", mock.Anything, int64(1), "cudos1mapped", "btc_owner_address").Return(types.Sats(0), errors.New("db down"))
+	storage.On("MoveAccumulatedAmount", mock.Anything, int64(2), "cudos1mapped", "btc_owner_address").Return(types.Sats(200000), nil)
+
+	apiRequester := &mockAPIRequester{}
+	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "cudos1mapped", "cudos-network").Return("btc_owner_address", nil)
+
+	s := NewReconcileAccrualsService(&infrastructure.Config{Network: "cudos-network"}, apiRequester)
+	require.EqualError(t, s.Execute(context.Background(), &mockBtcClient{}, storage),
+		"failed to reconcile the accumulated amounts of farms {[1]}")
+
+	// the next farm is still reconciled
+	storage.AssertExpectations(t)
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/notifier"
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/rs/zerolog/log"
@@ -13,21 +15,29 @@ import (
 type RetryService struct {
 	config                    *infrastructure.Config
 	helper                    InfrastructureHelper
+	alerts                    Alerter
 	btcNetworkParams          *types.BtcNetworkParams
 	apiRequester              ApiRequester
+	secretProvider            SecretProvider
 	btcWalletOpenFailsPerFarm map[string]int
 }
 
-func NewRetryService(config *infrastructure.Config, apiRequester ApiRequester, helper InfrastructureHelper, btcNetworkParams *types.BtcNetworkParams) *RetryService {
+func NewRetryService(config *infrastructure.Config, apiRequester ApiRequester, helper InfrastructureHelper, alerts Alerter, btcNetworkParams *types.BtcNetworkParams, secretProvider SecretProvider) *RetryService {
 	return &RetryService{
 		config:                    config,
 		helper:                    helper,
+		alerts:                    alerts,
 		btcNetworkParams:          btcNetworkParams,
 		apiRequester:              apiRequester,
+		secretProvider:            secretProvider,
 		btcWalletOpenFailsPerFarm: make(map[string]int),
 	}
 }
 
+func (s *RetryService) Dependencies() []string {
+	return []string{metrics.EndpointBitcoind, metrics.EndpointDb}
+}
+
 /*
 Checks the confirmation status of pending transactions,
 updates the status for those with confirmations,
@@ -42,21 +52,25 @@ and retries transactions that have not been confirmed within the specified time
     append the transaction hash to the txToConfirm slice.
     Otherwise, append the transaction object to the txToRetry slice.
 
- 3. Update the status of transactions that have confirmations to TransactionCompleted in the storage.
+ 3. Get the network fees of the transactions that have confirmations from their wallets.
+    Update their status to TransactionCompleted and book the fees in the ledger.
+    A transaction whose fee can not be read stays pending and is completed on the next run.
 
  4. Iterate through the transactions that need to be retried and do the following:
     a. Check if enough time has passed since the transaction was sent
     based on the RBFTransactionRetryDelayInSeconds configuration value.
     b. If the delay requirement is met, call the retryTransaction() function
     to attempt to resend the transaction with a higher fee.
+    The transactions of paused farms are not bumped, a bump spends from the farm wallet. They are retried once the farm is resumed.
 */
 func (s *RetryService) Execute(ctx context.Context, btcClient BtcClient, storage Storage) error {
 	unconfirmedTransactionHashes, err := storage.GetTxHashesByStatus(ctx, types.TransactionPending)
 	if err != nil {
 		return err
 	}
+	metrics.PendingTransactions.Set(float64(len(unconfirmedTransactionHashes)))
 
-	var txToConfirm []string
+	var txToConfirm []types.TransactionHashWithStatus
 	var txToRetry []types.TransactionHashWithStatus
 
 	for _, tx := range unconfirmedTransactionHashes {
@@ -84,21 +98,35 @@ func (s *RetryService) Execute(ctx context.Context, btcClient BtcClient, storage
 		// }
 
 		if decodedRawTx.Confirmations > 0 {
-			txToConfirm = append(txToConfirm, tx.TxHash)
+			txToConfirm = append(txToConfirm, tx)
 		} else {
 			txToRetry = append(txToRetry, tx)
 		}
 	}
 
 	// all the ones that were included in at least 1 block - mark them as completed
-	err = storage.UpdateTransactionsStatus(ctx, txToConfirm, types.TransactionCompleted)
+	networkFees := s.getNetworkFees(ctx, txToConfirm)
+	err = storage.CompleteTransactions(ctx, networkFees)
 	if err != nil {
 		return err
 	}
+	metrics.TransactionStatusChanges.WithLabelValues(types.TransactionCompleted).Add(float64(len(networkFees)))
 
 	// for all others - check if enough time has passed; if so - send bump fee tx
+	var pausedWallets map[string]bool
 	for _, tx := range txToRetry {
 		if s.helper.Unix() >= tx.TimeSent+int64(s.config.RBFTransactionRetryDelayInSeconds) {
+			if pausedWallets == nil {
+				if pausedWallets, err = getPausedWallets(ctx, storage); err != nil {
+					return err
+				}
+			}
+
+			if pausedWallets[tx.FarmBtcWalletName] {
+				log.Info().Msgf("Farm {%s} is paused, skipping the retry of tx {%s}", tx.FarmBtcWalletName, tx.TxHash)
+				continue
+			}
+
 			err := s.retryTransaction(tx, storage, ctx, btcClient)
 			if err != nil {
 				return err
@@ -115,17 +143,19 @@ It checks if the retry count has exceeded the maximum allowed number, and if not
 it creates a new transaction with a higher fee and saves it in the storage.
 
  1. Check if the retry count has exceeded the maximum allowed number of retries for the transaction.
-    If it has, log an error message, send an email notification, and return nil.
- 2. Load the wallet associated with the transaction.
- 3. Use a defer statement to lock and unload the wallet when the function execution completes.
-    This ensures that the wallet is locked and unloaded even if an error occurs during the execution.
+    If it has, log an error message, send a notification, and return nil.
+ 2. Open the wallet associated with the transaction. If the pay service is processing the same farm,
+    this waits until it is finished. Other farms are not waiting on each other.
+ 3. Load the wallet, if it is not loaded yet.
  4. Unlock the wallet for a duration of 60 seconds.
- 5. Call BumpFee() to increase the transaction fee and create a new RBF (Replace-By-Fee) transaction.
+ 5. Use a defer statement to lock the wallet when the function execution completes.
+    This ensures that the wallet is locked even if an error occurs during the execution.
+ 6. Call BumpFee() to increase the transaction fee and create a new RBF (Replace-By-Fee) transaction.
     Store the new transaction hash in newRBFtxHash.
- 6. Save the new RBF transaction information in the storage,
+ 7. Save the new RBF transaction information in the storage,
     marking the old transaction as TransactionReplaced
     and the new transaction as TransactionPending.
- 7. Increment the retry count by 1.
+ 8. Increment the retry count by 1.
 */
 func (s *RetryService) retryTransaction(tx types.TransactionHashWithStatus, storage Storage, ctx context.Context, btcClient BtcClient) error {
 	retryCountExceeded, err := s.retryCountExceeded(tx, storage, ctx)
@@ -135,30 +165,81 @@ func (s *RetryService) retryTransaction(tx types.TransactionHashWithStatus, stor
 	if retryCountExceeded {
 		message := fmt.Sprintf("transaction has reached max RBF retry count and manual intervention will be needed. TxHash: {%s}; Farm Name: {%s}", tx.TxHash, tx.FarmBtcWalletName)
 		log.Error().Msg(message)
-		err = s.helper.SendMail(message)
+		s.alerts.Fire(ctx, fmt.Sprintf("transaction %s", tx.TxHash), notifier.Notification{
+			Severity: notifier.SeverityCritical,
+			Title:    "Transaction needs manual intervention",
+			Message:  message,
+			Farm:     tx.FarmBtcWalletName,
+			TxHash:   tx.TxHash,
+		})
+		return nil
+	}
+
+	_, err = s.bumpFee(ctx, btcClient, storage, tx)
+	return err
+}
+
+// BumpTransaction replaces a pending or failed transaction with a higher fee one right away and returns the hash of the new transaction.
+// It is meant for manual intervention, so the retry delay and the max retry count are not checked.
+func (s *RetryService) BumpTransaction(ctx context.Context, btcClient BtcClient, storage Storage, txHash string) (string, error) {
+	for _, status := range []string{types.TransactionPending, types.TransactionFailed} {
+		txs, err := storage.GetTxHashesByStatus(ctx, status)
 		if err != nil {
-			return err
+			return "", err
+		}
+
+		for _, tx := range txs {
+			if tx.TxHash != txHash {
+				continue
+			}
+
+			newRBFtxHash, err := s.bumpFee(ctx, btcClient, storage, tx)
+			if err != nil {
+				return "", err
+			}
+			if newRBFtxHash == "" {
+				return "", fmt.Errorf("wallet {%s} could not be loaded", tx.FarmBtcWalletName)
+			}
+
+			return newRBFtxHash, nil
 		}
-		return nil
 	}
+
+	return "", fmt.Errorf("no pending or failed transaction with hash {%s} found", txHash)
+}
+
+// bumpFee replaces the transaction with a higher fee one and saves the replacement.
+// If the wallet could not be loaded yet, nothing is done and the returned hash is empty.
+func (s *RetryService) bumpFee(ctx context.Context, btcClient BtcClient, storage Storage, tx types.TransactionHashWithStatus) (string, error) {
+	walletClient, releaseWallet, err := btcClient.OpenWallet(tx.FarmBtcWalletName)
+	if err != nil {
+		return "", err
+	}
+	defer releaseWallet()
+
 	loaded, err := s.loadWallet(btcClient, tx.FarmBtcWalletName)
 	if err != nil || !loaded {
-		return err
+		return "", err
 	}
-	defer unloadWallet(btcClient, tx.FarmBtcWalletName)
 
-	err = btcClient.WalletPassphrase(s.config.AuraPoolTestFarmWalletPassword, 60)
+	err = unlockWallet(s.secretProvider, walletClient, tx.FarmBtcWalletName)
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer lockWallet(btcClient, tx.FarmBtcWalletName)
+	defer lockWallet(walletClient, tx.FarmBtcWalletName)
 
-	newRBFtxHash, err := s.apiRequester.BumpFee(ctx, tx.TxHash)
+	newRBFtxHash, err := s.apiRequester.BumpFee(ctx, tx.FarmBtcWalletName, tx.TxHash)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	return storage.SaveRBFTransactionInformation(ctx, tx.TxHash, types.TransactionReplaced, newRBFtxHash, types.TransactionPending, tx.FarmBtcWalletName, tx.FarmPaymentId, tx.RetryCount+1)
+	if err := storage.SaveRBFTransactionInformation(ctx, tx.TxHash, types.TransactionReplaced, newRBFtxHash, types.TransactionPending, tx.FarmBtcWalletName, tx.FarmPaymentId, tx.RetryCount+1); err != nil {
+		return "", err
+	}
+
+	metrics.RBFBumps.WithLabelValues(tx.FarmBtcWalletName).Inc()
+	metrics.TransactionStatusChanges.WithLabelValues(types.TransactionReplaced).Inc()
+	return newRBFtxHash, nil
 }
 
 /*
@@ -183,7 +264,39 @@ func (s *RetryService) retryCountExceeded(tx types.TransactionHashWithStatus, st
 		if err != nil {
 			return true, err
 		}
+		metrics.TransactionStatusChanges.WithLabelValues(types.TransactionFailed).Inc()
 		return true, nil
 	}
 	return false, nil
 }
+
+// getPausedWallets returns the wallet names of the approved farms that are paused
+func getPausedWallets(ctx context.Context, storage Storage) (map[string]bool, error) {
+	pausedFarmIds, err := storage.GetPausedFarmIds(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pausedWallets := make(map[string]bool)
+	if len(pausedFarmIds) == 0 {
+		return pausedWallets, nil
+	}
+
+	farms, err := storage.GetApprovedFarms(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pausedFarms := make(map[int64]bool)
+	for _, farmId := range pausedFarmIds {
+		pausedFarms[farmId] = true
+	}
+
+	for _, farm := range farms {
+		if pausedFarms[farm.Id] {
+			pausedWallets[farm.RewardsFromPoolBtcWalletName] = true
+		}
+	}
+
+	return pausedWallets, nil
+}
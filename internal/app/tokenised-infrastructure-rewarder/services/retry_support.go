@@ -1,8 +1,10 @@
 package services
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
 	"github.com/rs/zerolog/log"
 )
 
@@ -38,6 +40,7 @@ import (
 // }
 
 // loadWallet attempts to load the specified Bitcoin wallet using the given BTC client.
+// A wallet that is already loaded is not loaded again.
 // If the wallet fails to load for 15 consecutive attempts, the function returns an error.
 // The function returns a boolean to indicate whether the wallet was successfully loaded or not.
 // If the wallet is loaded successfully - nullate the fail counter for the wallet.
@@ -45,7 +48,16 @@ import (
 // - bool: True if the wallet was successfully loaded, false otherwise.
 // - error: An error indicating the reason for the wallet load failure, if any.
 func (s *RetryService) loadWallet(btcClient BtcClient, farmName string) (bool, error) {
-	_, err := btcClient.LoadWallet(farmName)
+	loaded, err := isWalletLoaded(btcClient, farmName)
+	if err != nil {
+		return false, err
+	}
+
+	if loaded {
+		return true, nil
+	}
+
+	_, err = btcClient.LoadWallet(farmName)
 	if err != nil {
 		s.btcWalletOpenFailsPerFarm[farmName]++
 		if s.btcWalletOpenFailsPerFarm[farmName] >= 15 {
@@ -62,3 +74,29 @@ func (s *RetryService) loadWallet(btcClient BtcClient, farmName string) (bool, e
 
 	return true, nil
 }
+
+// getNetworkFees reads the fees of the confirmed transactions from the wallets that sent them.
+// The wallet reports the fee as a negative amount. Transactions whose fee can not be read are left out.
+func (s *RetryService) getNetworkFees(ctx context.Context, confirmedTxs []types.TransactionHashWithStatus) []types.NetworkFee {
+	var networkFees []types.NetworkFee
+	for _, tx := range confirmedTxs {
+		walletTransaction, err := s.apiRequester.GetWalletTransaction(ctx, tx.FarmBtcWalletName, tx.TxHash)
+		if err != nil {
+			log.Error().Msgf("Failed to get the network fee of transaction {%s}, it stays pending: %s", tx.TxHash, err)
+			continue
+		}
+
+		fee := walletTransaction.Fee
+		if fee < 0 {
+			fee = -fee
+		}
+
+		networkFees = append(networkFees, types.NetworkFee{
+			TxHash:        tx.TxHash,
+			FarmPaymentId: tx.FarmPaymentId,
+			FeeBtc:        fee,
+		})
+	}
+
+	return networkFees
+}
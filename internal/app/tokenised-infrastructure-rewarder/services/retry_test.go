@@ -2,10 +2,12 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/sql_db"
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/chaincfg"
@@ -31,19 +33,19 @@ func TestRetryService_Execute(t *testing.T) {
 		MinConfirmations: 6,
 	}
 
-	s := NewRetryService(config, setupMockApiRequesterRetryService(), &mockHelper{}, btcNetworkParams)
+	s := NewRetryService(config, setupMockApiRequesterRetryService(), &mockHelper{}, &mockAlerter{}, btcNetworkParams, &mockSecretProvider{})
 	mockStorageService := setupMockStorageRetryService()
 	require.NoError(t, s.Execute(context.Background(), setupMockBtcClientRetryService(), mockStorageService))
 
 	completedTransactions := 0
-	expectedCompletedTransactions := 1
+	expectedCompletedTransactions := 2
 	repalcedTransactions := 0
 	expectedReplacedTransactions := 2
 	failedTransactions := 0
 	expectedFailedTransactions := 1
 	for _, elem := range mockStorageService.Calls {
-		if elem.Method == "UpdateTransactionsStatus" && elem.Arguments[2].(string) == "Completed" {
-			completedTransactions++
+		if elem.Method == "CompleteTransactions" {
+			completedTransactions += len(elem.Arguments[1].([]types.NetworkFee))
 		}
 		if elem.Method == "UpdateTransactionsStatus" && elem.Arguments[2].(string) == "Failed" {
 			failedTransactions++
@@ -59,15 +61,63 @@ func TestRetryService_Execute(t *testing.T) {
 	assert.Equal(t, expectedFailedTransactions, failedTransactions)
 
 }
+
+func TestRetryService_Execute_PausedFarm(t *testing.T) {
+	config := &infrastructure.Config{RBFTransactionRetryDelayInSeconds: 10, RBFTransactionRetryMaxCount: 2}
+
+	storage := &mockStorage{}
+	storage.On("GetTxHashesByStatus", mock.Anything, types.TransactionPending).Return([]types.TransactionHashWithStatus{
+		{TxHash: "b58d7705c8980ad58e9ee981760bdb45f28adad898266b58ebde6dedfc93f884", TimeSent: 10, FarmBtcWalletName: "farm_sub_account_name_1"},
+	}, nil)
+	storage.On("CompleteTransactions", mock.Anything, mock.Anything).Return(nil)
+	storage.On("GetPausedFarmIds", mock.Anything).Return([]int64{1}, nil)
+	storage.On("GetApprovedFarms", mock.Anything).Return([]types.Farm{{Id: 1, RewardsFromPoolBtcWalletName: "farm_sub_account_name_1"}}, nil)
+
+	apiRequester := &mockAPIRequester{}
+	s := NewRetryService(config, apiRequester, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{})
+	require.NoError(t, s.Execute(context.Background(), setupMockBtcClientRetryService(), storage))
+
+	// the wallet of a paused farm is not spent from
+	apiRequester.AssertNotCalled(t, "BumpFee", mock.Anything, mock.Anything, mock.Anything)
+	storage.AssertNotCalled(t, "SaveRBFTransactionInformation", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestRetryService_BumpTransaction(t *testing.T) {
+	config := &infrastructure.Config{
+		RBFTransactionRetryMaxCount: 2,
+	}
+
+	failedTxHash := "b58d7705c8980ad58e9ee981760bdb45f28adad898266b58ebde6dedfc93f889"
+	storage := &mockStorage{}
+	storage.On("GetTxHashesByStatus", mock.Anything, types.TransactionPending).Return([]types.TransactionHashWithStatus{}, nil)
+	storage.On("GetTxHashesByStatus", mock.Anything, types.TransactionFailed).Return([]types.TransactionHashWithStatus{
+		{TxHash: failedTxHash, FarmBtcWalletName: "farm_sub_account_name_1", FarmPaymentId: 1, RetryCount: 2},
+	}, nil)
+	storage.On("SaveRBFTransactionInformation", mock.Anything, failedTxHash, types.TransactionReplaced, "new_tx_hash", types.TransactionPending, "farm_sub_account_name_1", int64(1), 3).Return(nil)
+
+	apiRequester := &mockAPIRequester{}
+	apiRequester.On("BumpFee", mock.Anything, "farm_sub_account_name_1", failedTxHash).Return("new_tx_hash", nil)
+
+	s := NewRetryService(config, apiRequester, &mockHelper{}, &mockAlerter{}, &types.BtcNetworkParams{}, &mockSecretProvider{})
+
+	// the max retry count is reached, but the manual bump still replaces the transaction
+	newTxHash, err := s.BumpTransaction(context.Background(), setupMockBtcClientRetryService(), storage, failedTxHash)
+	require.NoError(t, err)
+	require.Equal(t, "new_tx_hash", newTxHash)
+	storage.AssertExpectations(t)
+
+	_, err = s.BumpTransaction(context.Background(), setupMockBtcClientRetryService(), storage, "unknown_tx_hash")
+	require.Error(t, err)
+}
+
 func TestRetryService_Execute_With_Database(t *testing.T) {
-	skipDBTests(t)
 
 	config := &infrastructure.Config{
 		Network:                     "BTC",
 		CUDOMaintenanceFeePercent:   50,
 		CUDOFeeOnAllBTC:             2,
 		CUDOFeePayoutAddress:        "cudo_maintenance_fee_payout_address_1",
-		GlobalPayoutThresholdInBTC:  0.01,
+		GlobalPayoutThresholdInBTC:  1000000,
 		DbDriverName:                "postgres",
 		DbUser:                      "postgresUser",
 		DbPassword:                  "mysecretpassword",
@@ -88,8 +138,9 @@ func TestRetryService_Execute_With_Database(t *testing.T) {
 	}()
 
 	seedDatabase(dbStorage)
+	seedFarmPayments(sqlxDB)
 
-	s := NewRetryService(config, setupMockApiRequesterRetryService(), &mockHelperRetry{}, btcNetworkParams)
+	s := NewRetryService(config, setupMockApiRequesterRetryService(), &mockHelperRetry{}, &mockAlerter{}, btcNetworkParams, &mockSecretProvider{})
 	require.NoError(t, s.Execute(context.Background(), setupMockBtcClientRetryService(), dbStorage))
 	// fetch from db and check:
 	confirmedTx, _ := dbStorage.GetTxHashesByStatus(context.Background(), types.TransactionCompleted)
@@ -97,6 +148,14 @@ func TestRetryService_Execute_With_Database(t *testing.T) {
 	assert.Equal(t, "b58d7705c8980ad58e9ee981760bdb45f28adad898266b58ebde6dedfc93f881", confirmedTx[0].TxHash)
 	assert.Equal(t, "b58d7705c8980ad58e9ee981760bdb45f28adad898266b58ebde6dedfc93f882", confirmedTx[1].TxHash)
 
+	// the network fees of the confirmed transactions are booked against the income of their farm
+	var networkFeeEntries []types.LedgerEntry
+	err := sqlxDB.SelectContext(context.Background(), &networkFeeEntries, `SELECT * FROM ledger_entries WHERE account = $1 ORDER BY id`, types.LedgerNetworkFee)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(networkFeeEntries))
+	assert.Equal(t, int64(1), networkFeeEntries[0].FarmId)
+	assert.Equal(t, "0.0001", networkFeeEntries[0].AmountBtc.String())
+
 	failedTx, _ := dbStorage.GetTxHashesByStatus(context.Background(), types.TransactionFailed)
 	assert.Equal(t, 2, len(failedTx))
 	assert.Equal(t, "b58d7705c8980ad58e9ee981760bdb45f28adad898266b58ebde6dedfc93f883", failedTx[0].TxHash)
@@ -115,7 +174,7 @@ func TestRetryService_Execute_With_Database(t *testing.T) {
 	assert.Equal(t, 1, newPendingTx[1].RetryCount)
 
 	var rbfHistory []types.RBFTransactionHistory
-	err := sqlxDB.SelectContext(context.Background(), &rbfHistory, `SELECT * FROM rbf_transaction_history`)
+	err = sqlxDB.SelectContext(context.Background(), &rbfHistory, `SELECT * FROM rbf_transaction_history`)
 	if err != nil {
 		panic(err)
 	}
@@ -160,14 +219,25 @@ func seedDatabase(dbStorage Storage) {
 	}
 }
 
+func seedFarmPayments(sqlxDB *sqlx.DB) {
+	for _, farmPaymentId := range []int64{1, 2} {
+		_, err := sqlxDB.Exec(`INSERT INTO farm_payment_statistics (id, farm_id, amount_btc, "createdAt", "updatedAt") VALUES ($1, 1, '1', $2, $2)`,
+			farmPaymentId, time.Now())
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
 func setupMockApiRequesterRetryService() *mockAPIRequester {
 	apiRequester := &mockAPIRequester{}
 
 	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "nft_owner_2", "BTC").Return("nft_owner_2_payout_addr", nil)
-	apiRequester.On("BumpFee", mock.Anything, "b58d7705c8980ad58e9ee981760bdb45f28adad898266b58ebde6dedfc93f884").Return(
+	apiRequester.On("BumpFee", mock.Anything, mock.Anything, "b58d7705c8980ad58e9ee981760bdb45f28adad898266b58ebde6dedfc93f884").Return(
 		"b58d7705c8980ad58e9ee981760bdb45f28adad898266b58ebde6dedfc93f885", nil)
-	apiRequester.On("BumpFee", mock.Anything, "b58d7705c8980ad58e9ee981760bdb45f28adad898266b58ebde6dedfc93f887").Return(
+	apiRequester.On("BumpFee", mock.Anything, mock.Anything, "b58d7705c8980ad58e9ee981760bdb45f28adad898266b58ebde6dedfc93f887").Return(
 		"b58d7705c8980ad58e9ee981760bdb45f28adad898266b58ebde6dedfc93f888", nil)
+	apiRequester.On("GetWalletTransaction", mock.Anything, "farm_sub_account_name_1", mock.Anything).Return(&types.BtcWalletTransaction{Fee: -10000}, nil)
 
 	return apiRequester
 }
@@ -201,7 +271,7 @@ func setupMockBtcClientRetryService() *mockBtcClient {
 
 	btcClient.On("LoadWallet", "farm_sub_account_name_1").Return(&btcjson.LoadWalletResult{}, nil)
 
-	btcClient.On("UnloadWallet", mock.Anything).Return(nil)
+	btcClient.On("RawRequest").Return(json.RawMessage(`[]`), nil)
 
 	btcClient.On("WalletPassphrase", mock.Anything, mock.Anything).Return(nil)
 
@@ -257,14 +327,21 @@ func setupMockStorageRetryService() *mockStorage {
 
 	storage.On("GetTxHashesByStatus", mock.Anything, types.TransactionPending).Return(uncomfirmedTransactions, nil)
 	storage.On("UpdateTransactionsStatus", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	storage.On("CompleteTransactions", mock.Anything, mock.Anything).Return(nil)
 	storage.On("SaveTxHashWithStatus", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 	storage.On("SaveRBFTransactionInformation", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
 	storage.On("GetApprovedFarms", mock.Anything).Return(nil, nil)
+	storage.On("GetPausedFarmIds", mock.Anything).Return([]int64{}, nil)
 
 	return storage
 }
 
 func tearDownDatabaseRBF(sqlxDB *sqlx.DB) {
+	if sqlxDB.DriverName() == sql_db.DriverSqlite {
+		sqlxDB.Close()
+		return
+	}
+
 	_, err := sqlxDB.Exec("TRUNCATE TABLE statistics_tx_hash_status")
 	if err != nil {
 		panic(err)
@@ -273,6 +350,10 @@ func tearDownDatabaseRBF(sqlxDB *sqlx.DB) {
 	if err != nil {
 		panic(err)
 	}
+	_, err = sqlxDB.Exec("TRUNCATE TABLE farm_payment_statistics, ledger_entries")
+	if err != nil {
+		panic(err)
+	}
 }
 
 type mockHelperRetry struct {
@@ -289,7 +370,3 @@ func (_ *mockHelperRetry) Date() (year int, month time.Month, day int) {
 func (_ *mockHelperRetry) Unix() int64 {
 	return 4132020742
 }
-
-func (_ *mockHelperRetry) SendMail(message string) error {
-	return nil
-}
@@ -0,0 +1,508 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/shopspring/decimal"
+)
+
+type StatementStorage interface {
+	GetNFTStatisticsByOwner(ctx context.Context, owner string, from, to int64) ([]types.NFTStatistics, error)
+	GetThresholdAmountsByAddress(ctx context.Context, address string) ([]types.AddressThresholdAmountByFarm, error)
+	GetPaidDestinationsByAddress(ctx context.Context, address string, from, to time.Time) ([]types.AddressPayout, error)
+	GetFarmPaymentUTXOTxHash(ctx context.Context, farmPaymentId int64) (string, error)
+	GetBtcPrice(ctx context.Context, event, reference, currency string) (types.BtcPrice, error)
+}
+
+// OwnerStatementQuery selects what the owner earned with the nfts held in [From, To).
+// The amounts are valued in the fiat Currency at the captured prices, the statement has no fiat values without a currency.
+type OwnerStatementQuery struct {
+	Owner    string
+	From     time.Time
+	To       time.Time
+	Currency string
+}
+
+// OwnerStatement is what a nft owner earned in a period, what is still held for them below the payment threshold
+// and the transactions that paid them
+type OwnerStatement struct {
+	Owner string
+	From  time.Time
+	To    time.Time
+	// PayoutAddresses are the btc addresses the rewards of the owner were sent to
+	PayoutAddresses []string
+	Nfts            []StatementNft
+	Held            []StatementHeld
+	Payments        []StatementPayment
+
+	GrossRewardBtc        types.Sats
+	FarmMaintenanceFeeBtc types.Sats
+	CUDOMaintenanceFeeBtc types.Sats
+	NetRewardBtc          types.Sats
+	HeldBtc               types.Sats
+	PaidBtc               types.Sats
+
+	FiatCurrency string
+	// FiatTotals are the totals in the fiat currency, nil if the price of any nft or payment was not captured
+	FiatTotals *StatementFiatTotals
+}
+
+// StatementFiatTotals are the totals of a statement valued at the prices of the payments
+type StatementFiatTotals struct {
+	GrossReward        decimal.Decimal
+	FarmMaintenanceFee decimal.Decimal
+	CUDOMaintenanceFee decimal.Decimal
+	NetReward          decimal.Decimal
+	Paid               decimal.Decimal
+}
+
+// StatementNft is an ownership window of a nft, the net reward is what was accrued for the owner
+type StatementNft struct {
+	FarmPaymentId         int64
+	DenomId               string
+	TokenId               string
+	TimeOwnedFrom         time.Time
+	TimeOwnedTo           time.Time
+	PercentOfTimeOwned    float64
+	PayoutAddress         string
+	GrossRewardBtc        types.Sats
+	FarmMaintenanceFeeBtc types.Sats
+	CUDOMaintenanceFeeBtc types.Sats
+	NetRewardBtc          types.Sats
+	// BtcPrice is the price when the farm payment was received, nil if it was not captured
+	BtcPrice *decimal.Decimal
+}
+
+// StatementHeld is the amount accumulated for an address of the owner in a farm, waiting for the payment threshold
+type StatementHeld struct {
+	Address   string
+	FarmId    int64
+	AmountBtc types.Sats
+}
+
+type StatementPayment struct {
+	FarmPaymentId    int64
+	Address          string
+	AmountBtc        types.Sats
+	TxHash           string
+	Status           string
+	ReplacedByTxHash string
+	PaidAt           time.Time
+	// CrossFarm is set when the payment was made because the amounts held for the owner in all farms reached the threshold together
+	CrossFarm bool
+	// BtcPrice is the price when the transaction was sent, or else when the farm payment was received
+	BtcPrice *decimal.Decimal
+}
+
+// The formats an owner statement can be written in
+const (
+	StatementFormatHTML = "html"
+	StatementFormatCSV  = "csv"
+)
+
+/*
+GenerateOwnerStatement collects the earnings of the owner in the period of the query.
+
+ 1. Every ownership window that overlaps the period is listed whole, as it was paid.
+    The maintenance fees of a nft are split between its owners by the time they owned it, like its reward,
+    so the gross reward of a window is its net reward plus its part of the fees.
+ 2. The rewards accrue for the cudos address of the owner until it maps a btc address,
+    after that they accrue for the btc address. Both are reported as held, in every farm.
+ 3. The payments are the transactions that sent the accrued amounts to the btc addresses in the period.
+    A payment to a btc address includes everything accrued for it, not only the nfts of the statement.
+ 4. The nfts are valued at the price when their farm payment was received, the payments at the price when they were sent.
+    The amounts held are not valued, they are not paid yet.
+*/
+func GenerateOwnerStatement(ctx context.Context, storage StatementStorage, query OwnerStatementQuery) (OwnerStatement, error) {
+	if query.Owner == "" {
+		return OwnerStatement{}, fmt.Errorf("owner address is required")
+	}
+	if !query.From.Before(query.To) {
+		return OwnerStatement{}, fmt.Errorf("invalid statement period, from {%s} is not before to {%s}", query.From, query.To)
+	}
+
+	statement := OwnerStatement{
+		Owner:           query.Owner,
+		From:            query.From.UTC(),
+		To:              query.To.UTC(),
+		PayoutAddresses: []string{},
+		Nfts:            []StatementNft{},
+		Held:            []StatementHeld{},
+		Payments:        []StatementPayment{},
+		FiatCurrency:    query.Currency,
+	}
+
+	farmPaymentPrices := make(map[int64]*decimal.Decimal)
+	getFarmPaymentPrice := func(farmPaymentId int64) (*decimal.Decimal, error) {
+		if query.Currency == "" {
+			return nil, nil
+		}
+		if price, ok := farmPaymentPrices[farmPaymentId]; ok {
+			return price, nil
+		}
+
+		utxoTxHash, err := storage.GetFarmPaymentUTXOTxHash(ctx, farmPaymentId)
+		if err != nil {
+			return nil, err
+		}
+
+		var price *decimal.Decimal
+		if utxoTxHash != "" {
+			if price, err = getBtcPrice(ctx, storage, types.BtcPriceEventFarmPayment, utxoTxHash, query.Currency); err != nil {
+				return nil, err
+			}
+		}
+		farmPaymentPrices[farmPaymentId] = price
+		return price, nil
+	}
+
+	statistics, err := storage.GetNFTStatisticsByOwner(ctx, query.Owner, query.From.Unix(), query.To.Unix())
+	if err != nil {
+		return OwnerStatement{}, err
+	}
+
+	payoutAddresses := make(map[string]bool)
+	for _, nftStatistics := range statistics {
+		timesOwned := make([]decimal.Decimal, len(nftStatistics.NFTOwnersForPeriod))
+		for i, owner := range nftStatistics.NFTOwnersForPeriod {
+			timesOwned[i] = decimal.NewFromInt(owner.TotalTimeOwned)
+		}
+		farmMaintenanceFees := nftStatistics.MaintenanceFee.Allocate(timesOwned)
+		cudoMaintenanceFees := nftStatistics.CUDOPartOfMaintenanceFee.Allocate(timesOwned)
+
+		for i, owner := range nftStatistics.NFTOwnersForPeriod {
+			if owner.Owner != query.Owner || owner.TimeOwnedTo <= query.From.Unix() || owner.TimeOwnedFrom >= query.To.Unix() {
+				continue
+			}
+
+			if owner.PayoutAddress != "" && owner.PayoutAddress != query.Owner {
+				payoutAddresses[owner.PayoutAddress] = true
+			}
+
+			nft := StatementNft{
+				FarmPaymentId:         nftStatistics.FarmPaymentId,
+				DenomId:               nftStatistics.DenomId,
+				TokenId:               nftStatistics.TokenId,
+				TimeOwnedFrom:         time.Unix(owner.TimeOwnedFrom, 0).UTC(),
+				TimeOwnedTo:           time.Unix(owner.TimeOwnedTo, 0).UTC(),
+				PercentOfTimeOwned:    owner.PercentOfTimeOwned,
+				PayoutAddress:         owner.PayoutAddress,
+				FarmMaintenanceFeeBtc: farmMaintenanceFees[i],
+				CUDOMaintenanceFeeBtc: cudoMaintenanceFees[i],
+				NetRewardBtc:          owner.Reward,
+			}
+			nft.GrossRewardBtc = nft.NetRewardBtc + nft.FarmMaintenanceFeeBtc + nft.CUDOMaintenanceFeeBtc
+			if nft.BtcPrice, err = getFarmPaymentPrice(nft.FarmPaymentId); err != nil {
+				return OwnerStatement{}, err
+			}
+
+			statement.Nfts = append(statement.Nfts, nft)
+			statement.GrossRewardBtc += nft.GrossRewardBtc
+			statement.FarmMaintenanceFeeBtc += nft.FarmMaintenanceFeeBtc
+			statement.CUDOMaintenanceFeeBtc += nft.CUDOMaintenanceFeeBtc
+			statement.NetRewardBtc += nft.NetRewardBtc
+		}
+	}
+
+	for address := range payoutAddresses {
+		statement.PayoutAddresses = append(statement.PayoutAddresses, address)
+	}
+	sort.Strings(statement.PayoutAddresses)
+
+	for _, address := range append([]string{query.Owner}, statement.PayoutAddresses...) {
+		thresholdAmounts, err := storage.GetThresholdAmountsByAddress(ctx, address)
+		if err != nil {
+			return OwnerStatement{}, err
+		}
+
+		for _, thresholdAmount := range thresholdAmounts {
+			amount, err := types.ParseSats(thresholdAmount.AmountBTC)
+			if err != nil {
+				return OwnerStatement{}, fmt.Errorf("invalid amount held for address {%s} in farm {%s}: %s", address, thresholdAmount.FarmId, err)
+			}
+			if amount <= 0 {
+				continue
+			}
+
+			farmId, err := strconv.ParseInt(thresholdAmount.FarmId, 10, 64)
+			if err != nil {
+				return OwnerStatement{}, fmt.Errorf("invalid farm id {%s} of address {%s}: %s", thresholdAmount.FarmId, address, err)
+			}
+
+			statement.Held = append(statement.Held, StatementHeld{Address: address, FarmId: farmId, AmountBtc: amount})
+			statement.HeldBtc += amount
+		}
+
+		payouts, err := storage.GetPaidDestinationsByAddress(ctx, address, query.From, query.To)
+		if err != nil {
+			return OwnerStatement{}, err
+		}
+
+		for _, payout := range payouts {
+			payment := StatementPayment{
+				FarmPaymentId:    payout.FarmPaymentId,
+				Address:          payout.Address,
+				AmountBtc:        payout.AmountBTC,
+				TxHash:           payout.TxHash,
+				Status:           payout.Status,
+				ReplacedByTxHash: payout.ReplacedByTxHash,
+				PaidAt:           payout.CreatedAt.UTC(),
+				CrossFarm:        payout.CrossFarm,
+			}
+
+			if query.Currency != "" && payout.TxHash != "" {
+				if payment.BtcPrice, err = getBtcPrice(ctx, storage, types.BtcPriceEventSendMany, payout.TxHash, query.Currency); err != nil {
+					return OwnerStatement{}, err
+				}
+			}
+			if payment.BtcPrice == nil {
+				if payment.BtcPrice, err = getFarmPaymentPrice(payout.FarmPaymentId); err != nil {
+					return OwnerStatement{}, err
+				}
+			}
+
+			statement.Payments = append(statement.Payments, payment)
+			statement.PaidBtc += payout.AmountBTC
+		}
+	}
+
+	if query.Currency != "" {
+		statement.FiatTotals = statementFiatTotals(statement)
+	}
+
+	return statement, nil
+}
+
+// statementFiatTotals adds up the fiat values of the nfts and the payments, nil if any of them has no price
+func statementFiatTotals(statement OwnerStatement) *StatementFiatTotals {
+	totals := StatementFiatTotals{}
+	for _, nft := range statement.Nfts {
+		if nft.BtcPrice == nil {
+			return nil
+		}
+		totals.GrossReward = totals.GrossReward.Add(nft.GrossRewardBtc.FiatValue(*nft.BtcPrice))
+		totals.FarmMaintenanceFee = totals.FarmMaintenanceFee.Add(nft.FarmMaintenanceFeeBtc.FiatValue(*nft.BtcPrice))
+		totals.CUDOMaintenanceFee = totals.CUDOMaintenanceFee.Add(nft.CUDOMaintenanceFeeBtc.FiatValue(*nft.BtcPrice))
+		totals.NetReward = totals.NetReward.Add(nft.NetRewardBtc.FiatValue(*nft.BtcPrice))
+	}
+
+	for _, payment := range statement.Payments {
+		if payment.BtcPrice == nil {
+			return nil
+		}
+		totals.Paid = totals.Paid.Add(payment.AmountBtc.FiatValue(*payment.BtcPrice))
+	}
+
+	return &totals
+}
+
+// WriteOwnerStatement writes the statement in the given format
+func WriteOwnerStatement(w io.Writer, format string, statement OwnerStatement) error {
+	switch format {
+	case StatementFormatHTML:
+		return ownerStatementTemplate.Execute(w, statement)
+	case StatementFormatCSV:
+		return WriteOwnerStatementCSV(w, statement)
+	default:
+		return fmt.Errorf("invalid statement format {%s}, expected %s or %s", format, StatementFormatHTML, StatementFormatCSV)
+	}
+}
+
+// OwnerStatementCSVHeader are the columns of the csv statement, in their order.
+// Every row is a record of the statement, the columns that don't apply to the record are empty.
+// Every amount is in btc, sats and the fiat currency, the fiat columns are empty when the price was not captured.
+var OwnerStatementCSVHeader = exportColumns(
+	"owner",
+	"record",
+	"farm_payment_id",
+	"farm_id",
+	"denom_id",
+	"token_id",
+	"time_owned_from",
+	"time_owned_to",
+	"percent_of_time_owned",
+	"address",
+	"fiat_currency",
+	"btc_price",
+	"gross_reward_btc",
+	"farm_maintenance_fee_btc",
+	"cudo_maintenance_fee_btc",
+	"net_reward_btc",
+	"amount_btc",
+	"tx_hash",
+	"status",
+	"replaced_by_tx_hash",
+	"paid_at",
+	"cross_farm",
+)
+
+// the records of the csv statement
+const (
+	statementRecordNft     = "nft"
+	statementRecordHeld    = "held"
+	statementRecordPayment = "payment"
+	statementRecordTotal   = "total"
+)
+
+// WriteOwnerStatementCSV writes the statement as csv, with the columns of OwnerStatementCSVHeader.
+// The nft records come first, then the held and the payment records, and the totals last.
+func WriteOwnerStatementCSV(w io.Writer, statement OwnerStatement) error {
+	csvWriter := csv.NewWriter(w)
+	if err := csvWriter.Write(OwnerStatementCSVHeader); err != nil {
+		return err
+	}
+
+	for _, row := range ownerStatementRows(statement) {
+		if err := csvWriter.Write(row.values(OwnerStatementCSVHeader)); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+func ownerStatementRows(statement OwnerStatement) []exportRow {
+	newRow := func(record string) exportRow {
+		return exportRow{"owner": statement.Owner, "record": record}
+	}
+
+	rows := []exportRow{}
+	for _, nft := range statement.Nfts {
+		row := newRow(statementRecordNft)
+		row["farm_payment_id"] = strconv.FormatInt(nft.FarmPaymentId, 10)
+		row["denom_id"] = nft.DenomId
+		row["token_id"] = nft.TokenId
+		row["time_owned_from"] = nft.TimeOwnedFrom.Format(time.RFC3339)
+		row["time_owned_to"] = nft.TimeOwnedTo.Format(time.RFC3339)
+		row["percent_of_time_owned"] = strconv.FormatFloat(nft.PercentOfTimeOwned, 'f', -1, 64)
+		row["address"] = nft.PayoutAddress
+		row.setPrice(statement.FiatCurrency, nft.BtcPrice)
+		row.setAmount("gross_reward_btc", nft.GrossRewardBtc)
+		row.setAmount("farm_maintenance_fee_btc", nft.FarmMaintenanceFeeBtc)
+		row.setAmount("cudo_maintenance_fee_btc", nft.CUDOMaintenanceFeeBtc)
+		row.setAmount("net_reward_btc", nft.NetRewardBtc)
+		rows = append(rows, row)
+	}
+
+	for _, held := range statement.Held {
+		row := newRow(statementRecordHeld)
+		row["farm_id"] = strconv.FormatInt(held.FarmId, 10)
+		row["address"] = held.Address
+		row.setAmount("amount_btc", held.AmountBtc)
+		rows = append(rows, row)
+	}
+
+	for _, payment := range statement.Payments {
+		row := newRow(statementRecordPayment)
+		row["farm_payment_id"] = strconv.FormatInt(payment.FarmPaymentId, 10)
+		row["address"] = payment.Address
+		row.setPrice(statement.FiatCurrency, payment.BtcPrice)
+		row.setAmount("amount_btc", payment.AmountBtc)
+		row["tx_hash"] = payment.TxHash
+		row["status"] = payment.Status
+		row["replaced_by_tx_hash"] = payment.ReplacedByTxHash
+		row["paid_at"] = payment.PaidAt.Format(time.RFC3339)
+		row["cross_farm"] = strconv.FormatBool(payment.CrossFarm)
+		rows = append(rows, row)
+	}
+
+	total := newRow(statementRecordTotal)
+	total["time_owned_from"] = statement.From.Format(time.RFC3339)
+	total["time_owned_to"] = statement.To.Format(time.RFC3339)
+	total.setAmount("gross_reward_btc", statement.GrossRewardBtc)
+	total.setAmount("farm_maintenance_fee_btc", statement.FarmMaintenanceFeeBtc)
+	total.setAmount("cudo_maintenance_fee_btc", statement.CUDOMaintenanceFeeBtc)
+	total.setAmount("net_reward_btc", statement.NetRewardBtc)
+	total.setAmount("amount_btc", statement.HeldBtc)
+	if statement.FiatTotals != nil {
+		total["fiat_currency"] = statement.FiatCurrency
+		total["gross_reward_fiat"] = statement.FiatTotals.GrossReward.StringFixed(2)
+		total["farm_maintenance_fee_fiat"] = statement.FiatTotals.FarmMaintenanceFee.StringFixed(2)
+		total["cudo_maintenance_fee_fiat"] = statement.FiatTotals.CUDOMaintenanceFee.StringFixed(2)
+		total["net_reward_fiat"] = statement.FiatTotals.NetReward.StringFixed(2)
+	}
+
+	return append(rows, total)
+}
+
+var ownerStatementTemplate = template.Must(template.New("owner_statement").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.Format("2006-01-02 15:04:05 MST") },
+	"fiat": func(amount types.Sats, btcPrice *decimal.Decimal) string {
+		if btcPrice == nil {
+			return ""
+		}
+		return amount.FiatValue(*btcPrice).StringFixed(2)
+	},
+	"upper": strings.ToUpper,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Earnings statement of {{.Owner}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; }
+td.amount { text-align: right; font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>Earnings statement</h1>
+<p>Owner: {{.Owner}}<br>
+Period: {{date .From}} to {{date .To}}<br>
+{{if .PayoutAddresses}}BTC payout addresses: {{range $i, $address := .PayoutAddresses}}{{if $i}}, {{end}}{{$address}}{{end}}{{else}}No BTC payout address, the rewards are held for the cudos address{{end}}</p>
+
+<h2>Summary</h2>
+<table>
+<tr><td>Gross reward</td><td class="amount">{{.GrossRewardBtc}} BTC</td></tr>
+<tr><td>Farm maintenance fees</td><td class="amount">{{.FarmMaintenanceFeeBtc}} BTC</td></tr>
+<tr><td>CUDO maintenance fees</td><td class="amount">{{.CUDOMaintenanceFeeBtc}} BTC</td></tr>
+<tr><td>Net reward</td><td class="amount">{{.NetRewardBtc}} BTC</td></tr>
+<tr><td>Held below the payment threshold</td><td class="amount">{{.HeldBtc}} BTC</td></tr>
+<tr><td>Paid in the period</td><td class="amount">{{.PaidBtc}} BTC</td></tr>
+</table>
+{{if .FiatCurrency}}{{$currency := upper .FiatCurrency}}{{with .FiatTotals}}
+<h2>Summary in {{$currency}}</h2>
+<table>
+<tr><td>Gross reward</td><td class="amount">{{.GrossReward.StringFixed 2}} {{$currency}}</td></tr>
+<tr><td>Farm maintenance fees</td><td class="amount">{{.FarmMaintenanceFee.StringFixed 2}} {{$currency}}</td></tr>
+<tr><td>CUDO maintenance fees</td><td class="amount">{{.CUDOMaintenanceFee.StringFixed 2}} {{$currency}}</td></tr>
+<tr><td>Net reward</td><td class="amount">{{.NetReward.StringFixed 2}} {{$currency}}</td></tr>
+<tr><td>Paid in the period</td><td class="amount">{{.Paid.StringFixed 2}} {{$currency}}</td></tr>
+</table>
+{{else}}<p>The {{$currency}} totals are not available, the btc price of some of the payments was not captured.</p>
+{{end}}{{end}}
+
+<h2>NFTs</h2>
+<table>
+<tr><th>Farm payment</th><th>Denom</th><th>Token</th><th>Owned from</th><th>Owned to</th><th>% of period</th><th>Payout address</th><th>Gross reward</th><th>Farm maintenance fee</th><th>CUDO maintenance fee</th><th>Net reward</th><th>BTC price</th><th>Net reward {{upper .FiatCurrency}}</th></tr>
+{{range .Nfts}}<tr><td>{{.FarmPaymentId}}</td><td>{{.DenomId}}</td><td>{{.TokenId}}</td><td>{{date .TimeOwnedFrom}}</td><td>{{date .TimeOwnedTo}}</td><td class="amount">{{printf "%.2f" .PercentOfTimeOwned}}</td><td>{{.PayoutAddress}}</td><td class="amount">{{.GrossRewardBtc}}</td><td class="amount">{{.FarmMaintenanceFeeBtc}}</td><td class="amount">{{.CUDOMaintenanceFeeBtc}}</td><td class="amount">{{.NetRewardBtc}}</td><td class="amount">{{with .BtcPrice}}{{.}}{{end}}</td><td class="amount">{{fiat .NetRewardBtc .BtcPrice}}</td></tr>
+{{else}}<tr><td colspan="13">No NFTs held in the period</td></tr>
+{{end}}</table>
+
+<h2>Held below the payment threshold</h2>
+<table>
+<tr><th>Address</th><th>Farm</th><th>Amount</th></tr>
+{{range .Held}}<tr><td>{{.Address}}</td><td>{{.FarmId}}</td><td class="amount">{{.AmountBtc}}</td></tr>
+{{else}}<tr><td colspan="3">Nothing held</td></tr>
+{{end}}</table>
+
+<h2>Payments</h2>
+<table>
+<tr><th>Paid at</th><th>Farm payment</th><th>Address</th><th>Amount</th><th>BTC price</th><th>Amount {{upper .FiatCurrency}}</th><th>Transaction</th><th>Status</th><th>Replaced by</th><th>Threshold reached in</th></tr>
+{{range .Payments}}<tr><td>{{date .PaidAt}}</td><td>{{.FarmPaymentId}}</td><td>{{.Address}}</td><td class="amount">{{.AmountBtc}}</td><td class="amount">{{with .BtcPrice}}{{.}}{{end}}</td><td class="amount">{{fiat .AmountBtc .BtcPrice}}</td><td>{{.TxHash}}</td><td>{{.Status}}</td><td>{{.ReplacedByTxHash}}</td><td>{{if .CrossFarm}}all farms{{else}}farm{{end}}</td></tr>
+{{else}}<tr><td colspan="10">No payments in the period</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
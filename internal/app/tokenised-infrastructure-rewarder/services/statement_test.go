@@ -0,0 +1,92 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateOwnerStatement(t *testing.T) {
+	from := time.Unix(1000, 0)
+	to := time.Unix(3000, 0)
+
+	storage := &mockStorage{}
+	storage.On("GetNFTStatisticsByOwner", mock.Anything, "cudos1owner", int64(1000), int64(3000)).Return([]types.NFTStatistics{
+		{
+			FarmPaymentId:            1,
+			DenomId:                  "denom_1",
+			TokenId:                  "1",
+			Reward:                   90000001,
+			MaintenanceFee:           7000001,
+			CUDOPartOfMaintenanceFee: 3000000,
+			NFTOwnersForPeriod: []types.NFTOwnerInformation{
+				{TimeOwnedFrom: 0, TimeOwnedTo: 1500, TotalTimeOwned: 1500, PercentOfTimeOwned: 75, Owner: "cudos1other", Reward: 67500001},
+				{TimeOwnedFrom: 1500, TimeOwnedTo: 2000, TotalTimeOwned: 500, PercentOfTimeOwned: 25, Owner: "cudos1owner", Reward: 22500000},
+			},
+		},
+		{
+			FarmPaymentId:            2,
+			DenomId:                  "denom_1",
+			TokenId:                  "1",
+			Reward:                   9000000,
+			MaintenanceFee:           700000,
+			CUDOPartOfMaintenanceFee: 300000,
+			NFTOwnersForPeriod: []types.NFTOwnerInformation{
+				{TimeOwnedFrom: 2000, TimeOwnedTo: 4000, TotalTimeOwned: 2000, PercentOfTimeOwned: 100, Owner: "cudos1owner", PayoutAddress: "owner_btc_address", Reward: 9000000},
+			},
+		},
+	}, nil)
+	storage.On("GetThresholdAmountsByAddress", mock.Anything, "cudos1owner").Return([]types.AddressThresholdAmountByFarm{
+		{BTCAddress: "cudos1owner", FarmId: "1", AmountBTC: "0"},
+	}, nil)
+	storage.On("GetThresholdAmountsByAddress", mock.Anything, "owner_btc_address").Return([]types.AddressThresholdAmountByFarm{
+		{BTCAddress: "owner_btc_address", FarmId: "1", AmountBTC: "0.0009"},
+	}, nil)
+	storage.On("GetPaidDestinationsByAddress", mock.Anything, "cudos1owner", from, to).Return([]types.AddressPayout{}, nil)
+	storage.On("GetPaidDestinationsByAddress", mock.Anything, "owner_btc_address", from, to).Return([]types.AddressPayout{
+		{DestinationAddressWithAmount: types.DestinationAddressWithAmount{FarmPaymentId: 2, Address: "owner_btc_address", AmountBTC: 30600000, TxHash: "tx_hash_2", CrossFarm: true}, Status: types.TransactionCompleted},
+	}, nil)
+
+	storage.On("GetFarmPaymentUTXOTxHash", mock.Anything, int64(1)).Return("utxo_tx_hash_1", nil)
+	storage.On("GetFarmPaymentUTXOTxHash", mock.Anything, int64(2)).Return("utxo_tx_hash_2", nil)
+	storage.On("GetBtcPrice", mock.Anything, types.BtcPriceEventFarmPayment, "utxo_tx_hash_1", "usd").Return(types.BtcPrice{Price: decimal.NewFromInt(20000)}, nil)
+	storage.On("GetBtcPrice", mock.Anything, types.BtcPriceEventFarmPayment, "utxo_tx_hash_2", "usd").Return(types.BtcPrice{Price: decimal.NewFromInt(30000)}, nil)
+	storage.On("GetBtcPrice", mock.Anything, types.BtcPriceEventSendMany, "tx_hash_2", "usd").Return(types.BtcPrice{Price: decimal.NewFromInt(31000)}, nil)
+
+	statement, err := GenerateOwnerStatement(context.Background(), storage, OwnerStatementQuery{Owner: "cudos1owner", From: from, To: to, Currency: "usd"})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"owner_btc_address"}, statement.PayoutAddresses)
+	require.Len(t, statement.Nfts, 2)
+	require.Equal(t, types.Sats(1750000), statement.Nfts[0].FarmMaintenanceFeeBtc)
+	require.Equal(t, types.Sats(750000), statement.Nfts[0].CUDOMaintenanceFeeBtc)
+	require.Equal(t, types.Sats(25000000), statement.Nfts[0].GrossRewardBtc)
+	require.Equal(t, types.Sats(35000000), statement.GrossRewardBtc)
+	require.Equal(t, types.Sats(31500000), statement.NetRewardBtc)
+	require.Equal(t, []StatementHeld{{Address: "owner_btc_address", FarmId: 1, AmountBtc: 90000}}, statement.Held)
+	require.Equal(t, types.Sats(30600000), statement.PaidBtc)
+	require.True(t, statement.Payments[0].CrossFarm)
+	require.NotNil(t, statement.FiatTotals)
+	require.Equal(t, "7200", statement.FiatTotals.NetReward.String())
+	require.Equal(t, "9486", statement.FiatTotals.Paid.String())
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteOwnerStatement(&buf, StatementFormatCSV, statement))
+	require.Contains(t, buf.String(), "cudos1owner,payment,2,,,,,,,owner_btc_address,usd,31000,,,,,,,,,,,,,0.306,30600000,9486.00,tx_hash_2,Completed,")
+	require.Contains(t, buf.String(), "cudos1owner,held,,1,,,,,,owner_btc_address,,,,,,,,,,,,,,,0.0009,90000,,")
+
+	buf.Reset()
+	require.NoError(t, WriteOwnerStatement(&buf, StatementFormatHTML, statement))
+	require.Contains(t, buf.String(), "tx_hash_2")
+	require.Contains(t, buf.String(), "9486.00")
+	require.Contains(t, buf.String(), "<td>all farms</td>")
+
+	_, err = GenerateOwnerStatement(context.Background(), storage, OwnerStatementQuery{Owner: "cudos1owner", From: to, To: from})
+	require.Error(t, err)
+}
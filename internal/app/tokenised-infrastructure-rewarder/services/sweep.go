@@ -0,0 +1,237 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/notifier"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/rs/zerolog/log"
+)
+
+// SweepService pays out the amounts that sit under the payout threshold for too long,
+// e.g. because their owner sold the nfts or the farm stopped producing.
+// It runs on SWEEP_SCHEDULE, separate from the processing of the UTXOs, and spends from the farm wallets the same way the pay service does.
+type SweepService struct {
+	config       *infrastructure.Config
+	helper       InfrastructureHelper
+	alerts       Alerter
+	apiRequester ApiRequester
+	// the wallets are loaded, the interrupted payouts recovered and the prices captured the same way as for the farm payments
+	wallets *farmWallets
+}
+
+func NewSweepService(config *infrastructure.Config, apiRequester ApiRequester, helper InfrastructureHelper, alerts Alerter, btcNetworkParams *types.BtcNetworkParams, secretProvider SecretProvider, priceSource PriceSource) *SweepService {
+	return &SweepService{
+		config:       config,
+		helper:       helper,
+		alerts:       alerts,
+		apiRequester: apiRequester,
+		wallets:      newFarmWallets(config, apiRequester, helper, secretProvider, priceSource),
+	}
+}
+
+func (s *SweepService) Dependencies() []string {
+	return []string{metrics.EndpointBitcoind, metrics.EndpointDb, metrics.EndpointCudosRest}
+}
+
+// Sweeps the aged amounts of all approved farms one by one. Paused farms are skipped.
+// In case of an error while sweeping a farm, the error is logged and alerted and the next farm is swept.
+// The alert is resolved once the farm is swept successfully.
+func (s *SweepService) Execute(ctx context.Context, btcClient BtcClient, storage Storage) error {
+	farms, err := storage.GetApprovedFarms(ctx)
+	if err != nil {
+		return err
+	}
+
+	pausedFarmIds, err := storage.GetPausedFarmIds(ctx)
+	if err != nil {
+		return err
+	}
+
+	pausedFarms := make(map[int64]bool)
+	for _, farmId := range pausedFarmIds {
+		pausedFarms[farmId] = true
+	}
+
+	for _, farm := range farms {
+		if pausedFarms[farm.Id] {
+			log.Info().Msgf("Farm {%s} is paused, skipping its sweep", farm.RewardsFromPoolBtcWalletName)
+			continue
+		}
+
+		if err := s.sweepFarm(ctx, btcClient, storage, farm); err != nil {
+			s.farmFailed(ctx, farm, err)
+			continue
+		}
+
+		s.alerts.Resolve(ctx, sweepAlertSource(farm))
+	}
+
+	return nil
+}
+
+func (s *SweepService) farmFailed(ctx context.Context, farm types.Farm, err error) {
+	msg := fmt.Sprintf("sweeping farm {%s} failed. Error: %s", farm.RewardsFromPoolBtcWalletName, err)
+	log.Error().Msg(msg)
+
+	s.alerts.Fire(ctx, sweepAlertSource(farm), notifier.Notification{
+		Severity: notifier.SeverityWarning,
+		Title:    "Sweeping farm failed",
+		Message:  msg,
+		Farm:     farm.RewardsFromPoolBtcWalletName,
+		Error:    err.Error(),
+	})
+}
+
+func sweepAlertSource(farm types.Farm) string {
+	return fmt.Sprintf("sweep %s", farm.RewardsFromPoolBtcWalletName)
+}
+
+/*
+sweepFarm pays out the aged amounts accumulated in a single farm:
+
+ 1. Validate the farm.
+ 2. Open and load the farm wallet, so it is not used by the pay and retry services until the sweep is finished.
+ 3. Recover the payouts of the farm that were interrupted after sending.
+ 4. Collect the aged amounts. If there are none - nothing is sent.
+ 5. Pay the aged amounts from the farm wallet, see payAccumulatedAmounts.
+    The unprocessed UTXOs of the farm are locked while sending, so the sweep does not spend them.
+*/
+func (s *SweepService) sweepFarm(ctx context.Context, btcClient BtcClient, storage Storage, farm types.Farm) error {
+	log.Debug().Msgf("Sweeping farm with name %s..", farm.RewardsFromPoolBtcWalletName)
+	if err := validateFarm(farm); err != nil {
+		return err
+	}
+
+	walletClient, releaseWallet, err := btcClient.OpenWallet(farm.RewardsFromPoolBtcWalletName)
+	if err != nil {
+		return err
+	}
+	defer releaseWallet()
+
+	loaded, err := s.wallets.prepareWallet(ctx, btcClient, walletClient, storage, farm)
+	if err != nil {
+		return err
+	}
+
+	if !loaded {
+		return nil
+	}
+
+	payload, err := s.sweepPayload(ctx, storage, farm)
+	if err != nil {
+		return err
+	}
+
+	if len(payload.AddressesToSendBtc) == 0 {
+		log.Debug().Msgf("Nothing to sweep for farm {%s}", farm.RewardsFromPoolBtcWalletName)
+		return nil
+	}
+
+	var totalSweptSats types.Sats
+	for _, amount := range payload.AddressesToSendBtc {
+		totalSweptSats += amount
+	}
+
+	txHash, err := s.wallets.payAccumulatedAmounts(ctx, walletClient, storage, farm, "sweep", payload)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msgf("Swept {%s} from farm {%s} to %d addresses with tx {%s}", totalSweptSats, farm.RewardsFromPoolBtcWalletName, len(payload.AddressesToSendBtc), txHash)
+	return nil
+}
+
+/*
+sweepPayload collects the amounts of the farm that are accumulating for longer than SWEEP_MAX_AGE_DAYS.
+
+ 1. The amount of a cudos address is paid to the btc address its owner mapped, together with the amount accumulated for that btc address.
+    The cudos addresses without a mapped btc address can not be paid and keep accumulating.
+ 2. The amounts below SWEEP_DUST_FLOOR_IN_BTC are not worth a transaction output and keep accumulating.
+ 3. The accumulated amounts of every swept address are reset, the same way as when their threshold is reached.
+*/
+func (s *SweepService) sweepPayload(ctx context.Context, storage Storage, farm types.Farm) (types.PayoutIntentPayload, error) {
+	thresholdAmounts, err := storage.GetAccruingAmountsByFarm(ctx, farm.Id)
+	if err != nil {
+		return types.PayoutIntentPayload{}, err
+	}
+
+	now := time.Unix(s.helper.Unix(), 0).UTC()
+	agedBefore := now.AddDate(0, 0, -s.config.SweepMaxAgeDays)
+	dustFloor := s.config.SweepDustFloorInBTC
+
+	amounts := make(map[string]types.Sats)
+	var agedAddresses []string
+	for _, thresholdAmount := range thresholdAmounts {
+		amount, err := types.ParseSats(thresholdAmount.AmountBTC)
+		if err != nil {
+			return types.PayoutIntentPayload{}, err
+		}
+
+		amounts[thresholdAmount.BTCAddress] = amount
+		if amount > 0 && thresholdAmount.AccruingSince != nil && !thresholdAmount.AccruingSince.After(agedBefore) {
+			agedAddresses = append(agedAddresses, thresholdAmount.BTCAddress)
+		}
+	}
+
+	// the cudos addresses are swept first, so the amounts of the btc addresses they are mapped to are swept with them
+	sort.SliceStable(agedAddresses, func(i, j int) bool {
+		return isCudosAddress(agedAddresses[i]) && !isCudosAddress(agedAddresses[j])
+	})
+
+	payload := types.PayoutIntentPayload{
+		FarmSubAccountName:                farm.RewardsFromPoolBtcWalletName,
+		PaymentTimestamp:                  now.Unix(),
+		AddressesToSendBtc:                make(map[string]types.Sats),
+		AddressesWithAmountInfo:           make(map[string]types.AmountInfo),
+		AddressesWithThresholdToUpdateBtc: make(map[string]types.Sats),
+		Sweep:                             true,
+	}
+
+	for _, address := range agedAddresses {
+		if _, swept := payload.AddressesWithThresholdToUpdateBtc[address]; swept {
+			continue
+		}
+
+		addressToSend := address
+		amount := amounts[address]
+		sweptAddresses := []string{address}
+
+		if isCudosAddress(address) {
+			addressToSend, err = s.apiRequester.GetPayoutAddressFromNode(ctx, address, s.config.Network)
+			if err != nil {
+				return types.PayoutIntentPayload{}, err
+			}
+
+			if addressToSend == "" {
+				log.Info().Msgf("No btc address is mapped to {%s}, its amount of {%s} in farm {%s} can not be swept", address, amount, farm.RewardsFromPoolBtcWalletName)
+				continue
+			}
+
+			if _, swept := payload.AddressesWithThresholdToUpdateBtc[addressToSend]; !swept {
+				if btcAddressAmount, ok := amounts[addressToSend]; ok {
+					amount += btcAddressAmount
+					sweptAddresses = append(sweptAddresses, addressToSend)
+				}
+			}
+		}
+
+		if amount < dustFloor {
+			log.Debug().Msgf("Amount {%s} of {%s} in farm {%s} is below the dust floor, it is not swept", amount, address, farm.RewardsFromPoolBtcWalletName)
+			continue
+		}
+
+		for _, sweptAddress := range sweptAddresses {
+			payload.AddressesWithThresholdToUpdateBtc[sweptAddress] = 0
+		}
+		payload.AddressesToSendBtc[addressToSend] += amount
+		payload.AddressesWithAmountInfo[addressToSend] = types.AmountInfo{Amount: payload.AddressesToSendBtc[addressToSend], ThresholdReached: true}
+	}
+
+	return payload, nil
+}
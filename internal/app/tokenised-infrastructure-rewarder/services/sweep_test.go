@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newSweepTestFarm() types.Farm {
+	return types.Farm{
+		Id:                                 1,
+		RewardsFromPoolBtcWalletName:       "farm_1",
+		MaintenanceFeeInBtc:                1,
+		AddressForReceivingRewardsFromPool: "address_for_receiving_reward_from_pool_1",
+		MaintenanceFeePayoutAddress:        "maintenance_fee_address",
+		LeftoverRewardPayoutAddress:        "leftover_reward_address",
+	}
+}
+
+// the mock helper says it is 2022-10-24, the amounts accruing since before 2022-09-24 are aged
+func newSweepTestThresholdAmounts() []types.AddressThresholdAmountByFarm {
+	aged := time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+	fresh := time.Date(2022, 10, 20, 0, 0, 0, 0, time.UTC)
+
+	return []types.AddressThresholdAmountByFarm{
+		{BTCAddress: "btc_owner_address", FarmId: "1", AmountBTC: "0.0002", AccruingSince: &fresh},
+		{BTCAddress: "cudos1aged", FarmId: "1", AmountBTC: "0.001", AccruingSince: &aged},
+		{BTCAddress: "cudos1unmapped", FarmId: "1", AmountBTC: "0.003", AccruingSince: &aged},
+		{BTCAddress: "dust_address", FarmId: "1", AmountBTC: "0.00005", AccruingSince: &aged},
+		{BTCAddress: "fresh_address", FarmId: "1", AmountBTC: "0.05", AccruingSince: &fresh},
+		{BTCAddress: "maintenance_fee_address", FarmId: "1", AmountBTC: "0.002", AccruingSince: &aged},
+	}
+}
+
+func newSweepTestService(apiRequester *mockAPIRequester, alerts *mockAlerter) *SweepService {
+	config := &infrastructure.Config{Network: "cudos-network", SweepMaxAgeDays: 30, SweepDustFloorInBTC: 10000}
+	return NewSweepService(config, apiRequester, &mockHelper{}, alerts, &types.BtcNetworkParams{}, &mockSecretProvider{}, nil)
+}
+
+func TestSweepPayload(t *testing.T) {
+	storage := &mockStorage{}
+	storage.On("GetAccruingAmountsByFarm", mock.Anything, int64(1)).Return(newSweepTestThresholdAmounts(), nil)
+
+	apiRequester := &mockAPIRequester{}
+	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "cudos1aged", "cudos-network").Return("btc_owner_address", nil)
+	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "cudos1unmapped", "cudos-network").Return("", nil)
+
+	payload, err := newSweepTestService(apiRequester, &mockAlerter{}).sweepPayload(context.Background(), storage, newSweepTestFarm())
+	require.NoError(t, err)
+
+	require.True(t, payload.Sweep)
+	require.Equal(t, "farm_1", payload.FarmSubAccountName)
+	require.Equal(t, types.Sats(0), payload.ReceivedRewardBtc)
+
+	// the btc address is swept with the aged cudos address mapped to it, even though its own amount is fresh
+	require.Equal(t, map[string]types.Sats{
+		"btc_owner_address":       120000,
+		"maintenance_fee_address": 200000,
+	}, payload.AddressesToSendBtc)
+	require.Equal(t, map[string]types.AmountInfo{
+		"btc_owner_address":       {Amount: 120000, ThresholdReached: true},
+		"maintenance_fee_address": {Amount: 200000, ThresholdReached: true},
+	}, payload.AddressesWithAmountInfo)
+	require.Equal(t, map[string]types.Sats{
+		"btc_owner_address":       0,
+		"cudos1aged":              0,
+		"maintenance_fee_address": 0,
+	}, payload.AddressesWithThresholdToUpdateBtc)
+}
+
+func TestSweepService_Execute(t *testing.T) {
+	storage := &mockStorage{}
+	storage.On("GetApprovedFarms", mock.Anything).Return([]types.Farm{newSweepTestFarm()}, nil)
+	storage.On("GetPausedFarmIds", mock.Anything).Return([]int64{}, nil)
+	storage.On("GetUnfinishedPayoutIntents", mock.Anything, int64(1)).Return([]types.PayoutIntent{}, nil)
+	storage.On("GetUTXOTransaction", mock.Anything, "change").Return(types.UTXOTransaction{}, sql.ErrNoRows)
+	storage.On("GetAccruingAmountsByFarm", mock.Anything, int64(1)).Return(newSweepTestThresholdAmounts(), nil)
+	storage.On("SavePayoutIntent", mock.Anything, mock.Anything).Return(nil)
+	storage.On("MarkPayoutIntentSent", mock.Anything, mock.Anything, "sweep_tx_hash").Return(nil)
+	storage.On("UpdateThresholdStatus", mock.Anything, mock.Anything, int64(1666641078), map[string]types.Sats{
+		"btc_owner_address":       0,
+		"cudos1aged":              0,
+		"maintenance_fee_address": 0,
+	}, int64(1)).Return(nil)
+	storage.On("SaveStatistics", mock.Anything, types.Sats(0), mock.Anything, map[string]types.AmountInfo{
+		"btc_owner_address":       {Amount: 120000, ThresholdReached: true},
+		"maintenance_fee_address": {Amount: 200000, ThresholdReached: true},
+	}, mock.Anything, "sweep_tx_hash", int64(1), "farm_1").Return(nil)
+
+	apiRequester := &mockAPIRequester{}
+	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "cudos1aged", "cudos-network").Return("btc_owner_address", nil)
+	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "cudos1unmapped", "cudos-network").Return("", nil)
+	apiRequester.On("SendMany", mock.Anything, "farm_1", map[string]types.Sats{
+		"btc_owner_address":       120000,
+		"maintenance_fee_address": 200000,
+	}, mock.Anything).Return("sweep_tx_hash", nil)
+
+	btcClient := &mockBtcClient{}
+	btcClient.On("RawRequest").Return(json.RawMessage(`["farm_1"]`), nil)
+	// the change of the earlier payouts is not a farm payment
+	btcClient.On("ListUnspent").Return([]types.UnspentTx{{TxID: "change", Amount: 100000000, Address: "change_address"}}, nil)
+	btcClient.On("GetBalance").Return(btcutil.Amount(100000000), nil)
+	btcClient.On("WalletPassphrase", "passphrase-farm_1", int64(60)).Return(nil)
+	btcClient.On("WalletLock").Return(nil)
+
+	alerts := &mockAlerter{}
+	require.NoError(t, newSweepTestService(apiRequester, alerts).Execute(context.Background(), btcClient, storage))
+
+	apiRequester.AssertExpectations(t)
+	btcClient.AssertCalled(t, "WalletLock")
+	require.Empty(t, alerts.fired)
+	require.Equal(t, []string{"sweep farm_1"}, alerts.resolved)
+
+	storage.AssertExpectations(t)
+	var intent types.PayoutIntent
+	for _, call := range storage.Calls {
+		if call.Method == "SavePayoutIntent" {
+			intent = call.Arguments.Get(1).(types.PayoutIntent)
+		}
+	}
+	require.True(t, intent.Payload.Sweep)
+	require.Equal(t, intent.IdempotencyKey, intent.UTXOTxHash)
+	require.Equal(t, int64(1), intent.FarmId)
+}
+
+func TestSweepService_LocksUnprocessedUTXOs(t *testing.T) {
+	storage := &mockStorage{}
+	storage.On("GetApprovedFarms", mock.Anything).Return([]types.Farm{newSweepTestFarm()}, nil)
+	storage.On("GetPausedFarmIds", mock.Anything).Return([]int64{}, nil)
+	storage.On("GetUnfinishedPayoutIntents", mock.Anything, int64(1)).Return([]types.PayoutIntent{}, nil)
+	storage.On("GetUTXOTransaction", mock.Anything, "utxo").Return(types.UTXOTransaction{Processed: false}, nil)
+	storage.On("GetAccruingAmountsByFarm", mock.Anything, int64(1)).Return(newSweepTestThresholdAmounts(), nil)
+	storage.On("SavePayoutIntent", mock.Anything, mock.Anything).Return(nil)
+	storage.On("MarkPayoutIntentSent", mock.Anything, mock.Anything, "sweep_tx_hash").Return(nil)
+	storage.On("UpdateThresholdStatus", mock.Anything, mock.Anything, int64(1666641078), mock.Anything, int64(1)).Return(nil)
+	storage.On("SaveStatistics", mock.Anything, types.Sats(0), mock.Anything, mock.Anything, mock.Anything, "sweep_tx_hash", int64(1), "farm_1").Return(nil)
+
+	apiRequester := &mockAPIRequester{}
+	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "cudos1aged", "cudos-network").Return("btc_owner_address", nil)
+	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "cudos1unmapped", "cudos-network").Return("", nil)
+	apiRequester.On("SendMany", mock.Anything, "farm_1", mock.Anything, mock.Anything).Return("sweep_tx_hash", nil)
+
+	btcClient := &mockBtcClient{}
+	btcClient.On("RawRequest").Return(json.RawMessage(`["farm_1"]`), nil)
+	btcClient.On("ListUnspent").Return([]types.UnspentTx{{TxID: "utxo", Vout: 1, Amount: 100000000, Address: "address_for_receiving_reward_from_pool_1"}}, nil)
+	// the unprocessed UTXO and the swept amounts
+	btcClient.On("GetBalance").Return(btcutil.Amount(100320000), nil)
+	btcClient.On("WalletPassphrase", "passphrase-farm_1", int64(60)).Return(nil)
+	btcClient.On("WalletLock").Return(nil)
+
+	alerts := &mockAlerter{}
+	require.NoError(t, newSweepTestService(apiRequester, alerts).Execute(context.Background(), btcClient, storage))
+
+	apiRequester.AssertExpectations(t)
+	require.Empty(t, alerts.fired)
+
+	// the locks left by an interrupted payout are released, then the UTXO is locked while the sweep is sent
+	require.Equal(t, []string{
+		`listwallets []`,
+		`lockunspent [true]`,
+		`lockunspent [false,[{"txid":"utxo","vout":1}]]`,
+		`lockunspent [true,[{"txid":"utxo","vout":1}]]`,
+	}, btcClient.rawRequests)
+}
+
+func TestSweepService_ReservesUnprocessedUTXOs(t *testing.T) {
+	storage := &mockStorage{}
+	storage.On("GetApprovedFarms", mock.Anything).Return([]types.Farm{newSweepTestFarm()}, nil)
+	storage.On("GetPausedFarmIds", mock.Anything).Return([]int64{}, nil)
+	storage.On("GetUnfinishedPayoutIntents", mock.Anything, int64(1)).Return([]types.PayoutIntent{}, nil)
+	storage.On("GetUTXOTransaction", mock.Anything, "utxo").Return(types.UTXOTransaction{Processed: false}, nil)
+	storage.On("GetAccruingAmountsByFarm", mock.Anything, int64(1)).Return(newSweepTestThresholdAmounts(), nil)
+
+	apiRequester := &mockAPIRequester{}
+	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "cudos1aged", "cudos-network").Return("btc_owner_address", nil)
+	apiRequester.On("GetPayoutAddressFromNode", mock.Anything, "cudos1unmapped", "cudos-network").Return("", nil)
+
+	btcClient := &mockBtcClient{}
+	btcClient.On("RawRequest").Return(json.RawMessage(`["farm_1"]`), nil)
+	btcClient.On("ListUnspent").Return([]types.UnspentTx{{TxID: "utxo", Amount: 100000000, Address: "address_for_receiving_reward_from_pool_1"}}, nil)
+	// the swept amounts could only be paid with the unprocessed UTXO
+	btcClient.On("GetBalance").Return(btcutil.Amount(100000000), nil)
+
+	alerts := &mockAlerter{}
+	require.NoError(t, newSweepTestService(apiRequester, alerts).Execute(context.Background(), btcClient, storage))
+
+	apiRequester.AssertNotCalled(t, "SendMany", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	storage.AssertNotCalled(t, "SavePayoutIntent", mock.Anything, mock.Anything)
+	require.Len(t, alerts.fired, 1)
+	require.Contains(t, alerts.fired["sweep farm_1"][0].Error, "without the unprocessed UTXOs")
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"time"
 
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/notifier"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/secrets"
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
 	"github.com/btcsuite/btcd/btcjson"
 	"github.com/btcsuite/btcd/btcutil"
@@ -15,23 +17,32 @@ import (
 )
 
 type CollectionProcessResult struct {
-	CUDOMaintenanceFeeBtcDecimal  decimal.Decimal
-	FarmMaintenanceFeeBtcDecimal  decimal.Decimal
-	NftRewardsAfterFeesBtcDecimal decimal.Decimal
-	CollectionPaymentAllocation   types.CollectionPaymentAllocation
-	NftStatistics                 []types.NFTStatistics
+	CUDOMaintenanceFeeSats      types.Sats
+	FarmMaintenanceFeeSats      types.Sats
+	NftRewardsAfterFeesSats     types.Sats
+	CollectionPaymentAllocation types.CollectionPaymentAllocation
+	NftStatistics               []types.NFTStatistics
 }
 
 type NftProcessResult struct {
-	CudoPartOfMaintenanceFeeBtcDecimal         decimal.Decimal
-	MaintenanceFeeBtcDecimal                   decimal.Decimal
-	RewardForNftAfterFeeBtcDecimal             decimal.Decimal
+	CudoPartOfMaintenanceFeeSats               types.Sats
+	MaintenanceFeeSats                         types.Sats
+	RewardForNftAfterFeeSats                   types.Sats
 	AllNftOwnersForTimePeriodWithRewardPercent map[string]float64
 	NftOwnersForPeriod                         []types.NFTOwnerInformation
 	NftPeriodStart                             int64
 	NftPeriodEnd                               int64
 }
 
+// FarmStatus is the result of the last pay run for a farm
+type FarmStatus struct {
+	FarmId       int64     `json:"farm_id"`
+	FarmName     string    `json:"farm_name"`
+	Paused       bool      `json:"paused"`
+	LastRunAt    time.Time `json:"last_run_at"`
+	LastRunError string    `json:"last_run_error,omitempty"`
+}
+
 type ApiRequester interface {
 	GetChainNftMintTimestamp(ctx context.Context, denomId, tokenId string) (int64, error)
 
@@ -51,11 +62,13 @@ type ApiRequester interface {
 
 	GetFarmCollectionsWithNFTs(ctx context.Context, denomIds []string) ([]types.Collection, error)
 
-	SendMany(ctx context.Context, destinationAddressesWithAmount map[string]float64) (string, error)
+	SendMany(ctx context.Context, walletName string, destinationAddressesWithAmount map[string]types.Sats, comment string) (string, error)
 
-	BumpFee(ctx context.Context, txId string) (string, error)
+	BumpFee(ctx context.Context, walletName, txId string) (string, error)
 
-	GetWalletTransaction(ctx context.Context, txId string) (*types.BtcWalletTransaction, error)
+	GetWalletTransaction(ctx context.Context, walletName, txId string) (*types.BtcWalletTransaction, error)
+
+	ListWalletTransactions(ctx context.Context, walletName string, count, skip int) ([]types.BtcWalletTransaction, error)
 }
 
 type Provider interface {
@@ -66,19 +79,20 @@ type Provider interface {
 type BtcClient interface {
 	LoadWallet(walletName string) (*btcjson.LoadWalletResult, error)
 
-	UnloadWallet(walletName *string) error
-
 	WalletPassphrase(passphrase string, timeoutSecs int64) error
 
 	WalletLock() error
 
 	GetRawTransactionVerbose(txHash *chainhash.Hash) (*btcjson.TxRawResult, error)
 
-	ListUnspent() ([]btcjson.ListUnspentResult, error)
+	ListUnspent() ([]types.UnspentTx, error)
 
 	GetBalance(account string) (btcutil.Amount, error)
 
 	RawRequest(method string, params []json.RawMessage) (json.RawMessage, error)
+
+	// OpenWallet returns a client for the wallet endpoint of the node and holds the wallet lock until release is called
+	OpenWallet(walletName string) (walletClient BtcClient, release func(), err error)
 }
 
 type Storage interface {
@@ -86,12 +100,14 @@ type Storage interface {
 
 	GetPayoutTimesForNFT(ctx context.Context, collectionDenomId, nftId string) ([]types.NFTStatistics, error)
 
-	SaveStatistics(ctx context.Context, receivedRewardForFarmBtcDecimal decimal.Decimal, collectionPaymentAllocationsStatistics []types.CollectionPaymentAllocation, destinationAddressesWithAmount map[string]types.AmountInfo, statistics []types.NFTStatistics, txHash string, farmId int64, farmSubAccountName string) error
+	SaveStatistics(ctx context.Context, receivedRewardForFarm types.Sats, collectionPaymentAllocationsStatistics []types.CollectionPaymentAllocation, destinationAddressesWithAmount map[string]types.AmountInfo, statistics []types.NFTStatistics, txHash string, farmId int64, farmSubAccountName string) error
 
 	GetTxHashesByStatus(ctx context.Context, status string) ([]types.TransactionHashWithStatus, error)
 
 	UpdateTransactionsStatus(ctx context.Context, txHashesToMarkCompleted []string, status string) error
 
+	CompleteTransactions(ctx context.Context, networkFees []types.NetworkFee) error
+
 	SaveTxHashWithStatus(ctx context.Context, txHash, status, farmSubAccountName string, farmPaymentId int64, retryCount int) error
 
 	SaveRBFTransactionInformation(ctx context.Context, oldTxHash, oldTxStatus, newRBFTxHash, newRBFTXStatus, farmSubAccountName string, farmPaymentId int64, retryCount int) error
@@ -100,18 +116,64 @@ type Storage interface {
 
 	GetLastUTXOTransactionByFarmId(ctx context.Context, farmId int64) (types.UTXOTransaction, error)
 
-	GetCurrentAcummulatedAmountForAddress(ctx context.Context, key string, farmId int64) (decimal.Decimal, error)
+	GetCurrentAcummulatedAmountForAddress(ctx context.Context, key string, farmId int64) (types.Sats, error)
 
-	UpdateThresholdStatus(ctx context.Context, processedTransactions string, paymentTimestamp int64, addressesWithThresholdToUpdateBtcDecimal map[string]decimal.Decimal, farmId int64) error
+	UpdateThresholdStatus(ctx context.Context, processedTransactions string, paymentTimestamp int64, addressesWithThresholdToUpdate map[string]types.Sats, farmId int64) error
 
 	SetInitialAccumulatedAmountForAddress(ctx context.Context, address string, farmId int64, amount int) error
 
 	GetFarmAuraPoolCollections(ctx context.Context, farmId int64) ([]types.AuraPoolCollection, error)
+
+	SavePayoutIntent(ctx context.Context, intent types.PayoutIntent) error
+
+	MarkPayoutIntentSent(ctx context.Context, idempotencyKey, txHash string) error
+
+	FinalizePayoutIntent(ctx context.Context, intent types.PayoutIntent, txHash string) error
+
+	RollbackPayoutIntent(ctx context.Context, idempotencyKey string) error
+
+	GetUnfinishedPayoutIntents(ctx context.Context, farmId int64) ([]types.PayoutIntent, error)
+
+	GetPausedFarmIds(ctx context.Context) ([]int64, error)
+
+	GetFarmSchedules(ctx context.Context) ([]types.FarmSchedule, error)
+
+	SaveFarmLastRun(ctx context.Context, farmId int64, lastRunAt time.Time) error
+
+	SaveBtcPrice(ctx context.Context, price types.BtcPrice) error
+
+	GetFarmPayoutThreshold(ctx context.Context, farmId int64) (types.FarmPayoutThreshold, error)
+
+	GetAddressPayoutThreshold(ctx context.Context, address string) (types.AddressPayoutThreshold, error)
+
+	GetAccruingAmountsByFarm(ctx context.Context, farmId int64) ([]types.AddressThresholdAmountByFarm, error)
+
+	GetCudosAddressAccruals(ctx context.Context) ([]types.AddressThresholdAmountByFarm, error)
+
+	GetThresholdAmountsByAddress(ctx context.Context, address string) ([]types.AddressThresholdAmountByFarm, error)
+
+	MoveAccumulatedAmount(ctx context.Context, farmId int64, fromAddress, toAddress string) (types.Sats, error)
+}
+
+// Alerter sends the alerts of the services through the shared alert manager
+type Alerter interface {
+	Fire(ctx context.Context, source string, notification notifier.Notification)
+	Resolve(ctx context.Context, source string)
+}
+
+// SecretProvider resolves the passphrases of the farm wallets
+type SecretProvider interface {
+	WalletPassphrase(walletName string) (*secrets.Secret, error)
+}
+
+// PriceSource tells the price of a bitcoin in fiat currencies at the moment of the payments
+type PriceSource interface {
+	Name() string
+	BtcPrices(ctx context.Context, currencies []string) (map[string]decimal.Decimal, error)
 }
 
 type InfrastructureHelper interface {
 	DaysIn(m time.Month, year int) int
 	Unix() int64
 	Date() (year int, month time.Month, day int)
-	SendMail(message string) error
 }
@@ -1,17 +1,85 @@
 package services
 
-import "github.com/rs/zerolog/log"
+import (
+	"encoding/json"
 
-// unloadWallet attempts to unload the specified Bitcoin wallet (farmName) using the given BTC client.
-// If the wallet fails to unload, an error message is logged. If the wallet is successfully unloaded, a debug
-// message is logged.
-func unloadWallet(btcClient BtcClient, farmName string) {
-	if err := btcClient.UnloadWallet(&farmName); err != nil {
-		log.Error().Msgf("Failed to unload wallet %s: %s", farmName, err)
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/btcsuite/btcd/btcjson"
+	"github.com/rs/zerolog/log"
+)
+
+// isWalletLoaded checks if the wallet is already loaded in the node,
+// loaded wallets stay loaded and are used through their own endpoint.
+func isWalletLoaded(btcClient BtcClient, walletName string) (bool, error) {
+	rawMessage, err := btcClient.RawRequest("listwallets", []json.RawMessage{})
+	if err != nil {
+		return false, err
+	}
+
+	loadedWalletsNames := []string{}
+	if err := json.Unmarshal(rawMessage, &loadedWalletsNames); err != nil {
+		return false, err
+	}
+
+	for _, loadedWalletName := range loadedWalletsNames {
+		if loadedWalletName == walletName {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// lockUnspent locks the outputs of the unspent transactions in the wallet, so the wallet does not spend them, or unlocks them.
+// Unlocking without unspent transactions unlocks all outputs of the wallet.
+// The locks are kept in the memory of the node, they are gone after the node restarts.
+func lockUnspent(btcClient BtcClient, unlock bool, unspentTxs []types.UnspentTx) error {
+	unlockParam, err := json.Marshal(unlock)
+	if err != nil {
+		return err
+	}
+	params := []json.RawMessage{unlockParam}
+
+	if len(unspentTxs) > 0 {
+		outputs := make([]btcjson.TransactionInput, 0, len(unspentTxs))
+		for _, unspentTx := range unspentTxs {
+			outputs = append(outputs, btcjson.TransactionInput{Txid: unspentTx.TxID, Vout: unspentTx.Vout})
+		}
+
+		outputsParam, err := json.Marshal(outputs)
+		if err != nil {
+			return err
+		}
+		params = append(params, outputsParam)
+	}
+
+	_, err = btcClient.RawRequest("lockunspent", params)
+	return err
+}
+
+// unlockUnspent unlocks the UTXOs locked for a payout. If the wallet fails to unlock them, an error message is logged,
+// they stay locked until the wallet is prepared for the next payout.
+func unlockUnspent(btcClient BtcClient, walletName string, unspentTxs []types.UnspentTx) {
+	if err := lockUnspent(btcClient, true, unspentTxs); err != nil {
+		log.Error().Msgf("Failed to unlock the UTXOs of wallet %s: %s", walletName, err)
 		return
 	}
 
-	log.Debug().Msgf("Farm Wallet: {%s} unloaded", farmName)
+	log.Debug().Msgf("UTXOs of wallet {%s} unlocked", walletName)
+}
+
+// unlockWallet unlocks the wallet for 60 seconds with the passphrase from the secret provider.
+// The passphrase is wiped right after, it is never logged or returned in errors.
+func unlockWallet(secretProvider SecretProvider, btcClient BtcClient, walletName string) error {
+	passphrase, err := secretProvider.WalletPassphrase(walletName)
+	if err != nil {
+		return err
+	}
+	defer passphrase.Wipe()
+
+	return passphrase.Use(func(value string) error {
+		return btcClient.WalletPassphrase(value, 60)
+	})
 }
 
 // lockWallet attempts to lock the specified Bitcoin wallet (farmName) using the given BTC client.
@@ -0,0 +1,24 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnlockWallet(t *testing.T) {
+	btcClient := &mockBtcClient{}
+	btcClient.On("WalletPassphrase", "passphrase-farm-1", int64(60)).Return(nil)
+
+	require.NoError(t, unlockWallet(&mockSecretProvider{}, btcClient, "farm-1"))
+	btcClient.AssertExpectations(t)
+}
+
+func TestUnlockWallet_FailsWithoutPassphrase(t *testing.T) {
+	btcClient := &mockBtcClient{}
+
+	err := unlockWallet(&mockSecretProvider{err: errors.New("no passphrase for wallet {farm-1}")}, btcClient, "farm-1")
+	require.EqualError(t, err, "no passphrase for wallet {farm-1}")
+	btcClient.AssertNotCalled(t, "WalletPassphrase")
+}
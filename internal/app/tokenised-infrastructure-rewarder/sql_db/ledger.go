@@ -0,0 +1,509 @@
+package sql_db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/rs/zerolog/log"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	journalFarmPayment = "farm_payment"
+	journalPayout      = "payout"
+	journalNetworkFee  = "network_fee"
+	journalAccrualMove = "accrual_move"
+)
+
+// the accounts that hold what is owed to an address, in the order they are settled
+var accruedAccounts = []string{
+	types.LedgerCudoGeneralFee,
+	types.LedgerCudoMaintenanceFee,
+	types.LedgerFarmLeftover,
+	types.LedgerFarmMaintenance,
+	types.LedgerOwnerAccrued,
+}
+
+func journalName(kind string, reference interface{}) string {
+	return fmt.Sprintf("%s:%v", kind, reference)
+}
+
+/*
+saveLedgerEntries books a farm payment in the ledger, in the db transaction of its statistics.
+
+ 1. The farm payment journal credits the farm income with the received reward
+    and debits the accounts of the addresses it is allocated to. It references the UTXO the reward was received with.
+ 2. The payout journal moves what the threshold update took from the accrued accounts of each address
+    to the paid accounts of the addresses the transaction was sent to. If the transaction pays more or less
+    than what was taken, the journal does not balance and nothing is saved.
+    A sweep receives nothing, so it has only the payout journal.
+*/
+func (tx *DbTx) saveLedgerEntries(ctx context.Context, farmId, farmPaymentId int64, utxoTxHash, txHash string, payload types.PayoutIntentPayload) error {
+	if payload.Sweep {
+		return tx.savePayoutJournal(ctx, farmId, farmPaymentId, txHash, payload)
+	}
+
+	paymentEntries := []types.LedgerEntry{{Account: types.LedgerFarmIncome, AmountBtc: payload.ReceivedRewardBtc.Btc().Neg()}}
+	if len(payload.LedgerAllocations) == 0 {
+		log.Warn().Msgf("No ledger allocations for farm payment {%d}, booking it as accrued to its addresses", farmPaymentId)
+		legacyEntries, err := tx.legacyLedgerEntries(ctx, farmId, payload.AddressesWithThresholdToUpdateBtc, payload.AddressesWithAmountInfo)
+		if err != nil {
+			return err
+		}
+		paymentEntries = append(paymentEntries, legacyEntries...)
+	}
+
+	for _, allocation := range payload.LedgerAllocations {
+		paymentEntries = append(paymentEntries, types.LedgerEntry{Account: allocation.Account, Address: allocation.Address, AmountBtc: allocation.AmountBtc.Btc()})
+	}
+
+	if err := tx.saveJournal(ctx, journalName(journalFarmPayment, farmPaymentId), farmId, farmPaymentId, utxoTxHash, paymentEntries); err != nil {
+		return err
+	}
+
+	return tx.savePayoutJournal(ctx, farmId, farmPaymentId, txHash, payload)
+}
+
+func (tx *DbTx) savePayoutJournal(ctx context.Context, farmId, farmPaymentId int64, txHash string, payload types.PayoutIntentPayload) error {
+	payoutEntries, err := tx.payoutEntries(ctx, farmId, payload.AddressesWithThresholdToUpdateBtc, payload.AddressesWithAmountInfo)
+	if err != nil {
+		return err
+	}
+
+	return tx.saveJournal(ctx, journalName(journalPayout, farmPaymentId), farmId, farmPaymentId, txHash, payoutEntries)
+}
+
+// legacyLedgerEntries allocates the farm payment of an intent saved before the ledger existed, which has no allocations.
+// Each address is allocated what its accumulated amount grows by and what is sent to it, all of it as accrued to the owner of the address.
+func (tx *DbTx) legacyLedgerEntries(ctx context.Context, farmId int64, thresholdsToUpdate map[string]types.Sats, addressesWithAmountInfo map[string]types.AmountInfo) ([]types.LedgerEntry, error) {
+	var entries []types.LedgerEntry
+
+	for _, address := range sortedKeys(thresholdsToUpdate) {
+		balances, err := tx.accruedBalances(ctx, farmId, address)
+		if err != nil {
+			return nil, err
+		}
+
+		amount := thresholdsToUpdate[address].Btc()
+		for _, accountBalance := range balances {
+			amount = amount.Sub(accountBalance)
+		}
+
+		entries = append(entries, types.LedgerEntry{Account: types.LedgerOwnerAccrued, Address: address, AmountBtc: amount})
+	}
+
+	for _, address := range sortedKeys(addressesWithAmountInfo) {
+		if amountInfo := addressesWithAmountInfo[address]; amountInfo.ThresholdReached {
+			entries = append(entries, types.LedgerEntry{Account: types.LedgerOwnerAccrued, Address: address, AmountBtc: amountInfo.Amount.Btc()})
+		}
+	}
+
+	return entries, nil
+}
+
+// payoutEntries debits the paid account of every address the transaction was sent to,
+// and credits the accrued accounts with the difference between their balance and the updated threshold amount
+func (tx *DbTx) payoutEntries(ctx context.Context, farmId int64, thresholdsToUpdate map[string]types.Sats, addressesWithAmountInfo map[string]types.AmountInfo) ([]types.LedgerEntry, error) {
+	var entries []types.LedgerEntry
+
+	for _, address := range sortedKeys(addressesWithAmountInfo) {
+		amountInfo := addressesWithAmountInfo[address]
+		if amountInfo.ThresholdReached && amountInfo.Amount != 0 {
+			entries = append(entries, types.LedgerEntry{Account: types.LedgerAddressPaid, Address: address, AmountBtc: amountInfo.Amount.Btc()})
+		}
+	}
+
+	for _, address := range sortedKeys(thresholdsToUpdate) {
+		balances, err := tx.accruedBalances(ctx, farmId, address)
+		if err != nil {
+			return nil, err
+		}
+
+		var balance decimal.Decimal
+		for _, accountBalance := range balances {
+			balance = balance.Add(accountBalance)
+		}
+
+		taken := balance.Sub(thresholdsToUpdate[address].Btc())
+		if taken.IsNegative() {
+			// the amount accumulated for the btc address of a nft owner is moved to its cudos address
+			entries = append(entries, types.LedgerEntry{Account: types.LedgerOwnerAccrued, Address: address, AmountBtc: taken.Neg()})
+			continue
+		}
+
+		for _, account := range accruedAccounts {
+			if taken.IsZero() {
+				break
+			}
+
+			credit := decimal.Min(balances[account], taken)
+			if !credit.IsPositive() {
+				continue
+			}
+
+			entries = append(entries, types.LedgerEntry{Account: account, Address: address, AmountBtc: credit.Neg()})
+			taken = taken.Sub(credit)
+		}
+	}
+
+	return entries, nil
+}
+
+// GetFarmPaymentLedgerEntries returns the entries of the journal that allocated the farm payment
+func (sdb *SqlDB) GetFarmPaymentLedgerEntries(ctx context.Context, farmPaymentId int64) (_ []types.LedgerEntry, retErr error) {
+	defer metrics.ObserveDbQuery("GetFarmPaymentLedgerEntries", time.Now(), &retErr)
+	entries := []types.LedgerEntry{}
+	if err := sdb.SelectContext(ctx, &entries, selectLedgerEntriesByJournal, journalName(journalFarmPayment, farmPaymentId)); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// GetFarmPaymentUTXOTxHash returns the hash of the UTXO the farm payment was received with, or empty if it is not known.
+// The farm payments booked before their journal referenced the UTXO are found by the payout intent of their transaction.
+func (sdb *SqlDB) GetFarmPaymentUTXOTxHash(ctx context.Context, farmPaymentId int64) (_ string, retErr error) {
+	defer metrics.ObserveDbQuery("GetFarmPaymentUTXOTxHash", time.Now(), &retErr)
+	var utxoTxHashes []string
+	if err := sdb.SelectContext(ctx, &utxoTxHashes, selectFarmPaymentUTXOTxHash, journalName(journalFarmPayment, farmPaymentId), types.LedgerFarmIncome); err != nil {
+		return "", err
+	}
+
+	if len(utxoTxHashes) == 0 || utxoTxHashes[0] == "" {
+		if err := sdb.SelectContext(ctx, &utxoTxHashes, selectPayoutIntentUTXOTxHash, farmPaymentId, types.PayoutIntentCompleted); err != nil {
+			return "", err
+		}
+	}
+
+	if len(utxoTxHashes) == 0 {
+		return "", nil
+	}
+
+	return utxoTxHashes[0], nil
+}
+
+// moveAccruedBalances moves the balance of each accrued account of the address to the same account of the other address
+func (tx *DbTx) moveAccruedBalances(ctx context.Context, farmId int64, fromAddress, toAddress string) error {
+	balances, err := tx.accruedBalances(ctx, farmId, fromAddress)
+	if err != nil {
+		return err
+	}
+
+	var entries []types.LedgerEntry
+	for account, balance := range balances {
+		entries = append(entries,
+			types.LedgerEntry{Account: account, Address: fromAddress, AmountBtc: balance.Neg()},
+			types.LedgerEntry{Account: account, Address: toAddress, AmountBtc: balance},
+		)
+	}
+
+	journal := journalName(journalAccrualMove, fmt.Sprintf("%d:%s:%d", farmId, fromAddress, time.Now().UnixNano()))
+	return tx.saveJournal(ctx, journal, farmId, 0, "", entries)
+}
+
+// accruedBalances returns the balance of each accrued account of the address in the farm
+func (tx *DbTx) accruedBalances(ctx context.Context, farmId int64, address string) (map[string]decimal.Decimal, error) {
+	var entries []types.LedgerEntry
+	if err := tx.SelectContext(ctx, &entries, selectLedgerEntriesByAddress, farmId, address); err != nil {
+		return nil, err
+	}
+
+	balances := make(map[string]decimal.Decimal)
+	for _, entry := range entries {
+		if isAccruedAccount(entry.Account) {
+			balances[entry.Account] = balances[entry.Account].Add(entry.AmountBtc)
+		}
+	}
+
+	return balances, nil
+}
+
+// saveJournal merges the entries of the same account and saves them, if they balance
+func (tx *DbTx) saveJournal(ctx context.Context, journal string, farmId, farmPaymentId int64, txHash string, entries []types.LedgerEntry) error {
+	merged := mergeLedgerEntries(entries)
+	if len(merged) == 0 {
+		return nil
+	}
+
+	var sum decimal.Decimal
+	for _, entry := range merged {
+		sum = sum.Add(entry.AmountBtc)
+	}
+
+	if !sum.IsZero() {
+		return fmt.Errorf("ledger journal {%s} does not balance, it is off by {%s} BTC", journal, sum)
+	}
+
+	now := time.Now().UTC()
+	for _, entry := range merged {
+		if _, err := tx.ExecContext(ctx, insertLedgerEntry, journal, farmId, farmPaymentId, entry.Account, entry.Address, entry.AmountBtc.String(), txHash, now); err != nil {
+			return fmt.Errorf("failed to save ledger journal {%s}: %s", journal, err)
+		}
+	}
+
+	return nil
+}
+
+// mergeLedgerEntries sums the entries by account and address, drops the zero ones and sorts the rest
+func mergeLedgerEntries(entries []types.LedgerEntry) []types.LedgerEntry {
+	amounts := make(map[[2]string]decimal.Decimal)
+	for _, entry := range entries {
+		key := [2]string{entry.Account, entry.Address}
+		amounts[key] = amounts[key].Add(entry.AmountBtc)
+	}
+
+	var merged []types.LedgerEntry
+	for key, amount := range amounts {
+		if !amount.IsZero() {
+			merged = append(merged, types.LedgerEntry{Account: key[0], Address: key[1], AmountBtc: amount})
+		}
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Account != merged[j].Account {
+			return merged[i].Account < merged[j].Account
+		}
+		return merged[i].Address < merged[j].Address
+	})
+
+	return merged
+}
+
+// CompleteTransactions marks the confirmed payout transactions as completed
+// and books their network fees against the income of the farm, in a single db transaction
+func (sdb *SqlDB) CompleteTransactions(ctx context.Context, networkFees []types.NetworkFee) (retErr error) {
+	defer metrics.ObserveDbQuery("CompleteTransactions", time.Now(), &retErr)
+
+	return sdb.ExecuteTx(ctx, func(tx *DbTx) error {
+		for _, networkFee := range networkFees {
+			if err := updateTransactionsStatus(ctx, tx, []string{networkFee.TxHash}, types.TransactionCompleted); err != nil {
+				return err
+			}
+
+			var farmId int64
+			if err := tx.GetContext(ctx, &farmId, selectFarmIdOfFarmPayment, networkFee.FarmPaymentId); err != nil {
+				return fmt.Errorf("failed to get the farm of transaction {%s}: %s", networkFee.TxHash, err)
+			}
+
+			if err := tx.saveJournal(ctx, journalName(journalNetworkFee, networkFee.TxHash), farmId, networkFee.FarmPaymentId, networkFee.TxHash, []types.LedgerEntry{
+				{Account: types.LedgerNetworkFee, AmountBtc: networkFee.FeeBtc.Btc()},
+				{Account: types.LedgerFarmIncome, AmountBtc: networkFee.FeeBtc.Btc().Neg()},
+			}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+/*
+VerifyLedger checks the ledger against itself and against the statistics and returns every problem found.
+
+ 1. The entries of every journal sum up to zero.
+ 2. The farm income credited by every farm payment journal is the amount of the farm payment.
+    Every farm payment after the first one in the ledger has a journal, except the sweeps, which receive nothing.
+ 3. The amounts paid to each address by a payout journal are the amounts sent to it according to the statistics of the farm payment.
+ 4. The balance of the accrued accounts of each address is the amount accumulated for it in the threshold amounts.
+*/
+func (sdb *SqlDB) VerifyLedger(ctx context.Context) (_ []string, retErr error) {
+	defer metrics.ObserveDbQuery("VerifyLedger", time.Now(), &retErr)
+
+	var entries []types.LedgerEntry
+	if err := sdb.SelectContext(ctx, &entries, selectLedgerEntries); err != nil {
+		return nil, err
+	}
+
+	var farmPayments []types.FarmPayment
+	if err := sdb.SelectContext(ctx, &farmPayments, selectFarmPayments); err != nil {
+		return nil, err
+	}
+
+	var sentAmounts []sentAmountRepo
+	if err := sdb.SelectContext(ctx, &sentAmounts, selectSentAmounts); err != nil {
+		return nil, err
+	}
+
+	var thresholdAmounts []types.AddressThresholdAmountByFarm
+	if err := sdb.SelectContext(ctx, &thresholdAmounts, selectThresholdAmounts); err != nil {
+		return nil, err
+	}
+
+	var problems []string
+
+	journalSums := make(map[string]decimal.Decimal)
+	farmIncomeByPayment := make(map[int64]decimal.Decimal)
+	paidByPayment := make(map[int64]map[string]decimal.Decimal)
+	accruedByAddress := make(map[string]decimal.Decimal)
+	firstBookedPaymentId := int64(0)
+
+	for _, entry := range entries {
+		journalSums[entry.Journal] = journalSums[entry.Journal].Add(entry.AmountBtc)
+
+		kind := strings.SplitN(entry.Journal, ":", 2)[0]
+		if kind == journalFarmPayment && entry.Account == types.LedgerFarmIncome {
+			farmIncomeByPayment[entry.FarmPaymentId] = farmIncomeByPayment[entry.FarmPaymentId].Add(entry.AmountBtc.Neg())
+			if firstBookedPaymentId == 0 || entry.FarmPaymentId < firstBookedPaymentId {
+				firstBookedPaymentId = entry.FarmPaymentId
+			}
+		}
+
+		if kind == journalPayout && entry.Account == types.LedgerAddressPaid {
+			addToAddressAmounts(paidByPayment, entry.FarmPaymentId, entry.Address, entry.AmountBtc)
+		}
+
+		if isAccruedAccount(entry.Account) {
+			key := thresholdKey(entry.FarmId, entry.Address)
+			accruedByAddress[key] = accruedByAddress[key].Add(entry.AmountBtc)
+		}
+	}
+
+	for journal, sum := range journalSums {
+		if !sum.IsZero() {
+			problems = append(problems, fmt.Sprintf("journal {%s} does not balance, it is off by {%s} BTC", journal, sum))
+		}
+	}
+
+	sentByPayment := make(map[int64]map[string]decimal.Decimal)
+	for _, sentAmount := range sentAmounts {
+		addToAddressAmounts(sentByPayment, sentAmount.FarmPaymentId, sentAmount.Address, sentAmount.AmountBtc)
+	}
+
+	for _, farmPayment := range farmPayments {
+		farmPaymentId, err := strconv.ParseInt(farmPayment.Id, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		farmIncome, booked := farmIncomeByPayment[farmPaymentId]
+		if !booked && farmPayment.AmountBTC == 0 {
+			problems = append(problems, compareAddressAmounts(fmt.Sprintf("sweep {%d}", farmPaymentId), sentByPayment[farmPaymentId], paidByPayment[farmPaymentId])...)
+			continue
+		}
+
+		if !booked {
+			if firstBookedPaymentId != 0 && farmPaymentId > firstBookedPaymentId {
+				problems = append(problems, fmt.Sprintf("farm payment {%d} is not booked in the ledger", farmPaymentId))
+			}
+			continue
+		}
+
+		if !farmIncome.Equal(farmPayment.AmountBTC.Btc()) {
+			problems = append(problems, fmt.Sprintf("farm payment {%d} received {%s} BTC, but the ledger booked {%s} BTC", farmPaymentId, farmPayment.AmountBTC, farmIncome))
+		}
+
+		problems = append(problems, compareAddressAmounts(fmt.Sprintf("farm payment {%d}", farmPaymentId), sentByPayment[farmPaymentId], paidByPayment[farmPaymentId])...)
+	}
+
+	thresholdByAddress := make(map[string]decimal.Decimal)
+	for _, thresholdAmount := range thresholdAmounts {
+		farmId, err := strconv.ParseInt(thresholdAmount.FarmId, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		amount, err := decimal.NewFromString(thresholdAmount.AmountBTC)
+		if err != nil {
+			return nil, err
+		}
+
+		thresholdByAddress[thresholdKey(farmId, thresholdAmount.BTCAddress)] = amount
+	}
+
+	for key, amount := range thresholdByAddress {
+		if accrued := accruedByAddress[key]; !accrued.Equal(amount) {
+			problems = append(problems, fmt.Sprintf("%s has {%s} BTC accumulated, but the ledger has {%s} BTC accrued", key, amount, accrued))
+		}
+	}
+
+	for key, accrued := range accruedByAddress {
+		if _, ok := thresholdByAddress[key]; !ok && !accrued.IsZero() {
+			problems = append(problems, fmt.Sprintf("%s has no accumulated amount, but the ledger has {%s} BTC accrued", key, accrued))
+		}
+	}
+
+	sort.Strings(problems)
+	return problems, nil
+}
+
+type sentAmountRepo struct {
+	FarmPaymentId int64           `db:"farm_payment_id"`
+	Address       string          `db:"address"`
+	AmountBtc     decimal.Decimal `db:"amount_btc"`
+}
+
+func compareAddressAmounts(farmPayment string, sent, paid map[string]decimal.Decimal) []string {
+	var problems []string
+
+	for address, amount := range sent {
+		if !paid[address].Equal(amount) {
+			problems = append(problems, fmt.Sprintf("%s sent {%s} BTC to address {%s}, but the ledger paid {%s} BTC", farmPayment, amount, address, paid[address]))
+		}
+	}
+
+	for address, amount := range paid {
+		if _, ok := sent[address]; !ok {
+			problems = append(problems, fmt.Sprintf("%s sent nothing to address {%s}, but the ledger paid {%s} BTC", farmPayment, address, amount))
+		}
+	}
+
+	return problems
+}
+
+func addToAddressAmounts(amounts map[int64]map[string]decimal.Decimal, farmPaymentId int64, address string, amount decimal.Decimal) {
+	if amounts[farmPaymentId] == nil {
+		amounts[farmPaymentId] = make(map[string]decimal.Decimal)
+	}
+	amounts[farmPaymentId][address] = amounts[farmPaymentId][address].Add(amount)
+}
+
+func thresholdKey(farmId int64, address string) string {
+	return fmt.Sprintf("farm {%d} address {%s}", farmId, address)
+}
+
+func isAccruedAccount(account string) bool {
+	for _, accruedAccount := range accruedAccounts {
+		if account == accruedAccount {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[T any](values map[string]T) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+const (
+	insertLedgerEntry = `INSERT INTO ledger_entries (journal, farm_id, farm_payment_id, account, address, amount_btc, tx_hash, "createdAt")
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	selectLedgerEntries = `SELECT * FROM ledger_entries ORDER BY id ASC`
+
+	selectLedgerEntriesByJournal = `SELECT * FROM ledger_entries WHERE journal=$1 ORDER BY id ASC`
+
+	selectFarmPaymentUTXOTxHash = `SELECT tx_hash FROM ledger_entries WHERE journal=$1 AND account=$2`
+
+	selectPayoutIntentUTXOTxHash = `SELECT intent.utxo_tx_hash FROM payout_intents intent
+	JOIN statistics_tx_hash_status status ON status.tx_hash=intent.tx_hash WHERE status.farm_payment_id=$1 AND intent.status=$2 ORDER BY status.id ASC`
+
+	selectLedgerEntriesByAddress = `SELECT * FROM ledger_entries WHERE farm_id=$1 AND address=$2 ORDER BY id ASC`
+
+	selectFarmIdOfFarmPayment = `SELECT farm_id FROM farm_payment_statistics WHERE id=$1`
+
+	selectFarmPayments = `SELECT * FROM farm_payment_statistics ORDER BY id ASC`
+
+	selectSentAmounts = `SELECT farm_payment_id, address, amount_btc FROM statistics_destination_addresses_with_amount WHERE threshold_reached=true`
+
+	selectThresholdAmounts = `SELECT * FROM threshold_amounts`
+)
@@ -0,0 +1,272 @@
+package sql_db
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/stretchr/testify/require"
+)
+
+func newLedgerTestSqlDB(t *testing.T) *SqlDB {
+	ctx := context.Background()
+	sdb := newTestSqlDB(t)
+
+	_, err := sdb.MigrateUp(ctx)
+	require.NoError(t, err)
+	require.NoError(t, sdb.SetInitialAccumulatedAmountForAddress(ctx, "owner_address", 1, 0))
+	require.NoError(t, sdb.SetInitialAccumulatedAmountForAddress(ctx, "cudo_fee_address", 1, 0))
+
+	return sdb
+}
+
+// the farm receives 1 BTC, the cudo fee of 0.02 BTC is sent and the rest accumulates for the owner
+func newLedgerTestIntent(sentToCudo types.Sats) types.PayoutIntent {
+	return types.PayoutIntent{
+		IdempotencyKey: "1:utxo_tx_hash",
+		FarmId:         1,
+		UTXOTxHash:     "utxo_tx_hash",
+		Payload: types.PayoutIntentPayload{
+			FarmSubAccountName: "farm_wallet",
+			PaymentTimestamp:   1664999478,
+			ReceivedRewardBtc:  types.SatsPerBtc,
+			AddressesWithAmountInfo: map[string]types.AmountInfo{
+				"cudo_fee_address": {Amount: sentToCudo, ThresholdReached: true},
+				"owner_address":    {Amount: 98000000, ThresholdReached: false},
+			},
+			AddressesWithThresholdToUpdateBtc: map[string]types.Sats{
+				"cudo_fee_address": 0,
+				"owner_address":    98000000,
+			},
+			LedgerAllocations: []types.LedgerAllocation{
+				{Account: types.LedgerCudoGeneralFee, Address: "cudo_fee_address", AmountBtc: 2000000},
+				{Account: types.LedgerOwnerAccrued, Address: "owner_address", AmountBtc: 98000000},
+			},
+		},
+	}
+}
+
+func TestFinalizePayoutIntent_BooksLedger(t *testing.T) {
+	ctx := context.Background()
+	sdb := newLedgerTestSqlDB(t)
+
+	require.NoError(t, sdb.SavePayoutIntent(ctx, newLedgerTestIntent(2000000)))
+	require.NoError(t, sdb.FinalizePayoutIntent(ctx, newLedgerTestIntent(2000000), "payout_tx_hash"))
+
+	var entries []types.LedgerEntry
+	require.NoError(t, sdb.SelectContext(ctx, &entries, selectLedgerEntries))
+
+	balances := make(map[string]string)
+	for _, entry := range entries {
+		balances[entry.Journal+" "+entry.Account+" "+entry.Address] = entry.AmountBtc.String()
+	}
+	require.Equal(t, map[string]string{
+		"farm_payment:1 farm_income ":                      "-1",
+		"farm_payment:1 cudo_general_fee cudo_fee_address": "0.02",
+		"farm_payment:1 owner_accrued owner_address":       "0.98",
+		"payout:1 cudo_general_fee cudo_fee_address":       "-0.02",
+		"payout:1 address_paid cudo_fee_address":           "0.02",
+	}, balances)
+
+	problems, err := sdb.VerifyLedger(ctx)
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	require.NoError(t, sdb.SaveTxHashWithStatus(ctx, "other_tx_hash", types.TransactionPending, "farm_wallet", 1, 0))
+	require.NoError(t, sdb.CompleteTransactions(ctx, []types.NetworkFee{
+		{TxHash: "payout_tx_hash", FarmPaymentId: 1, FeeBtc: 10000},
+	}))
+
+	completed, err := sdb.GetTxHashesByStatus(ctx, types.TransactionCompleted)
+	require.NoError(t, err)
+	require.Len(t, completed, 1)
+	require.Equal(t, "payout_tx_hash", completed[0].TxHash)
+
+	problems, err = sdb.VerifyLedger(ctx)
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	require.EqualError(t, sdb.CompleteTransactions(ctx, []types.NetworkFee{{TxHash: "other_tx_hash", FarmPaymentId: 2}}),
+		"failed to get the farm of transaction {other_tx_hash}: sql: no rows in result set")
+}
+
+func TestFinalizePayoutIntent_Sweep(t *testing.T) {
+	ctx := context.Background()
+	sdb := newLedgerTestSqlDB(t)
+
+	require.NoError(t, sdb.FinalizePayoutIntent(ctx, newLedgerTestIntent(2000000), "payout_tx_hash"))
+
+	accruing, err := sdb.GetAccruingAmountsByFarm(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, accruing, 1)
+	require.Equal(t, "owner_address", accruing[0].BTCAddress)
+	require.NotNil(t, accruing[0].AccruingSince)
+
+	sweep := types.PayoutIntent{
+		IdempotencyKey: "sweep_key",
+		FarmId:         1,
+		UTXOTxHash:     "sweep_key",
+		Payload: types.PayoutIntentPayload{
+			FarmSubAccountName:                "farm_wallet",
+			PaymentTimestamp:                  1667591478,
+			AddressesToSendBtc:                map[string]types.Sats{"owner_address": 98000000},
+			AddressesWithAmountInfo:           map[string]types.AmountInfo{"owner_address": {Amount: 98000000, ThresholdReached: true}},
+			AddressesWithThresholdToUpdateBtc: map[string]types.Sats{"owner_address": 0},
+			Sweep:                             true,
+		},
+	}
+	require.NoError(t, sdb.SavePayoutIntent(ctx, sweep))
+	require.NoError(t, sdb.FinalizePayoutIntent(ctx, sweep, "sweep_tx_hash"))
+
+	accruing, err = sdb.GetAccruingAmountsByFarm(ctx, 1)
+	require.NoError(t, err)
+	require.Empty(t, accruing)
+
+	_, err = sdb.GetUTXOTransaction(ctx, "sweep_key")
+	require.Error(t, err, "a sweep has no utxo to mark as processed")
+
+	lastUTXO, err := sdb.GetLastUTXOTransactionByFarmId(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, "utxo_tx_hash", lastUTXO.TxHash)
+
+	var entries []types.LedgerEntry
+	require.NoError(t, sdb.SelectContext(ctx, &entries, selectLedgerEntriesByJournal, journalName(journalPayout, 2)))
+	require.Len(t, entries, 2)
+	require.Equal(t, types.LedgerAddressPaid, entries[0].Account)
+	require.Equal(t, "0.98", entries[0].AmountBtc.String())
+	require.Equal(t, types.LedgerOwnerAccrued, entries[1].Account)
+	require.Equal(t, "-0.98", entries[1].AmountBtc.String())
+
+	pending, err := sdb.GetTxHashesByStatus(ctx, types.TransactionPending)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+
+	problems, err := sdb.VerifyLedger(ctx)
+	require.NoError(t, err)
+	require.Empty(t, problems)
+}
+
+func TestMoveAccumulatedAmount(t *testing.T) {
+	ctx := context.Background()
+	sdb := newLedgerTestSqlDB(t)
+
+	// the owner has no btc address mapped yet, the amount accumulates for the cudos address
+	intent := newLedgerTestIntent(2000000)
+	intent.Payload.AddressesWithAmountInfo["cudos1owner"] = intent.Payload.AddressesWithAmountInfo["owner_address"]
+	intent.Payload.AddressesWithThresholdToUpdateBtc["cudos1owner"] = intent.Payload.AddressesWithThresholdToUpdateBtc["owner_address"]
+	delete(intent.Payload.AddressesWithAmountInfo, "owner_address")
+	delete(intent.Payload.AddressesWithThresholdToUpdateBtc, "owner_address")
+	intent.Payload.LedgerAllocations[1].Address = "cudos1owner"
+	require.NoError(t, sdb.SetInitialAccumulatedAmountForAddress(ctx, "cudos1owner", 1, 0))
+	require.NoError(t, sdb.FinalizePayoutIntent(ctx, intent, "payout_tx_hash"))
+
+	accruals, err := sdb.GetCudosAddressAccruals(ctx)
+	require.NoError(t, err)
+	require.Len(t, accruals, 1)
+	require.Equal(t, "cudos1owner", accruals[0].BTCAddress)
+	accruingSince := accruals[0].AccruingSince
+
+	moved, err := sdb.MoveAccumulatedAmount(ctx, 1, "cudos1owner", "btc_owner_address")
+	require.NoError(t, err)
+	require.Equal(t, types.Sats(98000000), moved)
+
+	amount, err := sdb.GetCurrentAcummulatedAmountForAddress(ctx, "btc_owner_address", 1)
+	require.NoError(t, err)
+	require.Equal(t, types.Sats(98000000), amount)
+
+	amount, err = sdb.GetCurrentAcummulatedAmountForAddress(ctx, "cudos1owner", 1)
+	require.NoError(t, err)
+	require.Equal(t, types.Sats(0), amount)
+
+	accruing, err := sdb.GetAccruingAmountsByFarm(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, accruing, 1)
+	require.Equal(t, "btc_owner_address", accruing[0].BTCAddress)
+	require.True(t, accruingSince.Equal(*accruing[0].AccruingSince), "the btc address accrues since the cudos address did")
+
+	accruals, err = sdb.GetCudosAddressAccruals(ctx)
+	require.NoError(t, err)
+	require.Empty(t, accruals)
+
+	var entries []types.LedgerEntry
+	require.NoError(t, sdb.SelectContext(ctx, &entries, selectLedgerEntries))
+	moves := make(map[string]string)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Journal, journalAccrualMove) {
+			moves[entry.Account+" "+entry.Address] = entry.AmountBtc.String()
+		}
+	}
+	require.Equal(t, map[string]string{
+		"owner_accrued cudos1owner":       "-0.98",
+		"owner_accrued btc_owner_address": "0.98",
+	}, moves)
+
+	problems, err := sdb.VerifyLedger(ctx)
+	require.NoError(t, err)
+	require.Empty(t, problems)
+
+	// nothing is left to move
+	moved, err = sdb.MoveAccumulatedAmount(ctx, 1, "cudos1owner", "btc_owner_address")
+	require.NoError(t, err)
+	require.Equal(t, types.Sats(0), moved)
+
+	moved, err = sdb.MoveAccumulatedAmount(ctx, 1, "cudos1unknown", "btc_owner_address")
+	require.NoError(t, err)
+	require.Equal(t, types.Sats(0), moved)
+}
+
+func TestFinalizePayoutIntent_UnbalancedPayout(t *testing.T) {
+	ctx := context.Background()
+	sdb := newLedgerTestSqlDB(t)
+
+	// the transaction sends more than the threshold update took from the accrued accounts
+	require.NoError(t, sdb.SavePayoutIntent(ctx, newLedgerTestIntent(3000000)))
+	require.EqualError(t, sdb.FinalizePayoutIntent(ctx, newLedgerTestIntent(3000000), "payout_tx_hash"),
+		"ledger journal {payout:1} does not balance, it is off by {0.01} BTC")
+
+	var entries []types.LedgerEntry
+	require.NoError(t, sdb.SelectContext(ctx, &entries, selectLedgerEntries))
+	require.Empty(t, entries)
+
+	_, err := sdb.GetUTXOTransaction(ctx, "utxo_tx_hash")
+	require.Error(t, err, "nothing of the payout must be saved")
+}
+
+func TestLedger_AppendOnly(t *testing.T) {
+	ctx := context.Background()
+	sdb := newLedgerTestSqlDB(t)
+
+	require.NoError(t, sdb.FinalizePayoutIntent(ctx, newLedgerTestIntent(2000000), "payout_tx_hash"))
+
+	_, err := sdb.ExecContext(ctx, `UPDATE ledger_entries SET amount_btc='0' WHERE account='farm_income'`)
+	require.Error(t, err)
+
+	_, err = sdb.ExecContext(ctx, `DELETE FROM ledger_entries`)
+	require.Error(t, err)
+}
+
+func TestVerifyLedger_Tampered(t *testing.T) {
+	ctx := context.Background()
+	sdb := newLedgerTestSqlDB(t)
+
+	require.NoError(t, sdb.FinalizePayoutIntent(ctx, newLedgerTestIntent(2000000), "payout_tx_hash"))
+
+	_, err := sdb.ExecContext(ctx, `UPDATE threshold_amounts SET amount_btc='1.98' WHERE btc_address='owner_address'`)
+	require.NoError(t, err)
+	_, err = sdb.ExecContext(ctx, `UPDATE farm_payment_statistics SET amount_btc='2' WHERE id=1`)
+	require.NoError(t, err)
+	_, err = sdb.ExecContext(ctx, `UPDATE statistics_destination_addresses_with_amount SET amount_btc='0.01' WHERE address='cudo_fee_address'`)
+	require.NoError(t, err)
+	_, err = sdb.ExecContext(ctx, insertLedgerEntry, "manual", 1, 0, types.LedgerOwnerAccrued, "owner_address", "0.5", "", "2022-10-05")
+	require.NoError(t, err)
+
+	problems, err := sdb.VerifyLedger(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"farm payment {1} received {2} BTC, but the ledger booked {1} BTC",
+		"farm payment {1} sent {0.01} BTC to address {cudo_fee_address}, but the ledger paid {0.02} BTC",
+		"farm {1} address {owner_address} has {1.98} BTC accumulated, but the ledger has {1.48} BTC accrued",
+		"journal {manual} does not balance, it is off by {0.5} BTC",
+	}, problems)
+}
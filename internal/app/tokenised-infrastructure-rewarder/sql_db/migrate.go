@@ -0,0 +1,275 @@
+package sql_db
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The supported db drivers, each has its own migrations with the same versions
+const (
+	DriverPostgres = "postgres"
+	DriverSqlite   = "sqlite3"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is a versioned change of the schema, read from migrations/<driver>/<version>_<name>.up.sql and the matching .down.sql
+type Migration struct {
+	Version int64
+	Name    string
+	up      string
+	down    string
+}
+
+type MigrationStatus struct {
+	Version   int64      `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"appliedAt"`
+}
+
+var migrationsByDriver = map[string][]Migration{
+	DriverPostgres: mustLoadMigrations(DriverPostgres),
+	DriverSqlite:   mustLoadMigrations(DriverSqlite),
+}
+
+// SchemaVersion is the version of the schema this build works with
+func SchemaVersion() int64 {
+	migrations := migrationsByDriver[DriverPostgres]
+	return migrations[len(migrations)-1].Version
+}
+
+func mustLoadMigrations(driverName string) []Migration {
+	loaded, err := loadMigrations(driverName)
+	if err != nil {
+		panic(err)
+	}
+	return loaded
+}
+
+func loadMigrations(driverName string) ([]Migration, error) {
+	dir := path.Join("migrations", driverName)
+	entries, err := migrationFiles.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrationsByVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		parts := strings.SplitN(strings.TrimSuffix(fileName, ".sql"), "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid migration file name {%s}", fileName)
+		}
+
+		version, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid version of migration {%s}", fileName)
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join(dir, fileName))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := migrationsByVersion[version]
+		if !ok {
+			migration = &Migration{Version: version}
+			migrationsByVersion[version] = migration
+		}
+
+		switch {
+		case strings.HasSuffix(parts[1], ".up"):
+			migration.Name = strings.TrimSuffix(parts[1], ".up")
+			migration.up = string(content)
+		case strings.HasSuffix(parts[1], ".down"):
+			migration.down = string(content)
+		default:
+			return nil, fmt.Errorf("migration {%s} is neither up nor down", fileName)
+		}
+	}
+
+	loaded := []Migration{}
+	for _, migration := range migrationsByVersion {
+		if migration.up == "" || migration.down == "" {
+			return nil, fmt.Errorf("migration {%d} must have both an up and a down file", migration.Version)
+		}
+		loaded = append(loaded, *migration)
+	}
+
+	if len(loaded) == 0 {
+		return nil, fmt.Errorf("no migrations found for driver {%s}", driverName)
+	}
+
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].Version < loaded[j].Version })
+	return loaded, nil
+}
+
+/*
+MigrateUp applies all migrations that are not applied yet and returns them.
+
+ 1. Each migration is applied in its own db transaction together with its row in schema_migrations,
+    so a failed migration leaves the schema at the previous version.
+ 2. If two replicas migrate at the same time, the second insert of the same version fails and its migration is rolled back.
+*/
+func (sdb *SqlDB) MigrateUp(ctx context.Context) ([]Migration, error) {
+	migrations, err := sdb.migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	appliedVersions, err := sdb.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []Migration{}
+	for _, migration := range migrations {
+		if _, ok := appliedVersions[migration.Version]; ok {
+			continue
+		}
+
+		if err := sdb.ExecuteTx(ctx, func(tx *DbTx) error {
+			if _, err := tx.ExecContext(ctx, migration.up); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, insertSchemaMigration, migration.Version, migration.Name, time.Now().UTC())
+			return err
+		}); err != nil {
+			return applied, fmt.Errorf("failed to apply migration {%d_%s}: %s", migration.Version, migration.Name, err)
+		}
+
+		applied = append(applied, migration)
+	}
+
+	return applied, nil
+}
+
+// MigrateDown reverts the last steps applied migrations, newest first, and returns them
+func (sdb *SqlDB) MigrateDown(ctx context.Context, steps int) ([]Migration, error) {
+	migrations, err := sdb.migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	appliedVersions, err := sdb.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	reverted := []Migration{}
+	for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := migrations[i]
+		if _, ok := appliedVersions[migration.Version]; !ok {
+			continue
+		}
+
+		if err := sdb.ExecuteTx(ctx, func(tx *DbTx) error {
+			if _, err := tx.ExecContext(ctx, migration.down); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, deleteSchemaMigration, migration.Version)
+			return err
+		}); err != nil {
+			return reverted, fmt.Errorf("failed to revert migration {%d_%s}: %s", migration.Version, migration.Name, err)
+		}
+
+		reverted = append(reverted, migration)
+	}
+
+	return reverted, nil
+}
+
+// MigrationStatus returns all migrations of this build and when they were applied, nil if they are not applied yet
+func (sdb *SqlDB) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := sdb.migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	appliedVersions, err := sdb.appliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []MigrationStatus{}
+	for _, migration := range migrations {
+		status := MigrationStatus{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := appliedVersions[migration.Version]; ok {
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// CheckSchemaVersion fails if the schema is not at the version of this build.
+// It only reads, the schema is changed with the migrate command.
+func (sdb *SqlDB) CheckSchemaVersion(ctx context.Context) error {
+	var version int64
+	if err := sdb.GetContext(ctx, &version, selectSchemaVersion); err != nil {
+		return fmt.Errorf("failed to read schema version, run migrate up: %s", err)
+	}
+
+	if version < SchemaVersion() {
+		return fmt.Errorf("schema version {%d} is older than the required {%d}, run migrate up", version, SchemaVersion())
+	}
+
+	if version > SchemaVersion() {
+		return fmt.Errorf("schema version {%d} is newer than the {%d} supported by this build", version, SchemaVersion())
+	}
+
+	return nil
+}
+
+func (sdb *SqlDB) migrations() ([]Migration, error) {
+	migrations, ok := migrationsByDriver[sdb.DriverName()]
+	if !ok {
+		return nil, fmt.Errorf("no migrations for db driver {%s}", sdb.DriverName())
+	}
+	return migrations, nil
+}
+
+func (sdb *SqlDB) appliedMigrations(ctx context.Context) (map[int64]time.Time, error) {
+	if _, err := sdb.ExecContext(ctx, createSchemaMigrations); err != nil {
+		return nil, fmt.Errorf("failed to create schema_migrations: %s", err)
+	}
+
+	var rows []struct {
+		Version   int64     `db:"version"`
+		AppliedAt time.Time `db:"appliedAt"`
+	}
+	if err := sdb.SelectContext(ctx, &rows, selectSchemaMigrations); err != nil {
+		return nil, err
+	}
+
+	appliedVersions := make(map[int64]time.Time)
+	for _, row := range rows {
+		appliedVersions[row.Version] = row.AppliedAt
+	}
+
+	return appliedVersions, nil
+}
+
+const (
+	createSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		"appliedAt" TIMESTAMP NOT NULL
+	)`
+
+	selectSchemaMigrations = `SELECT version, "appliedAt" FROM schema_migrations ORDER BY version ASC`
+
+	selectSchemaVersion = `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`
+
+	insertSchemaMigration = `INSERT INTO schema_migrations (version, name, "appliedAt") VALUES ($1, $2, $3)`
+
+	deleteSchemaMigration = `DELETE FROM schema_migrations WHERE version=$1`
+)
@@ -0,0 +1,113 @@
+package sql_db
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSqlDB(t *testing.T) *SqlDB {
+	db, err := sqlx.Connect("sqlite3", ":memory:")
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	// every connection to :memory: opens its own empty db
+	db.SetMaxOpenConns(1)
+
+	return NewSqlDB(db)
+}
+
+func TestLoadMigrations(t *testing.T) {
+	postgresMigrations, err := loadMigrations(DriverPostgres)
+	require.NoError(t, err)
+
+	for i, migration := range postgresMigrations {
+		require.Equal(t, int64(i+1), migration.Version, "migration versions must have no gaps")
+		require.NotEmpty(t, migration.Name)
+	}
+	require.Equal(t, postgresMigrations[len(postgresMigrations)-1].Version, SchemaVersion())
+
+	sqliteMigrations, err := loadMigrations(DriverSqlite)
+	require.NoError(t, err)
+	require.Len(t, sqliteMigrations, len(postgresMigrations), "every driver must have the same migrations")
+	for i := range sqliteMigrations {
+		require.Equal(t, postgresMigrations[i].Version, sqliteMigrations[i].Version)
+		require.Equal(t, postgresMigrations[i].Name, sqliteMigrations[i].Name)
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	sdb := newTestSqlDB(t)
+
+	require.EqualError(t, sdb.CheckSchemaVersion(ctx), "failed to read schema version, run migrate up: no such table: schema_migrations")
+
+	applied, err := sdb.MigrateUp(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, len(migrationsByDriver[DriverSqlite]))
+	require.NoError(t, sdb.CheckSchemaVersion(ctx))
+
+	applied, err = sdb.MigrateUp(ctx)
+	require.NoError(t, err)
+	require.Empty(t, applied)
+
+	reverted, err := sdb.MigrateDown(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, reverted, 1)
+	require.Equal(t, SchemaVersion(), reverted[0].Version)
+	require.EqualError(t, sdb.CheckSchemaVersion(ctx), fmt.Sprintf("schema version {%d} is older than the required {%d}, run migrate up", SchemaVersion()-1, SchemaVersion()))
+
+	statuses, err := sdb.MigrationStatus(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, len(migrationsByDriver[DriverSqlite]))
+	require.NotNil(t, statuses[0].AppliedAt)
+	require.Nil(t, statuses[len(statuses)-1].AppliedAt)
+
+	reverted, err = sdb.MigrateDown(ctx, len(migrationsByDriver[DriverSqlite]))
+	require.NoError(t, err)
+	require.Len(t, reverted, len(migrationsByDriver[DriverSqlite])-1)
+
+	var tables []string
+	require.NoError(t, sdb.SelectContext(ctx, &tables, `SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%' ORDER BY name`))
+	require.Equal(t, []string{"schema_migrations"}, tables)
+}
+
+func TestCheckSchemaVersion_NewerSchema(t *testing.T) {
+	ctx := context.Background()
+	sdb := newTestSqlDB(t)
+
+	_, err := sdb.MigrateUp(ctx)
+	require.NoError(t, err)
+	_, err = sdb.ExecContext(ctx, insertSchemaMigration, SchemaVersion()+1, "from_a_newer_build", time.Now().UTC())
+	require.NoError(t, err)
+
+	require.EqualError(t, sdb.CheckSchemaVersion(ctx), fmt.Sprintf("schema version {%d} is newer than the {%d} supported by this build", SchemaVersion()+1, SchemaVersion()))
+}
+
+func TestUniqueConstraints(t *testing.T) {
+	ctx := context.Background()
+	sdb := newTestSqlDB(t)
+
+	_, err := sdb.MigrateUp(ctx)
+	require.NoError(t, err)
+
+	markProcessed := func() error {
+		return sdb.ExecuteTx(ctx, func(tx *DbTx) error {
+			return tx.markUTXOAsProcessed(ctx, "utxo_tx_hash", 1664999478, 1)
+		})
+	}
+	require.NoError(t, markProcessed())
+	require.Error(t, markProcessed(), "an UTXO must be processed only once")
+
+	require.NoError(t, sdb.SetInitialAccumulatedAmountForAddress(ctx, "address", 1, 0))
+	require.Error(t, sdb.SetInitialAccumulatedAmountForAddress(ctx, "address", 1, 0))
+	require.NoError(t, sdb.SetInitialAccumulatedAmountForAddress(ctx, "address", 2, 0))
+
+	require.NoError(t, sdb.SaveTxHashWithStatus(ctx, "tx_hash", "Pending", "farm_wallet", 1, 0))
+	require.Error(t, sdb.SaveTxHashWithStatus(ctx, "tx_hash", "Pending", "farm_wallet", 1, 0))
+}
@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS rbf_transaction_history;
+DROP TABLE IF EXISTS statistics_tx_hash_status;
+DROP TABLE IF EXISTS statistics_destination_addresses_with_amount;
+DROP TABLE IF EXISTS statistics_nft_owners_payout_history;
+DROP TABLE IF EXISTS statistics_nft_payout_history;
+DROP TABLE IF EXISTS collection_payment_allocations;
+DROP TABLE IF EXISTS farm_payment_statistics;
+DROP TABLE IF EXISTS threshold_amounts;
+DROP TABLE IF EXISTS utxo_transactions;
+DROP TABLE IF EXISTS collections;
+DROP TABLE IF EXISTS farms;
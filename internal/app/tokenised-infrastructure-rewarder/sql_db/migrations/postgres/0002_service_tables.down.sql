@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS service_leases;
+DROP TABLE IF EXISTS farm_schedules;
+DROP TABLE IF EXISTS paused_farms;
+DROP INDEX IF EXISTS payout_intents_utxo_tx_hash_active;
+DROP TABLE IF EXISTS payout_intents;
@@ -0,0 +1,37 @@
+-- The tables owned by this service and not by the platform
+
+CREATE TABLE IF NOT EXISTS payout_intents (
+    idempotency_key TEXT PRIMARY KEY,
+    farm_id BIGINT NOT NULL,
+    utxo_tx_hash TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL,
+    tx_hash TEXT NOT NULL DEFAULT '',
+    "createdAt" TIMESTAMP NOT NULL,
+    "updatedAt" TIMESTAMP NOT NULL
+);
+
+-- an UTXO can have only one intent that is not rolled back, which guarantees it is never paid twice
+CREATE UNIQUE INDEX IF NOT EXISTS payout_intents_utxo_tx_hash_active ON payout_intents (utxo_tx_hash) WHERE status <> 'RolledBack';
+
+CREATE TABLE IF NOT EXISTS paused_farms (
+    farm_id BIGINT PRIMARY KEY,
+    "createdAt" TIMESTAMP NOT NULL
+);
+
+-- an empty schedule means that the farm follows the schedule of the pay service
+CREATE TABLE IF NOT EXISTS farm_schedules (
+    farm_id BIGINT PRIMARY KEY,
+    schedule TEXT NOT NULL DEFAULT '',
+    timezone TEXT NOT NULL DEFAULT '',
+    "lastRunAt" TIMESTAMP,
+    "updatedAt" TIMESTAMP NOT NULL
+);
+
+-- the replica that holds the lease is the only one running the workers
+CREATE TABLE IF NOT EXISTS service_leases (
+    name TEXT PRIMARY KEY,
+    holder TEXT NOT NULL,
+    "expiresAt" TIMESTAMP NOT NULL,
+    "updatedAt" TIMESTAMP NOT NULL
+);
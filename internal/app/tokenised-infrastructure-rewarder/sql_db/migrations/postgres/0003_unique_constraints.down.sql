@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS collection_payment_allocations_farm_payment_id_collection_id;
+DROP INDEX IF EXISTS rbf_transaction_history_old_tx_hash;
+DROP INDEX IF EXISTS statistics_tx_hash_status_tx_hash;
+DROP INDEX IF EXISTS threshold_amounts_btc_address_farm_id;
+DROP INDEX IF EXISTS utxo_transactions_tx_hash;
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS ledger_entries_append_only ON ledger_entries;
+DROP FUNCTION IF EXISTS ledger_entries_append_only();
+DROP INDEX IF EXISTS ledger_entries_farm_id_address;
+DROP INDEX IF EXISTS ledger_entries_journal_account_address;
+DROP TABLE IF EXISTS ledger_entries;
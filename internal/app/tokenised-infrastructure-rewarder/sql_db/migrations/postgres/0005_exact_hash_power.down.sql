@@ -0,0 +1,2 @@
+ALTER TABLE collections ALTER COLUMN hashing_power TYPE DOUBLE PRECISION USING hashing_power::DOUBLE PRECISION;
+ALTER TABLE farms ALTER COLUMN total_farm_hashrate TYPE DOUBLE PRECISION USING total_farm_hashrate::DOUBLE PRECISION;
@@ -0,0 +1,4 @@
+-- The hash power of the farms and collections is kept as an exact decimal in TH/s, so the reward shares have no float error.
+
+ALTER TABLE farms ALTER COLUMN total_farm_hashrate TYPE NUMERIC USING total_farm_hashrate::NUMERIC;
+ALTER TABLE collections ALTER COLUMN hashing_power TYPE NUMERIC USING hashing_power::NUMERIC;
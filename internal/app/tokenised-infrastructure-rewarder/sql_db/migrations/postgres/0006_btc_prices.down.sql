@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS btc_prices_event_reference_currency;
+DROP TABLE IF EXISTS btc_prices;
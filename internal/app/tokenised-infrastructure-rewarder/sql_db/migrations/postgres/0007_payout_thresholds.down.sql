@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS address_payout_thresholds;
+DROP TABLE IF EXISTS farm_payout_thresholds;
@@ -0,0 +1,17 @@
+-- The payout thresholds that override GLOBAL_PAYOUT_THRESHOLD_IN_BTC.
+-- The threshold of an address is resolved from the preference of the address, then the override of the farm, then the global default.
+
+-- a farm without a threshold uses the global default, the farm addresses can be paid on every payment regardless of the threshold
+CREATE TABLE IF NOT EXISTS farm_payout_thresholds (
+    farm_id BIGINT PRIMARY KEY,
+    threshold_btc NUMERIC,
+    skip_threshold_for_farm_addresses BOOLEAN NOT NULL DEFAULT FALSE,
+    "updatedAt" TIMESTAMP NOT NULL
+);
+
+-- the threshold the owner of the address picked, in every farm
+CREATE TABLE IF NOT EXISTS address_payout_thresholds (
+    address TEXT PRIMARY KEY,
+    threshold_btc NUMERIC NOT NULL,
+    "updatedAt" TIMESTAMP NOT NULL
+);
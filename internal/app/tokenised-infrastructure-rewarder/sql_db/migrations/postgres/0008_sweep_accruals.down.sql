@@ -0,0 +1 @@
+ALTER TABLE threshold_amounts DROP COLUMN IF EXISTS "accruingSince";
@@ -0,0 +1,5 @@
+-- The time each accumulated amount started accruing, so the sweep can pay the amounts that sit under the payout threshold for too long.
+-- It is empty while nothing is accumulated. The amounts accumulated before are taken as accruing since the row was created.
+ALTER TABLE threshold_amounts ADD COLUMN IF NOT EXISTS "accruingSince" TIMESTAMP;
+
+UPDATE threshold_amounts SET "accruingSince"="createdAt" WHERE amount_btc <> 0;
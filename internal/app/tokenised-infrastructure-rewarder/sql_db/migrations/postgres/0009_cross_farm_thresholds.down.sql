@@ -0,0 +1 @@
+ALTER TABLE statistics_destination_addresses_with_amount DROP COLUMN IF EXISTS cross_farm;
@@ -0,0 +1,134 @@
+-- The tables shared with the aura pool platform, for local development and tests without postgres.
+-- The btc amounts are TEXT, as NUMERIC columns in sqlite would round them to floating point.
+
+CREATE TABLE IF NOT EXISTS farms (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    sub_account_name TEXT NOT NULL,
+    rewards_from_pool_btc_wallet_name TEXT NOT NULL,
+    total_farm_hashrate REAL NOT NULL,
+    address_for_receiving_rewards_from_pool TEXT NOT NULL,
+    leftover_reward_payout_address TEXT NOT NULL,
+    maintenance_fee_payout_address TEXT NOT NULL,
+    maintenance_fee_in_btc REAL NOT NULL,
+    status TEXT NOT NULL,
+    farm_start_time TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS collections (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    farm_id INTEGER NOT NULL,
+    denom_id TEXT NOT NULL,
+    hashing_power REAL NOT NULL,
+    status TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS utxo_transactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    farm_id INTEGER NOT NULL,
+    tx_hash TEXT NOT NULL,
+    payment_timestamp BIGINT NOT NULL,
+    processed BOOLEAN NOT NULL,
+    "createdAt" TIMESTAMP NOT NULL,
+    "updatedAt" TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS threshold_amounts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    btc_address TEXT NOT NULL,
+    farm_id INTEGER NOT NULL,
+    amount_btc TEXT NOT NULL,
+    "createdAt" TIMESTAMP NOT NULL,
+    "updatedAt" TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS farm_payment_statistics (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    farm_id INTEGER NOT NULL,
+    amount_btc TEXT NOT NULL,
+    "createdAt" TIMESTAMP NOT NULL,
+    "updatedAt" TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS collection_payment_allocations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    farm_id INTEGER NOT NULL,
+    farm_payment_id INTEGER NOT NULL,
+    collection_id INTEGER NOT NULL,
+    collection_allocation_amount_btc TEXT NOT NULL,
+    cudo_general_fee_btc TEXT NOT NULL,
+    cudo_maintenance_fee_btc TEXT NOT NULL,
+    farm_unsold_leftover_btc TEXT NOT NULL,
+    farm_maintenance_fee_btc TEXT NOT NULL,
+    "createdAt" TIMESTAMP NOT NULL,
+    "updatedAt" TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS statistics_nft_payout_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    denom_id TEXT NOT NULL,
+    token_id TEXT NOT NULL,
+    farm_payment_id INTEGER NOT NULL,
+    payout_period_start BIGINT NOT NULL,
+    payout_period_end BIGINT NOT NULL,
+    reward TEXT NOT NULL,
+    maintenance_fee TEXT NOT NULL,
+    cudo_part_of_maintenance_fee TEXT NOT NULL,
+    tx_hash TEXT NOT NULL,
+    "createdAt" TIMESTAMP NOT NULL,
+    "updatedAt" TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS statistics_nft_owners_payout_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    time_owned_from BIGINT NOT NULL,
+    time_owned_to BIGINT NOT NULL,
+    total_time_owned BIGINT NOT NULL,
+    percent_of_time_owned REAL NOT NULL,
+    owner TEXT NOT NULL,
+    payout_address TEXT NOT NULL,
+    reward TEXT NOT NULL,
+    nft_payout_history_id INTEGER NOT NULL,
+    farm_payment_id INTEGER NOT NULL,
+    sent BOOLEAN NOT NULL,
+    "createdAt" TIMESTAMP NOT NULL,
+    "updatedAt" TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS statistics_destination_addresses_with_amount (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    address TEXT NOT NULL,
+    amount_btc TEXT NOT NULL,
+    tx_hash TEXT NOT NULL,
+    farm_id INTEGER NOT NULL,
+    farm_payment_id INTEGER NOT NULL,
+    payout_time BIGINT NOT NULL,
+    threshold_reached BOOLEAN NOT NULL,
+    "createdAt" TIMESTAMP NOT NULL,
+    "updatedAt" TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS statistics_tx_hash_status (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    farm_payment_id INTEGER NOT NULL,
+    tx_hash TEXT NOT NULL,
+    status TEXT NOT NULL,
+    time_sent BIGINT NOT NULL,
+    farm_btc_wallet_name TEXT NOT NULL,
+    retry_count INTEGER NOT NULL,
+    "createdAt" TIMESTAMP NOT NULL,
+    "updatedAt" TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS rbf_transaction_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    old_tx_hash TEXT NOT NULL,
+    new_tx_hash TEXT NOT NULL,
+    "createdAt" TIMESTAMP NOT NULL,
+    "updatedAt" TIMESTAMP NOT NULL
+);
@@ -0,0 +1,8 @@
+-- Uniqueness that used to be checked by the service after reading, now enforced by the db.
+-- Creating an index fails if the table already has duplicates, they have to be cleaned up first.
+
+CREATE UNIQUE INDEX IF NOT EXISTS utxo_transactions_tx_hash ON utxo_transactions (tx_hash);
+CREATE UNIQUE INDEX IF NOT EXISTS threshold_amounts_btc_address_farm_id ON threshold_amounts (btc_address, farm_id);
+CREATE UNIQUE INDEX IF NOT EXISTS statistics_tx_hash_status_tx_hash ON statistics_tx_hash_status (tx_hash);
+CREATE UNIQUE INDEX IF NOT EXISTS rbf_transaction_history_old_tx_hash ON rbf_transaction_history (old_tx_hash);
+CREATE UNIQUE INDEX IF NOT EXISTS collection_payment_allocations_farm_payment_id_collection_id ON collection_payment_allocations (farm_payment_id, collection_id);
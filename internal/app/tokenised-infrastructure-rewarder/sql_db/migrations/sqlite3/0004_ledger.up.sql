@@ -0,0 +1,38 @@
+-- The append-only double-entry ledger of every satoshi the service moves.
+-- Debits are positive and credits are negative, so the entries of each journal sum up to zero.
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    journal TEXT NOT NULL,
+    farm_id INTEGER NOT NULL,
+    farm_payment_id INTEGER NOT NULL DEFAULT 0,
+    account TEXT NOT NULL,
+    address TEXT NOT NULL DEFAULT '',
+    amount_btc TEXT NOT NULL,
+    tx_hash TEXT NOT NULL DEFAULT '',
+    "createdAt" TIMESTAMP NOT NULL
+);
+
+-- an account is booked at most once per journal, so a journal can not be written twice
+CREATE UNIQUE INDEX IF NOT EXISTS ledger_entries_journal_account_address ON ledger_entries (journal, account, address);
+CREATE INDEX IF NOT EXISTS ledger_entries_farm_id_address ON ledger_entries (farm_id, address);
+
+CREATE TRIGGER IF NOT EXISTS ledger_entries_no_update BEFORE UPDATE ON ledger_entries
+BEGIN
+    SELECT RAISE(ABORT, 'ledger_entries is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS ledger_entries_no_delete BEFORE DELETE ON ledger_entries
+BEGIN
+    SELECT RAISE(ABORT, 'ledger_entries is append-only');
+END;
+
+-- the amounts accumulated before the ledger existed are opened as accrued to their address, funded by the farm income.
+-- The amounts are negated as text, so they are not rounded to floating point.
+INSERT INTO ledger_entries (journal, farm_id, account, address, amount_btc, "createdAt")
+SELECT 'opening:' || farm_id || ':' || btc_address, farm_id, 'owner_accrued', btc_address, amount_btc, CURRENT_TIMESTAMP
+FROM threshold_amounts WHERE CAST(amount_btc AS REAL) <> 0;
+
+INSERT INTO ledger_entries (journal, farm_id, account, address, amount_btc, "createdAt")
+SELECT 'opening:' || farm_id || ':' || btc_address, farm_id, 'farm_income', '', '-' || amount_btc, CURRENT_TIMESTAMP
+FROM threshold_amounts WHERE CAST(amount_btc AS REAL) <> 0;
@@ -0,0 +1,9 @@
+ALTER TABLE collections ADD COLUMN hashing_power_real REAL NOT NULL DEFAULT 0;
+UPDATE collections SET hashing_power_real = CAST(hashing_power AS REAL);
+ALTER TABLE collections DROP COLUMN hashing_power;
+ALTER TABLE collections RENAME COLUMN hashing_power_real TO hashing_power;
+
+ALTER TABLE farms ADD COLUMN total_farm_hashrate_real REAL NOT NULL DEFAULT 0;
+UPDATE farms SET total_farm_hashrate_real = CAST(total_farm_hashrate AS REAL);
+ALTER TABLE farms DROP COLUMN total_farm_hashrate;
+ALTER TABLE farms RENAME COLUMN total_farm_hashrate_real TO total_farm_hashrate;
@@ -0,0 +1,12 @@
+-- The hash power of the farms and collections is kept as an exact decimal in TH/s, so the reward shares have no float error.
+-- The type of a column can not be changed in sqlite, the REAL columns are replaced by TEXT columns.
+
+ALTER TABLE farms ADD COLUMN total_farm_hashrate_th TEXT NOT NULL DEFAULT '0';
+UPDATE farms SET total_farm_hashrate_th = CAST(total_farm_hashrate AS TEXT);
+ALTER TABLE farms DROP COLUMN total_farm_hashrate;
+ALTER TABLE farms RENAME COLUMN total_farm_hashrate_th TO total_farm_hashrate;
+
+ALTER TABLE collections ADD COLUMN hashing_power_th TEXT NOT NULL DEFAULT '0';
+UPDATE collections SET hashing_power_th = CAST(hashing_power AS TEXT);
+ALTER TABLE collections DROP COLUMN hashing_power;
+ALTER TABLE collections RENAME COLUMN hashing_power_th TO hashing_power;
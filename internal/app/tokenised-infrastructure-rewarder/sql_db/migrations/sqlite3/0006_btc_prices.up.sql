@@ -0,0 +1,15 @@
+-- The price of a bitcoin in fiat currencies, captured when a farm payment is made and when its transaction is sent.
+-- The farm payment prices reference the UTXO of the payment, the send prices the hash of the transaction.
+
+CREATE TABLE IF NOT EXISTS btc_prices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    event TEXT NOT NULL,
+    reference TEXT NOT NULL,
+    farm_id INTEGER NOT NULL,
+    currency TEXT NOT NULL,
+    price TEXT NOT NULL,
+    source TEXT NOT NULL,
+    "capturedAt" TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS btc_prices_event_reference_currency ON btc_prices (event, reference, currency);
@@ -0,0 +1,2 @@
+-- Whether the address was paid because the amounts accumulated for its owner in all farms reached the payout threshold together.
+ALTER TABLE statistics_destination_addresses_with_amount ADD COLUMN cross_farm BOOLEAN NOT NULL DEFAULT 0;
@@ -2,26 +2,62 @@ package sql_db
 
 import (
 	"context"
-	"database/sql"
+	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
-	"github.com/shopspring/decimal"
 )
 
-func (sdb *SqlDB) GetPayoutTimesForNFT(ctx context.Context, collectionDenomId string, nftId string) ([]types.NFTStatistics, error) {
+func (sdb *SqlDB) GetPayoutTimesForNFT(ctx context.Context, collectionDenomId string, nftId string) (_ []types.NFTStatistics, retErr error) {
+	defer metrics.ObserveDbQuery("GetPayoutTimesForNFT", time.Now(), &retErr)
 	var payoutTimes []types.NFTStatisticsRepo
 	if err := sdb.SelectContext(ctx, &payoutTimes, selectNFTPayoutHistory, collectionDenomId, nftId); err != nil {
 		return nil, err
 	}
 
+	return parseNFTStatistics(payoutTimes)
+}
+
+// GetNFTStatisticsByFarmPayment returns the statistics of the nfts paid by the farm payment, together with their owners
+func (sdb *SqlDB) GetNFTStatisticsByFarmPayment(ctx context.Context, farmPaymentId int64) (_ []types.NFTStatistics, retErr error) {
+	defer metrics.ObserveDbQuery("GetNFTStatisticsByFarmPayment", time.Now(), &retErr)
+	var payoutTimes []types.NFTStatisticsRepo
+	if err := sdb.SelectContext(ctx, &payoutTimes, selectNFTPayoutHistoryByFarmPayment, farmPaymentId); err != nil {
+		return nil, err
+	}
+
+	var owners []nftOwnerInformationWithPayoutHistoryRepo
+	if err := sdb.SelectContext(ctx, &owners, selectNFTOwnersPayoutHistoryByFarmPayment, farmPaymentId); err != nil {
+		return nil, err
+	}
+
+	ownersByPayoutHistoryId := make(map[string][]types.NFTOwnerInformationRepo)
+	for _, owner := range owners {
+		ownersByPayoutHistoryId[owner.NftPayoutHistoryId] = append(ownersByPayoutHistoryId[owner.NftPayoutHistoryId], owner.NFTOwnerInformationRepo)
+	}
+
+	for i := range payoutTimes {
+		payoutTimes[i].NFTOwnersForPeriod = ownersByPayoutHistoryId[payoutTimes[i].Id]
+	}
+
+	return parseNFTStatistics(payoutTimes)
+}
+
+type nftOwnerInformationWithPayoutHistoryRepo struct {
+	types.NFTOwnerInformationRepo
+	NftPayoutHistoryId string `db:"nft_payout_history_id"`
+}
+
+func parseNFTStatistics(payoutTimes []types.NFTStatisticsRepo) ([]types.NFTStatistics, error) {
 	var payoutTimesParsed []types.NFTStatistics
 
 	for _, payoutTimeRepo := range payoutTimes {
 		var ownerInfos []types.NFTOwnerInformation
 
 		for _, ownerInfoRepo := range payoutTimeRepo.NFTOwnersForPeriod {
-			rewardBtcDecimal, err := decimal.NewFromString(ownerInfoRepo.Reward)
+			reward, err := types.ParseSats(ownerInfoRepo.Reward)
 			if err != nil {
 				return nil, err
 			}
@@ -32,7 +68,7 @@ func (sdb *SqlDB) GetPayoutTimesForNFT(ctx context.Context, collectionDenomId st
 				PercentOfTimeOwned: ownerInfoRepo.PercentOfTimeOwned,
 				Owner:              ownerInfoRepo.Owner,
 				PayoutAddress:      ownerInfoRepo.PayoutAddress,
-				Reward:             rewardBtcDecimal,
+				Reward:             reward,
 				CreatedAt:          ownerInfoRepo.CreatedAt,
 				UpdatedAt:          ownerInfoRepo.UpdatedAt,
 			}
@@ -40,17 +76,17 @@ func (sdb *SqlDB) GetPayoutTimesForNFT(ctx context.Context, collectionDenomId st
 			ownerInfos = append(ownerInfos, parsedInfo)
 		}
 
-		rewardBtcDecimal, err := decimal.NewFromString(payoutTimeRepo.Reward)
+		reward, err := types.ParseSats(payoutTimeRepo.Reward)
 		if err != nil {
 			return nil, err
 		}
 
-		maintenanceFeeBtcDecimal, err := decimal.NewFromString(payoutTimeRepo.MaintenanceFee)
+		maintenanceFee, err := types.ParseSats(payoutTimeRepo.MaintenanceFee)
 		if err != nil {
 			return nil, err
 		}
 
-		cudoPartOfFeeBtcDecimal, err := decimal.NewFromString(payoutTimeRepo.CUDOPartOfMaintenanceFee)
+		cudoPartOfFee, err := types.ParseSats(payoutTimeRepo.CUDOPartOfMaintenanceFee)
 		if err != nil {
 			return nil, err
 		}
@@ -58,11 +94,12 @@ func (sdb *SqlDB) GetPayoutTimesForNFT(ctx context.Context, collectionDenomId st
 			Id:                       payoutTimeRepo.Id,
 			TokenId:                  payoutTimeRepo.TokenId,
 			DenomId:                  payoutTimeRepo.DenomId,
+			FarmPaymentId:            payoutTimeRepo.FarmPaymentId,
 			PayoutPeriodStart:        payoutTimeRepo.PayoutPeriodStart,
 			PayoutPeriodEnd:          payoutTimeRepo.PayoutPeriodEnd,
-			Reward:                   rewardBtcDecimal,
-			MaintenanceFee:           maintenanceFeeBtcDecimal,
-			CUDOPartOfMaintenanceFee: cudoPartOfFeeBtcDecimal,
+			Reward:                   reward,
+			MaintenanceFee:           maintenanceFee,
+			CUDOPartOfMaintenanceFee: cudoPartOfFee,
 			NFTOwnersForPeriod:       ownerInfos,
 			TxHash:                   payoutTimeRepo.TxHash,
 			CreatedAt:                payoutTimeRepo.CreatedAt,
@@ -75,7 +112,76 @@ func (sdb *SqlDB) GetPayoutTimesForNFT(ctx context.Context, collectionDenomId st
 	return payoutTimesParsed, nil
 }
 
-func (sdb *SqlDB) GetApprovedFarms(ctx context.Context) ([]types.Farm, error) {
+// GetUnfinishedPayoutIntents returns the intents of the farm that were saved, but their bookkeeping was never finished
+func (sdb *SqlDB) GetUnfinishedPayoutIntents(ctx context.Context, farmId int64) (_ []types.PayoutIntent, retErr error) {
+	defer metrics.ObserveDbQuery("GetUnfinishedPayoutIntents", time.Now(), &retErr)
+	var intentsRepo []types.PayoutIntentRepo
+	if err := sdb.SelectContext(ctx, &intentsRepo, selectUnfinishedPayoutIntents, farmId, types.PayoutIntentPending, types.PayoutIntentSent); err != nil {
+		return nil, err
+	}
+
+	intents := []types.PayoutIntent{}
+	for _, intentRepo := range intentsRepo {
+		var payload types.PayoutIntentPayload
+		if err := json.Unmarshal([]byte(intentRepo.Payload), &payload); err != nil {
+			return nil, fmt.Errorf("invalid payload for payout intent {%s}: %s", intentRepo.IdempotencyKey, err)
+		}
+
+		intents = append(intents, types.PayoutIntent{
+			IdempotencyKey: intentRepo.IdempotencyKey,
+			FarmId:         intentRepo.FarmId,
+			UTXOTxHash:     intentRepo.UTXOTxHash,
+			Payload:        payload,
+			Status:         intentRepo.Status,
+			TxHash:         intentRepo.TxHash,
+			CreatedAt:      intentRepo.CreatedAt,
+			UpdatedAt:      intentRepo.UpdatedAt,
+		})
+	}
+
+	return intents, nil
+}
+
+func (sdb *SqlDB) GetPausedFarmIds(ctx context.Context) (_ []int64, retErr error) {
+	defer metrics.ObserveDbQuery("GetPausedFarmIds", time.Now(), &retErr)
+	farmIds := []int64{}
+	if err := sdb.SelectContext(ctx, &farmIds, selectPausedFarmIds); err != nil {
+		return nil, err
+	}
+	return farmIds, nil
+}
+
+func (sdb *SqlDB) GetFarmSchedules(ctx context.Context) (_ []types.FarmSchedule, retErr error) {
+	defer metrics.ObserveDbQuery("GetFarmSchedules", time.Now(), &retErr)
+	farmSchedules := []types.FarmSchedule{}
+	if err := sdb.SelectContext(ctx, &farmSchedules, selectFarmSchedules); err != nil {
+		return nil, err
+	}
+	return farmSchedules, nil
+}
+
+// GetFarmPayoutThreshold returns the payout threshold override of the farm, sql.ErrNoRows if the farm has none
+func (sdb *SqlDB) GetFarmPayoutThreshold(ctx context.Context, farmId int64) (_ types.FarmPayoutThreshold, retErr error) {
+	defer metrics.ObserveDbQuery("GetFarmPayoutThreshold", time.Now(), &retErr)
+	var threshold types.FarmPayoutThreshold
+	if err := sdb.GetContext(ctx, &threshold, selectFarmPayoutThreshold, farmId); err != nil {
+		return types.FarmPayoutThreshold{}, err
+	}
+	return threshold, nil
+}
+
+// GetAddressPayoutThreshold returns the payout threshold the owner of the address picked, sql.ErrNoRows if they picked none
+func (sdb *SqlDB) GetAddressPayoutThreshold(ctx context.Context, address string) (_ types.AddressPayoutThreshold, retErr error) {
+	defer metrics.ObserveDbQuery("GetAddressPayoutThreshold", time.Now(), &retErr)
+	var threshold types.AddressPayoutThreshold
+	if err := sdb.GetContext(ctx, &threshold, selectAddressPayoutThreshold, address); err != nil {
+		return types.AddressPayoutThreshold{}, err
+	}
+	return threshold, nil
+}
+
+func (sdb *SqlDB) GetApprovedFarms(ctx context.Context) (_ []types.Farm, retErr error) {
+	defer metrics.ObserveDbQuery("GetApprovedFarms", time.Now(), &retErr)
 	farms := []types.Farm{}
 	if err := sdb.SelectContext(ctx, &farms, selectApprovedFarms); err != nil {
 		return nil, err
@@ -83,7 +189,8 @@ func (sdb *SqlDB) GetApprovedFarms(ctx context.Context) ([]types.Farm, error) {
 	return farms, nil
 }
 
-func (sdb *SqlDB) GetTxHashesByStatus(ctx context.Context, status string) ([]types.TransactionHashWithStatus, error) {
+func (sdb *SqlDB) GetTxHashesByStatus(ctx context.Context, status string) (_ []types.TransactionHashWithStatus, retErr error) {
+	defer metrics.ObserveDbQuery("GetTxHashesByStatus", time.Now(), &retErr)
 	txHashesWithStatus := []types.TransactionHashWithStatus{}
 	if err := sdb.SelectContext(ctx, &txHashesWithStatus, selectTxHashStatus, status); err != nil {
 		return nil, err
@@ -91,37 +198,30 @@ func (sdb *SqlDB) GetTxHashesByStatus(ctx context.Context, status string) ([]typ
 	return txHashesWithStatus, nil
 }
 
-func (sdb *SqlDB) GetCurrentAcummulatedAmountForAddress(ctx context.Context, address string, farmId int64) (decimal.Decimal, error) {
-	var result []types.AddressThresholdAmountByFarm
-	if err := sdb.SelectContext(ctx, &result, selectThresholdByAddress, address, farmId); err != nil {
-		return decimal.Zero, err
+// GetCurrentAcummulatedAmountForAddress returns sql.ErrNoRows if nothing is accumulated for the address in the farm yet
+func (sdb *SqlDB) GetCurrentAcummulatedAmountForAddress(ctx context.Context, address string, farmId int64) (_ types.Sats, retErr error) {
+	defer metrics.ObserveDbQuery("GetCurrentAcummulatedAmountForAddress", time.Now(), &retErr)
+	var result types.AddressThresholdAmountByFarm
+	if err := sdb.GetContext(ctx, &result, selectThresholdByAddress, address, farmId); err != nil {
+		return 0, err
 	}
 
-	if len(result) > 1 {
-		return decimal.Zero, fmt.Errorf("more then one threshold address for farm! Address: %s, FarmId: %d", address, farmId)
-	} else if len(result) == 0 {
-		return decimal.Zero, sql.ErrNoRows
-	}
-
-	return decimal.NewFromString(result[0].AmountBTC)
+	return types.ParseSats(result.AmountBTC)
 }
 
-func (sdb *SqlDB) GetUTXOTransaction(ctx context.Context, txHash string) (types.UTXOTransaction, error) {
-	var result []types.UTXOTransaction
-	if err := sdb.SelectContext(ctx, &result, selectUTXOById, txHash); err != nil {
+// GetUTXOTransaction returns sql.ErrNoRows if the UTXO was never processed
+func (sdb *SqlDB) GetUTXOTransaction(ctx context.Context, txHash string) (_ types.UTXOTransaction, retErr error) {
+	defer metrics.ObserveDbQuery("GetUTXOTransaction", time.Now(), &retErr)
+	var result types.UTXOTransaction
+	if err := sdb.GetContext(ctx, &result, selectUTXOById, txHash); err != nil {
 		return types.UTXOTransaction{}, err
 	}
 
-	if len(result) > 1 {
-		return types.UTXOTransaction{}, fmt.Errorf("tx_hash with %s is duplicated in table utxo_transactions", txHash)
-	} else if len(result) == 0 {
-		return types.UTXOTransaction{}, sql.ErrNoRows
-	}
-
-	return result[0], nil
+	return result, nil
 }
 
-func (sdb *SqlDB) GetLastUTXOTransactionByFarmId(ctx context.Context, farmId int64) (types.UTXOTransaction, error) {
+func (sdb *SqlDB) GetLastUTXOTransactionByFarmId(ctx context.Context, farmId int64) (_ types.UTXOTransaction, retErr error) {
+	defer metrics.ObserveDbQuery("GetLastUTXOTransactionByFarmId", time.Now(), &retErr)
 	var result []types.UTXOTransaction
 	if err := sdb.SelectContext(ctx, &result, selectUTXOByFarmId, farmId); err != nil {
 		return types.UTXOTransaction{}, err
@@ -134,7 +234,57 @@ func (sdb *SqlDB) GetLastUTXOTransactionByFarmId(ctx context.Context, farmId int
 	return result[0], nil
 }
 
-func (sdb *SqlDB) GetFarmAuraPoolCollections(ctx context.Context, farmId int64) ([]types.AuraPoolCollection, error) {
+func (sdb *SqlDB) GetFarmPayment(ctx context.Context, farmPaymentId int64) (_ types.FarmPayment, retErr error) {
+	defer metrics.ObserveDbQuery("GetFarmPayment", time.Now(), &retErr)
+	var farmPayment types.FarmPayment
+	if err := sdb.GetContext(ctx, &farmPayment, selectFarmPaymentById, farmPaymentId); err != nil {
+		return types.FarmPayment{}, err
+	}
+	return farmPayment, nil
+}
+
+func (sdb *SqlDB) GetCollectionPaymentAllocations(ctx context.Context, farmPaymentId int64) (_ []types.CollectionPaymentAllocation, retErr error) {
+	defer metrics.ObserveDbQuery("GetCollectionPaymentAllocations", time.Now(), &retErr)
+	allocations := []types.CollectionPaymentAllocation{}
+	if err := sdb.SelectContext(ctx, &allocations, selectCollectionPaymentAllocations, farmPaymentId); err != nil {
+		return nil, err
+	}
+	return allocations, nil
+}
+
+// GetThresholdAmountsByAddress returns the amounts accumulated for the address in all farms
+func (sdb *SqlDB) GetThresholdAmountsByAddress(ctx context.Context, address string) (_ []types.AddressThresholdAmountByFarm, retErr error) {
+	defer metrics.ObserveDbQuery("GetThresholdAmountsByAddress", time.Now(), &retErr)
+	thresholdAmounts := []types.AddressThresholdAmountByFarm{}
+	if err := sdb.SelectContext(ctx, &thresholdAmounts, selectThresholdsByAddress, address); err != nil {
+		return nil, err
+	}
+	return thresholdAmounts, nil
+}
+
+// GetAccruingAmountsByFarm returns the amounts accumulated in the farm that are not paid out yet, ordered by address
+func (sdb *SqlDB) GetAccruingAmountsByFarm(ctx context.Context, farmId int64) (_ []types.AddressThresholdAmountByFarm, retErr error) {
+	defer metrics.ObserveDbQuery("GetAccruingAmountsByFarm", time.Now(), &retErr)
+	thresholdAmounts := []types.AddressThresholdAmountByFarm{}
+	if err := sdb.SelectContext(ctx, &thresholdAmounts, selectAccruingThresholdsByFarm, farmId); err != nil {
+		return nil, err
+	}
+	return thresholdAmounts, nil
+}
+
+// GetCudosAddressAccruals returns the amounts accumulated for cudos addresses in all farms, ordered by farm and address.
+// The owners of the cudos addresses had no btc address mapped when the amounts were accumulated.
+func (sdb *SqlDB) GetCudosAddressAccruals(ctx context.Context) (_ []types.AddressThresholdAmountByFarm, retErr error) {
+	defer metrics.ObserveDbQuery("GetCudosAddressAccruals", time.Now(), &retErr)
+	thresholdAmounts := []types.AddressThresholdAmountByFarm{}
+	if err := sdb.SelectContext(ctx, &thresholdAmounts, selectCudosAddressAccruals); err != nil {
+		return nil, err
+	}
+	return thresholdAmounts, nil
+}
+
+func (sdb *SqlDB) GetFarmAuraPoolCollections(ctx context.Context, farmId int64) (_ []types.AuraPoolCollection, retErr error) {
+	defer metrics.ObserveDbQuery("GetFarmAuraPoolCollections", time.Now(), &retErr)
 	collections := []types.AuraPoolCollection{}
 	if err := sdb.SelectContext(ctx, &collections, selectFarmCollections, farmId); err != nil {
 		return nil, err
@@ -142,10 +292,128 @@ func (sdb *SqlDB) GetFarmAuraPoolCollections(ctx context.Context, farmId int64)
 	return collections, nil
 }
 
+// GetFarmPaymentIdsByDate returns the ids of the farm payments created in [from, to)
+func (sdb *SqlDB) GetFarmPaymentIdsByDate(ctx context.Context, from, to time.Time) (_ []int64, retErr error) {
+	defer metrics.ObserveDbQuery("GetFarmPaymentIdsByDate", time.Now(), &retErr)
+	farmPaymentIds := []int64{}
+	if err := sdb.SelectContext(ctx, &farmPaymentIds, selectFarmPaymentIdsByDate, from.UTC(), to.UTC()); err != nil {
+		return nil, err
+	}
+	return farmPaymentIds, nil
+}
+
+func (sdb *SqlDB) GetDestinationAddressesByFarmPayment(ctx context.Context, farmPaymentId int64) (_ []types.DestinationAddressWithAmount, retErr error) {
+	defer metrics.ObserveDbQuery("GetDestinationAddressesByFarmPayment", time.Now(), &retErr)
+	destinations := []types.DestinationAddressWithAmount{}
+	if err := sdb.SelectContext(ctx, &destinations, selectDestinationAddressesByFarmPayment, farmPaymentId); err != nil {
+		return nil, err
+	}
+	return destinations, nil
+}
+
+// GetTxHashesByFarmPayment returns the transactions that paid out the farm payment, the replacements included
+func (sdb *SqlDB) GetTxHashesByFarmPayment(ctx context.Context, farmPaymentId int64) (_ []types.TransactionHashWithStatus, retErr error) {
+	defer metrics.ObserveDbQuery("GetTxHashesByFarmPayment", time.Now(), &retErr)
+	txHashesWithStatus := []types.TransactionHashWithStatus{}
+	if err := sdb.SelectContext(ctx, &txHashesWithStatus, selectTxHashStatusByFarmPayment, farmPaymentId); err != nil {
+		return nil, err
+	}
+	return txHashesWithStatus, nil
+}
+
+// GetRBFTransactionsByFarmPayment returns the replacements of the transactions of the farm payment
+func (sdb *SqlDB) GetRBFTransactionsByFarmPayment(ctx context.Context, farmPaymentId int64) (_ []types.RBFTransactionHistory, retErr error) {
+	defer metrics.ObserveDbQuery("GetRBFTransactionsByFarmPayment", time.Now(), &retErr)
+	rbfTransactions := []types.RBFTransactionHistory{}
+	if err := sdb.SelectContext(ctx, &rbfTransactions, selectRBFTransactionsByFarmPayment, farmPaymentId); err != nil {
+		return nil, err
+	}
+	return rbfTransactions, nil
+}
+
+// GetNFTStatisticsByOwner returns the statistics of the nfts the owner held in [from, to), in unix seconds.
+// Every nft comes with all of its owners for the payout period, not only with the given owner.
+func (sdb *SqlDB) GetNFTStatisticsByOwner(ctx context.Context, owner string, from, to int64) (_ []types.NFTStatistics, retErr error) {
+	defer metrics.ObserveDbQuery("GetNFTStatisticsByOwner", time.Now(), &retErr)
+	var payoutTimes []types.NFTStatisticsRepo
+	if err := sdb.SelectContext(ctx, &payoutTimes, selectNFTPayoutHistoryByOwner, owner, from, to); err != nil {
+		return nil, err
+	}
+
+	var owners []nftOwnerInformationWithPayoutHistoryRepo
+	if err := sdb.SelectContext(ctx, &owners, selectNFTOwnersPayoutHistoryByOwner, owner, from, to); err != nil {
+		return nil, err
+	}
+
+	ownersByPayoutHistoryId := make(map[string][]types.NFTOwnerInformationRepo)
+	for _, owner := range owners {
+		ownersByPayoutHistoryId[owner.NftPayoutHistoryId] = append(ownersByPayoutHistoryId[owner.NftPayoutHistoryId], owner.NFTOwnerInformationRepo)
+	}
+
+	for i := range payoutTimes {
+		payoutTimes[i].NFTOwnersForPeriod = ownersByPayoutHistoryId[payoutTimes[i].Id]
+	}
+
+	return parseNFTStatistics(payoutTimes)
+}
+
+// GetPaidDestinationsByAddress returns the amounts sent to the address by the farm payments created in [from, to)
+func (sdb *SqlDB) GetPaidDestinationsByAddress(ctx context.Context, address string, from, to time.Time) (_ []types.AddressPayout, retErr error) {
+	defer metrics.ObserveDbQuery("GetPaidDestinationsByAddress", time.Now(), &retErr)
+	payouts := []types.AddressPayout{}
+	if err := sdb.SelectContext(ctx, &payouts, selectPaidDestinationsByAddress, address, from.UTC(), to.UTC()); err != nil {
+		return nil, err
+	}
+	return payouts, nil
+}
+
+// GetBtcPrice returns the price of a bitcoin in the currency captured at the event, sql.ErrNoRows if it was not captured
+func (sdb *SqlDB) GetBtcPrice(ctx context.Context, event, reference, currency string) (_ types.BtcPrice, retErr error) {
+	defer metrics.ObserveDbQuery("GetBtcPrice", time.Now(), &retErr)
+	var price types.BtcPrice
+	if err := sdb.GetContext(ctx, &price, selectBtcPrice, event, reference, currency); err != nil {
+		return types.BtcPrice{}, err
+	}
+	return price, nil
+}
+
 const selectNFTPayoutHistory = `SELECT * FROM statistics_nft_payout_history WHERE denom_id=$1 and token_id=$2 ORDER BY payout_period_end ASC`
+const selectNFTPayoutHistoryByFarmPayment = `SELECT * FROM statistics_nft_payout_history WHERE farm_payment_id=$1 ORDER BY id ASC`
+const selectNFTOwnersPayoutHistoryByFarmPayment = `SELECT time_owned_from, time_owned_to, total_time_owned, percent_of_time_owned, owner, payout_address, reward, nft_payout_history_id, "createdAt", "updatedAt"
+	FROM statistics_nft_owners_payout_history WHERE farm_payment_id=$1 ORDER BY time_owned_from ASC`
 const selectTxHashStatus = `SELECT * FROM statistics_tx_hash_status WHERE status=$1 ORDER BY time_sent ASC`
+const selectFarmSchedules = `SELECT farm_id, schedule, timezone, "lastRunAt", "updatedAt" FROM farm_schedules ORDER BY farm_id ASC`
 const selectApprovedFarms = `SELECT id, name, description, sub_account_name, rewards_from_pool_btc_wallet_name, total_farm_hashrate, address_for_receiving_rewards_from_pool, leftover_reward_payout_address, maintenance_fee_payout_address, maintenance_fee_in_btc, created_at, farm_start_time FROM farms WHERE status='approved'`
 const selectThresholdByAddress = `SELECT * FROM threshold_amounts WHERE btc_address=$1 AND farm_id=$2`
+const selectThresholdsByAddress = `SELECT * FROM threshold_amounts WHERE btc_address=$1 ORDER BY farm_id ASC`
+const selectCudosAddressAccruals = `SELECT * FROM threshold_amounts WHERE btc_address LIKE 'cudos%' AND "accruingSince" IS NOT NULL ORDER BY farm_id ASC, btc_address ASC`
+const selectAccruingThresholdsByFarm = `SELECT * FROM threshold_amounts WHERE farm_id=$1 AND "accruingSince" IS NOT NULL ORDER BY btc_address ASC`
+const selectFarmPaymentById = `SELECT * FROM farm_payment_statistics WHERE id=$1`
+const selectCollectionPaymentAllocations = `SELECT * FROM collection_payment_allocations WHERE farm_payment_id=$1 ORDER BY collection_id ASC`
 const selectUTXOById = `SELECT * FROM utxo_transactions WHERE tx_hash=$1`
 const selectUTXOByFarmId = `SELECT id, farm_id, tx_hash, payment_timestamp, processed FROM utxo_transactions WHERE farm_id=$1 ORDER BY payment_timestamp DESC`
+const selectUnfinishedPayoutIntents = `SELECT * FROM payout_intents WHERE farm_id=$1 AND status IN ($2, $3) ORDER BY "createdAt" ASC`
+const selectFarmId = `SELECT id FROM farms WHERE id=$1`
+const selectPausedFarmIds = `SELECT farm_id FROM paused_farms ORDER BY farm_id ASC`
 const selectFarmCollections = `SELECT id, denom_id, hashing_power FROM collections WHERE farm_id=$1`
+const selectFarmPaymentIdsByDate = `SELECT id FROM farm_payment_statistics WHERE "createdAt" >= $1 AND "createdAt" < $2 ORDER BY id ASC`
+const selectDestinationAddressesByFarmPayment = `SELECT * FROM statistics_destination_addresses_with_amount WHERE farm_payment_id=$1 ORDER BY address ASC`
+const selectTxHashStatusByFarmPayment = `SELECT * FROM statistics_tx_hash_status WHERE farm_payment_id=$1 ORDER BY time_sent ASC, id ASC`
+const selectRBFTransactionsByFarmPayment = `SELECT rbf.id, rbf.old_tx_hash, rbf.new_tx_hash, rbf."createdAt", rbf."updatedAt" FROM rbf_transaction_history rbf
+	JOIN statistics_tx_hash_status status ON status.tx_hash=rbf.old_tx_hash WHERE status.farm_payment_id=$1 ORDER BY rbf.id ASC`
+
+// the nft payouts in which the owner held the nft for a part of [$2, $3)
+const nftPayoutHistoryIdsByOwner = `SELECT nft_payout_history_id FROM statistics_nft_owners_payout_history WHERE owner=$1 AND time_owned_to > $2 AND time_owned_from < $3`
+const selectNFTPayoutHistoryByOwner = `SELECT * FROM statistics_nft_payout_history WHERE id IN (` + nftPayoutHistoryIdsByOwner + `) ORDER BY payout_period_start ASC, id ASC`
+const selectNFTOwnersPayoutHistoryByOwner = `SELECT time_owned_from, time_owned_to, total_time_owned, percent_of_time_owned, owner, payout_address, reward, nft_payout_history_id, "createdAt", "updatedAt"
+	FROM statistics_nft_owners_payout_history WHERE nft_payout_history_id IN (` + nftPayoutHistoryIdsByOwner + `) ORDER BY time_owned_from ASC, id ASC`
+const selectPaidDestinationsByAddress = `SELECT d.*, COALESCE(status.status, '') AS status, COALESCE(rbf.new_tx_hash, '') AS replaced_by_tx_hash
+	FROM statistics_destination_addresses_with_amount d
+	LEFT JOIN statistics_tx_hash_status status ON status.tx_hash=d.tx_hash
+	LEFT JOIN rbf_transaction_history rbf ON rbf.old_tx_hash=d.tx_hash
+	WHERE d.address=$1 AND d.threshold_reached=true AND d."createdAt" >= $2 AND d."createdAt" < $3 ORDER BY d."createdAt" ASC, d.id ASC`
+const selectFarmPayoutThreshold = `SELECT farm_id, threshold_btc, skip_threshold_for_farm_addresses, "updatedAt" FROM farm_payout_thresholds WHERE farm_id=$1`
+
+const selectAddressPayoutThreshold = `SELECT address, threshold_btc, "updatedAt" FROM address_payout_thresholds WHERE address=$1`
+
+const selectBtcPrice = `SELECT * FROM btc_prices WHERE event=$1 AND reference=$2 AND currency=$3`
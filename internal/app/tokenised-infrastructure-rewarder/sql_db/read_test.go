@@ -0,0 +1,139 @@
+package sql_db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetNFTStatisticsByOwner(t *testing.T) {
+	ctx := context.Background()
+	sdb := newLedgerTestSqlDB(t)
+	require.NoError(t, sdb.SetInitialAccumulatedAmountForAddress(ctx, "owner_btc_address", 1, 0))
+
+	intent := newLedgerTestIntent(2000000)
+	intent.Payload.AddressesWithAmountInfo["owner_address"] = types.AmountInfo{Amount: 38000000, ThresholdReached: false}
+	intent.Payload.AddressesWithAmountInfo["owner_btc_address"] = types.AmountInfo{Amount: 60000000, ThresholdReached: true, CrossFarm: true}
+	intent.Payload.AddressesWithThresholdToUpdateBtc = map[string]types.Sats{"cudo_fee_address": 0, "owner_address": 38000000, "owner_btc_address": 0}
+	intent.Payload.LedgerAllocations = []types.LedgerAllocation{
+		{Account: types.LedgerCudoGeneralFee, Address: "cudo_fee_address", AmountBtc: 2000000},
+		{Account: types.LedgerOwnerAccrued, Address: "owner_address", AmountBtc: 38000000},
+		{Account: types.LedgerOwnerAccrued, Address: "owner_btc_address", AmountBtc: 60000000},
+	}
+	intent.Payload.NftStatistics = []types.NFTStatistics{
+		{
+			DenomId:                  "denom_1",
+			TokenId:                  "1",
+			PayoutPeriodStart:        1000,
+			PayoutPeriodEnd:          2000,
+			Reward:                   90000000,
+			MaintenanceFee:           8000000,
+			CUDOPartOfMaintenanceFee: 2000000,
+			NFTOwnersForPeriod: []types.NFTOwnerInformation{
+				{TimeOwnedFrom: 1000, TimeOwnedTo: 1500, TotalTimeOwned: 500, PercentOfTimeOwned: 50, Owner: "cudos1owner", PayoutAddress: "owner_btc_address", Reward: 45000000},
+				{TimeOwnedFrom: 1500, TimeOwnedTo: 2000, TotalTimeOwned: 500, PercentOfTimeOwned: 50, Owner: "cudos1other", Reward: 45000000},
+			},
+		},
+	}
+
+	require.NoError(t, sdb.SavePayoutIntent(ctx, intent))
+	require.NoError(t, sdb.FinalizePayoutIntent(ctx, intent, "payout_tx_hash"))
+
+	statistics, err := sdb.GetNFTStatisticsByOwner(ctx, "cudos1owner", 1200, 3000)
+	require.NoError(t, err)
+	require.Len(t, statistics, 1)
+	require.Equal(t, types.Sats(8000000), statistics[0].MaintenanceFee)
+	require.Len(t, statistics[0].NFTOwnersForPeriod, 2)
+	require.Equal(t, "owner_btc_address", statistics[0].NFTOwnersForPeriod[0].PayoutAddress)
+
+	statistics, err = sdb.GetNFTStatisticsByOwner(ctx, "cudos1owner", 1500, 3000)
+	require.NoError(t, err)
+	require.Empty(t, statistics)
+
+	now := time.Now()
+	payouts, err := sdb.GetPaidDestinationsByAddress(ctx, "owner_btc_address", now.Add(-time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, payouts, 1)
+	require.Equal(t, types.Sats(60000000), payouts[0].AmountBTC)
+	require.Equal(t, "payout_tx_hash", payouts[0].TxHash)
+	require.Equal(t, types.TransactionPending, payouts[0].Status)
+	require.True(t, payouts[0].CrossFarm)
+
+	payouts, err = sdb.GetPaidDestinationsByAddress(ctx, "owner_address", now.Add(-time.Hour), now.Add(time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, payouts)
+}
+
+func TestSaveAndGetBtcPrice(t *testing.T) {
+	ctx := context.Background()
+	sdb := newTestSqlDB(t)
+	_, err := sdb.MigrateUp(ctx)
+	require.NoError(t, err)
+
+	_, err = sdb.GetBtcPrice(ctx, types.BtcPriceEventSendMany, "tx_hash", "usd")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	price := types.BtcPrice{
+		Event:      types.BtcPriceEventSendMany,
+		Reference:  "tx_hash",
+		FarmId:     1,
+		Currency:   "usd",
+		Price:      decimal.RequireFromString("30123.45678901"),
+		Source:     "file",
+		CapturedAt: time.Unix(1666641078, 0).UTC(),
+	}
+	require.NoError(t, sdb.SaveBtcPrice(ctx, price))
+
+	// capturing the price of the same event again replaces it
+	price.Price = decimal.RequireFromString("30200.1")
+	require.NoError(t, sdb.SaveBtcPrice(ctx, price))
+
+	saved, err := sdb.GetBtcPrice(ctx, types.BtcPriceEventSendMany, "tx_hash", "usd")
+	require.NoError(t, err)
+	require.Equal(t, "30200.1", saved.Price.String())
+	require.Equal(t, int64(1), saved.FarmId)
+	require.Equal(t, "file", saved.Source)
+	require.True(t, price.CapturedAt.Equal(saved.CapturedAt))
+}
+
+func TestPayoutThresholds(t *testing.T) {
+	ctx := context.Background()
+	sdb := newTestSqlDB(t)
+	_, err := sdb.MigrateUp(ctx)
+	require.NoError(t, err)
+
+	_, err = sdb.GetFarmPayoutThreshold(ctx, 1)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	threshold := types.Sats(5000000)
+	require.NoError(t, sdb.SetFarmPayoutThreshold(ctx, types.FarmPayoutThreshold{FarmId: 1, ThresholdBtc: &threshold}))
+	farmThreshold, err := sdb.GetFarmPayoutThreshold(ctx, 1)
+	require.NoError(t, err)
+	require.Equal(t, threshold, *farmThreshold.ThresholdBtc)
+	require.False(t, farmThreshold.SkipThresholdForFarmAddresses)
+
+	// the farm keeps the global threshold and only skips it for its own addresses
+	require.NoError(t, sdb.SetFarmPayoutThreshold(ctx, types.FarmPayoutThreshold{FarmId: 1, SkipThresholdForFarmAddresses: true}))
+	farmThreshold, err = sdb.GetFarmPayoutThreshold(ctx, 1)
+	require.NoError(t, err)
+	require.Nil(t, farmThreshold.ThresholdBtc)
+	require.True(t, farmThreshold.SkipThresholdForFarmAddresses)
+
+	require.NoError(t, sdb.DeleteFarmPayoutThreshold(ctx, 1))
+	_, err = sdb.GetFarmPayoutThreshold(ctx, 1)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.NoError(t, sdb.SetAddressPayoutThreshold(ctx, "btc_address", 50000000))
+	addressThreshold, err := sdb.GetAddressPayoutThreshold(ctx, "btc_address")
+	require.NoError(t, err)
+	require.Equal(t, types.Sats(50000000), addressThreshold.ThresholdBtc)
+
+	require.NoError(t, sdb.DeleteAddressPayoutThreshold(ctx, "btc_address"))
+	_, err = sdb.GetAddressPayoutThreshold(ctx, "btc_address")
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -3,11 +3,12 @@ package sql_db
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
 	"github.com/jmoiron/sqlx"
 	"github.com/rs/zerolog/log"
-	"github.com/shopspring/decimal"
 )
 
 func NewSqlDB(db *sqlx.DB) *SqlDB {
@@ -16,7 +17,7 @@ func NewSqlDB(db *sqlx.DB) *SqlDB {
 
 func (sdb *SqlDB) SaveStatistics(
 	ctx context.Context,
-	receivedRewardForFarmBtcDecimal decimal.Decimal,
+	receivedRewardForFarm types.Sats,
 	collectionPaymentAllocationsStatistics []types.CollectionPaymentAllocation,
 	destinationAddressesWithAmount map[string]types.AmountInfo,
 	statistics []types.NFTStatistics,
@@ -24,62 +25,77 @@ func (sdb *SqlDB) SaveStatistics(
 	farmId int64,
 	farmSubAccountName string,
 ) (retErr error) {
+	defer metrics.ObserveDbQuery("SaveStatistics", time.Now(), &retErr)
 
 	return sdb.ExecuteTx(ctx, func(tx *DbTx) error {
-		farmPaymentId, err := tx.saveFarmPaymentStatistics(ctx, farmId, receivedRewardForFarmBtcDecimal)
-		if err != nil {
-			return err
-		}
+		_, err := tx.saveStatistics(ctx, receivedRewardForFarm, collectionPaymentAllocationsStatistics, destinationAddressesWithAmount, statistics, txHash, farmId, farmSubAccountName)
+		return err
+	})
+}
 
-		for _, collectionPaymentAllocation := range collectionPaymentAllocationsStatistics {
-			if err := tx.saveCollectionPaymentAllocation(
-				ctx,
-				farmId,
-				farmPaymentId,
-				collectionPaymentAllocation.CollectionId,
-				collectionPaymentAllocation.CollectionAllocationAmount,
-				collectionPaymentAllocation.CUDOGeneralFee,
-				collectionPaymentAllocation.CUDOMaintenanceFee,
-				collectionPaymentAllocation.FarmUnsoldLeftovers,
-				collectionPaymentAllocation.FarmMaintenanceFee,
-			); err != nil {
-				return err
-			}
+func (tx *DbTx) saveStatistics(
+	ctx context.Context,
+	receivedRewardForFarm types.Sats,
+	collectionPaymentAllocationsStatistics []types.CollectionPaymentAllocation,
+	destinationAddressesWithAmount map[string]types.AmountInfo,
+	statistics []types.NFTStatistics,
+	txHash string,
+	farmId int64,
+	farmSubAccountName string,
+) (int64, error) {
+	farmPaymentId, err := tx.saveFarmPaymentStatistics(ctx, farmId, receivedRewardForFarm)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, collectionPaymentAllocation := range collectionPaymentAllocationsStatistics {
+		if err := tx.saveCollectionPaymentAllocation(
+			ctx,
+			farmId,
+			farmPaymentId,
+			collectionPaymentAllocation.CollectionId,
+			collectionPaymentAllocation.CollectionAllocationAmount,
+			collectionPaymentAllocation.CUDOGeneralFee,
+			collectionPaymentAllocation.CUDOMaintenanceFee,
+			collectionPaymentAllocation.FarmUnsoldLeftovers,
+			collectionPaymentAllocation.FarmMaintenanceFee,
+		); err != nil {
+			return 0, err
 		}
+	}
 
-		for address, amountInfo := range destinationAddressesWithAmount {
-			if err := tx.saveDestinationAddressesWithAmountHistory(ctx, address, amountInfo, txHash, farmId, farmPaymentId); err != nil {
-				return err
-			}
+	for address, amountInfo := range destinationAddressesWithAmount {
+		if err := tx.saveDestinationAddressesWithAmountHistory(ctx, address, amountInfo, txHash, farmId, farmPaymentId); err != nil {
+			return 0, err
 		}
+	}
 
-		for _, nftStatistic := range statistics {
-			var nftPayoutHistoryId int
-			var err error
-			if nftPayoutHistoryId, err = tx.saveNFTInformationHistory(ctx, nftStatistic.DenomId, nftStatistic.TokenId, farmPaymentId,
-				nftStatistic.PayoutPeriodStart, nftStatistic.PayoutPeriodEnd, nftStatistic.Reward, txHash,
-				nftStatistic.MaintenanceFee, nftStatistic.CUDOPartOfMaintenanceFee); err != nil {
-				return err
-			}
+	for _, nftStatistic := range statistics {
+		var nftPayoutHistoryId int
+		var err error
+		if nftPayoutHistoryId, err = tx.saveNFTInformationHistory(ctx, nftStatistic.DenomId, nftStatistic.TokenId, farmPaymentId,
+			nftStatistic.PayoutPeriodStart, nftStatistic.PayoutPeriodEnd, nftStatistic.Reward, txHash,
+			nftStatistic.MaintenanceFee, nftStatistic.CUDOPartOfMaintenanceFee); err != nil {
+			return 0, err
+		}
 
-			for _, ownerForPeriod := range nftStatistic.NFTOwnersForPeriod {
-				isSent := fundsHaveBeenSent(destinationAddressesWithAmount, ownerForPeriod)
-				if err := tx.saveNFTOwnersForPeriodHistory(ctx,
-					ownerForPeriod.TimeOwnedFrom, ownerForPeriod.TimeOwnedTo, ownerForPeriod.TotalTimeOwned,
-					ownerForPeriod.PercentOfTimeOwned, ownerForPeriod.Owner, ownerForPeriod.PayoutAddress, ownerForPeriod.Reward, nftPayoutHistoryId, farmPaymentId, isSent); err != nil {
-					return err
-				}
+		for _, ownerForPeriod := range nftStatistic.NFTOwnersForPeriod {
+			isSent := fundsHaveBeenSent(destinationAddressesWithAmount, ownerForPeriod)
+			if err := tx.saveNFTOwnersForPeriodHistory(ctx,
+				ownerForPeriod.TimeOwnedFrom, ownerForPeriod.TimeOwnedTo, ownerForPeriod.TotalTimeOwned,
+				ownerForPeriod.PercentOfTimeOwned, ownerForPeriod.Owner, ownerForPeriod.PayoutAddress, ownerForPeriod.Reward, nftPayoutHistoryId, farmPaymentId, isSent); err != nil {
+				return 0, err
 			}
 		}
+	}
 
-		if txHash != "" {
-			if err := saveTxHashWithStatus(ctx, tx, txHash, types.TransactionPending, farmSubAccountName, farmPaymentId, 0); err != nil {
-				return err
-			}
+	if txHash != "" {
+		if err := saveTxHashWithStatus(ctx, tx, txHash, types.TransactionPending, farmSubAccountName, farmPaymentId, 0); err != nil {
+			return 0, err
 		}
+	}
 
-		return nil
-	})
+	return farmPaymentId, nil
 }
 
 func fundsHaveBeenSent(destinationAddressesWithAmount map[string]types.AmountInfo, ownerInfo types.NFTOwnerInformation) bool {
@@ -93,7 +109,8 @@ func fundsHaveBeenSent(destinationAddressesWithAmount map[string]types.AmountInf
 	return false
 }
 
-func (sdb *SqlDB) SaveRBFTransactionInformation(ctx context.Context, oldTxHash, oldTxStatus, newRBFTxHash, newRBFTXStatus, farmSubAccountName string, farmPaymentId int64, retryCount int) error {
+func (sdb *SqlDB) SaveRBFTransactionInformation(ctx context.Context, oldTxHash, oldTxStatus, newRBFTxHash, newRBFTXStatus, farmSubAccountName string, farmPaymentId int64, retryCount int) (retErr error) {
+	defer metrics.ObserveDbQuery("SaveRBFTransactionInformation", time.Now(), &retErr)
 
 	return sdb.ExecuteTx(ctx, func(tx *DbTx) error {
 		// update old tx status
@@ -115,20 +132,58 @@ func (sdb *SqlDB) SaveRBFTransactionInformation(ctx context.Context, oldTxHash,
 	})
 }
 
-func (sdb *SqlDB) UpdateThresholdStatus(ctx context.Context, processedTransaction string, paymentTimestamp int64, addressesWithThresholdToUpdate map[string]decimal.Decimal, farmId int64) (retErr error) {
+func (sdb *SqlDB) UpdateThresholdStatus(ctx context.Context, processedTransaction string, paymentTimestamp int64, addressesWithThresholdToUpdate map[string]types.Sats, farmId int64) (retErr error) {
+	defer metrics.ObserveDbQuery("UpdateThresholdStatus", time.Now(), &retErr)
 
 	return sdb.ExecuteTx(ctx, func(tx *DbTx) error {
-		if retErr = tx.markUTXOAsProcessed(ctx, processedTransaction, paymentTimestamp, farmId); retErr != nil {
-			return fmt.Errorf("failed to commit transaction: %s", retErr)
+		return tx.updateThresholdStatus(ctx, processedTransaction, paymentTimestamp, addressesWithThresholdToUpdate, farmId)
+	})
+}
+
+func (tx *DbTx) updateThresholdStatus(ctx context.Context, processedTransaction string, paymentTimestamp int64, addressesWithThresholdToUpdate map[string]types.Sats, farmId int64) error {
+	if err := tx.markUTXOAsProcessed(ctx, processedTransaction, paymentTimestamp, farmId); err != nil {
+		return fmt.Errorf("failed to commit transaction: %s", err)
+	}
+
+	for address, amount := range addressesWithThresholdToUpdate {
+		if err := tx.updateCurrentAcummulatedAmountForAddress(ctx, address, farmId, amount); err != nil {
+			return fmt.Errorf("failed to commit transaction: %s", err)
 		}
+	}
+
+	return nil
+}
 
-		for address, amount := range addressesWithThresholdToUpdate {
-			if retErr = tx.updateCurrentAcummulatedAmountForAddress(ctx, address, farmId, amount); retErr != nil {
-				return fmt.Errorf("failed to commit transaction: %s", retErr)
+// FinalizePayoutIntent finishes the bookkeeping of a sent payout in a single db transaction.
+// The UTXO is marked as processed, the thresholds are updated, the statistics and the ledger entries are saved
+// and the intent is marked as completed, so either all of it is saved or none of it.
+// A sweep has no UTXO, only its thresholds are updated.
+func (sdb *SqlDB) FinalizePayoutIntent(ctx context.Context, intent types.PayoutIntent, txHash string) (retErr error) {
+	defer metrics.ObserveDbQuery("FinalizePayoutIntent", time.Now(), &retErr)
+	payload := intent.Payload
+
+	return sdb.ExecuteTx(ctx, func(tx *DbTx) error {
+		if payload.Sweep {
+			for address, amount := range payload.AddressesWithThresholdToUpdateBtc {
+				if err := tx.updateCurrentAcummulatedAmountForAddress(ctx, address, intent.FarmId, amount); err != nil {
+					return fmt.Errorf("failed to commit transaction: %s", err)
+				}
 			}
+		} else if err := tx.updateThresholdStatus(ctx, intent.UTXOTxHash, payload.PaymentTimestamp, payload.AddressesWithThresholdToUpdateBtc, intent.FarmId); err != nil {
+			return err
 		}
 
-		return nil
+		farmPaymentId, err := tx.saveStatistics(ctx, payload.ReceivedRewardBtc, payload.CollectionPaymentAllocations, payload.AddressesWithAmountInfo,
+			payload.NftStatistics, txHash, intent.FarmId, payload.FarmSubAccountName)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.saveLedgerEntries(ctx, intent.FarmId, farmPaymentId, intent.UTXOTxHash, txHash, payload); err != nil {
+			return err
+		}
+
+		return updatePayoutIntentStatus(ctx, tx, intent.IdempotencyKey, types.PayoutIntentCompleted, txHash)
 	})
 }
 
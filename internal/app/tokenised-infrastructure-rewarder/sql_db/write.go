@@ -3,25 +3,24 @@ package sql_db
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
 	"time"
 
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
-	"github.com/shopspring/decimal"
 )
 
-func (tx *DbTx) saveFarmPaymentStatistics(ctx context.Context, farmId int64, amountBtc decimal.Decimal) (int64, error) {
+func (tx *DbTx) saveFarmPaymentStatistics(ctx context.Context, farmId int64, amountBtc types.Sats) (int64, error) {
 	now := time.Now()
 
-	_, err := tx.ExecContext(ctx, insertFarmPaymentStatistics, farmId, amountBtc.String(), now.UTC(), now.UTC())
-	if err != nil {
+	// the id of the inserted row, the farms are paid concurrently so another farm payment can be inserted meanwhile
+	var id int64
+	if err := tx.QueryRowContext(ctx, insertFarmPaymentStatistics, farmId, amountBtc.String(), now.UTC(), now.UTC()).Scan(&id); err != nil {
 		return 0, err
 	}
 
-	var id int64
-	row := tx.QueryRow("SELECT max(id) from farm_payment_statistics")
-	row.Scan(&id)
-
-	return id, err
+	return id, nil
 }
 
 func (tx *DbTx) saveCollectionPaymentAllocation(
@@ -29,11 +28,11 @@ func (tx *DbTx) saveCollectionPaymentAllocation(
 	farmId int64,
 	farmPaymentId int64,
 	collectionId int64,
-	collectionAllocationAmount decimal.Decimal,
-	cudoGeneralFee decimal.Decimal,
-	cudoMaintenanceFee decimal.Decimal,
-	farmUnsoldLeftovers decimal.Decimal,
-	farmMaintenanceFee decimal.Decimal,
+	collectionAllocationAmount types.Sats,
+	cudoGeneralFee types.Sats,
+	cudoMaintenanceFee types.Sats,
+	farmUnsoldLeftovers types.Sats,
+	farmMaintenanceFee types.Sats,
 ) error {
 	now := time.Now()
 
@@ -43,7 +42,7 @@ func (tx *DbTx) saveCollectionPaymentAllocation(
 		farmId,
 		farmPaymentId,
 		collectionId,
-		collectionAllocationAmount,
+		collectionAllocationAmount.String(),
 		cudoGeneralFee.String(),
 		cudoMaintenanceFee.String(),
 		farmUnsoldLeftovers.String(),
@@ -60,7 +59,7 @@ func (tx *DbTx) saveDestinationAddressesWithAmountHistory(ctx context.Context, a
 	if !amountInfo.ThresholdReached {
 		txHash = "" // the funds were not sent but accumulated, we keep this record as statistic that they were spread but with empty tx hash
 	}
-	_, err := tx.ExecContext(ctx, insertDestinationAddressesWithAmountHistory, address, amountInfo.Amount.String(), txHash, farmId, farmPaymentId, now.Unix(), amountInfo.ThresholdReached, now.UTC(), now.UTC())
+	_, err := tx.ExecContext(ctx, insertDestinationAddressesWithAmountHistory, address, amountInfo.Amount.String(), txHash, farmId, farmPaymentId, now.Unix(), amountInfo.ThresholdReached, amountInfo.CrossFarm, now.UTC(), now.UTC())
 	return err
 
 }
@@ -73,9 +72,9 @@ func (tx *DbTx) saveNFTInformationHistory(
 	farmPaymentId int64,
 	payoutPeriodStart,
 	payoutPeriodEnd int64,
-	reward decimal.Decimal,
+	reward types.Sats,
 	txHash string,
-	maintenanceFee, CudoPartOfMaintenanceFee decimal.Decimal) (int, error) {
+	maintenanceFee, CudoPartOfMaintenanceFee types.Sats) (int, error) {
 
 	var id int
 	now := time.Now()
@@ -88,7 +87,7 @@ func (tx *DbTx) saveNFTInformationHistory(
 	return id, nil
 }
 
-func (tx *DbTx) saveNFTOwnersForPeriodHistory(ctx context.Context, timedOwnedFrom int64, timedOwnedTo int64, totalTimeOwned int64, percentOfTimeOwned float64, owner string, payoutAddress string, reward decimal.Decimal, nftPayoutHistoryId int, farmPaymentId int64, sent bool) error {
+func (tx *DbTx) saveNFTOwnersForPeriodHistory(ctx context.Context, timedOwnedFrom int64, timedOwnedTo int64, totalTimeOwned int64, percentOfTimeOwned float64, owner string, payoutAddress string, reward types.Sats, nftPayoutHistoryId int, farmPaymentId int64, sent bool) error {
 	now := time.Now()
 	_, err := tx.ExecContext(ctx, insertNFTOnwersForPeriodHistory,
 		timedOwnedFrom, timedOwnedTo, totalTimeOwned, percentOfTimeOwned, owner, payoutAddress, reward.String(), nftPayoutHistoryId, sent, now.UTC(), now.UTC(), farmPaymentId)
@@ -101,7 +100,8 @@ func (tx *DbTx) saveRBFTransactionHistory(ctx context.Context, oldTxHash string,
 	return err
 }
 
-func (sdb *SqlDB) SaveTxHashWithStatus(ctx context.Context, txHash, txStatus, farmSubAccountName string, farmPaymentId int64, retryCount int) error {
+func (sdb *SqlDB) SaveTxHashWithStatus(ctx context.Context, txHash, txStatus, farmSubAccountName string, farmPaymentId int64, retryCount int) (retErr error) {
+	defer metrics.ObserveDbQuery("SaveTxHashWithStatus", time.Now(), &retErr)
 	return saveTxHashWithStatus(ctx, sdb, txHash, txStatus, farmSubAccountName, farmPaymentId, retryCount)
 }
 
@@ -111,7 +111,8 @@ func saveTxHashWithStatus(ctx context.Context, sqlExec SqlExecutor, txHash, txSt
 	return err
 }
 
-func (sdb *SqlDB) UpdateTransactionsStatus(ctx context.Context, txHashes []string, txStatus string) error {
+func (sdb *SqlDB) UpdateTransactionsStatus(ctx context.Context, txHashes []string, txStatus string) (retErr error) {
+	defer metrics.ObserveDbQuery("UpdateTransactionsStatus", time.Now(), &retErr)
 	return updateTransactionsStatus(ctx, sdb, txHashes, txStatus)
 }
 
@@ -125,11 +126,235 @@ func updateTransactionsStatus(ctx context.Context, sqlExec SqlExecutor, txHashes
 	return nil
 }
 
-func (tx *DbTx) updateCurrentAcummulatedAmountForAddress(ctx context.Context, address string, farmId int64, amount decimal.Decimal) error {
-	_, err := tx.ExecContext(ctx, updateThresholdAmounts, amount.String(), address, farmId)
+// SavePayoutIntent persists the intent before anything is sent.
+// Only one intent that is not rolled back can exist for an UTXO, so a second attempt to pay the same UTXO fails here.
+func (sdb *SqlDB) SavePayoutIntent(ctx context.Context, intent types.PayoutIntent) (retErr error) {
+	defer metrics.ObserveDbQuery("SavePayoutIntent", time.Now(), &retErr)
+	payload, err := json.Marshal(intent.Payload)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if _, err := sdb.ExecContext(ctx, insertPayoutIntent, intent.IdempotencyKey, intent.FarmId, intent.UTXOTxHash, string(payload), types.PayoutIntentPending, "", now, now); err != nil {
+		return fmt.Errorf("failed to save payout intent for utxo {%s}: %s", intent.UTXOTxHash, err)
+	}
+
+	return nil
+}
+
+func (sdb *SqlDB) MarkPayoutIntentSent(ctx context.Context, idempotencyKey, txHash string) (retErr error) {
+	defer metrics.ObserveDbQuery("MarkPayoutIntentSent", time.Now(), &retErr)
+	return updatePayoutIntentStatus(ctx, sdb, idempotencyKey, types.PayoutIntentSent, txHash)
+}
+
+func (sdb *SqlDB) RollbackPayoutIntent(ctx context.Context, idempotencyKey string) (retErr error) {
+	defer metrics.ObserveDbQuery("RollbackPayoutIntent", time.Now(), &retErr)
+	return updatePayoutIntentStatus(ctx, sdb, idempotencyKey, types.PayoutIntentRolledBack, "")
+}
+
+func updatePayoutIntentStatus(ctx context.Context, sqlExec SqlExecutor, idempotencyKey, status, txHash string) error {
+	_, err := sqlExec.ExecContext(ctx, updatePayoutIntentStatusQuery, status, txHash, time.Now().UTC(), idempotencyKey)
+	return err
+}
+
+// PauseFarm stops the payouts for the farm until it is resumed. Pausing an already paused farm does nothing.
+// Returns sql.ErrNoRows if there is no farm with the id.
+func (sdb *SqlDB) PauseFarm(ctx context.Context, farmId int64) (retErr error) {
+	defer metrics.ObserveDbQuery("PauseFarm", time.Now(), &retErr)
+	return sdb.ExecuteTx(ctx, func(tx *DbTx) error {
+		var id int64
+		if err := tx.GetContext(ctx, &id, selectFarmId, farmId); err != nil {
+			return fmt.Errorf("failed to get farm {%d}: %w", farmId, err)
+		}
+
+		_, err := tx.ExecContext(ctx, insertPausedFarm, farmId, time.Now().UTC())
+		return err
+	})
+}
+
+func (sdb *SqlDB) ResumeFarm(ctx context.Context, farmId int64) (retErr error) {
+	defer metrics.ObserveDbQuery("ResumeFarm", time.Now(), &retErr)
+	_, err := sdb.ExecContext(ctx, deletePausedFarm, farmId)
+	return err
+}
+
+// SetFarmSchedule overrides the pay schedule of the farm. The schedule must be validated by the caller.
+func (sdb *SqlDB) SetFarmSchedule(ctx context.Context, farmId int64, schedule, timezone string) (retErr error) {
+	defer metrics.ObserveDbQuery("SetFarmSchedule", time.Now(), &retErr)
+	_, err := sdb.ExecContext(ctx, upsertFarmSchedule, farmId, schedule, timezone, time.Now().UTC())
+	return err
+}
+
+// DeleteFarmSchedule makes the farm follow the schedule of the pay service again. The time of its last run is kept.
+func (sdb *SqlDB) DeleteFarmSchedule(ctx context.Context, farmId int64) (retErr error) {
+	defer metrics.ObserveDbQuery("DeleteFarmSchedule", time.Now(), &retErr)
+	_, err := sdb.ExecContext(ctx, resetFarmSchedule, time.Now().UTC(), farmId)
+	return err
+}
+
+func (sdb *SqlDB) SaveFarmLastRun(ctx context.Context, farmId int64, lastRunAt time.Time) (retErr error) {
+	defer metrics.ObserveDbQuery("SaveFarmLastRun", time.Now(), &retErr)
+	_, err := sdb.ExecContext(ctx, upsertFarmLastRun, farmId, lastRunAt.UTC(), time.Now().UTC())
+	return err
+}
+
+// SetFarmPayoutThreshold overrides the payout threshold of the farm. The threshold must be validated by the caller.
+func (sdb *SqlDB) SetFarmPayoutThreshold(ctx context.Context, threshold types.FarmPayoutThreshold) (retErr error) {
+	defer metrics.ObserveDbQuery("SetFarmPayoutThreshold", time.Now(), &retErr)
+	_, err := sdb.ExecContext(ctx, upsertFarmPayoutThreshold, threshold.FarmId, threshold.ThresholdBtc, threshold.SkipThresholdForFarmAddresses, time.Now().UTC())
+	return err
+}
+
+// DeleteFarmPayoutThreshold makes the addresses paid by the farm use the global payout threshold again
+func (sdb *SqlDB) DeleteFarmPayoutThreshold(ctx context.Context, farmId int64) (retErr error) {
+	defer metrics.ObserveDbQuery("DeleteFarmPayoutThreshold", time.Now(), &retErr)
+	_, err := sdb.ExecContext(ctx, deleteFarmPayoutThreshold, farmId)
+	return err
+}
+
+// SetAddressPayoutThreshold saves the payout threshold the owner of the address picked. The threshold must be validated by the caller.
+func (sdb *SqlDB) SetAddressPayoutThreshold(ctx context.Context, address string, threshold types.Sats) (retErr error) {
+	defer metrics.ObserveDbQuery("SetAddressPayoutThreshold", time.Now(), &retErr)
+	_, err := sdb.ExecContext(ctx, upsertAddressPayoutThreshold, address, threshold, time.Now().UTC())
+	return err
+}
+
+func (sdb *SqlDB) DeleteAddressPayoutThreshold(ctx context.Context, address string) (retErr error) {
+	defer metrics.ObserveDbQuery("DeleteAddressPayoutThreshold", time.Now(), &retErr)
+	_, err := sdb.ExecContext(ctx, deleteAddressPayoutThreshold, address)
+	return err
+}
+
+// AcquireLease takes the lease for the holder if it is free or expired, or extends it if the holder already has it.
+// Returns false if the lease is held by someone else.
+// The expiry is computed from the clock of the db, so the clocks of the replicas do not have to agree.
+func (sdb *SqlDB) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (_ bool, retErr error) {
+	defer metrics.ObserveDbQuery("AcquireLease", time.Now(), &retErr)
+	query := upsertServiceLease
+	if sdb.DriverName() == DriverSqlite {
+		query = upsertServiceLeaseSqlite
+	}
+
+	result, err := sdb.ExecContext(ctx, query, name, holder, ttl.Milliseconds())
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+// ReleaseLease gives up the lease, so another holder does not have to wait for it to expire
+func (sdb *SqlDB) ReleaseLease(ctx context.Context, name, holder string) (retErr error) {
+	defer metrics.ObserveDbQuery("ReleaseLease", time.Now(), &retErr)
+	_, err := sdb.ExecContext(ctx, deleteServiceLease, name, holder)
 	return err
 }
 
+// SaveBtcPrice records the price of a bitcoin at an event. Capturing the price of the same event again replaces it.
+func (sdb *SqlDB) SaveBtcPrice(ctx context.Context, price types.BtcPrice) (retErr error) {
+	defer metrics.ObserveDbQuery("SaveBtcPrice", time.Now(), &retErr)
+	_, err := sdb.ExecContext(ctx, upsertBtcPrice, price.Event, price.Reference, price.FarmId, price.Currency, price.Price.String(), price.Source, price.CapturedAt.UTC())
+	return err
+}
+
+// updateCurrentAcummulatedAmountForAddress keeps the time the amount started accruing until it is paid out
+func (tx *DbTx) updateCurrentAcummulatedAmountForAddress(ctx context.Context, address string, farmId int64, amount types.Sats) error {
+	query := updateThresholdAmounts
+	if amount == 0 {
+		query = resetThresholdAmounts
+	}
+
+	_, err := tx.ExecContext(ctx, query, amount.String(), time.Now().UTC(), address, farmId)
+	return err
+}
+
+/*
+MoveAccumulatedAmount moves the amount accumulated for an address in the farm onto another address, in a single db transaction.
+It is used to move the amount of a cudos address onto the btc address its owner mapped later. Returns the amount moved.
+
+ 1. Nothing is moved if nothing is accumulated for the address.
+ 2. The amount is added to the amount of the other address, which keeps accruing since the older of the two,
+    and the amount of the address is reset.
+ 3. The accrued balances of the address are moved to the other address in the ledger.
+*/
+func (sdb *SqlDB) MoveAccumulatedAmount(ctx context.Context, farmId int64, fromAddress, toAddress string) (_ types.Sats, retErr error) {
+	defer metrics.ObserveDbQuery("MoveAccumulatedAmount", time.Now(), &retErr)
+	var moved types.Sats
+
+	err := sdb.ExecuteTx(ctx, func(tx *DbTx) error {
+		var from types.AddressThresholdAmountByFarm
+		if err := tx.GetContext(ctx, &from, selectThresholdByAddress, fromAddress, farmId); err != nil {
+			if err == sql.ErrNoRows {
+				return nil
+			}
+			return err
+		}
+
+		fromAmount, err := types.ParseSats(from.AmountBTC)
+		if err != nil {
+			return err
+		}
+
+		if fromAmount == 0 {
+			return nil
+		}
+
+		var to types.AddressThresholdAmountByFarm
+		if err := tx.GetContext(ctx, &to, selectThresholdByAddress, toAddress, farmId); err != nil {
+			if err != sql.ErrNoRows {
+				return err
+			}
+
+			now := time.Now().UTC()
+			if _, err := tx.ExecContext(ctx, insertInitialThresholdAmount, toAddress, farmId, 0, now, now); err != nil {
+				return err
+			}
+			// the failed scan may have left the fields half set
+			to = types.AddressThresholdAmountByFarm{AmountBTC: "0"}
+		}
+
+		toAmount, err := types.ParseSats(to.AmountBTC)
+		if err != nil {
+			return err
+		}
+
+		accruingSince := from.AccruingSince
+		if accruingSince == nil || (to.AccruingSince != nil && to.AccruingSince.Before(*accruingSince)) {
+			accruingSince = to.AccruingSince
+		}
+		if accruingSince == nil {
+			now := time.Now().UTC()
+			accruingSince = &now
+		}
+
+		if _, err := tx.ExecContext(ctx, moveThresholdAmount, (toAmount + fromAmount).String(), accruingSince.UTC(), time.Now().UTC(), toAddress, farmId); err != nil {
+			return err
+		}
+
+		if err := tx.updateCurrentAcummulatedAmountForAddress(ctx, fromAddress, farmId, 0); err != nil {
+			return err
+		}
+
+		if err := tx.moveAccruedBalances(ctx, farmId, fromAddress, toAddress); err != nil {
+			return err
+		}
+
+		moved = fromAmount
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to move the amount of {%s} to {%s} in farm {%d}: %s", fromAddress, toAddress, farmId, err)
+	}
+
+	return moved, nil
+}
+
 func (tx *DbTx) markUTXOAsProcessed(ctx context.Context, tx_hash string, paymentTimestamp, farmId int64) error {
 	var UTXOMaps []map[string]interface{}
 	m := map[string]interface{}{
@@ -146,7 +371,8 @@ func (tx *DbTx) markUTXOAsProcessed(ctx context.Context, tx_hash string, payment
 	return err
 }
 
-func (sdb *SqlDB) SetInitialAccumulatedAmountForAddress(ctx context.Context, address string, farmId int64, amount int) error {
+func (sdb *SqlDB) SetInitialAccumulatedAmountForAddress(ctx context.Context, address string, farmId int64, amount int) (retErr error) {
+	defer metrics.ObserveDbQuery("SetInitialAccumulatedAmountForAddress", time.Now(), &retErr)
 	_, err := sdb.ExecContext(ctx, insertInitialThresholdAmount, address, farmId, amount, time.Now().UTC(), time.Now().UTC())
 	return err
 
@@ -163,7 +389,7 @@ const (
 	(old_tx_hash, new_tx_hash, "createdAt", "updatedAt") VALUES ($1, $2, $3, $4)`
 
 	insertDestinationAddressesWithAmountHistory = `INSERT INTO statistics_destination_addresses_with_amount
-		(address, amount_btc, tx_hash, farm_id, farm_payment_id, payout_time, threshold_reached, "createdAt", "updatedAt") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+		(address, amount_btc, tx_hash, farm_id, farm_payment_id, payout_time, threshold_reached, cross_farm, "createdAt", "updatedAt") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
 
 	insertNFTInformationHistory = `INSERT INTO statistics_nft_payout_history (denom_id, token_id, farm_payment_id, payout_period_start,
 		payout_period_end, reward, tx_hash, maintenance_fee, cudo_part_of_maintenance_fee, "createdAt", "updatedAt")
@@ -175,13 +401,60 @@ const (
 
 	updateTxHashesWithStatusQuery = `UPDATE statistics_tx_hash_status SET status=$1 where tx_hash=$2`
 
-	updateThresholdAmounts = `UPDATE threshold_amounts SET amount_btc=$1 where btc_address=$2 and farm_id=$3`
+	updateThresholdAmounts = `UPDATE threshold_amounts SET amount_btc=$1, "accruingSince"=COALESCE("accruingSince", $2), "updatedAt"=$2
+	where btc_address=$3 and farm_id=$4`
+
+	moveThresholdAmount = `UPDATE threshold_amounts SET amount_btc=$1, "accruingSince"=$2, "updatedAt"=$3 where btc_address=$4 and farm_id=$5`
+
+	resetThresholdAmounts = `UPDATE threshold_amounts SET amount_btc=$1, "accruingSince"=NULL, "updatedAt"=$2 where btc_address=$3 and farm_id=$4`
 
 	insertInitialThresholdAmount = `INSERT INTO threshold_amounts
 	(btc_address, farm_id, amount_btc, "createdAt", "updatedAt") VALUES ($1, $2, $3, $4, $5)`
 
 	insertFarmPaymentStatistics = `INSERT INTO farm_payment_statistics
-	(farm_id, amount_btc, "createdAt", "updatedAt") VALUES ($1, $2, $3, $4)`
+	(farm_id, amount_btc, "createdAt", "updatedAt") VALUES ($1, $2, $3, $4) RETURNING id`
+
+	insertPayoutIntent = `INSERT INTO payout_intents
+	(idempotency_key, farm_id, utxo_tx_hash, payload, status, tx_hash, "createdAt", "updatedAt") VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	updatePayoutIntentStatusQuery = `UPDATE payout_intents SET status=$1, tx_hash=$2, "updatedAt"=$3 WHERE idempotency_key=$4`
+
+	insertPausedFarm = `INSERT INTO paused_farms (farm_id, "createdAt") VALUES ($1, $2) ON CONFLICT (farm_id) DO NOTHING`
+
+	deletePausedFarm = `DELETE FROM paused_farms WHERE farm_id=$1`
+
+	upsertFarmSchedule = `INSERT INTO farm_schedules (farm_id, schedule, timezone, "updatedAt") VALUES ($1, $2, $3, $4)
+	ON CONFLICT (farm_id) DO UPDATE SET schedule=EXCLUDED.schedule, timezone=EXCLUDED.timezone, "updatedAt"=EXCLUDED."updatedAt"`
+
+	resetFarmSchedule = `UPDATE farm_schedules SET schedule='', timezone='', "updatedAt"=$1 WHERE farm_id=$2`
+
+	upsertFarmLastRun = `INSERT INTO farm_schedules (farm_id, "lastRunAt", "updatedAt") VALUES ($1, $2, $3)
+	ON CONFLICT (farm_id) DO UPDATE SET "lastRunAt"=EXCLUDED."lastRunAt", "updatedAt"=EXCLUDED."updatedAt"`
+
+	upsertFarmPayoutThreshold = `INSERT INTO farm_payout_thresholds (farm_id, threshold_btc, skip_threshold_for_farm_addresses, "updatedAt") VALUES ($1, $2, $3, $4)
+	ON CONFLICT (farm_id) DO UPDATE SET threshold_btc=EXCLUDED.threshold_btc, skip_threshold_for_farm_addresses=EXCLUDED.skip_threshold_for_farm_addresses, "updatedAt"=EXCLUDED."updatedAt"`
+
+	deleteFarmPayoutThreshold = `DELETE FROM farm_payout_thresholds WHERE farm_id=$1`
+
+	upsertAddressPayoutThreshold = `INSERT INTO address_payout_thresholds (address, threshold_btc, "updatedAt") VALUES ($1, $2, $3)
+	ON CONFLICT (address) DO UPDATE SET threshold_btc=EXCLUDED.threshold_btc, "updatedAt"=EXCLUDED."updatedAt"`
+
+	deleteAddressPayoutThreshold = `DELETE FROM address_payout_thresholds WHERE address=$1`
+
+	upsertBtcPrice = `INSERT INTO btc_prices (event, reference, farm_id, currency, price, source, "capturedAt") VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (event, reference, currency) DO UPDATE SET farm_id=EXCLUDED.farm_id, price=EXCLUDED.price, source=EXCLUDED.source, "capturedAt"=EXCLUDED."capturedAt"`
+
+	upsertServiceLease = `INSERT INTO service_leases (name, holder, "expiresAt", "updatedAt")
+	VALUES ($1, $2, (now() AT TIME ZONE 'UTC') + $3 * interval '1 millisecond', now() AT TIME ZONE 'UTC')
+	ON CONFLICT (name) DO UPDATE SET holder=EXCLUDED.holder, "expiresAt"=EXCLUDED."expiresAt", "updatedAt"=EXCLUDED."updatedAt"
+	WHERE service_leases.holder=EXCLUDED.holder OR service_leases."expiresAt" < EXCLUDED."updatedAt"`
+
+	upsertServiceLeaseSqlite = `INSERT INTO service_leases (name, holder, "expiresAt", "updatedAt")
+	VALUES ($1, $2, strftime('%Y-%m-%d %H:%M:%f', 'now', ($3 / 1000.0) || ' seconds'), strftime('%Y-%m-%d %H:%M:%f', 'now'))
+	ON CONFLICT (name) DO UPDATE SET holder=EXCLUDED.holder, "expiresAt"=EXCLUDED."expiresAt", "updatedAt"=EXCLUDED."updatedAt"
+	WHERE service_leases.holder=EXCLUDED.holder OR service_leases."expiresAt" < EXCLUDED."updatedAt"`
+
+	deleteServiceLease = `DELETE FROM service_leases WHERE name=$1 AND holder=$2`
 
 	insertCollectionPaymentAllocation = `INSERT INTO collection_payment_allocations
 	(farm_id, farm_payment_id, collection_id, collection_allocation_amount_btc, cudo_general_fee_btc, cudo_maintenance_fee_btc, farm_unsold_leftover_btc, farm_maintenance_fee_btc, "createdAt", "updatedAt") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
@@ -0,0 +1,112 @@
+package sql_db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPauseFarm(t *testing.T) {
+	ctx := context.Background()
+	sdb := newTestSqlDB(t)
+	_, err := sdb.MigrateUp(ctx)
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	sdb.MustExec(`INSERT INTO farms (id, name, sub_account_name, rewards_from_pool_btc_wallet_name, total_farm_hashrate, address_for_receiving_rewards_from_pool,
+		leftover_reward_payout_address, maintenance_fee_payout_address, maintenance_fee_in_btc, status, farm_start_time, created_at, updated_at)
+		VALUES (1, 'farm_1', 'farm_1', 'farm_1', 1200, 'address_1', 'leftover_address_1', 'maintenance_fee_address_1', 1, 'approved', $1, $2, $3)`, now, now, now)
+
+	require.NoError(t, sdb.PauseFarm(ctx, 1))
+	// pausing a paused farm does nothing
+	require.NoError(t, sdb.PauseFarm(ctx, 1))
+	require.ErrorIs(t, sdb.PauseFarm(ctx, 2), sql.ErrNoRows)
+
+	pausedFarmIds, err := sdb.GetPausedFarmIds(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1}, pausedFarmIds)
+}
+
+func TestSetAndDeleteFarmSchedule(t *testing.T) {
+	ctx := context.Background()
+	sdb := newTestSqlDB(t)
+	_, err := sdb.MigrateUp(ctx)
+	require.NoError(t, err)
+
+	lastRunAt := time.Unix(1666641078, 0).UTC()
+	require.NoError(t, sdb.SaveFarmLastRun(ctx, 1, lastRunAt))
+	require.NoError(t, sdb.SetFarmSchedule(ctx, 1, "0 2 * * *", "Europe/Sofia"))
+
+	farmSchedules, err := sdb.GetFarmSchedules(ctx)
+	require.NoError(t, err)
+	require.Len(t, farmSchedules, 1)
+	require.Equal(t, "0 2 * * *", farmSchedules[0].Schedule)
+	require.Equal(t, "Europe/Sofia", farmSchedules[0].Timezone)
+
+	require.NoError(t, sdb.DeleteFarmSchedule(ctx, 1))
+
+	// the override is cleared and the time of the last run is kept
+	farmSchedules, err = sdb.GetFarmSchedules(ctx)
+	require.NoError(t, err)
+	require.Len(t, farmSchedules, 1)
+	require.Empty(t, farmSchedules[0].Schedule)
+	require.Empty(t, farmSchedules[0].Timezone)
+	require.True(t, lastRunAt.Equal(*farmSchedules[0].LastRunAt))
+}
+
+func TestFinalizePayoutIntent_ConcurrentFarmPayments(t *testing.T) {
+	ctx := context.Background()
+	sdb := newLedgerTestSqlDB(t)
+	require.NoError(t, sdb.SetInitialAccumulatedAmountForAddress(ctx, "owner_address", 2, 0))
+	require.NoError(t, sdb.SetInitialAccumulatedAmountForAddress(ctx, "cudo_fee_address", 2, 0))
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		farmId := int64(i + 1)
+		intent := newLedgerTestIntent(2000000)
+		intent.IdempotencyKey = fmt.Sprintf("%d:utxo_tx_hash_%d", farmId, farmId)
+		intent.FarmId = farmId
+		intent.UTXOTxHash = fmt.Sprintf("utxo_tx_hash_%d", farmId)
+		intent.Payload.FarmSubAccountName = fmt.Sprintf("farm_wallet_%d", farmId)
+		intent.Payload.CollectionPaymentAllocations = []types.CollectionPaymentAllocation{
+			{CollectionId: farmId * 10, CollectionAllocationAmount: 98000000},
+			{CollectionId: farmId*10 + 1, CollectionAllocationAmount: 0},
+		}
+		intent.Payload.NftStatistics = []types.NFTStatistics{
+			{DenomId: fmt.Sprintf("denom_%d", farmId), TokenId: "1", Reward: 98000000},
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = sdb.FinalizePayoutIntent(ctx, intent, fmt.Sprintf("payout_tx_hash_%d", farmId))
+		}(i)
+	}
+	wg.Wait()
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+
+	var allocations []types.CollectionPaymentAllocation
+	require.NoError(t, sdb.SelectContext(ctx, &allocations, `SELECT * FROM collection_payment_allocations`))
+	require.Len(t, allocations, 4)
+	for _, allocation := range allocations {
+		var paymentFarmId int64
+		require.NoError(t, sdb.GetContext(ctx, &paymentFarmId, `SELECT farm_id FROM farm_payment_statistics WHERE id = $1`, allocation.FarmPaymentId))
+		require.Equal(t, allocation.FarmId, paymentFarmId, "the allocation references the payment of its own farm")
+		require.Equal(t, allocation.FarmId, allocation.CollectionId/10)
+	}
+
+	for farmId := int64(1); farmId <= 2; farmId++ {
+		var paymentFarmId int64
+		require.NoError(t, sdb.GetContext(ctx, &paymentFarmId, `SELECT p.farm_id FROM statistics_nft_payout_history h
+			JOIN farm_payment_statistics p ON p.id = h.farm_payment_id WHERE h.denom_id = $1`, fmt.Sprintf("denom_%d", farmId)))
+		require.Equal(t, farmId, paymentFarmId, "the nft payout references the payment of its own farm")
+	}
+}
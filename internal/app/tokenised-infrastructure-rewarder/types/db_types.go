@@ -13,11 +13,11 @@ type Farm struct {
 	SubAccountName               string `db:"sub_account_name"`
 	RewardsFromPoolBtcWalletName string `db:"rewards_from_pool_btc_wallet_name"`
 	// Location                           string  `db:"location"`
-	TotalHashPower                     float64 `db:"total_farm_hashrate"`
-	AddressForReceivingRewardsFromPool string  `db:"address_for_receiving_rewards_from_pool"`
-	LeftoverRewardPayoutAddress        string  `db:"leftover_reward_payout_address"`
-	MaintenanceFeePayoutAddress        string  `db:"maintenance_fee_payout_address"`
-	MaintenanceFeeInBtc                float64 `db:"maintenance_fee_in_btc"`
+	TotalHashPower                     HashPower `db:"total_farm_hashrate"`
+	AddressForReceivingRewardsFromPool string    `db:"address_for_receiving_rewards_from_pool"`
+	LeftoverRewardPayoutAddress        string    `db:"leftover_reward_payout_address"`
+	MaintenanceFeePayoutAddress        string    `db:"maintenance_fee_payout_address"`
+	MaintenanceFeeInBtc                float64   `db:"maintenance_fee_in_btc"`
 	// Manufacturers                      []uint8 `db:"manufacturers"`
 	// MinerTypes                         []uint8 `db:"miner_types"`
 	// EnergySource                       []uint8 `db:"energy_source"`
@@ -38,15 +38,15 @@ type Farm struct {
 }
 
 type NFTStatistics struct {
-	Id                       string          `db:"id"`
-	TokenId                  string          `db:"token_id"`
-	DenomId                  string          `db:"denom_id"`
-	FarmPaymentId            int64           `db:"farm_payment_id"`
-	PayoutPeriodStart        int64           `db:"payout_period_start"`
-	PayoutPeriodEnd          int64           `db:"payout_period_end"`
-	Reward                   decimal.Decimal `db:"reward"`
-	MaintenanceFee           decimal.Decimal `db:"maintenance_fee"`
-	CUDOPartOfMaintenanceFee decimal.Decimal `db:"cudo_part_of_maintenance_fee"`
+	Id                       string `db:"id"`
+	TokenId                  string `db:"token_id"`
+	DenomId                  string `db:"denom_id"`
+	FarmPaymentId            int64  `db:"farm_payment_id"`
+	PayoutPeriodStart        int64  `db:"payout_period_start"`
+	PayoutPeriodEnd          int64  `db:"payout_period_end"`
+	Reward                   Sats   `db:"reward"`
+	MaintenanceFee           Sats   `db:"maintenance_fee"`
+	CUDOPartOfMaintenanceFee Sats   `db:"cudo_part_of_maintenance_fee"`
 	NFTOwnersForPeriod       []NFTOwnerInformation
 	TxHash                   string    `db:"tx_hash"`
 	CreatedAt                time.Time `db:"createdAt"`
@@ -70,15 +70,15 @@ type NFTStatisticsRepo struct {
 }
 
 type NFTOwnerInformation struct {
-	TimeOwnedFrom      int64           `db:"time_owned_from"`
-	TimeOwnedTo        int64           `db:"time_owned_to"`
-	TotalTimeOwned     int64           `db:"total_time_owned"`
-	PercentOfTimeOwned float64         `db:"percent_of_time_owned"`
-	Owner              string          `db:"owner"`
-	PayoutAddress      string          `db:"payout_address"`
-	Reward             decimal.Decimal `db:"reward"`
-	CreatedAt          time.Time       `db:"createdAt"`
-	UpdatedAt          time.Time       `db:"updatedAt"`
+	TimeOwnedFrom      int64     `db:"time_owned_from"`
+	TimeOwnedTo        int64     `db:"time_owned_to"`
+	TotalTimeOwned     int64     `db:"total_time_owned"`
+	PercentOfTimeOwned float64   `db:"percent_of_time_owned"`
+	Owner              string    `db:"owner"`
+	PayoutAddress      string    `db:"payout_address"`
+	Reward             Sats      `db:"reward"`
+	CreatedAt          time.Time `db:"createdAt"`
+	UpdatedAt          time.Time `db:"updatedAt"`
 }
 
 type NFTOwnerInformationRepo struct {
@@ -125,41 +125,133 @@ type UTXOTransaction struct {
 	UpdatedAt        time.Time `db:"updatedAt"`
 }
 
+// AddressThresholdAmountByFarm is the amount accumulated for an address in a farm until its payout threshold is reached.
+// AccruingSince is the time the amount started accumulating, it is nil while nothing is accumulated.
 type AddressThresholdAmountByFarm struct {
-	Id         string    `db:"id"`
-	BTCAddress string    `db:"btc_address"`
-	FarmId     string    `db:"farm_id"`
-	AmountBTC  string    `db:"amount_btc"`
-	CreatedAt  time.Time `db:"createdAt"`
-	UpdatedAt  time.Time `db:"updatedAt"`
+	Id            string     `db:"id"`
+	BTCAddress    string     `db:"btc_address"`
+	FarmId        string     `db:"farm_id"`
+	AmountBTC     string     `db:"amount_btc"`
+	AccruingSince *time.Time `db:"accruingSince"`
+	CreatedAt     time.Time  `db:"createdAt"`
+	UpdatedAt     time.Time  `db:"updatedAt"`
 }
 
 type FarmPayment struct {
-	Id        string          `db:"id"`
-	FarmId    int64           `db:"farm_id"`
-	AmountBTC decimal.Decimal `db:"amount_btc"`
-	CreatedAt time.Time       `db:"createdAt"`
-	UpdatedAt time.Time       `db:"updatedAt"`
+	Id        string    `db:"id"`
+	FarmId    int64     `db:"farm_id"`
+	AmountBTC Sats      `db:"amount_btc"`
+	CreatedAt time.Time `db:"createdAt"`
+	UpdatedAt time.Time `db:"updatedAt"`
+}
+
+// DestinationAddressWithAmount is what a farm payment allocated to an address.
+// If the threshold of the address was not reached the amount was accumulated and the tx hash is empty.
+type DestinationAddressWithAmount struct {
+	Id               int64     `db:"id"`
+	Address          string    `db:"address"`
+	AmountBTC        Sats      `db:"amount_btc"`
+	TxHash           string    `db:"tx_hash"`
+	FarmId           int64     `db:"farm_id"`
+	FarmPaymentId    int64     `db:"farm_payment_id"`
+	PayoutTime       int64     `db:"payout_time"`
+	ThresholdReached bool      `db:"threshold_reached"`
+	CrossFarm        bool      `db:"cross_farm"`
+	CreatedAt        time.Time `db:"createdAt"`
+	UpdatedAt        time.Time `db:"updatedAt"`
+}
+
+// AddressPayout is an amount sent to an address, with the status of the transaction that sent it
+type AddressPayout struct {
+	DestinationAddressWithAmount
+	Status           string `db:"status"`
+	ReplacedByTxHash string `db:"replaced_by_tx_hash"`
 }
 
 type CollectionPaymentAllocation struct {
-	Id                         int64           `db:"id"`
-	FarmId                     int64           `db:"farm_id"`
-	FarmPaymentId              int64           `db:"farm_payment_id"`
-	CollectionId               int64           `db:"collection_id"`
-	CollectionAllocationAmount decimal.Decimal `db:"collection_allocation_amount_btc"`
-	CUDOGeneralFee             decimal.Decimal `db:"cudo_general_fee_btc"`
-	CUDOMaintenanceFee         decimal.Decimal `db:"cudo_maintenance_fee_btc"`
-	FarmUnsoldLeftovers        decimal.Decimal `db:"farm_unsold_leftover_btc"`
-	FarmMaintenanceFee         decimal.Decimal `db:"farm_maintenance_fee_btc"`
-	CreatedAt                  time.Time       `db:"createdAt"`
-	UpdatedAt                  time.Time       `db:"updatedAt"`
+	Id                         int64     `db:"id"`
+	FarmId                     int64     `db:"farm_id"`
+	FarmPaymentId              int64     `db:"farm_payment_id"`
+	CollectionId               int64     `db:"collection_id"`
+	CollectionAllocationAmount Sats      `db:"collection_allocation_amount_btc"`
+	CUDOGeneralFee             Sats      `db:"cudo_general_fee_btc"`
+	CUDOMaintenanceFee         Sats      `db:"cudo_maintenance_fee_btc"`
+	FarmUnsoldLeftovers        Sats      `db:"farm_unsold_leftover_btc"`
+	FarmMaintenanceFee         Sats      `db:"farm_maintenance_fee_btc"`
+	CreatedAt                  time.Time `db:"createdAt"`
+	UpdatedAt                  time.Time `db:"updatedAt"`
 }
 
 type AuraPoolCollection struct {
-	Id           int64   `db:"id"`
-	DenomId      string  `db:"denom_id"`
-	HashingPower float64 `db:"hashing_power"`
+	Id           int64     `db:"id"`
+	DenomId      string    `db:"denom_id"`
+	HashingPower HashPower `db:"hashing_power"`
+}
+
+// FarmSchedule overrides the pay schedule of a farm. It also keeps the time of the last scheduled run of the farm,
+// so the schedule is followed no matter which replica runs the pay worker.
+type FarmSchedule struct {
+	FarmId    int64      `db:"farm_id"`
+	Schedule  string     `db:"schedule"`
+	Timezone  string     `db:"timezone"`
+	LastRunAt *time.Time `db:"lastRunAt"`
+	UpdatedAt time.Time  `db:"updatedAt"`
+}
+
+// FarmPayoutThreshold overrides the global payout threshold for the addresses paid by a farm.
+// A nil threshold keeps the global one, the farm addresses can be paid on every payment regardless of any threshold.
+type FarmPayoutThreshold struct {
+	FarmId                        int64     `db:"farm_id"`
+	ThresholdBtc                  *Sats     `db:"threshold_btc"`
+	SkipThresholdForFarmAddresses bool      `db:"skip_threshold_for_farm_addresses"`
+	UpdatedAt                     time.Time `db:"updatedAt"`
+}
+
+// AddressPayoutThreshold is the payout threshold the owner of an address picked, in every farm
+type AddressPayoutThreshold struct {
+	Address      string    `db:"address"`
+	ThresholdBtc Sats      `db:"threshold_btc"`
+	UpdatedAt    time.Time `db:"updatedAt"`
+}
+
+// PayoutIntent is written before the rewards for an UTXO are sent
+// so the bookkeeping can be finished or rolled back if the service dies after the send.
+type PayoutIntent struct {
+	IdempotencyKey string
+	FarmId         int64
+	UTXOTxHash     string
+	Payload        PayoutIntentPayload
+	Status         string
+	TxHash         string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+type PayoutIntentRepo struct {
+	IdempotencyKey string    `db:"idempotency_key"`
+	FarmId         int64     `db:"farm_id"`
+	UTXOTxHash     string    `db:"utxo_tx_hash"`
+	Payload        string    `db:"payload"`
+	Status         string    `db:"status"`
+	TxHash         string    `db:"tx_hash"`
+	CreatedAt      time.Time `db:"createdAt"`
+	UpdatedAt      time.Time `db:"updatedAt"`
+}
+
+// PayoutIntentPayload holds everything needed to finish the bookkeeping of a payout without recalculating it.
+type PayoutIntentPayload struct {
+	FarmSubAccountName                string                        `json:"farm_sub_account_name"`
+	PaymentTimestamp                  int64                         `json:"payment_timestamp"`
+	ReceivedRewardBtc                 Sats                          `json:"received_reward_btc"`
+	AddressesToSendBtc                map[string]Sats               `json:"addresses_to_send_btc"`
+	AddressesWithAmountInfo           map[string]AmountInfo         `json:"addresses_with_amount_info"`
+	AddressesWithThresholdToUpdateBtc map[string]Sats               `json:"addresses_with_threshold_to_update_btc"`
+	NftStatistics                     []NFTStatistics               `json:"nft_statistics"`
+	CollectionPaymentAllocations      []CollectionPaymentAllocation `json:"collection_payment_allocations"`
+	LedgerAllocations                 []LedgerAllocation            `json:"ledger_allocations"`
+	// Sweep is set for a payout of accumulated amounts without a received reward, e.g. a sweep or the cross-farm shares of the owners.
+	// It has no UTXO to mark as processed.
+	Sweep bool `json:"sweep,omitempty"`
 }
 
 const (
@@ -168,3 +260,69 @@ const (
 	TransactionFailed    = "Failed"
 	TransactionReplaced  = "Replaced"
 )
+
+const (
+	PayoutIntentPending    = "Pending"
+	PayoutIntentSent       = "Sent"
+	PayoutIntentCompleted  = "Completed"
+	PayoutIntentRolledBack = "RolledBack"
+)
+
+// The accounts of the ledger. The fee, maintenance, leftover and accrued accounts hold what is owed to an address until it is paid.
+const (
+	LedgerFarmIncome         = "farm_income"
+	LedgerCudoGeneralFee     = "cudo_general_fee"
+	LedgerCudoMaintenanceFee = "cudo_maintenance_fee"
+	LedgerFarmMaintenance    = "farm_maintenance"
+	LedgerFarmLeftover       = "farm_leftover"
+	LedgerOwnerAccrued       = "owner_accrued"
+	LedgerAddressPaid        = "address_paid"
+	LedgerNetworkFee         = "network_fee"
+)
+
+// LedgerAllocation is the part of a farm payment that is owed to an address through one of the ledger accounts
+type LedgerAllocation struct {
+	Account   string `json:"account"`
+	Address   string `json:"address"`
+	AmountBtc Sats   `json:"amount_btc"`
+}
+
+// LedgerEntry is a single line of the append-only ledger. Debits are positive and credits are negative,
+// so the entries of each journal sum up to zero.
+type LedgerEntry struct {
+	Id            int64           `db:"id"`
+	Journal       string          `db:"journal"`
+	FarmId        int64           `db:"farm_id"`
+	FarmPaymentId int64           `db:"farm_payment_id"`
+	Account       string          `db:"account"`
+	Address       string          `db:"address"`
+	AmountBtc     decimal.Decimal `db:"amount_btc"`
+	TxHash        string          `db:"tx_hash"`
+	CreatedAt     time.Time       `db:"createdAt"`
+}
+
+// NetworkFee is the fee paid to the miners for a confirmed payout transaction
+type NetworkFee struct {
+	TxHash        string
+	FarmPaymentId int64
+	FeeBtc        Sats
+}
+
+// The moments the price of a bitcoin is captured at
+const (
+	BtcPriceEventFarmPayment = "farm_payment"
+	BtcPriceEventSendMany    = "send_many"
+)
+
+// BtcPrice is the price of a bitcoin in a fiat currency at the moment of an event.
+// The reference of a farm payment price is the hash of its UTXO, the one of a send price is the hash of the transaction.
+type BtcPrice struct {
+	Id         int64           `db:"id"`
+	Event      string          `db:"event"`
+	Reference  string          `db:"reference"`
+	FarmId     int64           `db:"farm_id"`
+	Currency   string          `db:"currency"`
+	Price      decimal.Decimal `db:"price"`
+	Source     string          `db:"source"`
+	CapturedAt time.Time       `db:"capturedAt"`
+}
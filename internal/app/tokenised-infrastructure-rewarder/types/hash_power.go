@@ -0,0 +1,130 @@
+package types
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrHashPowerPrecision is returned for a hash power written with more precision than a float64 can hold
+var ErrHashPowerPrecision = errors.New("hash power has more precision than a float64 can hold")
+
+// HashPower is an amount of hash power in TH/s, kept as an exact decimal.
+// The ratios of hash powers are computed on the exact values, so no float error leaks into the reward shares.
+type HashPower struct {
+	th decimal.Decimal
+}
+
+// NewHashPowerFromTh returns the hash power of the given TH/s
+func NewHashPowerFromTh(th decimal.Decimal) HashPower {
+	return HashPower{th: th}
+}
+
+// NewHashPowerFromInt returns the hash power of the given whole TH/s
+func NewHashPowerFromInt(th int64) HashPower {
+	return HashPower{th: decimal.NewFromInt(th)}
+}
+
+// ParseHashPower parses a hash power in TH/s
+func ParseHashPower(th string) (HashPower, error) {
+	thDecimal, err := decimal.NewFromString(th)
+	if err != nil {
+		return HashPower{}, fmt.Errorf("invalid hash power {%s}: %s", th, err)
+	}
+
+	return HashPower{th: thDecimal}, nil
+}
+
+// Th returns the hash power in TH/s
+func (h HashPower) Th() decimal.Decimal {
+	return h.th
+}
+
+func (h HashPower) Add(other HashPower) HashPower {
+	return HashPower{th: h.th.Add(other.th)}
+}
+
+func (h HashPower) Sub(other HashPower) HashPower {
+	return HashPower{th: h.th.Sub(other.th)}
+}
+
+func (h HashPower) IsPositive() bool {
+	return h.th.IsPositive()
+}
+
+func (h HashPower) Equal(other HashPower) bool {
+	return h.th.Equal(other.th)
+}
+
+func (h HashPower) GreaterThan(other HashPower) bool {
+	return h.th.GreaterThan(other.th)
+}
+
+func (h HashPower) String() string {
+	return h.th.String()
+}
+
+// MarshalJSON writes the hash power as a json number in TH/s
+func (h HashPower) MarshalJSON() ([]byte, error) {
+	return []byte(h.th.String()), nil
+}
+
+// UnmarshalJSON reads a hash power in TH/s, given as a json number or string.
+// The nft data is written by clients that hold the hash power in a float64,
+// so a number with more precision than that was rounded by someone and is rejected instead of being rounded again.
+func (h *HashPower) UnmarshalJSON(data []byte) error {
+	literal := strings.Trim(string(data), `"`)
+
+	hashPower, err := ParseHashPower(literal)
+	if err != nil {
+		return err
+	}
+
+	float, err := strconv.ParseFloat(literal, 64)
+	if err != nil || !decimal.NewFromFloat(float).Equal(hashPower.th) {
+		return fmt.Errorf("%w: {%s}", ErrHashPowerPrecision, literal)
+	}
+
+	*h = hashPower
+	return nil
+}
+
+// Value writes the hash power in TH/s to the db
+func (h HashPower) Value() (driver.Value, error) {
+	return h.th.String(), nil
+}
+
+// Scan reads a hash power in TH/s from the db.
+// Columns that still are floating point are read by the shortest decimal that is the same float.
+func (h *HashPower) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case []byte:
+		return h.scanString(string(value))
+	case string:
+		return h.scanString(value)
+	case float64:
+		*h = HashPower{th: decimal.NewFromFloat(value)}
+	case int64:
+		*h = NewHashPowerFromInt(value)
+	case nil:
+		*h = HashPower{}
+	default:
+		return fmt.Errorf("can not scan %T into a hash power", src)
+	}
+
+	return nil
+}
+
+func (h *HashPower) scanString(value string) error {
+	hashPower, err := ParseHashPower(value)
+	if err != nil {
+		return err
+	}
+
+	*h = hashPower
+	return nil
+}
@@ -0,0 +1,37 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPower_UnmarshalJSON(t *testing.T) {
+	var nftDataJson NFTDataJson
+	require.NoError(t, json.Unmarshal([]byte(`{"expiration_date": 1, "hash_rate_owned": 0.1}`), &nftDataJson))
+	require.Equal(t, "0.1", nftDataJson.HashRateOwned.String())
+
+	require.NoError(t, json.Unmarshal([]byte(`{"hash_rate_owned": "960"}`), &nftDataJson))
+	require.Equal(t, "960", nftDataJson.HashRateOwned.String())
+
+	err := json.Unmarshal([]byte(`{"hash_rate_owned": 0.12345678901234567891}`), &nftDataJson)
+	require.True(t, errors.Is(err, ErrHashPowerPrecision))
+
+	err = json.Unmarshal([]byte(`{"hash_rate_owned": 123456789012345678901}`), &nftDataJson)
+	require.True(t, errors.Is(err, ErrHashPowerPrecision))
+
+	require.Error(t, json.Unmarshal([]byte(`{"hash_rate_owned": "fast"}`), &nftDataJson))
+}
+
+func TestHashPower_Scan(t *testing.T) {
+	var hashPower HashPower
+	require.NoError(t, hashPower.Scan([]byte("1674.01")))
+	require.Equal(t, "1674.01", hashPower.String())
+
+	require.NoError(t, hashPower.Scan(0.1))
+	require.Equal(t, "0.1", hashPower.String())
+
+	require.Error(t, hashPower.Scan(true))
+}
@@ -0,0 +1,184 @@
+package types
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// Sats is an amount of bitcoin in satoshis, the smallest amount that can be sent.
+// Amounts are split in satoshis, so every split adds up exactly to the amount that is split.
+// In the db and in json the amount is written in BTC, with at most 8 decimals.
+type Sats int64
+
+const SatsPerBtc = 100000000
+
+// NewSatsFromBtc converts an amount in BTC to satoshis, rounded to the nearest satoshi
+func NewSatsFromBtc(btc decimal.Decimal) Sats {
+	return Sats(btc.Shift(8).Round(0).IntPart())
+}
+
+// NewSatsFromBtcFloat converts an amount in BTC that was already read as a float, e.g. from an old float column of the db.
+// Amounts with at most 8 decimals are exact, the shortest decimal representation of the float is that amount.
+// Amounts from the btc node and the config are parsed from their text instead.
+func NewSatsFromBtcFloat(btc float64) Sats {
+	return NewSatsFromBtc(decimal.NewFromFloat(btc))
+}
+
+// ParseSats parses an amount in BTC
+func ParseSats(btc string) (Sats, error) {
+	btcDecimal, err := decimal.NewFromString(btc)
+	if err != nil {
+		return 0, fmt.Errorf("invalid BTC amount {%s}: %s", btc, err)
+	}
+
+	return NewSatsFromBtc(btcDecimal), nil
+}
+
+// Btc returns the amount in BTC
+func (s Sats) Btc() decimal.Decimal {
+	return decimal.New(int64(s), -8)
+}
+
+// FiatValue returns the value of the amount at the price of a bitcoin, rounded to cents
+func (s Sats) FiatValue(btcPrice decimal.Decimal) decimal.Decimal {
+	return s.Btc().Mul(btcPrice).Round(2)
+}
+
+func (s Sats) String() string {
+	return s.Btc().String()
+}
+
+// Share returns the part of the amount that part is of whole, rounded down to the satoshi.
+// The satoshis that are rounded off are left to the caller, who has to give them to someone.
+func (s Sats) Share(part, whole decimal.Decimal) Sats {
+	if s <= 0 || !part.IsPositive() || !whole.IsPositive() {
+		return 0
+	}
+
+	share, _ := decimal.NewFromInt(int64(s)).Mul(part).QuoRem(whole, 0)
+	return Sats(share.IntPart())
+}
+
+// Percent returns the given percent of the amount, rounded down to the satoshi
+func (s Sats) Percent(percent decimal.Decimal) Sats {
+	return s.Share(percent, decimal.NewFromInt(100))
+}
+
+/*
+Allocate splits the amount by the weights with the largest remainder method, so the shares always add up to the amount.
+
+ 1. Every share is rounded down to the satoshi.
+ 2. The satoshis that are left are given one by one to the shares with the largest remainders.
+    On equal remainders the earlier share gets the satoshi first.
+ 3. If no weight is positive the whole amount is given to the last share.
+*/
+func (s Sats) Allocate(weights []decimal.Decimal) []Sats {
+	shares := make([]Sats, len(weights))
+	if len(weights) == 0 || s <= 0 {
+		return shares
+	}
+
+	var totalWeight decimal.Decimal
+	for _, weight := range weights {
+		if weight.IsPositive() {
+			totalWeight = totalWeight.Add(weight)
+		}
+	}
+
+	if !totalWeight.IsPositive() {
+		shares[len(shares)-1] = s
+		return shares
+	}
+
+	amount := decimal.NewFromInt(int64(s))
+	remainders := make([]decimal.Decimal, len(weights))
+	left := s
+	for i, weight := range weights {
+		if !weight.IsPositive() {
+			continue
+		}
+
+		share, remainder := amount.Mul(weight).QuoRem(totalWeight, 0)
+		shares[i] = Sats(share.IntPart())
+		remainders[i] = remainder
+		left -= shares[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return remainders[order[i]].GreaterThan(remainders[order[j]])
+	})
+
+	for i := 0; left > 0; i++ {
+		shares[order[i]]++
+		left--
+	}
+
+	return shares
+}
+
+// SumSats adds up the amounts
+func SumSats(amounts ...Sats) Sats {
+	var sum Sats
+	for _, amount := range amounts {
+		sum += amount
+	}
+	return sum
+}
+
+// MarshalJSON writes the amount as a json number in BTC, as the btc node expects it
+func (s Sats) MarshalJSON() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalJSON reads an amount in BTC, given as a json number or string
+func (s *Sats) UnmarshalJSON(data []byte) error {
+	sats, err := ParseSats(strings.Trim(string(data), `"`))
+	if err != nil {
+		return err
+	}
+
+	*s = sats
+	return nil
+}
+
+// Value writes the amount in BTC to the db
+func (s Sats) Value() (driver.Value, error) {
+	return s.String(), nil
+}
+
+// Scan reads an amount in BTC from the db.
+// Statistics saved before the amounts were kept in satoshis can have fractions of a satoshi, they are rounded to the nearest satoshi.
+func (s *Sats) Scan(src interface{}) error {
+	var sats Sats
+	var err error
+
+	switch value := src.(type) {
+	case []byte:
+		sats, err = ParseSats(string(value))
+	case string:
+		sats, err = ParseSats(value)
+	case float64:
+		sats = NewSatsFromBtcFloat(value)
+	case int64:
+		sats = NewSatsFromBtc(decimal.NewFromInt(value))
+	case nil:
+		sats = 0
+	default:
+		err = fmt.Errorf("can not scan %T into a BTC amount", src)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	*s = sats
+	return nil
+}
@@ -0,0 +1,75 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSats_Allocate(t *testing.T) {
+	amount := Sats(100)
+
+	shares := amount.Allocate([]decimal.Decimal{decimal.NewFromInt(1), decimal.NewFromInt(1), decimal.NewFromInt(1)})
+	require.Equal(t, []Sats{34, 33, 33}, shares)
+
+	shares = amount.Allocate([]decimal.Decimal{decimal.NewFromInt(1), decimal.NewFromInt(2), decimal.NewFromInt(4)})
+	require.Equal(t, []Sats{14, 29, 57}, shares)
+	require.Equal(t, amount, SumSats(shares...))
+
+	shares = amount.Allocate([]decimal.Decimal{decimal.Zero, decimal.Zero})
+	require.Equal(t, []Sats{0, 100}, shares)
+}
+
+func TestSats_Share(t *testing.T) {
+	require.Equal(t, Sats(33), Sats(100).Share(decimal.NewFromInt(1), decimal.NewFromInt(3)))
+	require.Equal(t, Sats(20), Sats(101).Percent(decimal.NewFromInt(20)))
+	require.Equal(t, Sats(0), Sats(100).Share(decimal.NewFromInt(1), decimal.Zero))
+}
+
+func TestSats_FiatValue(t *testing.T) {
+	require.Equal(t, "9037.04", Sats(30000000).FiatValue(decimal.RequireFromString("30123.456789")).String())
+	require.Equal(t, "0", Sats(1).FiatValue(decimal.RequireFromString("30123.45")).String())
+}
+
+func TestSats_ConvertBtc(t *testing.T) {
+	require.Equal(t, Sats(625000000), NewSatsFromBtcFloat(6.25))
+	require.Equal(t, Sats(12258064), NewSatsFromBtcFloat(0.12258064))
+	require.Equal(t, "0.00000001", Sats(1).String())
+
+	sats, err := ParseSats("0.000000016")
+	require.NoError(t, err)
+	require.Equal(t, Sats(2), sats)
+
+	_, err = ParseSats("one")
+	require.Error(t, err)
+
+	data, err := json.Marshal(map[string]Sats{"address": 12345678})
+	require.NoError(t, err)
+	require.Equal(t, `{"address":0.12345678}`, string(data))
+
+	var amount Sats
+	require.NoError(t, json.Unmarshal([]byte(`"1.5"`), &amount))
+	require.Equal(t, Sats(150000000), amount)
+}
+
+func TestUnspentTx_ExactAmount(t *testing.T) {
+	// 20999999.99999999 BTC has more digits than a float64 keeps
+	var unspentTxs []UnspentTx
+	require.NoError(t, json.Unmarshal([]byte(`[{"txid":"utxo","vout":1,"address":"address","amount":20999999.99999999,"confirmations":6,"spendable":true}]`), &unspentTxs))
+	require.Len(t, unspentTxs, 1)
+	require.Equal(t, Sats(2099999999999999), unspentTxs[0].Amount)
+	require.Equal(t, uint32(1), unspentTxs[0].Vout)
+}
+
+func TestBtcWalletTransaction_ExactAmounts(t *testing.T) {
+	var tx BtcWalletTransaction
+	require.NoError(t, json.Unmarshal([]byte(`{"amount":-20999999.99999999,"fee":-0.00000141,"txid":"tx_hash","comment":"key",
+		"details":[{"address":"address","category":"send","amount":-20999999.99999999,"vout":0,"fee":-0.00000141,"abandoned":false}]}`), &tx))
+	require.Equal(t, Sats(-2099999999999999), tx.Amount)
+	require.Equal(t, Sats(-141), tx.Fee)
+	require.Len(t, tx.Details, 1)
+	require.Equal(t, Sats(-2099999999999999), tx.Details[0].Amount)
+	require.Equal(t, Sats(-141), tx.Details[0].Fee)
+}
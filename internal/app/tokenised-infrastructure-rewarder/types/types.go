@@ -2,7 +2,6 @@ package types
 
 import (
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/shopspring/decimal"
 )
 
 type Collection struct {
@@ -32,8 +31,8 @@ type NFT struct {
 }
 
 type NFTDataJson struct {
-	ExpirationDate int64   `json:"expiration_date"`
-	HashRateOwned  float64 `json:"hash_rate_owned"`
+	ExpirationDate int64     `json:"expiration_date"`
+	HashRateOwned  HashPower `json:"hash_rate_owned"`
 }
 
 type BtcNetworkParams struct {
@@ -42,13 +41,18 @@ type BtcNetworkParams struct {
 }
 
 type AmountInfo struct {
-	Amount           decimal.Decimal
+	Amount           Sats
 	ThresholdReached bool
+	// CrossFarm is set when the threshold was reached by the amounts accumulated for the owner in all farms together.
+	// The farm that finds it holds the amount, without ThresholdReached, until the shares of the other farms are sent.
+	CrossFarm bool `json:",omitempty"`
 }
 
+// BtcWalletTransaction is a transaction of a wallet, as returned by gettransaction and listtransactions.
+// The amounts are parsed from the json numbers of the node, like the amounts of UnspentTx.
 type BtcWalletTransaction struct {
-	Amount            float64                       `json:"amount"`
-	Fee               float64                       `json:"fee"`
+	Amount            Sats                          `json:"amount"`
+	Fee               Sats                          `json:"fee"`
 	Confirmations     int64                         `json:"confirmations"`
 	Trusted           bool                          `json:"trusted"`
 	Txid              string                        `json:"txid"`
@@ -60,13 +64,27 @@ type BtcWalletTransaction struct {
 	ReplacesTxid      string                        `json:"replaces_txid"`
 	Details           []BtcWalletTransactionDetails `json:"details"`
 	Hex               string                        `json:"hex"`
+	Comment           string                        `json:"comment"`
+}
+
+// UnspentTx is an unspent output of a wallet, as listed by listunspent.
+// The amount is parsed from the json number of the node, so it is exact without going through a float.
+type UnspentTx struct {
+	TxID          string `json:"txid"`
+	Vout          uint32 `json:"vout"`
+	Address       string `json:"address"`
+	Label         string `json:"label"`
+	ScriptPubKey  string `json:"scriptPubKey"`
+	Amount        Sats   `json:"amount"`
+	Confirmations int64  `json:"confirmations"`
+	Spendable     bool   `json:"spendable"`
 }
 
 type BtcWalletTransactionDetails struct {
-	Address   string  `json:"address"`
-	Category  string  `json:"category"`
-	Amount    float64 `json:"amount"`
-	Vout      uint64  `json:"vout"`
-	Fee       float64 `json:"fee"`
-	Abandoned bool    `json:"abandoned"`
+	Address   string `json:"address"`
+	Category  string `json:"category"`
+	Amount    Sats   `json:"amount"`
+	Vout      uint64 `json:"vout"`
+	Fee       Sats   `json:"fee"`
+	Abandoned bool   `json:"abandoned"`
 }
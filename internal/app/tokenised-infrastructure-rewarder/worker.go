@@ -2,13 +2,17 @@ package tokenised_infrastructure_rewarder
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"sync"
 	"time"
 
 	_ "github.com/lib/pq"
 
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/notifier"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/resilience"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/schedule"
 	services "github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/services"
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/sql_db"
 	"github.com/btcsuite/btcd/rpcclient"
@@ -16,21 +20,44 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
-func Start(ctx context.Context, ctxCancel context.CancelFunc, config *infrastructure.Config, service Service, provider Provider, mutex *sync.Mutex, interval time.Duration) {
+// Start runs the service on its schedule until the context is done. A run triggered through the admin api is forced, see services.WithForcedRun.
+// The pay and retry workers share the wallet locks, so they wait on each other only when working with the same wallet.
+// The service is executed only while this replica is the leader and the run is canceled if the lease is lost.
+// While a dependency of the service is unavailable, its runs are paused instead of counted as errors.
+// Failures are retried with exponential backoff. The errors of the service are counted until a run succeeds.
+func Start(ctx context.Context, ctxCancel context.CancelFunc, config *infrastructure.Config, service Service, provider Provider, walletLocks *services.WalletLocks, leader *Leader, alerts services.Alerter, breakers *resilience.Breakers, workerSchedule schedule.Schedule, control *Control) {
 	log.Info().Msg("Application worker starting")
 
+	backoff := resilience.Backoff{Initial: config.WorkerFailureRetryDelay, Max: config.WorkerFailureRetryMaxDelay}
+	failures := 0
+
 	retry := func(err error) {
-		log.Error().Msgf("retry error: %s", err)
+		failures++
+		delay := backoff.Delay(failures)
+		log.Error().Msgf("retry error: %s, retrying in %s", err, delay)
 
-		ticker := time.NewTicker(config.WorkerFailureRetryDelay)
-		defer ticker.Stop()
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
 
 		select {
-		case <-ticker.C:
+		case <-timer.C:
 		case <-ctx.Done():
 		}
 	}
 
+	dbBreaker := breakers.Get(metrics.EndpointDb)
+
+	// the ping is also the probe of the db breaker when it is half-open
+	pingDb := func(db *sqlx.DB) error {
+		if err := dbBreaker.Allow(); err != nil {
+			return err
+		}
+
+		err := db.PingContext(ctx)
+		dbBreaker.Record(err != nil && ctx.Err() == nil)
+		return err
+	}
+
 	errorCount := 0
 
 	for ctx.Err() == nil {
@@ -46,66 +73,160 @@ func Start(ctx context.Context, ctxCancel context.CancelFunc, config *infrastruc
 
 			db, err := provider.InitDBConnection()
 			if err != nil {
+				dbBreaker.Record(true)
 				retry(err)
 				return
 			}
 			defer db.Close()
 
+			if err := sql_db.NewSqlDB(db).CheckSchemaVersion(ctx); err != nil {
+				retry(err)
+				return
+			}
+
+			control.setReady(true)
+			defer control.setReady(false)
+
 			for processingError == nil {
-				ticker := time.NewTicker(interval)
-				defer ticker.Stop()
-
-				select {
-				case <-ticker.C:
-					mutex.Lock()
-					processingError = service.Execute(ctx, rpcClient, sql_db.NewSqlDB(db))
-					mutex.Unlock()
-				case <-ctx.Done():
+				forced, ok := waitForRun(ctx, workerSchedule, control)
+				if !ok {
 					return
 				}
+
+				runCtx, cancelRun, isLeader := leader.Context(ctx)
+				control.setLeader(isLeader)
+				if !isLeader {
+					log.Debug().Msgf("Skipping {%s} run, this replica is not the leader", control.service)
+					continue
+				}
+
+				if blocked := breakers.Blocked(service.Dependencies()...); len(blocked) > 0 {
+					cancelRun()
+					log.Warn().Msgf("Skipping {%s} run, unavailable dependencies: %v", control.service, blocked)
+					continue
+				}
+
+				if forced {
+					runCtx = services.WithForcedRun(runCtx)
+				}
+
+				control.runStarted()
+				start := time.Now()
+				dependencyFailures := breakers.TotalFailures(service.Dependencies()...)
+				btcClient := services.NewInstrumentedBtcClient(services.NewBtcNodeClient(rpcClient, provider.InitBtcWalletRpcClient, walletLocks), breakers.Get(metrics.EndpointBitcoind))
+				processingError = service.Execute(runCtx, btcClient, sql_db.NewSqlDB(db))
+				cancelRun()
+
+				// the run was canceled because another replica took over, which is not an error of the service
+				if processingError != nil && ctx.Err() == nil && !leader.IsLeader() {
+					log.Warn().Msgf("Lost the lease during {%s} run: %s", control.service, processingError)
+					processingError = nil
+				}
+
+				metrics.ObserveWorkerRun(control.service, start, processingError)
+				control.runEnded(processingError)
+
+				if processingError == nil {
+					failures = 0
+					errorCount = 0
+					alerts.Resolve(ctx, workerAlertSource(control.service))
+					continue
+				}
+
+				// the service is fine, it just has to wait until its dependencies are back.
+				// A failure recorded by a breaker during the run is a dependency error, even if the breaker did not open yet.
+				if errors.Is(processingError, resilience.ErrOpen) || breakers.TotalFailures(service.Dependencies()...) > dependencyFailures ||
+					len(breakers.Blocked(service.Dependencies()...)) > 0 || pingDb(db) != nil {
+					dependencyUnavailable(ctx, alerts, control.service, processingError)
+					processingError = nil
+				}
 			}
 
 			// TODO: https://medium.com/htc-research-engineering-blog/handle-golang-errors-with-stacktrace-1caddf6dab07
 			if processingError != nil {
 				errorCount++
-				errorEncountered(config, processingError, errorCount)
+				errorEncountered(ctx, alerts, control.service, processingError, errorCount)
 				if errorCount >= config.ServiceMaxErrorCount {
-					maxErrorCountReached(config, processingError)
+					maxErrorCountReached(ctx, config, alerts, control.service, processingError)
 					ctxCancel()
 					return
 				}
+				retry(processingError)
 			}
 		}()
 	}
 }
 
-var mSendMail = sendMail
+// waitForRun waits until the next run time of the schedule or until a run is triggered through the admin api.
+// Returns false if the context is done.
+func waitForRun(ctx context.Context, workerSchedule schedule.Schedule, control *Control) (forced bool, ok bool) {
+	var timerC <-chan time.Time
+	nextRun := workerSchedule.Next(time.Now())
+	if nextRun.IsZero() {
+		log.Warn().Msgf("Schedule of {%s} has no next run, waiting for a manual trigger", control.service)
+	} else {
+		timer := time.NewTimer(time.Until(nextRun))
+		defer timer.Stop()
+		timerC = timer.C
+	}
+	control.setNextRun(nextRun)
+
+	select {
+	case <-timerC:
+		return false, true
+	case <-control.trigger:
+		log.Info().Msg("Run triggered manually")
+		return true, true
+	case <-ctx.Done():
+		return false, false
+	}
+}
 
-func maxErrorCountReached(config *infrastructure.Config, err error) {
+func dependencyUnavailable(ctx context.Context, alerts services.Alerter, service string, err error) {
+	message := fmt.Sprintf("Application is waiting for its dependencies to recover. Error: %s", err)
+	log.Warn().Msg(message)
+	alerts.Fire(ctx, workerAlertSource(service), notifier.Notification{
+		Severity: notifier.SeverityWarning,
+		Title:    "Dependency unavailable",
+		Message:  message,
+		Error:    err.Error(),
+	})
+}
+
+func maxErrorCountReached(ctx context.Context, config *infrastructure.Config, alerts services.Alerter, service string, err error) {
 	message := fmt.Sprintf("Application has exceeded the ServiceMaxErrorCount: {%d} and needs manual intervention!\n Error: {%s}", config.ServiceMaxErrorCount, err)
 	log.Error().Msg(message)
-	mSendMail(config, message)
+	alerts.Fire(ctx, workerAlertSource(service), notifier.Notification{
+		Severity: notifier.SeverityCritical,
+		Title:    "Application stopped",
+		Message:  message,
+		Error:    err.Error(),
+	})
 }
 
-func errorEncountered(config *infrastructure.Config, processingError error, errorCount int) {
+func errorEncountered(ctx context.Context, alerts services.Alerter, service string, processingError error, errorCount int) {
 	message := fmt.Sprintf("Application has encountered an error! Error: %s...Retrying for %d time", processingError, errorCount)
 	log.Error().Msg(message)
-	mSendMail(config, message)
+	alerts.Fire(ctx, workerAlertSource(service), notifier.Notification{
+		Severity: notifier.SeverityWarning,
+		Title:    "Application encountered an error",
+		Message:  message,
+		Error:    processingError.Error(),
+	})
 }
 
-func sendMail(config *infrastructure.Config, message string) {
-	h := infrastructure.NewHelper(config)
-	err := h.SendMail(message)
-	if err != nil {
-		panic(err)
-	}
+func workerAlertSource(service string) string {
+	return fmt.Sprintf("%s worker", service)
 }
 
 type Provider interface {
 	InitBtcRpcClient() (*rpcclient.Client, error)
+	InitBtcWalletRpcClient(walletName string) (*rpcclient.Client, error)
 	InitDBConnection() (*sqlx.DB, error)
 }
 
 type Service interface {
 	Execute(ctx context.Context, btcClient services.BtcClient, storage services.Storage) error
+	// Dependencies are the names of the external dependencies of the service, as used by the circuit breakers
+	Dependencies() []string
 }
@@ -3,14 +3,18 @@ package tokenised_infrastructure_rewarder
 import (
 	"context"
 	"errors"
-
+	"fmt"
 	"os"
-	"sync"
 	"testing"
 	"time"
 
 	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/infrastructure"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/metrics"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/notifier"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/resilience"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/schedule"
 	services "github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/services"
+	"github.com/CudoVentures/tokenised-infrastructure-rewarder/internal/app/tokenised-infrastructure-rewarder/sql_db"
 	"github.com/btcsuite/btcd/rpcclient"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
@@ -28,7 +32,7 @@ func TestWorkerShouldReturnIfContextIsCanceled(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel()
 
-	Start(ctx, cancel, &infrastructure.Config{}, nil, nil, &sync.Mutex{}, time.Second*1)
+	Start(ctx, cancel, &infrastructure.Config{}, nil, nil, services.NewWalletLocks(), newTestLeader(t), newTestAlerter(), resilience.NewBreakers(3, time.Minute), schedule.Every(time.Second), NewControl("test"))
 
 	require.Error(t, ctx.Err())
 }
@@ -53,18 +57,234 @@ func TestWorkerShouldReturnIfContextIsCanceledDuringProcessPayment(t *testing.T)
 
 	mp.On("InitBtcRpcClient").Return(client, nil)
 
-	db, err := sqlx.Connect("sqlite3", ":memory:")
-	require.NoError(t, err)
+	db := newTestDB(t)
 
 	mp.On("InitDBConnection").Return(db, nil)
 
 	Start(ctx, cancel, &infrastructure.Config{
 		WorkerFailureRetryDelay: 1 * time.Second,
-	}, mps, mp, &sync.Mutex{}, 1*time.Second)
+	}, mps, mp, services.NewWalletLocks(), newTestLeader(t), newTestAlerter(), resilience.NewBreakers(3, time.Minute), schedule.Every(1*time.Second), NewControl("test"))
 
 	require.Error(t, ctx.Err())
 }
 
+func TestWorkerShouldRunWhenTriggered(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mps := &mockPayService{}
+	mps.On("Execute", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		cancel()
+	})
+
+	mp := &mockProvider{}
+
+	connCfg := &rpcclient.ConnConfig{
+		HTTPPostMode: true,
+		DisableTLS:   true,
+	}
+
+	client, err := rpcclient.New(connCfg, nil)
+	require.NoError(t, err)
+
+	mp.On("InitBtcRpcClient").Return(client, nil)
+
+	db := newTestDB(t)
+
+	mp.On("InitDBConnection").Return(db, nil)
+
+	control := NewControl("test")
+	require.True(t, control.Trigger())
+	require.False(t, control.Trigger(), "only one run should be queued")
+
+	// the interval is long enough, so only the trigger can start the run
+	Start(ctx, cancel, &infrastructure.Config{
+		WorkerFailureRetryDelay: 1 * time.Second,
+	}, mps, mp, services.NewWalletLocks(), newTestLeader(t), newTestAlerter(), resilience.NewBreakers(3, time.Minute), schedule.Every(time.Hour), control)
+
+	mps.AssertNumberOfCalls(t, "Execute", 1)
+	mps.AssertCalled(t, "Execute", mock.MatchedBy(func(ctx context.Context) bool {
+		return services.IsForcedRun(ctx)
+	}), mock.Anything, mock.Anything)
+	require.False(t, control.Ready())
+	require.False(t, control.Status().LastRunEnded.IsZero())
+	require.True(t, control.Status().Leader)
+}
+
+func TestWorkerShouldNotRunWithoutLease(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mps := &mockPayService{}
+
+	mp := &mockProvider{}
+
+	connCfg := &rpcclient.ConnConfig{
+		HTTPPostMode: true,
+		DisableTLS:   true,
+	}
+
+	client, err := rpcclient.New(connCfg, nil)
+	require.NoError(t, err)
+
+	mp.On("InitBtcRpcClient").Return(client, nil)
+
+	db := newTestDB(t)
+
+	mp.On("InitDBConnection").Return(db, nil)
+
+	control := NewControl("test")
+	require.True(t, control.Trigger())
+
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		cancel()
+	}()
+
+	Start(ctx, cancel, &infrastructure.Config{
+		WorkerFailureRetryDelay: 1 * time.Second,
+	}, mps, mp, services.NewWalletLocks(), NewLeader(LeaseName, "standby", time.Hour), newTestAlerter(), resilience.NewBreakers(3, time.Minute), schedule.Every(100*time.Millisecond), control)
+
+	mps.AssertNotCalled(t, "Execute", mock.Anything, mock.Anything, mock.Anything)
+	require.False(t, control.Status().Leader)
+	require.True(t, control.Status().LastRunStarted.IsZero())
+}
+
+func TestWorkerShouldSkipRunWhileDependencyIsUnavailable(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mps := &mockPayService{}
+
+	mp := &mockProvider{}
+
+	client, err := rpcclient.New(&rpcclient.ConnConfig{HTTPPostMode: true, DisableTLS: true}, nil)
+	require.NoError(t, err)
+
+	mp.On("InitBtcRpcClient").Return(client, nil)
+
+	db := newTestDB(t)
+
+	mp.On("InitDBConnection").Return(db, nil)
+
+	breakers := resilience.NewBreakers(1, time.Hour)
+	breakers.Get(metrics.EndpointHasura).Record(true)
+
+	go func() {
+		time.Sleep(500 * time.Millisecond)
+		cancel()
+	}()
+
+	Start(ctx, cancel, &infrastructure.Config{
+		WorkerFailureRetryDelay: 1 * time.Second,
+	}, mps, mp, services.NewWalletLocks(), newTestLeader(t), newTestAlerter(), breakers, schedule.Every(100*time.Millisecond), NewControl("test"))
+
+	mps.AssertNotCalled(t, "Execute", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWorkerShouldNotCountDependencyFailures(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mps := &mockPayService{}
+	mps.On("Execute", mock.Anything, mock.Anything, mock.Anything).Return(fmt.Errorf("failed to get collections: %w: hasura", resilience.ErrOpen)).Twice()
+	mps.On("Execute", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		cancel()
+	})
+
+	mp := &mockProvider{}
+
+	client, err := rpcclient.New(&rpcclient.ConnConfig{HTTPPostMode: true, DisableTLS: true}, nil)
+	require.NoError(t, err)
+
+	mp.On("InitBtcRpcClient").Return(client, nil)
+
+	db := newTestDB(t)
+
+	mp.On("InitDBConnection").Return(db, nil)
+
+	alerter := newTestAlerter()
+
+	// a single error of the service would stop the application
+	Start(ctx, cancel, &infrastructure.Config{
+		WorkerFailureRetryDelay: 1 * time.Second,
+		ServiceMaxErrorCount:    1,
+	}, mps, mp, services.NewWalletLocks(), newTestLeader(t), alerter, resilience.NewBreakers(3, time.Minute), schedule.Every(50*time.Millisecond), NewControl("pay"))
+
+	mps.AssertNumberOfCalls(t, "Execute", 3)
+	alerter.AssertCalled(t, "Fire", mock.Anything, "pay worker", mock.MatchedBy(func(notification notifier.Notification) bool {
+		return notification.Title == "Dependency unavailable"
+	}))
+	alerter.AssertCalled(t, "Resolve", mock.Anything, "pay worker")
+}
+
+func TestWorkerShouldCountRecordedDependencyFailuresAsDependencyErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	breakers := resilience.NewBreakers(3, time.Minute)
+
+	mps := &mockPayService{}
+	// hasura failed, but not often enough to open its breaker
+	mps.On("Execute", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("failed to get collections")).Run(func(args mock.Arguments) {
+		breakers.Get(metrics.EndpointHasura).Record(true)
+	}).Twice()
+	mps.On("Execute", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		cancel()
+	})
+
+	mp := &mockProvider{}
+
+	client, err := rpcclient.New(&rpcclient.ConnConfig{HTTPPostMode: true, DisableTLS: true}, nil)
+	require.NoError(t, err)
+
+	mp.On("InitBtcRpcClient").Return(client, nil)
+	mp.On("InitDBConnection").Return(newTestDB(t), nil)
+
+	alerter := newTestAlerter()
+
+	Start(ctx, cancel, &infrastructure.Config{
+		WorkerFailureRetryDelay: 1 * time.Second,
+		ServiceMaxErrorCount:    1,
+	}, mps, mp, services.NewWalletLocks(), newTestLeader(t), alerter, breakers, schedule.Every(50*time.Millisecond), NewControl("pay"))
+
+	mps.AssertNumberOfCalls(t, "Execute", 3)
+	require.Equal(t, resilience.StateClosed, breakers.Get(metrics.EndpointHasura).State())
+	alerter.AssertNotCalled(t, "Fire", mock.Anything, "pay worker", mock.MatchedBy(func(notification notifier.Notification) bool {
+		return notification.Title == "Application stopped"
+	}))
+}
+
+func TestWorkerShouldResetErrorCountAfterSuccessfulRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mps := &mockPayService{}
+	mps.On("Execute", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("first error")).Once()
+	mps.On("Execute", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	mps.On("Execute", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("second error")).Once()
+	mps.On("Execute", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		cancel()
+	})
+
+	mp := &mockProvider{}
+
+	client, err := rpcclient.New(&rpcclient.ConnConfig{HTTPPostMode: true, DisableTLS: true}, nil)
+	require.NoError(t, err)
+
+	mp.On("InitBtcRpcClient").Return(client, nil)
+	// the connection is closed after every error of the service
+	mp.On("InitDBConnection").Return(newTestDB(t), nil).Once()
+	mp.On("InitDBConnection").Return(newTestDB(t), nil).Once()
+	mp.On("InitDBConnection").Return(newTestDB(t), nil)
+
+	alerter := newTestAlerter()
+
+	// two errors in a row would stop the application
+	Start(ctx, cancel, &infrastructure.Config{
+		WorkerFailureRetryDelay: 10 * time.Millisecond,
+		ServiceMaxErrorCount:    2,
+	}, mps, mp, services.NewWalletLocks(), newTestLeader(t), alerter, resilience.NewBreakers(3, time.Minute), schedule.Every(10*time.Millisecond), NewControl("pay"))
+
+	mps.AssertNumberOfCalls(t, "Execute", 4)
+	alerter.AssertNotCalled(t, "Fire", mock.Anything, "pay worker", mock.MatchedBy(func(notification notifier.Notification) bool {
+		return notification.Title == "Application stopped"
+	}))
+}
+
 func TestWorkerShouldRetryIfRpcConnectionFails(t *testing.T) {
 	mp := &mockProvider{}
 
@@ -82,7 +302,7 @@ func TestWorkerShouldRetryIfRpcConnectionFails(t *testing.T) {
 
 	go Start(ctx, cancel, &infrastructure.Config{
 		WorkerFailureRetryDelay: 200 * time.Millisecond,
-	}, nil, mp, &sync.Mutex{}, 200*time.Millisecond)
+	}, nil, mp, services.NewWalletLocks(), newTestLeader(t), newTestAlerter(), resilience.NewBreakers(3, time.Minute), schedule.Every(200*time.Millisecond), NewControl("test"))
 
 	time.Sleep(1 * time.Second)
 
@@ -104,8 +324,7 @@ func TestWorkerShouldRetryIfDbConnectionFails(t *testing.T) {
 
 	mp.On("InitBtcRpcClient").Return(client, nil)
 
-	db, err := sqlx.Connect("sqlite3", ":memory:")
-	require.NoError(t, err)
+	db := newTestDB(t)
 
 	mp.On("InitDBConnection").Return(db, errors.New("should fail"))
 
@@ -113,7 +332,7 @@ func TestWorkerShouldRetryIfDbConnectionFails(t *testing.T) {
 
 	go Start(ctx, cancel, &infrastructure.Config{
 		WorkerFailureRetryDelay: 200 * time.Millisecond,
-	}, nil, mp, &sync.Mutex{}, 200*time.Millisecond)
+	}, nil, mp, services.NewWalletLocks(), newTestLeader(t), newTestAlerter(), resilience.NewBreakers(3, time.Minute), schedule.Every(200*time.Millisecond), NewControl("test"))
 
 	time.Sleep(1 * time.Second)
 
@@ -128,37 +347,89 @@ func TestMaxErrorCountReached(t *testing.T) {
 	}
 	err := errors.New("test error")
 
-	var receivedConfig *infrastructure.Config
-	var receivedMessage string
+	alerter := &mockAlerter{}
+	alerter.On("Fire", mock.Anything, "pay worker", mock.Anything).Return()
 
-	// Temporarily replace mSendMail function with a mock function
-	tempSendMail := mSendMail
-	mSendMail = func(config *infrastructure.Config, message string) {
-		receivedConfig = config
-		receivedMessage = message
-	}
-	defer func() { mSendMail = tempSendMail }() // Restore original function after the test
+	maxErrorCountReached(context.Background(), config, alerter, "pay", err)
+
+	notification := alerter.Calls[0].Arguments.Get(2).(notifier.Notification)
+	assert.Equal(t, notifier.SeverityCritical, notification.Severity)
+	assert.Contains(t, notification.Message, "Application has exceeded the ServiceMaxErrorCount", "Expected message to contain error")
+	assert.Equal(t, "test error", notification.Error)
+}
+
+func TestWorkerShouldResolveAlertsAfterSuccessfulRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mps := &mockPayService{}
+	mps.On("Execute", mock.Anything, mock.Anything, mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		cancel()
+	})
+
+	mp := &mockProvider{}
+
+	client, err := rpcclient.New(&rpcclient.ConnConfig{HTTPPostMode: true, DisableTLS: true}, nil)
+	require.NoError(t, err)
+
+	mp.On("InitBtcRpcClient").Return(client, nil)
+
+	db := newTestDB(t)
+
+	mp.On("InitDBConnection").Return(db, nil)
 
-	maxErrorCountReached(config, err)
+	alerter := &mockAlerter{}
+	alerter.On("Resolve", mock.Anything, "pay worker").Return()
 
-	assert.Equal(t, config, receivedConfig, "Expected config to be passed to sendMail")
-	assert.Contains(t, receivedMessage, "Application has exceeded the ServiceMaxErrorCount", "Expected message to contain error")
+	Start(ctx, cancel, &infrastructure.Config{
+		WorkerFailureRetryDelay: 1 * time.Second,
+	}, mps, mp, services.NewWalletLocks(), newTestLeader(t), alerter, resilience.NewBreakers(3, time.Minute), schedule.Every(100*time.Millisecond), NewControl("pay"))
+
+	alerter.AssertCalled(t, "Resolve", mock.Anything, "pay worker")
+	alerter.AssertNotCalled(t, "Fire", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// newTestDB returns an in-memory db with the schema the workers expect
+func newTestDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Connect("sqlite3", ":memory:")
+	require.NoError(t, err)
+
+	// every connection to :memory: opens its own empty db
+	db.SetMaxOpenConns(1)
+
+	_, err = sql_db.NewSqlDB(db).MigrateUp(context.Background())
+	require.NoError(t, err)
+
+	return db
 }
 
-// MockHelper is a mock of the infrastructure.Helper
-type MockHelper struct {
+type mockAlerter struct {
 	mock.Mock
 }
 
-func (m *MockHelper) SendMail(message string) error {
-	args := m.Called(message)
-	return args.Error(0)
+// newTestAlerter returns an alerter that accepts all alerts
+func newTestAlerter() *mockAlerter {
+	alerter := &mockAlerter{}
+	alerter.On("Fire", mock.Anything, mock.Anything, mock.Anything).Return().Maybe()
+	alerter.On("Resolve", mock.Anything, mock.Anything).Return().Maybe()
+	return alerter
+}
+
+func (ma *mockAlerter) Fire(ctx context.Context, source string, notification notifier.Notification) {
+	ma.Called(ctx, source, notification)
+}
+
+func (ma *mockAlerter) Resolve(ctx context.Context, source string) {
+	ma.Called(ctx, source)
 }
 
 type mockPayService struct {
 	mock.Mock
 }
 
+func (mps *mockPayService) Dependencies() []string {
+	return []string{metrics.EndpointBitcoind, metrics.EndpointHasura}
+}
+
 func (mps *mockPayService) Execute(ctx context.Context, btcClient services.BtcClient, storage services.Storage) error {
 	args := mps.Called(ctx, btcClient, storage)
 	return args.Error(0)
@@ -176,6 +447,11 @@ func (mp *mockProvider) InitBtcRpcClient() (*rpcclient.Client, error) {
 	return args.Get(0).(*rpcclient.Client), args.Error(1)
 }
 
+func (mp *mockProvider) InitBtcWalletRpcClient(walletName string) (*rpcclient.Client, error) {
+	args := mp.Called(walletName)
+	return args.Get(0).(*rpcclient.Client), args.Error(1)
+}
+
 func (mp *mockProvider) InitDBConnection() (*sqlx.DB, error) {
 	mp.initDbConnectionCallsCount += 1
 	args := mp.Called()